@@ -0,0 +1,233 @@
+package main
+
+import (
+    "fmt"
+    "math"
+)
+
+// how much of a shake or kick is left with ReduceShake on
+const REDUCEDSHAKE = 0.2
+
+// how far the UI scale goes either way
+const UISCALEMIN, UISCALEMAX = 0.5, 3
+
+// a post-process pass that shifts colors apart for a kind of color blindness
+type ColorFilter string
+
+const (
+    ColorFilterNone ColorFilter = "none"
+    // red-blind
+    ColorFilterProtanopia ColorFilter = "protanopia"
+    // green-blind, the most common
+    ColorFilterDeuteranopia ColorFilter = "deuteranopia"
+    // blue-blind
+    ColorFilterTritanopia ColorFilter = "tritanopia"
+)
+
+var COLORFILTERS = []ColorFilter{ColorFilterNone, ColorFilterProtanopia, ColorFilterDeuteranopia, ColorFilterTritanopia}
+
+func ParseColorFilter(s string) (ColorFilter, error) {
+    for _, f := range COLORFILTERS {
+        if string(f) == s {
+            return f, nil
+        }
+    }
+    return ColorFilterNone, fmt.Errorf("unknown color filter %q", s)
+}
+
+// the filter after f, wrapping round to none, e.g. for an options button that steps through them
+func (f ColorFilter) Next() ColorFilter {
+    for i, other := range COLORFILTERS {
+        if other == f {
+            return COLORFILTERS[(i+1)%len(COLORFILTERS)]
+        }
+    }
+    return ColorFilterNone
+}
+
+type AccessibilitySettings struct {
+    ColorFilter ColorFilter `json:"color_filter"`
+    // 0 to 1, how far the filter shifts colors
+    FilterStrength float64 `json:"filter_strength"`
+    // scales the UI, dialogues, tooltips and inventories and their text, 1 as designed
+    UIScale float64 `json:"ui_scale"`
+    // cuts camera shake and kicks down to REDUCEDSHAKE
+    ReduceShake bool `json:"reduce_shake"`
+}
+
+// the accessibility options in effect. the post processor, the camera and the UI read it as they
+// draw, so changes show straight away.
+type Accessibility struct {
+    settings AccessibilitySettings
+    filter   *PostEffect
+    onChange []func(AccessibilitySettings) error
+}
+
+func NewAccessibility() *Accessibility {
+    a := &Accessibility{filter: ColorblindEffect(ColorFilterNone, 1)}
+    a.Set(DefaultSettings().Accessibility)
+    return a
+}
+
+// takes on s, e.g. the saved settings, without telling OnChange
+func (a *Accessibility) Set(s AccessibilitySettings) {
+    if _, err := ParseColorFilter(string(s.ColorFilter)); err != nil {
+        settingsLog.Warnf("%v", err)
+        s.ColorFilter = ColorFilterNone
+    }
+    s.FilterStrength = math.Max(0, math.Min(1, s.FilterStrength))
+    if s.UIScale <= 0 {
+        s.UIScale = 1
+    }
+    s.UIScale = math.Max(UISCALEMIN, math.Min(UISCALEMAX, s.UIScale))
+    a.settings = s
+    a.filter.Enabled = s.ColorFilter != ColorFilterNone
+    a.filter.Set("uMode", colorFilterMode(s.ColorFilter))
+    a.filter.Set("uStrength", float32(s.FilterStrength))
+}
+
+func (a *Accessibility) Settings() AccessibilitySettings {
+    return a.settings
+}
+
+// registers fn to run with the settings whenever one of the Set methods changes them
+func (a *Accessibility) OnChange(fn func(AccessibilitySettings) error) {
+    a.onChange = append(a.onChange, fn)
+}
+
+func (a *Accessibility) change(s AccessibilitySettings) {
+    a.Set(s)
+    for _, fn := range a.onChange {
+        if err := fn(a.settings); err != nil {
+            settingsLog.Errorf("accessibility: %v", err)
+        }
+    }
+}
+
+func (a *Accessibility) SetColorFilter(f ColorFilter) {
+    s := a.settings
+    s.ColorFilter = f
+    a.change(s)
+}
+
+func (a *Accessibility) SetFilterStrength(strength float64) {
+    s := a.settings
+    s.FilterStrength = strength
+    a.change(s)
+}
+
+func (a *Accessibility) SetUIScale(scale float64) {
+    s := a.settings
+    s.UIScale = scale
+    a.change(s)
+}
+
+func (a *Accessibility) SetReduceShake(reduce bool) {
+    s := a.settings
+    s.ReduceShake = reduce
+    a.change(s)
+}
+
+func (a *Accessibility) UIScale() float64 {
+    return a.settings.UIScale
+}
+
+// what camera shake and kicks are multiplied by
+func (a *Accessibility) ShakeScale() float64 {
+    if a.settings.ReduceShake {
+        return REDUCEDSHAKE
+    }
+    return 1
+}
+
+// the color filter pass, disabled while there's no filter; Run puts it last in the post chain
+func (a *Accessibility) Filter() *PostEffect {
+    return a.filter
+}
+
+func colorFilterMode(f ColorFilter) float32 {
+    switch f {
+    case ColorFilterDeuteranopia:
+        return 1
+    case ColorFilterTritanopia:
+        return 2
+    }
+    return 0
+}
+
+// daltonizes the screen for filter: works out what someone with it would see, and moves the
+// difference into the colors they can tell apart. strength 0 to 1 blends it in.
+func ColorblindEffect(filter ColorFilter, strength float32) *PostEffect {
+    e := NewPostEffect("colorblind", SHADERCOLORBLIND, map[string]float32{
+        "uMode":     colorFilterMode(filter),
+        "uStrength": strength,
+    })
+    e.Enabled = filter != ColorFilterNone
+    return e
+}
+
+const SHADERCOLORBLIND = gradeShaderHeader + `
+uniform float uMode;
+uniform float uStrength;
+
+void main() {
+    vec2 t = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
+    vec4 c = texture(uTexture, t);
+    vec3 rgb = clamp(straight(c), 0.0, 1.0);
+
+    // into the responses of the eye's long, medium and short cones
+    vec3 lms = vec3(
+        dot(rgb, vec3(17.8824, 43.5161, 4.11935)),
+        dot(rgb, vec3(3.45565, 27.1554, 3.86714)),
+        dot(rgb, vec3(0.0299566, 0.184309, 1.46709))
+    );
+    // with the missing cone made up from the other two
+    if (uMode < 0.5) {
+        lms.x = 2.02344 * lms.y - 2.52581 * lms.z;
+    } else if (uMode < 1.5) {
+        lms.y = 0.494207 * lms.x + 1.24827 * lms.z;
+    } else {
+        lms.z = -0.395913 * lms.x + 0.801109 * lms.y;
+    }
+    vec3 seen = vec3(
+        dot(lms, vec3(0.0809444479, -0.130504409, 0.116721066)),
+        dot(lms, vec3(-0.0102485335, 0.0540193266, -0.113614708)),
+        dot(lms, vec3(-0.000365296938, -0.00412161469, 0.693511405))
+    );
+    vec3 lost = rgb - seen;
+    vec3 shift = vec3(0.0, 0.7 * lost.r + lost.g, 0.7 * lost.r + lost.b);
+    vec3 corrected = clamp(rgb + shift, 0.0, 1.0);
+
+    fragColor = vec4(mix(rgb, corrected, uStrength) * c.a, c.a);
+}
+`
+
+func registerAccessibilityCommands(c *Console, a *Accessibility) {
+    c.Register("colorfilter", "shows the color blindness filter, or switches to none, protanopia, deuteranopia or tritanopia", func(args ConsoleArgs) error {
+        if !args.Has(0) {
+            c.Printf("%s", a.Settings().ColorFilter)
+            return nil
+        }
+        f, err := ParseColorFilter(args.String(0))
+        if err != nil {
+            return err
+        }
+        a.SetColorFilter(f)
+        return nil
+    }, StringArg("filter").Opt())
+    c.Register("uiscale", "shows or sets how big the UI and its text are drawn, 1 as designed", func(args ConsoleArgs) error {
+        if args.Has(0) {
+            a.SetUIScale(args.Float(0))
+        }
+        c.Printf("%g", a.UIScale())
+        return nil
+    }, FloatArg("scale").Opt())
+    c.Register("reduceshake", "turns reduced screen shake on or off", func(args ConsoleArgs) error {
+        on := !a.Settings().ReduceShake
+        if args.Has(0) {
+            on = args.Bool(0)
+        }
+        a.SetReduceShake(on)
+        return nil
+    }, BoolArg("on").Opt())
+}
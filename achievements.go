@@ -0,0 +1,407 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "reflect"
+    "sort"
+    "time"
+
+    "github.com/faiface/pixel"
+)
+
+var statsLog = logging.Module("stats")
+
+// the save slot Stats keeps its progress in
+const STATSSLOT = "stats"
+
+// what a stat's "on" can name, as gameplay structs published on the event bus
+var statEvents = map[string]reflect.Type{}
+
+// lets the stats file count an event, e.g. RegisterStatEvent("enemy_died", EnemyDied{}) for a
+// stat with "on": "enemy_died"
+func RegisterStatEvent(name string, example interface{}) {
+    t := reflect.TypeOf(example)
+    if t == nil || t.Kind() != reflect.Struct {
+        panic(fmt.Sprintf("stats: event %T has to be a struct value", example))
+    }
+    if _, ok := statEvents[name]; ok {
+        panic(fmt.Sprintf("stats: event %q registered twice", name))
+    }
+    statEvents[name] = t
+}
+
+// publish it to change a stat from anywhere without registering an event for it, e.g.
+// events.Publish(StatEvent{"gold_found", 25})
+type StatEvent struct {
+    Stat   string
+    Amount float64
+}
+
+// something the game counts
+type StatDef struct {
+    Name string `json:"name"`
+    // "max" keeps the highest it's been set to, like a best score, and "min" the lowest, like a
+    // fastest time; otherwise every change adds up
+    Keep string `json:"keep"`
+    // a RegisterStatEvent name; each one published counts 1, or the value of its Field
+    On    string `json:"on"`
+    Field string `json:"field"`
+}
+
+// a milestone: it unlocks when Stat reaches Goal, or when the game calls Unlock if there's no Stat
+type AchievementDef struct {
+    Title string `json:"title"`
+    Text  string `json:"text"`
+    // a picture asset shown on the toast
+    Icon string  `json:"icon"`
+    Stat string  `json:"stat"`
+    Goal float64 `json:"goal"`
+    // left out of lists until it's unlocked
+    Hidden bool `json:"hidden"`
+}
+
+// the definitions, as a data file:
+//
+//	{
+//		"stats": {
+//			"enemies_killed": {"name": "Enemies defeated", "on": "enemy_died"},
+//			"damage_dealt": {"name": "Damage dealt", "on": "enemy_hit", "field": "Damage"},
+//			"best_score": {"name": "Best score", "keep": "max"}
+//		},
+//		"achievements": {
+//			"first_blood": {"title": "First Blood", "text": "Defeat an enemy.", "icon": "icons/sword.png", "stat": "enemies_killed", "goal": 1},
+//			"centurion": {"title": "Centurion", "text": "Defeat 100 enemies.", "stat": "enemies_killed", "goal": 100},
+//			"secret": {"title": "Who's There?", "text": "Find the hidden room.", "hidden": true}
+//		}
+//	}
+type StatsFile struct {
+    Stats        map[string]StatDef        `json:"stats"`
+    Achievements map[string]AchievementDef `json:"achievements"`
+}
+
+// the player's progress, which is what gets saved
+type StatsState struct {
+    Values   map[string]float64   `json:"stats"`
+    Unlocked map[string]time.Time `json:"unlocked"`
+}
+
+// an achievement and how far along it is
+type AchievementProgress struct {
+    ID string
+    AchievementDef
+    // the stat's value, up to Goal
+    Value    float64
+    Unlocked bool
+    When     time.Time
+}
+
+// counters and achievements from a stats file, kept by the game across sessions. gameplay
+// doesn't call it: stats count the events they're set to, and an achievement whose stat reaches
+// its goal unlocks with a toast. set Saves, then Restore, to keep progress between runs; it saves
+// whenever something unlocks and as the game closes.
+type Stats struct {
+    Saves *SaveManager
+    // STATSSLOT when ""
+    Slot string
+
+    defs     StatsFile
+    state    StatsState
+    subs     []Subscription
+    onUnlock []func(id string, a AchievementDef)
+}
+
+func NewStats() *Stats {
+    return &Stats{state: StatsState{Values: map[string]float64{}, Unlocked: map[string]time.Time{}}}
+}
+
+// reads the definitions from a JSON asset and starts counting their events, replacing any loaded
+// before. progress already made stays.
+func (s *Stats) Load(name string) error {
+    data, err := ReadAsset(name)
+    if err != nil {
+        return err
+    }
+    var defs StatsFile
+    if err := json.Unmarshal(data, &defs); err != nil {
+        return fmt.Errorf("%s: %v", name, err)
+    }
+    if err := defs.check(); err != nil {
+        return fmt.Errorf("%s: %v", name, err)
+    }
+    s.Define(defs)
+    return nil
+}
+
+func (f *StatsFile) check() error {
+    for id, def := range f.Stats {
+        switch def.Keep {
+        case "", "sum", "max", "min":
+        default:
+            return fmt.Errorf("stat %s keeps %q, not sum, max or min", id, def.Keep)
+        }
+        if def.On == "" {
+            continue
+        }
+        t, ok := statEvents[def.On]
+        if !ok {
+            return fmt.Errorf("stat %s is on %q, which isn't a registered event", id, def.On)
+        }
+        if def.Field != "" {
+            field, ok := t.FieldByName(def.Field)
+            if !ok || !numericKind(field.Type.Kind()) {
+                return fmt.Errorf("stat %s counts %s.%s, which isn't a number field", id, t.Name(), def.Field)
+            }
+        }
+    }
+    for id, a := range f.Achievements {
+        if _, ok := f.Stats[a.Stat]; a.Stat != "" && !ok {
+            return fmt.Errorf("achievement %s is on %q, which isn't a stat", id, a.Stat)
+        }
+    }
+    return nil
+}
+
+func numericKind(k reflect.Kind) bool {
+    return k >= reflect.Int && k <= reflect.Float64 && k != reflect.Uintptr
+}
+
+// like Load, with the definitions made in code
+func (s *Stats) Define(defs StatsFile) {
+    for _, sub := range s.subs {
+        events.Unsubscribe(sub)
+    }
+    s.subs = s.subs[:0]
+    s.defs = defs
+    s.subs = append(s.subs, events.Subscribe(func(e StatEvent) {
+        s.Add(e.Stat, e.Amount)
+    }))
+    for id, def := range defs.Stats {
+        if def.On == "" {
+            continue
+        }
+        id, field := id, def.Field
+        t := statEvents[def.On]
+        handler := reflect.MakeFunc(reflect.FuncOf([]reflect.Type{t}, nil, false), func(args []reflect.Value) []reflect.Value {
+            amount := 1.0
+            if field != "" {
+                v := args[0].FieldByName(field)
+                switch {
+                case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+                    amount = float64(v.Int())
+                case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+                    amount = float64(v.Uint())
+                default:
+                    amount = v.Float()
+                }
+            }
+            s.Add(id, amount)
+            return nil
+        })
+        s.subs = append(s.subs, events.Subscribe(handler.Interface()))
+    }
+    // goals may have changed under progress already made
+    for id := range defs.Stats {
+        s.check(id)
+    }
+}
+
+// registers fn for each achievement as it unlocks, after its toast's queued
+func (s *Stats) OnUnlock(fn func(id string, a AchievementDef)) {
+    s.onUnlock = append(s.onUnlock, fn)
+}
+
+// the value of stat, 0 until it's changed
+func (s *Stats) Value(stat string) float64 {
+    return s.state.Values[stat]
+}
+
+// counts amount towards stat: added for a sum, or kept if it beats the best for max and min
+func (s *Stats) Add(stat string, amount float64) {
+    def, ok := s.defs.Stats[stat]
+    if !ok {
+        statsLog.Warnf("no stat %q", stat)
+        return
+    }
+    old, seen := s.state.Values[stat]
+    switch def.Keep {
+    case "max":
+        if seen {
+            amount = math.Max(old, amount)
+        }
+    case "min":
+        if seen {
+            amount = math.Min(old, amount)
+        }
+    default:
+        amount += old
+    }
+    s.state.Values[stat] = amount
+    s.check(stat)
+}
+
+// unlocks what stat's reached
+func (s *Stats) check(stat string) {
+    for id, a := range s.defs.Achievements {
+        if a.Stat == stat && a.Goal > 0 && s.Value(stat) >= a.Goal {
+            s.Unlock(id)
+        }
+    }
+}
+
+func (s *Stats) Unlocked(id string) bool {
+    _, ok := s.state.Unlocked[id]
+    return ok
+}
+
+// unlocks an achievement now, showing its toast and saving, unless it already is
+func (s *Stats) Unlock(id string) {
+    a, ok := s.defs.Achievements[id]
+    if !ok {
+        statsLog.Warnf("no achievement %q", id)
+        return
+    }
+    if s.Unlocked(id) {
+        return
+    }
+    s.state.Unlocked[id] = time.Now()
+    statsLog.Infof("unlocked %s", id)
+    toasts.Show(Toast{Icon: achievementIcon(a.Icon), Title: a.Title, Text: a.Text})
+    for _, fn := range s.onUnlock {
+        fn(id, a)
+    }
+    if s.Saves != nil {
+        if err := s.Save(); err != nil {
+            statsLog.Errorf("%v", err)
+        }
+    }
+}
+
+func achievementIcon(path string) *pixel.Sprite {
+    if path == "" {
+        return nil
+    }
+    pic, err := LoadPicture(path)
+    if err != nil {
+        statsLog.Warnf("%v", err)
+        return nil
+    }
+    return pixel.NewSprite(pic, pic.Bounds())
+}
+
+// every achievement with its progress, unlocked ones first, leaving out hidden ones still locked
+func (s *Stats) Achievements() []AchievementProgress {
+    var list []AchievementProgress
+    for id, a := range s.defs.Achievements {
+        when, unlocked := s.state.Unlocked[id]
+        if a.Hidden && !unlocked {
+            continue
+        }
+        p := AchievementProgress{ID: id, AchievementDef: a, Unlocked: unlocked, When: when}
+        if a.Stat != "" {
+            p.Value = math.Min(s.Value(a.Stat), a.Goal)
+        }
+        list = append(list, p)
+    }
+    sort.Slice(list, func(i, j int) bool {
+        if list[i].Unlocked != list[j].Unlocked {
+            return list[i].Unlocked
+        }
+        return list[i].ID < list[j].ID
+    })
+    return list
+}
+
+// the progress, e.g. to keep it in the game's own save instead of STATSSLOT
+func (s *Stats) State() StatsState {
+    return s.state
+}
+
+// puts progress back, unlocking anything it's already enough for without a toast
+func (s *Stats) SetState(state StatsState) {
+    if state.Values == nil {
+        state.Values = map[string]float64{}
+    }
+    if state.Unlocked == nil {
+        state.Unlocked = map[string]time.Time{}
+    }
+    s.state = state
+    for id, a := range s.defs.Achievements {
+        if a.Stat != "" && a.Goal > 0 && s.Value(a.Stat) >= a.Goal && !s.Unlocked(id) {
+            s.state.Unlocked[id] = time.Now()
+        }
+    }
+}
+
+func (s *Stats) slot() string {
+    if s.Slot == "" {
+        return STATSSLOT
+    }
+    return s.Slot
+}
+
+// writes the progress to Saves
+func (s *Stats) Save() error {
+    if s.Saves == nil {
+        return fmt.Errorf("stats: no Saves to save to")
+    }
+    return s.Saves.Save(s.slot(), s.state)
+}
+
+// reads the progress back from Saves; a first run with nothing saved yet starts from nothing
+func (s *Stats) Restore() error {
+    if s.Saves == nil {
+        return fmt.Errorf("stats: no Saves to restore from")
+    }
+    if !s.Saves.Exists(s.slot()) {
+        return nil
+    }
+    var state StatsState
+    if _, err := s.Saves.Load(s.slot(), &state); err != nil {
+        return err
+    }
+    s.SetState(state)
+    return nil
+}
+
+// starts over, e.g. from a reset button in the settings
+func (s *Stats) Reset() {
+    s.state = StatsState{Values: map[string]float64{}, Unlocked: map[string]time.Time{}}
+}
+
+func registerStatsCommands(c *Console, s *Stats) {
+    c.Register("stats", "prints every stat and achievement", func(args ConsoleArgs) error {
+        var ids []string
+        for id := range s.defs.Stats {
+            ids = append(ids, id)
+        }
+        sort.Strings(ids)
+        for _, id := range ids {
+            c.Printf("%-20s %g", id, s.Value(id))
+        }
+        for _, a := range s.Achievements() {
+            mark := " "
+            if a.Unlocked {
+                mark = "x"
+            }
+            c.Printf("[%s] %-16s %g/%g", mark, a.ID, a.Value, a.Goal)
+        }
+        return nil
+    })
+    c.Register("stat", "adds to a stat, to try out its achievements", func(args ConsoleArgs) error {
+        if _, ok := s.defs.Stats[args.String(0)]; !ok {
+            return fmt.Errorf("no stat %q", args.String(0))
+        }
+        s.Add(args.String(0), args.Float(1))
+        c.Printf("%s = %g", args.String(0), s.Value(args.String(0)))
+        return nil
+    }, StringArg("stat"), FloatArg("amount"))
+    c.Register("unlock", "unlocks an achievement", func(args ConsoleArgs) error {
+        if _, ok := s.defs.Achievements[args.String(0)]; !ok {
+            return fmt.Errorf("no achievement %q", args.String(0))
+        }
+        s.Unlock(args.String(0))
+        return nil
+    }, StringArg("id"))
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+    "sort"
+
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// how many seconds of game time Consume remembers a press for, e.g. a jump pressed just before
+// landing
+const INPUTBUFFER = 0.1
+
+// named actions like "jump" or "fire" read through their bindings, so game code asks
+// actions.JustPressed("jump") and the player decides which keys and pad controls that means. an
+// action is held while any of its bindings is, and just pressed on the frame the first goes down.
+type Actions struct {
+    // shared with the settings, so rebinding is saved with them
+    Bindings KeyBindings
+    Pad      PadBindings
+    // whose gamepad counts, as Gamepads assigns them; -1 for none
+    Player int
+    // whether the keyboard and mouse count, e.g. off for a second player on a pad
+    Keyboard bool
+    DeadZone float64
+    // the default Consume window, in seconds; SetBuffer changes it per action
+    BufferTime float64
+
+    values map[string]float64
+    // set by on-screen controls, see SetVirtual
+    virtual        map[string]float64
+    held, previous map[string]bool
+    // game time each action was last pressed, until it's consumed
+    pressedAt map[string]float64
+    buffers   map[string]float64
+    rebinding string
+    slot      int
+    // the rebind ended this frame, so the key that ended it is spent
+    rebound  bool
+    onChange []func(KeyBindings, PadBindings) error
+}
+
+// the first player's actions. a game with more players makes one Actions per player, sets its
+// Player and calls its Update each frame along with the built-in one.
+func NewActions(keys KeyBindings, pad PadBindings) *Actions {
+    if keys == nil {
+        keys = make(KeyBindings)
+    }
+    if pad == nil {
+        pad = make(PadBindings)
+    }
+    return &Actions{
+        Bindings:   keys,
+        Pad:        pad,
+        Keyboard:   true,
+        DeadZone:   PADDEADZONE,
+        BufferTime: INPUTBUFFER,
+        values:     make(map[string]float64),
+        virtual:    make(map[string]float64),
+        held:       make(map[string]bool),
+        previous:   make(map[string]bool),
+        pressedAt:  make(map[string]float64),
+        buffers:    make(map[string]float64),
+    }
+}
+
+// registers fn to run with the bindings whenever they change, e.g. to save the settings
+func (a *Actions) OnChange(fn func(KeyBindings, PadBindings) error) {
+    a.onChange = append(a.onChange, fn)
+}
+
+func (a *Actions) changed() {
+    for _, fn := range a.onChange {
+        if err := fn(a.Bindings, a.Pad); err != nil {
+            settingsLog.Errorf("key bindings: %v", err)
+        }
+    }
+}
+
+// the player's pad, or -1
+func (a *Actions) joystick() pixelgl.Joystick {
+    if a.Player < 0 || gamepads == nil {
+        return -1
+    }
+    return gamepads.Joystick(a.Player)
+}
+
+// reads this frame's state of every action from in, and finishes a Rebind if something was
+// pressed. call it once per frame before anything asks about actions; simulate does.
+func (a *Actions) Update(in Input) {
+    a.previous, a.held = a.held, a.previous
+    for action := range a.held {
+        delete(a.held, action)
+    }
+    for action := range a.values {
+        delete(a.values, action)
+    }
+    a.rebound = false
+    if a.rebinding != "" {
+        a.captureRebind(in)
+        a.rebound = a.rebinding == ""
+        // what was just bound shouldn't also fire its new action
+        return
+    }
+    if a.Keyboard {
+        for action, buttons := range a.Bindings {
+            for _, b := range buttons {
+                if in.Pressed(b) {
+                    a.values[action] = 1
+                    break
+                }
+            }
+        }
+    }
+    if js := a.joystick(); js >= 0 {
+        for action, controls := range a.Pad {
+            for _, c := range controls {
+                if v := c.value(in, js, a.DeadZone); v > a.values[action] {
+                    a.values[action] = v
+                }
+            }
+        }
+    }
+    for action, v := range a.virtual {
+        if v > a.values[action] {
+            a.values[action] = v
+        }
+    }
+    for action, v := range a.values {
+        if v >= PADPRESSTHRESHOLD {
+            a.held[action] = true
+            if !a.previous[action] {
+                a.pressedAt[action] = clock.Total()
+            }
+        }
+    }
+}
+
+// pushes action to v, 0 to 1, alongside its bindings until ClearVirtual, for input that isn't a
+// key or pad, like VirtualControls
+func (a *Actions) SetVirtual(action string, v float64) {
+    if v > 0 {
+        a.virtual[action] = v
+    }
+}
+
+func (a *Actions) ClearVirtual() {
+    for action := range a.virtual {
+        delete(a.virtual, action)
+    }
+}
+
+// how far the action is pushed, 0 to 1: 1 for a key or button, partway for a stick or trigger
+func (a *Actions) Value(action string) float64 {
+    return a.values[action]
+}
+
+func (a *Actions) Pressed(action string) bool {
+    return a.held[action]
+}
+
+func (a *Actions) JustPressed(action string) bool {
+    return a.held[action] && !a.previous[action]
+}
+
+func (a *Actions) JustReleased(action string) bool {
+    return !a.held[action] && a.previous[action]
+}
+
+// -1 to 1 from a pair of opposing actions, e.g. Axis("left", "right"); analog on a stick
+func (a *Actions) Axis(negative, positive string) float64 {
+    return a.Value(positive) - a.Value(negative)
+}
+
+// sets how long action's presses wait to be consumed, in seconds; 0 only counts this frame's
+func (a *Actions) SetBuffer(action string, seconds float64) {
+    a.buffers[action] = seconds
+}
+
+func (a *Actions) bufferTime(action string) float64 {
+    if seconds, ok := a.buffers[action]; ok {
+        return seconds
+    }
+    return a.BufferTime
+}
+
+// whether action was pressed within its buffer window and hasn't been consumed, without
+// consuming it
+func (a *Actions) Buffered(action string) bool {
+    at, ok := a.pressedAt[action]
+    return ok && clock.Total()-at <= a.bufferTime(action)
+}
+
+// true once for each press of action, if it's asked within the buffer window; the game asks
+// when the action becomes possible, e.g. if onGround && actions.Consume("jump"), so a press a
+// little early still counts
+func (a *Actions) Consume(action string) bool {
+    if !a.Buffered(action) {
+        return false
+    }
+    delete(a.pressedAt, action)
+    return true
+}
+
+// forgets a press waiting to be consumed, e.g. when a cutscene starts
+func (a *Actions) ClearBuffer(action string) {
+    delete(a.pressedAt, action)
+}
+
+// sets action's buttons, replacing the ones it had
+func (a *Actions) Bind(action string, buttons ...pixelgl.Button) {
+    a.Bindings[action] = append([]pixelgl.Button(nil), buttons...)
+    a.changed()
+}
+
+// adds b to action's buttons unless it's there already
+func (a *Actions) AddBinding(action string, b pixelgl.Button) {
+    for _, bound := range a.Bindings[action] {
+        if bound == b {
+            return
+        }
+    }
+    a.Bindings[action] = append(a.Bindings[action], b)
+    a.changed()
+}
+
+func (a *Actions) Unbind(action string, b pixelgl.Button) {
+    buttons := a.Bindings[action]
+    for i, bound := range buttons {
+        if bound == b {
+            a.Bindings[action] = append(buttons[:i:i], buttons[i+1:]...)
+            a.changed()
+            return
+        }
+    }
+}
+
+// sets action's gamepad controls, replacing the ones it had
+func (a *Actions) BindPad(action string, controls ...PadControl) {
+    a.Pad[action] = append([]PadControl(nil), controls...)
+    a.changed()
+}
+
+// the actions b is bound to, sorted, for warning about a key doing two things
+func (a *Actions) BoundTo(b pixelgl.Button) []string {
+    var actions []string
+    for action, buttons := range a.Bindings {
+        for _, bound := range buttons {
+            if bound == b {
+                actions = append(actions, action)
+                break
+            }
+        }
+    }
+    sort.Strings(actions)
+    return actions
+}
+
+// binds the next key, button or pad control the player presses to action, replacing its slot'th
+// binding of that kind or adding one when slot is past the end; Escape cancels. every action
+// reads as released until then, so an options screen can show "press a key" without the game
+// reacting.
+func (a *Actions) Rebind(action string, slot int) {
+    a.rebinding, a.slot = action, slot
+}
+
+func (a *Actions) CancelRebind() {
+    a.rebinding = ""
+}
+
+// the action waiting for a button, if any
+func (a *Actions) Rebinding() (string, bool) {
+    return a.rebinding, a.rebinding != ""
+}
+
+// whether this frame's Update finished or cancelled a rebind, so whatever else reads the same
+// key, like Escape for pause, can leave it alone
+func (a *Actions) Rebound() bool {
+    return a.rebound
+}
+
+func (a *Actions) captureRebind(in Input) {
+    action := a.rebinding
+    for b := pixelgl.Button(0); b <= pixelgl.KeyLast; b++ {
+        if !in.JustPressed(b) {
+            continue
+        }
+        a.rebinding = ""
+        if b == pixelgl.KeyEscape {
+            return
+        }
+        buttons := append([]pixelgl.Button(nil), a.Bindings[action]...)
+        if a.slot >= 0 && a.slot < len(buttons) {
+            buttons[a.slot] = b
+        } else {
+            buttons = append(buttons, b)
+        }
+        a.Bindings[action] = buttons
+        a.changed()
+        return
+    }
+    js := a.joystick()
+    if js < 0 {
+        return
+    }
+    var captured []PadControl
+    for b := pixelgl.GamepadButton(0); b <= pixelgl.ButtonLast; b++ {
+        if in.JoystickJustPressed(js, b) {
+            captured = append(captured, PadButton(b))
+        }
+    }
+    for axis := pixelgl.GamepadAxis(0); axis <= pixelgl.AxisLast; axis++ {
+        for _, dir := range []int{-1, 1} {
+            if c := PadAxis(axis, dir); c.value(in, js, a.DeadZone) >= PADPRESSTHRESHOLD {
+                captured = append(captured, c)
+            }
+        }
+    }
+    if len(captured) == 0 {
+        return
+    }
+    a.rebinding = ""
+    controls := append([]PadControl(nil), a.Pad[action]...)
+    if a.slot >= 0 && a.slot < len(controls) {
+        controls[a.slot] = captured[0]
+    } else {
+        controls = append(controls, captured[0])
+    }
+    a.Pad[action] = controls
+    a.changed()
+}
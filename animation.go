@@ -0,0 +1,256 @@
+package main
+
+import (
+    "time"
+
+    "github.com/faiface/pixel"
+)
+
+type AnimationMode int
+
+const (
+    // plays once and holds the last frame
+    AnimationOnce AnimationMode = iota
+    AnimationLoop
+    // plays forwards then backwards, forever
+    AnimationPingPong
+)
+
+type Animation struct {
+    Name      string
+    Frames    []*pixel.Sprite
+    Durations []time.Duration
+    Mode      AnimationMode
+    // by frame index: events for Animator.OnEvent, e.g. "footstep" on 3, and sounds played as
+    // the frame comes up, as sound event names or files
+    Events map[int][]string
+    Sounds map[int][]string
+}
+
+// an animation where every frame lasts frameTime
+func NewAnimation(name string, frames []*pixel.Sprite, frameTime time.Duration, mode AnimationMode) *Animation {
+    durations := make([]time.Duration, len(frames))
+    for i := range durations {
+        durations[i] = frameTime
+    }
+    return &Animation{Name: name, Frames: frames, Durations: durations, Mode: mode}
+}
+
+// adds events to frame, for syncing effects with the sprite, e.g. a hitbox on the swing frame
+func (a *Animation) Tag(frame int, events ...string) *Animation {
+    if a.Events == nil {
+        a.Events = make(map[int][]string)
+    }
+    a.Events[frame] = append(a.Events[frame], events...)
+    return a
+}
+
+// adds sounds to play when frame comes up, e.g. a footstep as each foot lands
+func (a *Animation) Sound(frame int, sounds ...string) *Animation {
+    if a.Sounds == nil {
+        a.Sounds = make(map[int][]string)
+    }
+    a.Sounds[frame] = append(a.Sounds[frame], sounds...)
+    return a
+}
+
+// an animation over frames first through last (inclusive) of sheet
+func SheetAnimation(sheet *SpriteSheet, name string, first, last int, frameTime time.Duration, mode AnimationMode) *Animation {
+    return NewAnimation(name, sheet.Sprites()[first:last+1], frameTime, mode)
+}
+
+// converts an Aseprite tag, keeping its per-frame durations. trim offsets are dropped, so export untrimmed.
+func (a *AsepriteAnimation) Animation(mode AnimationMode) *Animation {
+    anim := &Animation{Name: a.Name, Mode: mode}
+    for _, frame := range a.Frames {
+        anim.Frames = append(anim.Frames, frame.Sprite)
+        anim.Durations = append(anim.Durations, frame.Duration)
+    }
+    return anim
+}
+
+// plays named animations, advanced from the game loop with Update
+type Animator struct {
+    FlipX, FlipY bool
+    // playback rate multiplier, 1 is normal speed
+    Speed float64
+    // called with the animation's name when a once animation ends or a looping one wraps around
+    OnComplete func(name string)
+    // called with the animation's name and the event when a frame tagged with it comes up
+    OnEvent func(name, event string)
+    // where the animation's sounds come from when Spatial, see Audio.PlayAt; keep it on the
+    // sprite
+    Position pixel.Vec
+    Spatial  bool
+
+    animations map[string]*Animation
+    current    *Animation
+    frame      int
+    elapsed    time.Duration
+    backwards  bool
+    playing    bool
+}
+
+func NewAnimator() *Animator {
+    return &Animator{Speed: 1, animations: make(map[string]*Animation)}
+}
+
+func (a *Animator) Add(anim *Animation) {
+    a.animations[anim.Name] = anim
+}
+
+// switches to the named animation from its first frame; playing the current animation again is a no-op
+func (a *Animator) Play(name string) {
+    anim, ok := a.animations[name]
+    if !ok {
+        return
+    }
+    if a.current == anim && a.playing {
+        return
+    }
+    a.current = anim
+    a.Restart()
+}
+
+func (a *Animator) Restart() {
+    a.frame = 0
+    a.elapsed = 0
+    a.backwards = false
+    a.playing = true
+    a.shown()
+}
+
+func (a *Animator) Pause() {
+    a.playing = false
+}
+
+func (a *Animator) Resume() {
+    if a.current != nil {
+        a.playing = true
+    }
+}
+
+func (a *Animator) Playing() bool {
+    return a.playing
+}
+
+func (a *Animator) Current() string {
+    if a.current == nil {
+        return ""
+    }
+    return a.current.Name
+}
+
+func (a *Animator) Frame() int {
+    return a.frame
+}
+
+// advances playback by dt seconds
+func (a *Animator) Update(dt float64) {
+    if !a.playing || a.current == nil || len(a.current.Frames) == 0 {
+        return
+    }
+    a.elapsed += time.Duration(dt * a.Speed * float64(time.Second))
+
+    for a.playing {
+        duration := a.current.Durations[a.frame]
+        if duration <= 0 || a.elapsed < duration {
+            return
+        }
+        a.elapsed -= duration
+        previous := a.frame
+        a.advance()
+        // a once animation holding its last frame doesn't show it again
+        if a.frame != previous || a.playing {
+            a.shown()
+        }
+    }
+}
+
+func (a *Animator) advance() {
+    anim := a.current
+    last := len(anim.Frames) - 1
+
+    switch anim.Mode {
+    case AnimationOnce:
+        if a.frame == last {
+            a.playing = false
+            a.elapsed = 0
+            a.complete()
+            return
+        }
+        a.frame++
+    case AnimationLoop:
+        if a.frame == last {
+            a.frame = 0
+            a.complete()
+            return
+        }
+        a.frame++
+    case AnimationPingPong:
+        if last == 0 {
+            a.complete()
+            return
+        }
+        if a.backwards {
+            a.frame--
+            if a.frame == 0 {
+                a.backwards = false
+                a.complete()
+            }
+        } else {
+            a.frame++
+            if a.frame == last {
+                a.backwards = true
+            }
+        }
+    }
+}
+
+// fires the events and plays the sounds of the frame that just came up
+func (a *Animator) shown() {
+    anim := a.current
+    if sounds := anim.Sounds[a.frame]; len(sounds) > 0 && audio != nil {
+        for _, sound := range sounds {
+            if a.Spatial {
+                audio.PlaySoundAt(sound, a.Position)
+            } else {
+                audio.PlaySound(sound)
+            }
+        }
+    }
+    if a.OnEvent != nil {
+        for _, event := range anim.Events[a.frame] {
+            a.OnEvent(anim.Name, event)
+        }
+    }
+}
+
+func (a *Animator) complete() {
+    if a.OnComplete != nil {
+        a.OnComplete(a.current.Name)
+    }
+}
+
+// the sprite for the current frame, or nil before anything has played
+func (a *Animator) Sprite() *pixel.Sprite {
+    if a.current == nil || len(a.current.Frames) == 0 {
+        return nil
+    }
+    return a.current.Frames[a.frame]
+}
+
+func (a *Animator) Draw(t pixel.Target, matrix pixel.Matrix) {
+    sprite := a.Sprite()
+    if sprite == nil {
+        return
+    }
+    flip := pixel.V(1, 1)
+    if a.FlipX {
+        flip.X = -1
+    }
+    if a.FlipY {
+        flip.Y = -1
+    }
+    sprite.Draw(t, pixel.IM.ScaledXY(pixel.ZV, flip).Chained(matrix))
+}
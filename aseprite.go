@@ -0,0 +1,157 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "path"
+    "time"
+
+    "github.com/faiface/pixel"
+)
+
+// default frame duration Aseprite uses when the export omits one
+const ASEPRITEFRAMETIME = 100 * time.Millisecond
+
+type AsepriteFrame struct {
+    *AtlasFrame
+    Duration time.Duration
+}
+
+// a named tag from the Aseprite timeline, with reverse and ping-pong already unrolled into Frames
+type AsepriteAnimation struct {
+    Name      string
+    Direction string
+    Frames    []AsepriteFrame
+}
+
+// total time of one pass through the animation
+func (a *AsepriteAnimation) Length() time.Duration {
+    var total time.Duration
+    for _, frame := range a.Frames {
+        total += frame.Duration
+    }
+    return total
+}
+
+// returns the index of the frame showing after elapsed time, looping or holding the last frame
+func (a *AsepriteAnimation) FrameIndex(elapsed time.Duration, loop bool) int {
+    length := a.Length()
+    if length <= 0 || len(a.Frames) == 0 {
+        return 0
+    }
+    if loop {
+        elapsed %= length
+    } else if elapsed >= length {
+        return len(a.Frames) - 1
+    }
+    for i, frame := range a.Frames {
+        if elapsed < frame.Duration {
+            return i
+        }
+        elapsed -= frame.Duration
+    }
+    return len(a.Frames) - 1
+}
+
+func (a *AsepriteAnimation) FrameAt(elapsed time.Duration, loop bool) *AsepriteFrame {
+    return &a.Frames[a.FrameIndex(elapsed, loop)]
+}
+
+// the frames and tags of an Aseprite JSON export
+type AsepriteSheet struct {
+    Picture    pixel.Picture
+    Frames     []AsepriteFrame
+    Animations map[string]*AsepriteAnimation
+}
+
+type asepriteTag struct {
+    Name      string `json:"name"`
+    From      int    `json:"from"`
+    To        int    `json:"to"`
+    Direction string `json:"direction"`
+}
+
+type asepriteFile struct {
+    Frames json.RawMessage `json:"frames"`
+    Meta   struct {
+        Image     string        `json:"image"`
+        FrameTags []asepriteTag `json:"frameTags"`
+    } `json:"meta"`
+}
+
+// loads the JSON written by Aseprite's "Export Sprite Sheet" (hash or array) along with its image.
+// without any tags the whole timeline becomes a single animation named "default".
+func LoadAseprite(name string) (*AsepriteSheet, error) {
+    data, err := ReadAsset(name)
+    if err != nil {
+        return nil, err
+    }
+
+    var file asepriteFile
+    if err := json.Unmarshal(data, &file); err != nil {
+        return nil, fmt.Errorf("aseprite %s: %v", name, err)
+    }
+
+    frames, err := parseTexturePackerFrames(file.Frames)
+    if err != nil {
+        return nil, fmt.Errorf("aseprite %s: %v", name, err)
+    }
+    if len(frames) == 0 {
+        return nil, fmt.Errorf("aseprite %s: no frames", name)
+    }
+
+    if file.Meta.Image == "" {
+        return nil, fmt.Errorf("aseprite %s: missing meta.image", name)
+    }
+    pic, err := LoadPicture(path.Join(path.Dir(assetPath(name)), file.Meta.Image))
+    if err != nil {
+        return nil, err
+    }
+
+    sheet := &AsepriteSheet{Picture: pic, Animations: make(map[string]*AsepriteAnimation)}
+    for _, frame := range frames {
+        duration := time.Duration(frame.Duration) * time.Millisecond
+        if duration <= 0 {
+            duration = ASEPRITEFRAMETIME
+        }
+        sheet.Frames = append(sheet.Frames, AsepriteFrame{newAtlasFrame(pic, frame), duration})
+    }
+
+    tags := file.Meta.FrameTags
+    if len(tags) == 0 {
+        tags = []asepriteTag{{Name: "default", From: 0, To: len(frames) - 1, Direction: "forward"}}
+    }
+    for _, tag := range tags {
+        if tag.From < 0 || tag.To >= len(sheet.Frames) || tag.From > tag.To {
+            return nil, fmt.Errorf("aseprite %s: tag %q has invalid range %d-%d", name, tag.Name, tag.From, tag.To)
+        }
+        sheet.Animations[tag.Name] = &AsepriteAnimation{
+            Name:      tag.Name,
+            Direction: tag.Direction,
+            Frames:    unrollAsepriteTag(sheet.Frames, tag),
+        }
+    }
+
+    return sheet, nil
+}
+
+func unrollAsepriteTag(frames []AsepriteFrame, tag asepriteTag) []AsepriteFrame {
+    var out []AsepriteFrame
+    switch tag.Direction {
+    case "reverse":
+        for i := tag.To; i >= tag.From; i-- {
+            out = append(out, frames[i])
+        }
+    case "pingpong":
+        for i := tag.From; i <= tag.To; i++ {
+            out = append(out, frames[i])
+        }
+        // don't repeat the end frames when bouncing back
+        for i := tag.To - 1; i > tag.From; i-- {
+            out = append(out, frames[i])
+        }
+    default:
+        out = append(out, frames[tag.From:tag.To+1]...)
+    }
+    return out
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+    "io/fs"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/faiface/pixel"
+)
+
+var assetLog = logging.Module("assets")
+
+// how often PollChanges stats loaded files when hot reloading
+const HOTRELOADINTERVAL = 500 * time.Millisecond
+
+// shared, reference counted handle to a cached picture
+type PictureHandle struct {
+    Path    string
+    Picture pixel.Picture
+    refs    int
+    manager *AssetManager
+
+    modTime  time.Time
+    sprites  []*pixel.Sprite
+    onReload []func(pixel.Picture)
+}
+
+// creates a sprite that follows the handle across hot reloads
+func (h *PictureHandle) Sprite(frame pixel.Rect) *pixel.Sprite {
+    sprite := pixel.NewSprite(h.Picture, frame)
+    h.sprites = append(h.sprites, sprite)
+    return sprite
+}
+
+// registers fn to run with the new picture after a hot reload, for batches, sheets and canvases built from it
+func (h *PictureHandle) OnReload(fn func(pixel.Picture)) {
+    h.onReload = append(h.onReload, fn)
+}
+
+func (h *PictureHandle) reload(pic pixel.Picture, modTime time.Time) {
+    h.Picture = pic
+    h.modTime = modTime
+    // a new picture pointer misses pixel's per-target texture cache, so the next draw uploads it
+    for _, sprite := range h.sprites {
+        sprite.Set(pic, sprite.Frame())
+    }
+    for _, fn := range h.onReload {
+        fn(pic)
+    }
+}
+
+// drops this reference, unloading the picture once nobody holds it
+func (h *PictureHandle) Release() {
+    h.manager.Release(h)
+}
+
+// caches decoded assets by path so each file is read and decoded once
+type AssetManager struct {
+    mu       sync.Mutex
+    pictures map[string]*PictureHandle
+
+    // when set, PollChanges reloads pictures whose files changed on disk
+    HotReload bool
+    // when set, pictures that fail to load are replaced by a checkerboard instead of returning an error
+    Placeholders bool
+    lastPoll     time.Time
+}
+
+func NewAssetManager() *AssetManager {
+    return &AssetManager{pictures: make(map[string]*PictureHandle)}
+}
+
+// returns the cached picture for path, loading it on first use. every call must be paired with a Release.
+func (m *AssetManager) Picture(path string) (*PictureHandle, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if h, ok := m.pictures[path]; ok {
+        h.refs++
+        return h, nil
+    }
+
+    pic, err := LoadPicture(path)
+    if err != nil && m.Placeholders {
+        assetLog.Warnf("%v, using placeholder", err)
+        pic, err = PlaceholderPicture(PLACEHOLDERSIZE, PLACEHOLDERSIZE), nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    h := &PictureHandle{Path: path, Picture: pic, refs: 1, manager: m, modTime: assetModTime(path)}
+    m.pictures[path] = h
+    return h, nil
+}
+
+func (m *AssetManager) Release(h *PictureHandle) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if m.pictures[h.Path] != h || h.refs == 0 {
+        return
+    }
+    h.refs--
+    if h.refs == 0 {
+        delete(m.pictures, h.Path)
+    }
+}
+
+// evicts path from the cache no matter how many references are outstanding.
+// existing handles keep working, but the next Picture call reloads from disk.
+func (m *AssetManager) Unload(path string) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if h, ok := m.pictures[path]; ok {
+        h.refs = 0
+        delete(m.pictures, path)
+    }
+}
+
+func (m *AssetManager) UnloadAll() {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    for path, h := range m.pictures {
+        h.refs = 0
+        delete(m.pictures, path)
+    }
+}
+
+// paths currently held in the cache, sorted
+func (m *AssetManager) Loaded() []string {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    paths := make([]string, 0, len(m.pictures))
+    for path := range m.pictures {
+        paths = append(paths, path)
+    }
+    sort.Strings(paths)
+    return paths
+}
+
+func (m *AssetManager) RefCount(path string) int {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if h, ok := m.pictures[path]; ok {
+        return h.refs
+    }
+    return 0
+}
+
+// approximate bytes of decoded pixel data held by the cache
+func (m *AssetManager) MemoryUsage() int {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    var total int
+    for _, h := range m.pictures {
+        total += pictureMemory(h.Picture)
+    }
+    return total
+}
+
+func pictureMemory(pic pixel.Picture) int {
+    if pd, ok := pic.(*pixel.PictureData); ok {
+        // pixel stores each texel as a 4 byte color.RGBA
+        return len(pd.Pix) * 4
+    }
+    return 0
+}
+
+func assetModTime(path string) time.Time {
+    info, err := fs.Stat(AssetFS, assetPath(path))
+    if err != nil {
+        return time.Time{}
+    }
+    return info.ModTime()
+}
+
+// reloads any cached picture whose file changed since it was loaded. call it once per frame from the
+// main loop; it only touches the filesystem every HOTRELOADINTERVAL. a file that fails to decode
+// mid-save keeps the old picture and is retried on the next poll.
+func (m *AssetManager) PollChanges() {
+    if !m.HotReload || time.Since(m.lastPoll) < HOTRELOADINTERVAL {
+        return
+    }
+    m.lastPoll = time.Now()
+
+    m.mu.Lock()
+    handles := make([]*PictureHandle, 0, len(m.pictures))
+    for _, h := range m.pictures {
+        handles = append(handles, h)
+    }
+    m.mu.Unlock()
+
+    for _, h := range handles {
+        modTime := assetModTime(h.Path)
+        if modTime.IsZero() || !modTime.After(h.modTime) {
+            continue
+        }
+        if pic, err := LoadPicture(h.Path); err == nil {
+            h.reload(pic, modTime)
+        }
+    }
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+    "embed"
+    "io/fs"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+)
+
+//go:embed icon.png assets.json
+var embeddedAssets embed.FS
+
+// filesystem every asset loader reads from. it defaults to the files embedded
+// in the binary, so a distributed build doesn't need the source tree next to it.
+var AssetFS fs.FS = embeddedAssets
+
+// reads assets from a directory on disk instead, e.g. while iterating on art
+func UseAssetDir(dir string) {
+    AssetFS = os.DirFS(dir)
+}
+
+// converts an OS style path into the slash separated, unrooted form io/fs expects
+func assetPath(name string) string {
+    name = path.Clean(filepath.ToSlash(name))
+    return strings.TrimPrefix(name, "/")
+}
+
+func OpenAsset(name string) (fs.File, error) {
+    return AssetFS.Open(assetPath(name))
+}
+
+func ReadAsset(name string) ([]byte, error) {
+    return fs.ReadFile(AssetFS, assetPath(name))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "math"
+    "path"
+
+    "github.com/faiface/pixel"
+)
+
+// a single named frame of a TexturePacker atlas
+type AtlasFrame struct {
+    Sprite  *pixel.Sprite
+    Rotated bool
+    Trimmed bool
+    // size of the frame before TexturePacker trimmed it
+    SourceSize pixel.Vec
+    // offset of the trimmed frame's center from the untrimmed center
+    Offset pixel.Vec
+}
+
+// undoes the packer's rotation and trimming so the frame draws as the original image, centered on the origin
+func (f *AtlasFrame) Matrix() pixel.Matrix {
+    m := pixel.IM
+    if f.Rotated {
+        // packed frames are rotated 90° clockwise
+        m = m.Rotated(pixel.ZV, math.Pi/2)
+    }
+    return m.Moved(f.Offset)
+}
+
+func (f *AtlasFrame) Draw(t pixel.Target, matrix pixel.Matrix) {
+    f.Sprite.Draw(t, f.Matrix().Chained(matrix))
+}
+
+type Atlas struct {
+    Picture pixel.Picture
+    Frames  map[string]*AtlasFrame
+}
+
+// returns the plain sprites by frame name, ignoring trim offsets and rotation
+func (a *Atlas) Sprites() map[string]*pixel.Sprite {
+    sprites := make(map[string]*pixel.Sprite, len(a.Frames))
+    for name, frame := range a.Frames {
+        sprites[name] = frame.Sprite
+    }
+    return sprites
+}
+
+type texturePackerRect struct {
+    X, Y, W, H float64
+}
+
+type texturePackerFrame struct {
+    Filename         string            `json:"filename"`
+    Frame            texturePackerRect `json:"frame"`
+    Rotated          bool              `json:"rotated"`
+    Trimmed          bool              `json:"trimmed"`
+    SpriteSourceSize texturePackerRect `json:"spriteSourceSize"`
+    SourceSize       texturePackerRect `json:"sourceSize"`
+    // milliseconds, only written by Aseprite
+    Duration int `json:"duration"`
+}
+
+type texturePackerFile struct {
+    Frames json.RawMessage `json:"frames"`
+    Meta   struct {
+        Image string `json:"image"`
+    } `json:"meta"`
+}
+
+// loads a TexturePacker JSON atlas (hash or array format) and the picture named in its meta block
+func LoadAtlas(name string) (*Atlas, error) {
+    data, err := ReadAsset(name)
+    if err != nil {
+        return nil, err
+    }
+
+    var file texturePackerFile
+    if err := json.Unmarshal(data, &file); err != nil {
+        return nil, fmt.Errorf("atlas %s: %v", name, err)
+    }
+
+    frames, err := parseTexturePackerFrames(file.Frames)
+    if err != nil {
+        return nil, fmt.Errorf("atlas %s: %v", name, err)
+    }
+
+    if file.Meta.Image == "" {
+        return nil, fmt.Errorf("atlas %s: missing meta.image", name)
+    }
+    pic, err := LoadPicture(path.Join(path.Dir(assetPath(name)), file.Meta.Image))
+    if err != nil {
+        return nil, err
+    }
+
+    atlas := &Atlas{Picture: pic, Frames: make(map[string]*AtlasFrame, len(frames))}
+    for _, frame := range frames {
+        atlas.Frames[frame.Filename] = newAtlasFrame(pic, frame)
+    }
+    return atlas, nil
+}
+
+// decodes either frames layout, keeping the hash format's key order since Aseprite relies on it
+func parseTexturePackerFrames(raw json.RawMessage) ([]texturePackerFrame, error) {
+    raw = bytes.TrimSpace(raw)
+    if len(raw) > 0 && raw[0] == '[' {
+        var frames []texturePackerFrame
+        err := json.Unmarshal(raw, &frames)
+        return frames, err
+    }
+    if len(raw) == 0 || raw[0] != '{' {
+        return nil, fmt.Errorf("missing frames")
+    }
+
+    var frames []texturePackerFrame
+    dec := json.NewDecoder(bytes.NewReader(raw))
+    if _, err := dec.Token(); err != nil {
+        return nil, err
+    }
+    for dec.More() {
+        key, err := dec.Token()
+        if err != nil {
+            return nil, err
+        }
+        var frame texturePackerFrame
+        if err := dec.Decode(&frame); err != nil {
+            return nil, err
+        }
+        frame.Filename = key.(string)
+        frames = append(frames, frame)
+    }
+    return frames, nil
+}
+
+func newAtlasFrame(pic pixel.Picture, frame texturePackerFrame) *AtlasFrame {
+    // rotated frames occupy a w/h-swapped region of the sheet
+    w, h := frame.Frame.W, frame.Frame.H
+    if frame.Rotated {
+        w, h = h, w
+    }
+
+    // TexturePacker measures from the top-left, pixel from the bottom-left
+    bounds := pic.Bounds()
+    minX := bounds.Min.X + frame.Frame.X
+    maxY := bounds.Max.Y - frame.Frame.Y
+    sprite := pixel.NewSprite(pic, pixel.R(minX, maxY-h, minX+w, maxY))
+
+    source := pixel.V(frame.SourceSize.W, frame.SourceSize.H)
+    if source == pixel.ZV {
+        source = pixel.V(frame.Frame.W, frame.Frame.H)
+    }
+
+    var offset pixel.Vec
+    if frame.Trimmed {
+        offset = pixel.V(
+            frame.SpriteSourceSize.X+frame.SpriteSourceSize.W/2-source.X/2,
+            source.Y/2-(frame.SpriteSourceSize.Y+frame.SpriteSourceSize.H/2),
+        )
+    }
+
+    return &AtlasFrame{
+        Sprite:     sprite,
+        Rotated:    frame.Rotated,
+        Trimmed:    frame.Trimmed,
+        SourceSize: source,
+        Offset:     offset,
+    }
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "math/rand"
+    "path"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/faiface/beep"
+    "github.com/faiface/beep/vorbis"
+    "github.com/faiface/beep/wav"
+    "github.com/faiface/pixel"
+)
+
+var audioLog = logging.Module("audio")
+
+// the rate everything is mixed at; clips recorded at another rate are resampled to it
+const AUDIORATE = beep.SampleRate(44100)
+
+// how much sound the device is handed at a time: lower plays sooner after Play, higher survives a
+// slow frame without crackling
+const AUDIOLATENCY = 50 * time.Millisecond
+
+// what plays the mix, pulling from it on its own goroutine. building with the speaker tag plays
+// through the sound card with beep's speaker, which needs ALSA's headers on Linux; without it the
+// mix is pulled in real time and thrown away, so music still moves on and sounds still finish.
+type AudioDevice interface {
+    Start(rate beep.SampleRate, latency time.Duration, mix beep.Streamer) error
+    Close()
+}
+
+// the device Run starts audio on; the speaker build replaces it
+var newAudioDevice = func() AudioDevice { return &silentDevice{} }
+
+// pulls the mix at the rate a sound card would and drops it
+type silentDevice struct {
+    stop chan struct{}
+    done sync.WaitGroup
+}
+
+func (d *silentDevice) Start(rate beep.SampleRate, latency time.Duration, mix beep.Streamer) error {
+    d.stop = make(chan struct{})
+    d.done.Add(1)
+    go func() {
+        defer d.done.Done()
+        ticker := time.NewTicker(latency)
+        defer ticker.Stop()
+        samples := make([][2]float64, rate.N(latency))
+        last := time.Now()
+        for {
+            select {
+            case <-d.stop:
+                return
+            case now := <-ticker.C:
+                // however late the tick, the mix moves on by as much time as went by
+                for n := rate.N(now.Sub(last)); n > 0; n -= len(samples) {
+                    if n < len(samples) {
+                        mix.Stream(samples[:n])
+                        break
+                    }
+                    mix.Stream(samples)
+                }
+                last = now
+            }
+        }
+    }()
+    return nil
+}
+
+func (d *silentDevice) Close() {
+    if d.stop != nil {
+        close(d.stop)
+        d.done.Wait()
+        d.stop = nil
+    }
+}
+
+// scales a streamer by a linear volume, 0 silent to 1 as recorded
+type gainStreamer struct {
+    streamer beep.Streamer
+    gain     float64
+}
+
+func (g *gainStreamer) Stream(samples [][2]float64) (int, bool) {
+    n, ok := g.streamer.Stream(samples)
+    for i := range samples[:n] {
+        samples[i][0] *= g.gain
+        samples[i][1] *= g.gain
+    }
+    return n, ok
+}
+
+func (g *gainStreamer) Err() error {
+    return g.streamer.Err()
+}
+
+// a clip decoded into memory to play over and over, e.g. a jump or a hit
+type Sound struct {
+    Path   string
+    buffer *beep.Buffer
+}
+
+func (s *Sound) Duration() time.Duration {
+    return AUDIORATE.D(s.buffer.Len())
+}
+
+// an asset read into memory that can still seek, which io.NopCloser would hide
+type memoryFile struct {
+    *bytes.Reader
+}
+
+func (memoryFile) Close() error {
+    return nil
+}
+
+// opens an audio asset for streaming; the caller closes it
+func openAudio(name string) (beep.StreamSeekCloser, beep.Format, error) {
+    file, err := OpenAsset(name)
+    if err != nil {
+        return nil, beep.Format{}, err
+    }
+    // looping seeks, which a file inside a pak can't, so those are held in memory still encoded;
+    // decoded samples never are unless LoadSound asks
+    var src io.ReadCloser = file
+    if _, ok := file.(io.ReadSeeker); !ok {
+        data, err := io.ReadAll(file)
+        file.Close()
+        if err != nil {
+            return nil, beep.Format{}, fmt.Errorf("%s: %v", name, err)
+        }
+        src = memoryFile{bytes.NewReader(data)}
+    }
+    var stream beep.StreamSeekCloser
+    var format beep.Format
+    switch strings.ToLower(path.Ext(name)) {
+    case ".wav":
+        stream, format, err = wav.Decode(src)
+    case ".ogg":
+        stream, format, err = vorbis.Decode(src)
+    default:
+        err = fmt.Errorf("unknown audio format")
+    }
+    if err != nil {
+        src.Close()
+        return nil, beep.Format{}, fmt.Errorf("%s: %v", name, err)
+    }
+    return stream, format, nil
+}
+
+// a streamer at AUDIORATE whatever rate s was recorded at
+func resampled(format beep.Format, s beep.Streamer) beep.Streamer {
+    if format.SampleRate == AUDIORATE {
+        return s
+    }
+    return beep.Resample(4, format.SampleRate, AUDIORATE, s)
+}
+
+// decodes a WAV or OGG Vorbis asset into memory
+func LoadSound(name string) (*Sound, error) {
+    stream, format, err := openAudio(name)
+    if err != nil {
+        return nil, err
+    }
+    defer stream.Close()
+    buffer := beep.NewBuffer(beep.Format{SampleRate: AUDIORATE, NumChannels: 2, Precision: 2})
+    buffer.Append(resampled(format, stream))
+    if err := stream.Err(); err != nil {
+        return nil, fmt.Errorf("%s: %v", name, err)
+    }
+    return &Sound{Path: name, buffer: buffer}, nil
+}
+
+// a sound that's playing, to stop it or tell when it's done; Play's callers can ignore it
+type Playback struct {
+    audio *Audio
+    ctrl  *beep.Ctrl
+    done  bool
+    // set for sounds played at a position
+    panned *pannedStreamer
+    pos    pixel.Vec
+}
+
+func (p *Playback) Stop() {
+    p.audio.mu.Lock()
+    defer p.audio.mu.Unlock()
+    p.ctrl.Streamer = nil
+    p.done = true
+}
+
+// whether it played to the end or was stopped
+func (p *Playback) Done() bool {
+    p.audio.mu.Lock()
+    defer p.audio.mu.Unlock()
+    return p.done
+}
+
+// sound effects and music, mixed and handed to an AudioDevice. Run starts it on the device and
+// closes it with the window; until Start, as in headless runs, nothing pulls the mix and sounds
+// never finish.
+type Audio struct {
+    // guards the mix, which the device reads on its own goroutine
+    mu     sync.Mutex
+    device AudioDevice
+    // drained streamers are dropped from their bus as they finish
+    buses    [AUDIOBUSES]*audioBus
+    volume   VolumeSettings
+    onChange []func(VolumeSettings) error
+    sounds   map[string]*Sound
+    events   map[string]*soundEvent
+    rng      *rand.Rand
+    // fades everything for SetBackground; frozen stops pulling the mix once it's silent
+    focus      *fader
+    background bool
+    frozen     bool
+    // the song playing, and ones still fading out
+    track     *musicTrack
+    retired   []*musicTrack
+    intensity float64
+    // sounds playing at a position, and where they're heard from
+    emitters []*Playback
+    listener pixel.Vec
+    reach    pixel.Vec
+    rotation float64
+}
+
+func NewAudio() *Audio {
+    a := &Audio{
+        sounds: make(map[string]*Sound),
+        events: make(map[string]*soundEvent),
+        // apart from the game's random source, so sound variation doesn't change a replay
+        rng: rng.Stream("audio"),
+    }
+    for b := range a.buses {
+        a.buses[b] = &audioBus{gain: 1}
+    }
+    a.buses[BusMaster].mix.Add(a.buses[BusMusic], a.buses[BusEffects], a.buses[BusVoice])
+    a.focus = &fader{streamer: a.buses[BusMaster], gain: 1, target: 1}
+    a.volume = DefaultSettings().Volume
+    return a
+}
+
+// starts device pulling the mix; Close stops it
+func (a *Audio) Start(device AudioDevice) error {
+    if err := device.Start(AUDIORATE, AUDIOLATENCY, lockedStreamer{a}); err != nil {
+        return fmt.Errorf("audio: %v", err)
+    }
+    a.device = device
+    return nil
+}
+
+// stops the device and the music, for when the game exits
+func (a *Audio) Close() {
+    if a.device != nil {
+        a.device.Close()
+        a.device = nil
+    }
+    a.mu.Lock()
+    tracks := append(a.retired, a.track)
+    a.track, a.retired = nil, nil
+    a.mu.Unlock()
+    for _, track := range tracks {
+        track.close()
+    }
+}
+
+// pans the sounds playing at a position from where the listener is now and closes the files of
+// songs that finished fading out or playing; simulate calls it every frame
+func (a *Audio) Update() {
+    a.mu.Lock()
+    a.placeEmitters()
+    if a.track != nil && a.track.fader.finished() {
+        a.retire(0)
+    }
+    var done []*musicTrack
+    kept := a.retired[:0]
+    for _, track := range a.retired {
+        if track.fader.finished() {
+            done = append(done, track)
+        } else {
+            kept = append(kept, track)
+        }
+    }
+    a.retired = kept
+    a.mu.Unlock()
+    for _, track := range done {
+        track.close()
+    }
+}
+
+// reads the mix under the lock, so game code can change it between any two of the device's reads
+type lockedStreamer struct {
+    a *Audio
+}
+
+func (l lockedStreamer) Stream(samples [][2]float64) (int, bool) {
+    l.a.mu.Lock()
+    defer l.a.mu.Unlock()
+    if l.a.frozen && l.a.focus.gain == 0 {
+        for i := range samples {
+            samples[i] = [2]float64{}
+        }
+        return len(samples), true
+    }
+    return l.a.focus.Stream(samples)
+}
+
+func (l lockedStreamer) Err() error {
+    return nil
+}
+
+// sets every bus's volume and mute and whether sounds are placed, e.g. from settings.Volume;
+// unlike SetBusVolume it doesn't run OnChange
+func (a *Audio) SetVolume(v VolumeSettings) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    a.volume = v
+    for b, bus := range a.buses {
+        bus.gain, bus.muted = v.Level(AudioBus(b))
+    }
+    a.refocus()
+}
+
+func (a *Audio) Volume() VolumeSettings {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return a.volume
+}
+
+// the sound at name, loaded the first time it's asked for and kept after
+func (a *Audio) Sound(name string) (*Sound, error) {
+    if s, ok := a.sounds[name]; ok {
+        return s, nil
+    }
+    s, err := LoadSound(name)
+    if err != nil {
+        return nil, err
+    }
+    a.sounds[name] = s
+    return s, nil
+}
+
+// starts s from the beginning, alongside whatever else is playing
+func (a *Audio) Play(s *Sound) *Playback {
+    return a.PlayOn(BusEffects, s)
+}
+
+// starts s on bus, e.g. BusVoice for dialogue, so its volume follows that bus's
+func (a *Audio) PlayOn(bus AudioBus, s *Sound) *Playback {
+    p := &Playback{audio: a}
+    a.start(p, bus, s.buffer.Streamer(0, s.buffer.Len()))
+    return p
+}
+
+// adds p to bus, playing stream until it ends
+func (a *Audio) start(p *Playback, bus AudioBus, stream beep.Streamer) {
+    if bus < 0 || bus >= AUDIOBUSES {
+        bus = BusEffects
+    }
+    // the callback runs on the device's goroutine, inside the lock
+    p.ctrl = &beep.Ctrl{Streamer: beep.Seq(stream, beep.Callback(func() { p.done = true }))}
+    a.mu.Lock()
+    a.buses[bus].mix.Add(p.ctrl)
+    a.mu.Unlock()
+}
+
+// plays the sound at name, logging rather than failing when it can't be loaded, so a missing
+// effect doesn't stop the game
+func (a *Audio) PlayFile(name string) *Playback {
+    s, err := a.Sound(name)
+    if err != nil {
+        audioLog.Warnf("%v", err)
+        return nil
+    }
+    return a.Play(s)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+    "image/color"
+
+    "github.com/faiface/pixel"
+)
+
+type spriteRun struct {
+    picture pixel.Picture
+    batch   *pixel.Batch
+}
+
+// groups sprites by their picture into pixel.Batch objects, so thousands of sprites cost one draw
+// call per texture. by default every sprite sharing a picture draws together in the order the
+// pictures were first used; KeepOrder only merges consecutive sprites with the same picture, so
+// overlapping sprites from different pictures still layer correctly.
+//
+// clear it every frame for moving things, or fill it once and keep drawing it for static scenery.
+type SpriteQueue struct {
+    KeepOrder bool
+
+    runs []spriteRun
+    // batches are kept between frames so their vertex buffers get reused
+    pool map[pixel.Picture][]*pixel.Batch
+    used map[pixel.Picture]int
+}
+
+func NewSpriteQueue() *SpriteQueue {
+    return &SpriteQueue{
+        pool: make(map[pixel.Picture][]*pixel.Batch),
+        used: make(map[pixel.Picture]int),
+    }
+}
+
+func (q *SpriteQueue) batchFor(pic pixel.Picture) *pixel.Batch {
+    if q.KeepOrder {
+        if n := len(q.runs); n > 0 && q.runs[n-1].picture == pic {
+            return q.runs[n-1].batch
+        }
+    } else {
+        for _, run := range q.runs {
+            if run.picture == pic {
+                return run.batch
+            }
+        }
+    }
+
+    i := q.used[pic]
+    if i == len(q.pool[pic]) {
+        q.pool[pic] = append(q.pool[pic], pixel.NewBatch(&pixel.TrianglesData{}, pic))
+    }
+    batch := q.pool[pic][i]
+    q.used[pic] = i + 1
+    q.runs = append(q.runs, spriteRun{pic, batch})
+    return batch
+}
+
+func (q *SpriteQueue) Add(s *pixel.Sprite, m pixel.Matrix) {
+    q.AddColorMask(s, m, nil)
+}
+
+func (q *SpriteQueue) AddColorMask(s *pixel.Sprite, m pixel.Matrix, mask color.Color) {
+    if s == nil || s.Picture() == nil {
+        return
+    }
+    s.DrawColorMask(q.batchFor(s.Picture()), m, mask)
+}
+
+// a pixel.Target for the given picture, for things like ParallaxLayer or text that draw themselves
+func (q *SpriteQueue) Target(pic pixel.Picture) pixel.Target {
+    return q.batchFor(pic)
+}
+
+// number of draw calls the next Draw will make
+func (q *SpriteQueue) DrawCalls() int {
+    return len(q.runs)
+}
+
+func (q *SpriteQueue) Draw(t pixel.Target) {
+    for _, run := range q.runs {
+        run.batch.Draw(t)
+    }
+}
+
+// empties the queue, keeping its batches around for the next frame
+func (q *SpriteQueue) Clear() {
+    for _, run := range q.runs {
+        run.batch.Clear()
+    }
+    q.runs = q.runs[:0]
+    for pic := range q.used {
+        q.used[pic] = 0
+    }
+}
+
+// drops batches for pictures that aren't in the queue right now, e.g. after changing levels
+func (q *SpriteQueue) Trim() {
+    for pic := range q.pool {
+        if q.used[pic] == 0 {
+            delete(q.pool, pic)
+            delete(q.used, pic)
+        } else {
+            q.pool[pic] = q.pool[pic][:q.used[pic]]
+        }
+    }
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// what a behavior tree node did this tick
+type BehaviorStatus int
+
+const (
+    BehaviorSuccess BehaviorStatus = iota
+    BehaviorFailure
+    // not finished; it's ticked again next time, carrying on where it was
+    BehaviorRunning
+)
+
+func (s BehaviorStatus) String() string {
+    switch s {
+    case BehaviorSuccess:
+        return "success"
+    case BehaviorFailure:
+        return "failure"
+    }
+    return "running"
+}
+
+// one node of a behavior tree. nodes keep whatever they need between ticks, like which child a
+// sequence is on, so every agent needs a tree of its own: build them with a function rather than
+// sharing one.
+type BehaviorNode interface {
+    // runs the node once; composites and decorators tick their children through ctx.Tick
+    Tick(ctx *BehaviorContext) BehaviorStatus
+    // puts a running node back to the start, when the branch it's on is abandoned
+    Reset()
+    // what the debug view calls it
+    Label() string
+    Children() []BehaviorNode
+}
+
+// what a tree's nodes see while it ticks
+type BehaviorContext struct {
+    // the agent, and the world it's in; nil when the tree's ticked outside a World
+    World  *World
+    Entity Entity
+    // seconds since the tree last ticked
+    DT float64
+    // the agent's memory, shared by its nodes, e.g. a target one finds and another chases
+    Blackboard map[string]interface{}
+
+    behavior *Behavior
+}
+
+// ticks n and records what it did, for the debug view and for resetting abandoned branches
+func (ctx *BehaviorContext) Tick(n BehaviorNode) BehaviorStatus {
+    status := n.Tick(ctx)
+    ctx.behavior.ticked[n] = status
+    return status
+}
+
+// an agent's tree, as a component; Behaviors ticks it each tick, e.g.
+//
+//	world.Add(guard, NewBehavior(BehaviorSelector("guard",
+//		BehaviorSequence("fight", BehaviorCondition("sees player", seesPlayer), BehaviorAction("shoot", shoot)),
+//		BehaviorSequence("patrol", BehaviorAction("walk", walkRoute), BehaviorWait(2)),
+//	)))
+type Behavior struct {
+    Root       BehaviorNode
+    Blackboard map[string]interface{}
+    // what the root returned last tick
+    Status BehaviorStatus
+
+    // the nodes ticked this tick and last tick, and what each returned
+    ticked map[BehaviorNode]BehaviorStatus
+    last   map[BehaviorNode]BehaviorStatus
+}
+
+var BehaviorType = ComponentTypeOf((*Behavior)(nil))
+
+func NewBehavior(root BehaviorNode) *Behavior {
+    return &Behavior{Root: root, Blackboard: map[string]interface{}{}, ticked: map[BehaviorNode]BehaviorStatus{}, last: map[BehaviorNode]BehaviorStatus{}}
+}
+
+// runs the tree once for e in w, dt seconds after the last time
+func (b *Behavior) Tick(w *World, e Entity, dt float64) BehaviorStatus {
+    for n := range b.ticked {
+        delete(b.ticked, n)
+    }
+    ctx := &BehaviorContext{World: w, Entity: e, DT: dt, Blackboard: b.Blackboard, behavior: b}
+    b.Status = ctx.Tick(b.Root)
+    b.last, b.ticked = b.ticked, b.last
+    return b.Status
+}
+
+// restarts the whole tree, e.g. after the agent's been stunned
+func (b *Behavior) Reset() {
+    b.Root.Reset()
+}
+
+// the nodes from the root down to the leaf last tick ended on, each with what it returned
+func (b *Behavior) Branch() []BehaviorNode {
+    var branch []BehaviorNode
+    for n := b.Root; n != nil; {
+        if _, ok := b.last[n]; !ok {
+            break
+        }
+        branch = append(branch, n)
+        var next BehaviorNode
+        // the last child ticked is the one the node stopped on
+        for _, c := range n.Children() {
+            if _, ok := b.last[c]; ok {
+                next = c
+            }
+        }
+        n = next
+    }
+    return branch
+}
+
+// what n returned last tick, and whether it was ticked at all
+func (b *Behavior) StatusOf(n BehaviorNode) (BehaviorStatus, bool) {
+    s, ok := b.last[n]
+    return s, ok
+}
+
+// Branch as one line, e.g. "guard > patrol > walk (running)"
+func (b *Behavior) Describe() string {
+    var labels []string
+    branch := b.Branch()
+    for _, n := range branch {
+        labels = append(labels, n.Label())
+    }
+    if len(branch) == 0 {
+        return ""
+    }
+    return fmt.Sprintf("%s (%s)", strings.Join(labels, " > "), b.last[branch[len(branch)-1]])
+}
+
+type behaviorComposite struct {
+    name     string
+    selector bool
+    children []BehaviorNode
+    // the child a sequence is on
+    current int
+    // the child left running last tick, to reset if it's passed over
+    running BehaviorNode
+}
+
+// runs its children in order until one fails, picking up at the one still running. it succeeds
+// once they all have.
+func BehaviorSequence(name string, children ...BehaviorNode) BehaviorNode {
+    return &behaviorComposite{name: name, children: children}
+}
+
+// tries its children in order until one doesn't fail. it starts from the first every tick, so a
+// higher priority child taking over resets the one that was running.
+func BehaviorSelector(name string, children ...BehaviorNode) BehaviorNode {
+    return &behaviorComposite{name: name, selector: true, children: children}
+}
+
+func (c *behaviorComposite) Tick(ctx *BehaviorContext) BehaviorStatus {
+    start := c.current
+    if c.selector {
+        start = 0
+    }
+    for i := start; i < len(c.children); i++ {
+        child := c.children[i]
+        status := ctx.Tick(child)
+        if status == BehaviorRunning {
+            if c.running != nil && c.running != child {
+                c.running.Reset()
+            }
+            c.running, c.current = child, i
+            return status
+        }
+        if c.running == child {
+            c.running = nil
+        }
+        if (status == BehaviorSuccess) == c.selector {
+            c.stop()
+            return status
+        }
+    }
+    c.stop()
+    if c.selector {
+        return BehaviorFailure
+    }
+    return BehaviorSuccess
+}
+
+// done for now, so the next tick starts over
+func (c *behaviorComposite) stop() {
+    if c.running != nil {
+        c.running.Reset()
+        c.running = nil
+    }
+    c.current = 0
+}
+
+func (c *behaviorComposite) Reset() {
+    c.stop()
+}
+
+func (c *behaviorComposite) Label() string {
+    return c.name
+}
+
+func (c *behaviorComposite) Children() []BehaviorNode {
+    return c.children
+}
+
+type behaviorLeaf struct {
+    name string
+    run  func(ctx *BehaviorContext) BehaviorStatus
+    // called when a running leaf is abandoned, or nil
+    reset func()
+}
+
+func (l *behaviorLeaf) Tick(ctx *BehaviorContext) BehaviorStatus {
+    return l.run(ctx)
+}
+
+func (l *behaviorLeaf) Reset() {
+    if l.reset != nil {
+        l.reset()
+    }
+}
+
+func (l *behaviorLeaf) Label() string {
+    return l.name
+}
+
+func (l *behaviorLeaf) Children() []BehaviorNode {
+    return nil
+}
+
+// a leaf that does something, returning BehaviorRunning for as long as it takes
+func BehaviorAction(name string, fn func(ctx *BehaviorContext) BehaviorStatus) BehaviorNode {
+    return &behaviorLeaf{name: name, run: fn}
+}
+
+// a leaf that succeeds when fn is true and fails otherwise
+func BehaviorCondition(name string, fn func(ctx *BehaviorContext) bool) BehaviorNode {
+    return &behaviorLeaf{name: name, run: func(ctx *BehaviorContext) BehaviorStatus {
+        if fn(ctx) {
+            return BehaviorSuccess
+        }
+        return BehaviorFailure
+    }}
+}
+
+// a leaf that runs for seconds, then succeeds
+func BehaviorWait(seconds float64) BehaviorNode {
+    elapsed := 0.0
+    return &behaviorLeaf{
+        name: fmt.Sprintf("wait %gs", seconds),
+        run: func(ctx *BehaviorContext) BehaviorStatus {
+            elapsed += ctx.DT
+            if elapsed < seconds {
+                return BehaviorRunning
+            }
+            elapsed = 0
+            return BehaviorSuccess
+        },
+        reset: func() { elapsed = 0 },
+    }
+}
+
+// a node with one child whose status it changes, see BehaviorInvert, BehaviorRepeat and the rest
+type behaviorDecorator struct {
+    name  string
+    child BehaviorNode
+    tick  func(ctx *BehaviorContext, child BehaviorNode) BehaviorStatus
+    reset func()
+}
+
+func (d *behaviorDecorator) Tick(ctx *BehaviorContext) BehaviorStatus {
+    return d.tick(ctx, d.child)
+}
+
+func (d *behaviorDecorator) Reset() {
+    if d.reset != nil {
+        d.reset()
+    }
+    d.child.Reset()
+}
+
+func (d *behaviorDecorator) Label() string {
+    return d.name
+}
+
+func (d *behaviorDecorator) Children() []BehaviorNode {
+    return []BehaviorNode{d.child}
+}
+
+// a node of your own over child: tick decides what it returns, ticking child through ctx.Tick
+// when it wants to
+func BehaviorDecorate(name string, child BehaviorNode, tick func(ctx *BehaviorContext, child BehaviorNode) BehaviorStatus) BehaviorNode {
+    return &behaviorDecorator{name: name, child: child, tick: tick}
+}
+
+// success for failure and failure for success
+func BehaviorInvert(child BehaviorNode) BehaviorNode {
+    return BehaviorDecorate("not", child, func(ctx *BehaviorContext, child BehaviorNode) BehaviorStatus {
+        switch status := ctx.Tick(child); status {
+        case BehaviorSuccess:
+            return BehaviorFailure
+        case BehaviorFailure:
+            return BehaviorSuccess
+        default:
+            return status
+        }
+    })
+}
+
+// succeeds however child finishes, for a step that's nice to have in a sequence
+func BehaviorAlwaysSucceed(child BehaviorNode) BehaviorNode {
+    return BehaviorDecorate("optional", child, func(ctx *BehaviorContext, child BehaviorNode) BehaviorStatus {
+        if ctx.Tick(child) == BehaviorRunning {
+            return BehaviorRunning
+        }
+        return BehaviorSuccess
+    })
+}
+
+// runs child times over, once a tick, failing as soon as it does; times 0 repeats forever
+func BehaviorRepeat(times int, child BehaviorNode) BehaviorNode {
+    done := 0
+    name := "repeat"
+    if times > 0 {
+        name = fmt.Sprintf("repeat %d", times)
+    }
+    d := &behaviorDecorator{name: name, child: child, reset: func() { done = 0 }}
+    d.tick = func(ctx *BehaviorContext, child BehaviorNode) BehaviorStatus {
+        switch ctx.Tick(child) {
+        case BehaviorRunning:
+            return BehaviorRunning
+        case BehaviorFailure:
+            done = 0
+            return BehaviorFailure
+        }
+        done++
+        if times > 0 && done >= times {
+            done = 0
+            return BehaviorSuccess
+        }
+        return BehaviorRunning
+    }
+    return d
+}
+
+// runs child again each tick until it fails, then succeeds, e.g. to keep attacking while a
+// condition under it holds
+func BehaviorUntilFailure(child BehaviorNode) BehaviorNode {
+    return BehaviorDecorate("until failure", child, func(ctx *BehaviorContext, child BehaviorNode) BehaviorStatus {
+        if ctx.Tick(child) == BehaviorFailure {
+            return BehaviorSuccess
+        }
+        return BehaviorRunning
+    })
+}
+
+// fails without ticking child for seconds after it last finished, e.g. so a special attack can
+// only come round every so often
+func BehaviorCooldown(seconds float64, child BehaviorNode) BehaviorNode {
+    // counts down while the child isn't running
+    left := 0.0
+    var running bool
+    d := &behaviorDecorator{name: fmt.Sprintf("cooldown %gs", seconds), child: child}
+    // cut short counts as finished
+    d.reset = func() {
+        if running {
+            running, left = false, seconds
+        }
+    }
+    d.tick = func(ctx *BehaviorContext, child BehaviorNode) BehaviorStatus {
+        if !running {
+            left -= ctx.DT
+            if left > 0 {
+                return BehaviorFailure
+            }
+        }
+        status := ctx.Tick(child)
+        running = status == BehaviorRunning
+        if !running {
+            left = seconds
+        }
+        return status
+    }
+    return d
+}
+
+// fails child if it's still running after seconds, resetting it
+func BehaviorTimeout(seconds float64, child BehaviorNode) BehaviorNode {
+    elapsed := 0.0
+    d := &behaviorDecorator{name: fmt.Sprintf("timeout %gs", seconds), child: child, reset: func() { elapsed = 0 }}
+    d.tick = func(ctx *BehaviorContext, child BehaviorNode) BehaviorStatus {
+        elapsed += ctx.DT
+        status := ctx.Tick(child)
+        if status != BehaviorRunning {
+            elapsed = 0
+            return status
+        }
+        if elapsed >= seconds {
+            elapsed = 0
+            child.Reset()
+            return BehaviorFailure
+        }
+        return BehaviorRunning
+    }
+    return d
+}
+
+// ticks every Behavior in World, after Game.Update and before collision and physics, so what the
+// agents decide moves them the same tick. set World in Game.Init.
+type Behaviors struct {
+    World *World
+    // seconds between ticks of the trees, to spare the CPU when there are many agents; 0 ticks
+    // them every simulation step
+    Interval float64
+    // draws each agent's branch over it, see Draw; the behaviors console command toggles it
+    Debug bool
+
+    elapsed float64
+}
+
+func NewBehaviors() *Behaviors {
+    return &Behaviors{}
+}
+
+// dt is in seconds
+func (b *Behaviors) Update(dt float64) {
+    if b.World == nil {
+        return
+    }
+    b.elapsed += dt
+    if b.elapsed < b.Interval {
+        return
+    }
+    dt, b.elapsed = b.elapsed, 0
+    b.World.Each(func(e Entity) {
+        b.World.Get(e, BehaviorType).(*Behavior).Tick(b.World, e, dt)
+    }, BehaviorType)
+}
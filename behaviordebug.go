@@ -0,0 +1,49 @@
+package main
+
+import (
+    "github.com/faiface/pixel"
+    "golang.org/x/image/colornames"
+)
+
+// how far above an agent its branch starts, in screen pixels
+const BEHAVIORDEBUGLIFT = 12
+
+// while Debug is on, writes each agent's active branch over it, root at the top and the leaf
+// last tick ended on nearest the agent: running nodes yellow, ones that succeeded green and
+// failed red. only agents with a Transform in view get one.
+func (b *Behaviors) Draw() {
+    if !b.Debug || b.World == nil || renderer == nil || camera == nil {
+        return
+    }
+    view := camera.VisibleRect()
+    opts := TextOptions{Size: 10, Align: AlignCenter}
+    b.World.Each(func(e Entity) {
+        at := b.World.Get(e, TransformType).(*Transform).Position
+        if !view.Contains(at) {
+            return
+        }
+        behavior := b.World.Get(e, BehaviorType).(*Behavior)
+        branch := behavior.Branch()
+        pos := camera.WorldToScreen(at).Add(pixel.V(0, BEHAVIORDEBUGLIFT))
+        labels := make([]string, len(branch))
+        statuses := make([]BehaviorStatus, len(branch))
+        for i, n := range branch {
+            labels[i] = n.Label()
+            statuses[i], _ = behavior.StatusOf(n)
+        }
+        renderer.Submit(LAYERUI, func(t pixel.Target) {
+            for i := len(labels) - 1; i >= 0; i-- {
+                switch statuses[i] {
+                case BehaviorRunning:
+                    opts.Color = colornames.Yellow
+                case BehaviorSuccess:
+                    opts.Color = colornames.Lime
+                default:
+                    opts.Color = colornames.Red
+                }
+                DrawText(t, nil, labels[i], pos, opts)
+                pos.Y += opts.Size + 2
+            }
+        })
+    }, BehaviorType, TransformType)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "math"
+    "math/rand"
+    "runtime"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+    "golang.org/x/image/colornames"
+)
+
+var benchLog = logging.Module("bench")
+
+// frames each scene runs before timing starts, so batches are built and the driver's warmed up
+const BENCHWARMUP = 60
+
+// timed frames per scene by default
+const BENCHFRAMES = 600
+
+// where --bench writes its results by default
+const BENCHOUT = "bench.json"
+
+// the seed every run uses, so two runs draw exactly the same frames
+const BENCHSEED = 1
+
+// the sprite scene's sprite count and the tile map scene's size in tiles
+const BENCHSPRITES = 10000
+const BENCHMAPSIZE = 512
+
+// a stress scene for --bench. Setup builds it for a window of the given size and Frame advances
+// it by dt, submitting to the global renderer and moving the global camera.
+type BenchScene struct {
+    Name  string
+    Setup func(bounds pixel.Rect)
+    Frame func(dt float64)
+}
+
+var benchScenes = map[string]BenchScene{}
+
+// adds a scene to the ones --bench can run; games register theirs before Run
+func RegisterBench(s BenchScene) {
+    if _, ok := benchScenes[s.Name]; ok {
+        panic(fmt.Sprintf("bench: scene %q registered twice", s.Name))
+    }
+    benchScenes[s.Name] = s
+}
+
+// registered scene names, sorted
+func BenchScenes() []string {
+    names := make([]string, 0, len(benchScenes))
+    for name := range benchScenes {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// frame times in milliseconds, and what the renderer did on an average frame
+type BenchResult struct {
+    Scene  string  `json:"scene"`
+    Frames int     `json:"frames"`
+    Mean   float64 `json:"mean_ms"`
+    Min    float64 `json:"min_ms"`
+    Median float64 `json:"median_ms"`
+    P95    float64 `json:"p95_ms"`
+    P99    float64 `json:"p99_ms"`
+    Max    float64 `json:"max_ms"`
+    FPS    float64 `json:"fps"`
+    Calls  float64 `json:"draw_calls"`
+    Drawn  float64 `json:"drawn"`
+    Culled float64 `json:"culled"`
+}
+
+// what --bench writes: enough about the run to tell whether two files are comparable
+type BenchReport struct {
+    Time    time.Time     `json:"time"`
+    Go      string        `json:"go"`
+    OS      string        `json:"os"`
+    Width   int           `json:"width"`
+    Height  int           `json:"height"`
+    Results []BenchResult `json:"results"`
+}
+
+// the statistics over frame times in milliseconds, which it sorts
+func benchStats(times []float64) BenchResult {
+    r := BenchResult{Frames: len(times)}
+    if len(times) == 0 {
+        return r
+    }
+    sort.Float64s(times)
+    sum := 0.0
+    for _, t := range times {
+        sum += t
+    }
+    pick := func(q float64) float64 {
+        return times[int(math.Min(float64(len(times)-1), math.Floor(q*float64(len(times)))))]
+    }
+    r.Mean = sum / float64(len(times))
+    r.Min, r.Max = times[0], times[len(times)-1]
+    r.Median, r.P95, r.P99 = pick(0.5), pick(0.95), pick(0.99)
+    if r.Mean > 0 {
+        r.FPS = 1000 / r.Mean
+    }
+    return r
+}
+
+// runs one scene for BENCHWARMUP and then frames frames at a fixed 60Hz step, timing each from
+// the start of the update to the end of the buffer swap
+func runBenchScene(win *pixelgl.Window, s BenchScene, frames int) BenchResult {
+    SeedRandom(BENCHSEED)
+    camera = NewCamera(win.Bounds())
+    renderer = NewRenderer(camera)
+    s.Setup(win.Bounds())
+    // whatever the last scene left behind shouldn't be collected on this one's clock
+    runtime.GC()
+
+    times := make([]float64, 0, frames)
+    var calls, drawn, culled int
+    for i := 0; i < BENCHWARMUP+frames && !win.Closed(); i++ {
+        start := time.Now()
+        s.Frame(1.0 / 60)
+        win.Clear(colornames.Black)
+        renderer.Draw(win)
+        win.Update()
+        if i < BENCHWARMUP {
+            continue
+        }
+        times = append(times, float64(time.Since(start))/float64(time.Millisecond))
+        stats := renderer.Stats()
+        calls += stats.Calls
+        drawn += stats.Drawn
+        culled += stats.Culled
+    }
+    r := benchStats(times)
+    r.Scene = s.Name
+    if n := float64(len(times)); n > 0 {
+        r.Calls, r.Drawn, r.Culled = float64(calls)/n, float64(drawn)/n, float64(culled)/n
+    }
+    return r
+}
+
+// what --bench runs instead of the game: a window without vsync, the named scenes, or all of them
+// for "all", one after another, and the report written to out
+func runBench(names string, frames int, out string, width, height int) error {
+    if frames <= 0 {
+        frames = BENCHFRAMES
+    }
+    if out == "" {
+        out = BENCHOUT
+    }
+    if width <= 0 || height <= 0 {
+        width, height = SCREENX, SCREENY
+    }
+    list := BenchScenes()
+    if names != "all" {
+        list = strings.Split(names, ",")
+    }
+    for _, name := range list {
+        if _, ok := benchScenes[name]; !ok {
+            return fmt.Errorf("bench: no scene %q, there's %s", name, strings.Join(BenchScenes(), ", "))
+        }
+    }
+
+    win, err := pixelgl.NewWindow(pixelgl.WindowConfig{
+        Title:  "bench",
+        Bounds: pixel.R(0, 0, float64(width), float64(height)),
+    })
+    if err != nil {
+        return err
+    }
+    defer win.Destroy()
+
+    report := BenchReport{Time: time.Now(), Go: runtime.Version(), OS: runtime.GOOS + "/" + runtime.GOARCH, Width: width, Height: height}
+    for _, name := range list {
+        r := runBenchScene(win, benchScenes[name], frames)
+        benchLog.Infof("%s: %.2fms mean, %.2fms p99, %.0f fps, %.0f draw calls", r.Scene, r.Mean, r.P99, r.FPS, r.Calls)
+        report.Results = append(report.Results, r)
+        if win.Closed() {
+            break
+        }
+    }
+    data, err := json.MarshalIndent(report, "", "  ")
+    if err != nil {
+        return err
+    }
+    if err := ioutil.WriteFile(out, data, 0644); err != nil {
+        return err
+    }
+    benchLog.Infof("results written to %s", out)
+    return nil
+}
+
+// a map of random pattern tiles on one layer, width by height cells of 8 pixels
+func benchTileMap(width, height int, random *rand.Rand) *TileMap {
+    m := &TileMap{Width: width, Height: height, TileWidth: 8, TileHeight: 8}
+    ts := &Tileset{FirstGID: 1, Name: "bench", TileWidth: 8, TileHeight: 8, Picture: patternTile()}
+    ts.sliceFrames(0, 0)
+    m.Tilesets = []*Tileset{ts}
+    gids := make([]uint32, width*height)
+    for i := range gids {
+        gids[i] = uint32(1 + random.Intn(ts.TileCount))
+    }
+    m.Layers = []*TileLayer{{Name: "ground", Width: width, Height: height, Visible: true, Opacity: 1, GIDs: gids, tileMap: m}}
+    return m
+}
+
+// the built-in stress scenes: BENCHSPRITES bouncing sprites through one queue, a BENCHMAPSIZE
+// square tile map under a panning, zooming camera, and a storm of particle emitters
+func init() {
+    type mover struct {
+        pos, vel    pixel.Vec
+        angle, spin float64
+    }
+    var movers []mover
+    var sprite *pixel.Sprite
+    var area pixel.Rect
+    RegisterBench(BenchScene{
+        Name: "sprites",
+        Setup: func(bounds pixel.Rect) {
+            area = bounds
+            tile := patternTile()
+            sprite = pixel.NewSprite(tile, tile.Bounds())
+            random := rng.Stream("bench")
+            movers = make([]mover, BENCHSPRITES)
+            for i := range movers {
+                movers[i] = mover{
+                    pos:  pixel.V(random.Float64()*bounds.W(), random.Float64()*bounds.H()),
+                    vel:  pixel.V(random.Float64()*200-100, random.Float64()*200-100),
+                    spin: random.Float64()*4 - 2,
+                }
+            }
+        },
+        Frame: func(dt float64) {
+            q := renderer.Sprites(LAYERACTORS)
+            for i := range movers {
+                m := &movers[i]
+                m.pos = m.pos.Add(m.vel.Scaled(dt))
+                if m.pos.X < area.Min.X || m.pos.X > area.Max.X {
+                    m.vel.X = -m.vel.X
+                }
+                if m.pos.Y < area.Min.Y || m.pos.Y > area.Max.Y {
+                    m.vel.Y = -m.vel.Y
+                }
+                m.angle += m.spin * dt
+                q.Add(sprite, pixel.IM.Rotated(pixel.ZV, m.angle).Moved(m.pos))
+            }
+        },
+    })
+
+    var tiles *TileMap
+    var elapsed float64
+    RegisterBench(BenchScene{
+        Name: "tilemap",
+        Setup: func(bounds pixel.Rect) {
+            tiles = benchTileMap(BENCHMAPSIZE, BENCHMAPSIZE, rng.Stream("bench"))
+            elapsed = 0
+        },
+        Frame: func(dt float64) {
+            elapsed += dt
+            // a slow loop around the middle, zooming out far enough to cull little
+            mapBounds := tiles.Bounds()
+            radius := math.Min(mapBounds.W(), mapBounds.H()) / 3
+            camera.Position = mapBounds.Center().Add(pixel.V(math.Cos(elapsed/4), math.Sin(elapsed/4)).Scaled(radius))
+            camera.Zoom = 0.6 + 0.4*math.Sin(elapsed)
+            camera.Update(dt)
+            renderer.SubmitMap(LAYERWORLD, 0, tiles)
+        },
+    })
+
+    var emitters []*ParticleEmitter
+    RegisterBench(BenchScene{
+        Name: "particles",
+        Setup: func(bounds pixel.Rect) {
+            emitters = emitters[:0]
+            for i := 0; i < 40; i++ {
+                at := pixel.V(bounds.W()*float64(i%8+1)/9, bounds.H()*float64(i/8+1)/6)
+                e := NewParticleEmitter(at)
+                e.Rate = 1000
+                e.Lifetime, e.LifetimeVariance = 1.5, 0.5
+                e.Spread = math.Pi
+                e.Speed, e.SpeedVariance = 120, 60
+                e.Gravity = pixel.V(0, -80)
+                e.StartColor, e.EndColor = pixel.ToRGBA(colornames.Orange), pixel.ToRGBA(colornames.Red).Mul(pixel.Alpha(0))
+                emitters = append(emitters, e)
+            }
+        },
+        Frame: func(dt float64) {
+            for _, e := range emitters {
+                e.Update(dt)
+                renderer.Submit(LAYERPARTICLES, e.Draw)
+            }
+        },
+    })
+}
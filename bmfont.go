@@ -0,0 +1,247 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/xml"
+    "fmt"
+    "image"
+    "io"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/text"
+    "golang.org/x/image/font"
+    "golang.org/x/image/math/fixed"
+)
+
+type bmChar struct {
+    X, Y, Width, Height int
+    XOffset, YOffset    int
+    XAdvance            int
+    Page                int
+}
+
+// a font.Face over the pages of a BMFont export, so pixel/text can build an atlas from it unscaled
+type bmFace struct {
+    lineHeight, base int
+    pages            []image.Image
+    chars            map[rune]bmChar
+    kerning          map[[2]rune]int
+}
+
+// loads an AngelCode BMFont in the text or XML format along with its page images.
+// pages are copied into the atlas pixel for pixel, so retro fonts stay crisp.
+func LoadBMFont(name string) (*Font, error) {
+    data, err := ReadAsset(name)
+    if err != nil {
+        return nil, err
+    }
+    if bytes.HasPrefix(data, []byte("BMF")) {
+        return nil, fmt.Errorf("bmfont %s: binary format isn't supported, export as text or XML", name)
+    }
+
+    var blocks []bmBlock
+    if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+        blocks, err = parseBMFontXML(data)
+    } else {
+        blocks, err = parseBMFontText(data)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("bmfont %s: %v", name, err)
+    }
+
+    face := &bmFace{chars: make(map[rune]bmChar), kerning: make(map[[2]rune]int)}
+    pageFiles := make(map[int]string)
+    for _, b := range blocks {
+        switch b.tag {
+        case "common":
+            face.lineHeight = b.int("lineHeight")
+            face.base = b.int("base")
+        case "page":
+            pageFiles[b.int("id")] = b.attrs["file"]
+        case "char":
+            face.chars[rune(b.int("id"))] = bmChar{
+                X:        b.int("x"),
+                Y:        b.int("y"),
+                Width:    b.int("width"),
+                Height:   b.int("height"),
+                XOffset:  b.int("xoffset"),
+                YOffset:  b.int("yoffset"),
+                XAdvance: b.int("xadvance"),
+                Page:     b.int("page"),
+            }
+        case "kerning":
+            face.kerning[[2]rune{rune(b.int("first")), rune(b.int("second"))}] = b.int("amount")
+        }
+    }
+    if len(face.chars) == 0 {
+        return nil, fmt.Errorf("bmfont %s: no chars", name)
+    }
+
+    face.pages = make([]image.Image, len(pageFiles))
+    for id, file := range pageFiles {
+        if id < 0 || id >= len(pageFiles) {
+            return nil, fmt.Errorf("bmfont %s: page id %d out of range", name, id)
+        }
+        pic, err := LoadPicture(path.Join(path.Dir(assetPath(name)), file))
+        if err != nil {
+            return nil, fmt.Errorf("bmfont %s: %v", name, err)
+        }
+        face.pages[id] = pic.(*pixel.PictureData).Image()
+    }
+    for r, c := range face.chars {
+        if c.Page < 0 || c.Page >= len(face.pages) {
+            return nil, fmt.Errorf("bmfont %s: char %d uses missing page %d", name, r, c.Page)
+        }
+    }
+
+    return &Font{
+        Name:    name,
+        bitmap:  face,
+        atlases: make(map[float64]*text.Atlas),
+        writers: make(map[*text.Atlas]*text.Text),
+    }, nil
+}
+
+// one line of the text format or one element of the XML format
+type bmBlock struct {
+    tag   string
+    attrs map[string]string
+}
+
+func (b bmBlock) int(key string) int {
+    n, _ := strconv.Atoi(b.attrs[key])
+    return n
+}
+
+// lines look like `char id=65 x=10 y=0 ...`, with values optionally quoted
+func parseBMFontText(data []byte) ([]bmBlock, error) {
+    var blocks []bmBlock
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" {
+            continue
+        }
+        tag := line
+        rest := ""
+        if i := strings.IndexByte(line, ' '); i >= 0 {
+            tag, rest = line[:i], line[i+1:]
+        }
+        block := bmBlock{tag: tag, attrs: make(map[string]string)}
+        for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+            eq := strings.IndexByte(rest, '=')
+            if eq < 0 {
+                return nil, fmt.Errorf("malformed line %q", line)
+            }
+            key := rest[:eq]
+            rest = rest[eq+1:]
+            var value string
+            if strings.HasPrefix(rest, `"`) {
+                end := strings.IndexByte(rest[1:], '"')
+                if end < 0 {
+                    return nil, fmt.Errorf("unterminated quote in %q", line)
+                }
+                value, rest = rest[1:end+1], rest[end+2:]
+            } else if sp := strings.IndexByte(rest, ' '); sp >= 0 {
+                value, rest = rest[:sp], rest[sp:]
+            } else {
+                value, rest = rest, ""
+            }
+            block.attrs[key] = value
+        }
+        blocks = append(blocks, block)
+    }
+    return blocks, scanner.Err()
+}
+
+func parseBMFontXML(data []byte) ([]bmBlock, error) {
+    var blocks []bmBlock
+    decoder := xml.NewDecoder(bytes.NewReader(data))
+    for {
+        tok, err := decoder.Token()
+        if err == io.EOF {
+            return blocks, nil
+        }
+        if err != nil {
+            return nil, err
+        }
+        start, ok := tok.(xml.StartElement)
+        if !ok {
+            continue
+        }
+        block := bmBlock{tag: start.Name.Local, attrs: make(map[string]string)}
+        for _, attr := range start.Attr {
+            block.attrs[attr.Name.Local] = attr.Value
+        }
+        blocks = append(blocks, block)
+    }
+}
+
+// the runes the font defines, for building its atlas
+func (f *bmFace) runes() []rune {
+    runes := make([]rune, 0, len(f.chars))
+    for r := range f.chars {
+        runes = append(runes, r)
+    }
+    sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+    return runes
+}
+
+// undefined runes fall back to '?' and then to an empty glyph, since pixel/text asks for its replacement char
+func (f *bmFace) char(r rune) bmChar {
+    if c, ok := f.chars[r]; ok {
+        return c
+    }
+    if r == unicode.ReplacementChar {
+        return f.chars['?']
+    }
+    return bmChar{}
+}
+
+func (f *bmFace) Close() error {
+    return nil
+}
+
+func (f *bmFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+    c := f.char(r)
+    x := dot.X.Round() + c.XOffset
+    y := dot.Y.Round() - f.base + c.YOffset
+    dr := image.Rect(x, y, x+c.Width, y+c.Height)
+    var mask image.Image = image.Transparent
+    maskp := image.Point{}
+    if c.Width > 0 && c.Height > 0 {
+        page := f.pages[c.Page]
+        mask = page
+        maskp = page.Bounds().Min.Add(image.Pt(c.X, c.Y))
+    }
+    return dr, mask, maskp, fixed.I(c.XAdvance), true
+}
+
+func (f *bmFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+    c := f.char(r)
+    top := c.YOffset - f.base
+    bounds := fixed.R(c.XOffset, top, c.XOffset+c.Width, top+c.Height)
+    return bounds, fixed.I(c.XAdvance), true
+}
+
+func (f *bmFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+    return fixed.I(f.char(r).XAdvance), true
+}
+
+func (f *bmFace) Kern(r0, r1 rune) fixed.Int26_6 {
+    return fixed.I(f.kerning[[2]rune{r0, r1}])
+}
+
+func (f *bmFace) Metrics() font.Metrics {
+    return font.Metrics{
+        Height:  fixed.I(f.lineHeight),
+        Ascent:  fixed.I(f.base),
+        Descent: fixed.I(f.lineHeight - f.base),
+    }
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+)
+
+// produces the view matrix for win.SetMatrix each frame
+type Camera struct {
+    // world point shown at the center of the viewport
+    Position pixel.Vec
+    Zoom     float64
+    // the range ZoomAt keeps Zoom in; 0 leaves that end open
+    ZoomMin, ZoomMax float64
+    // radians, counter-clockwise
+    Rotation float64
+    // screen area the camera renders into, usually screen.Bounds()
+    Viewport pixel.Rect
+
+    // half extents of the box around Position a followed target can move in without moving the camera
+    Deadzone pixel.Vec
+    // how quickly Follow catches up, per second; 0 snaps straight to the target
+    Smoothing float64
+    // world area the view is kept inside; the zero rect leaves the camera unbounded
+    Bounds pixel.Rect
+
+    // how fast shake wobbles, per second, and how quickly a kick springs back
+    ShakeFrequency, KickRecovery float64
+
+    shakes []cameraShake
+    kick   pixel.Vec
+    flash  cameraFlash
+    // seconds, drives the shake noise
+    clock float64
+}
+
+// a camera that starts out as the identity transform for viewport
+func NewCamera(viewport pixel.Rect) *Camera {
+    return &Camera{
+        Position:       viewport.Center(),
+        Zoom:           1,
+        Viewport:       viewport,
+        ShakeFrequency: 15,
+        KickRecovery:   12,
+    }
+}
+
+// moves towards target, ignoring motion inside the deadzone. dt is in seconds.
+func (c *Camera) Follow(target pixel.Vec, dt float64) {
+    goal := c.Position
+    delta := target.Sub(c.Position)
+    if delta.X > c.Deadzone.X {
+        goal.X = target.X - c.Deadzone.X
+    } else if delta.X < -c.Deadzone.X {
+        goal.X = target.X + c.Deadzone.X
+    }
+    if delta.Y > c.Deadzone.Y {
+        goal.Y = target.Y - c.Deadzone.Y
+    } else if delta.Y < -c.Deadzone.Y {
+        goal.Y = target.Y + c.Deadzone.Y
+    }
+
+    if c.Smoothing <= 0 {
+        c.Position = goal
+    } else {
+        // frame rate independent exponential smoothing
+        t := 1 - math.Exp(-c.Smoothing*dt)
+        c.Position = pixel.Lerp(c.Position, goal, t)
+    }
+    c.Clamp()
+}
+
+// half the world space size of the view, ignoring rotation
+func (c *Camera) halfView() pixel.Vec {
+    zoom := c.zoom()
+    return pixel.V(c.Viewport.W()/2/zoom, c.Viewport.H()/2/zoom)
+}
+
+func (c *Camera) zoom() float64 {
+    if c.Zoom <= 0 {
+        return 1
+    }
+    return c.Zoom
+}
+
+// keeps the view inside Bounds, centering on any axis where the bounds are smaller than the view
+func (c *Camera) Clamp() {
+    if c.Bounds == (pixel.Rect{}) {
+        return
+    }
+    half := c.halfView()
+    c.Position.X = clampAxis(c.Position.X, c.Bounds.Min.X+half.X, c.Bounds.Max.X-half.X)
+    c.Position.Y = clampAxis(c.Position.Y, c.Bounds.Min.Y+half.Y, c.Bounds.Max.Y-half.Y)
+}
+
+func clampAxis(v, lo, hi float64) float64 {
+    if lo > hi {
+        return (lo + hi) / 2
+    }
+    return math.Max(lo, math.Min(hi, v))
+}
+
+func (c *Camera) Matrix() pixel.Matrix {
+    offset, angle := c.shakeOffset()
+    kick := c.kick.Scaled(accessibility.ShakeScale())
+    return pixel.IM.
+        Moved(c.Position.Add(offset).Add(kick).Scaled(-1)).
+        Rotated(pixel.ZV, -c.Rotation-angle).
+        Scaled(pixel.ZV, c.zoom()).
+        Moved(c.Viewport.Center())
+}
+
+func (c *Camera) ScreenToWorld(screen pixel.Vec) pixel.Vec {
+    return c.Matrix().Unproject(screen)
+}
+
+func (c *Camera) WorldToScreen(world pixel.Vec) pixel.Vec {
+    return c.Matrix().Project(world)
+}
+
+// axis aligned world rect covering everything the camera can see, including rotation
+func (c *Camera) VisibleRect() pixel.Rect {
+    return visibleIn(c.Matrix(), c.Viewport)
+}
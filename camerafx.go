@@ -0,0 +1,103 @@
+package main
+
+import (
+    "image/color"
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+)
+
+// how far, in radians, the view tilts at full trauma, relative to the shake strength in pixels
+const SHAKEROTATION = 0.003
+
+type cameraShake struct {
+    strength, duration, remaining float64
+}
+
+type cameraFlash struct {
+    color               pixel.RGBA
+    duration, remaining float64
+}
+
+// shakes the view by up to strength world pixels, easing off over duration seconds.
+// overlapping shakes add up, so repeated hits feel heavier.
+func (c *Camera) Shake(strength, duration float64) {
+    if duration <= 0 || strength <= 0 {
+        return
+    }
+    c.shakes = append(c.shakes, cameraShake{strength, duration, duration})
+}
+
+// knocks the view by offset, e.g. opposite a gun's recoil, and springs back at KickRecovery
+func (c *Camera) Kick(offset pixel.Vec) {
+    c.kick = c.kick.Add(offset)
+}
+
+// fills the screen with col, fading out over duration seconds; see DrawFlash
+func (c *Camera) Flash(col color.Color, duration float64) {
+    c.flash = cameraFlash{pixel.ToRGBA(col), duration, duration}
+}
+
+// advances shake, kick and flash. dt is in seconds.
+func (c *Camera) Update(dt float64) {
+    c.clock += dt
+
+    shakes := c.shakes[:0]
+    for _, s := range c.shakes {
+        s.remaining -= dt
+        if s.remaining > 0 {
+            shakes = append(shakes, s)
+        }
+    }
+    c.shakes = shakes
+
+    if c.KickRecovery > 0 {
+        c.kick = c.kick.Scaled(math.Exp(-c.KickRecovery * dt))
+    } else {
+        c.kick = pixel.ZV
+    }
+    if c.kick.Len() < 0.01 {
+        c.kick = pixel.ZV
+    }
+
+    c.flash.remaining = math.Max(0, c.flash.remaining-dt)
+}
+
+// trauma of each shake falls from 1 to 0, and squaring it makes small shakes subtle and big ones violent.
+// reduced screen shake turns it down.
+func (c *Camera) shakeOffset() (pixel.Vec, float64) {
+    amount := 0.0
+    for _, s := range c.shakes {
+        trauma := s.remaining / s.duration
+        amount += s.strength * trauma * trauma
+    }
+    amount *= accessibility.ShakeScale()
+    if amount == 0 {
+        return pixel.ZV, 0
+    }
+    t := c.clock * c.ShakeFrequency
+    offset := pixel.V(shakeNoise(t, 0), shakeNoise(t, 1)).Scaled(amount)
+    return offset, shakeNoise(t, 2) * amount * SHAKEROTATION
+}
+
+// smooth noise in -1..1 built from sines at unrelated frequencies, so shake wobbles instead of jittering
+func shakeNoise(t, seed float64) float64 {
+    t += seed * 17.31
+    return (math.Sin(t*1.0) + math.Sin(t*2.137+1.3) + math.Sin(t*3.539+4.1)) / 3
+}
+
+// true while a shake or kick is still moving the view
+func (c *Camera) Shaking() bool {
+    return len(c.shakes) > 0 || c.kick != pixel.ZV
+}
+
+// draws the current flash over the whole viewport; use a screen space layer like LAYERUI
+func (c *Camera) DrawFlash(imd *imdraw.IMDraw) {
+    if c.flash.remaining <= 0 || c.flash.duration <= 0 {
+        return
+    }
+    imd.Color = c.flash.color.Scaled(c.flash.remaining / c.flash.duration)
+    imd.Push(c.Viewport.Min, c.Viewport.Max)
+    imd.Rectangle(0)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+    "runtime"
+    "strings"
+
+    "github.com/faiface/mainthread"
+    "github.com/faiface/pixel/pixelgl"
+    "github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// what the clipboard holds in headless runs, where there's no window to reach the system one
+var headlessClipboard string
+
+// the system clipboard's text, or "" when it holds none
+func ClipboardText() string {
+    if win == nil {
+        return headlessClipboard
+    }
+    var s string
+    mainthread.Call(func() {
+        s = glfw.GetClipboardString()
+        // an empty or non-text clipboard leaves GLFW a FormatUnavailable error that whatever
+        // calls it next would panic with, so it's collected here
+        defer func() {
+            if r := recover(); r != nil {
+                if err, ok := r.(*glfw.Error); !ok || err.Code != glfw.FormatUnavailable {
+                    panic(r)
+                }
+            }
+        }()
+        glfw.GetTime()
+    })
+    return s
+}
+
+func SetClipboardText(s string) {
+    if win == nil {
+        headlessClipboard = s
+        return
+    }
+    mainthread.Call(func() {
+        glfw.SetClipboardString(s)
+    })
+}
+
+// the clipboard as one line, for fields that don't take newlines
+func clipboardLine() string {
+    s := strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ").Replace(ClipboardText())
+    return strings.TrimSpace(s)
+}
+
+// whether the copy and paste modifier is held: Command on macOS, Ctrl elsewhere
+func shortcutHeld(in Input) bool {
+    if runtime.GOOS == "darwin" {
+        return in.Pressed(pixelgl.KeyLeftSuper) || in.Pressed(pixelgl.KeyRightSuper)
+    }
+    return in.Pressed(pixelgl.KeyLeftControl) || in.Pressed(pixelgl.KeyRightControl)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+    "time"
+)
+
+// the frame clock everything reads instead of calling time.Now. Tick it once at the top of each
+// frame; Delta is scaled by Scale for slow motion or pausing, Unscaled is for things that should
+// keep going regardless, like menus and the debug overlay.
+type Time struct {
+    // 1 is normal speed, 0.5 half speed and 0 stops scaled time entirely
+    Scale float64
+
+    delta, unscaled      float64
+    total, unscaledTotal float64
+    frame                uint64
+    now, last            time.Time
+}
+
+func NewTime() *Time {
+    return &Time{Scale: 1}
+}
+
+// starts a new frame, measuring the real time since the previous one
+func (t *Time) Tick() {
+    t.now = time.Now()
+    if t.last.IsZero() {
+        t.last = t.now
+    }
+    dt := t.now.Sub(t.last).Seconds()
+    t.last = t.now
+    t.advance(dt)
+}
+
+// starts a new frame dt real seconds after the last one without looking at the wall clock, for
+// headless runs that need the same frames every time
+func (t *Time) Advance(dt float64) {
+    t.now = t.now.Add(time.Duration(dt * float64(time.Second)))
+    t.advance(dt)
+}
+
+func (t *Time) advance(dt float64) {
+    t.unscaled = dt
+    t.delta = t.unscaled * t.Scale
+    t.total += t.delta
+    t.unscaledTotal += t.unscaled
+    t.frame++
+}
+
+// scaled seconds since the last frame
+func (t *Time) Delta() float64 {
+    return t.delta
+}
+
+// real seconds since the last frame
+func (t *Time) Unscaled() float64 {
+    return t.unscaled
+}
+
+// scaled seconds since the first frame
+func (t *Time) Total() float64 {
+    return t.total
+}
+
+// real seconds since the first frame
+func (t *Time) UnscaledTotal() float64 {
+    return t.unscaledTotal
+}
+
+// frames ticked so far
+func (t *Time) Frame() uint64 {
+    return t.frame
+}
+
+// when the current frame started, the same for everyone who asks during it
+func (t *Time) Now() time.Time {
+    return t.now
+}
+
+func (t *Time) Paused() bool {
+    return t.Scale == 0
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+)
+
+// every collision layer, the default Mask
+const COLLIDEALL = ^uint32(0)
+
+// how far, in world units, something can already be below a one-way platform's top and still
+// land on it, for rounding
+const ONEWAYSLOP = 0.01
+
+// a shape on an entity, centered on its Transform's Position plus Offset: an axis aligned box by
+// default, or a circle or convex polygon for round projectiles and rotated hitboxes. only
+// polygons turn with the Transform's Rotation; give a box that should turn BoxPoints instead.
+type Collider struct {
+    Shape  ShapeKind
+    Size   pixel.Vec
+    Radius float64
+    // a ShapeConvex's corners around the center, in order
+    Points []pixel.Vec
+    Offset pixel.Vec
+    // bits for what it is and what it hits; two colliders touch when each one's Mask has a bit of
+    // the other's Layer. zero means layer 1 and COLLIDEALL, so a bare Collider hits everything.
+    Layer, Mask uint32
+    // reports overlaps without pushing or being pushed, e.g. pickups and hurtboxes
+    Trigger bool
+    // never moved by resolution, e.g. walls
+    Static bool
+    // only stops things coming down onto its top, so they can jump up through it
+    OneWay bool
+    // a climbable area for a character controller to look for; make it a Trigger too
+    Ladder bool
+}
+
+var ColliderType = ComponentTypeOf((*Collider)(nil))
+
+func init() {
+    RegisterComponent("collider", (*Collider)(nil))
+}
+
+func (c *Collider) layer() uint32 {
+    if c.Layer == 0 {
+        return 1
+    }
+    return c.Layer
+}
+
+func (c *Collider) mask() uint32 {
+    if c.Mask == 0 {
+        return COLLIDEALL
+    }
+    return c.Mask
+}
+
+// whether c and other are on layers that hit each other
+func (c *Collider) Hits(other *Collider) bool {
+    return c.mask()&other.layer() != 0 && other.mask()&c.layer() != 0
+}
+
+// the box in world space with the entity at pos, or the bounds of a circle or unrotated polygon
+func (c *Collider) Rect(pos pixel.Vec) pixel.Rect {
+    return c.WorldShape(&Transform{Position: pos}).Rect
+}
+
+// the shape in world space where t puts it
+func (c *Collider) WorldShape(t *Transform) WorldShape {
+    center := t.Position.Add(c.Offset)
+    switch c.Shape {
+    case ShapeCircle:
+        return WorldCircle(center, c.Radius)
+    case ShapeConvex:
+        points := make([]pixel.Vec, len(c.Points))
+        for i, p := range c.Points {
+            points[i] = center.Add(p.Rotated(t.Rotation))
+        }
+        return WorldPolygon(points)
+    }
+    half := c.Size.Scaled(0.5)
+    return WorldRect(pixel.Rect{Min: center.Sub(half), Max: center.Add(half)})
+}
+
+// how a overlaps b: the shortest push that separates a, along the axis it's least deep in.
+// false when they don't overlap; touching edges don't count.
+func Penetration(a, b pixel.Rect) (pixel.Vec, bool) {
+    dx := math.Min(a.Max.X, b.Max.X) - math.Max(a.Min.X, b.Min.X)
+    dy := math.Min(a.Max.Y, b.Max.Y) - math.Max(a.Min.Y, b.Min.Y)
+    if dx <= 0 || dy <= 0 {
+        return pixel.ZV, false
+    }
+    if dx < dy {
+        if a.Center().X < b.Center().X {
+            return pixel.V(-dx, 0), true
+        }
+        return pixel.V(dx, 0), true
+    }
+    if a.Center().Y < b.Center().Y {
+        return pixel.V(0, -dy), true
+    }
+    return pixel.V(0, dy), true
+}
+
+// two overlapping colliders. Normal points the way A has to go to get out of B, Depth is how far.
+type Contact struct {
+    A, B    Entity
+    Normal  pixel.Vec
+    Depth   float64
+    Trigger bool
+}
+
+// the push that separates A from B
+func (c Contact) Penetration() pixel.Vec {
+    return c.Normal.Scaled(c.Depth)
+}
+
+// B's side of the contact
+func (c Contact) Flip() Contact {
+    return Contact{A: c.B, B: c.A, Normal: pixel.ZV.Sub(c.Normal), Depth: c.Depth, Trigger: c.Trigger}
+}
+
+type contactPair struct {
+    a, b Entity
+}
+
+// finds the overlapping colliders in World every fixed step, pushes solid ones apart, and reports
+// contacts starting and ending: the engine runs it after Game.Update, so set World in
+// Game.Init. entities need a Transform and a Collider.
+type Collisions struct {
+    World *World
+    // every collider's box as of the last Step or Sync, for the broadphase and the queries; cull
+    // drawing with Index.Query(camera.VisibleRect())
+    Index *SpatialHash
+    // tile layers rays stop at, see AddSolidTiles, and the collision layer their tiles are on;
+    // zero means layer 1
+    Solids     []*TileLayer
+    SolidLayer uint32
+    // pushes overlapping solid colliders apart each step; off leaves it to the game
+    Resolve bool
+    // this step's contacts, each pair once
+    Contacts []Contact
+    // draws the colliders over the world, see Draw; the collision console command toggles it
+    Debug bool
+
+    touching map[contactPair]Contact
+    triggers map[Entity]*TriggerCallbacks
+    // World's Changes as of the last Sync
+    synced      uint64
+    syncedWorld *World
+    // where each collider was before this step, or before MoveAndCollide's move, for one-way
+    // platforms
+    previous map[Entity]pixel.Rect
+    onEnter  []func(Contact)
+    onStay   []func(Contact)
+    onExit   []func(Contact)
+}
+
+func NewCollisions() *Collisions {
+    return &Collisions{Resolve: true, Index: NewSpatialHash(SPATIALCELL), touching: make(map[contactPair]Contact), previous: make(map[Entity]pixel.Rect)}
+}
+
+// registers fn for two colliders starting to overlap
+func (c *Collisions) OnEnter(fn func(Contact)) {
+    c.onEnter = append(c.onEnter, fn)
+}
+
+// registers fn for every step two colliders keep overlapping
+func (c *Collisions) OnStay(fn func(Contact)) {
+    c.onStay = append(c.onStay, fn)
+}
+
+// registers fn for two colliders no longer overlapping, or one of them going away
+func (c *Collisions) OnExit(fn func(Contact)) {
+    c.onExit = append(c.onExit, fn)
+}
+
+// e's collider box in world space, or the bounds of its circle or polygon, if it has both parts
+func (c *Collisions) Rect(e Entity) (pixel.Rect, bool) {
+    shape, ok := c.Shape(e)
+    return shape.Rect, ok
+}
+
+// e's collider shape in world space, if it has both parts
+func (c *Collisions) Shape(e Entity) (WorldShape, bool) {
+    if c.World == nil {
+        return WorldShape{}, false
+    }
+    col, _ := c.World.Get(e, ColliderType).(*Collider)
+    t, _ := c.World.Get(e, TransformType).(*Transform)
+    if col == nil || t == nil {
+        return WorldShape{}, false
+    }
+    return col.WorldShape(t), true
+}
+
+func (c *Collisions) colliders() []Entity {
+    if c.World == nil {
+        return nil
+    }
+    return c.World.Query(ColliderType, TransformType)
+}
+
+// the contact between a and b, if their colliders overlap and are on layers that hit
+func (c *Collisions) contact(a, b Entity) (Contact, bool) {
+    ca := c.World.Get(a, ColliderType).(*Collider)
+    cb := c.World.Get(b, ColliderType).(*Collider)
+    // two things that never move have nothing to resolve or report, e.g. a zone inside a wall
+    if !ca.Hits(cb) || (ca.Static && cb.Static) {
+        return Contact{}, false
+    }
+    sa, _ := c.Shape(a)
+    sb, _ := c.Shape(b)
+    ra, rb := sa.Rect, sb.Rect
+    push, ok := Collide(sa, sb)
+    if !ok {
+        return Contact{}, false
+    }
+    trigger := ca.Trigger || cb.Trigger
+    switch {
+    case ca.OneWay && cb.OneWay:
+        return Contact{}, false
+    case cb.OneWay:
+        return c.landing(a, b, ra, rb, trigger)
+    case ca.OneWay:
+        contact, ok := c.landing(b, a, rb, ra, trigger)
+        return contact.Flip(), ok
+    }
+    depth := push.Len()
+    return Contact{A: a, B: b, Normal: push.Scaled(1 / depth), Depth: depth, Trigger: trigger}, true
+}
+
+// the contact of mover with a one-way platform: only when it was above the top, going up out of
+// it whatever axis it's least deep in
+func (c *Collisions) landing(mover, platform Entity, box, top pixel.Rect, trigger bool) (Contact, bool) {
+    was, ok := c.previous[mover]
+    if !ok {
+        was = box
+    }
+    if was.Min.Y < top.Max.Y-ONEWAYSLOP {
+        return Contact{}, false
+    }
+    return Contact{A: mover, B: platform, Normal: pixel.V(0, 1), Depth: top.Max.Y - box.Min.Y, Trigger: trigger}, true
+}
+
+// brings Index up to date with where every collider is now. Step does it, and the queries do
+// when entities or colliders came or went since, so they only miss things that moved, apart
+// from MoveAndCollide's and Teleport's moves; call it after moving a lot of entities mid-step.
+func (c *Collisions) Sync() {
+    if c.World == nil {
+        return
+    }
+    c.synced, c.syncedWorld = c.World.Changes(), c.World
+    entities := c.colliders()
+    present := make(map[Entity]bool, len(entities))
+    for _, e := range entities {
+        present[e] = true
+        box, _ := c.Rect(e)
+        if old, ok := c.Index.Bounds(e); ok {
+            c.previous[e] = old
+        } else {
+            c.previous[e] = box
+        }
+        c.Index.Set(e, box)
+    }
+    for _, e := range c.Index.Entities() {
+        if !present[e] {
+            c.Index.Remove(e)
+            delete(c.previous, e)
+        }
+    }
+}
+
+// syncs if World's entities changed since the last Sync
+func (c *Collisions) refresh() {
+    if c.World != nil && (c.World != c.syncedWorld || c.World.Changes() != c.synced) {
+        c.Sync()
+    }
+}
+
+// the entities Index found that still have a collider on one of mask's layers, with their
+// current shape
+func (c *Collisions) filter(candidates []Entity, mask uint32, keep func(WorldShape) bool) []Entity {
+    var hits []Entity
+    for _, e := range candidates {
+        shape, ok := c.Shape(e)
+        if !ok || c.World.Get(e, ColliderType).(*Collider).layer()&mask == 0 {
+            continue
+        }
+        if keep(shape) {
+            hits = append(hits, e)
+        }
+    }
+    return hits
+}
+
+// every entity whose collider overlaps r and is on one of mask's layers
+func (c *Collisions) QueryRect(r pixel.Rect, mask uint32) []Entity {
+    c.refresh()
+    area := WorldRect(r)
+    return c.filter(c.Index.Query(r), mask, func(shape WorldShape) bool { return shape.Intersects(area) })
+}
+
+// every entity whose collider contains p and is on one of mask's layers
+func (c *Collisions) QueryPoint(p pixel.Vec, mask uint32) []Entity {
+    c.refresh()
+    return c.filter(c.Index.QueryPoint(p), mask, func(shape WorldShape) bool { return shape.Contains(p) })
+}
+
+// every entity whose collider comes within radius of center and is on one of mask's layers
+func (c *Collisions) Near(center pixel.Vec, radius float64, mask uint32) []Entity {
+    c.refresh()
+    return c.filter(c.Index.QueryRadius(center, radius), mask, func(shape WorldShape) bool {
+        return shape.Distance(center) <= radius
+    })
+}
+
+// what e overlaps right now, with e as each contact's A
+func (c *Collisions) Overlaps(e Entity) []Contact {
+    box, ok := c.Rect(e)
+    if !ok {
+        return nil
+    }
+    c.refresh()
+    c.Index.Set(e, box)
+    var contacts []Contact
+    for _, other := range c.Index.Query(box) {
+        if other == e || !c.World.Has(other, ColliderType) || !c.World.Has(other, TransformType) {
+            continue
+        }
+        if contact, ok := c.contact(e, other); ok {
+            contacts = append(contacts, contact)
+        }
+    }
+    return contacts
+}
+
+// moves e by delta one axis at a time, stopping against solid colliders instead of going into
+// them, the way a platformer character moves. returns how far it got and what it hit. each axis
+// is swept first, so a fast move stops at a thin wall rather than passing through it.
+func (c *Collisions) MoveAndCollide(e Entity, delta pixel.Vec) (pixel.Vec, []Contact) {
+    t, _ := c.World.Get(e, TransformType).(*Transform)
+    if t == nil {
+        return pixel.ZV, nil
+    }
+    start := t.Position
+    var hits []Contact
+    for _, step := range []pixel.Vec{pixel.V(delta.X, 0), pixel.V(0, delta.Y)} {
+        if step == pixel.ZV {
+            continue
+        }
+        c.previous[e], _ = c.Rect(e)
+        if swept := c.sweep(e, step, true); len(swept) > 0 {
+            hit := swept[0]
+            step = step.Scaled(hit.Time)
+            hits = append(hits, Contact{A: e, B: hit.Entity, Normal: hit.Normal})
+        }
+        t.Position = t.Position.Add(step)
+        for _, contact := range c.Overlaps(e) {
+            if contact.Trigger {
+                continue
+            }
+            if c.World.Get(contact.B, ColliderType).(*Collider).OneWay && step.Y >= 0 {
+                continue
+            }
+            sa, _ := c.Shape(e)
+            sb, _ := c.Shape(contact.B)
+            out, still := Collide(sa, sb)
+            if !still {
+                continue
+            }
+            // pushed back against the way it moved only, so sliding along a wall still works; a
+            // circle or polygon goes out along the surface's normal instead, so it slides down
+            // slopes and around curves
+            a, b := sa.Rect, sb.Rect
+            var push pixel.Vec
+            switch {
+            case sa.Kind != ShapeBox || sb.Kind != ShapeBox:
+                push = out
+            case step.X > 0:
+                push.X = b.Min.X - a.Max.X
+            case step.X < 0:
+                push.X = b.Max.X - a.Min.X
+            case step.Y > 0:
+                push.Y = b.Min.Y - a.Max.Y
+            default:
+                push.Y = b.Max.Y - a.Min.Y
+            }
+            // deeper than the step means it overlapped before, which isn't this move's to fix
+            if push.Len() > step.Len()+ONEWAYSLOP {
+                continue
+            }
+            t.Position = t.Position.Add(push)
+            depth := push.Len()
+            hits = append(hits, Contact{A: e, B: contact.B, Normal: push.Scaled(1 / depth), Depth: depth})
+        }
+    }
+    c.reindex(e)
+    return t.Position.Sub(start), hits
+}
+
+// puts e straight at pos without colliding, e.g. a moving platform or undoing a trial move. unlike
+// setting its Transform, the queries find it there right away.
+func (c *Collisions) Teleport(e Entity, pos pixel.Vec) {
+    if t, _ := c.World.Get(e, TransformType).(*Transform); t != nil {
+        t.Position = pos
+        c.reindex(e)
+    }
+}
+
+func (c *Collisions) reindex(e Entity) {
+    if box, ok := c.Rect(e); ok {
+        c.Index.Set(e, box)
+    }
+}
+
+// pushes contact's colliders apart: all the way for one against a Static one, half each otherwise
+func (c *Collisions) Separate(contact Contact) {
+    ca := c.World.Get(contact.A, ColliderType).(*Collider)
+    cb := c.World.Get(contact.B, ColliderType).(*Collider)
+    ta := c.World.Get(contact.A, TransformType).(*Transform)
+    tb := c.World.Get(contact.B, TransformType).(*Transform)
+    push := contact.Penetration()
+    switch {
+    case ca.Static && cb.Static:
+    case ca.Static:
+        tb.Position = tb.Position.Sub(push)
+    case cb.Static:
+        ta.Position = ta.Position.Add(push)
+    default:
+        ta.Position = ta.Position.Add(push.Scaled(0.5))
+        tb.Position = tb.Position.Sub(push.Scaled(0.5))
+    }
+}
+
+// finds this step's contacts, resolves them and calls the handlers; the engine calls it every
+// fixed step while there's a World
+func (c *Collisions) Step() {
+    c.Contacts = c.Contacts[:0]
+    c.Sync()
+    c.Index.Pairs(func(a, b Entity) {
+        if contact, ok := c.contact(a, b); ok {
+            c.Contacts = append(c.Contacts, contact)
+        }
+    })
+    c.finish()
+}
+
+// resolves Contacts and reports what started, stayed and ended since the last step
+func (c *Collisions) finish() {
+    seen := make(map[contactPair]bool, len(c.Contacts))
+    for _, contact := range c.Contacts {
+        if c.Resolve && !contact.Trigger {
+            c.Separate(contact)
+        }
+        pair := contactPair{contact.A, contact.B}
+        seen[pair] = true
+        _, was := c.touching[pair]
+        c.touching[pair] = contact
+        handlers, phase := c.onStay, triggerStay
+        if !was {
+            handlers, phase = c.onEnter, triggerEnter
+        }
+        for _, fn := range handlers {
+            fn(contact)
+        }
+        if contact.Trigger {
+            c.triggered(contact, phase)
+        }
+    }
+    var gone []contactPair
+    for pair := range c.touching {
+        if !seen[pair] {
+            gone = append(gone, pair)
+        }
+    }
+    sortPairs(gone)
+    for _, pair := range gone {
+        contact := c.touching[pair]
+        delete(c.touching, pair)
+        for _, fn := range c.onExit {
+            fn(contact)
+        }
+        if contact.Trigger {
+            c.triggered(contact, triggerExit)
+        }
+    }
+    c.pruneTriggers()
+}
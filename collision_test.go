@@ -0,0 +1,78 @@
+package main
+
+import (
+    "testing"
+
+    "github.com/faiface/pixel"
+)
+
+// a 1x1 box at (0, 3) and a wall 2 wide and 10 tall centred on (10, 0), so 9 to 11 across
+func wallAndBox() (*Collisions, Entity, Entity) {
+    c := NewCollisions()
+    c.World = NewWorld()
+    wall := c.World.Create(&Transform{Position: pixel.V(10, 0)}, &Collider{Size: pixel.V(2, 10), Static: true})
+    box := c.World.Create(&Transform{Position: pixel.V(0, 3)}, &Collider{Size: pixel.V(1, 1)})
+    return c, wall, box
+}
+
+func position(c *Collisions, e Entity) pixel.Vec {
+    return c.World.Get(e, TransformType).(*Transform).Position
+}
+
+func TestMoveAndCollideStopsFlush(t *testing.T) {
+    c, wall, box := wallAndBox()
+    moved, hits := c.MoveAndCollide(box, pixel.V(20, 0))
+    if moved != pixel.V(8.5, 0) {
+        t.Errorf("moved %v, want (8.5, 0) to stop against the wall", moved)
+    }
+    if len(hits) != 1 || hits[0].B != wall || hits[0].Normal != pixel.V(-1, 0) {
+        t.Errorf("hits %+v, want the wall's left face", hits)
+    }
+}
+
+func TestMoveAndCollideFlushDoesNotTunnel(t *testing.T) {
+    c, wall, box := wallAndBox()
+    c.MoveAndCollide(box, pixel.V(20, 0))
+    for i := 0; i < 3; i++ {
+        moved, hits := c.MoveAndCollide(box, pixel.V(20, 0))
+        if moved != pixel.ZV {
+            t.Fatalf("push %d moved %v from flush, to %v", i+1, moved, position(c, box))
+        }
+        if len(hits) != 1 || hits[0].B != wall || hits[0].Normal != pixel.V(-1, 0) {
+            t.Errorf("push %d hits %+v, want the wall's left face", i+1, hits)
+        }
+    }
+    if got := position(c, box); got != pixel.V(8.5, 3) {
+        t.Errorf("ended at %v, want (8.5, 3)", got)
+    }
+}
+
+func TestMoveAndCollideFlushSlidesAndLeaves(t *testing.T) {
+    c, _, box := wallAndBox()
+    c.MoveAndCollide(box, pixel.V(20, 0))
+    if moved, hits := c.MoveAndCollide(box, pixel.V(5, 1)); moved != pixel.V(0, 1) || len(hits) != 1 {
+        t.Errorf("pushing into the wall and up moved %v with %d hits, want (0, 1) and 1", moved, len(hits))
+    }
+    if moved, hits := c.MoveAndCollide(box, pixel.V(-2, 0)); moved != pixel.V(-2, 0) || len(hits) != 0 {
+        t.Errorf("backing off moved %v with %d hits, want (-2, 0) and none", moved, len(hits))
+    }
+}
+
+func TestSweepRectTouching(t *testing.T) {
+    box := pixel.R(8, 2.5, 9, 3.5)
+    wall := pixel.R(9, -5, 11, 5)
+    if at, normal, ok := SweepRect(box, pixel.V(1, 0), wall); !ok || at != 0 || normal != pixel.V(-1, 0) {
+        t.Errorf("into the wall: %v %v %v, want a hit at 0 on (-1, 0)", at, normal, ok)
+    }
+    if _, _, ok := SweepRect(box, pixel.V(-1, 0), wall); ok {
+        t.Error("moving away hit")
+    }
+    if _, _, ok := SweepRect(box, pixel.V(0, 1), wall); ok {
+        t.Error("sliding along the face hit")
+    }
+    // only the corners touch
+    corner := pixel.R(8, 5, 9, 6)
+    if _, _, ok := SweepRect(corner, pixel.V(0, -1), wall); ok {
+        t.Error("a corner hit")
+    }
+}
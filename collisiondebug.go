@@ -0,0 +1,110 @@
+package main
+
+import (
+    "image/color"
+    "math"
+
+    "github.com/faiface/pixel"
+    "golang.org/x/image/colornames"
+)
+
+// how far ahead, in seconds, the debug view draws each collider's velocity
+const COLLISIONDEBUGLEAD = 0.1
+
+// while Debug is on, draws every collider in view over the world, with no help from the game:
+// static ones grey, moving ones green, triggers yellow, one-way platforms as their top edge in
+// cyan, and anything touching something this step in orange. lines show how fast each is going,
+// red dots and white ticks the contacts and their normals, and faint squares the spatial hash
+// cells in use.
+func (c *Collisions) Draw() {
+    if !c.Debug || c.World == nil || renderer == nil {
+        return
+    }
+    view := pixel.R(-1e9, -1e9, 1e9, 1e9)
+    if camera != nil {
+        view = camera.VisibleRect()
+    }
+    imd := renderer.IMDraw(LAYERPARTICLES)
+
+    imd.Color = color.RGBA{255, 255, 255, 24}
+    for _, cell := range c.Index.Cells() {
+        if cell.Intersects(view) {
+            imd.Push(cell.Min, cell.Max)
+            imd.Rectangle(1)
+        }
+    }
+
+    touching := make(map[Entity]bool)
+    for _, contact := range c.Contacts {
+        touching[contact.A], touching[contact.B] = true, true
+    }
+    visible := c.Index.Query(view)
+    for _, e := range visible {
+        shape, ok := c.Shape(e)
+        if !ok {
+            continue
+        }
+        box := shape.Rect
+        col := c.World.Get(e, ColliderType).(*Collider)
+        switch {
+        case touching[e]:
+            imd.Color = colornames.Orange
+        case col.Trigger:
+            imd.Color = colornames.Yellow
+        case col.OneWay:
+            imd.Color = colornames.Cyan
+        case col.Static:
+            imd.Color = colornames.Gray
+        default:
+            imd.Color = colornames.Lime
+        }
+        switch {
+        case col.OneWay:
+            imd.Push(pixel.V(box.Min.X, box.Max.Y), box.Max)
+            imd.Line(2)
+        case shape.Kind == ShapeCircle:
+            imd.Push(shape.Center)
+            imd.Circle(shape.Radius, 1)
+        case shape.Kind == ShapeConvex:
+            imd.Push(shape.Points...)
+            imd.Polygon(1)
+        default:
+            imd.Push(box.Min, box.Max)
+            imd.Rectangle(1)
+        }
+        if was, ok := c.previous[e]; ok && !col.Static {
+            velocity := box.Center().Sub(was.Center()).Scaled(TICKRATE)
+            if velocity != pixel.ZV {
+                imd.Color = colornames.Red
+                imd.Push(box.Center(), box.Center().Add(velocity.Scaled(COLLISIONDEBUGLEAD)))
+                imd.Line(1)
+            }
+        }
+    }
+
+    for _, contact := range c.Contacts {
+        a, okA := c.Rect(contact.A)
+        b, okB := c.Rect(contact.B)
+        if !okA || !okB {
+            continue
+        }
+        point := contactPoint(a, b)
+        imd.Color = colornames.Red
+        imd.Push(point)
+        imd.Circle(2, 0)
+        imd.Color = colornames.White
+        imd.Push(point, point.Add(contact.Normal.Scaled(8)))
+        imd.Line(1)
+    }
+    debug.Count("colliders", c.Index.Len())
+    debug.Count("colliders drawn", len(visible))
+    debug.Count("contacts", len(c.Contacts))
+}
+
+// the middle of where two boxes overlap, or of the edge they share once pushed apart
+func contactPoint(a, b pixel.Rect) pixel.Vec {
+    return pixel.V(
+        (math.Max(a.Min.X, b.Min.X)+math.Min(a.Max.X, b.Max.X))/2,
+        (math.Max(a.Min.Y, b.Min.Y)+math.Min(a.Max.Y, b.Max.Y))/2,
+    )
+}
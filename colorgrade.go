@@ -0,0 +1,168 @@
+package main
+
+import (
+    "fmt"
+    "image/color"
+
+    "github.com/faiface/pixel"
+    "github.com/go-gl/mathgl/mgl32"
+)
+
+// LUTs are strips of Size slices side by side, one per blue level, each Size x Size with red
+// going right and green going down, the layout most image editors and engines export
+func IdentityLUT(size int) *pixel.PictureData {
+    pd := pixel.MakePictureData(pixel.R(0, 0, float64(size*size), float64(size)))
+    step := 255 / float64(size-1)
+    for y := 0; y < size; y++ {
+        for x := 0; x < size*size; x++ {
+            // Pix starts at the bottom row
+            r, g, b := x%size, size-1-y, x/size
+            pd.Pix[y*size*size+x] = color.RGBA{uint8(float64(r) * step), uint8(float64(g) * step), uint8(float64(b) * step), 255}
+        }
+    }
+    return pd
+}
+
+// loads a strip LUT, checking it's as wide as its height squared
+func LoadLUT(path string) (pixel.Picture, error) {
+    pic, err := LoadPicture(path)
+    if err != nil {
+        return nil, err
+    }
+    b := pic.Bounds()
+    if b.H() < 2 || b.W() != b.H()*b.H() {
+        return nil, fmt.Errorf("lut %s: %vx%v isn't a strip of square slices", path, b.W(), b.H())
+    }
+    return pic, nil
+}
+
+// the palette as a one pixel high picture, which is how PaletteEffect reads it
+func PalettePicture(p Palette) *pixel.PictureData {
+    pd := pixel.MakePictureData(pixel.R(0, 0, float64(len(p)), 1))
+    for i, c := range p {
+        c.A = 255
+        pd.Pix[i] = c
+    }
+    return pd
+}
+
+// remaps every color through lut, blended with the original by strength 0-1. swap Extra for
+// another LUT of any size to change the grade at runtime.
+func LUTEffect(lut pixel.Picture, strength float32) *PostEffect {
+    e := NewPostEffect("lut", SHADERLUT, map[string]float32{"uStrength": strength})
+    e.Extra = lut
+    return e
+}
+
+// snaps every color to the nearest one in palette. dither 0-1 adds ordered dithering between
+// neighbouring colors; set Extra to another PalettePicture to change palettes at runtime.
+func PaletteEffect(palette Palette, dither float32) *PostEffect {
+    e := NewPostEffect("palette", SHADERPALETTE, map[string]float32{"uDither": dither})
+    e.Extra = PalettePicture(palette)
+    return e
+}
+
+// a mood tint multiplied over the screen by amount 0-1, with saturation, contrast and brightness
+// params for tweening between looks. SetColor("uTint", c) changes the tint.
+func GradeEffect(tint color.Color, amount float32) *PostEffect {
+    e := NewPostEffect("grade", SHADERGRADE, map[string]float32{
+        "uAmount":     amount,
+        "uSaturation": 1,
+        "uContrast":   1,
+        "uBrightness": 0,
+    })
+    e.Uniform("uTint", &mgl32.Vec4{})
+    e.SetColor("uTint", tint)
+    return e
+}
+
+// canvases hold premultiplied colors, so grading works on the straight color and multiplies back
+const gradeShaderHeader = postShaderHeader + `
+vec3 straight(vec4 c) {
+    return c.a > 0.0 ? c.rgb / c.a : c.rgb;
+}
+
+// reads a texel of Extra, with p in its pixels
+vec4 extra(vec2 p) {
+    return texture(uTexture, (uExtra.xy + p - uTexBounds.xy) / uTexBounds.zw);
+}
+`
+
+const SHADERLUT = gradeShaderHeader + `
+uniform float uStrength;
+
+void main() {
+    vec2 t = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
+    vec4 c = texture(uTexture, t);
+    vec3 rgb = clamp(straight(c), 0.0, 1.0);
+
+    // the two nearest blue slices, filtered within each and blended between
+    float n = uExtra.w;
+    float b = rgb.b * (n - 1.0);
+    float b0 = floor(b);
+    float b1 = min(b0 + 1.0, n - 1.0);
+    vec2 rg = vec2(rgb.r * (n - 1.0) + 0.5, (1.0 - rgb.g) * (n - 1.0) + 0.5);
+    vec3 s0 = extra(rg + vec2(b0 * n, 0.0)).rgb;
+    vec3 s1 = extra(rg + vec2(b1 * n, 0.0)).rgb;
+    vec3 graded = mix(s0, s1, b - b0);
+
+    fragColor = vec4(mix(rgb, graded, uStrength) * c.a, c.a);
+}
+`
+
+const SHADERPALETTE = gradeShaderHeader + `
+uniform float uDither;
+
+const float BAYER[16] = float[16](
+    0.0, 8.0, 2.0, 10.0,
+    12.0, 4.0, 14.0, 6.0,
+    3.0, 11.0, 1.0, 9.0,
+    15.0, 7.0, 13.0, 5.0
+);
+
+void main() {
+    vec2 t = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
+    vec4 c = texture(uTexture, t);
+    if (c.a == 0.0) {
+        fragColor = c;
+        return;
+    }
+    vec3 rgb = straight(c);
+    ivec2 cell = ivec2(mod(gl_FragCoord.xy, 4.0));
+    rgb += ((BAYER[cell.y * 4 + cell.x] + 0.5) / 16.0 - 0.5) * uDither;
+
+    // nearest by distance weighted towards green, which the eye is most sensitive to
+    vec3 pick = rgb;
+    float best = 1e9;
+    int size = int(uExtra.z);
+    for (int i = 0; i < size; i++) {
+        vec3 s = extra(vec2(float(i) + 0.5, 0.5)).rgb;
+        vec3 d = rgb - s;
+        float dist = dot(d * d, vec3(0.3, 0.59, 0.11));
+        if (dist < best) {
+            best = dist;
+            pick = s;
+        }
+    }
+    fragColor = vec4(pick * c.a, c.a);
+}
+`
+
+const SHADERGRADE = gradeShaderHeader + `
+uniform vec4 uTint;
+uniform float uAmount;
+uniform float uSaturation;
+uniform float uContrast;
+uniform float uBrightness;
+
+void main() {
+    vec2 t = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
+    vec4 c = texture(uTexture, t);
+    vec3 rgb = straight(c);
+    rgb = (rgb - 0.5) * uContrast + 0.5 + uBrightness;
+    float luma = dot(rgb, vec3(0.299, 0.587, 0.114));
+    rgb = mix(vec3(luma), rgb, uSaturation);
+    rgb = mix(rgb, rgb * uTint.rgb, uAmount);
+    fragColor = vec4(clamp(rgb, 0.0, 1.0) * c.a, c.a);
+}
+`
@@ -0,0 +1,511 @@
+package main
+
+import (
+    "fmt"
+    "image/color"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+    "golang.org/x/image/colornames"
+)
+
+// lines of output kept for scrolling back, and commands kept for Up and Down
+const CONSOLESCROLLBACK = 500
+const CONSOLEHISTORY = 50
+
+type ArgKind int
+
+const (
+    ArgString ArgKind = iota
+    ArgInt
+    ArgFloat
+    ArgBool
+)
+
+// one parameter of a console command, checked and converted before the command runs
+type ConsoleArg struct {
+    Name     string
+    Kind     ArgKind
+    Optional bool
+    // values Tab offers for it, e.g. entity kinds for spawn
+    Choices func() []string
+}
+
+func StringArg(name string) ConsoleArg { return ConsoleArg{Name: name, Kind: ArgString} }
+func IntArg(name string) ConsoleArg    { return ConsoleArg{Name: name, Kind: ArgInt} }
+func FloatArg(name string) ConsoleArg  { return ConsoleArg{Name: name, Kind: ArgFloat} }
+func BoolArg(name string) ConsoleArg   { return ConsoleArg{Name: name, Kind: ArgBool} }
+
+// the same arg, allowed to be left off the end of the line
+func (a ConsoleArg) Opt() ConsoleArg {
+    a.Optional = true
+    return a
+}
+
+func (a ConsoleArg) WithChoices(choices func() []string) ConsoleArg {
+    a.Choices = choices
+    return a
+}
+
+func (a ConsoleArg) parse(s string) (interface{}, error) {
+    switch a.Kind {
+    case ArgInt:
+        n, err := strconv.Atoi(s)
+        if err != nil {
+            return nil, fmt.Errorf("%s: expected a whole number, got %q", a.Name, s)
+        }
+        return n, nil
+    case ArgFloat:
+        f, err := strconv.ParseFloat(s, 64)
+        if err != nil {
+            return nil, fmt.Errorf("%s: expected a number, got %q", a.Name, s)
+        }
+        return f, nil
+    case ArgBool:
+        switch strings.ToLower(s) {
+        case "1", "true", "on", "yes":
+            return true, nil
+        case "0", "false", "off", "no":
+            return false, nil
+        }
+        return nil, fmt.Errorf("%s: expected on or off, got %q", a.Name, s)
+    }
+    return s, nil
+}
+
+// a command's converted arguments in the order they were declared; optional ones left off are
+// missing, so check Len or Has before reading them
+type ConsoleArgs []interface{}
+
+func (a ConsoleArgs) Len() int            { return len(a) }
+func (a ConsoleArgs) Has(i int) bool      { return i < len(a) }
+func (a ConsoleArgs) String(i int) string { return a[i].(string) }
+func (a ConsoleArgs) Int(i int) int       { return a[i].(int) }
+func (a ConsoleArgs) Float(i int) float64 { return a[i].(float64) }
+func (a ConsoleArgs) Bool(i int) bool     { return a[i].(bool) }
+
+type consoleCommand struct {
+    name string
+    help string
+    args []ConsoleArg
+    run  func(args ConsoleArgs) error
+}
+
+func (c *consoleCommand) usage() string {
+    parts := []string{c.name}
+    for _, a := range c.args {
+        if a.Optional {
+            parts = append(parts, "["+a.Name+"]")
+        } else {
+            parts = append(parts, "<"+a.Name+">")
+        }
+    }
+    return strings.Join(parts, " ")
+}
+
+// a drop-down developer console: commands with typed arguments, history on Up and Down, Tab
+// completion, Ctrl+C and Ctrl+V for the line, and a scrollback that also tails the log
+type Console struct {
+    Open bool
+    Key  pixelgl.Button
+    // the share of the window it covers when open
+    Height float64
+
+    commands map[string]*consoleCommand
+    onExec   []func(line string)
+    input    string
+    history  []string
+    // where Up and Down are in history; len(history) is the line being typed
+    browsing int
+    // lines back from the newest, for PageUp and PageDown
+    scroll int
+    // set while a typed line runs, whose "> line" echo is the newest line and not output
+    echoed bool
+
+    // log lines arrive from any goroutine
+    mu    sync.Mutex
+    lines []string
+
+    imd *imdraw.IMDraw
+}
+
+func NewConsole() *Console {
+    c := &Console{
+        Key:      pixelgl.KeyGraveAccent,
+        Height:   0.4,
+        commands: make(map[string]*consoleCommand),
+        imd:      imdraw.New(nil),
+    }
+    c.Register("help", "lists commands, or shows how to use one", func(args ConsoleArgs) error {
+        if args.Has(0) {
+            cmd, ok := c.commands[args.String(0)]
+            if !ok {
+                return fmt.Errorf("no command %q", args.String(0))
+            }
+            c.Printf("%s  %s", cmd.usage(), cmd.help)
+            return nil
+        }
+        for _, name := range c.Commands() {
+            c.Printf("%s  %s", c.commands[name].usage(), c.commands[name].help)
+        }
+        return nil
+    }, StringArg("command").Opt().WithChoices(c.Commands))
+    c.Register("clear", "empties the scrollback", func(args ConsoleArgs) error {
+        c.mu.Lock()
+        c.lines = nil
+        c.mu.Unlock()
+        c.scroll = 0
+        return nil
+    })
+    c.Register("copy", "copies the last lines of output to the clipboard, 1 unless told", func(args ConsoleArgs) error {
+        n := 1
+        if args.Has(0) {
+            n = args.Int(0)
+        }
+        if n < 1 {
+            return fmt.Errorf("lines must be at least 1")
+        }
+        c.mu.Lock()
+        end := len(c.lines)
+        if c.echoed && end > 0 {
+            end--
+        }
+        start := end - n
+        if start < 0 {
+            start = 0
+        }
+        copied := strings.Join(c.lines[start:end], "\n")
+        c.mu.Unlock()
+        if copied == "" {
+            return fmt.Errorf("nothing to copy")
+        }
+        SetClipboardText(copied)
+        return nil
+    }, IntArg("lines").Opt())
+    c.Register("echo", "prints its argument", func(args ConsoleArgs) error {
+        c.Printf("%s", args.String(0))
+        return nil
+    }, StringArg("text"))
+    return c
+}
+
+// adds a command, replacing any with the same name. run's error is printed; usage mistakes are
+// caught before it's called.
+func (c *Console) Register(name, help string, run func(args ConsoleArgs) error, args ...ConsoleArg) {
+    c.commands[name] = &consoleCommand{name: name, help: help, args: args, run: run}
+}
+
+func (c *Console) Unregister(name string) {
+    delete(c.commands, name)
+}
+
+// command names, sorted
+func (c *Console) Commands() []string {
+    names := make([]string, 0, len(c.commands))
+    for name := range c.commands {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// adds a line of output
+func (c *Console) Printf(format string, args ...interface{}) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    for _, line := range strings.Split(fmt.Sprintf(format, args...), "\n") {
+        c.lines = append(c.lines, line)
+    }
+    if over := len(c.lines) - CONSOLESCROLLBACK; over > 0 {
+        c.lines = append([]string(nil), c.lines[over:]...)
+    }
+}
+
+// the console as a LogSink, so logging.AddSink(console) tails the log into the scrollback
+func (c *Console) Write(e LogEntry) {
+    c.Printf("%s", e)
+}
+
+// splits a line into words, keeping "quoted text" together
+func consoleFields(line string) []string {
+    var fields []string
+    var field strings.Builder
+    quoted, started := false, false
+    for _, r := range line {
+        switch {
+        case r == '"':
+            quoted = !quoted
+            started = true
+        case r == ' ' && !quoted:
+            if started {
+                fields = append(fields, field.String())
+                field.Reset()
+                started = false
+            }
+        default:
+            field.WriteRune(r)
+            started = true
+        }
+    }
+    if started {
+        fields = append(fields, field.String())
+    }
+    return fields
+}
+
+// registers fn to run with every line submitted from the keyboard, e.g. to record it in a replay
+func (c *Console) OnExec(fn func(line string)) {
+    c.onExec = append(c.onExec, fn)
+}
+
+// runs a command line as if it had been typed, e.g. from a startup script
+func (c *Console) Exec(line string) error {
+    fields := consoleFields(line)
+    if len(fields) == 0 {
+        return nil
+    }
+    cmd, ok := c.commands[fields[0]]
+    if !ok {
+        return fmt.Errorf("unknown command %q, try help", fields[0])
+    }
+    words := fields[1:]
+    // a trailing string argument takes the rest of the line, so echo hello world needs no quotes
+    if n := len(cmd.args); n > 0 && cmd.args[n-1].Kind == ArgString && len(words) > n {
+        words = append(words[:n-1], strings.Join(words[n-1:], " "))
+    }
+    if len(words) > len(cmd.args) {
+        return fmt.Errorf("too many arguments, usage: %s", cmd.usage())
+    }
+    var args ConsoleArgs
+    for i, a := range cmd.args {
+        if i >= len(words) {
+            if !a.Optional {
+                return fmt.Errorf("missing %s, usage: %s", a.Name, cmd.usage())
+            }
+            break
+        }
+        v, err := a.parse(words[i])
+        if err != nil {
+            return fmt.Errorf("%s: %v", cmd.name, err)
+        }
+        args = append(args, v)
+    }
+    if err := cmd.run(args); err != nil {
+        return fmt.Errorf("%s: %v", cmd.name, err)
+    }
+    return nil
+}
+
+func (c *Console) submit() {
+    line := strings.TrimSpace(c.input)
+    c.input = ""
+    c.scroll = 0
+    if line == "" {
+        return
+    }
+    if len(c.history) == 0 || c.history[len(c.history)-1] != line {
+        c.history = append(c.history, line)
+        if len(c.history) > CONSOLEHISTORY {
+            c.history = c.history[1:]
+        }
+    }
+    c.browsing = len(c.history)
+    c.Printf("> %s", line)
+    for _, fn := range c.onExec {
+        fn(line)
+    }
+    c.echoed = true
+    err := c.Exec(line)
+    c.echoed = false
+    if err != nil {
+        c.Printf("%v", err)
+    }
+}
+
+func commonPrefix(words []string) string {
+    if len(words) == 0 {
+        return ""
+    }
+    prefix := words[0]
+    for _, w := range words[1:] {
+        for !strings.HasPrefix(w, prefix) {
+            prefix = prefix[:len(prefix)-1]
+        }
+    }
+    return prefix
+}
+
+// completes the word being typed from command names or the argument's choices. one match is
+// filled in; several fill in what they share and get listed.
+func (c *Console) complete() {
+    fields := consoleFields(c.input)
+    if len(fields) == 0 || strings.HasSuffix(c.input, " ") {
+        fields = append(fields, "")
+    }
+    word := fields[len(fields)-1]
+
+    var options []string
+    if len(fields) == 1 {
+        options = c.Commands()
+    } else if cmd, ok := c.commands[fields[0]]; ok && len(fields)-2 < len(cmd.args) {
+        a := cmd.args[len(fields)-2]
+        switch {
+        case a.Choices != nil:
+            options = a.Choices()
+        case a.Kind == ArgBool:
+            options = []string{"on", "off"}
+        }
+    }
+    var matches []string
+    for _, o := range options {
+        if strings.HasPrefix(o, word) {
+            matches = append(matches, o)
+        }
+    }
+    if len(matches) == 0 {
+        return
+    }
+    head := strings.TrimSuffix(c.input, word)
+    if len(matches) == 1 {
+        c.input = head + matches[0] + " "
+        return
+    }
+    c.input = head + commonPrefix(matches)
+    c.Printf("%s", strings.Join(matches, "  "))
+}
+
+// pressed, or held long enough for the OS to repeat it
+func typing(in Input, b pixelgl.Button) bool {
+    return in.JustPressed(b) || in.Repeated(b)
+}
+
+// handles the toggle key and, while open, editing the line. call it before anything else reads
+// input, and hand the rest of the frame BlockInput(in) when it reports the input as taken: while
+// open, and on the frame the toggle key or Escape closes it, so that Escape doesn't also pause.
+func (c *Console) Update(in Input) bool {
+    if in.JustPressed(c.Key) {
+        c.Open = !c.Open
+        // the key's own character shouldn't end up in the line
+        return true
+    }
+    if !c.Open {
+        return false
+    }
+    c.input += in.Typed()
+    switch {
+    case shortcutHeld(in) && typing(in, pixelgl.KeyV):
+        c.input += clipboardLine()
+    case shortcutHeld(in) && in.JustPressed(pixelgl.KeyC) && c.input != "":
+        SetClipboardText(c.input)
+    case typing(in, pixelgl.KeyBackspace) && c.input != "":
+        runes := []rune(c.input)
+        c.input = string(runes[:len(runes)-1])
+    case in.JustPressed(pixelgl.KeyEnter) || in.JustPressed(pixelgl.KeyKPEnter):
+        c.submit()
+    case in.JustPressed(pixelgl.KeyTab):
+        c.complete()
+    case typing(in, pixelgl.KeyUp) && c.browsing > 0:
+        c.browsing--
+        c.input = c.history[c.browsing]
+    case typing(in, pixelgl.KeyDown) && c.browsing < len(c.history):
+        c.browsing++
+        c.input = ""
+        if c.browsing < len(c.history) {
+            c.input = c.history[c.browsing]
+        }
+    case typing(in, pixelgl.KeyPageUp):
+        c.scroll += 5
+    case typing(in, pixelgl.KeyPageDown):
+        c.scroll -= 5
+    case in.JustPressed(pixelgl.KeyEscape):
+        c.Open = false
+    }
+    if c.scroll < 0 {
+        c.scroll = 0
+    }
+    return true
+}
+
+// draws the console across the top of bounds, straight onto the window like the debug overlay
+func (c *Console) Draw(t RenderTarget, bounds pixel.Rect) {
+    if !c.Open {
+        return
+    }
+    t.SetMatrix(pixel.IM)
+    const pad = 8.0
+    opts := TextOptions{Size: 14}
+    atlas, err := DefaultFont().Atlas(opts.Size)
+    if err != nil {
+        return
+    }
+    lineH := atlas.LineHeight()
+    panel := pixel.R(bounds.Min.X, bounds.Max.Y-bounds.H()*c.Height, bounds.Max.X, bounds.Max.Y)
+
+    c.imd.Clear()
+    c.imd.Color = pixel.RGBA{A: 0.8}
+    c.imd.Push(panel.Min, panel.Max)
+    c.imd.Rectangle(0)
+    c.imd.Color = colornames.Dimgray
+    c.imd.Push(pixel.V(panel.Min.X, panel.Min.Y+lineH+pad), pixel.V(panel.Max.X, panel.Min.Y+lineH+pad))
+    c.imd.Line(1)
+    c.imd.Draw(t)
+
+    baseline := panel.Min.Y + pad/2 + (lineH - atlas.Ascent())
+    DrawText(t, nil, "> "+c.input+"_", pixel.V(panel.Min.X+pad, baseline), opts)
+
+    c.mu.Lock()
+    visible := int((panel.H() - lineH - 2*pad) / lineH)
+    if max := len(c.lines) - visible; c.scroll > max {
+        c.scroll = max
+    }
+    if c.scroll < 0 {
+        c.scroll = 0
+    }
+    end := len(c.lines) - c.scroll
+    start := end - visible
+    if start < 0 {
+        start = 0
+    }
+    shown := strings.Join(c.lines[start:end], "\n")
+    c.mu.Unlock()
+
+    lines := end - start
+    top := panel.Min.Y + lineH + pad*1.5 + float64(lines-1)*lineH + (lineH - atlas.Ascent())
+    DrawText(t, nil, shown, pixel.V(panel.Min.X+pad, top), TextOptions{Size: opts.Size, Color: color.Gray{200}})
+}
+
+// wraps in so the keyboard, mouse buttons, scroll and gamepads read as idle, e.g. while the console has them
+func BlockInput(in Input) Input {
+    return blockedInput{in}
+}
+
+type blockedInput struct {
+    Input
+}
+
+func (blockedInput) Pressed(b pixelgl.Button) bool      { return false }
+func (blockedInput) JustPressed(b pixelgl.Button) bool  { return false }
+func (blockedInput) JustReleased(b pixelgl.Button) bool { return false }
+func (blockedInput) Repeated(b pixelgl.Button) bool     { return false }
+func (blockedInput) MouseScroll() pixel.Vec             { return pixel.ZV }
+func (blockedInput) Typed() string                      { return "" }
+
+func (blockedInput) JoystickPressed(js pixelgl.Joystick, b pixelgl.GamepadButton) bool { return false }
+func (blockedInput) JoystickJustPressed(js pixelgl.Joystick, b pixelgl.GamepadButton) bool {
+    return false
+}
+func (blockedInput) JoystickJustReleased(js pixelgl.Joystick, b pixelgl.GamepadButton) bool {
+    return false
+}
+func (blockedInput) JoystickAxis(js pixelgl.Joystick, axis pixelgl.GamepadAxis) float64 {
+    // triggers rest at -1
+    if axis == pixelgl.AxisLeftTrigger || axis == pixelgl.AxisRightTrigger {
+        return -1
+    }
+    return 0
+}
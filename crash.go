@@ -0,0 +1,119 @@
+package main
+
+import (
+    "fmt"
+    "image"
+    "image/png"
+    "os"
+    "path/filepath"
+    "runtime"
+    "strings"
+    "time"
+
+    "github.com/faiface/mainthread"
+    "github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// where crash reports are written, relative to the working directory
+const CRASHDIR = "crashes"
+
+// log lines kept for crash reports
+const CRASHLOGLINES = 100
+
+// the end of the log, kept for crash reports
+var recentLog = NewLogTail(CRASHLOGLINES)
+
+// the GL driver strings, read on the main thread
+func glInfo() (info string) {
+    defer func() {
+        if recover() != nil {
+            info = "unavailable"
+        }
+    }()
+    mainthread.Call(func() {
+        info = fmt.Sprintf("%s, %s, %s",
+            gl.GoStr(gl.GetString(gl.VERSION)),
+            gl.GoStr(gl.GetString(gl.VENDOR)),
+            gl.GoStr(gl.GetString(gl.RENDERER)))
+    })
+    return info
+}
+
+// the last frame, or nil when the window is gone or the GPU can't be read back
+func lastFrame() (img image.Image) {
+    defer func() {
+        if recover() != nil {
+            img = nil
+        }
+    }()
+    if win == nil || win.Closed() {
+        return nil
+    }
+    return CaptureCanvas(win.Canvas())
+}
+
+// writes a report for the panic value into CRASHDIR and returns its path. gpu and shot are
+// left out when they couldn't be collected.
+func writeCrashReport(value interface{}, stack []byte, gpu string, shot image.Image) (string, error) {
+    if err := os.MkdirAll(CRASHDIR, 0755); err != nil {
+        return "", err
+    }
+    base := filepath.Join(CRASHDIR, "crash_"+time.Now().Format("2006-01-02_15-04-05"))
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "panic: %v\n\n", value)
+    fmt.Fprintf(&b, "time:    %s\n", time.Now().Format(time.RFC3339))
+    fmt.Fprintf(&b, "go:      %s %s/%s, %d cpus\n", runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+    if gpu != "" {
+        fmt.Fprintf(&b, "gl:      %s\n", gpu)
+    }
+    if win != nil {
+        fmt.Fprintf(&b, "window:  %v\n", win.Bounds().Size())
+    }
+    fmt.Fprintf(&b, "frame:   %d\n", clock.Frame())
+    if shot != nil {
+        if file, err := os.Create(base + ".png"); err == nil {
+            if png.Encode(file, shot) == nil {
+                fmt.Fprintf(&b, "screen:  %s\n", filepath.Base(base+".png"))
+            }
+            file.Close()
+        }
+    }
+    fmt.Fprintf(&b, "\nstack:\n%s\n", stack)
+    if entries := recentLog.Entries(); len(entries) > 0 {
+        fmt.Fprintf(&b, "\nlog:\n")
+        for _, e := range entries {
+            fmt.Fprintln(&b, e)
+        }
+    }
+
+    path := base + ".txt"
+    if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+        return "", err
+    }
+    return path, nil
+}
+
+// turns a panic into a crash report, tells the player where it is and returns an error in place
+// of the panic. gpu says whether the main thread is still running the window, so the GL strings
+// and last frame can be read through mainthread.Call; a panic on the main thread itself has
+// already torn the window down.
+func reportCrash(value interface{}, gpu bool) error {
+    stack := make([]byte, 1<<16)
+    stack = stack[:runtime.Stack(stack, true)]
+
+    info := ""
+    var shot image.Image
+    if gpu && win != nil {
+        info = glInfo()
+        shot = lastFrame()
+    }
+
+    path, err := writeCrashReport(value, stack, info, shot)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "the game crashed and the crash report couldn't be written: %v\n%s", err, stack)
+        return fmt.Errorf("crash: %v", value)
+    }
+    fmt.Fprintf(os.Stderr, "the game crashed, a report was written to %s\n", path)
+    return fmt.Errorf("crash: %v (report in %s)", value, path)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+    "fmt"
+
+    "github.com/faiface/mainthread"
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+    "github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// common cursor states; any other name works too
+const (
+    CursorDefault = "default"
+    CursorHover   = "hover"
+    CursorGrab    = "grab"
+)
+
+type cursorVariant struct {
+    sprite *pixel.Sprite
+    // from the top-left of the frame, like image editors and the OS measure it
+    hotspot  pixel.Vec
+    hardware *glfw.Cursor
+}
+
+// replaces the OS cursor with a sprite per state, or with OS cursors made from pictures, which
+// follow the mouse without the frame of lag a drawn one has
+type Cursor struct {
+    // the variant shown, switched by the game, e.g. to CursorHover over buttons
+    State   string
+    Scale   float64
+    Visible bool
+
+    win      *pixelgl.Window
+    variants map[string]*cursorVariant
+    // what the OS cursor was last set up for
+    applied string
+    drawn   bool
+    dirty   bool
+}
+
+func NewCursor(win *pixelgl.Window) *Cursor {
+    return &Cursor{
+        State:    CursorDefault,
+        Scale:    1,
+        Visible:  true,
+        win:      win,
+        variants: make(map[string]*cursorVariant),
+        dirty:    true,
+    }
+}
+
+func (c *Cursor) variant(state string) *cursorVariant {
+    v, ok := c.variants[state]
+    if !ok {
+        v = &cursorVariant{}
+        c.variants[state] = v
+    }
+    return v
+}
+
+// draws sprite for state with hotspot pixels in from its top-left corner
+func (c *Cursor) Set(state string, sprite *pixel.Sprite, hotspot pixel.Vec) {
+    v := c.variant(state)
+    v.sprite, v.hotspot = sprite, hotspot
+    c.dirty = true
+}
+
+// uses an OS cursor made from pic for state, falling back to the sprite set with Set when the
+// platform can't make one
+func (c *Cursor) SetHardware(state string, pic *pixel.PictureData, hotspot pixel.Vec) error {
+    var cursor *glfw.Cursor
+    var err error
+    mainthread.Call(func() {
+        // glfw panics with the platform's error when it can't make the cursor
+        defer func() {
+            if r := recover(); r != nil {
+                err = fmt.Errorf("cursor %s: %v", state, r)
+            }
+        }()
+        cursor = glfw.CreateCursor(pic.Image(), int(hotspot.X), int(hotspot.Y))
+    })
+    if err != nil {
+        return err
+    }
+    v := c.variant(state)
+    if v.hardware != nil {
+        mainthread.Call(v.hardware.Destroy)
+    }
+    v.hardware = cursor
+    c.dirty = true
+    return nil
+}
+
+func (c *Cursor) current() *cursorVariant {
+    if v, ok := c.variants[c.State]; ok {
+        return v
+    }
+    return c.variants[CursorDefault]
+}
+
+// shows or hides the OS cursor to match State; call once per frame before Draw
+func (c *Cursor) Update() {
+    v := c.current()
+    drawn := c.Visible && v != nil && v.hardware == nil && v.sprite != nil
+    key := c.State
+    if !c.Visible {
+        key = ""
+    }
+    if !c.dirty && key == c.applied && drawn == c.drawn {
+        return
+    }
+    c.applied, c.drawn, c.dirty = key, drawn, false
+
+    var hardware *glfw.Cursor
+    if v != nil {
+        hardware = v.hardware
+    }
+    mainthread.Call(func() {
+        if gw := glfwWindow(); gw != nil {
+            // nil puts back the arrow
+            gw.SetCursor(hardware)
+        }
+    })
+    c.win.SetCursorVisible(c.Visible && !drawn)
+}
+
+// draws the sprite cursor with its hotspot at pos, e.g. win.MousePosition() after everything else
+func (c *Cursor) Draw(t RenderTarget, pos pixel.Vec) {
+    v := c.current()
+    if !c.drawn || v == nil || v.sprite == nil {
+        return
+    }
+    // the hotspot is measured down from the top-left, the sprite is drawn around its center
+    half := v.sprite.Frame().Size().Scaled(0.5)
+    offset := pixel.V(half.X-v.hotspot.X, v.hotspot.Y-half.Y).Scaled(c.Scale)
+    t.SetMatrix(pixel.IM)
+    v.sprite.Draw(t, pixel.IM.Scaled(pixel.ZV, c.Scale).Moved(pos.Add(offset)))
+}
+
+// frees the OS cursors and puts back the default one
+func (c *Cursor) Destroy() {
+    mainthread.Call(func() {
+        if gw := glfwWindow(); gw != nil {
+            gw.SetCursor(nil)
+        }
+        for _, v := range c.variants {
+            if v.hardware != nil {
+                v.hardware.Destroy()
+                v.hardware = nil
+            }
+        }
+    })
+    c.win.SetCursorVisible(true)
+    c.dirty = true
+}
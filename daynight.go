@@ -0,0 +1,222 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "sort"
+
+    "github.com/faiface/pixel"
+)
+
+// hours in an in-game day
+const DAYHOURS = 24.0
+
+type dayLight struct {
+    light      *Light
+    day, night float64
+}
+
+type dayEvent struct {
+    name string
+    fn   func()
+}
+
+// an in-game clock that fades Lighting's ambient, a screen tint and bound lights between day and
+// night, easing through twilight around Sunrise and Sunset
+type DayCycle struct {
+    // hour of the day, 0 up to DAYHOURS
+    Time float64
+    // real seconds a whole day takes
+    Length float64
+    Paused bool
+    // hours the sun comes up and goes down, and how many hours each change takes
+    Sunrise, Sunset, Twilight float64
+    Ease                      EaseFunc
+
+    DayAmbient, NightAmbient float64
+    // the tint blends from night to day, passing dawn and dusk at the middle of each twilight
+    DayColor, NightColor, DawnColor, DuskColor pixel.RGBA
+
+    // when set, Update drives their Ambient and uTint
+    Lighting *Lighting
+    Grade    *PostEffect
+
+    day    int
+    marks  map[string]float64
+    events []dayEvent
+    lights []dayLight
+}
+
+// length is the real seconds in a day; the clock starts at 8am
+func NewDayCycle(length float64) *DayCycle {
+    return &DayCycle{
+        Time:         8,
+        Length:       length,
+        Sunrise:      6,
+        Sunset:       18,
+        Twilight:     1.5,
+        Ease:         InOutSine,
+        DayAmbient:   1,
+        NightAmbient: 0.15,
+        DayColor:     pixel.RGB(1, 1, 1),
+        NightColor:   pixel.RGB(0.35, 0.4, 0.7),
+        DawnColor:    pixel.RGB(1, 0.75, 0.6),
+        DuskColor:    pixel.RGB(1, 0.6, 0.45),
+        marks:        make(map[string]float64),
+    }
+}
+
+// names a time of day for On; sunrise, sunset, noon and midnight are always there
+func (c *DayCycle) Mark(name string, hour float64) {
+    c.marks[name] = math.Mod(hour, DAYHOURS)
+}
+
+func (c *DayCycle) mark(name string) (float64, bool) {
+    switch name {
+    case "sunrise":
+        return c.Sunrise, true
+    case "sunset":
+        return c.Sunset, true
+    case "noon":
+        return 12, true
+    case "midnight":
+        return 0, true
+    }
+    h, ok := c.marks[name]
+    return h, ok
+}
+
+// calls fn every day when the clock passes the named time
+func (c *DayCycle) On(name string, fn func()) {
+    c.events = append(c.events, dayEvent{name, fn})
+}
+
+// fades a light's intensity between day and night values, e.g. 0 and 1 for a street lamp
+func (c *DayCycle) AddLight(l *Light, day, night float64) {
+    c.lights = append(c.lights, dayLight{l, day, night})
+}
+
+func (c *DayCycle) RemoveLight(l *Light) {
+    for i, dl := range c.lights {
+        if dl.light == l {
+            c.lights = append(c.lights[:i], c.lights[i+1:]...)
+            return
+        }
+    }
+}
+
+// days passed since the cycle started
+func (c *DayCycle) Day() int {
+    return c.day
+}
+
+// jumps to hour without firing any callbacks in between
+func (c *DayCycle) SetTime(hour float64) {
+    c.Time = math.Mod(hour, DAYHOURS)
+    if c.Time < 0 {
+        c.Time += DAYHOURS
+    }
+    c.apply()
+}
+
+// the time as "hh:mm"
+func (c *DayCycle) Clock() string {
+    minutes := int(c.Time * 60)
+    return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// advances the clock and fires any named times it passed. dt is in seconds.
+func (c *DayCycle) Update(dt float64) {
+    if !c.Paused && c.Length > 0 {
+        prev := c.Time
+        c.Time += dt / c.Length * DAYHOURS
+        wrapped := c.Time >= DAYHOURS
+        if wrapped {
+            c.day += int(c.Time / DAYHOURS)
+            c.Time = math.Mod(c.Time, DAYHOURS)
+        }
+        c.fire(prev, c.Time, wrapped)
+    }
+    c.apply()
+}
+
+// runs callbacks between prev and now in clock order, so a frame spanning both sunset and a
+// later mark still sees sunset first
+func (c *DayCycle) fire(prev, now float64, wrapped bool) {
+    type due struct {
+        at float64
+        fn func()
+    }
+    var fired []due
+    for _, e := range c.events {
+        h, ok := c.mark(e.name)
+        if !ok {
+            continue
+        }
+        if !wrapped && h > prev && h <= now {
+            fired = append(fired, due{h, e.fn})
+        } else if wrapped && (h > prev || h <= now) {
+            // times after the wrap sort after the ones before it
+            at := h
+            if h <= now {
+                at += DAYHOURS
+            }
+            fired = append(fired, due{at, e.fn})
+        }
+    }
+    sort.SliceStable(fired, func(i, j int) bool { return fired[i].at < fired[j].at })
+    for _, d := range fired {
+        d.fn()
+    }
+}
+
+// 0 at night up to 1 in full day
+func (c *DayCycle) Daylight() float64 {
+    half := c.Twilight / 2
+    rise := c.ramp((c.Time - (c.Sunrise - half)) / c.Twilight)
+    set := 1 - c.ramp((c.Time-(c.Sunset-half))/c.Twilight)
+    return math.Min(rise, set)
+}
+
+func (c *DayCycle) ramp(t float64) float64 {
+    if math.IsNaN(t) || math.IsInf(t, 0) {
+        t = math.Copysign(1, t)
+    }
+    t = math.Max(0, math.Min(1, t))
+    if c.Ease != nil {
+        t = c.Ease(t)
+    }
+    return t
+}
+
+func (c *DayCycle) Ambient() float64 {
+    return c.NightAmbient + (c.DayAmbient-c.NightAmbient)*c.Daylight()
+}
+
+// the screen tint for the current time
+func (c *DayCycle) Tint() pixel.RGBA {
+    tint := lerpRGBA(c.NightColor, c.DayColor, c.Daylight())
+    // dawn and dusk peak halfway through their twilight and fade out at either end
+    if c.Twilight > 0 {
+        if w := 1 - math.Abs(c.Time-c.Sunrise)/(c.Twilight/2); w > 0 {
+            tint = lerpRGBA(tint, c.DawnColor, c.ramp(w))
+        }
+        if w := 1 - math.Abs(c.Time-c.Sunset)/(c.Twilight/2); w > 0 {
+            tint = lerpRGBA(tint, c.DuskColor, c.ramp(w))
+        }
+    }
+    return tint
+}
+
+func (c *DayCycle) apply() {
+    daylight := c.Daylight()
+    if c.Lighting != nil {
+        c.Lighting.Ambient = c.Ambient()
+    }
+    if c.Grade != nil {
+        c.Grade.SetColor("uTint", c.Tint())
+    }
+    for _, dl := range c.lights {
+        dl.light.Intensity = dl.night + (dl.day-dl.night)*daylight
+    }
+}
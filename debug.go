@@ -0,0 +1,172 @@
+package main
+
+import (
+    "fmt"
+    "image/color"
+    "runtime"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+    "golang.org/x/image/colornames"
+)
+
+// frames kept for the frame time graph
+const DEBUGHISTORY = 120
+
+// how often memory stats are sampled, since ReadMemStats stops the world
+const DEBUGMEMINTERVAL = 500 * time.Millisecond
+
+// an F3 style overlay drawn straight onto the window after everything else, so post-processing,
+// the camera and the virtual screen don't touch it
+type DebugOverlay struct {
+    Visible bool
+    Key     pixelgl.Button
+
+    frameTimes [DEBUGHISTORY]float64
+    frame      int
+    counters   map[string]int
+    watches    map[string]func() interface{}
+    mem        runtime.MemStats
+    lastMem    time.Time
+    imd        *imdraw.IMDraw
+}
+
+func NewDebugOverlay() *DebugOverlay {
+    return &DebugOverlay{
+        Key:      pixelgl.KeyF3,
+        counters: make(map[string]int),
+        watches:  make(map[string]func() interface{}),
+        imd:      imdraw.New(nil),
+    }
+}
+
+// shows a named value that's evaluated every frame the overlay is open
+func (d *DebugOverlay) Watch(name string, fn func() interface{}) {
+    d.watches[name] = fn
+}
+
+func (d *DebugOverlay) Unwatch(name string) {
+    delete(d.watches, name)
+}
+
+// sets a counter for this frame, e.g. the number of live entities
+func (d *DebugOverlay) Count(name string, n int) {
+    d.counters[name] = n
+}
+
+// records the frame time and handles the toggle key. dt is in seconds.
+func (d *DebugOverlay) Update(in Input, dt float64) {
+    if in.JustPressed(d.Key) {
+        d.Visible = !d.Visible
+    }
+    d.frameTimes[d.frame%DEBUGHISTORY] = dt
+    d.frame++
+    if d.Visible && time.Since(d.lastMem) >= DEBUGMEMINTERVAL {
+        runtime.ReadMemStats(&d.mem)
+        d.lastMem = time.Now()
+    }
+}
+
+func (d *DebugOverlay) averageFrameTime() float64 {
+    n := d.frame
+    if n > DEBUGHISTORY {
+        n = DEBUGHISTORY
+    }
+    if n == 0 {
+        return 0
+    }
+    total := 0.0
+    for i := 0; i < n; i++ {
+        total += d.frameTimes[i]
+    }
+    return total / float64(n)
+}
+
+func (d *DebugOverlay) lines() []string {
+    avg := d.averageFrameTime()
+    fps := 0.0
+    if avg > 0 {
+        fps = 1 / avg
+    }
+    stats := renderer.Stats()
+    lines := []string{
+        fmt.Sprintf("%.0f fps  %.2f ms", fps, avg*1000),
+        fmt.Sprintf("layers %d  calls %d  batches %d", stats.Layers, stats.Calls, stats.Batches),
+        fmt.Sprintf("drawn %d  culled %d", stats.Drawn, stats.Culled),
+        fmt.Sprintf("heap %.1f MB  gc %d  goroutines %d", float64(d.mem.HeapAlloc)/1e6, d.mem.NumGC, runtime.NumGoroutine()),
+        fmt.Sprintf("textures %.1f MB  tweens %d", float64(assets.MemoryUsage())/1e6, tweens.Len()),
+    }
+
+    var names []string
+    for name := range d.counters {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        lines = append(lines, fmt.Sprintf("%s %d", name, d.counters[name]))
+    }
+
+    names = names[:0]
+    for name := range d.watches {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        lines = append(lines, fmt.Sprintf("%s = %v", name, d.watches[name]()))
+    }
+    return lines
+}
+
+// draws the overlay in the window's top-left corner
+func (d *DebugOverlay) Draw(t RenderTarget, bounds pixel.Rect) {
+    if !d.Visible {
+        return
+    }
+    t.SetMatrix(pixel.IM)
+    const pad, graphH, width = 8.0, 40.0, 300.0
+    opts := TextOptions{Size: 13}
+    text := strings.Join(d.lines(), "\n")
+    size, err := MeasureText(nil, text, opts)
+    if err != nil {
+        return
+    }
+
+    top := bounds.Max.Y - pad
+    left := bounds.Min.X + pad
+    panel := pixel.R(left, top-size.Y-graphH-3*pad, left+width, top)
+    d.imd.Clear()
+    d.imd.Color = pixel.RGBA{A: 0.7}
+    d.imd.Push(panel.Min, panel.Max)
+    d.imd.Rectangle(0)
+
+    // one bar per frame, with the 60 fps budget as a line
+    graph := pixel.R(left+pad, panel.Min.Y+pad, left+width-pad, panel.Min.Y+pad+graphH)
+    barW := graph.W() / DEBUGHISTORY
+    for i := 0; i < DEBUGHISTORY; i++ {
+        ft := d.frameTimes[(d.frame+i)%DEBUGHISTORY]
+        h := ft / (1.0 / 30) * graph.H()
+        if h > graph.H() {
+            h = graph.H()
+        }
+        d.imd.Color = colornames.Limegreen
+        if ft > 1.0/55 {
+            d.imd.Color = colornames.Orangered
+        }
+        x := graph.Min.X + float64(i)*barW
+        d.imd.Push(pixel.V(x, graph.Min.Y), pixel.V(x+barW, graph.Min.Y+h))
+        d.imd.Rectangle(0)
+    }
+    d.imd.Color = color.RGBA{255, 255, 255, 128}
+    budget := graph.Min.Y + graph.H()/2
+    d.imd.Push(pixel.V(graph.Min.X, budget), pixel.V(graph.Max.X, budget))
+    d.imd.Line(1)
+    d.imd.Draw(t)
+
+    // the first baseline sits one ascent below the top padding
+    atlas, _ := DefaultFont().Atlas(opts.Size)
+    DrawText(t, nil, text, pixel.V(left+pad, top-pad-atlas.Ascent()), opts)
+}
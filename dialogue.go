@@ -0,0 +1,372 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "strings"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+    "github.com/faiface/pixel/text"
+)
+
+// how many letters a second a dialogue line types out at
+const DIALOGUESPEED = 40
+
+// how tall the dialogue box along the bottom of the screen is, and how big a portrait is drawn
+// inside it, in virtual pixels
+const DIALOGUEHEIGHT = 120
+const DIALOGUEPORTRAIT = 96
+
+// someone who talks in a dialogue
+type DialogueSpeaker struct {
+    Name string `json:"name"`
+    // a picture shown beside what they say; none when it's ""
+    Portrait string `json:"portrait"`
+}
+
+// an answer the player can pick
+type DialogueChoice struct {
+    Text string `json:"text"`
+    // the node it goes to; "" ends the conversation
+    Next string `json:"next"`
+    // handed to OnEvent when it's picked
+    Event string `json:"event"`
+}
+
+// one box of text
+type DialogueLine struct {
+    // a key of Dialogue.Speakers; "" for narration
+    Speaker string `json:"speaker"`
+    Text    string `json:"text"`
+    // handed to OnEvent as the line comes up, e.g. to set a quest flag
+    Event string `json:"event"`
+    // asked once the line has typed out; the conversation follows the one picked
+    Choices []DialogueChoice `json:"choices"`
+    // the node to jump to after the line rather than carrying on with the next; choices win
+    Goto string `json:"goto"`
+}
+
+// a conversation: nodes of lines played in order, from Start until a node runs out or a choice
+// or goto leads nowhere. as a data file,
+//
+//	{
+//		"speakers": {"elder": {"name": "Elder", "portrait": "portraits/elder.png"}},
+//		"nodes": {
+//			"start": [
+//				{"speaker": "elder", "text": "You're finally awake."},
+//				{"speaker": "elder", "text": "Will you help us?", "choices": [
+//					{"text": "Of course.", "next": "yes", "event": "quest_accepted"},
+//					{"text": "Not today."}
+//				]}
+//			],
+//			"yes": [{"speaker": "elder", "text": "Then take this."}]
+//		}
+//	}
+type Dialogue struct {
+    // the node it opens with; "start" when it's ""
+    Start    string                     `json:"start"`
+    Speakers map[string]DialogueSpeaker `json:"speakers"`
+    Nodes    map[string][]DialogueLine  `json:"nodes"`
+}
+
+// reads a dialogue from a JSON asset, checking that every speaker and node it names exists
+func LoadDialogue(name string) (*Dialogue, error) {
+    data, err := ReadAsset(name)
+    if err != nil {
+        return nil, err
+    }
+    var d Dialogue
+    if err := json.Unmarshal(data, &d); err != nil {
+        return nil, fmt.Errorf("%s: %v", name, err)
+    }
+    if err := d.check(); err != nil {
+        return nil, fmt.Errorf("%s: %v", name, err)
+    }
+    return &d, nil
+}
+
+func (d *Dialogue) start() string {
+    if d.Start == "" {
+        return "start"
+    }
+    return d.Start
+}
+
+func (d *Dialogue) check() error {
+    if _, ok := d.Nodes[d.start()]; !ok {
+        return fmt.Errorf("no start node %q", d.start())
+    }
+    target := func(node, next string) error {
+        if _, ok := d.Nodes[next]; next != "" && !ok {
+            return fmt.Errorf("%s goes to %q, which isn't a node", node, next)
+        }
+        return nil
+    }
+    for node, lines := range d.Nodes {
+        for _, line := range lines {
+            if _, ok := d.Speakers[line.Speaker]; line.Speaker != "" && !ok {
+                return fmt.Errorf("%s: no speaker %q", node, line.Speaker)
+            }
+            if err := target(node, line.Goto); err != nil {
+                return err
+            }
+            for _, c := range line.Choices {
+                if err := target(node, c.Next); err != nil {
+                    return err
+                }
+            }
+        }
+    }
+    return nil
+}
+
+// plays a Dialogue in a box along the bottom of the screen over the scene underneath, which stops
+// updating while it's up so the game waits for the conversation. each line types out at Speed;
+// confirm or a click shows the rest of it, then moves on, and choices are buttons above the box.
+// it holds while the game is paused. names, lines and choices are looked up with T, so a
+// dialogue's text can be keys into the string tables.
+type DialogueScene struct {
+    BaseScene
+    Dialogue *Dialogue
+    // letters a second; 0 shows each line whole
+    Speed   float64
+    Style   UIStyle
+    Font    *Font
+    Options TextOptions
+    // runs with each line's and picked choice's Event, when it has one
+    OnEvent func(event string)
+    // runs when the conversation ends, as the scene pops
+    OnEnd func()
+    UI    *UI
+
+    node  string
+    line  int
+    shown float64
+    ended bool
+
+    portraits map[string]*pixel.Sprite
+    imd       *imdraw.IMDraw
+}
+
+func NewDialogueScene(d *Dialogue) *DialogueScene {
+    return &DialogueScene{
+        Dialogue:  d,
+        Speed:     DIALOGUESPEED,
+        Style:     DefaultUIStyle(),
+        Options:   TextOptions{Size: FONTSIZE},
+        UI:        NewUI(),
+        portraits: map[string]*pixel.Sprite{},
+        imd:       imdraw.New(nil),
+    }
+}
+
+// pushes a DialogueScene playing d over the current scene
+func StartDialogue(d *Dialogue) *DialogueScene {
+    s := NewDialogueScene(d)
+    scenes.Push(s)
+    return s
+}
+
+func (s *DialogueScene) Overlay() bool {
+    return true
+}
+
+func (s *DialogueScene) Enter() {
+    s.goTo(s.Dialogue.start())
+}
+
+// the line on screen, or nil once it's over
+func (s *DialogueScene) Line() *DialogueLine {
+    lines := s.Dialogue.Nodes[s.node]
+    if s.ended || s.line >= len(lines) {
+        return nil
+    }
+    return &lines[s.line]
+}
+
+// whether the line on screen has finished typing out
+func (s *DialogueScene) Revealed() bool {
+    line := s.Line()
+    return line == nil || s.Speed <= 0 || int(s.shown) >= len([]rune(T(line.Text)))
+}
+
+func (s *DialogueScene) goTo(node string) {
+    if node == "" {
+        s.end()
+        return
+    }
+    s.node, s.line = node, -1
+    s.advance()
+}
+
+// moves on to the next line of the node, ending the conversation past its last
+func (s *DialogueScene) advance() {
+    s.line++
+    s.shown = 0
+    line := s.Line()
+    if line == nil {
+        s.end()
+        return
+    }
+    s.event(line.Event)
+    if len(line.Choices) > 0 {
+        s.UI.Focus(fmt.Sprintf("%s##choice0", line.Choices[0].Text))
+    }
+}
+
+func (s *DialogueScene) event(event string) {
+    if event != "" && s.OnEvent != nil {
+        s.OnEvent(event)
+    }
+}
+
+func (s *DialogueScene) end() {
+    if s.ended {
+        return
+    }
+    s.ended = true
+    scenes.Pop()
+    if s.OnEnd != nil {
+        s.OnEnd()
+    }
+}
+
+func (s *DialogueScene) HandleInput(in Input) {
+    s.UI.Begin(in)
+    line := s.Line()
+    if line == nil || scenes.Paused {
+        return
+    }
+    next := in.JustPressed(pixelgl.MouseButtonLeft) || (actions != nil && actions.JustPressed("confirm"))
+    switch {
+    case !s.Revealed():
+        if next {
+            s.shown = float64(len([]rune(T(line.Text))))
+        }
+    case len(line.Choices) > 0:
+        s.choices(line)
+    case next:
+        if line.Goto != "" {
+            s.goTo(line.Goto)
+        } else {
+            s.advance()
+        }
+    }
+}
+
+// lays out line's choices as buttons above the box and follows the one picked
+func (s *DialogueScene) choices(line *DialogueLine) {
+    ui := s.UI
+    style := ui.Scaled()
+    h := float64(len(line.Choices))*(style.RowHeight+style.Spacing) - style.Spacing + 2*style.Padding
+    box := s.box()
+    w := MENUWIDTH * accessibility.UIScale()
+    ui.BeginPanel(pixel.R(box.Max.X-w, box.Max.Y+style.Spacing, box.Max.X, box.Max.Y+style.Spacing+h), 0)
+    defer ui.EndPanel()
+    for i, c := range line.Choices {
+        if ui.Button(fmt.Sprintf("%s##choice%d", c.Text, i)) {
+            s.event(c.Event)
+            s.goTo(c.Next)
+            return
+        }
+    }
+}
+
+func (s *DialogueScene) Update(dt float64) {
+    if line := s.Line(); line != nil && s.Speed > 0 {
+        s.shown = math.Min(s.shown+s.Speed*dt, float64(len([]rune(T(line.Text)))))
+    }
+}
+
+// the box across the bottom of the screen, at the UI scale
+func (s *DialogueScene) box() pixel.Rect {
+    scale := accessibility.UIScale()
+    b := inset(screen.Bounds(), s.Style.Padding*scale)
+    return pixel.R(b.Min.X, b.Min.Y, b.Max.X, b.Min.Y+DIALOGUEHEIGHT*scale)
+}
+
+func (s *DialogueScene) portrait(path string) *pixel.Sprite {
+    sprite, ok := s.portraits[path]
+    if !ok {
+        // a placeholder rather than a missing face, so it's noticed
+        pic, _ := LoadPictureOrPlaceholder(path)
+        sprite = pixel.NewSprite(pic, pic.Bounds())
+        s.portraits[path] = sprite
+    }
+    return sprite
+}
+
+func (s *DialogueScene) Draw(t RenderTarget) {
+    line := s.Line()
+    if line == nil {
+        return
+    }
+    t.SetMatrix(pixel.IM)
+    scale := accessibility.UIScale()
+    style, options := s.Style.Scaled(scale), s.Options.scaled(scale)
+    box := s.box()
+    s.imd.Clear()
+    s.imd.Color = style.Panel
+    s.imd.Push(box.Min, box.Max)
+    s.imd.Rectangle(0)
+    s.imd.Draw(t)
+
+    inner := inset(box, style.Padding)
+    speaker := s.Dialogue.Speakers[line.Speaker]
+    if speaker.Portrait != "" {
+        sprite := s.portrait(speaker.Portrait)
+        frame := sprite.Frame()
+        size := DIALOGUEPORTRAIT * scale
+        at := pixel.V(inner.Min.X+size/2, inner.Center().Y)
+        sprite.Draw(t, pixel.IM.Scaled(pixel.ZV, math.Min(size/frame.W(), size/frame.H())).Moved(at))
+        inner.Min.X += size + style.Padding
+    }
+
+    font := s.Font
+    if font == nil {
+        font = DefaultFont()
+    }
+    atlas, err := font.Atlas(options.size())
+    if err != nil {
+        return
+    }
+    y := inner.Max.Y - atlas.Ascent()
+    if speaker.Name != "" {
+        opts := options
+        opts.Color = style.Accent
+        DrawText(t, font, T(speaker.Name), pixel.V(inner.Min.X, y), opts)
+        y -= lineHeight(atlas, options)
+    }
+    opts := options
+    opts.Color, opts.Width = style.Text, 0
+    DrawText(t, font, s.typed(atlas, T(line.Text), inner.W()), pixel.V(inner.Min.X, y), opts)
+    s.UI.Draw(t)
+}
+
+// as much of text as has typed out, wrapped where the whole of it would be so words don't jump
+// to the next line halfway through
+func (s *DialogueScene) typed(atlas *text.Atlas, full string, width float64) string {
+    lines := WrapText(atlas, full, width)
+    if s.Revealed() {
+        return strings.Join(lines, "\n")
+    }
+    left := int(s.shown)
+    var b strings.Builder
+    for i, line := range lines {
+        if i > 0 {
+            b.WriteString("\n")
+        }
+        runes := []rune(line)
+        if len(runes) >= left {
+            b.WriteString(string(runes[:left]))
+            break
+        }
+        b.WriteString(line)
+        // the space WrapText broke the line at
+        left -= len(runes) + 1
+    }
+    return b.String()
+}
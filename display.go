@@ -0,0 +1,402 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/faiface/mainthread"
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+    "github.com/go-gl/glfw/v3.3/glfw"
+)
+
+var displayLog = logging.Module("display")
+
+// how often TitleFPS rewrites the title
+const TITLEFPSINTERVAL = 500 * time.Millisecond
+
+type DisplayMode string
+
+const (
+    DisplayWindowed DisplayMode = "windowed"
+    // a window without decorations covering the whole monitor at its desktop resolution
+    DisplayBorderless DisplayMode = "borderless"
+    // exclusive fullscreen, switching the monitor to the chosen video mode
+    DisplayFullscreen DisplayMode = "fullscreen"
+)
+
+type DisplaySettings struct {
+    Mode DisplayMode `json:"mode"`
+    // monitor name, empty for the primary monitor
+    Monitor string `json:"monitor,omitempty"`
+    // fullscreen video mode; zero uses the monitor's current one
+    Width       int `json:"width,omitempty"`
+    Height      int `json:"height,omitempty"`
+    RefreshRate int `json:"refreshRate,omitempty"`
+    // windowed size, zero keeps SCREENX, SCREENY
+    WindowWidth  int `json:"windowWidth,omitempty"`
+    WindowHeight int `json:"windowHeight,omitempty"`
+    // a window without a title bar or border, still windowed rather than covering the monitor
+    Undecorated bool `json:"undecorated,omitempty"`
+    // keeps the window above every other, in any mode
+    AlwaysOnTop bool `json:"alwaysOnTop,omitempty"`
+}
+
+// switches win between windowed, borderless and fullscreen, telling OnChange about every change
+// so it can be saved
+type Display struct {
+    Settings DisplaySettings
+    // mode ToggleFullscreen goes to from a window
+    FullscreenMode DisplayMode
+    // appends the frame rate to the title, e.g. for playtest builds
+    TitleFPS bool
+
+    win                *pixelgl.Window
+    current            DisplayMode
+    restoreX, restoreY int
+    restoreW, restoreH int
+    onChange           []func(DisplaySettings) error
+
+    title, detail, shown string
+    fps                  float64
+    fpsAt                time.Time
+}
+
+func NewDisplay(win *pixelgl.Window, settings DisplaySettings) *Display {
+    d := &Display{
+        Settings:       settings,
+        FullscreenMode: DisplayBorderless,
+        win:            win,
+        current:        DisplayWindowed,
+    }
+    if settings.Mode == DisplayFullscreen {
+        d.FullscreenMode = DisplayFullscreen
+    }
+    return d
+}
+
+func Monitors() []*pixelgl.Monitor {
+    return pixelgl.Monitors()
+}
+
+// the monitor's video modes, for a resolution picker
+func VideoModes(m *pixelgl.Monitor) []pixelgl.VideoMode {
+    return m.VideoModes()
+}
+
+// pixelgl doesn't expose its glfw window, but it leaves its context current on the main thread
+func glfwWindow() *glfw.Window {
+    return glfw.GetCurrentContext()
+}
+
+func glfwMonitor(name string) *glfw.Monitor {
+    if name != "" {
+        for _, m := range glfw.GetMonitors() {
+            if m.GetName() == name {
+                return m
+            }
+        }
+    }
+    return glfw.GetPrimaryMonitor()
+}
+
+// applies Settings to the window
+func (d *Display) Apply() {
+    mainthread.Call(func() {
+        gw := glfwWindow()
+        if gw == nil {
+            return
+        }
+        if d.current == DisplayWindowed {
+            d.restoreX, d.restoreY = gw.GetPos()
+            d.restoreW, d.restoreH = gw.GetSize()
+        }
+        monitor := glfwMonitor(d.Settings.Monitor)
+
+        switch d.Settings.Mode {
+        case DisplayFullscreen:
+            mode := monitor.GetVideoMode()
+            w, h, rate := mode.Width, mode.Height, mode.RefreshRate
+            if d.Settings.Width > 0 && d.Settings.Height > 0 {
+                w, h = d.Settings.Width, d.Settings.Height
+            }
+            if d.Settings.RefreshRate > 0 {
+                rate = d.Settings.RefreshRate
+            }
+            gw.SetMonitor(monitor, 0, 0, w, h, rate)
+        case DisplayBorderless:
+            x, y := monitor.GetPos()
+            mode := monitor.GetVideoMode()
+            gw.SetMonitor(nil, x, y, mode.Width, mode.Height, 0)
+            gw.SetAttrib(glfw.Decorated, glfw.False)
+        default:
+            w, h := d.restoreW, d.restoreH
+            if d.Settings.WindowWidth > 0 && d.Settings.WindowHeight > 0 {
+                w, h = d.Settings.WindowWidth, d.Settings.WindowHeight
+            }
+            if w == 0 || h == 0 {
+                w, h = SCREENX, SCREENY
+            }
+            gw.SetAttrib(glfw.Decorated, glfwBool(!d.Settings.Undecorated))
+            gw.SetMonitor(nil, d.restoreX, d.restoreY, w, h, 0)
+        }
+        gw.SetAttrib(glfw.Floating, glfwBool(d.Settings.AlwaysOnTop))
+    })
+    d.current = d.Settings.Mode
+}
+
+func (d *Display) Mode() DisplayMode {
+    return d.current
+}
+
+func (d *Display) SetMode(mode DisplayMode) error {
+    d.Settings.Mode = mode
+    if mode != DisplayWindowed {
+        d.FullscreenMode = mode
+    }
+    d.Apply()
+    return d.save()
+}
+
+// exclusive fullscreen at a specific video mode on m
+func (d *Display) SetVideoMode(m *pixelgl.Monitor, mode pixelgl.VideoMode) error {
+    d.Settings.Monitor = m.Name()
+    d.Settings.Width, d.Settings.Height, d.Settings.RefreshRate = mode.Width, mode.Height, mode.RefreshRate
+    return d.SetMode(DisplayFullscreen)
+}
+
+func (d *Display) ToggleFullscreen() error {
+    if d.current == DisplayWindowed {
+        return d.SetMode(d.FullscreenMode)
+    }
+    return d.SetMode(DisplayWindowed)
+}
+
+// fn gets the new settings after every mode change, e.g. to write them to the settings file
+func (d *Display) OnChange(fn func(DisplaySettings) error) {
+    d.onChange = append(d.onChange, fn)
+}
+
+func (d *Display) save() error {
+    for _, fn := range d.onChange {
+        if err := fn(d.Settings); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// toggles fullscreen on Alt+Enter and keeps TitleFPS current; call once per frame
+func (d *Display) Update() {
+    alt := d.win.Pressed(pixelgl.KeyLeftAlt) || d.win.Pressed(pixelgl.KeyRightAlt)
+    if alt && d.win.JustPressed(pixelgl.KeyEnter) {
+        if err := d.ToggleFullscreen(); err != nil {
+            displayLog.Errorf("%v", err)
+        }
+    }
+    if d.TitleFPS && time.Since(d.fpsAt) >= TITLEFPSINTERVAL {
+        d.fpsAt = time.Now()
+        if avg := debug.averageFrameTime(); avg > 0 {
+            d.fps = 1 / avg
+        }
+        d.refreshTitle()
+    } else if !d.TitleFPS && d.fps != 0 {
+        d.fps = 0
+        d.refreshTitle()
+    }
+}
+
+func glfwBool(b bool) int {
+    if b {
+        return glfw.True
+    }
+    return glfw.False
+}
+
+// the window's title, without the detail or frame rate after it
+func (d *Display) Title() string {
+    return d.title
+}
+
+func (d *Display) SetTitle(title string) {
+    d.title = title
+    d.refreshTitle()
+}
+
+// shown after the title, e.g. the level being played; empty for none
+func (d *Display) SetTitleDetail(detail string) {
+    d.detail = detail
+    d.refreshTitle()
+}
+
+func (d *Display) refreshTitle() {
+    parts := []string{d.title}
+    if d.detail != "" {
+        parts = append(parts, d.detail)
+    }
+    if d.TitleFPS && d.fps > 0 {
+        parts = append(parts, fmt.Sprintf("%.0f fps", d.fps))
+    }
+    title := strings.Join(parts, " - ")
+    if title != d.shown {
+        d.win.SetTitle(title)
+        d.shown = title
+    }
+}
+
+// takes the window's border and title bar off, or puts them back; only windowed mode shows it
+func (d *Display) SetUndecorated(undecorated bool) error {
+    d.Settings.Undecorated = undecorated
+    if d.current == DisplayWindowed {
+        mainthread.Call(func() {
+            if gw := glfwWindow(); gw != nil {
+                gw.SetAttrib(glfw.Decorated, glfwBool(!undecorated))
+            }
+        })
+    }
+    return d.save()
+}
+
+func (d *Display) SetAlwaysOnTop(onTop bool) error {
+    d.Settings.AlwaysOnTop = onTop
+    mainthread.Call(func() {
+        if gw := glfwWindow(); gw != nil {
+            gw.SetAttrib(glfw.Floating, glfwBool(onTop))
+        }
+    })
+    return d.save()
+}
+
+// the monitor most of the window is on, falling back to the primary one
+func windowMonitor(gw *glfw.Window) *glfw.Monitor {
+    x, y := gw.GetPos()
+    w, h := gw.GetSize()
+    window := pixel.R(float64(x), float64(y), float64(x+w), float64(y+h))
+    best, area := glfw.GetPrimaryMonitor(), 0.0
+    for _, m := range glfw.GetMonitors() {
+        mx, my, mw, mh := m.GetWorkarea()
+        overlap := window.Intersect(pixel.R(float64(mx), float64(my), float64(mx+mw), float64(my+mh)))
+        if a := overlap.Area(); a > area {
+            best, area = m, a
+        }
+    }
+    return best
+}
+
+// the monitor the window's on, or the one Settings names outside windowed mode
+func (d *Display) Monitor() *pixelgl.Monitor {
+    var name string
+    mainthread.Call(func() {
+        if gw := glfwWindow(); gw != nil {
+            name = windowMonitor(gw).GetName()
+        }
+    })
+    if d.current != DisplayWindowed && d.Settings.Monitor != "" {
+        name = d.Settings.Monitor
+    }
+    for _, m := range pixelgl.Monitors() {
+        if m.Name() == name {
+            return m
+        }
+    }
+    return pixelgl.PrimaryMonitor()
+}
+
+// moves a window's top-left corner to pos, in desktop coordinates with y going down like the OS's
+func (d *Display) SetPosition(pos pixel.Vec) {
+    if d.current != DisplayWindowed {
+        return
+    }
+    mainthread.Call(func() {
+        if gw := glfwWindow(); gw != nil {
+            gw.SetPos(int(pos.X), int(pos.Y))
+        }
+    })
+}
+
+// centres the window in m's work area, or moves fullscreen and borderless over to m; nil
+// means the monitor it's on now
+func (d *Display) CenterOn(m *pixelgl.Monitor) error {
+    if d.current != DisplayWindowed {
+        if m == nil {
+            return nil
+        }
+        d.Settings.Monitor = m.Name()
+        d.Apply()
+        return d.save()
+    }
+    mainthread.Call(func() {
+        gw := glfwWindow()
+        if gw == nil {
+            return
+        }
+        monitor := windowMonitor(gw)
+        if m != nil {
+            monitor = glfwMonitor(m.Name())
+        }
+        mx, my, mw, mh := monitor.GetWorkarea()
+        w, h := gw.GetSize()
+        gw.SetPos(mx+(mw-w)/2, my+(mh-h)/2)
+    })
+    return nil
+}
+
+// how much bigger than its nominal size the OS draws things on the window's monitor, e.g. 2 on
+// a Retina display or 1.5 at 150% scaling. multiply window sizes and UI scale by it to keep
+// them the same physical size there.
+func (d *Display) DPIScale() float64 {
+    scale := 1.0
+    mainthread.Call(func() {
+        if gw := glfwWindow(); gw != nil {
+            x, _ := gw.GetContentScale()
+            scale = float64(x)
+        }
+    })
+    return scale
+}
+
+func registerDisplayCommands(c *Console, d *Display) {
+    c.Register("title", "sets the text shown after the window title, or clears it", func(args ConsoleArgs) error {
+        detail := ""
+        if args.Has(0) {
+            detail = args.String(0)
+        }
+        d.SetTitleDetail(detail)
+        return nil
+    }, StringArg("detail").Opt())
+    c.Register("titlefps", "shows or hides the frame rate in the window title", func(args ConsoleArgs) error {
+        d.TitleFPS = !d.TitleFPS
+        return nil
+    })
+    c.Register("ontop", "keeps the window above the others, or stops", func(args ConsoleArgs) error {
+        return d.SetAlwaysOnTop(!d.Settings.AlwaysOnTop)
+    })
+    c.Register("undecorated", "takes the window's border off, or puts it back", func(args ConsoleArgs) error {
+        return d.SetUndecorated(!d.Settings.Undecorated)
+    })
+    c.Register("center", "centres the window, on the named monitor if given", func(args ConsoleArgs) error {
+        if !args.Has(0) {
+            return d.CenterOn(nil)
+        }
+        for _, m := range pixelgl.Monitors() {
+            if m.Name() == args.String(0) {
+                return d.CenterOn(m)
+            }
+        }
+        return fmt.Errorf("no monitor %q", args.String(0))
+    }, StringArg("monitor").Opt())
+    c.Register("monitors", "lists the monitors and the window's DPI scale", func(args ConsoleArgs) error {
+        current := d.Monitor().Name()
+        for _, m := range pixelgl.Monitors() {
+            mark := " "
+            if m.Name() == current {
+                mark = "x"
+            }
+            w, h := m.Size()
+            c.Printf("[%s] %s  %.0fx%.0f", mark, m.Name(), w, h)
+        }
+        c.Printf("dpi scale %g", d.DPIScale())
+        return nil
+    })
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+    "path/filepath"
+    "strings"
+    "sync"
+
+    "github.com/faiface/mainthread"
+    "github.com/faiface/pixel"
+    "github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// files dragged from the OS onto the window, e.g. a save, a level or an image for the editor.
+// GLFW reports them while it polls events; they reach OnDrop handlers at the start of the next
+// frame, with the mouse where they were let go.
+type FileDrops struct {
+    mu      sync.Mutex
+    pending []string
+
+    onDrop []func(paths []string, at pixel.Vec)
+}
+
+func NewFileDrops() *FileDrops {
+    return &FileDrops{}
+}
+
+// registers fn for every drop; at is in virtual screen coordinates
+func (d *FileDrops) OnDrop(fn func(paths []string, at pixel.Vec)) {
+    d.onDrop = append(d.onDrop, fn)
+}
+
+// registers fn for the dropped files with one of exts, e.g. OnDropFile(loadLevel, ".tmx", ".ldtk")
+func (d *FileDrops) OnDropFile(fn func(path string, at pixel.Vec), exts ...string) {
+    d.OnDrop(func(paths []string, at pixel.Vec) {
+        for _, path := range paths {
+            ext := strings.ToLower(filepath.Ext(path))
+            for _, want := range exts {
+                if ext == strings.ToLower(want) {
+                    fn(path, at)
+                    break
+                }
+            }
+        }
+    })
+}
+
+// listens for drops on the window; Run calls it once the window is open
+func (d *FileDrops) Attach() {
+    mainthread.Call(func() {
+        if gw := glfwWindow(); gw != nil {
+            gw.SetDropCallback(func(w *glfw.Window, names []string) {
+                d.Drop(names...)
+            })
+        }
+    })
+}
+
+// queues paths as if they'd been dropped on the window, e.g. from a headless test
+func (d *FileDrops) Drop(paths ...string) {
+    d.mu.Lock()
+    d.pending = append(d.pending, paths...)
+    d.mu.Unlock()
+}
+
+// hands the files dropped since the last frame to the handlers; simulate calls it every frame
+func (d *FileDrops) Update(in Input) {
+    d.mu.Lock()
+    paths := d.pending
+    d.pending = nil
+    d.mu.Unlock()
+    if len(paths) == 0 {
+        return
+    }
+    at := screen.MousePosition(in)
+    engineLog.Infof("dropped %s", strings.Join(paths, ", "))
+    for _, fn := range d.onDrop {
+        fn(paths, at)
+    }
+}
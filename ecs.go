@@ -0,0 +1,273 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "sort"
+)
+
+// an entity handle; the low 32 bits index the world's slots and the high 32 count how often the
+// slot was reused, so a handle to a destroyed entity never finds its replacement
+type Entity uint64
+
+func (e Entity) index() uint32      { return uint32(e) }
+func (e Entity) generation() uint32 { return uint32(e >> 32) }
+
+func (e Entity) String() string {
+    return fmt.Sprintf("entity %d.%d", e.index(), e.generation())
+}
+
+// identifies a component by its Go type, which is always a pointer to a struct
+type ComponentType reflect.Type
+
+// the ComponentType for a nil pointer of the component, e.g. ComponentTypeOf((*Position)(nil))
+func ComponentTypeOf(ptr interface{}) ComponentType {
+    return reflect.TypeOf(ptr)
+}
+
+// packed components of one type with the entity each belongs to, so iterating them touches
+// one slice and removing swaps the last one into the gap
+type componentStore struct {
+    components []interface{}
+    entities   []Entity
+    index      map[Entity]int
+}
+
+func (s *componentStore) remove(e Entity) {
+    i, ok := s.index[e]
+    if !ok {
+        return
+    }
+    last := len(s.components) - 1
+    s.components[i], s.entities[i] = s.components[last], s.entities[last]
+    s.index[s.entities[i]] = i
+    s.components[last] = nil
+    s.components, s.entities = s.components[:last], s.entities[:last]
+    delete(s.index, e)
+}
+
+// runs once per World.Update
+type System interface {
+    Update(w *World, dt float64)
+}
+
+type SystemFunc func(w *World, dt float64)
+
+func (f SystemFunc) Update(w *World, dt float64) { f(w, dt) }
+
+// systems that also implement it are called by World.Draw in the same order
+type DrawSystem interface {
+    Draw(w *World, t RenderTarget)
+}
+
+type worldSystem struct {
+    name   string
+    order  int
+    system System
+}
+
+// entities, their components and the systems that run over them
+type World struct {
+    generations []uint32
+    alive       []bool
+    free        []uint32
+    stores      map[ComponentType]*componentStore
+    systems     []worldSystem
+    changes     uint64
+}
+
+func NewWorld() *World {
+    return &World{stores: make(map[ComponentType]*componentStore)}
+}
+
+func (w *World) Create(components ...interface{}) Entity {
+    var index uint32
+    if n := len(w.free); n > 0 {
+        index = w.free[n-1]
+        w.free = w.free[:n-1]
+    } else {
+        index = uint32(len(w.generations))
+        w.generations = append(w.generations, 0)
+        w.alive = append(w.alive, false)
+    }
+    w.alive[index] = true
+    e := Entity(uint64(w.generations[index])<<32 | uint64(index))
+    w.Add(e, components...)
+    return e
+}
+
+func (w *World) Alive(e Entity) bool {
+    i := e.index()
+    return int(i) < len(w.alive) && w.alive[i] && w.generations[i] == e.generation()
+}
+
+// removes e and all its components; the handle stays safe to use but finds nothing
+func (w *World) Destroy(e Entity) {
+    if !w.Alive(e) {
+        return
+    }
+    for _, s := range w.stores {
+        s.remove(e)
+    }
+    w.changes++
+    i := e.index()
+    w.alive[i] = false
+    w.generations[i]++
+    w.free = append(w.free, i)
+}
+
+// attaches components to e, replacing any of the same type. each must be a pointer.
+func (w *World) Add(e Entity, components ...interface{}) {
+    if !w.Alive(e) {
+        return
+    }
+    w.changes++
+    for _, c := range components {
+        t := reflect.TypeOf(c)
+        if t == nil || t.Kind() != reflect.Ptr {
+            panic(fmt.Sprintf("ecs: component %T isn't a pointer", c))
+        }
+        s, ok := w.stores[t]
+        if !ok {
+            s = &componentStore{index: make(map[Entity]int)}
+            w.stores[t] = s
+        }
+        if i, ok := s.index[e]; ok {
+            s.components[i] = c
+            continue
+        }
+        s.index[e] = len(s.components)
+        s.components = append(s.components, c)
+        s.entities = append(s.entities, e)
+    }
+}
+
+func (w *World) Remove(e Entity, t ComponentType) {
+    if s, ok := w.stores[t]; ok {
+        s.remove(e)
+        w.changes++
+    }
+}
+
+// counts components being added and removed, so a cache over entities, like collision's
+// index, can tell when it's out of date
+func (w *World) Changes() uint64 {
+    return w.changes
+}
+
+// e's component of type t, or nil; assert it to the pointer type, like
+// w.Get(e, PositionType).(*Position)
+func (w *World) Get(e Entity, t ComponentType) interface{} {
+    s, ok := w.stores[t]
+    if !ok {
+        return nil
+    }
+    if i, ok := s.index[e]; ok {
+        return s.components[i]
+    }
+    return nil
+}
+
+// every component e has, sorted by type name, for inspectors and debug dumps
+func (w *World) Components(e Entity) []interface{} {
+    var components []interface{}
+    for _, s := range w.stores {
+        if i, ok := s.index[e]; ok {
+            components = append(components, s.components[i])
+        }
+    }
+    sort.Slice(components, func(i, j int) bool {
+        return reflect.TypeOf(components[i]).String() < reflect.TypeOf(components[j]).String()
+    })
+    return components
+}
+
+func (w *World) Has(e Entity, types ...ComponentType) bool {
+    for _, t := range types {
+        s, ok := w.stores[t]
+        if !ok {
+            return false
+        }
+        if _, ok := s.index[e]; !ok {
+            return false
+        }
+    }
+    return true
+}
+
+// number of living entities
+func (w *World) Len() int {
+    return len(w.alive) - len(w.free)
+}
+
+// every living entity with all of types. the result is a copy, so systems can create and
+// destroy entities while going through it.
+func (w *World) Query(types ...ComponentType) []Entity {
+    if len(types) == 0 {
+        var all []Entity
+        for i, alive := range w.alive {
+            if alive {
+                all = append(all, Entity(uint64(w.generations[i])<<32|uint64(i)))
+            }
+        }
+        return all
+    }
+    // walk the smallest store and check the rest
+    var smallest *componentStore
+    for _, t := range types {
+        s, ok := w.stores[t]
+        if !ok {
+            return nil
+        }
+        if smallest == nil || len(s.entities) < len(smallest.entities) {
+            smallest = s
+        }
+    }
+    var matches []Entity
+    for _, e := range smallest.entities {
+        if w.Has(e, types...) {
+            matches = append(matches, e)
+        }
+    }
+    return matches
+}
+
+// calls fn for every entity with all of types, skipping ones destroyed along the way
+func (w *World) Each(fn func(e Entity), types ...ComponentType) {
+    for _, e := range w.Query(types...) {
+        if w.Alive(e) {
+            fn(e)
+        }
+    }
+}
+
+// adds a system; lower orders run first and equal orders keep the order they were added in
+func (w *World) AddSystem(name string, order int, s System) {
+    w.systems = append(w.systems, worldSystem{name, order, s})
+    sort.SliceStable(w.systems, func(i, j int) bool { return w.systems[i].order < w.systems[j].order })
+}
+
+func (w *World) RemoveSystem(name string) {
+    for i, s := range w.systems {
+        if s.name == name {
+            w.systems = append(w.systems[:i], w.systems[i+1:]...)
+            return
+        }
+    }
+}
+
+// runs every system in order. dt is in seconds.
+func (w *World) Update(dt float64) {
+    for _, s := range w.systems {
+        s.system.Update(w, dt)
+    }
+}
+
+// runs every DrawSystem in order
+func (w *World) Draw(t RenderTarget) {
+    for _, s := range w.systems {
+        if d, ok := s.system.(DrawSystem); ok {
+            d.Draw(w, t)
+        }
+    }
+}
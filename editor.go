@@ -0,0 +1,909 @@
+package main
+
+import (
+    "fmt"
+    "image/color"
+    "math"
+    "path/filepath"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+var editorLog = logging.Module("editor")
+
+// the shortcut context the editor's keys are bound in, active while it's open
+const SHORTCUTEDITOR = "editor"
+
+// the object layer entities are placed in unless the Editor says otherwise
+const EDITOROBJECTS = "entities"
+
+// how wide the editor's side panel is and how big tiles show in its palette, in virtual pixels
+// at a UI scale of 1
+const EDITORPANEL = 220
+const EDITORCELL = 24
+
+// how many edits undo goes back through
+const EDITORUNDO = 200
+
+// how fast the arrow keys pan the editor's view, in screen pixels a second
+const EDITORPAN = 600
+
+// something the editor can place: a map object of Type, Size big, drawn as Sprite stretched over
+// it or else as a box of Color. the game spawns it from the level's object layer like any other.
+type EditorEntity struct {
+    Type string
+    // a tile when it's zero
+    Size   pixel.Vec
+    Sprite *pixel.Sprite
+    Color  color.Color
+    // copied onto each one placed
+    Properties Properties
+}
+
+// the in-game level editor. it opens a Tiled .tmx level in an EditorScene over the game, where
+// tiles are painted from the level's own tilesets and entities placed from Entities, and saves it
+// back in the same format for LoadTMX, e.g.
+//
+//	editor.Level = "levels/1.tmx"  // what the key opens, usually the level being played
+//	editor.Entities = []EditorEntity{{Type: "enemy", Size: pixel.V(16, 16), Sprite: enemy}}
+//	editor.OnSave(func(path string, m *TileMap) { level.Load(path) })
+//
+// the key works once the game's started, and --editor opens a level in it straight away.
+type Editor struct {
+    // opens and closes it, F4 by default
+    Key   Chord
+    Level string
+    // the palette, ahead of any other types already in the level
+    Entities []EditorEntity
+    // the object layer entities go in, made when the level hasn't got one; EDITOROBJECTS by default
+    ObjectLayer string
+    // the directory levels are saved under, by the path they were opened with. Run sets it to
+    // --assets-dir, so a save lands where LoadTMX reads from; empty saves under the working
+    // directory.
+    Dir string
+
+    scene  *EditorScene
+    open   bool
+    onSave []func(path string, m *TileMap)
+}
+
+func NewEditor() *Editor {
+    return &Editor{Key: Chord{Key: pixelgl.KeyF4}, ObjectLayer: EDITOROBJECTS}
+}
+
+// registers fn to run after each save with the level's path and the editor's map, which it goes
+// on changing; load path again for a copy of the game's own
+func (e *Editor) OnSave(fn func(path string, m *TileMap)) {
+    e.onSave = append(e.onSave, fn)
+}
+
+// whether the editor's open
+func (e *Editor) Editing() bool {
+    return e.open
+}
+
+// the scene of the level last opened, or nil
+func (e *Editor) Scene() *EditorScene {
+    return e.scene
+}
+
+// loads the level at path and opens it in the editor, in place of the one being edited
+func (e *Editor) Open(path string) error {
+    m, err := LoadTMX(path)
+    if err != nil {
+        return err
+    }
+    e.Level = path
+    s := NewEditorScene(e, path, m)
+    if e.open {
+        scenes.Replace(s)
+    } else {
+        scenes.Push(s)
+    }
+    e.scene = s
+    return nil
+}
+
+// takes the editor off, with anything opened over it; its edits stay for when it's opened again
+func (e *Editor) Close() {
+    if e.open && e.scene != nil {
+        scenes.Remove(e.scene)
+    }
+}
+
+// closes the editor, or opens it on Level, picking up where it was left if that's the level it
+// last had open
+func (e *Editor) Toggle() {
+    switch {
+    case e.open:
+        e.Close()
+    case e.scene != nil && e.scene.Path == e.Level:
+        scenes.Push(e.scene)
+    case e.Level == "":
+        editorLog.Warnf("no level to edit: set editor.Level, or open one with the editor command")
+    default:
+        if err := e.Open(e.Level); err != nil {
+            editorLog.Errorf("%v", err)
+        }
+    }
+}
+
+// where the level at path is saved on disk
+func (e *Editor) file(path string) string {
+    if e.Dir == "" {
+        return filepath.FromSlash(path)
+    }
+    return filepath.Join(e.Dir, filepath.FromSlash(path))
+}
+
+func (e *Editor) objectLayer() string {
+    if e.ObjectLayer == "" {
+        return EDITOROBJECTS
+    }
+    return e.ObjectLayer
+}
+
+type editorMode int
+
+const (
+    editorTiles editorMode = iota
+    editorEntities
+)
+
+// one change that's been made and how to take it back and make it again
+type editorEdit struct {
+    undo, redo func()
+}
+
+// the cells one drag of the mouse has painted, as they were and as they are now
+type tileStroke struct {
+    layer         *TileLayer
+    before, after map[int]uint32
+}
+
+func newTileStroke(l *TileLayer) *tileStroke {
+    return &tileStroke{layer: l, before: map[int]uint32{}, after: map[int]uint32{}}
+}
+
+func (s *tileStroke) set(x, y int, gid uint32) {
+    l := s.layer
+    if x < 0 || y < 0 || x >= l.Width || y >= l.Height {
+        return
+    }
+    i := y*l.Width + x
+    if _, ok := s.before[i]; !ok {
+        s.before[i] = l.GIDs[i]
+    }
+    s.after[i] = gid
+    l.SetGID(x, y, gid)
+}
+
+// the stroke as an edit, or false when it didn't change anything
+func (s *tileStroke) edit() (editorEdit, bool) {
+    changed := false
+    for i, gid := range s.after {
+        changed = changed || s.before[i] != gid
+    }
+    apply := func(gids map[int]uint32) func() {
+        return func() {
+            for i, gid := range gids {
+                s.layer.SetGID(i%s.layer.Width, i/s.layer.Width, gid)
+            }
+        }
+    }
+    return editorEdit{undo: apply(s.before), redo: apply(s.after)}, changed
+}
+
+// the editor's screen: the level under a camera of its own, and a panel down the left with the
+// mode, the layer, snapping, undo, redo, save and reload over a palette of tiles or entities.
+// painting tiles, the left button paints the chosen one into the layer, the right erases and
+// Ctrl and the left picks up the one under the mouse. placing entities, the left places the chosen
+// one or drags one that's there, the right or Delete removes one. the middle button or the arrow
+// keys pan and the wheel zooms; T and E switch modes, G snapping, Ctrl+Z undoes, Ctrl+Y redoes,
+// Ctrl+S saves and Ctrl+O reloads.
+type EditorScene struct {
+    BaseScene
+    Editor *Editor
+    Map    *TileMap
+    // the level's path, as LoadTMX takes it
+    Path string
+    // snaps placed and dragged entities to the tile grid
+    Snap   bool
+    Camera *Camera
+    UI     *UI
+
+    mode editorMode
+    // indexes into Map.Layers and Map.Tilesets
+    layer, tileset int
+    // the gid painted, and the palette entry placed
+    tile   uint32
+    entity int
+    // palette rows scrolled past
+    scroll   int
+    palette  pixel.Rect
+    cursor   pixel.Vec
+    selected *MapObject
+    stroke   *tileStroke
+    // the entity being dragged, where it was and where the mouse took hold of it
+    moving   *MapObject
+    moveFrom pixel.Rect
+    grab     pixel.Vec
+    panning  bool
+    panFrom  pixel.Vec
+    // edits to undo, latest last, and those undone to redo
+    done, undone []editorEdit
+    dirty        bool
+
+    imd    *imdraw.IMDraw
+    sprite *pixel.Sprite
+}
+
+func NewEditorScene(e *Editor, path string, m *TileMap) *EditorScene {
+    s := &EditorScene{
+        Editor: e,
+        Map:    m,
+        Path:   path,
+        Snap:   true,
+        Camera: NewCamera(screen.Bounds()),
+        UI:     NewUI(),
+        imd:    imdraw.New(nil),
+        sprite: pixel.NewSprite(nil, pixel.Rect{}),
+    }
+    s.Camera.Position = m.Bounds().Center()
+    s.Camera.ZoomMin, s.Camera.ZoomMax = 0.1, 16
+    if len(m.Tilesets) > 0 {
+        s.tile = uint32(m.Tilesets[0].FirstGID)
+    }
+    return s
+}
+
+func (s *EditorScene) Enter() {
+    shortcuts.PushContext(SHORTCUTEDITOR)
+    s.Editor.open = true
+}
+
+func (s *EditorScene) Exit() {
+    s.finish()
+    shortcuts.PopContext(SHORTCUTEDITOR)
+    s.Editor.open = false
+}
+
+// whether there are edits since the level was loaded or saved
+func (s *EditorScene) Dirty() bool {
+    return s.dirty
+}
+
+func (s *EditorScene) tileLayer() *TileLayer {
+    if s.layer < 0 || s.layer >= len(s.Map.Layers) {
+        return nil
+    }
+    return s.Map.Layers[s.layer]
+}
+
+func (s *EditorScene) currentTileset() *Tileset {
+    if s.tileset < 0 || s.tileset >= len(s.Map.Tilesets) {
+        return nil
+    }
+    return s.Map.Tilesets[s.tileset]
+}
+
+// the object layer entities go in, made on the spot if the level hasn't got one
+func (s *EditorScene) group() *ObjectGroup {
+    name := s.Editor.objectLayer()
+    g := s.Map.ObjectGroup(name)
+    if g == nil {
+        g = &ObjectGroup{Name: name, Visible: true, Properties: Properties{}}
+        s.Map.ObjectGroups = append(s.Map.ObjectGroups, g)
+    }
+    return g
+}
+
+// Editor.Entities, then a plain box for each other type already in the level so it can be copied
+func (s *EditorScene) entities() []EditorEntity {
+    entities := append([]EditorEntity(nil), s.Editor.Entities...)
+    seen := map[string]bool{}
+    for _, e := range entities {
+        seen[e.Type] = true
+    }
+    if g := s.Map.ObjectGroup(s.Editor.objectLayer()); g != nil {
+        for _, o := range g.Objects {
+            if o.Type != "" && !seen[o.Type] {
+                seen[o.Type] = true
+                entities = append(entities, EditorEntity{Type: o.Type, Size: o.Rect.Size()})
+            }
+        }
+    }
+    return entities
+}
+
+func (s *EditorScene) entityFor(typ string) (EditorEntity, bool) {
+    for _, e := range s.Editor.Entities {
+        if e.Type == typ {
+            return e, true
+        }
+    }
+    return EditorEntity{}, false
+}
+
+func (s *EditorScene) tileSize() pixel.Vec {
+    return pixel.V(float64(s.Map.TileWidth), float64(s.Map.TileHeight))
+}
+
+// the corner of the cell at p, for snapping to
+func (s *EditorScene) snap(p pixel.Vec) pixel.Vec {
+    return s.Map.CellOrigin(s.Map.CellAt(p))
+}
+
+func (s *EditorScene) commit(edit editorEdit) {
+    s.done = append(s.done, edit)
+    if len(s.done) > EDITORUNDO {
+        s.done = append(s.done[:0], s.done[1:]...)
+    }
+    s.undone = s.undone[:0]
+    s.dirty = true
+}
+
+func (s *EditorScene) Undo() {
+    s.finish()
+    if len(s.done) == 0 {
+        return
+    }
+    edit := s.done[len(s.done)-1]
+    s.done = s.done[:len(s.done)-1]
+    edit.undo()
+    s.undone = append(s.undone, edit)
+    s.dirty = true
+}
+
+func (s *EditorScene) Redo() {
+    s.finish()
+    if len(s.undone) == 0 {
+        return
+    }
+    edit := s.undone[len(s.undone)-1]
+    s.undone = s.undone[:len(s.undone)-1]
+    edit.redo()
+    s.done = append(s.done, edit)
+    s.dirty = true
+}
+
+// ends any stroke or drag in progress, keeping it as an edit
+func (s *EditorScene) finish() {
+    if s.stroke != nil {
+        if edit, ok := s.stroke.edit(); ok {
+            s.commit(edit)
+        }
+        s.stroke = nil
+    }
+    if s.moving != nil {
+        o, by := s.moving, s.moving.Rect.Min.Sub(s.moveFrom.Min)
+        s.moving = nil
+        if by != pixel.ZV {
+            s.commit(editorEdit{
+                undo: func() { moveObject(o, by.Scaled(-1)) },
+                redo: func() { moveObject(o, by) },
+            })
+        }
+    }
+}
+
+// writes the level to Editor.Dir and tells OnSave
+func (s *EditorScene) Save() error {
+    s.finish()
+    if err := SaveTMX(s.Map, s.Editor.file(s.Path)); err != nil {
+        return err
+    }
+    s.dirty = false
+    editorLog.Infof("saved %s", s.Editor.file(s.Path))
+    toasts.Notify("Level saved", s.Path)
+    for _, fn := range s.Editor.onSave {
+        fn(s.Path, s.Map)
+    }
+    return nil
+}
+
+// loads the level again, dropping the edits and what there is to undo
+func (s *EditorScene) Reload() error {
+    m, err := LoadTMX(s.Path)
+    if err != nil {
+        return err
+    }
+    s.stroke, s.moving, s.selected = nil, nil, nil
+    s.Map = m
+    s.done, s.undone = s.done[:0], s.undone[:0]
+    s.dirty = false
+    if s.tileLayer() == nil {
+        s.layer = 0
+    }
+    if s.currentTileset() == nil {
+        s.tileset = 0
+    }
+    return nil
+}
+
+func (s *EditorScene) nextID() int {
+    next := 1
+    for _, g := range s.Map.ObjectGroups {
+        for _, o := range g.Objects {
+            if o.ID >= next {
+                next = o.ID + 1
+            }
+        }
+    }
+    return next
+}
+
+// the entity of the object layer under p, the topmost if they overlap
+func (s *EditorScene) objectAt(p pixel.Vec) *MapObject {
+    g := s.Map.ObjectGroup(s.Editor.objectLayer())
+    if g == nil {
+        return nil
+    }
+    // points and lines still want a few screen pixels to click on
+    slop := 4 / s.Camera.Zoom
+    for i := len(g.Objects) - 1; i >= 0; i-- {
+        o := g.Objects[i]
+        r := pixel.Rect{Min: o.Rect.Min.Sub(pixel.V(slop, slop)), Max: o.Rect.Max.Add(pixel.V(slop, slop))}
+        if r.Contains(p) {
+            return o
+        }
+    }
+    return nil
+}
+
+func moveObject(o *MapObject, by pixel.Vec) {
+    o.Rect = o.Rect.Moved(by)
+    for i := range o.Points {
+        o.Points[i] = o.Points[i].Add(by)
+    }
+}
+
+func (s *EditorScene) place(entity EditorEntity, at pixel.Vec) {
+    size := entity.Size
+    if size == pixel.ZV {
+        size = s.tileSize()
+    }
+    if s.Snap {
+        at = s.snap(at)
+    }
+    props := Properties{}
+    for k, v := range entity.Properties {
+        props[k] = v
+    }
+    o := &MapObject{
+        ID:         s.nextID(),
+        Type:       entity.Type,
+        Shape:      ShapeRect,
+        Rect:       pixel.Rect{Min: at, Max: at.Add(size)},
+        Visible:    true,
+        Properties: props,
+    }
+    g := s.group()
+    add := func() { g.Objects = append(g.Objects, o) }
+    add()
+    s.commit(editorEdit{undo: func() { s.unlink(g, o) }, redo: add})
+    s.selected = o
+}
+
+// removes o from the level, as an edit
+func (s *EditorScene) remove(o *MapObject) {
+    g := s.group()
+    i := s.unlink(g, o)
+    if i < 0 {
+        return
+    }
+    s.commit(editorEdit{
+        undo: func() {
+            at := int(math.Min(float64(i), float64(len(g.Objects))))
+            g.Objects = append(g.Objects[:at], append([]*MapObject{o}, g.Objects[at:]...)...)
+        },
+        redo: func() { s.unlink(g, o) },
+    })
+}
+
+// takes o out of g, returning where it was or -1
+func (s *EditorScene) unlink(g *ObjectGroup, o *MapObject) int {
+    if s.selected == o {
+        s.selected = nil
+    }
+    for i, other := range g.Objects {
+        if other == o {
+            g.Objects = append(g.Objects[:i:i], g.Objects[i+1:]...)
+            return i
+        }
+    }
+    return -1
+}
+
+func (s *EditorScene) DeleteSelected() {
+    if s.selected != nil {
+        s.remove(s.selected)
+    }
+}
+
+func (s *EditorScene) SetMode(mode editorMode) {
+    s.finish()
+    s.mode = mode
+}
+
+// steps i through n choices, wrapping round
+func cycle(i, n int) int {
+    if n == 0 {
+        return 0
+    }
+    return (i + 1) % n
+}
+
+// the panel's widgets above the palette
+const editorPanelRows = 7
+
+func (s *EditorScene) panel() {
+    style := s.UI.Scaled()
+    b := screen.Bounds()
+    r := pixel.R(b.Min.X, b.Min.Y, b.Min.X+math.Min(EDITORPANEL*accessibility.UIScale(), b.W()/2), b.Max.Y)
+    s.UI.BeginPanel(r, 0)
+    name := filepath.Base(s.Path)
+    if s.dirty {
+        name += "*"
+    }
+    s.UI.Label(name)
+    if s.mode == editorTiles {
+        if s.UI.Button("Tiles##mode") {
+            s.SetMode(editorEntities)
+        }
+        layer := T("No tile layers")
+        if l := s.tileLayer(); l != nil {
+            layer = l.Name
+        }
+        if s.UI.Button(layer + "##layer") {
+            s.finish()
+            s.layer = cycle(s.layer, len(s.Map.Layers))
+        }
+        tileset := T("No tilesets")
+        if ts := s.currentTileset(); ts != nil {
+            tileset = ts.Name
+        }
+        if s.UI.Button(tileset + "##tileset") {
+            s.tileset, s.scroll = cycle(s.tileset, len(s.Map.Tilesets)), 0
+        }
+    } else {
+        if s.UI.Button("Entities##mode") {
+            s.SetMode(editorTiles)
+        }
+        s.UI.Label(s.Editor.objectLayer())
+        s.UI.Space(style.RowHeight)
+    }
+    s.UI.Toggle("Snap to grid", &s.Snap)
+    s.UI.BeginRow(2)
+    if s.UI.Button("Undo") {
+        s.Undo()
+    }
+    if s.UI.Button("Redo") {
+        s.Redo()
+    }
+    s.UI.BeginRow(2)
+    if s.UI.Button("Save") {
+        s.save()
+    }
+    if s.UI.Button("Reload") {
+        s.reload()
+    }
+    s.UI.EndRow()
+    top := r.Max.Y - style.Padding - editorPanelRows*(style.RowHeight+style.Spacing)
+    s.palette = pixel.R(r.Min.X+style.Padding, r.Min.Y+style.Padding, r.Max.X-style.Padding, top)
+    if s.mode == editorEntities {
+        for i, e := range s.entities() {
+            label := e.Type
+            if i == s.entity {
+                label = "> " + label
+            }
+            if s.UI.Button(fmt.Sprintf("%s##entity%d", label, i)) {
+                s.entity = i
+            }
+        }
+    }
+    s.UI.EndPanel()
+}
+
+// saves, telling the player how it went
+func (s *EditorScene) save() {
+    if err := s.Save(); err != nil {
+        editorLog.Errorf("%v", err)
+        toasts.Notify("Couldn't save the level", err.Error())
+    }
+}
+
+func (s *EditorScene) reload() {
+    if err := s.Reload(); err != nil {
+        editorLog.Errorf("%v", err)
+        toasts.Notify("Couldn't load the level", err.Error())
+    }
+}
+
+// the tileset the palette shows, how big its cells are and how many to a row
+func (s *EditorScene) paletteLayout() (*Tileset, float64, int) {
+    ts := s.currentTileset()
+    cell := EDITORCELL * accessibility.UIScale()
+    columns := int(s.palette.W() / cell)
+    if columns < 1 {
+        columns = 1
+    }
+    return ts, cell, columns
+}
+
+// the palette cell of tile id, or false when it's scrolled out of view
+func (s *EditorScene) paletteCell(id int) (pixel.Rect, bool) {
+    _, cell, columns := s.paletteLayout()
+    row, col := id/columns-s.scroll, id%columns
+    min := pixel.V(s.palette.Min.X+float64(col)*cell, s.palette.Max.Y-float64(row+1)*cell)
+    r := pixel.Rect{Min: min, Max: min.Add(pixel.V(cell, cell))}
+    return r, row >= 0 && r.Min.Y >= s.palette.Min.Y
+}
+
+func (s *EditorScene) pickTile(in Input, at pixel.Vec) {
+    ts, cell, columns := s.paletteLayout()
+    if ts == nil {
+        return
+    }
+    rows := (ts.TileCount + columns - 1) / columns
+    if scroll := in.MouseScroll().Y; scroll != 0 {
+        s.scroll -= int(math.Copysign(1, scroll))
+        s.scroll = int(math.Max(0, math.Min(float64(rows-1), float64(s.scroll))))
+    }
+    if !in.JustPressed(pixelgl.MouseButtonLeft) {
+        return
+    }
+    col := int((at.X - s.palette.Min.X) / cell)
+    id := (int((s.palette.Max.Y-at.Y)/cell)+s.scroll)*columns + col
+    if col < columns && id < ts.TileCount {
+        s.tile = uint32(ts.FirstGID + id)
+    }
+}
+
+func (s *EditorScene) HandleInput(in Input) {
+    s.Camera.Viewport = screen.Bounds()
+    s.UI.Begin(in)
+    s.panel()
+    at := screen.MousePosition(in)
+    over := s.UI.WantsInput()
+    if s.mode == editorTiles && s.palette.Contains(at) {
+        s.pickTile(in, at)
+    }
+    s.pan(in, at, over)
+    s.cursor = s.Camera.ScreenToWorld(at)
+    switch s.mode {
+    case editorTiles:
+        s.paint(in, over)
+    case editorEntities:
+        s.drag(in, over)
+    }
+}
+
+func (s *EditorScene) pan(in Input, at pixel.Vec, over bool) {
+    if in.JustPressed(pixelgl.MouseButtonMiddle) && !over {
+        s.panning, s.panFrom = true, at
+    }
+    if !in.Pressed(pixelgl.MouseButtonMiddle) {
+        s.panning = false
+    }
+    scale := s.Camera.zoom()
+    if s.panning {
+        s.Camera.Position = s.Camera.Position.Add(s.panFrom.Sub(at).Scaled(1 / scale))
+        s.panFrom = at
+    }
+    var dir pixel.Vec
+    if in.Pressed(pixelgl.KeyLeft) {
+        dir.X--
+    }
+    if in.Pressed(pixelgl.KeyRight) {
+        dir.X++
+    }
+    if in.Pressed(pixelgl.KeyDown) {
+        dir.Y--
+    }
+    if in.Pressed(pixelgl.KeyUp) {
+        dir.Y++
+    }
+    s.Camera.Position = s.Camera.Position.Add(dir.Scaled(EDITORPAN * clock.Unscaled() / scale))
+    if !over {
+        s.Camera.ZoomAt(zoom.Factor(), zoom.Anchor)
+    }
+}
+
+func (s *EditorScene) paint(in Input, over bool) {
+    l := s.tileLayer()
+    left, right := in.Pressed(pixelgl.MouseButtonLeft), in.Pressed(pixelgl.MouseButtonRight)
+    if s.stroke == nil {
+        if over || l == nil {
+            return
+        }
+        ctrl := in.Pressed(pixelgl.KeyLeftControl) || in.Pressed(pixelgl.KeyRightControl)
+        if ctrl && in.JustPressed(pixelgl.MouseButtonLeft) {
+            s.tile = l.GID(s.Map.CellAt(s.cursor))
+            return
+        }
+        if !in.JustPressed(pixelgl.MouseButtonLeft) && !in.JustPressed(pixelgl.MouseButtonRight) {
+            return
+        }
+        s.stroke = newTileStroke(l)
+    }
+    if !left && !right {
+        s.finish()
+        return
+    }
+    gid := s.tile
+    if right {
+        gid = 0
+    }
+    x, y := s.Map.CellAt(s.cursor)
+    s.stroke.set(x, y, gid)
+}
+
+func (s *EditorScene) drag(in Input, over bool) {
+    if s.moving != nil {
+        if !in.Pressed(pixelgl.MouseButtonLeft) {
+            s.finish()
+            return
+        }
+        to := s.moveFrom.Min.Add(s.cursor.Sub(s.grab))
+        if s.Snap {
+            // to the nearest corner rather than the one of the cell it's in
+            to = s.snap(to.Add(s.tileSize().Scaled(0.5)))
+        }
+        moveObject(s.moving, to.Sub(s.moving.Rect.Min))
+        return
+    }
+    if over {
+        return
+    }
+    switch {
+    case in.JustPressed(pixelgl.MouseButtonLeft):
+        if o := s.objectAt(s.cursor); o != nil {
+            s.selected, s.moving, s.moveFrom, s.grab = o, o, o.Rect, s.cursor
+            return
+        }
+        s.selected = nil
+        if entities := s.entities(); s.entity < len(entities) {
+            s.place(entities[s.entity], s.cursor)
+        }
+    case in.JustPressed(pixelgl.MouseButtonRight):
+        if o := s.objectAt(s.cursor); o != nil {
+            s.remove(o)
+        }
+    }
+}
+
+func (s *EditorScene) Draw(t RenderTarget) {
+    style := s.UI.Style
+    zoom := s.Camera.zoom()
+    view := s.Camera.VisibleRect()
+    t.SetMatrix(s.Camera.Matrix())
+    s.Map.DrawView(t, view)
+    s.imd.Clear()
+
+    bounds := s.Map.Bounds()
+    if s.Map.Orientation == "" || s.Map.Orientation == TILEORTHOGONAL {
+        s.imd.Color = pixel.Alpha(0.15)
+        size := s.tileSize()
+        for x := 0; x <= s.Map.Width; x++ {
+            s.imd.Push(pixel.V(float64(x)*size.X, bounds.Min.Y), pixel.V(float64(x)*size.X, bounds.Max.Y))
+            s.imd.Line(1 / zoom)
+        }
+        for y := 0; y <= s.Map.Height; y++ {
+            s.imd.Push(pixel.V(bounds.Min.X, float64(y)*size.Y), pixel.V(bounds.Max.X, float64(y)*size.Y))
+            s.imd.Line(1 / zoom)
+        }
+    }
+    s.imd.Color = style.Accent
+    s.imd.Push(bounds.Min, bounds.Max)
+    s.imd.Rectangle(1 / zoom)
+
+    active := s.Map.ObjectGroup(s.Editor.objectLayer())
+    for _, g := range s.Map.ObjectGroups {
+        for _, o := range g.Objects {
+            c := pixel.ToRGBA(style.Text).Mul(pixel.Alpha(0.3))
+            if g == active {
+                c = pixel.ToRGBA(style.Accent)
+                if e, ok := s.entityFor(o.Type); ok {
+                    if e.Sprite != nil && o.Rect.W() > 0 && o.Rect.H() > 0 {
+                        frame := e.Sprite.Frame()
+                        m := pixel.IM.ScaledXY(pixel.ZV, pixel.V(o.Rect.W()/frame.W(), o.Rect.H()/frame.H())).Moved(o.Rect.Center())
+                        e.Sprite.Draw(t, m)
+                    }
+                    if e.Color != nil {
+                        c = pixel.ToRGBA(e.Color)
+                    }
+                }
+            }
+            thickness := 1 / zoom
+            if o == s.selected {
+                c, thickness = pixel.ToRGBA(style.Text), 2/zoom
+            }
+            s.imd.Color = c
+            s.imd.Push(o.Rect.Min, o.Rect.Max)
+            s.imd.Rectangle(thickness)
+        }
+    }
+
+    if s.mode == editorTiles && !s.UI.WantsInput() {
+        origin := s.snap(s.cursor)
+        s.imd.Color = style.Text
+        s.imd.Push(origin, origin.Add(s.tileSize()))
+        s.imd.Rectangle(1 / zoom)
+    }
+    s.imd.Draw(t)
+
+    // names over the entities, in screen space so they stay readable at any zoom
+    t.SetMatrix(pixel.IM)
+    opts := TextOptions{Size: FONTSIZE * accessibility.UIScale() * 0.75, Color: style.Text}
+    if active != nil {
+        for _, o := range active.Objects {
+            at := s.Camera.WorldToScreen(pixel.V(o.Rect.Min.X, o.Rect.Max.Y))
+            DrawText(t, nil, o.Type, at.Add(pixel.V(2, 2)), opts)
+        }
+    }
+
+    s.UI.Draw(t)
+    if s.mode == editorTiles {
+        s.drawPalette(t)
+    }
+}
+
+func (s *EditorScene) drawPalette(t RenderTarget) {
+    ts, cell, _ := s.paletteLayout()
+    if ts == nil {
+        return
+    }
+    s.imd.Clear()
+    for id := 0; id < ts.TileCount; id++ {
+        r, ok := s.paletteCell(id)
+        if !ok {
+            if r.Max.Y < s.palette.Min.Y {
+                break
+            }
+            continue
+        }
+        frame := ts.Frame(id)
+        s.sprite.Set(ts.Picture, frame)
+        fit := cell / math.Max(frame.W(), frame.H())
+        s.sprite.Draw(t, pixel.IM.Scaled(pixel.ZV, fit).Moved(r.Center()))
+        if uint32(ts.FirstGID+id) == s.tile&TILEGIDMASK {
+            s.imd.Color = s.UI.Style.Accent
+            s.imd.Push(r.Min, r.Max)
+            s.imd.Rectangle(2)
+        }
+    }
+    s.imd.Draw(t)
+}
+
+// the editor's key, once the game's started, and the ones that work while it's open
+func registerEditorShortcuts(sc *Shortcuts, e *Editor) {
+    sc.Register(SHORTCUTGLOBAL, "toggle editor", e.Key, e.Toggle)
+    open := func(fn func(s *EditorScene)) func() {
+        return func() {
+            if e.open && e.scene != nil {
+                fn(e.scene)
+            }
+        }
+    }
+    sc.Register(SHORTCUTEDITOR, "undo", MustChord("Ctrl+Z"), open((*EditorScene).Undo))
+    sc.Register(SHORTCUTEDITOR, "redo", MustChord("Ctrl+Y"), open((*EditorScene).Redo))
+    sc.Register(SHORTCUTEDITOR, "save level", MustChord("Ctrl+S"), open((*EditorScene).save))
+    sc.Register(SHORTCUTEDITOR, "reload level", MustChord("Ctrl+O"), open((*EditorScene).reload))
+    sc.Register(SHORTCUTEDITOR, "paint tiles", MustChord("T"), open(func(s *EditorScene) { s.SetMode(editorTiles) }))
+    sc.Register(SHORTCUTEDITOR, "place entities", MustChord("E"), open(func(s *EditorScene) { s.SetMode(editorEntities) }))
+    sc.Register(SHORTCUTEDITOR, "snap to grid", MustChord("G"), open(func(s *EditorScene) { s.Snap = !s.Snap }))
+    sc.Register(SHORTCUTEDITOR, "delete entity", MustChord("Delete"), open((*EditorScene).DeleteSelected))
+}
+
+func registerEditorCommands(c *Console, e *Editor) {
+    c.Register("editor", "opens a level in the editor, or opens and closes it on the level being played", func(args ConsoleArgs) error {
+        if args.Has(0) {
+            return e.Open(args.String(0))
+        }
+        e.Toggle()
+        return nil
+    }, StringArg("level").Opt())
+}
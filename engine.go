@@ -0,0 +1,713 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io/fs"
+    "math/rand"
+    "runtime"
+    "strings"
+    "time"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+    "golang.org/x/image/colornames"
+)
+
+var engineLog = logging.Module("engine")
+
+// what a game implements instead of editing the main loop. Init runs once the manifest has
+// finished loading, so resources are ready; Update and Draw run every frame after it.
+type Game interface {
+    // keep ctx, it's how the game reaches input and the built-in services
+    Init(ctx *Context) error
+    // a fixed simulation step of dt seconds, held while the game is paused
+    Update(dt float64)
+    // draws onto t directly or by submitting to ctx.Renderer, after the scenes
+    Draw(t RenderTarget)
+}
+
+// the built-in services, handed to Game.Init. they're the same ones the package globals point
+// at, so helpers written against those keep working.
+type Context struct {
+    // nil in headless runs; read input through Input instead
+    Window *pixelgl.Window
+    Input  Input
+    // named actions over Input, bound in the settings
+    Actions   *Actions
+    Gamepads  *Gamepads
+    Mouse     *Mouse
+    Drops     *FileDrops
+    Shortcuts *Shortcuts
+    Zoom      *ZoomInput
+    Onscreen  *VirtualControls
+    // change them and call Save to keep them for the next run
+    Settings  *Settings
+    Display   *Display
+    Screen    *VirtualScreen
+    Camera    *Camera
+    Renderer  *Renderer
+    Scenes    *SceneManager
+    Post      *PostProcessor
+    Assets    *AssetManager
+    Resources *Resources
+    Tweens    *Tweener
+    Scheduler *Scheduler
+    Clock     *Time
+    Audio     *Audio
+    Events    *EventBus
+    Loop      *FixedLoop
+    Pause     *Pause
+    Debug     *DebugOverlay
+    Editor    *Editor
+    Recorder  *Recorder
+    Console   *Console
+    Scripts   *Scripts
+    // runs after Game.Update once its World is set
+    Collisions *Collisions
+    // steps in place of Collisions once it has a Backend
+    Physics *Physics
+    // searches queued with Request finish over the next ticks
+    Paths *Pathfinder
+    // set its World and entities with a Behavior run their trees each tick
+    Behaviors *Behaviors
+    // Load a stats file in Game.Init; set Saves and Restore to keep progress
+    Stats *Stats
+    // second windows for tooling; Register an InspectorWindow or MapWindow to open it from the console
+    Windows *Windows
+    // nil in headless runs
+    Mods     *Mods
+    Profiler *Profiler
+    // seeded for replays; gameplay randomness should come from it
+    Random *rand.Rand
+    // Random and the other named streams, e.g. "loot" or "ai"
+    RNG *RNG
+}
+
+func newContext(in Input) *Context {
+    return &Context{
+        Window:     win,
+        Input:      in,
+        Actions:    actions,
+        Gamepads:   gamepads,
+        Mouse:      mouse,
+        Drops:      drops,
+        Shortcuts:  shortcuts,
+        Zoom:       zoom,
+        Onscreen:   onscreen,
+        Settings:   settings,
+        Display:    display,
+        Screen:     screen,
+        Camera:     camera,
+        Renderer:   renderer,
+        Scenes:     scenes,
+        Post:       post,
+        Assets:     assets,
+        Resources:  resources,
+        Tweens:     tweens,
+        Scheduler:  scheduler,
+        Clock:      clock,
+        Audio:      audio,
+        Events:     events,
+        Loop:       loop,
+        Pause:      pause,
+        Debug:      debug,
+        Editor:     editor,
+        Recorder:   recorder,
+        Console:    console,
+        Scripts:    scripts,
+        Collisions: collision,
+        Physics:    physics,
+        Paths:      paths,
+        Behaviors:  behaviors,
+        Stats:      stats,
+        Windows:    windows,
+        Mods:       mods,
+        Profiler:   profiler,
+        Random:     random,
+        RNG:        rng,
+    }
+}
+
+// how Run opens the window and what it loads
+type Config struct {
+    // what the player gets until they change something in the settings file
+    Settings     Settings
+    SettingsPath string
+    // the resolution the game renders at before scaling to the window
+    VirtualWidth, VirtualHeight float64
+    // a missing icon is only logged
+    Icon      string
+    Manifest  string
+    Resizable bool
+    // content packs overlaid on the assets; empty turns mods off
+    ModsDir string
+
+    // launch overrides, usually from ParseFlags; none of them are saved into the settings file
+    Width, Height int
+    Fullscreen    bool
+    NoVSync       bool
+    Debug         bool
+    RecordReplay  string
+    PlayReplay    string
+    AssetsDir     string
+    // a level to open in the editor once the game's started
+    Editor string
+    // the random seed, or zero for one from the clock; a replay being played brings its own
+    Seed int64
+    // times the systems each frame and serves pprof on ProfileAddr
+    Profile     bool
+    ProfileAddr string
+    // checks the golden scenes against the PNGs in this directory instead of running the game,
+    // or rewrites them with UpdateGolden
+    Golden       string
+    UpdateGolden bool
+    // runs these comma-separated benchmark scenes, or "all", instead of the game and writes the
+    // frame times to BenchOut
+    Bench       string
+    BenchFrames int
+    BenchOut    string
+}
+
+func DefaultConfig() Config {
+    return Config{
+        Settings:      DefaultSettings(),
+        SettingsPath:  SETTINGSPATH,
+        VirtualWidth:  VIRTUALX,
+        VirtualHeight: VIRTUALY,
+        Icon:          "icon.png",
+        Manifest:      MANIFESTPATH,
+        Resizable:     true,
+        ModsDir:       MODDIR,
+        ProfileAddr:   PROFILEADDR,
+        BenchFrames:   BENCHFRAMES,
+        BenchOut:      BENCHOUT,
+    }
+}
+
+// opens the window and runs game until it's closed. it must be called from main, since it takes
+// over the main thread for OpenGL. a panic is written up as a crash report in CRASHDIR and
+// comes back as the error.
+func Run(game Game, cfg Config) (err error) {
+    // panics inside mainthread.Call unwind through here, on the main thread
+    defer func() {
+        if r := recover(); r != nil {
+            err = reportCrash(r, false)
+        }
+    }()
+    pixelgl.Run(func() {
+        defer func() {
+            if r := recover(); r != nil {
+                err = reportCrash(r, true)
+            }
+        }()
+        err = run(game, cfg)
+    })
+    return err
+}
+
+// one frame of input and game time, dt in scaled seconds. game is nil until it's initialised,
+// which holds the scenes back too. shared by run and Headless, so both step the game the same way.
+func simulate(in Input, dt float64, game Game) {
+    ready := game != nil
+    stop := profiler.Time("input")
+    gamepads.Update(in)
+    onscreen.Update(in, actions)
+    actions.Update(in)
+    mouse.Update(in)
+    drops.Update(in)
+    shortcuts.Update(in)
+    zoom.Update(in, clock.Unscaled())
+    if ready {
+        pause.Update(in)
+    }
+    paused := pause.Paused()
+    tweens.Paused, scheduler.Paused, scenes.Paused = paused, paused, paused
+    gamepads.Paused = paused
+    audio.SetBackground(!in.Focused() || pause.AutoPaused())
+    audio.ListenFrom(camera)
+    audio.Update()
+    toasts.Update(clock.Unscaled())
+    network.Update()
+    if ready {
+        scenes.HandleInput(in)
+    }
+    stop()
+
+    // the simulation consumes scaled time in fixed steps, so Scale slows or pauses it
+    loop.Advance(dt, func(dt float64) {
+        stop := profiler.Time("timers")
+        tweens.Update(dt)
+        scheduler.Update(dt)
+        if !paused {
+            camera.Update(dt)
+        }
+        gamepads.UpdateRumble(dt)
+        stop()
+        if ready {
+            stop = profiler.Time("scenes")
+            scenes.Update(dt)
+            stop()
+            if !paused {
+                stop = profiler.Time("game")
+                game.Update(dt)
+                stop()
+                stop = profiler.Time("behaviors")
+                behaviors.Update(dt)
+                stop()
+                if physics.Active() {
+                    stop = profiler.Time("physics")
+                    physics.Step(dt)
+                    stop()
+                } else if collision.World != nil {
+                    stop = profiler.Time("collision")
+                    collision.Step()
+                    stop()
+                }
+                stop = profiler.Time("scripts")
+                scripts.Update(in, dt)
+                stop()
+                stop = profiler.Time("paths")
+                paths.Update()
+                stop()
+            }
+        }
+        // everything published during the step is handled before the next one
+        stop = profiler.Time("events")
+        events.Dispatch()
+        stop()
+    })
+}
+
+// draws the scenes, the game and everything submitted to the renderer onto t
+func render(t ComposeTarget, game Game) {
+    stop := profiler.Time("draw")
+    if game != nil {
+        scenes.Draw(t)
+        game.Draw(t)
+        scripts.Draw()
+        collision.Draw()
+        behaviors.Draw()
+        physics.Draw()
+        onscreen.Draw()
+    }
+    camera.DrawFlash(renderer.IMDraw(LAYERUI))
+    stop()
+    stop = profiler.Time("renderer")
+    renderer.Draw(t)
+    toasts.Draw(t)
+    stop()
+}
+
+// the engine's own console commands; games add theirs, like spawn, with ctx.Console.Register
+func registerEngineCommands(c *Console) {
+    c.Register("timescale", "sets clock.Scale, 1 is normal speed", func(args ConsoleArgs) error {
+        if args.Float(0) < 0 {
+            return fmt.Errorf("scale can't be negative")
+        }
+        clock.Scale = args.Float(0)
+        return nil
+    }, FloatArg("scale"))
+    c.Register("teleport", "moves the camera to a world position", func(args ConsoleArgs) error {
+        camera.Position = pixel.V(args.Float(0), args.Float(1))
+        return nil
+    }, FloatArg("x"), FloatArg("y"))
+    c.Register("debug", "shows or hides the debug overlay", func(args ConsoleArgs) error {
+        debug.Visible = !debug.Visible
+        if args.Has(0) {
+            debug.Visible = args.Bool(0)
+        }
+        return nil
+    }, BoolArg("on").Opt())
+    c.Register("collision", "shows or hides colliders, contacts and physics bodies over the world", func(args ConsoleArgs) error {
+        collision.Debug = !collision.Debug
+        if args.Has(0) {
+            collision.Debug = args.Bool(0)
+        }
+        physics.Debug = collision.Debug
+        return nil
+    }, BoolArg("on").Opt())
+    c.Register("behaviors", "shows or hides each agent's behavior tree branch over it", func(args ConsoleArgs) error {
+        behaviors.Debug = !behaviors.Debug
+        if args.Has(0) {
+            behaviors.Debug = args.Bool(0)
+        }
+        return nil
+    }, BoolArg("on").Opt())
+    c.Register("scripts", "lists the loaded scripts and what stopped any of them", func(args ConsoleArgs) error {
+        for _, script := range scripts.Loaded() {
+            if script.Err != nil {
+                c.Printf("%s  stopped: %v", script.Path, script.Err)
+            } else {
+                c.Printf("%s", script.Path)
+            }
+        }
+        return nil
+    })
+    c.Register("reload", "reloads a script, or every script", func(args ConsoleArgs) error {
+        for _, script := range scripts.Loaded() {
+            if args.Has(0) && script.Path != args.String(0) {
+                continue
+            }
+            if _, err := scripts.Load(script.Path); err != nil {
+                return err
+            }
+        }
+        return nil
+    }, StringArg("path").Opt().WithChoices(scriptPaths))
+    c.Register("mods", "lists the loaded mods in load order, and any that were skipped", func(args ConsoleArgs) error {
+        if mods == nil {
+            c.Printf("mods are off")
+            return nil
+        }
+        for _, mod := range mods.Loaded {
+            c.Printf("%s %s  %s", mod.ID, mod.Version, mod.Path)
+        }
+        for id, err := range mods.Skipped {
+            c.Printf("%s  skipped: %v", id, err)
+        }
+        return nil
+    })
+    c.Register("shortcuts", "lists the keyboard shortcuts and the contexts active now", func(args ConsoleArgs) error {
+        for _, line := range shortcuts.List() {
+            c.Printf("%s", line)
+        }
+        c.Printf("active: %s", strings.Join(shortcuts.Contexts(), ", "))
+        return nil
+    })
+    c.Register("bind", "binds an action to a button, replacing its others", func(args ConsoleArgs) error {
+        b, ok := ParseButton(args.String(1))
+        if !ok {
+            return fmt.Errorf("no button %q", args.String(1))
+        }
+        actions.Bind(args.String(0), b)
+        if also := actions.BoundTo(b); len(also) > 1 {
+            c.Printf("%s is also bound to %s", args.String(1), strings.Join(also, ", "))
+        }
+        return nil
+    }, StringArg("action").WithChoices(func() []string { return actions.Bindings.Actions() }), StringArg("button").WithChoices(ButtonNames))
+    c.Register("quit", "closes the window", func(args ConsoleArgs) error {
+        Quit()
+        return nil
+    })
+}
+
+func scriptPaths() []string {
+    var paths []string
+    for _, script := range scripts.Loaded() {
+        paths = append(paths, script.Path)
+    }
+    return paths
+}
+
+func run(game Game, cfg Config) error {
+    // a missing icon isn't worth refusing to start over
+    icons, err := LoadIconSet(cfg.Icon)
+    if err != nil {
+        engineLog.Warnf("icon: %v", err)
+    }
+
+    if cfg.AssetsDir != "" {
+        UseAssetDir(cfg.AssetsDir)
+        editor.Dir = cfg.AssetsDir
+    }
+    if cfg.ModsDir != "" {
+        mods, err = LoadMods(cfg.ModsDir)
+        if err != nil {
+            return err
+        }
+        defer mods.Close()
+        AssetFS = mods.FS(AssetFS)
+    }
+    // after the assets, so a game's own scenes can load theirs
+    if cfg.Golden != "" {
+        return runGolden(cfg.Golden, cfg.UpdateGolden)
+    }
+    if cfg.Bench != "" {
+        return runBench(cfg.Bench, cfg.BenchFrames, cfg.BenchOut, cfg.Width, cfg.Height)
+    }
+    // chosen now and logged, so a run is reproducible with --seed even when nobody recorded it
+    seed := cfg.Seed
+    if seed == 0 {
+        seed = time.Now().UnixNano()
+    }
+    // both start with Game.Init, so the loading screen's length doesn't matter
+    var replayRecorder *ReplayRecorder
+    var replayPlayer *ReplayPlayer
+    if cfg.PlayReplay != "" {
+        replay, err := LoadReplay(cfg.PlayReplay)
+        if err != nil {
+            return err
+        }
+        replayPlayer = NewReplayPlayer(replay)
+    } else if cfg.RecordReplay != "" {
+        replayRecorder = NewReplayRecorder(seed)
+        console.OnExec(replayRecorder.Command)
+        // deferred, so a crash still leaves the replay that led up to it
+        defer func() {
+            if err := replayRecorder.Replay.Save(cfg.RecordReplay); err != nil {
+                engineLog.Errorf("%v", err)
+                return
+            }
+            engineLog.Infof("replay of %d frames saved to %s", len(replayRecorder.Replay.Frames), cfg.RecordReplay)
+        }()
+    }
+    if cfg.Debug {
+        debug.Visible = true
+        logging.SetLevel(LogDebug)
+    }
+
+    // the console tails the log from the start, so loading warnings show up in it
+    logging.AddSink(console)
+    registerEngineCommands(console)
+    registerProfileCommands(console, profiler)
+    defer profiler.StopCPUProfile()
+    if cfg.Profile {
+        profiler.Enabled = true
+        profiler.StartServer(cfg.ProfileAddr)
+        debug.Watch("ms", func() interface{} { return profiler.Summary() })
+    }
+
+    settings = LoadSettings(cfg.SettingsPath, cfg.Settings)
+    audio.SetVolume(settings.Volume)
+    audio.OnChange(func(v VolumeSettings) error {
+        settings.Volume = v
+        return settings.Save()
+    })
+    registerAudioCommands(console, audio)
+    locale.Preferred = settings.Language
+    locale.OnChange(func(lang string) error {
+        settings.Language = lang
+        return settings.Save()
+    })
+    registerLocaleCommands(console, locale)
+    accessibility.Set(settings.Accessibility)
+    accessibility.OnChange(func(a AccessibilitySettings) error {
+        settings.Accessibility = a
+        return settings.Save()
+    })
+    registerAccessibilityCommands(console, accessibility)
+    registerToastCommands(console, toasts)
+    registerNetCommands(console, network)
+    registerRNGCommands(console, rng)
+    registerStatsCommands(console, stats)
+    registerWindowCommands(console, windows)
+    registerEditorCommands(console, editor)
+    // a machine without a sound card still gets to play, silently
+    if err := audio.Start(newAudioDevice()); err != nil {
+        audioLog.Warnf("%v", err)
+    }
+    defer audio.Close()
+    // a copy, so the overrides shape this launch without being written back
+    launch := *settings
+    if cfg.Width > 0 && cfg.Height > 0 {
+        launch.Display.WindowWidth, launch.Display.WindowHeight = cfg.Width, cfg.Height
+    }
+    if cfg.Fullscreen && launch.Display.Mode == DisplayWindowed {
+        launch.Display.Mode = DisplayBorderless
+    }
+    if cfg.NoVSync {
+        launch.VSync = false
+    }
+    width, height := float64(SCREENX), float64(SCREENY)
+    if launch.Display.WindowWidth > 0 && launch.Display.WindowHeight > 0 {
+        width, height = float64(launch.Display.WindowWidth), float64(launch.Display.WindowHeight)
+    }
+
+    win, err = pixelgl.NewWindow(pixelgl.WindowConfig{
+        Title:       launch.Title,
+        Bounds:      pixel.R(0, 0, width, height),
+        Icon:        icons,
+        VSync:       launch.VSync,
+        Resizable:   cfg.Resizable,
+        Undecorated: launch.Display.Undecorated,
+        AlwaysOnTop: launch.Display.AlwaysOnTop,
+    })
+    if err != nil {
+        return fmt.Errorf("window: %v", err)
+    }
+    drops.Attach()
+    // tool windows go with the game, even when it stops on an error
+    defer windows.CloseAll()
+    // Alt+Enter toggles fullscreen, and the last mode is restored on the next run
+    display = NewDisplay(win, launch.Display)
+    display.SetTitle(launch.Title)
+    registerDisplayCommands(console, display)
+    display.OnChange(func(d DisplaySettings) error {
+        settings.Display = d
+        return settings.Save()
+    })
+    if launch.Display.Mode != DisplayWindowed {
+        display.Apply()
+    }
+    if keys := settings.Keys["pause"]; len(keys) > 0 {
+        pause.Key = keys[0]
+    }
+    // rebinding a key takes effect straight away and is kept for the next run
+    actions = NewActions(settings.Keys, settings.Pad)
+    actions.DeadZone = settings.PadDeadZone
+    gamepads.RumbleStrength = settings.Rumble
+    mouse.Sensitivity = settings.MouseSensitivity
+    zoom.Sensitivity = settings.Zoom
+    actions.OnChange(func(k KeyBindings, p PadBindings) error {
+        settings.Keys, settings.Pad = k, p
+        return settings.Save()
+    })
+    if err := LoadGamepadMappings(GAMEPADMAPPINGS); err != nil && !errors.Is(err, fs.ErrNotExist) {
+        padLog.Warnf("%v", err)
+    }
+
+    screen = NewVirtualScreen(cfg.VirtualWidth, cfg.VirtualHeight)
+    camera = NewCamera(screen.Bounds())
+    renderer = NewRenderer(camera)
+    post = NewPostProcessor(screen.Bounds())
+    post.Filter = accessibility.Filter()
+    scenes = NewSceneManager(renderer, screen.Bounds())
+    screen.OnResize(func(bounds pixel.Rect) {
+        camera.Viewport = bounds
+        post.SetBounds(bounds)
+        scenes.SetBounds(bounds)
+    })
+
+    manifest, err := LoadManifest(cfg.Manifest)
+    if err != nil {
+        return err
+    }
+    if mods != nil {
+        if err := mods.MergeManifest(manifest); err != nil {
+            return err
+        }
+    }
+    if err := manifest.Validate(); err != nil {
+        return err
+    }
+    if err := locale.LoadDir(LOCALEDIR); err != nil {
+        return err
+    }
+
+    loader := NewLoader()
+    manifest.Queue(loader)
+    loader.Start(runtime.NumCPU())
+    resources = NewResources(manifest, loader)
+
+    // a clip still recording when the window closes gets finished rather than lost
+    defer recorder.Wait()
+    defer recorder.Stop()
+    defer scripts.Close()
+    defer network.Close()
+    // progress since the last unlock goes into the save as the game closes
+    defer func() {
+        if stats.Saves == nil {
+            return
+        }
+        if err := stats.Save(); err != nil {
+            statsLog.Errorf("%v", err)
+        }
+    }()
+
+    // stays nil until Init has run, which keeps it and the scenes out of the loop until then
+    var started Game
+    for !win.Closed() {
+        if err := loader.Err(); err != nil {
+            return err
+        }
+        if started == nil && loader.Done() {
+            if replayPlayer != nil {
+                seed = replayPlayer.Replay.Seed
+            }
+            SeedRandom(seed)
+            engineLog.Infof("random seed %d", seed)
+            if replayPlayer != nil || replayRecorder != nil {
+                loop.Reset()
+            }
+            if err := game.Init(newContext(win)); err != nil {
+                return fmt.Errorf("init: %v", err)
+            }
+            started = game
+            // only now, so the editor opens over the game's first scene rather than under it
+            registerEditorShortcuts(shortcuts, editor)
+            if cfg.Editor != "" {
+                if err := editor.Open(cfg.Editor); err != nil {
+                    editorLog.Errorf("%v", err)
+                }
+            }
+        }
+
+        // a replay's recorded frames stand in for live ones, until it runs out
+        var replayed *ReplayFrame
+        if started != nil && replayPlayer != nil {
+            if f, ok := replayPlayer.Next(); ok {
+                replayed = &f
+            } else {
+                engineLog.Infof("replay finished after %d frames", replayPlayer.Frame())
+                replayPlayer = nil
+            }
+        }
+        if replayed != nil {
+            clock.Advance(replayed.Delta)
+        } else {
+            clock.Tick()
+        }
+
+        // first, so an open console gets the keyboard to itself
+        consumed := console.Update(win)
+        var in Input = windows.Input(win)
+        if consumed {
+            in = BlockInput(in)
+        }
+        if replayed != nil {
+            in = replayPlayer.Input
+            for _, line := range replayed.Commands {
+                if err := console.Exec(line); err != nil {
+                    engineLog.Warnf("replay frame %d: %v", replayPlayer.Frame(), err)
+                }
+            }
+        }
+
+        display.Update()
+        debug.Update(in, clock.Unscaled())
+        screen.Update(win.Bounds())
+        stop := profiler.Time("assets")
+        assets.PollChanges()
+        scripts.PollChanges()
+        stop()
+        post.Update(clock.Unscaled())
+
+        if started != nil && replayRecorder != nil {
+            replayRecorder.Record(in, clock.Unscaled())
+        }
+        simulate(in, clock.Delta(), started)
+
+        win.Clear(colornames.Black)
+        post.Scene().Clear(colornames.Black)
+
+        if started == nil {
+            DrawLoadingBar(loader.Progress())
+        }
+        render(post.Scene(), started)
+        // letterboxed into the window, the bars keep the window's clear color
+        stop = profiler.Time("post")
+        post.Draw(win, screen.Viewport(win.Bounds()))
+        stop()
+        // before the overlays, so they never end up in screenshots or clips
+        stop = profiler.Time("capture")
+        HandleScreenshotKey(win)
+        recorder.Update(win, win.Canvas(), clock.Unscaled())
+        stop()
+        stop = profiler.Time("overlays")
+        recorder.DrawIndicator(win, win.Bounds())
+        debug.Draw(win, win.Bounds())
+        console.Draw(win, win.Bounds())
+        stop()
+        // between drawing the frame and presenting it, see Windows
+        stop = profiler.Time("windows")
+        windows.Update()
+        stop()
+        // mostly waiting on vsync and the driver
+        stop = profiler.Time("present")
+        win.Update()
+        stop()
+        profiler.EndFrame()
+    }
+    return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+)
+
+// events published while dispatching are handled in the same Dispatch, up to this many rounds,
+// so a handler that keeps publishing can't hang the frame
+const EVENTMAXROUNDS = 8
+
+// returned by Subscribe for Unsubscribe
+type Subscription uint64
+
+type eventHandler struct {
+    id Subscription
+    fn reflect.Value
+}
+
+// publish/subscribe keyed by the event's Go type, so systems react to a PlayerDied struct
+// without knowing who sent it. Publish queues events until Dispatch runs at a safe point in the
+// frame; Emit delivers straight away.
+type EventBus struct {
+    handlers map[reflect.Type][]eventHandler
+    queue    []interface{}
+    next     Subscription
+}
+
+func NewEventBus() *EventBus {
+    return &EventBus{handlers: make(map[reflect.Type][]eventHandler)}
+}
+
+// registers fn, a func taking a single event, e.g. func(e PlayerDied); its parameter type is
+// the topic
+func (b *EventBus) Subscribe(fn interface{}) Subscription {
+    v := reflect.ValueOf(fn)
+    t := v.Type()
+    if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 0 {
+        panic(fmt.Sprintf("events: %T isn't a func(event)", fn))
+    }
+    b.next++
+    topic := t.In(0)
+    b.handlers[topic] = append(b.handlers[topic], eventHandler{b.next, v})
+    return b.next
+}
+
+func (b *EventBus) Unsubscribe(sub Subscription) {
+    for topic, handlers := range b.handlers {
+        for i, h := range handlers {
+            if h.id == sub {
+                // copied so a dispatch already ranging over the old slice isn't disturbed
+                rest := append([]eventHandler(nil), handlers[:i]...)
+                b.handlers[topic] = append(rest, handlers[i+1:]...)
+                return
+            }
+        }
+    }
+}
+
+// queues e for the next Dispatch
+func (b *EventBus) Publish(e interface{}) {
+    b.queue = append(b.queue, e)
+}
+
+// delivers e to its subscribers right now
+func (b *EventBus) Emit(e interface{}) {
+    if e == nil {
+        return
+    }
+    v := reflect.ValueOf(e)
+    args := []reflect.Value{v}
+    for _, h := range b.handlers[v.Type()] {
+        h.fn.Call(args)
+    }
+}
+
+// delivers queued events in the order they were published
+func (b *EventBus) Dispatch() {
+    for round := 0; round < EVENTMAXROUNDS && len(b.queue) > 0; round++ {
+        queue := b.queue
+        b.queue = nil
+        for _, e := range queue {
+            b.Emit(e)
+        }
+    }
+}
+
+// drops queued events without delivering them, e.g. when changing levels
+func (b *EventBus) Clear() {
+    b.queue = nil
+}
+
+func (b *EventBus) Pending() int {
+    return len(b.queue)
+}
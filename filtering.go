@@ -0,0 +1,84 @@
+package main
+
+import (
+    "fmt"
+
+    "github.com/faiface/pixel"
+)
+
+type PictureOptions struct {
+    // linear filtering instead of nearest neighbour when drawn through a FilteredSprite
+    Smooth bool
+    // nearest neighbour pre-scale for pixel art; 0 and 1 leave the picture untouched
+    Scale int
+}
+
+// a picture that carries its own sampling mode rather than relying on the target's
+type FilteredPicture struct {
+    Picture pixel.Picture
+    Smooth  bool
+}
+
+func LoadPictureWithOptions(path string, opts PictureOptions) (*FilteredPicture, error) {
+    pic, err := LoadPicture(path)
+    if err != nil {
+        return nil, err
+    }
+    if opts.Scale > 1 {
+        pd, ok := pic.(*pixel.PictureData)
+        if !ok {
+            return nil, fmt.Errorf("%s: can only pre-scale picture data", path)
+        }
+        pic = ScalePictureNearest(pd, opts.Scale)
+    }
+    return &FilteredPicture{Picture: pic, Smooth: opts.Smooth}, nil
+}
+
+func (p *FilteredPicture) Sprite(frame pixel.Rect) *FilteredSprite {
+    return &FilteredSprite{Sprite: pixel.NewSprite(p.Picture, frame), Smooth: p.Smooth}
+}
+
+// the target side of smoothing; both pixelgl.Window and pixelgl.Canvas implement it
+type smoothTarget interface {
+    Smooth() bool
+    SetSmooth(smooth bool)
+}
+
+// a sprite drawn with its own sampling mode, restoring the target's afterwards
+type FilteredSprite struct {
+    *pixel.Sprite
+    Smooth bool
+}
+
+func (s *FilteredSprite) Draw(t pixel.Target, matrix pixel.Matrix) {
+    st, ok := t.(smoothTarget)
+    if !ok {
+        s.Sprite.Draw(t, matrix)
+        return
+    }
+    prev := st.Smooth()
+    st.SetSmooth(s.Smooth)
+    s.Sprite.Draw(t, matrix)
+    st.SetSmooth(prev)
+}
+
+// upscales by an integer factor, repeating each texel so pixel art stays crisp even when sampled smoothly
+func ScalePictureNearest(pd *pixel.PictureData, factor int) *pixel.PictureData {
+    if factor <= 1 {
+        return pd
+    }
+    w, h := pd.Stride, len(pd.Pix)/pd.Stride
+    bounds := pd.Rect
+    scaled := pixel.MakePictureData(pixel.R(
+        bounds.Min.X*float64(factor),
+        bounds.Min.Y*float64(factor),
+        bounds.Min.X*float64(factor)+float64(w*factor),
+        bounds.Min.Y*float64(factor)+float64(h*factor),
+    ))
+    for y := 0; y < h*factor; y++ {
+        for x := 0; x < w*factor; x++ {
+            scaled.Pix[y*scaled.Stride+x] = pd.Pix[(y/factor)*pd.Stride+x/factor]
+        }
+    }
+    return scaled
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+    "flag"
+    "os"
+    "path/filepath"
+)
+
+// reads launch options from args, usually os.Args[1:], into cfg. they only last for this run,
+// so a tester's --no-vsync never ends up in the player's settings file. Go's flag package
+// takes -width and --width alike.
+func ParseFlags(args []string, cfg *Config) error {
+    flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+    flags.IntVar(&cfg.Width, "width", cfg.Width, "window width, overriding the settings file")
+    flags.IntVar(&cfg.Height, "height", cfg.Height, "window height, overriding the settings file")
+    flags.BoolVar(&cfg.Fullscreen, "fullscreen", cfg.Fullscreen, "start fullscreen")
+    flags.BoolVar(&cfg.NoVSync, "no-vsync", cfg.NoVSync, "don't wait for vertical sync")
+    flags.BoolVar(&cfg.Debug, "debug", cfg.Debug, "open the debug overlay and log debug lines")
+    flags.StringVar(&cfg.RecordReplay, "record-replay", cfg.RecordReplay, "record input to this replay file")
+    flags.StringVar(&cfg.PlayReplay, "play-replay", cfg.PlayReplay, "play this replay file back instead of reading input")
+    flags.StringVar(&cfg.AssetsDir, "assets-dir", cfg.AssetsDir, "load assets from this directory instead of the pak or the embedded ones")
+    flags.Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed the random streams with this, to reproduce a run")
+    flags.StringVar(&cfg.Editor, "editor", cfg.Editor, "open this level in the editor once the game's started")
+    flags.StringVar(&cfg.ModsDir, "mods-dir", cfg.ModsDir, "load mods from this directory, or none when empty")
+    flags.BoolVar(&cfg.Profile, "profile", cfg.Profile, "time each system per frame and serve pprof")
+    flags.StringVar(&cfg.ProfileAddr, "profile-addr", cfg.ProfileAddr, "where --profile serves pprof")
+    flags.StringVar(&cfg.Golden, "golden", cfg.Golden, "render the golden scenes and compare them with the PNGs in this directory, then exit")
+    flags.BoolVar(&cfg.UpdateGolden, "update-golden", cfg.UpdateGolden, "with --golden, write the PNGs instead of comparing")
+    flags.StringVar(&cfg.Bench, "bench", cfg.Bench, "run these comma-separated benchmark scenes, or all of them, then exit")
+    flags.IntVar(&cfg.BenchFrames, "bench-frames", cfg.BenchFrames, "timed frames per benchmark scene")
+    flags.StringVar(&cfg.BenchOut, "bench-out", cfg.BenchOut, "where --bench writes its frame-time statistics")
+    return flags.Parse(args)
+}
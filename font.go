@@ -0,0 +1,373 @@
+package main
+
+import (
+    "fmt"
+    "image"
+    "image/color"
+    "math"
+    "path"
+    "strings"
+    "sync"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/text"
+    "golang.org/x/image/font"
+    "golang.org/x/image/font/gofont/goregular"
+    "golang.org/x/image/font/opentype"
+    "golang.org/x/image/font/sfnt"
+    "golang.org/x/image/math/fixed"
+)
+
+// size used by DrawText when the options don't set one
+const FONTSIZE = 16
+
+// runes baked into every atlas (ASCII and Latin-1), anything else draws as pixel's replacement glyph
+var FONTRUNES = fontRunes()
+
+func fontRunes() []rune {
+    runes := append([]rune(nil), text.ASCII...)
+    for r := rune(0xa0); r <= 0xff; r++ {
+        runes = append(runes, r)
+    }
+    return runes
+}
+
+// a parsed TrueType or OpenType font, rasterized into one atlas per size on demand.
+// bitmap fonts have a single atlas at their native size whatever size is asked for.
+type Font struct {
+    Name string
+
+    font    *opentype.Font
+    bitmap  *bmFace
+    mu      sync.Mutex
+    atlases map[float64]*text.Atlas
+    writers map[*text.Atlas]*text.Text
+    // draws the glyphs this font doesn't have, e.g. CJK script from a Latin font
+    fallback *Font
+    // baked in beyond FONTRUNES
+    extra []rune
+}
+
+var (
+    defaultFontOnce sync.Once
+    defaultFont     *Font
+)
+
+// Go Regular, bundled with x/image, so text can be drawn before any fonts are shipped
+func DefaultFont() *Font {
+    defaultFontOnce.Do(func() {
+        var err error
+        defaultFont, err = ParseFont("goregular", goregular.TTF)
+        if err != nil {
+            panic(err)
+        }
+    })
+    return defaultFont
+}
+
+// loads a .ttf or .otf from the asset filesystem, or a BMFont .fnt with its pages
+func LoadFont(name string) (*Font, error) {
+    if strings.EqualFold(path.Ext(name), ".fnt") {
+        return LoadBMFont(name)
+    }
+    data, err := ReadAsset(name)
+    if err != nil {
+        return nil, err
+    }
+    return ParseFont(name, data)
+}
+
+func ParseFont(name string, data []byte) (*Font, error) {
+    f, err := opentype.Parse(data)
+    if err != nil {
+        return nil, fmt.Errorf("font %s: %v", name, err)
+    }
+    return &Font{
+        Name:    name,
+        font:    f,
+        atlases: make(map[float64]*text.Atlas),
+        writers: make(map[*text.Atlas]*text.Text),
+    }, nil
+}
+
+// draws the runes f has no glyph for with fallback, e.g. a font with Japanese for a Latin one;
+// nil turns it off. neither can be a bitmap font.
+func (f *Font) SetFallback(fallback *Font) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if fallback == f {
+        fallback = nil
+    }
+    if fallback == f.fallback {
+        return
+    }
+    f.fallback = fallback
+    f.flush()
+}
+
+// bakes runes into the atlases as well as FONTRUNES, e.g. every letter a string table uses
+func (f *Font) AddRunes(runes []rune) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    have := make(map[rune]bool, len(FONTRUNES)+len(f.extra))
+    for _, r := range FONTRUNES {
+        have[r] = true
+    }
+    for _, r := range f.extra {
+        have[r] = true
+    }
+    added := false
+    for _, r := range runes {
+        if !have[r] {
+            have[r] = true
+            f.extra = append(f.extra, r)
+            added = true
+        }
+    }
+    if added {
+        f.flush()
+    }
+}
+
+// drops the atlases so they're built again with the new glyphs; call with the lock held
+func (f *Font) flush() {
+    f.atlases = make(map[float64]*text.Atlas)
+    f.writers = make(map[*text.Atlas]*text.Text)
+}
+
+// the glyph atlas for size in pixels, built the first time it's asked for
+func (f *Font) Atlas(size float64) (*text.Atlas, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if f.bitmap != nil {
+        size = 0
+    }
+    if atlas, ok := f.atlases[size]; ok {
+        return atlas, nil
+    }
+    if f.bitmap != nil {
+        atlas := text.NewAtlas(f.bitmap, f.bitmap.runes())
+        f.atlases[size] = atlas
+        return atlas, nil
+    }
+    face, err := f.face(size)
+    if err != nil {
+        return nil, err
+    }
+    if fb := f.fallback; fb != nil && fb.font != nil {
+        other, err := fb.face(size)
+        if err != nil {
+            face.Close()
+            return nil, err
+        }
+        face = &fallbackFace{Face: face, fallback: other, font: f.font}
+    }
+    atlas := text.NewAtlas(face, append(append([]rune(nil), FONTRUNES...), f.extra...))
+    face.Close()
+    f.atlases[size] = atlas
+    return atlas, nil
+}
+
+func (f *Font) face(size float64) (font.Face, error) {
+    face, err := opentype.NewFace(f.font, &opentype.FaceOptions{
+        Size:    size,
+        DPI:     72,
+        Hinting: font.HintingFull,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("font %s: size %v: %v", f.Name, size, err)
+    }
+    return face, nil
+}
+
+// a face that hands the runes its font has no glyph for to another
+type fallbackFace struct {
+    font.Face
+    fallback font.Face
+    font     *opentype.Font
+    buf      sfnt.Buffer
+}
+
+func (f *fallbackFace) pick(r rune) font.Face {
+    if i, err := f.font.GlyphIndex(&f.buf, r); err == nil && i == 0 {
+        return f.fallback
+    }
+    return f.Face
+}
+
+func (f *fallbackFace) Close() error {
+    f.fallback.Close()
+    return f.Face.Close()
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+    return f.pick(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+    return f.pick(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+    return f.pick(r).GlyphAdvance(r)
+}
+
+// only pairs from the same face kern
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+    if face := f.pick(r0); face == f.pick(r1) {
+        return face.Kern(r0, r1)
+    }
+    return 0
+}
+
+// a text.Text to reuse for atlas, so DrawText doesn't allocate a new one every frame
+func (f *Font) writer(atlas *text.Atlas) *text.Text {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    txt, ok := f.writers[atlas]
+    if !ok {
+        txt = text.New(pixel.ZV, atlas)
+        f.writers[atlas] = txt
+    }
+    return txt
+}
+
+type TextAlign int
+
+const (
+    AlignLeft TextAlign = iota
+    AlignCenter
+    AlignRight
+)
+
+type TextOptions struct {
+    // pixels, FONTSIZE when zero
+    Size  float64
+    Color color.Color
+    Align TextAlign
+    // wraps at word boundaries once a line is wider than this; 0 never wraps
+    Width float64
+    // multiple of the font's own line height; 0 means 1
+    LineSpacing float64
+}
+
+func (o TextOptions) size() float64 {
+    if o.Size <= 0 {
+        return FONTSIZE
+    }
+    return o.Size
+}
+
+// o with its size and wrapping width multiplied by scale
+func (o TextOptions) scaled(scale float64) TextOptions {
+    o.Size = o.size() * scale
+    o.Width *= scale
+    return o
+}
+
+// splits s into lines no wider than width, breaking at spaces where it can and mid-word where it must
+func WrapText(atlas *text.Atlas, s string, width float64) []string {
+    var lines []string
+    for _, paragraph := range strings.Split(s, "\n") {
+        if width <= 0 {
+            lines = append(lines, paragraph)
+            continue
+        }
+        line := ""
+        for _, word := range strings.Fields(paragraph) {
+            candidate := word
+            if line != "" {
+                candidate = line + " " + word
+            }
+            if textWidth(atlas, candidate) <= width {
+                line = candidate
+                continue
+            }
+            if line != "" {
+                lines = append(lines, line)
+            }
+            // a single word wider than the box gets broken by rune
+            line = ""
+            for _, r := range word {
+                if line != "" && textWidth(atlas, line+string(r)) > width {
+                    lines = append(lines, line)
+                    line = ""
+                }
+                line += string(r)
+            }
+        }
+        lines = append(lines, line)
+    }
+    return lines
+}
+
+func textWidth(atlas *text.Atlas, s string) float64 {
+    width, prev := 0.0, rune(-1)
+    for _, r := range s {
+        if prev >= 0 {
+            width += atlas.Kern(prev, r)
+        }
+        width += atlas.Glyph(r).Advance
+        prev = r
+    }
+    return width
+}
+
+// the size s would take up when drawn with opts, for laying out UI around it
+func MeasureText(f *Font, s string, opts TextOptions) (pixel.Vec, error) {
+    if f == nil {
+        f = DefaultFont()
+    }
+    atlas, err := f.Atlas(opts.size())
+    if err != nil {
+        return pixel.ZV, err
+    }
+    lines := WrapText(atlas, s, opts.Width)
+    width := 0.0
+    for _, line := range lines {
+        width = math.Max(width, textWidth(atlas, line))
+    }
+    return pixel.V(width, float64(len(lines))*lineHeight(atlas, opts)), nil
+}
+
+func lineHeight(atlas *text.Atlas, opts TextOptions) float64 {
+    if opts.LineSpacing <= 0 {
+        return atlas.LineHeight()
+    }
+    return atlas.LineHeight() * opts.LineSpacing
+}
+
+// draws s with the baseline of its first line at pos. with AlignCenter or AlignRight, pos.X is the
+// middle or right edge of every line. a nil font draws with DefaultFont.
+func DrawText(t pixel.Target, f *Font, s string, pos pixel.Vec, opts TextOptions) error {
+    if f == nil {
+        f = DefaultFont()
+    }
+    atlas, err := f.Atlas(opts.size())
+    if err != nil {
+        return err
+    }
+    txt := f.writer(atlas)
+    txt.Clear()
+    txt.LineHeight = lineHeight(atlas, opts)
+    if opts.Color != nil {
+        txt.Color = opts.Color
+    } else {
+        txt.Color = color.White
+    }
+
+    for i, line := range WrapText(atlas, s, opts.Width) {
+        lineWidth := textWidth(atlas, line)
+        x := 0.0
+        switch opts.Align {
+        case AlignCenter:
+            x = -lineWidth / 2
+        case AlignRight:
+            x = -lineWidth
+        }
+        txt.Dot = pixel.V(x, -float64(i)*txt.LineHeight)
+        txt.WriteString(line)
+    }
+    txt.Draw(t, pixel.IM.Moved(pos))
+    return nil
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+
+    "github.com/faiface/mainthread"
+    "github.com/faiface/pixel/pixelgl"
+    "github.com/go-gl/glfw/v3.3/glfw"
+)
+
+var padLog = logging.Module("gamepad")
+
+// extra controller layouts in SDL's gamecontrollerdb.txt format, loaded from the assets when
+// present. GLFW already knows the common Xbox and PlayStation pads.
+const GAMEPADMAPPINGS = "gamecontrollerdb.txt"
+
+// how far a stick has to move before it counts, so worn sticks don't drift
+const PADDEADZONE = 0.25
+
+// how far past the dead zone an axis bound to an action has to go for the action to be pressed
+const PADPRESSTHRESHOLD = 0.5
+
+// players Gamepads hands controllers out to
+const MAXPLAYERS = 4
+
+// one control on a gamepad: a button, or one direction of an axis
+type PadControl struct {
+    Button pixelgl.GamepadButton
+    Axis   pixelgl.GamepadAxis
+    // 0 for a button, -1 or 1 for the direction of Axis
+    Direction int
+}
+
+func PadButton(b pixelgl.GamepadButton) PadControl {
+    return PadControl{Button: b}
+}
+
+// dir below zero is the negative direction; for sticks that's left and up
+func PadAxis(axis pixelgl.GamepadAxis, dir int) PadControl {
+    if dir < 0 {
+        return PadControl{Axis: axis, Direction: -1}
+    }
+    return PadControl{Axis: axis, Direction: 1}
+}
+
+var padButtonNames = map[pixelgl.GamepadButton]string{
+    pixelgl.ButtonA:           "A",
+    pixelgl.ButtonB:           "B",
+    pixelgl.ButtonX:           "X",
+    pixelgl.ButtonY:           "Y",
+    pixelgl.ButtonLeftBumper:  "LeftBumper",
+    pixelgl.ButtonRightBumper: "RightBumper",
+    pixelgl.ButtonBack:        "Back",
+    pixelgl.ButtonStart:       "Start",
+    pixelgl.ButtonGuide:       "Guide",
+    pixelgl.ButtonLeftThumb:   "LeftThumb",
+    pixelgl.ButtonRightThumb:  "RightThumb",
+    pixelgl.ButtonDpadUp:      "DpadUp",
+    pixelgl.ButtonDpadRight:   "DpadRight",
+    pixelgl.ButtonDpadDown:    "DpadDown",
+    pixelgl.ButtonDpadLeft:    "DpadLeft",
+}
+
+var padAxisNames = map[pixelgl.GamepadAxis]string{
+    pixelgl.AxisLeftX:        "LeftX",
+    pixelgl.AxisLeftY:        "LeftY",
+    pixelgl.AxisRightX:       "RightX",
+    pixelgl.AxisRightY:       "RightY",
+    pixelgl.AxisLeftTrigger:  "LeftTrigger",
+    pixelgl.AxisRightTrigger: "RightTrigger",
+}
+
+// e.g. "A", "DpadUp", "LeftX-" or "RightTrigger+"
+func (c PadControl) String() string {
+    if c.Direction == 0 {
+        if name, ok := padButtonNames[c.Button]; ok {
+            return name
+        }
+        return fmt.Sprintf("Button%d", int(c.Button))
+    }
+    name, ok := padAxisNames[c.Axis]
+    if !ok {
+        name = fmt.Sprintf("Axis%d", int(c.Axis))
+    }
+    if c.Direction < 0 {
+        return name + "-"
+    }
+    return name + "+"
+}
+
+func ParsePadControl(name string) (PadControl, bool) {
+    for b, n := range padButtonNames {
+        if n == name {
+            return PadButton(b), true
+        }
+    }
+    if len(name) < 2 {
+        return PadControl{}, false
+    }
+    dir := 0
+    switch name[len(name)-1] {
+    case '-':
+        dir = -1
+    case '+':
+        dir = 1
+    default:
+        return PadControl{}, false
+    }
+    for axis, n := range padAxisNames {
+        if n == name[:len(name)-1] {
+            return PadAxis(axis, dir), true
+        }
+    }
+    return PadControl{}, false
+}
+
+// how far the control is pushed on pad js, 0 to 1 with the dead zone taken out
+func (c PadControl) value(in Input, js pixelgl.Joystick, deadZone float64) float64 {
+    if c.Direction == 0 {
+        if in.JoystickPressed(js, c.Button) {
+            return 1
+        }
+        return 0
+    }
+    v := in.JoystickAxis(js, c.Axis)
+    // GLFW reports triggers from -1 at rest to 1 held
+    if c.Axis == pixelgl.AxisLeftTrigger || c.Axis == pixelgl.AxisRightTrigger {
+        v = (v + 1) / 2
+    }
+    return ApplyDeadZone(v*float64(c.Direction), deadZone)
+}
+
+// v with the dead zone cut out of its 0-1 range, so movement starts from 0 at the zone's edge
+// instead of jumping; negative values come out as 0
+func ApplyDeadZone(v, deadZone float64) float64 {
+    if v <= deadZone {
+        return 0
+    }
+    if deadZone >= 1 {
+        return 1
+    }
+    return math.Min(1, (v-deadZone)/(1-deadZone))
+}
+
+// gamepad controls per action, saved by name like key bindings, e.g. "jump": ["A"]
+type PadBindings map[string][]PadControl
+
+func (p PadBindings) MarshalJSON() ([]byte, error) {
+    names := make(map[string][]string, len(p))
+    for action, controls := range p {
+        names[action] = []string{}
+        for _, c := range controls {
+            names[action] = append(names[action], c.String())
+        }
+    }
+    return json.Marshal(names)
+}
+
+func (p *PadBindings) UnmarshalJSON(data []byte) error {
+    var names map[string][]string
+    if err := json.Unmarshal(data, &names); err != nil {
+        return err
+    }
+    bindings := make(PadBindings, len(names))
+    for action, list := range names {
+        controls := []PadControl{}
+        for _, name := range list {
+            c, ok := ParsePadControl(name)
+            if !ok {
+                settingsLog.Warnf("unknown gamepad control %q for %s", name, action)
+                continue
+            }
+            controls = append(controls, c)
+        }
+        bindings[action] = controls
+    }
+    *p = bindings
+    return nil
+}
+
+// the same actions as DefaultKeyBindings, on the standard layout
+func DefaultPadBindings() PadBindings {
+    return PadBindings{
+        "up":      {PadButton(pixelgl.ButtonDpadUp), PadAxis(pixelgl.AxisLeftY, -1)},
+        "down":    {PadButton(pixelgl.ButtonDpadDown), PadAxis(pixelgl.AxisLeftY, 1)},
+        "left":    {PadButton(pixelgl.ButtonDpadLeft), PadAxis(pixelgl.AxisLeftX, -1)},
+        "right":   {PadButton(pixelgl.ButtonDpadRight), PadAxis(pixelgl.AxisLeftX, 1)},
+        "confirm": {PadButton(pixelgl.ButtonA)},
+        "cancel":  {PadButton(pixelgl.ButtonB)},
+        "pause":   {PadButton(pixelgl.ButtonStart)},
+    }
+}
+
+// which face buttons a pad has, for showing the right prompt
+type PadLayout int
+
+const (
+    LayoutXbox PadLayout = iota
+    LayoutPlayStation
+    LayoutNintendo
+)
+
+// guesses the layout from the name GLFW reports
+func PadLayoutOf(name string) PadLayout {
+    name = strings.ToLower(name)
+    switch {
+    case strings.Contains(name, "playstation"), strings.Contains(name, "dualshock"),
+        strings.Contains(name, "dualsense"), strings.Contains(name, "ps3"),
+        strings.Contains(name, "ps4"), strings.Contains(name, "ps5"), strings.Contains(name, "sony"):
+        return LayoutPlayStation
+    case strings.Contains(name, "nintendo"), strings.Contains(name, "switch"), strings.Contains(name, "joy-con"):
+        return LayoutNintendo
+    }
+    return LayoutXbox
+}
+
+var padLabels = map[PadLayout]map[pixelgl.GamepadButton]string{
+    LayoutPlayStation: {
+        pixelgl.ButtonA:           "Cross",
+        pixelgl.ButtonB:           "Circle",
+        pixelgl.ButtonX:           "Square",
+        pixelgl.ButtonY:           "Triangle",
+        pixelgl.ButtonLeftBumper:  "L1",
+        pixelgl.ButtonRightBumper: "R1",
+        pixelgl.ButtonBack:        "Share",
+        pixelgl.ButtonStart:       "Options",
+        pixelgl.ButtonGuide:       "PS",
+        pixelgl.ButtonLeftThumb:   "L3",
+        pixelgl.ButtonRightThumb:  "R3",
+    },
+    // SDL maps Nintendo pads by position, so the bottom button is A in the standard layout but
+    // labelled B on the pad
+    LayoutNintendo: {
+        pixelgl.ButtonA:           "B",
+        pixelgl.ButtonB:           "A",
+        pixelgl.ButtonX:           "Y",
+        pixelgl.ButtonY:           "X",
+        pixelgl.ButtonLeftBumper:  "L",
+        pixelgl.ButtonRightBumper: "R",
+        pixelgl.ButtonBack:        "-",
+        pixelgl.ButtonStart:       "+",
+        pixelgl.ButtonGuide:       "Home",
+    },
+    LayoutXbox: {
+        pixelgl.ButtonLeftBumper:  "LB",
+        pixelgl.ButtonRightBumper: "RB",
+        pixelgl.ButtonBack:        "View",
+        pixelgl.ButtonStart:       "Menu",
+        pixelgl.ButtonGuide:       "Xbox",
+        pixelgl.ButtonLeftThumb:   "LS",
+        pixelgl.ButtonRightThumb:  "RS",
+    },
+}
+
+// what the control is called on a pad with layout, e.g. "Cross" for A on a PlayStation pad
+func (c PadControl) Label(layout PadLayout) string {
+    if c.Direction == 0 {
+        if label, ok := padLabels[layout][c.Button]; ok {
+            return label
+        }
+    }
+    return c.String()
+}
+
+// tracks controllers as they're plugged in and out and hands each to a player, the first free
+// one when it connects. a pad that comes back gets its old player if nobody took it meanwhile.
+type Gamepads struct {
+    present [pixelgl.JoystickLast + 1]bool
+    player  [pixelgl.JoystickLast + 1]int
+    last    [pixelgl.JoystickLast + 1]int
+
+    // drives Rumble; nothing by default, GLFW has no force feedback
+    Haptics Haptics
+    // scales every rumble, 0 turns it off; from the settings
+    RumbleStrength float64
+    // set with the rest of the simulation's pause, it silences the motors
+    Paused bool
+
+    rumbles  [pixelgl.JoystickLast + 1][]padRumble
+    motors   [pixelgl.JoystickLast + 1][2]float64
+    noRumble bool
+
+    onConnect, onDisconnect []func(js pixelgl.Joystick, player int)
+}
+
+func NewGamepads() *Gamepads {
+    g := &Gamepads{Haptics: noHaptics{}, RumbleStrength: 1}
+    for js := range g.player {
+        g.player[js], g.last[js] = -1, -1
+    }
+    return g
+}
+
+// registers fn for a pad being plugged in; player is -1 when every player already has one
+func (g *Gamepads) OnConnect(fn func(js pixelgl.Joystick, player int)) {
+    g.onConnect = append(g.onConnect, fn)
+}
+
+func (g *Gamepads) OnDisconnect(fn func(js pixelgl.Joystick, player int)) {
+    g.onDisconnect = append(g.onDisconnect, fn)
+}
+
+// notices pads being connected and disconnected; simulate calls it every frame
+func (g *Gamepads) Update(in Input) {
+    for js := pixelgl.Joystick1; js <= pixelgl.JoystickLast; js++ {
+        present := in.JoystickPresent(js)
+        if present == g.present[js] {
+            continue
+        }
+        g.present[js] = present
+        if present {
+            player := g.last[js]
+            if player < 0 || g.Joystick(player) >= 0 {
+                player = g.freePlayer()
+            }
+            g.player[js] = player
+            padLog.Infof("%s connected as pad %d, player %d", in.JoystickName(js), js+1, player+1)
+            for _, fn := range g.onConnect {
+                fn(js, player)
+            }
+        } else {
+            player := g.player[js]
+            g.last[js], g.player[js] = player, -1
+            g.rumbles[js], g.motors[js] = nil, [2]float64{}
+            padLog.Infof("pad %d disconnected", js+1)
+            for _, fn := range g.onDisconnect {
+                fn(js, player)
+            }
+        }
+    }
+}
+
+func (g *Gamepads) freePlayer() int {
+    for player := 0; player < MAXPLAYERS; player++ {
+        if g.Joystick(player) < 0 {
+            return player
+        }
+    }
+    return -1
+}
+
+// the pads plugged in, in joystick order
+func (g *Gamepads) Connected() []pixelgl.Joystick {
+    var pads []pixelgl.Joystick
+    for js, present := range g.present {
+        if present {
+            pads = append(pads, pixelgl.Joystick(js))
+        }
+    }
+    return pads
+}
+
+// the player js belongs to, or -1
+func (g *Gamepads) Player(js pixelgl.Joystick) int {
+    return g.player[js]
+}
+
+// player's pad, or -1 when they don't have one
+func (g *Gamepads) Joystick(player int) pixelgl.Joystick {
+    for js, p := range g.player {
+        if p == player && g.present[js] {
+            return pixelgl.Joystick(js)
+        }
+    }
+    return -1
+}
+
+// gives js to player, e.g. from a "press Start to join" screen; whoever had it loses it
+func (g *Gamepads) Assign(js pixelgl.Joystick, player int) {
+    if other := g.Joystick(player); other >= 0 {
+        g.player[other] = -1
+    }
+    g.player[js] = player
+}
+
+// the connected players, sorted
+func (g *Gamepads) Players() []int {
+    var players []int
+    for js, p := range g.player {
+        if p >= 0 && g.present[js] {
+            players = append(players, p)
+        }
+    }
+    sort.Ints(players)
+    return players
+}
+
+// adds SDL gamecontrollerdb.txt style mappings from the asset at path, for pads GLFW doesn't know
+func LoadGamepadMappings(path string) error {
+    data, err := ReadAsset(path)
+    if err != nil {
+        return err
+    }
+    ok := true
+    mainthread.Call(func() {
+        ok = glfw.UpdateGamepadMappings(string(data))
+    })
+    if !ok {
+        return fmt.Errorf("gamepad mappings %s: GLFW rejected them", path)
+    }
+    return nil
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+    "fmt"
+    "image"
+    "image/color"
+    "image/png"
+    "math"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+    "golang.org/x/image/colornames"
+)
+
+var goldenLog = logging.Module("golden")
+
+// how far apart one channel of a pixel can be and still match, since drivers round blending
+// and filtering a little differently
+const GOLDENTOLERANCE = 2
+
+// the share of pixels allowed past the tolerance, for the odd antialiased edge
+const GOLDENMAXDIFF = 0.001
+
+// where a failed scene's render and its diff are written, under the golden directory
+const GOLDENFAILED = "failed"
+
+// a known scene rendered offscreen and compared against <Name>.png in the golden directory
+type GoldenScene struct {
+    Name          string
+    Width, Height int
+    // GOLDENTOLERANCE and GOLDENMAXDIFF when zero
+    Tolerance uint8
+    MaxDiff   float64
+    // draws into c, which is Width by Height and cleared to black
+    Draw func(c RenderCanvas)
+}
+
+var goldenScenes = map[string]GoldenScene{}
+
+// adds a scene to the ones --golden checks; games register theirs before Run
+func RegisterGolden(s GoldenScene) {
+    if _, ok := goldenScenes[s.Name]; ok {
+        panic(fmt.Sprintf("golden: scene %q registered twice", s.Name))
+    }
+    goldenScenes[s.Name] = s
+}
+
+// registered scene names, sorted
+func GoldenScenes() []string {
+    names := make([]string, 0, len(goldenScenes))
+    for name := range goldenScenes {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// how far a render is from its golden image
+type GoldenDiff struct {
+    // pixels with a channel further apart than the tolerance, out of Total
+    Differing, Total int
+    MaxDelta         uint8
+    // the golden image dimmed, with differing pixels in red
+    Image *image.RGBA
+}
+
+func (d GoldenDiff) Fraction() float64 {
+    if d.Total == 0 {
+        return 0
+    }
+    return float64(d.Differing) / float64(d.Total)
+}
+
+// compares got and want pixel by pixel; they have to be the same size
+func CompareImages(got, want image.Image, tolerance uint8) (GoldenDiff, error) {
+    gb, wb := got.Bounds(), want.Bounds()
+    if gb.Dx() != wb.Dx() || gb.Dy() != wb.Dy() {
+        return GoldenDiff{}, fmt.Errorf("golden: rendered %dx%d, golden is %dx%d", gb.Dx(), gb.Dy(), wb.Dx(), wb.Dy())
+    }
+    diff := GoldenDiff{Total: gb.Dx() * gb.Dy(), Image: image.NewRGBA(image.Rect(0, 0, gb.Dx(), gb.Dy()))}
+    for y := 0; y < gb.Dy(); y++ {
+        for x := 0; x < gb.Dx(); x++ {
+            g := color.NRGBAModel.Convert(got.At(gb.Min.X+x, gb.Min.Y+y)).(color.NRGBA)
+            w := color.NRGBAModel.Convert(want.At(wb.Min.X+x, wb.Min.Y+y)).(color.NRGBA)
+            delta := channelDelta(g.R, w.R)
+            for _, d := range []uint8{channelDelta(g.G, w.G), channelDelta(g.B, w.B), channelDelta(g.A, w.A)} {
+                if d > delta {
+                    delta = d
+                }
+            }
+            if delta > diff.MaxDelta {
+                diff.MaxDelta = delta
+            }
+            if delta > tolerance {
+                diff.Differing++
+                diff.Image.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+                continue
+            }
+            grey := uint8((uint16(w.R) + uint16(w.G) + uint16(w.B)) / 12)
+            diff.Image.SetRGBA(x, y, color.RGBA{grey, grey, grey, 255})
+        }
+    }
+    return diff, nil
+}
+
+func channelDelta(a, b uint8) uint8 {
+    if a > b {
+        return a - b
+    }
+    return b - a
+}
+
+// how one scene fared
+type GoldenResult struct {
+    Scene string
+    Diff  GoldenDiff
+    // set when the scene couldn't be compared at all, e.g. its golden image is missing
+    Err error
+    // the golden image was written rather than compared
+    Updated bool
+}
+
+func (r GoldenResult) Passed() bool {
+    if r.Err != nil {
+        return false
+    }
+    if r.Updated {
+        return true
+    }
+    s := goldenScenes[r.Scene]
+    limit := s.MaxDiff
+    if limit == 0 {
+        limit = GOLDENMAXDIFF
+    }
+    return r.Diff.Fraction() <= limit
+}
+
+// renders every registered scene and compares it with dir/<name>.png, or writes that file when
+// update is set. a failed scene's render and diff go into dir/failed for a look. it needs a GL
+// context, so call it from inside pixelgl.Run with a window open.
+func RunGolden(dir string, update bool) []GoldenResult {
+    results := make([]GoldenResult, 0, len(goldenScenes))
+    for _, name := range GoldenScenes() {
+        results = append(results, runGoldenScene(dir, goldenScenes[name], update))
+    }
+    return results
+}
+
+func runGoldenScene(dir string, s GoldenScene, update bool) GoldenResult {
+    result := GoldenResult{Scene: s.Name}
+    canvas := graphics.NewCanvas(pixel.R(0, 0, float64(s.Width), float64(s.Height)))
+    canvas.Clear(color.Black)
+    s.Draw(canvas)
+    got := CaptureCanvas(canvas)
+
+    path := filepath.Join(dir, s.Name+".png")
+    if update {
+        if result.Err = writePNG(path, got); result.Err == nil {
+            result.Updated = true
+        }
+        return result
+    }
+    want, err := readPNG(path)
+    if os.IsNotExist(err) {
+        result.Err = fmt.Errorf("golden: no %s yet, run with --update-golden to write it", path)
+        return result
+    } else if err != nil {
+        result.Err = err
+        return result
+    }
+    tolerance := s.Tolerance
+    if tolerance == 0 {
+        tolerance = GOLDENTOLERANCE
+    }
+    if result.Diff, result.Err = CompareImages(got, want, tolerance); result.Err != nil {
+        return result
+    }
+    if !result.Passed() {
+        failed := filepath.Join(dir, GOLDENFAILED)
+        if err := os.MkdirAll(failed, 0755); err != nil {
+            goldenLog.Warnf("%v", err)
+            return result
+        }
+        for suffix, img := range map[string]image.Image{".got.png": got, ".diff.png": result.Diff.Image} {
+            if err := writePNG(filepath.Join(failed, s.Name+suffix), img); err != nil {
+                goldenLog.Warnf("%v", err)
+            }
+        }
+    }
+    return result
+}
+
+func readPNG(path string) (image.Image, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    img, err := png.Decode(file)
+    if err != nil {
+        return nil, fmt.Errorf("golden: %s: %v", path, err)
+    }
+    return img, nil
+}
+
+func writePNG(path string, img image.Image) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return err
+    }
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    if err := png.Encode(file, img); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
+
+// what --golden runs instead of the game: an invisible window for the GL context, every scene
+// checked or written, and an error naming the ones that failed
+func runGolden(dir string, update bool) error {
+    win, err := pixelgl.NewWindow(pixelgl.WindowConfig{
+        Title:     "golden",
+        Bounds:    pixel.R(0, 0, 64, 64),
+        Invisible: true,
+    })
+    if err != nil {
+        return err
+    }
+    defer win.Destroy()
+
+    var failed []string
+    for _, r := range RunGolden(dir, update) {
+        switch {
+        case r.Err != nil:
+            goldenLog.Errorf("%s: %v", r.Scene, r.Err)
+            failed = append(failed, r.Scene)
+        case r.Updated:
+            goldenLog.Infof("%s: written", r.Scene)
+        case !r.Passed():
+            goldenLog.Errorf("%s: %d of %d pixels differ, by up to %d", r.Scene, r.Diff.Differing, r.Diff.Total, r.Diff.MaxDelta)
+            failed = append(failed, r.Scene)
+        default:
+            goldenLog.Infof("%s: ok, %d of %d pixels past tolerance, max delta %d", r.Scene, r.Diff.Differing, r.Diff.Total, r.Diff.MaxDelta)
+        }
+    }
+    if len(failed) > 0 {
+        return fmt.Errorf("golden: %d of %d scenes failed: %s", len(failed), len(goldenScenes), strings.Join(failed, ", "))
+    }
+    return nil
+}
+
+// a 16x16 tile in four flat colours with a white border, so filtering and UV mistakes show
+func patternTile() *pixel.PictureData {
+    img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+    quarters := []color.RGBA{colornames.Red, colornames.Lime, colornames.Blue, colornames.Yellow}
+    for y := 0; y < 16; y++ {
+        for x := 0; x < 16; x++ {
+            c := quarters[(y/8)*2+x/8]
+            if x == 0 || y == 0 || x == 15 || y == 15 {
+                c = colornames.White
+            }
+            img.SetRGBA(x, y, c)
+        }
+    }
+    return pixel.PictureDataFromImage(img)
+}
+
+// the reference scenes: flat shapes, a batched sprite field through a camera, text, the
+// pixel-art upscale and a post-processing chain
+func init() {
+    RegisterGolden(GoldenScene{Name: "shapes", Width: 128, Height: 128, Draw: func(c RenderCanvas) {
+        imd := imdraw.New(nil)
+        imd.Color = colornames.Orange
+        imd.Push(pixel.V(8, 8), pixel.V(56, 8), pixel.V(32, 56))
+        imd.Polygon(0)
+        imd.Color = colornames.Skyblue
+        imd.Push(pixel.V(96, 32))
+        imd.Circle(24, 0)
+        imd.Color = colornames.White
+        imd.Push(pixel.V(8, 72), pixel.V(120, 120))
+        imd.Line(4)
+        // half-transparent overlap checks blending
+        imd.Color = pixel.RGBA{R: 1, A: 1}.Mul(pixel.Alpha(0.5))
+        imd.Push(pixel.V(16, 80), pixel.V(64, 112))
+        imd.Rectangle(0)
+        imd.Color = pixel.RGBA{B: 1, A: 1}.Mul(pixel.Alpha(0.5))
+        imd.Push(pixel.V(40, 64), pixel.V(88, 96))
+        imd.Rectangle(0)
+        imd.Draw(c)
+    }})
+    RegisterGolden(GoldenScene{Name: "sprites", Width: 160, Height: 120, Draw: func(c RenderCanvas) {
+        tile := patternTile()
+        sprite := pixel.NewSprite(tile, tile.Bounds())
+        cam := NewCamera(c.Bounds())
+        cam.Position = cam.Position.Add(pixel.V(8, 4))
+        cam.Zoom = 1.5
+        r := NewRenderer(cam)
+        q := r.Sprites(LAYERACTORS)
+        for y := 0; y < 8; y++ {
+            for x := 0; x < 10; x++ {
+                at := pixel.V(float64(x)*18+10, float64(y)*18+10)
+                angle := float64(x+y) * math.Pi / 16
+                q.Add(sprite, pixel.IM.Rotated(pixel.ZV, angle).Moved(at))
+            }
+        }
+        q.AddColorMask(sprite, pixel.IM.Scaled(pixel.ZV, 3).Moved(c.Bounds().Center()), pixel.Alpha(0.75))
+        r.Draw(c)
+    }})
+    RegisterGolden(GoldenScene{Name: "text", Width: 200, Height: 80, Draw: func(c RenderCanvas) {
+        DrawText(c, nil, "Left 0123", pixel.V(4, 56), TextOptions{Size: 12})
+        DrawText(c, nil, "Centre", pixel.V(100, 32), TextOptions{Size: 16, Align: AlignCenter, Color: colornames.Yellow})
+        DrawText(c, nil, "right", pixel.V(196, 8), TextOptions{Size: 10, Align: AlignRight, Color: colornames.Lime})
+    }})
+    RegisterGolden(GoldenScene{Name: "scaled", Width: 200, Height: 120, Draw: func(c RenderCanvas) {
+        // a 64x36 virtual screen at a whole 3x, letterboxed like the window would be
+        virtual := NewVirtualScreen(64, 36)
+        virtual.Mode = ScaleInteger
+        post := NewPostProcessor(virtual.Bounds())
+        post.Scene().Clear(colornames.Navy)
+        tile := patternTile()
+        pixel.NewSprite(tile, tile.Bounds()).Draw(post.Scene(), pixel.IM.Moved(pixel.V(16, 18)))
+        pixel.NewSprite(tile, tile.Bounds()).Draw(post.Scene(), pixel.IM.Scaled(pixel.ZV, 2).Moved(pixel.V(46, 18)))
+        post.Draw(c, virtual.Viewport(c.Bounds()))
+    }})
+    RegisterGolden(GoldenScene{Name: "postfx", Width: 128, Height: 96, Draw: func(c RenderCanvas) {
+        post := NewPostProcessor(c.Bounds())
+        post.Scene().Clear(colornames.White)
+        imd := imdraw.New(nil)
+        imd.Color = colornames.Black
+        imd.Push(pixel.V(32, 24), pixel.V(96, 72))
+        imd.Rectangle(0)
+        imd.Draw(post.Scene())
+        post.Add(VignetteEffect(0.6), ChromaticAberrationEffect(2))
+        post.Draw(c, c.Bounds())
+    }})
+}
@@ -0,0 +1,47 @@
+//go:build golden
+// +build golden
+
+package main
+
+import (
+    "os"
+    "testing"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// the scenes need a GL context, so with the golden tag every test runs inside pixelgl.Run. it needs
+// a display too; make test-golden provides one with xvfb-run.
+func TestMain(m *testing.M) {
+    code := 0
+    pixelgl.Run(func() {
+        code = m.Run()
+    })
+    os.Exit(code)
+}
+
+func TestGolden(t *testing.T) {
+    win, err := pixelgl.NewWindow(pixelgl.WindowConfig{
+        Title:     "golden",
+        Bounds:    pixel.R(0, 0, 64, 64),
+        Invisible: true,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer win.Destroy()
+
+    results := RunGolden("golden", false)
+    if len(results) == 0 {
+        t.Fatal("no golden scenes registered")
+    }
+    for _, r := range results {
+        switch {
+        case r.Err != nil:
+            t.Errorf("%s: %v", r.Scene, r.Err)
+        case !r.Passed():
+            t.Errorf("%s: %d of %d pixels differ, by up to %d; the render and diff are in golden/%s", r.Scene, r.Diff.Differing, r.Diff.Total, r.Diff.MaxDelta, GOLDENFAILED)
+        }
+    }
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+    "image"
+    "image/color"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// every registered scene has its reference checked in, so --golden has something to compare with
+func TestGoldenImagesCommitted(t *testing.T) {
+    for _, name := range GoldenScenes() {
+        s := goldenScenes[name]
+        img, err := readPNG(filepath.Join("golden", name+".png"))
+        if os.IsNotExist(err) {
+            t.Errorf("%s: no golden/%s.png, run make golden-update", name, name)
+            continue
+        } else if err != nil {
+            t.Errorf("%s: %v", name, err)
+            continue
+        }
+        if b := img.Bounds(); b.Dx() != s.Width || b.Dy() != s.Height {
+            t.Errorf("%s: golden image is %dx%d, the scene is %dx%d", name, b.Dx(), b.Dy(), s.Width, s.Height)
+        }
+    }
+}
+
+func TestCompareImages(t *testing.T) {
+    want := image.NewRGBA(image.Rect(0, 0, 4, 4))
+    got := image.NewRGBA(image.Rect(0, 0, 4, 4))
+    for i := 3; i < len(want.Pix); i += 4 {
+        want.Pix[i], got.Pix[i] = 255, 255
+    }
+    // the first is just within tolerance, the second well past it
+    got.SetRGBA(0, 0, color.RGBA{R: GOLDENTOLERANCE, A: 255})
+    got.SetRGBA(1, 0, color.RGBA{R: 200, A: 255})
+    diff, err := CompareImages(got, want, GOLDENTOLERANCE)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if diff.Differing != 1 || diff.Total != 16 || diff.MaxDelta != 200 {
+        t.Errorf("%d of %d differ by up to %d, want 1 of 16 by 200", diff.Differing, diff.Total, diff.MaxDelta)
+    }
+    if diff.Image.RGBAAt(1, 0) != (color.RGBA{255, 0, 0, 255}) {
+        t.Errorf("differing pixel drawn %v in the diff, want red", diff.Image.RGBAAt(1, 0))
+    }
+    if _, err := CompareImages(image.NewRGBA(image.Rect(0, 0, 4, 5)), want, 0); err == nil {
+        t.Error("images of different sizes compared")
+    }
+}
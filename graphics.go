@@ -0,0 +1,97 @@
+package main
+
+import (
+    "image/color"
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// an offscreen surface to draw into and then draw elsewhere as a picture, which is what the
+// post processor, lighting, transitions, the minimap and screenshots are built from.
+// *pixelgl.Canvas is one.
+type RenderCanvas interface {
+    ComposeTarget
+    pixel.Picture
+    SetColorMask(c color.Color)
+    Clear(c color.Color)
+    SetBounds(bounds pixel.Rect)
+    Smooth() bool
+    SetSmooth(smooth bool)
+    Draw(t pixel.Target, matrix pixel.Matrix)
+    DrawColorMask(t pixel.Target, matrix pixel.Matrix, mask color.Color)
+    // RGBA bytes, bottom row first
+    Pixels() []uint8
+    // GLSL run over everything drawn into it, see PostEffect; backends without it draw unshaded
+    SetFragmentShader(src string)
+    SetUniform(name string, value interface{})
+}
+
+// the graphics library under the engine. engine code makes its canvases through graphics and
+// draws through pixel.Target, as imdraw and pixel.Batch already do, so a game swaps the whole
+// renderer by setting graphics before Run: NullBackend for servers, or an adapter over another
+// library for platforms pixelgl doesn't reach. windows and input stay the Input interface's.
+type RenderBackend interface {
+    Name() string
+    NewCanvas(bounds pixel.Rect) RenderCanvas
+}
+
+// OpenGL through pixelgl, which needs Run's main thread and a window's context
+type PixelGLBackend struct{}
+
+func (PixelGLBackend) Name() string { return "pixelgl" }
+
+func (PixelGLBackend) NewCanvas(bounds pixel.Rect) RenderCanvas {
+    return pixelgl.NewCanvas(bounds)
+}
+
+var _ RenderCanvas = (*pixelgl.Canvas)(nil)
+
+// draws nothing, for dedicated servers and Headless: canvases count what goes into them like
+// NullTarget and read back as transparent
+type NullBackend struct{}
+
+func (NullBackend) Name() string { return "null" }
+
+func (NullBackend) NewCanvas(bounds pixel.Rect) RenderCanvas {
+    return &NullCanvas{bounds: bounds}
+}
+
+type NullCanvas struct {
+    NullTarget
+    bounds pixel.Rect
+    smooth bool
+}
+
+func (c *NullCanvas) Bounds() pixel.Rect                                             { return c.bounds }
+func (c *NullCanvas) SetBounds(bounds pixel.Rect)                                    { c.bounds = bounds }
+func (c *NullCanvas) Smooth() bool                                                   { return c.smooth }
+func (c *NullCanvas) SetSmooth(smooth bool)                                          { c.smooth = smooth }
+func (c *NullCanvas) SetFragmentShader(src string)                                   {}
+func (c *NullCanvas) SetUniform(name string, value interface{})                      {}
+func (c *NullCanvas) Draw(t pixel.Target, matrix pixel.Matrix)                       { c.drawOnto(t) }
+func (c *NullCanvas) DrawColorMask(t pixel.Target, m pixel.Matrix, mask color.Color) { c.drawOnto(t) }
+
+// counts as a draw on another null target, and nothing on a real one
+func (c *NullCanvas) drawOnto(t pixel.Target) {
+    switch t := t.(type) {
+    case *NullTarget:
+        t.Draws++
+    case *NullCanvas:
+        t.Draws++
+    }
+}
+
+// the same size pixelgl.Canvas.Pixels would be, all zero
+func (c *NullCanvas) Pixels() []uint8 {
+    w, h := canvasSize(c.bounds)
+    return make([]uint8, 4*w*h)
+}
+
+// whole pixels a canvas over bounds covers, rounded outwards like pixelgl does
+func canvasSize(bounds pixel.Rect) (int, int) {
+    w := int(math.Ceil(bounds.Max.X) - math.Floor(bounds.Min.X))
+    h := int(math.Ceil(bounds.Max.Y) - math.Floor(bounds.Min.Y))
+    return w, h
+}
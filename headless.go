@@ -0,0 +1,302 @@
+package main
+
+import (
+    "fmt"
+    "image/color"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// scripted input for headless runs. changes show up straight away and Update ends the frame, so
+// a Press followed by a Step is seen as JustPressed for exactly that step.
+type FakeInput struct {
+    // the pretend window, for code that maps the mouse through the virtual screen
+    Window pixel.Rect
+
+    pressed, previous [pixelgl.KeyLast + 1]bool
+    repeated          [pixelgl.KeyLast + 1]bool
+    mouse, prevMouse  pixel.Vec
+    scroll            pixel.Vec
+    typed             string
+    unfocused         bool
+    outside           bool
+    pads              [pixelgl.JoystickLast + 1]fakePad
+}
+
+type fakePad struct {
+    present           bool
+    name              string
+    pressed, previous [pixelgl.ButtonLast + 1]bool
+    axes              [pixelgl.AxisLast + 1]float64
+}
+
+func NewFakeInput(window pixel.Rect) *FakeInput {
+    return &FakeInput{Window: window}
+}
+
+func (f *FakeInput) Press(buttons ...pixelgl.Button) {
+    for _, b := range buttons {
+        f.pressed[b] = true
+    }
+}
+
+func (f *FakeInput) Release(buttons ...pixelgl.Button) {
+    for _, b := range buttons {
+        f.pressed[b] = false
+    }
+}
+
+// a key repeat for held keys, like the OS sends
+func (f *FakeInput) Repeat(b pixelgl.Button) {
+    f.repeated[b] = true
+}
+
+// moves the mouse to pos in window coordinates
+func (f *FakeInput) MoveMouse(pos pixel.Vec) {
+    f.mouse = pos
+}
+
+func (f *FakeInput) Scroll(delta pixel.Vec) {
+    f.scroll = f.scroll.Add(delta)
+}
+
+func (f *FakeInput) Type(text string) {
+    f.typed += text
+}
+
+func (f *FakeInput) SetFocused(focused bool) {
+    f.unfocused = !focused
+}
+
+func (f *FakeInput) SetMouseInside(inside bool) {
+    f.outside = !inside
+}
+
+// plugs in a pad called name, with its triggers at rest
+func (f *FakeInput) ConnectPad(js pixelgl.Joystick, name string) {
+    f.pads[js] = fakePad{present: true, name: name}
+    f.pads[js].axes[pixelgl.AxisLeftTrigger] = -1
+    f.pads[js].axes[pixelgl.AxisRightTrigger] = -1
+}
+
+func (f *FakeInput) DisconnectPad(js pixelgl.Joystick) {
+    previous := f.pads[js].previous
+    f.pads[js] = fakePad{previous: previous}
+}
+
+func (f *FakeInput) PressPad(js pixelgl.Joystick, buttons ...pixelgl.GamepadButton) {
+    for _, b := range buttons {
+        f.pads[js].pressed[b] = true
+    }
+}
+
+func (f *FakeInput) ReleasePad(js pixelgl.Joystick, buttons ...pixelgl.GamepadButton) {
+    for _, b := range buttons {
+        f.pads[js].pressed[b] = false
+    }
+}
+
+// sets an axis, -1 to 1 like GLFW reports them
+func (f *FakeInput) SetAxis(js pixelgl.Joystick, axis pixelgl.GamepadAxis, v float64) {
+    f.pads[js].axes[axis] = v
+}
+
+// ends the frame: what's pressed now is what JustPressed compares against next frame
+func (f *FakeInput) Update() {
+    f.previous = f.pressed
+    f.repeated = [pixelgl.KeyLast + 1]bool{}
+    f.prevMouse = f.mouse
+    f.scroll = pixel.ZV
+    f.typed = ""
+    for js := range f.pads {
+        f.pads[js].previous = f.pads[js].pressed
+    }
+}
+
+func (f *FakeInput) Pressed(b pixelgl.Button) bool      { return f.pressed[b] }
+func (f *FakeInput) JustPressed(b pixelgl.Button) bool  { return f.pressed[b] && !f.previous[b] }
+func (f *FakeInput) JustReleased(b pixelgl.Button) bool { return !f.pressed[b] && f.previous[b] }
+func (f *FakeInput) Repeated(b pixelgl.Button) bool     { return f.repeated[b] }
+func (f *FakeInput) MousePosition() pixel.Vec           { return f.mouse }
+func (f *FakeInput) MousePreviousPosition() pixel.Vec   { return f.prevMouse }
+func (f *FakeInput) MouseInsideWindow() bool            { return !f.outside }
+func (f *FakeInput) MouseScroll() pixel.Vec             { return f.scroll }
+func (f *FakeInput) Typed() string                      { return f.typed }
+func (f *FakeInput) Focused() bool                      { return !f.unfocused }
+func (f *FakeInput) Bounds() pixel.Rect                 { return f.Window }
+
+func (f *FakeInput) JoystickPresent(js pixelgl.Joystick) bool { return f.pads[js].present }
+func (f *FakeInput) JoystickName(js pixelgl.Joystick) string  { return f.pads[js].name }
+
+func (f *FakeInput) JoystickPressed(js pixelgl.Joystick, b pixelgl.GamepadButton) bool {
+    return f.pads[js].pressed[b]
+}
+
+func (f *FakeInput) JoystickJustPressed(js pixelgl.Joystick, b pixelgl.GamepadButton) bool {
+    return f.pads[js].pressed[b] && !f.pads[js].previous[b]
+}
+
+func (f *FakeInput) JoystickJustReleased(js pixelgl.Joystick, b pixelgl.GamepadButton) bool {
+    return !f.pads[js].pressed[b] && f.pads[js].previous[b]
+}
+
+func (f *FakeInput) JoystickAxis(js pixelgl.Joystick, axis pixelgl.GamepadAxis) float64 {
+    return f.pads[js].axes[axis]
+}
+
+// a render target that throws everything away but counts it, so draw code runs without a GPU
+// and a check can still see that something was drawn
+type NullTarget struct {
+    // draw calls and vertices since the last Reset
+    Draws, Vertices int
+}
+
+func NewNullTarget() *NullTarget {
+    return &NullTarget{}
+}
+
+func (t *NullTarget) Reset() {
+    t.Draws, t.Vertices = 0, 0
+}
+
+func (t *NullTarget) MakeTriangles(tri pixel.Triangles) pixel.TargetTriangles {
+    return &nullTriangles{target: t, len: tri.Len()}
+}
+
+func (t *NullTarget) MakePicture(pic pixel.Picture) pixel.TargetPicture {
+    return &nullPicture{target: t, bounds: pic.Bounds()}
+}
+
+func (t *NullTarget) SetMatrix(m pixel.Matrix)                 {}
+func (t *NullTarget) SetColorMask(c color.Color)               {}
+func (t *NullTarget) SetComposeMethod(cmp pixel.ComposeMethod) {}
+func (t *NullTarget) Clear(c color.Color)                      {}
+
+func (t *NullTarget) draw(tri pixel.TargetTriangles) {
+    t.Draws++
+    t.Vertices += tri.Len()
+}
+
+type nullTriangles struct {
+    target *NullTarget
+    len    int
+}
+
+func (t *nullTriangles) Len() int                       { return t.len }
+func (t *nullTriangles) SetLen(n int)                   { t.len = n }
+func (t *nullTriangles) Slice(i, j int) pixel.Triangles { return &nullTriangles{t.target, j - i} }
+func (t *nullTriangles) Update(tri pixel.Triangles)     {}
+func (t *nullTriangles) Copy() pixel.Triangles          { return &nullTriangles{t.target, t.len} }
+func (t *nullTriangles) Draw()                          { t.target.draw(t) }
+
+type nullPicture struct {
+    target *NullTarget
+    bounds pixel.Rect
+}
+
+func (p *nullPicture) Bounds() pixel.Rect             { return p.bounds }
+func (p *nullPicture) Draw(tri pixel.TargetTriangles) { p.target.draw(tri) }
+
+var _ ComposeTarget = (*NullTarget)(nil)
+
+// the seed NewHeadless starts the RNG from, so every headless run draws the same numbers
+const HEADLESSSEED = 1
+
+// runs the game loop with no window: FakeInput in, NullTarget out and a fixed Delta per frame,
+// so game logic can be driven from go test or CI without a display. it shares simulate and
+// render with Run, and switches graphics to NullBackend so transitions, lighting and the post
+// processor make canvases that draw nothing rather than needing a GL context. Close puts the
+// previous backend back.
+type Headless struct {
+    Input  *FakeInput
+    Target *NullTarget
+    // real seconds per frame
+    Delta float64
+
+    game Game
+    // graphics from before NewHeadless, for Close
+    backend RenderBackend
+}
+
+// stands in when Headless is only driving the services and scenes
+type noGame struct{}
+
+func (noGame) Init(ctx *Context) error { return nil }
+func (noGame) Update(dt float64)       {}
+func (noGame) Draw(t RenderTarget)     {}
+
+// sets up the services Run would, sized to the virtual screen, and initialises game, which can
+// be nil to exercise scenes and systems on their own. timers, queued events, pause, the clock and
+// the RNG start over too, so one run doesn't leak into the next. there's no loading screen, so
+// load what the game needs into resources before calling it.
+func NewHeadless(game Game) (*Headless, error) {
+    if game == nil {
+        game = noGame{}
+    }
+    backend := graphics
+    graphics = NullBackend{}
+    settings = LoadSettings("", DefaultSettings())
+    actions = NewActions(settings.Keys, settings.Pad)
+    gamepads = NewGamepads()
+    mouse = NewMouse()
+    drops = NewFileDrops()
+    shortcuts = NewShortcuts()
+    zoom = NewZoomInput()
+    onscreen = NewVirtualControls()
+    collision = NewCollisions()
+    physics = NewPhysics()
+    paths = NewPathfinder()
+    behaviors = NewBehaviors()
+    audio = NewAudio()
+    tweens = NewTweener()
+    scheduler = NewScheduler()
+    events = NewEventBus()
+    pause = NewPause()
+    clock = NewTime()
+    loop = NewFixedLoop(TICKRATE)
+    console = NewConsole()
+    SeedRandom(HEADLESSSEED)
+    bounds := screen.Bounds()
+    camera = NewCamera(bounds)
+    renderer = NewRenderer(camera)
+    scenes = NewSceneManager(renderer, bounds)
+    h := &Headless{
+        Input:   NewFakeInput(bounds),
+        Target:  NewNullTarget(),
+        Delta:   1.0 / TICKRATE,
+        game:    game,
+        backend: backend,
+    }
+    if err := game.Init(newContext(h.Input)); err != nil {
+        h.Close()
+        return nil, fmt.Errorf("init: %v", err)
+    }
+    return h, nil
+}
+
+// restores the render backend NewHeadless replaced, so canvases made afterwards, like a golden
+// check's, draw for real again
+func (h *Headless) Close() {
+    if h.backend != nil {
+        graphics = h.backend
+        h.backend = nil
+    }
+}
+
+// runs one frame; Target holds what it drew until the next one
+func (h *Headless) Step() {
+    clock.Advance(h.Delta)
+    screen.Update(h.Input.Bounds())
+    simulate(h.Input, clock.Delta(), h.game)
+    h.Target.Reset()
+    render(h.Target, h.game)
+    profiler.EndFrame()
+    h.Input.Update()
+}
+
+func (h *Headless) Run(frames int) {
+    for i := 0; i < frames; i++ {
+        h.Step()
+    }
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+    "math"
+    "testing"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// walks right while "right" is held and draws itself every frame
+type walker struct {
+    x       float64
+    updates int
+    imd     *imdraw.IMDraw
+}
+
+const WALKSPEED = 120
+
+func (w *walker) Init(ctx *Context) error {
+    w.imd = imdraw.New(nil)
+    return nil
+}
+
+func (w *walker) Update(dt float64) {
+    w.updates++
+    if actions.Pressed("right") {
+        w.x += WALKSPEED * dt
+    }
+}
+
+func (w *walker) Draw(t RenderTarget) {
+    w.imd.Clear()
+    w.imd.Push(pixel.V(w.x, 0), pixel.V(w.x+8, 8))
+    w.imd.Rectangle(0)
+    w.imd.Draw(t)
+}
+
+func newTestHeadless(t *testing.T, game Game) *Headless {
+    t.Helper()
+    h, err := NewHeadless(game)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(h.Close)
+    return h
+}
+
+func TestHeadlessStep(t *testing.T) {
+    w := &walker{}
+    h := newTestHeadless(t, w)
+
+    h.Run(TICKRATE)
+    if w.updates != TICKRATE {
+        t.Errorf("%d updates in a second, want %d", w.updates, TICKRATE)
+    }
+    if w.x != 0 {
+        t.Errorf("moved to %v without input", w.x)
+    }
+    if h.Target.Draws == 0 {
+        t.Error("nothing drawn")
+    }
+
+    h.Input.Press(pixelgl.KeyRight)
+    h.Run(TICKRATE)
+    h.Input.Release(pixelgl.KeyRight)
+    h.Run(TICKRATE)
+    if math.Abs(w.x-WALKSPEED) > 1e-6 {
+        t.Errorf("walked to %v after a second held, want %v", w.x, WALKSPEED)
+    }
+}
+
+func TestHeadlessStartsClean(t *testing.T) {
+    first := newTestHeadless(t, nil)
+    roll := random.Int63()
+    pause.Pause()
+    tweens.Add(Wait(10))
+    scheduler.After(10, func() {})
+    delivered := 0
+    events.Subscribe(func(e StatEvent) { delivered++ })
+    events.Publish(StatEvent{})
+    first.Step()
+    first.Close()
+    seen := delivered
+
+    h := newTestHeadless(t, nil)
+    if pause.Paused() {
+        t.Error("still paused from the last run")
+    }
+    if tweens.Len() != 0 || scheduler.Len() != 0 {
+        t.Errorf("%d tweens and %d tasks left over", tweens.Len(), scheduler.Len())
+    }
+    events.Publish(StatEvent{})
+    h.Step()
+    if delivered != seen {
+        t.Errorf("the last run's subscriber got %d more events", delivered-seen)
+    }
+    if got := random.Int63(); got != roll {
+        t.Errorf("first roll %d, the last run's was %d", got, roll)
+    }
+}
+
+func TestHeadlessClose(t *testing.T) {
+    before := graphics
+    h := newTestHeadless(t, nil)
+    if graphics.Name() != "null" {
+        t.Fatalf("headless draws with %s", graphics.Name())
+    }
+    h.Close()
+    if graphics != before {
+        t.Errorf("graphics is %s after Close, was %s", graphics.Name(), before.Name())
+    }
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+    "fmt"
+
+    "github.com/faiface/pixel"
+)
+
+// the point of its parent a HUD element sits against
+type Anchor int
+
+const (
+    AnchorTopLeft Anchor = iota
+    AnchorTop
+    AnchorTopRight
+    AnchorLeft
+    AnchorCenter
+    AnchorRight
+    AnchorBottomLeft
+    AnchorBottom
+    AnchorBottomRight
+)
+
+// how far across and up the parent the anchor is, 0 to 1
+func (a Anchor) point() pixel.Vec {
+    x := [3]float64{0, 0.5, 1}[int(a)%3]
+    y := [3]float64{1, 0.5, 0}[int(a)/3]
+    return pixel.V(x, y)
+}
+
+// a width or height in virtual pixels plus a percentage of the parent's, e.g. Percent(100) for
+// the full width or HUDSize{Pixels: -16, Percent: 50} for half of it less a gutter
+type HUDSize struct {
+    Pixels, Percent float64
+}
+
+func Pixels(n float64) HUDSize {
+    return HUDSize{Pixels: n}
+}
+
+func Percent(p float64) HUDSize {
+    return HUDSize{Percent: p}
+}
+
+func (s HUDSize) of(length float64) float64 {
+    return s.Pixels + s.Percent/100*length
+}
+
+// a box on the HUD, placed against its parent's edges so it stays where it belongs at any
+// resolution: a health bar pinned top-left, a minimap top-right, a prompt centered at the bottom
+type HUDElement struct {
+    Anchor        Anchor
+    Width, Height HUDSize
+    // how far in from the edges it's anchored to; the middle anchors shift by it instead
+    Margin pixel.Vec
+    // the element it's laid out inside, by name; "" for the whole HUD
+    Parent string
+}
+
+// named HUDElements laid out over the virtual screen. Rect gives an element's place, working it
+// out again whenever the screen's size has changed, so a HUD drawn from it follows the window in
+// ScaleResize and changes of virtual resolution without any bookkeeping, e.g.
+//
+//	hud.Add("health", HUDElement{Anchor: AnchorTopLeft, Width: Pixels(120), Height: Pixels(12), Margin: pixel.V(8, 8)})
+//	bar := hud.Rect("health")
+//
+// an element's rect also works as a UI's Bounds.
+type HUD struct {
+    // the area it's laid out in; the zero rect follows the virtual screen
+    Bounds pixel.Rect
+
+    elements map[string]HUDElement
+    rects    map[string]pixel.Rect
+    // what the rects were laid out in; zero when something's changed since
+    laidOut pixel.Rect
+}
+
+func NewHUD() *HUD {
+    return &HUD{elements: map[string]HUDElement{}, rects: map[string]pixel.Rect{}}
+}
+
+// adds the element called name, or changes it. its parent has to be added first, and can't be
+// inside it.
+func (h *HUD) Add(name string, e HUDElement) error {
+    if e.Parent != "" {
+        if _, ok := h.elements[e.Parent]; !ok {
+            return fmt.Errorf("hud: %s's parent %q hasn't been added", name, e.Parent)
+        }
+    }
+    for p := e.Parent; p != ""; p = h.elements[p].Parent {
+        if p == name {
+            return fmt.Errorf("hud: %s would be inside itself", name)
+        }
+    }
+    h.elements[name] = e
+    h.laidOut = pixel.Rect{}
+    return nil
+}
+
+// removes the element called name; elements inside it are laid out in the whole HUD after
+func (h *HUD) Remove(name string) {
+    delete(h.elements, name)
+    h.laidOut = pixel.Rect{}
+}
+
+func (h *HUD) bounds() pixel.Rect {
+    if h.Bounds == (pixel.Rect{}) {
+        return screen.Bounds()
+    }
+    return h.Bounds
+}
+
+// where the element called name is on the virtual screen, or the zero rect when there's none
+func (h *HUD) Rect(name string) pixel.Rect {
+    if bounds := h.bounds(); bounds != h.laidOut {
+        h.Layout(bounds)
+    }
+    return h.rects[name]
+}
+
+// places every element in bounds
+func (h *HUD) Layout(bounds pixel.Rect) {
+    for name := range h.rects {
+        delete(h.rects, name)
+    }
+    for name := range h.elements {
+        h.place(name, bounds)
+    }
+    h.laidOut = bounds
+}
+
+// lays out name's parents before it
+func (h *HUD) place(name string, bounds pixel.Rect) pixel.Rect {
+    if r, ok := h.rects[name]; ok {
+        return r
+    }
+    e := h.elements[name]
+    parent := bounds
+    if _, ok := h.elements[e.Parent]; ok {
+        parent = h.place(e.Parent, bounds)
+    }
+    size := pixel.V(e.Width.of(parent.W()), e.Height.of(parent.H()))
+    at := e.Anchor.point()
+    // in from the edge it's against, and shifted along an axis it's centered on
+    inward := pixel.V(1, 1)
+    if at.X == 1 {
+        inward.X = -1
+    }
+    if at.Y == 1 {
+        inward.Y = -1
+    }
+    min := pixel.V(
+        parent.Min.X+at.X*(parent.W()-size.X)+inward.X*e.Margin.X,
+        parent.Min.Y+at.Y*(parent.H()-size.Y)+inward.Y*e.Margin.Y,
+    )
+    r := pixel.Rect{Min: min, Max: min.Add(size)}
+    h.rects[name] = r
+    return r
+}
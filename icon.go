@@ -0,0 +1,45 @@
+package main
+
+import (
+    "image"
+
+    "github.com/faiface/pixel"
+    "golang.org/x/image/draw"
+)
+
+// sizes the desktop environments pick from for taskbars, alt-tab and title bars
+var ICONSIZES = []int{16, 32, 64, 128}
+
+// downscales a single high resolution icon into each of sizes (ICONSIZES when none are given).
+// the source itself comes first; sizes bigger than it are skipped rather than blown up.
+func IconSet(pic pixel.Picture, sizes ...int) []pixel.Picture {
+    pd, ok := pic.(*pixel.PictureData)
+    if !ok {
+        pd = pixel.PictureDataFromPicture(pic)
+    }
+    if len(sizes) == 0 {
+        sizes = ICONSIZES
+    }
+
+    src := pd.Image()
+    bounds := src.Bounds()
+    icons := []pixel.Picture{pd}
+    for _, size := range sizes {
+        if size >= bounds.Dx() || size >= bounds.Dy() {
+            continue
+        }
+        dst := image.NewRGBA(image.Rect(0, 0, size, size))
+        // Catmull-Rom keeps the small sizes sharp without the aliasing of nearest neighbour
+        draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+        icons = append(icons, pixel.PictureDataFromImage(dst))
+    }
+    return icons
+}
+
+func LoadIconSet(path string, sizes ...int) ([]pixel.Picture, error) {
+    pic, err := LoadPicture(path)
+    if err != nil {
+        return nil, err
+    }
+    return IconSet(pic, sizes...), nil
+}
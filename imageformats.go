@@ -0,0 +1,37 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "image"
+    "io"
+
+    // decoders registered with image.Decode, so LoadPicture accepts any of them
+    _ "image/gif"
+    _ "image/jpeg"
+    _ "image/png"
+
+    _ "golang.org/x/image/bmp"
+    _ "golang.org/x/image/tiff"
+    _ "golang.org/x/image/webp"
+)
+
+var errUnknownImageFormat = errors.New("unknown image format")
+
+// sniffs the format of an encoded image from its header, e.g. "png", "jpeg", "gif" or "bmp".
+// the returned reader replays the sniffed bytes so the image can still be decoded from it.
+func DetectImageFormat(r io.Reader) (string, io.Reader, error) {
+    buffered := bufio.NewReader(r)
+    header, err := buffered.Peek(32)
+    if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+        return "", buffered, err
+    }
+
+    // only the magic number matters here, so a config error from the truncated header is fine
+    _, format, err := image.DecodeConfig(bytes.NewReader(header))
+    if err == image.ErrFormat {
+        return "", buffered, errUnknownImageFormat
+    }
+    return format, buffered, nil
+}
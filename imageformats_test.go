@@ -0,0 +1,56 @@
+package main
+
+import (
+    "bytes"
+    "image"
+    "image/color"
+    "image/gif"
+    "image/jpeg"
+    "image/png"
+    "io"
+    "testing"
+
+    "golang.org/x/image/bmp"
+    "golang.org/x/image/tiff"
+)
+
+func TestDetectImageFormat(t *testing.T) {
+    img := image.NewRGBA(image.Rect(0, 0, 5, 3))
+    for x := 0; x < 5; x++ {
+        img.Set(x, 1, color.RGBA{R: 255, A: 255})
+    }
+    encoders := map[string]func(w io.Writer) error{
+        "png":  func(w io.Writer) error { return png.Encode(w, img) },
+        "jpeg": func(w io.Writer) error { return jpeg.Encode(w, img, nil) },
+        "gif":  func(w io.Writer) error { return gif.Encode(w, img, nil) },
+        "bmp":  func(w io.Writer) error { return bmp.Encode(w, img) },
+        "tiff": func(w io.Writer) error { return tiff.Encode(w, img, nil) },
+    }
+    for want, encode := range encoders {
+        var buf bytes.Buffer
+        if err := encode(&buf); err != nil {
+            t.Fatalf("%s: %v", want, err)
+        }
+        format, r, err := DetectImageFormat(&buf)
+        if err != nil || format != want {
+            t.Errorf("%s detected as %q, %v", want, format, err)
+            continue
+        }
+        decoded, _, err := image.Decode(r)
+        if err != nil {
+            t.Errorf("%s: decoding after detecting: %v", want, err)
+            continue
+        }
+        if decoded.Bounds() != img.Bounds() {
+            t.Errorf("%s decoded to %v, want %v", want, decoded.Bounds(), img.Bounds())
+        }
+    }
+}
+
+func TestDetectImageFormatUnknown(t *testing.T) {
+    for _, data := range []string{"this is not an image, just some text that runs on", "short", ""} {
+        if _, _, err := DetectImageFormat(bytes.NewReader([]byte(data))); err != errUnknownImageFormat {
+            t.Errorf("%q: error %v, want %v", data, err, errUnknownImageFormat)
+        }
+    }
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// the input a frame reads, so game code doesn't need a real window; *pixelgl.Window satisfies it
+// and FakeInput stands in for it in headless runs
+type Input interface {
+    Pressed(button pixelgl.Button) bool
+    JustPressed(button pixelgl.Button) bool
+    JustReleased(button pixelgl.Button) bool
+    Repeated(button pixelgl.Button) bool
+    MousePosition() pixel.Vec
+    MousePreviousPosition() pixel.Vec
+    MouseInsideWindow() bool
+    MouseScroll() pixel.Vec
+    Typed() string
+    Focused() bool
+    Bounds() pixel.Rect
+
+    JoystickPresent(js pixelgl.Joystick) bool
+    JoystickName(js pixelgl.Joystick) string
+    JoystickPressed(js pixelgl.Joystick, button pixelgl.GamepadButton) bool
+    JoystickJustPressed(js pixelgl.Joystick, button pixelgl.GamepadButton) bool
+    JoystickJustReleased(js pixelgl.Joystick, button pixelgl.GamepadButton) bool
+    JoystickAxis(js pixelgl.Joystick, axis pixelgl.GamepadAxis) float64
+}
+
+var _ Input = (*pixelgl.Window)(nil)
@@ -0,0 +1,304 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+type inputStep struct {
+    // which line of a parsed script it came from, for errors; 0 when built in code
+    line int
+    run  func(h *Headless) error
+}
+
+// a timeline of input for a Headless run, so a test can say "hold right for 2s, then jump" and
+// check the game state after: NewInputScript().Hold(2, pixelgl.KeyRight).TapAction("jump"). steps
+// run in order; presses land on the next frame, and waits step the game in Headless.Delta frames.
+type InputScript struct {
+    steps []inputStep
+}
+
+func NewInputScript() *InputScript {
+    return &InputScript{}
+}
+
+func (s *InputScript) add(run func(h *Headless) error) *InputScript {
+    s.steps = append(s.steps, inputStep{run: run})
+    return s
+}
+
+// holds buttons down until Release
+func (s *InputScript) Press(buttons ...pixelgl.Button) *InputScript {
+    return s.add(func(h *Headless) error {
+        h.Input.Press(buttons...)
+        return nil
+    })
+}
+
+func (s *InputScript) Release(buttons ...pixelgl.Button) *InputScript {
+    return s.add(func(h *Headless) error {
+        h.Input.Release(buttons...)
+        return nil
+    })
+}
+
+// steps the game for seconds
+func (s *InputScript) Wait(seconds float64) *InputScript {
+    return s.add(func(h *Headless) error {
+        h.Run(scriptFrames(seconds, h.Delta))
+        return nil
+    })
+}
+
+// presses buttons, waits seconds and lets go
+func (s *InputScript) Hold(seconds float64, buttons ...pixelgl.Button) *InputScript {
+    return s.Press(buttons...).Wait(seconds).Release(buttons...)
+}
+
+// presses buttons for a single frame
+func (s *InputScript) Tap(buttons ...pixelgl.Button) *InputScript {
+    return s.Press(buttons...).add(func(h *Headless) error {
+        h.Step()
+        return nil
+    }).Release(buttons...)
+}
+
+// the first button action is bound to when the step runs, so scripts follow rebinding
+func actionButton(action string) (pixelgl.Button, error) {
+    buttons := actions.Bindings[action]
+    if len(buttons) == 0 {
+        return 0, fmt.Errorf("action %q has no buttons", action)
+    }
+    return buttons[0], nil
+}
+
+// holds action's first button for seconds
+func (s *InputScript) HoldAction(seconds float64, action string) *InputScript {
+    return s.add(func(h *Headless) error {
+        b, err := actionButton(action)
+        if err != nil {
+            return err
+        }
+        h.Input.Press(b)
+        h.Run(scriptFrames(seconds, h.Delta))
+        h.Input.Release(b)
+        return nil
+    })
+}
+
+func (s *InputScript) TapAction(action string) *InputScript {
+    return s.add(func(h *Headless) error {
+        b, err := actionButton(action)
+        if err != nil {
+            return err
+        }
+        h.Input.Press(b)
+        h.Step()
+        h.Input.Release(b)
+        return nil
+    })
+}
+
+// moves the mouse to pos in window coordinates
+func (s *InputScript) MoveMouse(pos pixel.Vec) *InputScript {
+    return s.add(func(h *Headless) error {
+        h.Input.MoveMouse(pos)
+        return nil
+    })
+}
+
+// moves the mouse to pos and clicks the left button there for a frame
+func (s *InputScript) Click(pos pixel.Vec) *InputScript {
+    return s.MoveMouse(pos).Tap(pixelgl.MouseButtonLeft)
+}
+
+func (s *InputScript) Type(text string) *InputScript {
+    return s.add(func(h *Headless) error {
+        h.Input.Type(text)
+        return nil
+    })
+}
+
+// runs fn between frames, e.g. to check state midway; its error stops the script
+func (s *InputScript) Do(fn func() error) *InputScript {
+    return s.add(func(h *Headless) error {
+        return fn()
+    })
+}
+
+// steps the game until cond holds, failing the script if it doesn't within timeout seconds
+func (s *InputScript) Until(cond func() bool, timeout float64) *InputScript {
+    return s.add(func(h *Headless) error {
+        for frames := scriptFrames(timeout, h.Delta); !cond(); frames-- {
+            if frames <= 0 {
+                return fmt.Errorf("condition not met within %gs", timeout)
+            }
+            h.Step()
+        }
+        return nil
+    })
+}
+
+// frames of delta seconds it takes to cover seconds
+func scriptFrames(seconds, delta float64) int {
+    return int(math.Ceil(seconds/delta - 1e-9))
+}
+
+// runs the script's steps through h in order, stopping at the first error
+func (h *Headless) RunScript(s *InputScript) error {
+    for i, step := range s.steps {
+        if err := step.run(h); err != nil {
+            if step.line > 0 {
+                return fmt.Errorf("input script line %d: %v", step.line, err)
+            }
+            return fmt.Errorf("input script step %d: %v", i+1, err)
+        }
+    }
+    return nil
+}
+
+// reads a script in the text form, one step per line with # comments, for fixtures kept next to
+// the tests:
+//
+//	hold 2 Right
+//	tap Space
+//	wait 0.5
+//	action 0.2 jump
+//	tapaction jump
+//	press LeftShift
+//	release LeftShift
+//	mouse 100 200
+//	click 100 200
+//	type hello world
+func ParseInputScript(src string) (*InputScript, error) {
+    s := NewInputScript()
+    scanner := bufio.NewScanner(strings.NewReader(src))
+    for line := 1; scanner.Scan(); line++ {
+        text := scanner.Text()
+        if i := strings.Index(text, "#"); i >= 0 {
+            text = text[:i]
+        }
+        fields := strings.Fields(text)
+        if len(fields) == 0 {
+            continue
+        }
+        before := len(s.steps)
+        if err := s.parseStep(fields, text); err != nil {
+            return nil, fmt.Errorf("input script line %d: %v", line, err)
+        }
+        for i := before; i < len(s.steps); i++ {
+            s.steps[i].line = line
+        }
+    }
+    return s, nil
+}
+
+func (s *InputScript) parseStep(fields []string, text string) error {
+    buttons := func(names []string) ([]pixelgl.Button, error) {
+        if len(names) == 0 {
+            return nil, fmt.Errorf("%s needs a button", fields[0])
+        }
+        var bs []pixelgl.Button
+        for _, name := range names {
+            b, ok := ParseButton(name)
+            if !ok {
+                return nil, fmt.Errorf("unknown button %q", name)
+            }
+            bs = append(bs, b)
+        }
+        return bs, nil
+    }
+    number := func(i int) (float64, error) {
+        if i >= len(fields) {
+            return 0, fmt.Errorf("%s needs a number", fields[0])
+        }
+        v, err := strconv.ParseFloat(strings.TrimSuffix(fields[i], "s"), 64)
+        if err != nil {
+            return 0, fmt.Errorf("%s: %q isn't a number", fields[0], fields[i])
+        }
+        return v, nil
+    }
+    switch fields[0] {
+    case "press", "release", "tap":
+        bs, err := buttons(fields[1:])
+        if err != nil {
+            return err
+        }
+        switch fields[0] {
+        case "press":
+            s.Press(bs...)
+        case "release":
+            s.Release(bs...)
+        default:
+            s.Tap(bs...)
+        }
+    case "hold":
+        seconds, err := number(1)
+        if err != nil {
+            return err
+        }
+        bs, err := buttons(fields[2:])
+        if err != nil {
+            return err
+        }
+        s.Hold(seconds, bs...)
+    case "wait":
+        seconds, err := number(1)
+        if err != nil {
+            return err
+        }
+        s.Wait(seconds)
+    case "action":
+        seconds, err := number(1)
+        if err != nil {
+            return err
+        }
+        if len(fields) != 3 {
+            return fmt.Errorf("usage: action <seconds> <name>")
+        }
+        s.HoldAction(seconds, fields[2])
+    case "tapaction":
+        if len(fields) != 2 {
+            return fmt.Errorf("usage: tapaction <name>")
+        }
+        s.TapAction(fields[1])
+    case "mouse", "click":
+        x, err := number(1)
+        if err != nil {
+            return err
+        }
+        y, err := number(2)
+        if err != nil {
+            return err
+        }
+        if fields[0] == "mouse" {
+            s.MoveMouse(pixel.V(x, y))
+        } else {
+            s.Click(pixel.V(x, y))
+        }
+    case "type":
+        s.Type(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "type")))
+    default:
+        return fmt.Errorf("unknown step %q", fields[0])
+    }
+    return nil
+}
+
+// reads a text script from the asset filesystem
+func LoadInputScript(path string) (*InputScript, error) {
+    data, err := ReadAsset(path)
+    if err != nil {
+        return nil, err
+    }
+    s, err := ParseInputScript(string(data))
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    return s, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+    "io/ioutil"
+    "math"
+    "strings"
+    "testing"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// runs with "right" held and jumps on "jump", remembering where
+type runner struct {
+    in      Input
+    x       float64
+    jumps   []float64
+    updates int
+    // every frame's raw input, for checking what a step did
+    held, tapped map[pixelgl.Button]int
+    typed        string
+}
+
+const RUNSPEED = 100
+
+func (r *runner) Init(ctx *Context) error {
+    r.in = ctx.Input
+    r.held, r.tapped = map[pixelgl.Button]int{}, map[pixelgl.Button]int{}
+    ctx.Actions.Bindings["jump"] = []pixelgl.Button{pixelgl.KeySpace}
+    return nil
+}
+
+func (r *runner) Update(dt float64) {
+    r.updates++
+    if actions.Pressed("right") {
+        r.x += RUNSPEED * dt
+    }
+    if actions.JustPressed("jump") {
+        r.jumps = append(r.jumps, r.x)
+    }
+    for _, b := range []pixelgl.Button{pixelgl.KeyRight, pixelgl.KeySpace, pixelgl.KeyLeftShift, pixelgl.KeyEnter, pixelgl.MouseButtonLeft} {
+        if r.in.Pressed(b) {
+            r.held[b]++
+        }
+        if r.in.JustPressed(b) {
+            r.tapped[b]++
+        }
+    }
+    r.typed += r.in.Typed()
+}
+
+func (r *runner) Draw(t RenderTarget) {}
+
+func runScript(t *testing.T, s *InputScript) (*Headless, *runner) {
+    t.Helper()
+    r := &runner{}
+    h := newTestHeadless(t, r)
+    if err := h.RunScript(s); err != nil {
+        t.Fatal(err)
+    }
+    return h, r
+}
+
+func checkRanAndJumped(t *testing.T, r *runner) {
+    t.Helper()
+    if math.Abs(r.x-2*RUNSPEED) > 1e-6 {
+        t.Errorf("ran to %v, want %v after 2s", r.x, 2*RUNSPEED)
+    }
+    if len(r.jumps) != 1 || math.Abs(r.jumps[0]-2*RUNSPEED) > 1e-6 {
+        t.Errorf("jumped at %v, want once at the end of the run", r.jumps)
+    }
+}
+
+func TestInputScriptRunThenJump(t *testing.T) {
+    _, r := runScript(t, NewInputScript().Hold(2, pixelgl.KeyRight).TapAction("jump"))
+    checkRanAndJumped(t, r)
+    if r.updates != 2*TICKRATE+1 {
+        t.Errorf("%d updates, want %d", r.updates, 2*TICKRATE+1)
+    }
+}
+
+func TestInputScriptFixture(t *testing.T) {
+    src, err := ioutil.ReadFile("testdata/run_and_jump.input")
+    if err != nil {
+        t.Fatal(err)
+    }
+    s, err := ParseInputScript(string(src))
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, r := runScript(t, s)
+    checkRanAndJumped(t, r)
+    if r.updates != 2*TICKRATE+1+TICKRATE/2 {
+        t.Errorf("%d updates, want %d", r.updates, 2*TICKRATE+1+TICKRATE/2)
+    }
+}
+
+func TestParseInputScriptSteps(t *testing.T) {
+    tests := []struct {
+        src   string
+        check func(h *Headless, r *runner) bool
+    }{
+        {"press LeftShift\nwait 0.1", func(h *Headless, r *runner) bool {
+            return h.Input.Pressed(pixelgl.KeyLeftShift) && r.held[pixelgl.KeyLeftShift] == 6
+        }},
+        {"press LeftShift\nrelease LeftShift\nwait 0.1", func(h *Headless, r *runner) bool {
+            return !h.Input.Pressed(pixelgl.KeyLeftShift) && r.held[pixelgl.KeyLeftShift] == 0
+        }},
+        {"tap Space Enter", func(h *Headless, r *runner) bool {
+            return r.updates == 1 && r.tapped[pixelgl.KeySpace] == 1 && r.tapped[pixelgl.KeyEnter] == 1 && !h.Input.Pressed(pixelgl.KeySpace)
+        }},
+        {"hold 0.5s Right", func(h *Headless, r *runner) bool {
+            return r.held[pixelgl.KeyRight] == TICKRATE/2 && !h.Input.Pressed(pixelgl.KeyRight)
+        }},
+        {"wait 0.25", func(h *Headless, r *runner) bool {
+            return r.updates == 15
+        }},
+        {"action 1 right", func(h *Headless, r *runner) bool {
+            return math.Abs(r.x-RUNSPEED) < 1e-6 && !h.Input.Pressed(pixelgl.KeyD)
+        }},
+        {"tapaction jump", func(h *Headless, r *runner) bool {
+            return len(r.jumps) == 1 && r.updates == 1
+        }},
+        {"mouse 100 200", func(h *Headless, r *runner) bool {
+            return h.Input.MousePosition() == pixel.V(100, 200) && r.updates == 0
+        }},
+        {"click 10 20", func(h *Headless, r *runner) bool {
+            return h.Input.MousePosition() == pixel.V(10, 20) && r.tapped[pixelgl.MouseButtonLeft] == 1
+        }},
+        {"type hello world  # a comment\nwait 0.1", func(h *Headless, r *runner) bool {
+            return r.typed == "hello world"
+        }},
+    }
+    for _, test := range tests {
+        s, err := ParseInputScript(test.src)
+        if err != nil {
+            t.Errorf("%q: %v", test.src, err)
+            continue
+        }
+        h, r := runScript(t, s)
+        if !test.check(h, r) {
+            t.Errorf("%q: didn't do what it says, got %+v", test.src, r)
+        }
+    }
+}
+
+func TestParseInputScriptErrors(t *testing.T) {
+    tests := []struct{ src, err string }{
+        {"wait 1\n\n# nothing\nhold x Right", `input script line 4: hold: "x" isn't a number`},
+        {"tap Space\njump", `input script line 2: unknown step "jump"`},
+        {"press Nope", `input script line 1: unknown button "Nope"`},
+        {"wait 1\nhold 2", "input script line 2: hold needs a button"},
+        {"mouse 10", "input script line 1: mouse needs a number"},
+        {"action 1", "input script line 1: usage: action <seconds> <name>"},
+        {"tapaction", "input script line 1: usage: tapaction <name>"},
+    }
+    for _, test := range tests {
+        if _, err := ParseInputScript(test.src); err == nil || err.Error() != test.err {
+            t.Errorf("%q: error %v, want %s", test.src, err, test.err)
+        }
+    }
+}
+
+func TestInputScriptRunErrorLine(t *testing.T) {
+    s, err := ParseInputScript("wait 0.1\ntapaction fly")
+    if err != nil {
+        t.Fatal(err)
+    }
+    h := newTestHeadless(t, &runner{})
+    err = h.RunScript(s)
+    if err == nil || !strings.HasPrefix(err.Error(), "input script line 2: ") {
+        t.Errorf("error %v, want one on line 2", err)
+    }
+    err = h.RunScript(NewInputScript().Wait(0.1).TapAction("fly"))
+    if err == nil || !strings.HasPrefix(err.Error(), "input script step 2: ") {
+        t.Errorf("error %v, want one on step 2", err)
+    }
+}
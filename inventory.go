@@ -0,0 +1,301 @@
+package main
+
+import (
+    "fmt"
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// how big an inventory slot is, and the gap between slots, in virtual pixels
+const INVENTORYSLOT = 40
+const INVENTORYGAP = 4
+
+// some of one item in a slot; the zero stack is an empty slot
+type ItemStack struct {
+    // the game's name for the item, e.g. "potion"
+    Item  string `json:"item"`
+    Count int    `json:"count"`
+}
+
+func (s ItemStack) Empty() bool {
+    return s.Item == "" || s.Count <= 0
+}
+
+// what an Inventory asks the game about its items. every hook is optional.
+type ItemHooks struct {
+    // the item's icon; without it the Inventory's Atlas frame named after the item
+    Icon func(item string) *AtlasFrame
+    // how many fit in one slot; 1 when it's nil, so nothing stacks
+    MaxStack func(item string) int
+    // whether item can go in slot, e.g. only armour in the armour slots
+    Accepts func(slot int, item string) bool
+    // runs after the player drags a stack from one slot to another
+    OnMove func(from, to int)
+    // runs when the player right-clicks a full slot, e.g. to drink a potion
+    OnUse func(slot int)
+}
+
+// a grid of item slots the player rearranges by dragging, laid out right and down from Position:
+// dropping a stack on the same item tops it up to MaxStack, anywhere else swaps the two. Slots is
+// the whole state, so saving it saves the inventory.
+type Inventory struct {
+    Columns, Rows int
+    Slots         []ItemStack
+    Hooks         ItemHooks
+    Atlas         *Atlas
+    // the grid's top-left corner, in virtual screen coordinates
+    Position pixel.Vec
+    Style    UIStyle
+    Font     *Font
+    Options  TextOptions
+
+    // the slot being dragged, the one under the mouse, or -1
+    dragging, hover int
+    mouse           pixel.Vec
+
+    imd *imdraw.IMDraw
+}
+
+func NewInventory(columns, rows int) *Inventory {
+    return &Inventory{
+        Columns:  columns,
+        Rows:     rows,
+        Slots:    make([]ItemStack, columns*rows),
+        Style:    DefaultUIStyle(),
+        Options:  TextOptions{Size: FONTSIZE},
+        dragging: -1,
+        hover:    -1,
+        imd:      imdraw.New(nil),
+    }
+}
+
+func (inv *Inventory) maxStack(item string) int {
+    if inv.Hooks.MaxStack == nil {
+        return 1
+    }
+    return int(math.Max(1, float64(inv.Hooks.MaxStack(item))))
+}
+
+func (inv *Inventory) accepts(slot int, item string) bool {
+    return item == "" || inv.Hooks.Accepts == nil || inv.Hooks.Accepts(slot, item)
+}
+
+// puts count of item in, topping up its stacks first and then filling empty slots; what didn't
+// fit is returned
+func (inv *Inventory) Add(item string, count int) int {
+    max := inv.maxStack(item)
+    for pass := 0; pass < 2 && count > 0; pass++ {
+        for i := range inv.Slots {
+            s := &inv.Slots[i]
+            // the first pass only tops up, the second only fills
+            if (pass == 0) == s.Empty() || (!s.Empty() && s.Item != item) || !inv.accepts(i, item) {
+                continue
+            }
+            if s.Empty() {
+                *s = ItemStack{Item: item}
+            }
+            n := int(math.Min(float64(count), float64(max-s.Count)))
+            if n <= 0 {
+                continue
+            }
+            s.Count += n
+            count -= n
+            if count == 0 {
+                break
+            }
+        }
+    }
+    return count
+}
+
+// takes up to count of item out, from the last stacks first, and returns how many it took
+func (inv *Inventory) Remove(item string, count int) int {
+    taken := 0
+    for i := len(inv.Slots) - 1; i >= 0 && taken < count; i-- {
+        s := &inv.Slots[i]
+        if s.Empty() || s.Item != item {
+            continue
+        }
+        n := int(math.Min(float64(count-taken), float64(s.Count)))
+        s.Count -= n
+        taken += n
+        if s.Count == 0 {
+            *s = ItemStack{}
+        }
+    }
+    return taken
+}
+
+// how many of item there are across every slot
+func (inv *Inventory) Count(item string) int {
+    n := 0
+    for _, s := range inv.Slots {
+        if !s.Empty() && s.Item == item {
+            n += s.Count
+        }
+    }
+    return n
+}
+
+// moves the stack in from onto to like a drop would, and says whether anything moved
+func (inv *Inventory) Move(from, to int) bool {
+    return inv.Transfer(from, inv, to)
+}
+
+// moves the stack in slot from onto other's slot to, e.g. from a chest to the player's bag:
+// merging onto the same item as far as it stacks, or else swapping the two if each slot takes
+// the other's item
+func (inv *Inventory) Transfer(from int, other *Inventory, to int) bool {
+    if from < 0 || from >= len(inv.Slots) || to < 0 || to >= len(other.Slots) || (inv == other && from == to) {
+        return false
+    }
+    a, b := &inv.Slots[from], &other.Slots[to]
+    if a.Empty() {
+        return false
+    }
+    if !b.Empty() && b.Item == a.Item {
+        n := int(math.Min(float64(a.Count), float64(other.maxStack(a.Item)-b.Count)))
+        if n <= 0 {
+            return false
+        }
+        b.Count += n
+        a.Count -= n
+        if a.Count == 0 {
+            *a = ItemStack{}
+        }
+        return true
+    }
+    if !other.accepts(to, a.Item) || (!b.Empty() && !inv.accepts(from, b.Item)) {
+        return false
+    }
+    *a, *b = *b, *a
+    return true
+}
+
+// the size of a slot and the gap between slots at the UI scale
+func (inv *Inventory) metrics() (slot, gap float64) {
+    scale := accessibility.UIScale()
+    return INVENTORYSLOT * scale, INVENTORYGAP * scale
+}
+
+// slot i's rect on the screen
+func (inv *Inventory) Rect(i int) pixel.Rect {
+    slot, gap := inv.metrics()
+    col, row := float64(i%inv.Columns), float64(i/inv.Columns)
+    min := pixel.V(inv.Position.X+col*(slot+gap), inv.Position.Y-(row+1)*slot-row*gap)
+    return pixel.Rect{Min: min, Max: min.Add(pixel.V(slot, slot))}
+}
+
+// how much room the grid takes at the UI scale, e.g. for a HUDElement or a panel around it
+func (inv *Inventory) Size() pixel.Vec {
+    slot, gap := inv.metrics()
+    cols, rows := float64(inv.Columns), float64(inv.Rows)
+    return pixel.V(cols*slot+(cols-1)*gap, rows*slot+(rows-1)*gap)
+}
+
+// the slot at pos on the screen, or -1
+func (inv *Inventory) SlotAt(pos pixel.Vec) int {
+    for i := range inv.Slots {
+        if inv.Rect(i).Contains(pos) {
+            return i
+        }
+    }
+    return -1
+}
+
+// the slot under the mouse, e.g. to give it a tooltip, or -1
+func (inv *Inventory) Hovered() int {
+    return inv.hover
+}
+
+// the slot being dragged, or -1
+func (inv *Inventory) Dragging() int {
+    return inv.dragging
+}
+
+// picks up, drops and uses stacks from the frame's input
+func (inv *Inventory) HandleInput(in Input) {
+    inv.mouse = screen.MousePosition(in)
+    inv.hover = -1
+    if in.MouseInsideWindow() {
+        inv.hover = inv.SlotAt(inv.mouse)
+    }
+    over := inv.hover >= 0 && !inv.Slots[inv.hover].Empty()
+    switch {
+    case in.JustPressed(pixelgl.MouseButtonLeft) && over:
+        inv.dragging = inv.hover
+    case in.JustReleased(pixelgl.MouseButtonLeft) && inv.dragging >= 0:
+        from := inv.dragging
+        inv.dragging = -1
+        if inv.Move(from, inv.hover) && inv.Hooks.OnMove != nil {
+            inv.Hooks.OnMove(from, inv.hover)
+        }
+    case in.JustPressed(pixelgl.MouseButtonRight) && over && inv.dragging < 0:
+        if inv.Hooks.OnUse != nil {
+            inv.Hooks.OnUse(inv.hover)
+        }
+    }
+}
+
+func (inv *Inventory) icon(item string) *AtlasFrame {
+    if inv.Hooks.Icon != nil {
+        return inv.Hooks.Icon(item)
+    }
+    if inv.Atlas != nil {
+        return inv.Atlas.Frames[item]
+    }
+    return nil
+}
+
+// draws the item and its count filling r
+func (inv *Inventory) drawStack(t RenderTarget, s ItemStack, r pixel.Rect) {
+    scale := accessibility.UIScale()
+    spacing := inv.Style.Spacing * scale
+    if frame := inv.icon(s.Item); frame != nil {
+        size := frame.SourceSize
+        if size.X <= 0 || size.Y <= 0 {
+            size = frame.Sprite.Frame().Size()
+        }
+        box := inset(r, spacing)
+        frame.Draw(t, pixel.IM.Scaled(pixel.ZV, math.Min(box.W()/size.X, box.H()/size.Y)).Moved(r.Center()))
+    }
+    if s.Count > 1 {
+        opts := inv.Options.scaled(scale)
+        opts.Color, opts.Align = inv.Style.Text, AlignRight
+        DrawText(t, inv.Font, fmt.Sprint(s.Count), pixel.V(r.Max.X-spacing, r.Min.Y+spacing), opts)
+    }
+}
+
+// draws the slots, then the dragged stack under the mouse
+func (inv *Inventory) Draw(t RenderTarget) {
+    t.SetMatrix(pixel.IM)
+    inv.imd.Clear()
+    for i := range inv.Slots {
+        inv.imd.Color = inv.Style.Widget
+        if i == inv.hover {
+            inv.imd.Color = inv.Style.Hovered
+        }
+        r := inv.Rect(i)
+        inv.imd.Push(r.Min, r.Max)
+        inv.imd.Rectangle(0)
+        if i == inv.hover && inv.dragging >= 0 {
+            inv.imd.Color = inv.Style.Accent
+            inv.imd.Push(r.Min, r.Max)
+            inv.imd.Rectangle(1)
+        }
+    }
+    inv.imd.Draw(t)
+    for i, s := range inv.Slots {
+        if !s.Empty() && i != inv.dragging {
+            inv.drawStack(t, s, inv.Rect(i))
+        }
+    }
+    if inv.dragging >= 0 {
+        slot, _ := inv.metrics()
+        half := pixel.V(slot/2, slot/2)
+        inv.drawStack(t, inv.Slots[inv.dragging], pixel.Rect{Min: inv.mouse.Sub(half), Max: inv.mouse.Add(half)})
+    }
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "path"
+    "strconv"
+
+    "github.com/faiface/pixel"
+)
+
+type ldtkField struct {
+    Identifier string          `json:"__identifier"`
+    Type       string          `json:"__type"`
+    Value      json.RawMessage `json:"__value"`
+}
+
+type ldtkTile struct {
+    Px  [2]float64 `json:"px"`
+    Src [2]float64 `json:"src"`
+    F   int        `json:"f"`
+    T   int        `json:"t"`
+}
+
+type ldtkEntity struct {
+    Identifier string      `json:"__identifier"`
+    IID        string      `json:"iid"`
+    Px         [2]float64  `json:"px"`
+    Pivot      [2]float64  `json:"__pivot"`
+    Width      float64     `json:"width"`
+    Height     float64     `json:"height"`
+    Fields     []ldtkField `json:"fieldInstances"`
+}
+
+type ldtkLayer struct {
+    Identifier     string       `json:"__identifier"`
+    Type           string       `json:"__type"`
+    CWid           int          `json:"__cWid"`
+    CHei           int          `json:"__cHei"`
+    GridSize       int          `json:"__gridSize"`
+    Opacity        float64      `json:"__opacity"`
+    OffsetX        float64      `json:"__pxTotalOffsetX"`
+    OffsetY        float64      `json:"__pxTotalOffsetY"`
+    TilesetDefUID  *int         `json:"__tilesetDefUid"`
+    Visible        bool         `json:"visible"`
+    IntGridCSV     []int        `json:"intGridCsv"`
+    GridTiles      []ldtkTile   `json:"gridTiles"`
+    AutoLayerTiles []ldtkTile   `json:"autoLayerTiles"`
+    Entities       []ldtkEntity `json:"entityInstances"`
+}
+
+type ldtkLevel struct {
+    Identifier      string      `json:"identifier"`
+    IID             string      `json:"iid"`
+    WorldX          float64     `json:"worldX"`
+    WorldY          float64     `json:"worldY"`
+    PxWid           int         `json:"pxWid"`
+    PxHei           int         `json:"pxHei"`
+    Fields          []ldtkField `json:"fieldInstances"`
+    Layers          []ldtkLayer `json:"layerInstances"`
+    ExternalRelPath string      `json:"externalRelPath"`
+}
+
+type ldtkTilesetDef struct {
+    UID          int    `json:"uid"`
+    Identifier   string `json:"identifier"`
+    RelPath      string `json:"relPath"`
+    TileGridSize int    `json:"tileGridSize"`
+    Spacing      int    `json:"spacing"`
+    Padding      int    `json:"padding"`
+}
+
+type ldtkLayerDef struct {
+    Identifier    string `json:"identifier"`
+    IntGridValues []struct {
+        Value      int     `json:"value"`
+        Identifier *string `json:"identifier"`
+    } `json:"intGridValues"`
+}
+
+type ldtkProject struct {
+    DefaultGridSize int         `json:"defaultGridSize"`
+    Levels          []ldtkLevel `json:"levels"`
+    Defs            struct {
+        Tilesets []ldtkTilesetDef `json:"tilesets"`
+        Layers   []ldtkLayerDef   `json:"layers"`
+    } `json:"defs"`
+}
+
+// a grid of editor-defined integer values, usually collision or terrain types
+type IntGridLayer struct {
+    Name          string
+    Width, Height int
+    GridSize      int
+    Offset        pixel.Vec
+    // row-major from the top-left; 0 is empty
+    Values []int
+    // the identifiers values have in the project, where they have one
+    Names map[int]string
+}
+
+// the value at column x, row y counted from the top
+func (g *IntGridLayer) Value(x, y int) int {
+    if x < 0 || y < 0 || x >= g.Width || y >= g.Height {
+        return 0
+    }
+    return g.Values[y*g.Width+x]
+}
+
+type LDtkLevel struct {
+    Identifier string
+    IID        string
+    // position in the LDtk world, converted to Y up
+    WorldPosition pixel.Vec
+    Fields        Properties
+    // tile layers, IntGrid layers and entities in the same form as a Tiled map
+    Map *TileMap
+}
+
+type LDtkProject struct {
+    Levels []*LDtkLevel
+}
+
+func (p *LDtkProject) Level(identifier string) *LDtkLevel {
+    for _, l := range p.Levels {
+        if l.Identifier == identifier {
+            return l
+        }
+    }
+    return nil
+}
+
+// loads an LDtk project, including levels saved as separate files
+func LoadLDtk(name string) (*LDtkProject, error) {
+    data, err := ReadAsset(name)
+    if err != nil {
+        return nil, err
+    }
+    var raw ldtkProject
+    if err := json.Unmarshal(data, &raw); err != nil {
+        return nil, fmt.Errorf("ldtk %s: %v", name, err)
+    }
+
+    dir := path.Dir(assetPath(name))
+    tilesets := make(map[int]*Tileset)
+    firstGID := 1
+    var ordered []*Tileset
+    for _, def := range raw.Defs.Tilesets {
+        // embedded atlases like the internal icons have no picture to load
+        if def.RelPath == "" {
+            continue
+        }
+        pic, err := LoadPicture(path.Join(dir, def.RelPath))
+        if err != nil {
+            return nil, fmt.Errorf("ldtk %s: %v", name, err)
+        }
+        ts := &Tileset{
+            FirstGID:   firstGID,
+            Name:       def.Identifier,
+            TileWidth:  def.TileGridSize,
+            TileHeight: def.TileGridSize,
+            Picture:    pic,
+            Properties: Properties{},
+            Tiles:      make(map[int]*TileInfo),
+        }
+        ts.sliceFrames(def.Spacing, def.Padding)
+        firstGID += len(ts.frames)
+        tilesets[def.UID] = ts
+        ordered = append(ordered, ts)
+    }
+
+    // IntGrid value names by layer, so a collision layer's "ladder" value can be told apart
+    valueNames := make(map[string]map[int]string)
+    for _, def := range raw.Defs.Layers {
+        names := make(map[int]string)
+        for _, v := range def.IntGridValues {
+            if v.Identifier != nil {
+                names[v.Value] = *v.Identifier
+            }
+        }
+        valueNames[def.Identifier] = names
+    }
+
+    project := &LDtkProject{}
+    for _, level := range raw.Levels {
+        if level.ExternalRelPath != "" {
+            levelPath := path.Join(dir, level.ExternalRelPath)
+            levelData, err := ReadAsset(levelPath)
+            if err != nil {
+                return nil, fmt.Errorf("ldtk %s: %v", name, err)
+            }
+            if err := json.Unmarshal(levelData, &level); err != nil {
+                return nil, fmt.Errorf("ldtk %s: %v", levelPath, err)
+            }
+        }
+        l, err := convertLDtkLevel(level, raw.DefaultGridSize, tilesets, ordered, valueNames)
+        if err != nil {
+            return nil, fmt.Errorf("ldtk %s: level %q: %v", name, level.Identifier, err)
+        }
+        project.Levels = append(project.Levels, l)
+    }
+    return project, nil
+}
+
+// turns field instances into properties, with non-string values kept as their JSON text
+func ldtkFields(fields []ldtkField) Properties {
+    props := make(Properties, len(fields))
+    for _, field := range fields {
+        var s string
+        if err := json.Unmarshal(field.Value, &s); err == nil {
+            props[field.Identifier] = s
+        } else if string(field.Value) != "null" {
+            props[field.Identifier] = string(field.Value)
+        }
+    }
+    return props
+}
+
+func convertLDtkLevel(level ldtkLevel, defaultGrid int, tilesets map[int]*Tileset, ordered []*Tileset, valueNames map[string]map[int]string) (*LDtkLevel, error) {
+    grid := defaultGrid
+    for _, layer := range level.Layers {
+        if layer.GridSize > 0 {
+            grid = layer.GridSize
+            break
+        }
+    }
+    if grid <= 0 {
+        return nil, fmt.Errorf("no grid size")
+    }
+
+    m := &TileMap{
+        Width:       (level.PxWid + grid - 1) / grid,
+        Height:      (level.PxHei + grid - 1) / grid,
+        TileWidth:   grid,
+        TileHeight:  grid,
+        Orientation: "orthogonal",
+        Properties:  ldtkFields(level.Fields),
+        Tilesets:    ordered,
+    }
+    height := float64(level.PxHei)
+
+    // LDtk lists the top-most layer first, the renderer wants back to front
+    for i := len(level.Layers) - 1; i >= 0; i-- {
+        layer := level.Layers[i]
+        offset := pixel.V(layer.OffsetX, -layer.OffsetY)
+
+        switch layer.Type {
+        case "IntGrid", "AutoLayer", "Tiles":
+            if layer.Type == "IntGrid" && len(layer.IntGridCSV) > 0 {
+                m.IntGrids = append(m.IntGrids, &IntGridLayer{
+                    Name:     layer.Identifier,
+                    Width:    layer.CWid,
+                    Height:   layer.CHei,
+                    GridSize: layer.GridSize,
+                    Offset:   offset,
+                    Values:   append([]int(nil), layer.IntGridCSV...),
+                    Names:    valueNames[layer.Identifier],
+                })
+            }
+            tiles := layer.GridTiles
+            if layer.Type != "Tiles" {
+                tiles = layer.AutoLayerTiles
+            }
+            if len(tiles) == 0 || layer.TilesetDefUID == nil {
+                continue
+            }
+            ts, ok := tilesets[*layer.TilesetDefUID]
+            if !ok {
+                return nil, fmt.Errorf("layer %q uses unknown tileset %d", layer.Identifier, *layer.TilesetDefUID)
+            }
+            m.Layers = append(m.Layers, ldtkTileLayers(m, layer, ts, tiles, offset)...)
+        case "Entities":
+            group := &ObjectGroup{Name: layer.Identifier, Visible: layer.Visible, Properties: Properties{}}
+            for _, e := range layer.Entities {
+                // px is the pivot point, measured from the level's top-left
+                minX := e.Px[0] - e.Pivot[0]*e.Width + offset.X
+                maxY := height - (e.Px[1] - e.Pivot[1]*e.Height) + offset.Y
+                group.Objects = append(group.Objects, &MapObject{
+                    Name:       e.IID,
+                    Type:       e.Identifier,
+                    Shape:      ShapeRect,
+                    Rect:       pixel.R(minX, maxY-e.Height, minX+e.Width, maxY),
+                    Visible:    true,
+                    Properties: ldtkFields(e.Fields),
+                })
+            }
+            m.ObjectGroups = append(m.ObjectGroups, group)
+        }
+    }
+
+    m.BuildColliders()
+
+    return &LDtkLevel{
+        Identifier:    level.Identifier,
+        IID:           level.IID,
+        WorldPosition: pixel.V(level.WorldX, -level.WorldY),
+        Fields:        m.Properties,
+        Map:           m,
+    }, nil
+}
+
+// places LDtk tiles into tile layers, spilling stacked auto-layer tiles into extra layers above
+func ldtkTileLayers(m *TileMap, layer ldtkLayer, ts *Tileset, tiles []ldtkTile, offset pixel.Vec) []*TileLayer {
+    var layers []*TileLayer
+    newLayer := func() *TileLayer {
+        name := layer.Identifier
+        if len(layers) > 0 {
+            name += "#" + strconv.Itoa(len(layers)+1)
+        }
+        l := &TileLayer{
+            Name:       name,
+            Width:      layer.CWid,
+            Height:     layer.CHei,
+            Visible:    layer.Visible,
+            Opacity:    layer.Opacity,
+            Offset:     offset,
+            Properties: Properties{},
+            GIDs:       make([]uint32, layer.CWid*layer.CHei),
+            tileMap:    m,
+        }
+        layers = append(layers, l)
+        return l
+    }
+    newLayer()
+
+    for _, tile := range tiles {
+        x, y := int(tile.Px[0])/layer.GridSize, int(tile.Px[1])/layer.GridSize
+        if x < 0 || y < 0 || x >= layer.CWid || y >= layer.CHei {
+            continue
+        }
+        gid := uint32(ts.FirstGID + tile.T)
+        if tile.F&1 != 0 {
+            gid |= TILEFLIPX
+        }
+        if tile.F&2 != 0 {
+            gid |= TILEFLIPY
+        }
+
+        var target *TileLayer
+        for _, l := range layers {
+            if l.GID(x, y) == 0 {
+                target = l
+                break
+            }
+        }
+        if target == nil {
+            target = newLayer()
+        }
+        target.GIDs[y*layer.CWid+x] = gid
+    }
+    return layers
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+    "image/color"
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+)
+
+// rings and segments used to build each light's falloff gradient
+const LIGHTRINGS, LIGHTSEGMENTS = 8, 48
+
+// a point light, or a cone when Spread is set. positions are in world space.
+type Light struct {
+    Position pixel.Vec
+    Radius   float64
+    // 0-1, how much darkness the light removes at its center
+    Intensity float64
+    // brightness curve exponent, 1 is linear and higher values keep the light tighter
+    Falloff float64
+    // tints the lit area additively, scaled by Glow
+    Color color.Color
+    Glow  float64
+    // radians; a Spread of 0 lights all the way around
+    Direction, Spread float64
+    CastShadows       bool
+    Enabled           bool
+}
+
+func NewLight(pos pixel.Vec, radius float64, c color.Color) *Light {
+    return &Light{
+        Position:    pos,
+        Radius:      radius,
+        Intensity:   1,
+        Falloff:     2,
+        Color:       c,
+        Glow:        0.25,
+        CastShadows: true,
+        Enabled:     true,
+    }
+}
+
+func NewConeLight(pos pixel.Vec, radius, direction, spread float64, c color.Color) *Light {
+    l := NewLight(pos, radius, c)
+    l.Direction, l.Spread = direction, spread
+    return l
+}
+
+// a window or canvas that can change how it blends
+type ComposeTarget interface {
+    RenderTarget
+    SetComposeMethod(cmp pixel.ComposeMethod)
+}
+
+// darkens the scene to Ambient everywhere no light reaches. each light is drawn into a scratch
+// canvas, has its shadows cut out and then erases its share of a darkness canvas, while its
+// color adds onto a glow canvas; both are composited over the scene in Draw.
+type Lighting struct {
+    // how much of the scene shows in unlit areas, 0 is pitch black
+    Ambient float64
+    Lights  []*Light
+    // world space edges that block light, see AddRect and AddPolygon
+    Occluders []pixel.Line
+    Camera    *Camera
+
+    darkness, glow, scratch RenderCanvas
+    imd                     *imdraw.IMDraw
+}
+
+func NewLighting(bounds pixel.Rect, cam *Camera) *Lighting {
+    return &Lighting{
+        Ambient:  0.2,
+        Camera:   cam,
+        darkness: graphics.NewCanvas(bounds),
+        glow:     graphics.NewCanvas(bounds),
+        scratch:  graphics.NewCanvas(bounds),
+        imd:      imdraw.New(nil),
+    }
+}
+
+func (lt *Lighting) Add(l *Light) *Light {
+    lt.Lights = append(lt.Lights, l)
+    return l
+}
+
+func (lt *Lighting) Remove(l *Light) {
+    for i, other := range lt.Lights {
+        if other == l {
+            lt.Lights = append(lt.Lights[:i], lt.Lights[i+1:]...)
+            return
+        }
+    }
+}
+
+func (lt *Lighting) AddRect(r pixel.Rect) {
+    corners := r.Vertices()
+    lt.AddPolygon(corners[:])
+}
+
+// adds the closed outline of points as occluding edges
+func (lt *Lighting) AddPolygon(points []pixel.Vec) {
+    for i := range points {
+        lt.Occluders = append(lt.Occluders, pixel.L(points[i], points[(i+1)%len(points)]))
+    }
+}
+
+// rectangles and polygons from a map's object layer, e.g. its "collision" group
+func (lt *Lighting) AddObjects(group *ObjectGroup) {
+    for _, obj := range group.Objects {
+        switch obj.Shape {
+        case ShapeRect, ShapeTile:
+            lt.AddRect(obj.Rect)
+        case ShapePolygon:
+            lt.AddPolygon(obj.Points)
+        case ShapePolyline:
+            for i := 0; i+1 < len(obj.Points); i++ {
+                lt.Occluders = append(lt.Occluders, pixel.L(obj.Points[i], obj.Points[i+1]))
+            }
+        }
+    }
+}
+
+func (lt *Lighting) ClearOccluders() {
+    lt.Occluders = lt.Occluders[:0]
+}
+
+func (lt *Lighting) SetBounds(bounds pixel.Rect) {
+    lt.darkness.SetBounds(bounds)
+    lt.glow.SetBounds(bounds)
+    lt.scratch.SetBounds(bounds)
+}
+
+func (lt *Lighting) view() pixel.Matrix {
+    if lt.Camera == nil {
+        return pixel.IM
+    }
+    return lt.Camera.Matrix()
+}
+
+// the light's gradient as rings of quads, each ring fading towards the edge
+func (lt *Lighting) drawGradient(l *Light) {
+    imd := lt.imd
+    imd.Clear()
+    start, sweep := 0.0, 2*math.Pi
+    if l.Spread > 0 {
+        start, sweep = l.Direction-l.Spread/2, l.Spread
+    }
+    falloff := l.Falloff
+    if falloff <= 0 {
+        falloff = 1
+    }
+    segments := int(math.Ceil(LIGHTSEGMENTS * sweep / (2 * math.Pi)))
+    if segments < 2 {
+        segments = 2
+    }
+    brightness := func(ring int) pixel.RGBA {
+        d := float64(ring) / LIGHTRINGS
+        return pixel.Alpha(l.Intensity * math.Pow(1-d, falloff))
+    }
+    point := func(ring, seg int) pixel.Vec {
+        angle := start + sweep*float64(seg)/float64(segments)
+        return l.Position.Add(pixel.Unit(angle).Scaled(l.Radius * float64(ring) / LIGHTRINGS))
+    }
+
+    for ring := 0; ring < LIGHTRINGS; ring++ {
+        inner, outer := brightness(ring), brightness(ring+1)
+        for seg := 0; seg < segments; seg++ {
+            imd.Color = inner
+            imd.Push(point(ring, seg))
+            imd.Push(point(ring, seg+1))
+            imd.Color = outer
+            imd.Push(point(ring+1, seg+1))
+            imd.Push(point(ring+1, seg))
+            imd.Polygon(0)
+        }
+    }
+}
+
+// extends every occluding edge near the light away from it, past the light's radius
+func (lt *Lighting) drawShadows(l *Light) {
+    imd := lt.imd
+    imd.Clear()
+    imd.Color = pixel.Alpha(1)
+    far := l.Radius * 4
+    reach := pixel.R(l.Position.X-l.Radius, l.Position.Y-l.Radius, l.Position.X+l.Radius, l.Position.Y+l.Radius)
+    for _, edge := range lt.Occluders {
+        if !reach.Intersects(edge.Bounds()) {
+            continue
+        }
+        a, b := edge.A, edge.B
+        da, db := a.Sub(l.Position), b.Sub(l.Position)
+        if da.Len() == 0 || db.Len() == 0 {
+            continue
+        }
+        imd.Push(a, b, b.Add(db.Unit().Scaled(far)), a.Add(da.Unit().Scaled(far)))
+        imd.Polygon(0)
+    }
+}
+
+// composites the lighting over t, which should already hold the scene
+func (lt *Lighting) Draw(t ComposeTarget) {
+    bounds := lt.darkness.Bounds()
+    view := lt.view()
+
+    // lights draw onto the darkness with Rout, which erases it by their alpha
+    lt.darkness.Clear(pixel.RGBA{A: 1 - lt.Ambient})
+    lt.darkness.SetComposeMethod(pixel.ComposeRout)
+    lt.glow.Clear(color.Transparent)
+    lt.glow.SetComposeMethod(pixel.ComposePlus)
+
+    for _, l := range lt.Lights {
+        if !l.Enabled || l.Radius <= 0 {
+            continue
+        }
+        lt.scratch.Clear(color.Transparent)
+        lt.scratch.SetMatrix(view)
+        lt.scratch.SetComposeMethod(pixel.ComposeOver)
+        lt.drawGradient(l)
+        lt.imd.Draw(lt.scratch)
+        if l.CastShadows && len(lt.Occluders) > 0 {
+            lt.scratch.SetComposeMethod(pixel.ComposeRout)
+            lt.drawShadows(l)
+            lt.imd.Draw(lt.scratch)
+        }
+
+        lt.scratch.Draw(lt.darkness, pixel.IM.Moved(bounds.Center()))
+        if l.Color != nil && l.Glow > 0 {
+            lt.scratch.DrawColorMask(lt.glow, pixel.IM.Moved(bounds.Center()), pixel.ToRGBA(l.Color).Scaled(l.Glow))
+        }
+    }
+
+    t.SetMatrix(pixel.IM)
+    lt.darkness.Draw(t, pixel.IM.Moved(bounds.Center()))
+    t.SetComposeMethod(pixel.ComposePlus)
+    lt.glow.Draw(t, pixel.IM.Moved(bounds.Center()))
+    t.SetComposeMethod(pixel.ComposeOver)
+}
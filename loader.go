@@ -0,0 +1,152 @@
+package main
+
+import (
+    "fmt"
+    "sync"
+
+    "github.com/faiface/pixel"
+    "golang.org/x/image/colornames"
+)
+
+type LoadFunc func() (interface{}, error)
+
+type loadJob struct {
+    name string
+    load LoadFunc
+}
+
+// loads queued assets on worker goroutines so the window can keep drawing a loading screen
+type Loader struct {
+    mu      sync.Mutex
+    jobs    []loadJob
+    results map[string]interface{}
+    err     error
+    total   int
+    done    int
+    started bool
+}
+
+func NewLoader() *Loader {
+    return &Loader{results: make(map[string]interface{})}
+}
+
+// queues a load under name; jobs queued after Start are ignored
+func (l *Loader) Queue(name string, load LoadFunc) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.started {
+        return
+    }
+    l.jobs = append(l.jobs, loadJob{name, load})
+    l.total++
+}
+
+func (l *Loader) QueuePicture(path string) {
+    l.Queue(path, func() (interface{}, error) {
+        return LoadPicture(path)
+    })
+}
+
+// starts workers goroutines draining the queue
+func (l *Loader) Start(workers int) {
+    l.mu.Lock()
+    if l.started {
+        l.mu.Unlock()
+        return
+    }
+    l.started = true
+    jobs := make(chan loadJob, len(l.jobs))
+    for _, job := range l.jobs {
+        jobs <- job
+    }
+    close(jobs)
+    l.jobs = nil
+    l.mu.Unlock()
+
+    if workers < 1 {
+        workers = 1
+    }
+    for i := 0; i < workers; i++ {
+        go func() {
+            for job := range jobs {
+                l.run(job)
+            }
+        }()
+    }
+}
+
+func (l *Loader) run(job loadJob) {
+    // a panicking load func shouldn't take the worker down silently
+    defer func() {
+        if r := recover(); r != nil {
+            l.finish(job.name, nil, fmt.Errorf("loading %s: %v", job.name, r))
+        }
+    }()
+    value, err := job.load()
+    if err != nil {
+        err = fmt.Errorf("loading %s: %v", job.name, err)
+    }
+    l.finish(job.name, value, err)
+}
+
+func (l *Loader) finish(name string, value interface{}, err error) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if err != nil && l.err == nil {
+        l.err = err
+    }
+    if err == nil {
+        l.results[name] = value
+    }
+    l.done++
+}
+
+// fraction of queued jobs finished, in [0, 1]
+func (l *Loader) Progress() float64 {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.total == 0 {
+        return 1
+    }
+    return float64(l.done) / float64(l.total)
+}
+
+func (l *Loader) Done() bool {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.started && l.done == l.total
+}
+
+// first error any job returned
+func (l *Loader) Err() error {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.err
+}
+
+func (l *Loader) Get(name string) interface{} {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.results[name]
+}
+
+func (l *Loader) Picture(name string) pixel.Picture {
+    pic, _ := l.Get(name).(pixel.Picture)
+    return pic
+}
+
+// draws a simple progress bar in the middle of the window
+func DrawLoadingBar(progress float64) {
+    const width, height = 400, 24
+    center := screen.Bounds().Center()
+    corner := center.Sub(pixel.V(width/2, height/2))
+    imd := renderer.IMDraw(LAYERUI)
+
+    imd.Color = colornames.Dimgray
+    imd.Push(corner, corner.Add(pixel.V(width, height)))
+    imd.Rectangle(2)
+
+    imd.Color = colornames.White
+    imd.Push(corner.Add(pixel.V(4, 4)), corner.Add(pixel.V(4+(width-8)*progress, height-4)))
+    imd.Rectangle(0)
+}
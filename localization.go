@@ -0,0 +1,466 @@
+package main
+
+import (
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "os"
+    "path"
+    "sort"
+    "strings"
+)
+
+var localeLog = logging.Module("locale")
+
+// where Run loads string tables from: every .json and .csv directly inside it
+const LOCALEDIR = "lang"
+
+// the language a string comes from when the current one doesn't have it
+const LOCALEFALLBACK = "en"
+
+// one language's strings. a string is its text under "", or its plural forms under "one",
+// "other" and so on.
+type stringTable struct {
+    name    string
+    font    string
+    strings map[string]map[string]string
+}
+
+func (t *stringTable) runes() []rune {
+    var runes []rune
+    for _, forms := range t.strings {
+        for _, s := range forms {
+            runes = append(runes, []rune(s)...)
+        }
+    }
+    return runes
+}
+
+// string tables per language and which one is showing. look strings up with T and TN: keys are
+// whatever the tables use, often the English text itself, and one with no translation shows as
+// the key, so untranslated text still reads. the UI, dialogues and tooltips look their text up
+// by themselves.
+type Localization struct {
+    // the language picked once its table is loaded, until SetLanguage; Run sets it from the
+    // settings, and the system's language is tried when it's ""
+    Preferred string
+    // where strings the current language is missing come from
+    Fallback string
+
+    language string
+    chosen   bool
+    tables   map[string]*stringTable
+    fonts    map[string]*Font
+    attached []*Font
+    onChange []func(lang string) error
+}
+
+func NewLocalization() *Localization {
+    return &Localization{Fallback: LOCALEFALLBACK, tables: map[string]*stringTable{}, fonts: map[string]*Font{}}
+}
+
+// "pt_BR" and "PT-br" are both "pt-br"
+func languageTag(lang string) string {
+    return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+}
+
+// "pt" for "pt-br"
+func baseLanguage(lang string) string {
+    if i := strings.Index(lang, "-"); i >= 0 {
+        return lang[:i]
+    }
+    return lang
+}
+
+// the OS's language from the environment, e.g. "de-de" for LANG=de_DE.UTF-8
+func systemLanguage() string {
+    for _, v := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+        lang := os.Getenv(v)
+        if i := strings.IndexAny(lang, ".@"); i >= 0 {
+            lang = lang[:i]
+        }
+        if lang != "" && lang != "C" && lang != "POSIX" {
+            return languageTag(lang)
+        }
+    }
+    return ""
+}
+
+func (l *Localization) table(lang string) *stringTable {
+    t, ok := l.tables[lang]
+    if !ok {
+        t = &stringTable{strings: map[string]map[string]string{}}
+        l.tables[lang] = t
+    }
+    return t
+}
+
+// loads every string table directly inside dir, in name order so later files override earlier
+func (l *Localization) LoadDir(dir string) error {
+    var paths []string
+    for _, ext := range []string{"json", "csv"} {
+        matches, err := fs.Glob(AssetFS, assetPath(dir)+"/*."+ext)
+        if err != nil {
+            return err
+        }
+        paths = append(paths, matches...)
+    }
+    sort.Strings(paths)
+    for _, p := range paths {
+        if err := l.Load(p); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// adds the strings in a .json or .csv asset to what's loaded, e.g. a mod's translation
+func (l *Localization) Load(name string) error {
+    data, err := ReadAsset(name)
+    if err != nil {
+        return err
+    }
+    if strings.EqualFold(path.Ext(name), ".csv") {
+        err = l.parseCSV(data)
+    } else {
+        err = l.parseJSON(data)
+    }
+    if err != nil {
+        return fmt.Errorf("%s: %v", name, err)
+    }
+    l.pick()
+    return nil
+}
+
+// one language: its tag, what it calls itself, a font for its script when Go Regular doesn't
+// have it, and its strings, each a string or an object of plural forms, e.g.
+//
+//	{
+//		"language": "de",
+//		"name": "Deutsch",
+//		"strings": {
+//			"Play": "Spielen",
+//			"%d coins": {"one": "%d Münze", "other": "%d Münzen"}
+//		}
+//	}
+type stringTableFile struct {
+    Language string                     `json:"language"`
+    Name     string                     `json:"name"`
+    Font     string                     `json:"font"`
+    Strings  map[string]json.RawMessage `json:"strings"`
+}
+
+func (l *Localization) parseJSON(data []byte) error {
+    var file stringTableFile
+    if err := json.Unmarshal(data, &file); err != nil {
+        return err
+    }
+    lang := languageTag(file.Language)
+    if lang == "" {
+        return fmt.Errorf("no language")
+    }
+    t := l.table(lang)
+    if file.Name != "" {
+        t.name = file.Name
+    }
+    if file.Font != "" {
+        t.font = file.Font
+    }
+    for key, raw := range file.Strings {
+        var s string
+        if err := json.Unmarshal(raw, &s); err == nil {
+            t.strings[key] = map[string]string{"": s}
+            continue
+        }
+        var forms map[string]string
+        if err := json.Unmarshal(raw, &forms); err != nil {
+            return fmt.Errorf("%s: a string or an object of plural forms: %v", key, err)
+        }
+        t.strings[key] = forms
+    }
+    return nil
+}
+
+// a column per language under a header like key,en,de,ja. a plural form's key ends in its
+// category, like "%d coins#one", and the rows "@name" and "@font" hold each language's name and
+// font.
+func (l *Localization) parseCSV(data []byte) error {
+    r := csv.NewReader(bytes.NewReader(data))
+    r.FieldsPerRecord = -1
+    rows, err := r.ReadAll()
+    if err != nil {
+        return err
+    }
+    if len(rows) == 0 || len(rows[0]) < 2 {
+        return fmt.Errorf("no header with a key column and a language")
+    }
+    langs := rows[0][1:]
+    for i, lang := range langs {
+        langs[i] = languageTag(lang)
+    }
+    for _, row := range rows[1:] {
+        if len(row) == 0 || row[0] == "" {
+            continue
+        }
+        key, form := row[0], ""
+        if i := strings.LastIndex(key, "#"); i >= 0 {
+            key, form = key[:i], key[i+1:]
+        }
+        for i, s := range row[1:] {
+            if i >= len(langs) || s == "" {
+                continue
+            }
+            t := l.table(langs[i])
+            switch key {
+            case "@name":
+                t.name = s
+            case "@font":
+                t.font = s
+            default:
+                if t.strings[key] == nil {
+                    t.strings[key] = map[string]string{}
+                }
+                t.strings[key][form] = s
+            }
+        }
+    }
+    return nil
+}
+
+// the loaded language closest to lang, "" when there's none
+func (l *Localization) match(lang string) string {
+    lang = languageTag(lang)
+    if lang == "" {
+        return ""
+    }
+    if _, ok := l.tables[lang]; ok {
+        return lang
+    }
+    if _, ok := l.tables[baseLanguage(lang)]; ok {
+        return baseLanguage(lang)
+    }
+    return ""
+}
+
+// settles on Preferred, the system's language or Fallback, whichever is loaded first, while the
+// player hasn't chosen
+func (l *Localization) pick() {
+    if l.chosen {
+        l.apply(l.language)
+        return
+    }
+    lang := ""
+    for _, want := range []string{l.Preferred, systemLanguage(), l.Fallback} {
+        if lang = l.match(want); lang != "" {
+            break
+        }
+    }
+    if lang == "" {
+        if langs := l.Languages(); len(langs) > 0 {
+            lang = langs[0]
+        }
+    }
+    l.apply(lang)
+}
+
+// shows lang from now on, and tells the OnChange callbacks, e.g. to save it
+func (l *Localization) SetLanguage(lang string) error {
+    match := l.match(lang)
+    if match == "" {
+        return fmt.Errorf("no strings for language %q", lang)
+    }
+    l.chosen = true
+    l.apply(match)
+    for _, fn := range l.onChange {
+        if err := fn(match); err != nil {
+            settingsLog.Errorf("language: %v", err)
+        }
+    }
+    return nil
+}
+
+func (l *Localization) Language() string {
+    return l.language
+}
+
+// every loaded language, sorted
+func (l *Localization) Languages() []string {
+    langs := make([]string, 0, len(l.tables))
+    for lang := range l.tables {
+        langs = append(langs, lang)
+    }
+    sort.Strings(langs)
+    return langs
+}
+
+// what lang calls itself, e.g. "Deutsch", or its tag without a name
+func (l *Localization) Name(lang string) string {
+    if t, ok := l.tables[languageTag(lang)]; ok && t.name != "" {
+        return t.name
+    }
+    return lang
+}
+
+// registers fn to run with the language whenever SetLanguage changes it
+func (l *Localization) OnChange(fn func(lang string) error) {
+    l.onChange = append(l.onChange, fn)
+}
+
+// gives f the current language's font for the glyphs it's missing, and keeps doing so as the
+// language changes. DefaultFont always has it.
+func (l *Localization) Attach(f *Font) {
+    l.attached = append(l.attached, f)
+    l.apply(l.language)
+}
+
+// switches to lang, baking its letters into the fonts and falling back to its font
+func (l *Localization) apply(lang string) {
+    l.language = lang
+    t, ok := l.tables[lang]
+    if !ok {
+        return
+    }
+    var fallback *Font
+    if t.font != "" {
+        fallback = l.fonts[t.font]
+        if fallback == nil {
+            f, err := LoadFont(t.font)
+            if err != nil {
+                localeLog.Warnf("%s: %v", lang, err)
+            } else {
+                fallback = f
+                l.fonts[t.font] = f
+            }
+        }
+    }
+    runes := t.runes()
+    for _, f := range append([]*Font{DefaultFont()}, l.attached...) {
+        if f.bitmap != nil {
+            continue
+        }
+        f.SetFallback(fallback)
+        f.AddRunes(runes)
+    }
+}
+
+// key's text in the current language, then the fallback's, then key itself
+func (l *Localization) text(key, form string) (string, bool) {
+    for _, lang := range []string{l.language, baseLanguage(l.language), languageTag(l.Fallback)} {
+        t, ok := l.tables[lang]
+        if !ok {
+            continue
+        }
+        forms := t.strings[key]
+        for _, f := range []string{form, "other", ""} {
+            if s, ok := forms[f]; ok {
+                return s, true
+            }
+        }
+    }
+    return key, false
+}
+
+// key in the current language, formatted with args like fmt.Sprintf when there are any
+func (l *Localization) T(key string, args ...interface{}) string {
+    s, _ := l.text(key, "")
+    if len(args) == 0 {
+        return s
+    }
+    return fmt.Sprintf(s, args...)
+}
+
+// the form of key for n things in the current language, formatted with n and then args, e.g.
+// TN("%d coins", 3) for "3 coins"
+func (l *Localization) TN(key string, n int, args ...interface{}) string {
+    s, _ := l.text(key, pluralCategory(l.language, n))
+    return fmt.Sprintf(s, append([]interface{}{n}, args...)...)
+}
+
+// T on the game's Localization
+func T(key string, args ...interface{}) string {
+    return locale.T(key, args...)
+}
+
+// TN on the game's Localization
+func TN(key string, n int, args ...interface{}) string {
+    return locale.TN(key, n, args...)
+}
+
+// which of CLDR's plural forms lang uses for n: "zero", "one", "two", "few", "many" or "other".
+// languages it doesn't know get English's one and other.
+func pluralCategory(lang string, n int) string {
+    if n < 0 {
+        n = -n
+    }
+    mod10, mod100 := n%10, n%100
+    switch baseLanguage(languageTag(lang)) {
+    case "ja", "zh", "ko", "vi", "th", "id", "ms", "tr":
+        return "other"
+    case "fr":
+        if n <= 1 {
+            return "one"
+        }
+    case "ru", "uk", "be", "sr", "hr", "bs":
+        switch {
+        case mod10 == 1 && mod100 != 11:
+            return "one"
+        case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+            return "few"
+        default:
+            return "many"
+        }
+    case "pl":
+        switch {
+        case n == 1:
+            return "one"
+        case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+            return "few"
+        default:
+            return "many"
+        }
+    case "cs", "sk":
+        switch {
+        case n == 1:
+            return "one"
+        case n >= 2 && n <= 4:
+            return "few"
+        }
+    case "ar":
+        switch {
+        case n == 0:
+            return "zero"
+        case n == 1:
+            return "one"
+        case n == 2:
+            return "two"
+        case mod100 >= 3 && mod100 <= 10:
+            return "few"
+        case mod100 >= 11:
+            return "many"
+        }
+    default:
+        if n == 1 {
+            return "one"
+        }
+    }
+    return "other"
+}
+
+// the console's language command, which saves like an options menu would
+func registerLocaleCommands(c *Console, l *Localization) {
+    c.Register("language", "lists the loaded languages, or switches to one", func(args ConsoleArgs) error {
+        if !args.Has(0) {
+            for _, lang := range l.Languages() {
+                mark := " "
+                if lang == l.Language() {
+                    mark = "*"
+                }
+                c.Printf("%s %-6s %s", mark, lang, l.Name(lang))
+            }
+            return nil
+        }
+        return l.SetLanguage(args.String(0))
+    }, StringArg("language").Opt())
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+// the game's log file, relative to the working directory
+const LOGPATH = "game.log"
+
+// the log file is rotated past this size, keeping LOGKEEP old ones as game.log.1, game.log.2...
+const LOGMAXSIZE = 4 << 20
+const LOGKEEP = 3
+
+type LogLevel int
+
+const (
+    LogDebug LogLevel = iota
+    LogInfo
+    LogWarn
+    LogError
+)
+
+func (l LogLevel) String() string {
+    switch l {
+    case LogDebug:
+        return "DEBUG"
+    case LogInfo:
+        return "INFO"
+    case LogWarn:
+        return "WARN"
+    case LogError:
+        return "ERROR"
+    }
+    return fmt.Sprintf("LEVEL%d", int(l))
+}
+
+type LogEntry struct {
+    Time    time.Time
+    Level   LogLevel
+    Module  string
+    Message string
+}
+
+// e.g. "12:04:05 WARN  assets: missing.png, using placeholder"
+func (e LogEntry) String() string {
+    return fmt.Sprintf("%s %-5s %s: %s", e.Time.Format("15:04:05"), e.Level, e.Module, e.Message)
+}
+
+// where entries end up. sinks are called with the log locked, one entry at a time.
+type LogSink interface {
+    Write(e LogEntry)
+}
+
+// routes entries from every module's Logger to the sinks, dropping those below the module's level
+type Logging struct {
+    mu     sync.Mutex
+    level  LogLevel
+    levels map[string]LogLevel
+    sinks  []LogSink
+}
+
+func NewLogging(sinks ...LogSink) *Logging {
+    return &Logging{level: LogInfo, levels: make(map[string]LogLevel), sinks: sinks}
+}
+
+func (l *Logging) AddSink(s LogSink) {
+    l.mu.Lock()
+    l.sinks = append(l.sinks, s)
+    l.mu.Unlock()
+}
+
+// the lowest level written for modules without their own
+func (l *Logging) SetLevel(level LogLevel) {
+    l.mu.Lock()
+    l.level = level
+    l.mu.Unlock()
+}
+
+// e.g. SetModuleLevel("assets", LogDebug) while chasing a loading bug
+func (l *Logging) SetModuleLevel(module string, level LogLevel) {
+    l.mu.Lock()
+    l.levels[module] = level
+    l.mu.Unlock()
+}
+
+func (l *Logging) Enabled(module string, level LogLevel) bool {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.enabled(module, level)
+}
+
+func (l *Logging) enabled(module string, level LogLevel) bool {
+    threshold, ok := l.levels[module]
+    if !ok {
+        threshold = l.level
+    }
+    return level >= threshold
+}
+
+func (l *Logging) Log(module string, level LogLevel, message string) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if !l.enabled(module, level) {
+        return
+    }
+    e := LogEntry{Time: time.Now(), Level: level, Module: module, Message: message}
+    for _, s := range l.sinks {
+        s.Write(e)
+    }
+}
+
+// a Logger that tags its entries with module
+func (l *Logging) Module(module string) *Logger {
+    return &Logger{module: module, logging: l}
+}
+
+// an io.Writer that logs each line written to it, for handing to code that wants one
+func (l *Logging) Writer(module string, level LogLevel) io.Writer {
+    return &logWriter{logger: l.Module(module), level: level}
+}
+
+// one module's log, e.g. var assetLog = logging.Module("assets")
+type Logger struct {
+    module  string
+    logging *Logging
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) { l.logf(LogDebug, format, args) }
+func (l *Logger) Infof(format string, args ...interface{})  { l.logf(LogInfo, format, args) }
+func (l *Logger) Warnf(format string, args ...interface{})  { l.logf(LogWarn, format, args) }
+func (l *Logger) Errorf(format string, args ...interface{}) { l.logf(LogError, format, args) }
+
+func (l *Logger) logf(level LogLevel, format string, args []interface{}) {
+    // skips formatting debug lines nobody will see
+    if !l.logging.Enabled(l.module, level) {
+        return
+    }
+    l.logging.Log(l.module, level, fmt.Sprintf(format, args...))
+}
+
+type logWriter struct {
+    mu      sync.Mutex
+    logger  *Logger
+    level   LogLevel
+    partial string
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+    w.mu.Lock()
+    lines := strings.Split(w.partial+string(p), "\n")
+    w.partial = lines[len(lines)-1]
+    w.mu.Unlock()
+    for _, line := range lines[:len(lines)-1] {
+        w.logger.logging.Log(w.logger.module, w.level, line)
+    }
+    return len(p), nil
+}
+
+// writes entries as lines, e.g. to os.Stderr
+type ConsoleSink struct {
+    W io.Writer
+}
+
+func (s ConsoleSink) Write(e LogEntry) {
+    fmt.Fprintln(s.W, e)
+}
+
+// the last entries in memory, for crash reports and the in-game console
+type LogTail struct {
+    mu      sync.Mutex
+    entries []LogEntry
+    next    int
+    full    bool
+}
+
+func NewLogTail(size int) *LogTail {
+    return &LogTail{entries: make([]LogEntry, size)}
+}
+
+func (t *LogTail) Write(e LogEntry) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    t.entries[t.next] = e
+    t.next = (t.next + 1) % len(t.entries)
+    if t.next == 0 {
+        t.full = true
+    }
+}
+
+// oldest first
+func (t *LogTail) Entries() []LogEntry {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if !t.full {
+        return append([]LogEntry(nil), t.entries[:t.next]...)
+    }
+    return append(append([]LogEntry(nil), t.entries[t.next:]...), t.entries[:t.next]...)
+}
+
+// appends to a file, starting a new one when it passes MaxSize so a long session can't fill
+// the disk. old files are shifted to path.1, path.2 and so on, keeping Keep of them.
+type FileSink struct {
+    Path    string
+    MaxSize int64
+    Keep    int
+
+    mu   sync.Mutex
+    file *os.File
+    size int64
+}
+
+func NewFileSink(path string, maxSize int64, keep int) (*FileSink, error) {
+    s := &FileSink{Path: path, MaxSize: maxSize, Keep: keep}
+    if err := s.open(); err != nil {
+        return nil, err
+    }
+    return s, nil
+}
+
+func (s *FileSink) open() error {
+    file, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        return fmt.Errorf("log %s: %v", s.Path, err)
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return fmt.Errorf("log %s: %v", s.Path, err)
+    }
+    s.file, s.size = file, info.Size()
+    return nil
+}
+
+func (s *FileSink) rotate() error {
+    s.file.Close()
+    s.file = nil
+    for i := s.Keep - 1; i >= 1; i-- {
+        os.Rename(fmt.Sprintf("%s.%d", s.Path, i), fmt.Sprintf("%s.%d", s.Path, i+1))
+    }
+    if s.Keep > 0 {
+        os.Rename(s.Path, s.Path+".1")
+    } else {
+        os.Remove(s.Path)
+    }
+    return s.open()
+}
+
+func (s *FileSink) Write(e LogEntry) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.file == nil {
+        return
+    }
+    line := e.String() + "\n"
+    if s.MaxSize > 0 && s.size+int64(len(line)) > s.MaxSize && s.size > 0 {
+        if err := s.rotate(); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            return
+        }
+    }
+    n, _ := s.file.WriteString(line)
+    s.size += int64(n)
+}
+
+func (s *FileSink) Close() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.file == nil {
+        return nil
+    }
+    err := s.file.Close()
+    s.file = nil
+    return err
+}
+
+// sends the standard logger through logging as module "log", so log.Printf calls from anywhere
+// reach every sink
+func CaptureLog() {
+    log.SetFlags(0)
+    log.SetOutput(logging.Writer("log", LogInfo))
+}
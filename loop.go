@@ -0,0 +1,89 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+)
+
+// simulation steps per second
+const TICKRATE = 60
+
+// seconds of real time a single frame may feed the simulation; a longer hitch, like dragging the
+// window, is dropped instead of being caught up in a burst of steps
+const MAXFRAMETIME = 0.25
+
+// runs updates in fixed steps however fast frames come, so physics behaves the same at any
+// refresh rate, and tells rendering how far it is between the last two steps
+type FixedLoop struct {
+    // seconds per step
+    Step         float64
+    MaxFrameTime float64
+
+    accumulator float64
+    ticks       uint64
+}
+
+func NewFixedLoop(rate float64) *FixedLoop {
+    return &FixedLoop{Step: 1 / rate, MaxFrameTime: MAXFRAMETIME}
+}
+
+// feeds frame seconds of real time in, calling update with Step for every whole step due, and
+// returns alpha, 0-1, how far past the last step the frame is. input read in update sees the
+// same presses every step of a frame and none on frames with no steps.
+func (l *FixedLoop) Advance(frame float64, update func(dt float64)) float64 {
+    if frame > l.MaxFrameTime {
+        frame = l.MaxFrameTime
+    }
+    l.accumulator += frame
+    for l.accumulator >= l.Step {
+        update(l.Step)
+        l.accumulator -= l.Step
+        l.ticks++
+    }
+    return l.Alpha()
+}
+
+// drops time left over from earlier frames, so the next step lands where a fresh loop's would,
+// e.g. when a replay starts
+func (l *FixedLoop) Reset() {
+    l.accumulator = 0
+}
+
+func (l *FixedLoop) Alpha() float64 {
+    return math.Min(1, l.accumulator/l.Step)
+}
+
+// steps run so far
+func (l *FixedLoop) Ticks() uint64 {
+    return l.ticks
+}
+
+// a value kept for the last two steps so it can be drawn between them. call Set once per step
+// and draw At(alpha).
+type Interpolated struct {
+    Previous, Current pixel.Vec
+}
+
+// moves to v, keeping the old value to blend from
+func (i *Interpolated) Set(v pixel.Vec) {
+    i.Previous, i.Current = i.Current, v
+}
+
+// jumps straight to v, e.g. on teleports and spawning, so it doesn't slide across the screen
+func (i *Interpolated) Reset(v pixel.Vec) {
+    i.Previous, i.Current = v, v
+}
+
+func (i *Interpolated) At(alpha float64) pixel.Vec {
+    return pixel.Lerp(i.Previous, i.Current, alpha)
+}
+
+// blends angles the short way round, in radians
+func LerpAngle(from, to, alpha float64) float64 {
+    d := math.Mod(to-from+math.Pi, 2*math.Pi)
+    if d < 0 {
+        d += 2 * math.Pi
+    }
+    return from + (d-math.Pi)*alpha
+}
@@ -1,70 +1,186 @@
 package main
 
 import (
-    "os"
+    "flag"
+    "fmt"
     "image"
-
-    _ "image/png"
+    "log"
+    "os"
+    "time"
 
     "github.com/faiface/pixel"
-    "github.com/faiface/pixel/imdraw"
     "github.com/faiface/pixel/pixelgl"
-    "golang.org/x/image/colornames"
 )
 
 const SCREENX, SCREENY = 960, 540
 
+// the resolution the game renders at before scaling to the window, e.g. 480, 270 for chunky pixels
+const VIRTUALX, VIRTUALY = SCREENX, SCREENY
+
 var (
-    win     *pixelgl.Window
-    imd     *imdraw.IMDraw
+    // every module logs through it, to stderr, game.log and the tail crash reports include
+    logging   = NewLogging(ConsoleSink{os.Stderr}, recentLog)
+    win       *pixelgl.Window
+    // window, volume and key options from settings.json
+    settings  *Settings
+    // "jump" rather than Space: game code reads actions, the player picks the keys
+    actions   *Actions
+    // connected pads and which player holds each
+    gamepads  = NewGamepads()
+    // clicks, drags and hover areas in virtual screen coordinates
+    mouse     = NewMouse()
+    // files dragged onto the window, e.g. for the level editor
+    drops     = NewFileDrops()
+    // Ctrl+Shift+R style chords, by context so the editor's don't fire in play
+    shortcuts = NewShortcuts()
+    // wheel, pinch and +/- as one signal: camera.ZoomAt(zoom.Factor(), zoom.Anchor)
+    zoom      = NewZoomInput()
+    // touch-style sticks and buttons that press actions, off until Enabled
+    onscreen  = NewVirtualControls()
+    // set its World and entities with a Transform and a Collider bump into each other
+    collision = NewCollisions()
+    // rigid bodies through a real physics engine, once the game sets a Backend
+    physics   = NewPhysics()
+    // A* searches over NavGrids, a budget of them each tick
+    paths     = NewPathfinder()
+    // ticks the behavior trees of its World's agents after Game.Update
+    behaviors = NewBehaviors()
+    display   *Display
+    screen    = NewVirtualScreen(VIRTUALX, VIRTUALY)
+    camera    *Camera
+    // makes every canvas the engine draws offscreen; NullBackend draws nothing, for servers
+    graphics  RenderBackend = PixelGLBackend{}
+    // game code submits draw calls into its layers, Run draws them all once per frame
+    renderer  *Renderer
+    // menus, levels and pause screens: push the first one in Game.Init and scenes take it from there
+    scenes    *SceneManager
+    // the frame renders into post.Scene() and reaches the window through its effect chain
+    post      *PostProcessor
+    assets    = NewAssetManager()
+    tweens    = NewTweener()
+    // delayed calls, repeating timers and scripted sequences on game time
+    scheduler = NewScheduler()
+    // frame timing for everything else; clock.Scale = 0.5 is slow motion
+    clock     = NewTime()
+    // sound effects and music, mixed on its own goroutine once Run starts it
+    audio     = NewAudio()
+    // string tables from lang/, the player's language and T("Play") to look text up in it
+    locale    = NewLocalization()
+    // color filters, UI scale and reduced shake, read by post, camera and the UI as they draw
+    accessibility = NewAccessibility()
+    // "Game saved" and the like, slid into a corner over everything for a few seconds
+    toasts    = NewToasts()
+    // the server and client while the game hosts or joins one, polled each frame
+    network   = NewNetwork()
+    // gameplay, UI and audio publish and subscribe to event structs here
+    events    = NewEventBus()
+    // counters and achievements from the game's stats file, counted off events
+    stats     = NewStats()
+    // fixed simulation steps; draw code reads loop.Alpha() to interpolate between them
+    loop      = NewFixedLoop(TICKRATE)
+    // Escape or losing focus freezes the simulation; drawing and the pause menu keep going
+    pause     = NewPause()
+    // F3 toggles it
+    debug     = NewDebugOverlay()
+    // F4 opens the level being played in it, to paint tiles and place entities and save it back
+    editor    = NewEditor()
+    // ` drops it down; help lists the commands
+    console   = NewConsole()
+    // Lua gameplay scripts from the assets' scripts directory
+    scripts   = NewScripts()
+    // content packs from mods/, layered over the assets by Run
+    mods      *Mods
+    // seeded once per run, from --seed, the replay or the clock, and split into named streams
+    rng       = NewRNG(time.Now().UnixNano())
+    // gameplay randomness; draw from it rather than math/rand so replays come out the same
+    random    = rng.Stream(RNGGAMEPLAY)
+    // --profile times each system; the console's cpuprofile and heapprofile work regardless
+    profiler  = NewProfiler()
+    // F10 starts and stops a GIF of the window
+    recorder  = NewRecorder()
+    // inspectors and other tooling in windows of their own; "window" in the console opens them
+    windows   = NewWindows()
+    // named assets from the manifest, ready once the loading screen finishes
+    resources *Resources
 )
 
 // used for loading icons and sprites
 func LoadPicture(path string) (pixel.Picture, error) {
-    // loads and decodes PNG
-    file, err := os.Open(path)
+    // loads and decodes any registered image format from the asset filesystem
+    file, err := OpenAsset(path)
     if err != nil {
-        panic(err)
+        return nil, err
     }
     defer file.Close()
-    img, _, err := image.Decode(file)
+    format, r, err := DetectImageFormat(file)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    img, _, err := image.Decode(r)
     if err != nil {
-        panic(err)
+        return nil, fmt.Errorf("%s: decoding %s: %v", path, format, err)
     }
     // converts to Pixel picture
     return pixel.PictureDataFromImage(img), nil
 }
 
-func run() {
-    icon, err := LoadPicture("icon.png")
-    if err != nil {
-        panic(err)
-    }
+// the game itself: fill in Init, Update and Draw, everything else is set up by Run
+type game struct {
+    ctx *Context
+}
 
-    cfg := pixelgl.WindowConfig{
-        Title:  "Go Pixel",
-        Bounds: pixel.R(0, 0, SCREENX, SCREENY),
-        Icon:  []pixel.Picture{icon},
-        VSync: true,
-    }
-    win, err = pixelgl.NewWindow(cfg)
-    if err != nil {
-        panic(err)
-    }
+func (g *game) Init(ctx *Context) error {
+    g.ctx = ctx
+    // ctx.Screen.Mode = ScaleInteger  // for pixel art, avoids uneven pixels at odd window sizes
+    // ctx.Post.Add(VignetteEffect(0.5), CRTEffect(0.1, 0.25))
+    // ctx.Post.Add(PaletteEffect(Palette{...}, 0.5)) or LUTEffect(lut, 1) for a color grade
+    // ctx.Assets.HotReload = true  // with UseAssetDir, swaps in edited pictures while the game runs
+    // ctx.Scripts.World = world  // then ctx.Scripts.LoadAll(SCRIPTDIR), HotReload works as for assets
 
-    imd = imdraw.New(nil)
+    // ctx.Console.Register("spawn", "spawns an enemy", spawnEnemy, StringArg("kind"), FloatArg("x"), FloatArg("y"))
 
-    for !win.Closed() {
-        imd.Clear()
+    // a title screen with Play, Options and Quit, Play starting the first level:
+    // ctx.Scenes.Push(NewMenuScene(ctx.Settings.Title, func() Scene { return &LevelScene{} }))
+    return nil
+}
 
-        // game loop here
+func (g *game) Update(dt float64) {}
 
-        win.Clear(colornames.Black)
-        imd.Draw(win)
-        win.Update()
-    }
-}
+func (g *game) Draw(t RenderTarget) {}
 
 func main() {
-    pixelgl.Run(run)
+    // log.Printf from anywhere, our own or a library's, goes through logging too
+    CaptureLog()
+    if file, err := NewFileSink(LOGPATH, LOGMAXSIZE, LOGKEEP); err != nil {
+        log.Print(err)
+    } else {
+        logging.AddSink(file)
+        defer file.Close()
+    }
+
+    // ./main pack <dir> <out.pak> bundles an assets directory for distribution
+    if len(os.Args) == 4 && os.Args[1] == "pack" {
+        if err := BuildPak(os.Args[2], os.Args[3]); err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+
+    if _, err := os.Stat(PAKPATH); err == nil {
+        if err := UsePak(PAKPATH, true); err != nil {
+            log.Fatal(err)
+        }
+    }
+
+    // e.g. ./main --width 1280 --height 720 --no-vsync --debug
+    cfg := DefaultConfig()
+    if err := ParseFlags(os.Args[1:], &cfg); err != nil {
+        if err == flag.ErrHelp {
+            return
+        }
+        os.Exit(2)
+    }
+    if err := Run(&game{}, cfg); err != nil {
+        log.Fatal(err)
+    }
 }
\ No newline at end of file
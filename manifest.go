@@ -0,0 +1,152 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "sort"
+
+    "github.com/faiface/pixel"
+)
+
+// default manifest path inside the asset filesystem
+const MANIFESTPATH = "assets.json"
+
+// lists every game resource under a logical name, so game code asks for "player" instead of a file path
+type Manifest struct {
+    Sprites  map[string]string `json:"sprites,omitempty"`
+    Atlases  map[string]string `json:"atlases,omitempty"`
+    Aseprite map[string]string `json:"aseprite,omitempty"`
+    Fonts    map[string]string `json:"fonts,omitempty"`
+    Sounds   map[string]string `json:"sounds,omitempty"`
+}
+
+func LoadManifest(path string) (*Manifest, error) {
+    data, err := ReadAsset(path)
+    if err != nil {
+        return nil, err
+    }
+    var m Manifest
+    if err := json.Unmarshal(data, &m); err != nil {
+        return nil, fmt.Errorf("manifest %s: %v", path, err)
+    }
+    return &m, nil
+}
+
+func (m *Manifest) sections() []struct {
+    kind  string
+    names map[string]string
+} {
+    return []struct {
+        kind  string
+        names map[string]string
+    }{
+        {"sprite", m.Sprites},
+        {"atlas", m.Atlases},
+        {"aseprite", m.Aseprite},
+        {"font", m.Fonts},
+        {"sound", m.Sounds},
+    }
+}
+
+// every file the manifest references, sorted and deduplicated
+func (m *Manifest) Files() []string {
+    seen := make(map[string]bool)
+    var files []string
+    for _, section := range m.sections() {
+        for _, path := range section.names {
+            if !seen[path] {
+                seen[path] = true
+                files = append(files, path)
+            }
+        }
+    }
+    sort.Strings(files)
+    return files
+}
+
+// checks every referenced file exists in the asset filesystem
+func (m *Manifest) Validate() error {
+    var missing []string
+    for _, section := range m.sections() {
+        for name, path := range section.names {
+            if _, err := fs.Stat(AssetFS, assetPath(path)); err != nil {
+                missing = append(missing, fmt.Sprintf("%s %q (%s)", section.kind, name, path))
+            }
+        }
+    }
+    if len(missing) > 0 {
+        sort.Strings(missing)
+        return fmt.Errorf("manifest: missing %v", missing)
+    }
+    return nil
+}
+
+func manifestKey(kind, name string) string {
+    return kind + ":" + name
+}
+
+// queues every loadable resource on l. sounds are only validated, since they're opened by path.
+func (m *Manifest) Queue(l *Loader) {
+    for name, path := range m.Sprites {
+        path := path
+        l.Queue(manifestKey("sprite", name), func() (interface{}, error) {
+            return LoadPicture(path)
+        })
+    }
+    for name, path := range m.Atlases {
+        path := path
+        l.Queue(manifestKey("atlas", name), func() (interface{}, error) {
+            return LoadAtlas(path)
+        })
+    }
+    for name, path := range m.Aseprite {
+        path := path
+        l.Queue(manifestKey("aseprite", name), func() (interface{}, error) {
+            return LoadAseprite(path)
+        })
+    }
+    for name, path := range m.Fonts {
+        path := path
+        l.Queue(manifestKey("font", name), func() (interface{}, error) {
+            return LoadFont(path)
+        })
+    }
+}
+
+// looks up assets loaded from a manifest by their logical names
+type Resources struct {
+    Manifest *Manifest
+    loader   *Loader
+}
+
+func NewResources(m *Manifest, l *Loader) *Resources {
+    return &Resources{Manifest: m, loader: l}
+}
+
+func (r *Resources) Picture(name string) pixel.Picture {
+    return r.loader.Picture(manifestKey("sprite", name))
+}
+
+func (r *Resources) Atlas(name string) *Atlas {
+    atlas, _ := r.loader.Get(manifestKey("atlas", name)).(*Atlas)
+    return atlas
+}
+
+func (r *Resources) Aseprite(name string) *AsepriteSheet {
+    sheet, _ := r.loader.Get(manifestKey("aseprite", name)).(*AsepriteSheet)
+    return sheet
+}
+
+func (r *Resources) Font(name string) *Font {
+    f, _ := r.loader.Get(manifestKey("font", name)).(*Font)
+    return f
+}
+
+func (r *Resources) FontPath(name string) string {
+    return r.Manifest.Fonts[name]
+}
+
+func (r *Resources) SoundPath(name string) string {
+    return r.Manifest.Sounds[name]
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "strings"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+)
+
+// how wide the menus' panels are, in virtual pixels
+const MENUWIDTH = 320
+
+// how long the menus' fades take, in seconds
+const MENUFADE = 0.4
+
+// closes the window, so Run returns after this frame
+func Quit() {
+    if win != nil {
+        win.SetClosed(true)
+    }
+}
+
+// a panel width wide at the UI scale, as far as the screen allows, and tall enough for rows
+// widgets, in the middle of the screen
+func menuPanel(ui *UI, width float64, rows int) pixel.Rect {
+    style := ui.Scaled()
+    width = math.Min(width*accessibility.UIScale(), screen.Bounds().W())
+    h := float64(rows)*(style.RowHeight+style.Spacing) - style.Spacing + 2*style.Padding
+    c := screen.Bounds().Center()
+    return pixel.R(c.X-width/2, c.Y-h/2, c.X+width/2, c.Y+h/2)
+}
+
+// a button on a menu and what it does
+type MenuItem struct {
+    Label  string
+    Action func()
+}
+
+// a title screen: the game's name over Play, the game's own Items, Options and Quit. Play fades
+// to the scene NewGame makes, Options opens an OptionsScene over it and Quit closes the window.
+type MenuScene struct {
+    BaseScene
+    Title string
+    // the scene Play starts; no Play button when it's nil
+    NewGame func() Scene
+    // between Play and Options, e.g. Continue or Credits
+    Items []MenuItem
+    // plays while the menu is up, see MusicScene
+    Song Song
+    UI   *UI
+}
+
+func NewMenuScene(title string, newGame func() Scene) *MenuScene {
+    return &MenuScene{Title: title, NewGame: newGame, UI: NewUI()}
+}
+
+func (m *MenuScene) Music() Song {
+    return m.Song
+}
+
+func (m *MenuScene) Enter() {
+    if m.NewGame != nil {
+        m.UI.Focus("Play")
+    } else {
+        m.UI.Focus("Options")
+    }
+}
+
+func (m *MenuScene) HandleInput(in Input) {
+    rows := 4 + len(m.Items)
+    if m.NewGame != nil {
+        rows++
+    }
+    m.UI.Begin(in)
+    m.UI.BeginPanel(menuPanel(m.UI, MENUWIDTH, rows), 0)
+    m.UI.Title(m.Title)
+    if m.NewGame != nil && m.UI.Button("Play") {
+        scenes.ReplaceWith(m.NewGame(), scenes.NewTransition(TransitionFade, MENUFADE))
+    }
+    for _, item := range m.Items {
+        if m.UI.Button(item.Label) && item.Action != nil {
+            item.Action()
+        }
+    }
+    if m.UI.Button("Options") {
+        scenes.Push(NewOptionsScene())
+    }
+    if m.UI.Button("Quit") {
+        Quit()
+    }
+    m.UI.EndPanel()
+}
+
+func (m *MenuScene) Draw(t RenderTarget) {
+    m.UI.Draw(t)
+}
+
+// how much the pause menu darkens the frozen game, 0 to 1
+const PAUSEDIM = 0.6
+
+// Resume, Settings and Quit over the frozen game, darkened. Pause pushes it when the game pauses
+// and takes it off, with anything opened from it, when it resumes; Escape closes Settings first
+// and then resumes.
+type PauseMenuScene struct {
+    BaseScene
+    Title string
+    // between Resume and Settings, e.g. Save or Restart
+    Items []MenuItem
+    // what Quit does, e.g. going back to the title screen; nil closes the window
+    OnQuit func()
+    // 0 to 1, PAUSEDIM by default
+    Dim float64
+    UI  *UI
+
+    imd *imdraw.IMDraw
+}
+
+func NewPauseMenuScene() *PauseMenuScene {
+    return &PauseMenuScene{Title: "Paused", Dim: PAUSEDIM, UI: NewUI(), imd: imdraw.New(nil)}
+}
+
+func (m *PauseMenuScene) Overlay() bool {
+    return true
+}
+
+func (m *PauseMenuScene) Unpausable() bool {
+    return true
+}
+
+func (m *PauseMenuScene) Enter() {
+    m.UI.Focus("Resume")
+}
+
+func (m *PauseMenuScene) HandleInput(in Input) {
+    m.UI.Begin(in)
+    m.UI.BeginPanel(menuPanel(m.UI, MENUWIDTH, 5+len(m.Items)), 0)
+    m.UI.Title(m.Title)
+    if m.UI.Button("Resume") {
+        pause.Resume()
+    }
+    for _, item := range m.Items {
+        if m.UI.Button(item.Label) && item.Action != nil {
+            item.Action()
+        }
+    }
+    if m.UI.Button("Settings") {
+        options := NewOptionsScene()
+        options.Transparent = true
+        scenes.Push(options)
+    }
+    if m.UI.Button("Quit") {
+        if m.OnQuit == nil {
+            Quit()
+        } else {
+            // the game shouldn't come back frozen
+            pause.Resume()
+            m.OnQuit()
+        }
+    }
+    m.UI.EndPanel()
+}
+
+// the panel only shows while nothing's open over it
+func (m *PauseMenuScene) Draw(t RenderTarget) {
+    t.SetMatrix(pixel.IM)
+    m.imd.Clear()
+    m.imd.Color = pixel.RGBA{A: math.Max(0, math.Min(1, m.Dim))}
+    b := screen.Bounds()
+    m.imd.Push(b.Min, b.Max)
+    m.imd.Rectangle(0)
+    m.imd.Draw(t)
+    if scenes.Top() == m {
+        m.UI.Draw(t)
+    }
+}
+
+type optionsTab int
+
+const (
+    optionsAudio optionsTab = iota
+    optionsVideo
+    optionsControls
+    optionsAccessibility
+)
+
+// the player's settings: volumes, display, language, key bindings and accessibility, each change applied and
+// saved to the settings file straight away. cancel or Back pops it, so it works over a title
+// screen or a pause menu alike.
+type OptionsScene struct {
+    BaseScene
+    UI *UI
+    // draws the scene underneath around the panel
+    Transparent bool
+
+    tab optionsTab
+}
+
+func NewOptionsScene() *OptionsScene {
+    return &OptionsScene{UI: NewUI()}
+}
+
+func (o *OptionsScene) Overlay() bool {
+    return o.Transparent
+}
+
+// keeps working when it's opened from the pause menu
+func (o *OptionsScene) Unpausable() bool {
+    return true
+}
+
+func (o *OptionsScene) Enter() {
+    o.UI.Focus("Audio")
+}
+
+func (o *OptionsScene) Exit() {
+    if actions != nil {
+        actions.CancelRebind()
+    }
+}
+
+func (o *OptionsScene) HandleInput(in Input) {
+    ui := o.UI
+    ui.Begin(in)
+    rebinding := false
+    if actions != nil {
+        _, rebinding = actions.Rebinding()
+    }
+    ui.BeginPanel(menuPanel(ui, 1.5*MENUWIDTH, o.rows()), 0)
+    ui.Title("Options")
+    ui.BeginRow(4)
+    for tab, label := range []string{"Audio", "Video", "Controls", "Accessibility"} {
+        if ui.Button(label) {
+            o.tab = optionsTab(tab)
+        }
+    }
+    ui.EndRow()
+    switch o.tab {
+    case optionsAudio:
+        o.audio()
+    case optionsVideo:
+        o.video()
+    case optionsControls:
+        o.controls()
+    case optionsAccessibility:
+        o.accessibility()
+    }
+    ui.Space(ui.Scaled().RowHeight / 2)
+    // the key that cancels a rebind shouldn't also leave the screen
+    if ui.Button("Back") || (!rebinding && actions != nil && actions.JustPressed("cancel")) {
+        scenes.Pop()
+    }
+    ui.EndPanel()
+}
+
+// how many rows the current tab takes, with the title, the tabs and Back
+func (o *OptionsScene) rows() int {
+    rows := 5
+    switch o.tab {
+    case optionsAudio:
+        rows += int(AUDIOBUSES) + 1
+    case optionsVideo:
+        rows += 2
+        if len(locale.Languages()) > 1 {
+            rows++
+        }
+    case optionsControls:
+        if actions != nil {
+            rows += len(actions.Bindings.Actions()) + 1
+        }
+    case optionsAccessibility:
+        rows += 4
+    }
+    return rows
+}
+
+func (o *OptionsScene) audio() {
+    if audio == nil {
+        return
+    }
+    for b := BusMaster; b < AUDIOBUSES; b++ {
+        volume := audio.BusVolume(b)
+        name := b.String()
+        if o.UI.Slider(strings.ToUpper(name[:1])+name[1:], &volume, 0, 1) {
+            audio.SetBusVolume(b, volume)
+        }
+    }
+    spatial := audio.Volume().Spatial
+    if o.UI.Toggle("Positional sound", &spatial) {
+        audio.SetSpatial(spatial)
+    }
+}
+
+func (o *OptionsScene) video() {
+    if display != nil {
+        fullscreen := display.Mode() != DisplayWindowed
+        if o.UI.Toggle("Fullscreen", &fullscreen) {
+            if err := display.ToggleFullscreen(); err != nil {
+                settingsLog.Errorf("display: %v", err)
+            }
+        }
+    }
+    if settings != nil {
+        vsync := settings.VSync
+        if o.UI.Toggle("VSync", &vsync) {
+            settings.VSync = vsync
+            if win != nil {
+                win.SetVSync(vsync)
+            }
+            if err := settings.Save(); err != nil {
+                settingsLog.Errorf("%v", err)
+            }
+        }
+    }
+    // steps through the loaded languages
+    if langs := locale.Languages(); len(langs) > 1 {
+        lang := locale.Language()
+        if o.UI.Button(T("Language") + ": " + locale.Name(lang) + "##language") {
+            next := langs[(indexOf(langs, lang)+1)%len(langs)]
+            if err := locale.SetLanguage(next); err != nil {
+                localeLog.Errorf("%v", err)
+            }
+        }
+    }
+}
+
+// a button per action showing its keys; clicking one waits for the key to bind in place of
+// the first
+func (o *OptionsScene) controls() {
+    if actions == nil {
+        return
+    }
+    waiting, _ := actions.Rebinding()
+    for _, action := range actions.Bindings.Actions() {
+        var names []string
+        for _, b := range actions.Bindings[action] {
+            names = append(names, b.String())
+        }
+        label := fmt.Sprintf("%s: %s", action, strings.Join(names, ", "))
+        if action == waiting {
+            label = fmt.Sprintf("%s: %s", action, T("press a key, Escape to cancel"))
+        }
+        if o.UI.Button(label+"##"+action) && waiting == "" {
+            actions.Rebind(action, 0)
+        }
+    }
+    if o.UI.Button("Reset to defaults") {
+        for action, buttons := range DefaultKeyBindings() {
+            actions.Bind(action, buttons...)
+        }
+    }
+}
+
+func (o *OptionsScene) accessibility() {
+    a := accessibility.Settings()
+    // steps through the filters
+    name := string(a.ColorFilter)
+    if o.UI.Button(T("Color filter") + ": " + T(strings.ToUpper(name[:1])+name[1:]) + "##colorfilter") {
+        accessibility.SetColorFilter(a.ColorFilter.Next())
+    }
+    if o.UI.Slider("Filter strength", &a.FilterStrength, 0, 1) {
+        accessibility.SetFilterStrength(a.FilterStrength)
+    }
+    if o.UI.Slider("UI scale", &a.UIScale, UISCALEMIN, UISCALEMAX) {
+        accessibility.SetUIScale(a.UIScale)
+    }
+    if o.UI.Toggle("Reduce screen shake", &a.ReduceShake) {
+        accessibility.SetReduceShake(a.ReduceShake)
+    }
+}
+
+func (o *OptionsScene) Draw(t RenderTarget) {
+    o.UI.Draw(t)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+    "image/color"
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// largest side of the cached terrain image; bigger maps are rendered at a reduced scale
+const MINIMAPTERRAINMAX = 2048
+
+// something shown on the minimap, e.g. the player or a quest target. keep the pointer to move it.
+type MinimapMarker struct {
+    Position pixel.Vec
+    Color    color.Color
+    // diameter in minimap pixels
+    Size    float64
+    Visible bool
+}
+
+// a downscaled view of the world around a camera, drawn in screen space into Rect
+type Minimap struct {
+    Map    *TileMap
+    Camera *Camera
+    // screen area it's drawn into, see MinimapCorner
+    Rect pixel.Rect
+    // minimap pixels per world pixel
+    Zoom float64
+    // world point at the middle when there's no Camera
+    Center pixel.Vec
+
+    Background color.Color
+    // outlines the camera's visible area
+    ShowView  bool
+    ViewColor color.Color
+    // drawn around Rect when set, otherwise a FrameWidth outline in FrameColor
+    Frame      *NinePatch
+    FrameColor color.Color
+    FrameWidth float64
+    // clicking or dragging on the minimap recenters Camera
+    ClickToMove bool
+
+    markers  map[string]*MinimapMarker
+    onClick  []func(world pixel.Vec)
+    terrain  RenderCanvas
+    scale    float64
+    dirty    bool
+    canvas   RenderCanvas
+    imd      *imdraw.IMDraw
+    dragging bool
+}
+
+func NewMinimap(m *TileMap, cam *Camera, rect pixel.Rect) *Minimap {
+    return &Minimap{
+        Map:         m,
+        Camera:      cam,
+        Rect:        rect,
+        Zoom:        0.1,
+        Background:  pixel.RGBA{A: 0.8},
+        ShowView:    true,
+        ViewColor:   pixel.RGB(1, 1, 1),
+        FrameColor:  pixel.RGB(0.8, 0.8, 0.8),
+        FrameWidth:  2,
+        ClickToMove: true,
+        markers:     make(map[string]*MinimapMarker),
+        dirty:       true,
+        canvas:      graphics.NewCanvas(pixel.R(0, 0, rect.W(), rect.H())),
+        imd:         imdraw.New(nil),
+    }
+}
+
+// a rect of the given size in the top-right corner of bounds, margin pixels in from the edges
+func MinimapCorner(bounds pixel.Rect, size pixel.Vec, margin float64) pixel.Rect {
+    corner := bounds.Max.Sub(pixel.V(margin, margin))
+    return pixel.Rect{Min: corner.Sub(size), Max: corner}
+}
+
+// adds or replaces a named marker
+func (mm *Minimap) Mark(name string, pos pixel.Vec, c color.Color) *MinimapMarker {
+    marker := &MinimapMarker{Position: pos, Color: c, Size: 4, Visible: true}
+    mm.markers[name] = marker
+    return marker
+}
+
+func (mm *Minimap) Marker(name string) *MinimapMarker {
+    return mm.markers[name]
+}
+
+func (mm *Minimap) Unmark(name string) {
+    delete(mm.markers, name)
+}
+
+// calls fn with the world position whenever the minimap is clicked
+func (mm *Minimap) OnClick(fn func(world pixel.Vec)) {
+    mm.onClick = append(mm.onClick, fn)
+}
+
+// redraws the cached terrain, e.g. after tiles change or a new map is set
+func (mm *Minimap) Refresh() {
+    mm.dirty = true
+}
+
+func (mm *Minimap) center() pixel.Vec {
+    if mm.Camera != nil {
+        return mm.Camera.Position
+    }
+    return mm.Center
+}
+
+// from world space to the minimap canvas
+func (mm *Minimap) matrix() pixel.Matrix {
+    size := mm.Rect.Size()
+    return pixel.IM.Moved(mm.center().Scaled(-1)).Scaled(pixel.ZV, mm.Zoom).Moved(size.Scaled(0.5))
+}
+
+// the world position under a screen point inside Rect
+func (mm *Minimap) ToWorld(screen pixel.Vec) pixel.Vec {
+    return mm.matrix().Unproject(screen.Sub(mm.Rect.Min))
+}
+
+func (mm *Minimap) Contains(screen pixel.Vec) bool {
+    return mm.Rect.Contains(screen)
+}
+
+// handles clicks; mouse is in the same screen space as Rect, e.g. screen.MousePosition(win).
+// returns true while the minimap has the mouse, so the game can ignore that click.
+func (mm *Minimap) Update(in Input, mouse pixel.Vec) bool {
+    if in.JustPressed(pixelgl.MouseButtonLeft) && mm.Contains(mouse) {
+        mm.dragging = true
+        for _, fn := range mm.onClick {
+            fn(mm.ToWorld(mouse))
+        }
+    }
+    if !in.Pressed(pixelgl.MouseButtonLeft) {
+        mm.dragging = false
+    }
+    if mm.dragging && mm.ClickToMove && mm.Camera != nil {
+        // clamped to the minimap so dragging past its edge doesn't fling the camera
+        inside := pixel.V(
+            math.Max(mm.Rect.Min.X, math.Min(mm.Rect.Max.X, mouse.X)),
+            math.Max(mm.Rect.Min.Y, math.Min(mm.Rect.Max.Y, mouse.Y)),
+        )
+        mm.Camera.Position = mm.ToWorld(inside)
+        mm.Camera.Clamp()
+    }
+    return mm.dragging
+}
+
+// renders the whole map once at a scale that fits MINIMAPTERRAINMAX
+func (mm *Minimap) buildTerrain() {
+    mm.dirty = false
+    if mm.Map == nil {
+        return
+    }
+    bounds := mm.Map.Bounds()
+    mm.scale = math.Min(1, MINIMAPTERRAINMAX/math.Max(bounds.W(), bounds.H()))
+    size := pixel.R(0, 0, math.Ceil(bounds.W()*mm.scale), math.Ceil(bounds.H()*mm.scale))
+    if mm.terrain == nil {
+        mm.terrain = graphics.NewCanvas(size)
+        // filtered when zoomed, so shrunken tiles blend instead of dropping pixels
+        mm.terrain.SetSmooth(true)
+    }
+    mm.terrain.SetBounds(size)
+    mm.terrain.Clear(color.Transparent)
+    mm.terrain.SetMatrix(pixel.IM.Moved(bounds.Min.Scaled(-1)).Scaled(pixel.ZV, mm.scale))
+    mm.Map.Draw(mm.terrain)
+    mm.terrain.SetMatrix(pixel.IM)
+}
+
+func (mm *Minimap) Draw(t RenderTarget) {
+    if mm.dirty {
+        mm.buildTerrain()
+    }
+    size := mm.Rect.Size()
+    if mm.canvas.Bounds().Size() != size {
+        mm.canvas.SetBounds(pixel.R(0, 0, size.X, size.Y))
+    }
+    mm.canvas.Clear(mm.Background)
+    m := mm.matrix()
+
+    if mm.terrain != nil {
+        // the terrain canvas covers the map's bounds at mm.scale
+        world := mm.Map.Bounds()
+        mm.terrain.Draw(mm.canvas, pixel.IM.Scaled(pixel.ZV, mm.Zoom/mm.scale).Moved(m.Project(world.Center())))
+    }
+
+    mm.imd.Clear()
+    for _, marker := range mm.markers {
+        if !marker.Visible {
+            continue
+        }
+        mm.imd.Color = marker.Color
+        mm.imd.Push(m.Project(marker.Position))
+        mm.imd.Circle(marker.Size/2, 0)
+    }
+    if mm.ShowView && mm.Camera != nil {
+        view := mm.Camera.VisibleRect()
+        mm.imd.Color = mm.ViewColor
+        mm.imd.Push(m.Project(view.Min), m.Project(view.Max))
+        mm.imd.Rectangle(1)
+    }
+    mm.imd.Draw(mm.canvas)
+
+    t.SetMatrix(pixel.IM)
+    mm.canvas.Draw(t, pixel.IM.Moved(mm.Rect.Center()))
+    switch {
+    case mm.Frame != nil:
+        mm.Frame.Draw(t, mm.Rect)
+    case mm.FrameWidth > 0:
+        mm.imd.Clear()
+        mm.imd.Color = mm.FrameColor
+        mm.imd.Push(mm.Rect.Min, mm.Rect.Max)
+        mm.imd.Rectangle(mm.FrameWidth)
+        mm.imd.Draw(t)
+    }
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+    "fmt"
+    "math"
+
+    "github.com/faiface/beep"
+)
+
+// one of the mixer's channels, each with its own volume, mute and effects. music, effects and
+// voice all play through master.
+type AudioBus int
+
+const (
+    BusMaster AudioBus = iota
+    BusMusic
+    BusEffects
+    BusVoice
+    AUDIOBUSES
+)
+
+var audioBusNames = [AUDIOBUSES]string{"master", "music", "effects", "voice"}
+
+func (b AudioBus) String() string {
+    if b < 0 || b >= AUDIOBUSES {
+        return "unknown"
+    }
+    return audioBusNames[b]
+}
+
+// the bus called name, as the console and the settings file spell it
+func ParseAudioBus(name string) (AudioBus, error) {
+    for b, n := range audioBusNames {
+        if n == name {
+            return AudioBus(b), nil
+        }
+    }
+    return 0, fmt.Errorf("no audio bus %q", name)
+}
+
+// what the audio does while the game is in the background
+type AudioFocus string
+
+const (
+    // carries on as if nothing happened
+    AudioFocusPlay AudioFocus = "play"
+    // drops to VolumeSettings.DuckVolume
+    AudioFocusDuck AudioFocus = "duck"
+    AudioFocusMute AudioFocus = "mute"
+    // fades out and holds everything where it is, music and sounds, until the game comes back
+    AudioFocusPause AudioFocus = "pause"
+)
+
+// how many seconds the audio takes to duck or come back
+const AUDIOFOCUSFADE = 0.25
+
+// processes a bus's mix in place, e.g. a low-pass while underwater. it runs on the device's
+// goroutine with the mix locked, so it has to be quick and can't call back into Audio.
+type AudioEffect func(samples [][2]float64)
+
+// what's playing on a bus, run through its effects and scaled by its volume
+type audioBus struct {
+    mix     beep.Mixer
+    gain    float64
+    muted   bool
+    effects []AudioEffect
+}
+
+func (b *audioBus) Stream(samples [][2]float64) (int, bool) {
+    n, ok := b.mix.Stream(samples)
+    for _, fx := range b.effects {
+        fx(samples[:n])
+    }
+    gain := b.gain
+    if b.muted {
+        gain = 0
+    }
+    for i := range samples[:n] {
+        samples[i][0] *= gain
+        samples[i][1] *= gain
+    }
+    return n, ok
+}
+
+func (b *audioBus) Err() error {
+    return nil
+}
+
+// the volume saved for bus and whether it's muted
+func (v VolumeSettings) Level(bus AudioBus) (float64, bool) {
+    switch bus {
+    case BusMaster:
+        return v.Master, v.MasterMuted
+    case BusMusic:
+        return v.Music, v.MusicMuted
+    case BusEffects:
+        return v.Effects, v.EffectsMuted
+    case BusVoice:
+        return v.Voice, v.VoiceMuted
+    }
+    return 0, true
+}
+
+func (v *VolumeSettings) setLevel(bus AudioBus, volume float64, muted bool) {
+    switch bus {
+    case BusMaster:
+        v.Master, v.MasterMuted = volume, muted
+    case BusMusic:
+        v.Music, v.MusicMuted = volume, muted
+    case BusEffects:
+        v.Effects, v.EffectsMuted = volume, muted
+    case BusVoice:
+        v.Voice, v.VoiceMuted = volume, muted
+    }
+}
+
+// sends the audio into the background or brings it back, as settings.Volume.Unfocused says.
+// simulate calls it every frame: the game is in the background while the window doesn't have
+// focus, and after it gets it back while a pause that losing focus started is still on.
+func (a *Audio) SetBackground(background bool) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if background == a.background {
+        return
+    }
+    a.background = background
+    a.refocus()
+}
+
+func (a *Audio) Background() bool {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return a.background
+}
+
+// fades to the volume the focus calls for; call with the lock held
+func (a *Audio) refocus() {
+    target := 1.0
+    a.frozen = false
+    if a.background {
+        switch a.volume.Unfocused {
+        case AudioFocusDuck:
+            target = math.Max(0, math.Min(1, a.volume.DuckVolume))
+        case AudioFocusMute:
+            target = 0
+        case AudioFocusPause:
+            target, a.frozen = 0, true
+        }
+    }
+    a.focus.fade(target, AUDIOFOCUSFADE)
+}
+
+// registers fn to run with the volumes whenever SetBusVolume, Mute or SetSpatial changes them,
+// e.g. to save the settings
+func (a *Audio) OnChange(fn func(VolumeSettings) error) {
+    a.onChange = append(a.onChange, fn)
+}
+
+func (a *Audio) changed() {
+    v := a.Volume()
+    for _, fn := range a.onChange {
+        if err := fn(v); err != nil {
+            settingsLog.Errorf("volume: %v", err)
+        }
+    }
+}
+
+// sets bus's volume, 0 silent to 1 full, clamped to that, e.g. from an options slider
+func (a *Audio) SetBusVolume(bus AudioBus, volume float64) {
+    if bus < 0 || bus >= AUDIOBUSES {
+        return
+    }
+    volume = math.Max(0, math.Min(1, volume))
+    a.mu.Lock()
+    _, muted := a.volume.Level(bus)
+    a.volume.setLevel(bus, volume, muted)
+    a.buses[bus].gain = volume
+    a.mu.Unlock()
+    a.changed()
+}
+
+func (a *Audio) BusVolume(bus AudioBus) float64 {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    volume, _ := a.volume.Level(bus)
+    return volume
+}
+
+// silences bus without forgetting its volume, so unmuting brings it back where it was
+func (a *Audio) Mute(bus AudioBus, muted bool) {
+    if bus < 0 || bus >= AUDIOBUSES {
+        return
+    }
+    a.mu.Lock()
+    volume, _ := a.volume.Level(bus)
+    a.volume.setLevel(bus, volume, muted)
+    a.buses[bus].muted = muted
+    a.mu.Unlock()
+    a.changed()
+}
+
+func (a *Audio) Muted(bus AudioBus) bool {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    _, muted := a.volume.Level(bus)
+    return muted
+}
+
+// runs fx over bus's mix after the effects added before it, and before its volume
+func (a *Audio) AddEffect(bus AudioBus, fx AudioEffect) {
+    if bus < 0 || bus >= AUDIOBUSES {
+        return
+    }
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    a.buses[bus].effects = append(a.buses[bus].effects, fx)
+}
+
+func (a *Audio) ClearEffects(bus AudioBus) {
+    if bus < 0 || bus >= AUDIOBUSES {
+        return
+    }
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    a.buses[bus].effects = nil
+}
+
+// the console's volume and mute commands, which save like an options menu would
+func registerAudioCommands(c *Console, a *Audio) {
+    c.Register("volume", "shows every bus's volume, or sets one from 0 to 1", func(args ConsoleArgs) error {
+        if !args.Has(0) {
+            for b := BusMaster; b < AUDIOBUSES; b++ {
+                volume, muted := a.Volume().Level(b)
+                if muted {
+                    c.Printf("%-8s %.2f  muted", b, volume)
+                } else {
+                    c.Printf("%-8s %.2f", b, volume)
+                }
+            }
+            return nil
+        }
+        bus, err := ParseAudioBus(args.String(0))
+        if err != nil {
+            return err
+        }
+        if !args.Has(1) {
+            return fmt.Errorf("volume %s needs a level", bus)
+        }
+        a.SetBusVolume(bus, args.Float(1))
+        return nil
+    }, StringArg("bus").Opt(), FloatArg("level").Opt())
+    c.Register("mute", "mutes or unmutes a bus, master if none is given", func(args ConsoleArgs) error {
+        bus := BusMaster
+        if args.Has(0) {
+            var err error
+            if bus, err = ParseAudioBus(args.String(0)); err != nil {
+                return err
+            }
+        }
+        muted := !a.Muted(bus)
+        if args.Has(1) {
+            muted = args.Bool(1)
+        }
+        a.Mute(bus, muted)
+        return nil
+    }, StringArg("bus").Opt(), BoolArg("on").Opt())
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+var modLog = logging.Module("mods")
+
+// where players drop mods, next to the game rather than inside its assets
+const MODDIR = "mods"
+
+// every mod describes itself in this file at its root
+const MODMANIFEST = "mod.json"
+
+// optional, in MODDIR: the order mods load in and which are switched off
+const MODORDERPATH = "load_order.json"
+
+// what a mod says about itself in mod.json
+type ModInfo struct {
+    ID          string `json:"id"`
+    Name        string `json:"name"`
+    Version     string `json:"version"`
+    Author      string `json:"author,omitempty"`
+    Description string `json:"description,omitempty"`
+    // mods that must be present; without them this one is skipped
+    Requires []string `json:"requires,omitempty"`
+    // mods this one loads after when they're present, so its files win over theirs
+    After []string `json:"after,omitempty"`
+    // breaks ties between mods load_order.json doesn't mention, lowest first
+    Priority int `json:"priority,omitempty"`
+}
+
+// a content pack: a directory or .pak in MODDIR whose files overlay the game's assets under the
+// same paths, e.g. mods/hd/sprites/player.png replaces sprites/player.png. its assets.json is
+// merged into the game's manifest instead of replacing it, so it can add names as well.
+type Mod struct {
+    ModInfo
+    // where it was found on disk
+    Path string
+    // the asset paths it provides, sorted
+    Files []string
+
+    fsys   fs.FS
+    closer io.Closer
+}
+
+// load_order.json, e.g. {"order": ["base-fixes", "hd"], "disabled": ["hardmode"]}
+type ModOrder struct {
+    Order    []string `json:"order"`
+    Disabled []string `json:"disabled,omitempty"`
+}
+
+// the mods found in a directory, in load order: where two provide the same file or manifest
+// name, the later one wins and the clash is kept in Conflicts
+type Mods struct {
+    Dir    string
+    Loaded []*Mod
+    // mods that were found but aren't loaded, by ID (or path when mod.json was unreadable)
+    Skipped map[string]error
+    // asset paths and manifest names ("sprite:player") given by more than one mod, to the mods
+    // giving them in load order
+    Conflicts map[string][]string
+}
+
+// scans dir for mods. a missing dir means no mods; a broken mod is skipped and logged rather
+// than stopping the game.
+func LoadMods(dir string) (*Mods, error) {
+    m := &Mods{Dir: dir, Skipped: make(map[string]error), Conflicts: make(map[string][]string)}
+    entries, err := os.ReadDir(dir)
+    if os.IsNotExist(err) {
+        return m, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("mods %s: %v", dir, err)
+    }
+
+    order, err := readModOrder(filepath.Join(dir, MODORDERPATH))
+    if err != nil {
+        return nil, err
+    }
+    disabled := make(map[string]bool)
+    for _, id := range order.Disabled {
+        disabled[id] = true
+    }
+
+    found := make(map[string]*Mod)
+    for _, entry := range entries {
+        path := filepath.Join(dir, entry.Name())
+        if !entry.IsDir() && filepath.Ext(path) != ".pak" {
+            continue
+        }
+        mod, err := openMod(path)
+        if err != nil {
+            m.Skipped[path] = err
+            modLog.Warnf("%v", err)
+            continue
+        }
+        if other, ok := found[mod.ID]; ok {
+            m.Skipped[mod.ID] = fmt.Errorf("mod %s: %s and %s share the id", mod.ID, other.Path, mod.Path)
+            modLog.Warnf("%v, ignoring the second", m.Skipped[mod.ID])
+            mod.close()
+            continue
+        }
+        if disabled[mod.ID] {
+            m.Skipped[mod.ID] = fmt.Errorf("mod %s: disabled", mod.ID)
+            mod.close()
+            continue
+        }
+        found[mod.ID] = mod
+    }
+
+    m.Loaded = m.sortMods(found, order.Order)
+    m.findConflicts()
+    for _, mod := range m.Loaded {
+        modLog.Infof("loaded %s %s (%s)", mod.ID, mod.Version, mod.Path)
+    }
+    return m, nil
+}
+
+func readModOrder(path string) (ModOrder, error) {
+    var order ModOrder
+    data, err := os.ReadFile(path)
+    if os.IsNotExist(err) {
+        return order, nil
+    }
+    if err != nil {
+        return order, err
+    }
+    if err := json.Unmarshal(data, &order); err != nil {
+        return order, fmt.Errorf("mods %s: %v", path, err)
+    }
+    return order, nil
+}
+
+func openMod(path string) (*Mod, error) {
+    mod := &Mod{Path: path}
+    if filepath.Ext(path) == ".pak" {
+        pak, err := OpenPak(path, true)
+        if err != nil {
+            return nil, fmt.Errorf("mod %s: %v", path, err)
+        }
+        mod.fsys, mod.closer = pak, pak
+    } else {
+        mod.fsys = os.DirFS(path)
+    }
+
+    data, err := fs.ReadFile(mod.fsys, MODMANIFEST)
+    if err == nil {
+        err = json.Unmarshal(data, &mod.ModInfo)
+    }
+    if err == nil && mod.ID == "" {
+        err = errors.New("no id")
+    }
+    if err != nil {
+        mod.close()
+        return nil, fmt.Errorf("mod %s: %s: %v", path, MODMANIFEST, err)
+    }
+
+    err = fs.WalkDir(mod.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() || strings.HasPrefix(d.Name(), ".") || modOwnFile(name) {
+            return nil
+        }
+        mod.Files = append(mod.Files, name)
+        return nil
+    })
+    if err != nil {
+        mod.close()
+        return nil, fmt.Errorf("mod %s: %v", path, err)
+    }
+    sort.Strings(mod.Files)
+    return mod, nil
+}
+
+// files a mod keeps to itself instead of overlaying the game's
+func modOwnFile(name string) bool {
+    return name == MODMANIFEST || name == MANIFESTPATH
+}
+
+func (mod *Mod) close() {
+    if mod.closer != nil {
+        mod.closer.Close()
+    }
+}
+
+// load_order.json's order first, then the rest by Priority and ID, then each mod moved after
+// those its After and Requires name. mods missing a requirement or caught in a cycle are skipped.
+func (m *Mods) sortMods(found map[string]*Mod, explicit []string) []*Mod {
+    var pending []*Mod
+    listed := make(map[string]bool)
+    for _, id := range explicit {
+        if mod, ok := found[id]; ok && !listed[id] {
+            listed[id] = true
+            pending = append(pending, mod)
+        }
+    }
+    var rest []*Mod
+    for id, mod := range found {
+        if !listed[id] {
+            rest = append(rest, mod)
+        }
+    }
+    sort.Slice(rest, func(i, j int) bool {
+        if rest[i].Priority != rest[j].Priority {
+            return rest[i].Priority < rest[j].Priority
+        }
+        return rest[i].ID < rest[j].ID
+    })
+    pending = append(pending, rest...)
+
+    // dropping a mod can strand others that require it, so repeat until nothing changes
+    for changed := true; changed; {
+        changed = false
+        present := make(map[string]bool)
+        for _, mod := range pending {
+            present[mod.ID] = true
+        }
+        kept := pending[:0]
+        for _, mod := range pending {
+            if missing := missingMods(mod.Requires, present); len(missing) > 0 {
+                m.skip(mod, fmt.Errorf("mod %s: requires %s", mod.ID, strings.Join(missing, ", ")))
+                changed = true
+                continue
+            }
+            kept = append(kept, mod)
+        }
+        pending = kept
+    }
+
+    present := make(map[string]bool)
+    for _, mod := range pending {
+        present[mod.ID] = true
+    }
+    var sorted []*Mod
+    placed := make(map[string]bool)
+    for len(pending) > 0 {
+        next := -1
+        for i, mod := range pending {
+            if modReady(mod, present, placed) {
+                next = i
+                break
+            }
+        }
+        if next < 0 {
+            for _, mod := range pending {
+                m.skip(mod, fmt.Errorf("mod %s: its load order forms a cycle", mod.ID))
+            }
+            break
+        }
+        placed[pending[next].ID] = true
+        sorted = append(sorted, pending[next])
+        pending = append(pending[:next], pending[next+1:]...)
+    }
+    return sorted
+}
+
+func (m *Mods) skip(mod *Mod, err error) {
+    m.Skipped[mod.ID] = err
+    modLog.Warnf("%v", err)
+    mod.close()
+}
+
+func missingMods(ids []string, present map[string]bool) []string {
+    var missing []string
+    for _, id := range ids {
+        if !present[id] {
+            missing = append(missing, id)
+        }
+    }
+    return missing
+}
+
+func modReady(mod *Mod, present, placed map[string]bool) bool {
+    for _, id := range append(append([]string(nil), mod.Requires...), mod.After...) {
+        if present[id] && !placed[id] {
+            return false
+        }
+    }
+    return true
+}
+
+func (m *Mods) findConflicts() {
+    providers := make(map[string][]string)
+    for _, mod := range m.Loaded {
+        for _, file := range mod.Files {
+            providers[file] = append(providers[file], mod.ID)
+        }
+    }
+    for file, ids := range providers {
+        if len(ids) > 1 {
+            m.Conflicts[file] = ids
+            modLog.Warnf("%s is in %s, using %s's", file, strings.Join(ids, " and "), ids[len(ids)-1])
+        }
+    }
+}
+
+// base with every loaded mod layered over it, the last in load order on top
+func (m *Mods) FS(base fs.FS) fs.FS {
+    if len(m.Loaded) == 0 {
+        return base
+    }
+    layers := make([]fs.FS, 0, len(m.Loaded)+1)
+    for i := len(m.Loaded) - 1; i >= 0; i-- {
+        layers = append(layers, modFS{m.Loaded[i].fsys})
+    }
+    return overlayFS(append(layers, base))
+}
+
+// adds each mod's assets.json to manifest, in load order, so a mod can both replace names the
+// game defines and add its own. clashing names between mods are recorded like clashing files.
+func (m *Mods) MergeManifest(manifest *Manifest) error {
+    for _, section := range []*map[string]string{&manifest.Sprites, &manifest.Atlases, &manifest.Aseprite, &manifest.Fonts, &manifest.Sounds} {
+        if *section == nil {
+            *section = make(map[string]string)
+        }
+    }
+    given := make(map[string][]string)
+    for _, mod := range m.Loaded {
+        data, err := fs.ReadFile(mod.fsys, MANIFESTPATH)
+        if errors.Is(err, fs.ErrNotExist) {
+            continue
+        }
+        if err != nil {
+            return fmt.Errorf("mod %s: %v", mod.ID, err)
+        }
+        var extra Manifest
+        if err := json.Unmarshal(data, &extra); err != nil {
+            return fmt.Errorf("mod %s: %s: %v", mod.ID, MANIFESTPATH, err)
+        }
+        ours, theirs := manifest.sections(), extra.sections()
+        for i := range ours {
+            for name, path := range theirs[i].names {
+                ours[i].names[name] = path
+                key := manifestKey(ours[i].kind, name)
+                given[key] = append(given[key], mod.ID)
+            }
+        }
+    }
+    for key, ids := range given {
+        if len(ids) > 1 {
+            m.Conflicts[key] = ids
+            modLog.Warnf("%s is in %s, using %s's", key, strings.Join(ids, " and "), ids[len(ids)-1])
+        }
+    }
+    return nil
+}
+
+func (m *Mods) Close() {
+    for _, mod := range m.Loaded {
+        mod.close()
+    }
+}
+
+// asset lookups try each layer in turn, the first being on top
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+    for _, layer := range o {
+        f, err := layer.Open(name)
+        if err == nil {
+            return f, nil
+        }
+        if !errors.Is(err, fs.ErrNotExist) {
+            return nil, err
+        }
+    }
+    return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// the union of every layer's entries, so globbing a directory finds what mods add to it
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+    seen := make(map[string]bool)
+    var entries []fs.DirEntry
+    found := false
+    for _, layer := range o {
+        list, err := fs.ReadDir(layer, name)
+        if err != nil {
+            if errors.Is(err, fs.ErrNotExist) {
+                continue
+            }
+            return nil, err
+        }
+        found = true
+        for _, e := range list {
+            if !seen[e.Name()] {
+                seen[e.Name()] = true
+                entries = append(entries, e)
+            }
+        }
+    }
+    if !found {
+        return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+    }
+    sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+    return entries, nil
+}
+
+// a mod's files minus the ones it keeps to itself
+type modFS struct {
+    fsys fs.FS
+}
+
+func (m modFS) Open(name string) (fs.File, error) {
+    if modOwnFile(name) {
+        return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+    }
+    return m.fsys.Open(name)
+}
+
+func (m modFS) ReadDir(name string) ([]fs.DirEntry, error) {
+    list, err := fs.ReadDir(m.fsys, name)
+    if err != nil || name != "." {
+        return list, err
+    }
+    entries := list[:0]
+    for _, e := range list {
+        if !modOwnFile(e.Name()) {
+            entries = append(entries, e)
+        }
+    }
+    return entries, nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// how far, in virtual pixels, the mouse moves with a button down before a press is a drag
+// rather than a click
+const DRAGTHRESHOLD = 4
+
+// the most real seconds between the clicks of a double or triple click
+const DOUBLECLICKTIME = 0.35
+
+// how far apart, in virtual pixels, the clicks of a double or triple click can land
+const CLICKDISTANCE = 4
+
+// the buttons Mouse follows: left, right and middle
+const MOUSEBUTTONS = 3
+
+// a drag in progress, in virtual screen coordinates
+type MouseDrag struct {
+    Button pixelgl.Button
+    // where the button went down, where the mouse is now, and how far it moved this frame
+    Start, Position, Delta pixel.Vec
+}
+
+// how far the drag has moved in all
+func (d MouseDrag) Offset() pixel.Vec {
+    return d.Position.Sub(d.Start)
+}
+
+// a rect Mouse reports the mouse entering and leaving, e.g. a button or a map tile
+type HoverArea struct {
+    // in virtual screen coordinates; move it freely
+    Rect    pixel.Rect
+    Enabled bool
+    Hovered bool
+
+    onEnter, onLeave []func()
+}
+
+func (h *HoverArea) OnEnter(fn func()) {
+    h.onEnter = append(h.onEnter, fn)
+}
+
+func (h *HoverArea) OnLeave(fn func()) {
+    h.onLeave = append(h.onLeave, fn)
+}
+
+type mouseButton struct {
+    down, dragging bool
+    start          pixel.Vec
+    lastClick      float64
+    lastClickAt    pixel.Vec
+    // clicks in the current run, each within DoubleClickTime and ClickDistance of the last
+    count int
+    // what happened this frame
+    clicked, dragStarted, dragEnded bool
+}
+
+// clicks, drags and hovering worked out from the raw buttons, so UI and map panning don't each
+// redo it. a press becomes a drag once it moves DragThreshold, and is a click when it's released
+// before then, so a drag never also clicks. positions are in virtual screen coordinates.
+type Mouse struct {
+    DragThreshold   float64
+    DoubleClickTime float64
+    ClickDistance   float64
+    // this frame's position and how far it moved since the last
+    Position, Delta pixel.Vec
+    // while Captured, how far the mouse moved this frame in window pixels times Sensitivity,
+    // unbounded by the window's edges
+    Relative    pixel.Vec
+    Sensitivity float64
+
+    buttons [MOUSEBUTTONS]mouseButton
+    areas   []*HoverArea
+    hovered *HoverArea
+    started bool
+    capture bool
+
+    onClick, onDoubleClick         []func(b pixelgl.Button, pos pixel.Vec)
+    onMultiClick                   []func(b pixelgl.Button, pos pixel.Vec, count int)
+    onDragStart, onDrag, onDragEnd []func(MouseDrag)
+}
+
+func NewMouse() *Mouse {
+    return &Mouse{
+        DragThreshold:   DRAGTHRESHOLD,
+        DoubleClickTime: DOUBLECLICKTIME,
+        ClickDistance:   CLICKDISTANCE,
+        Sensitivity:     1,
+    }
+}
+
+// hides the cursor and locks it to the window for relative movement, e.g. aiming or a free
+// camera. it lets go by itself when the window loses focus or Escape is pressed; call Capture
+// again, say on the next click, to take it back.
+func (m *Mouse) Capture() {
+    if m.capture {
+        return
+    }
+    m.capture = true
+    if win != nil {
+        win.SetCursorDisabled()
+    }
+}
+
+// gives the cursor back
+func (m *Mouse) Release() {
+    if !m.capture {
+        return
+    }
+    m.capture = false
+    m.Relative = pixel.ZV
+    if win != nil {
+        win.SetCursorVisible(true)
+    }
+}
+
+func (m *Mouse) Captured() bool {
+    return m.capture
+}
+
+func (m *Mouse) OnClick(fn func(b pixelgl.Button, pos pixel.Vec)) {
+    m.onClick = append(m.onClick, fn)
+}
+
+func (m *Mouse) OnDoubleClick(fn func(b pixelgl.Button, pos pixel.Vec)) {
+    m.onDoubleClick = append(m.onDoubleClick, fn)
+}
+
+// registers fn for every click with how many it makes in a row: 1, then 2 for a double click,
+// 3 for a triple and so on
+func (m *Mouse) OnMultiClick(fn func(b pixelgl.Button, pos pixel.Vec, count int)) {
+    m.onMultiClick = append(m.onMultiClick, fn)
+}
+
+func (m *Mouse) OnDragStart(fn func(MouseDrag)) {
+    m.onDragStart = append(m.onDragStart, fn)
+}
+
+// registers fn for every frame a drag moves
+func (m *Mouse) OnDrag(fn func(MouseDrag)) {
+    m.onDrag = append(m.onDrag, fn)
+}
+
+func (m *Mouse) OnDragEnd(fn func(MouseDrag)) {
+    m.onDragEnd = append(m.onDragEnd, fn)
+}
+
+// starts reporting the mouse over rect. areas added later sit on top, so only the topmost of
+// overlapping areas is hovered.
+func (m *Mouse) AddHover(rect pixel.Rect) *HoverArea {
+    h := &HoverArea{Rect: rect, Enabled: true}
+    m.areas = append(m.areas, h)
+    return h
+}
+
+func (m *Mouse) RemoveHover(h *HoverArea) {
+    for i, area := range m.areas {
+        if area == h {
+            m.areas = append(m.areas[:i:i], m.areas[i+1:]...)
+            break
+        }
+    }
+    if m.hovered == h {
+        m.hovered = nil
+        h.Hovered = false
+    }
+}
+
+// the area under the mouse, or nil
+func (m *Mouse) Hovered() *HoverArea {
+    return m.hovered
+}
+
+// reads this frame's mouse from in; simulate calls it every frame
+func (m *Mouse) Update(in Input) {
+    pos := screen.MousePosition(in)
+    if m.started {
+        m.Delta = pos.Sub(m.Position)
+    }
+    m.Position, m.started = pos, true
+    now := clock.UnscaledTotal()
+    if m.capture && (!in.Focused() || in.JustPressed(pixelgl.KeyEscape)) {
+        m.Release()
+    }
+    if m.capture {
+        m.Relative = in.MousePosition().Sub(in.MousePreviousPosition()).Scaled(m.Sensitivity)
+    }
+
+    for i := range m.buttons {
+        b := &m.buttons[i]
+        button := pixelgl.MouseButton1 + pixelgl.Button(i)
+        b.clicked, b.dragStarted, b.dragEnded = false, false, false
+        down := in.Pressed(button)
+        switch {
+        case down && !b.down:
+            b.start = pos
+        case down && !b.dragging && pos.Sub(b.start).Len() >= m.DragThreshold:
+            b.dragging, b.dragStarted = true, true
+            drag := m.drag(button)
+            for _, fn := range m.onDragStart {
+                fn(drag)
+            }
+        case !down && b.down && b.dragging:
+            b.dragging, b.dragEnded = false, true
+            drag := m.drag(button)
+            for _, fn := range m.onDragEnd {
+                fn(drag)
+            }
+        case !down && b.down:
+            b.clicked = true
+            if b.count > 0 && now-b.lastClick <= m.DoubleClickTime && pos.Sub(b.lastClickAt).Len() <= m.ClickDistance {
+                b.count++
+            } else {
+                b.count = 1
+            }
+            b.lastClick, b.lastClickAt = now, pos
+            for _, fn := range m.onClick {
+                fn(button, pos)
+            }
+            if b.count == 2 {
+                for _, fn := range m.onDoubleClick {
+                    fn(button, pos)
+                }
+            }
+            for _, fn := range m.onMultiClick {
+                fn(button, pos, b.count)
+            }
+        }
+        b.down = down
+        if b.dragging && !b.dragStarted && m.Delta != pixel.ZV {
+            drag := m.drag(button)
+            for _, fn := range m.onDrag {
+                fn(drag)
+            }
+        }
+    }
+
+    m.updateHover(in.MouseInsideWindow())
+}
+
+func (m *Mouse) updateHover(inside bool) {
+    var top *HoverArea
+    if inside {
+        for i := len(m.areas) - 1; i >= 0; i-- {
+            if area := m.areas[i]; area.Enabled && area.Rect.Contains(m.Position) {
+                top = area
+                break
+            }
+        }
+    }
+    if top == m.hovered {
+        return
+    }
+    if old := m.hovered; old != nil {
+        old.Hovered = false
+        for _, fn := range old.onLeave {
+            fn()
+        }
+    }
+    m.hovered = top
+    if top != nil {
+        top.Hovered = true
+        for _, fn := range top.onEnter {
+            fn()
+        }
+    }
+}
+
+func (m *Mouse) state(b pixelgl.Button) *mouseButton {
+    i := int(b - pixelgl.MouseButton1)
+    if i < 0 || i >= MOUSEBUTTONS {
+        return &mouseButton{}
+    }
+    return &m.buttons[i]
+}
+
+func (m *Mouse) drag(b pixelgl.Button) MouseDrag {
+    return MouseDrag{Button: b, Start: m.state(b).start, Position: m.Position, Delta: m.Delta}
+}
+
+// whether b was released this frame without having dragged
+func (m *Mouse) Clicked(b pixelgl.Button) bool {
+    return m.state(b).clicked
+}
+
+// how many clicks in a row b's click this frame makes, or 0 when it didn't click
+func (m *Mouse) Clicks(b pixelgl.Button) int {
+    if s := m.state(b); s.clicked {
+        return s.count
+    }
+    return 0
+}
+
+func (m *Mouse) DoubleClicked(b pixelgl.Button) bool {
+    return m.Clicks(b) == 2
+}
+
+func (m *Mouse) TripleClicked(b pixelgl.Button) bool {
+    return m.Clicks(b) == 3
+}
+
+// the drag b is making, if it's dragging
+func (m *Mouse) Drag(b pixelgl.Button) (MouseDrag, bool) {
+    return m.drag(b), m.state(b).dragging
+}
+
+func (m *Mouse) DragStarted(b pixelgl.Button) bool {
+    return m.state(b).dragStarted
+}
+
+// the drag b let go of this frame, if it did
+func (m *Mouse) DragEnded(b pixelgl.Button) (MouseDrag, bool) {
+    return m.drag(b), m.state(b).dragEnded
+}
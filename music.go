@@ -0,0 +1,468 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "sync"
+    "time"
+
+    "github.com/faiface/beep"
+)
+
+// how many seconds songs crossfade for when a MusicScene comes up without a transition
+const MUSICFADE = 1.5
+
+// how many seconds a stem takes to come in or drop out as the intensity changes
+const STEMFADE = 0.5
+
+// how much of a song is decoded ahead of the device, so a slow read or decode doesn't starve it
+const MUSICPREBUFFER = 2 * time.Second
+
+// how many samples of each stem are decoded at a time
+const MUSICCHUNK = 4096
+
+// music to stream: one file, or stems of the same length and rate that play in sync, so layers
+// can come in and drop out as the game gets more intense
+type Song struct {
+    // the first is the base layer
+    Stems []string
+    // in seconds: reaching LoopEnd jumps back to LoopStart, so an intro before LoopStart plays
+    // only once. a LoopEnd of 0 is the end of the file.
+    LoopStart, LoopEnd float64
+    // plays through once and stops when false
+    Loop bool
+    // the intensity, 0 to 1, at which each stem comes in, see SetIntensity; stems past the end
+    // of it always play
+    Intensity []float64
+}
+
+// one looping file
+func NewSong(path string) Song {
+    return Song{Stems: []string{path}, Loop: true}
+}
+
+func (s Song) same(other Song) bool {
+    if len(s.Stems) != len(other.Stems) || s.LoopStart != other.LoopStart || s.LoopEnd != other.LoopEnd || s.Loop != other.Loop {
+        return false
+    }
+    for i := range s.Stems {
+        if s.Stems[i] != other.Stems[i] {
+            return false
+        }
+    }
+    return true
+}
+
+// the intensity stem i comes in at
+func (s Song) threshold(i int) float64 {
+    if i < len(s.Intensity) {
+        return s.Intensity[i]
+    }
+    return 0
+}
+
+// moves its gain toward target a little every sample, so fades don't click
+type fader struct {
+    streamer     beep.Streamer
+    gain, target float64
+    // how much gain changes per sample
+    step float64
+    // ends the stream once it's faded out, so the mixer lets go of it
+    drain bool
+    // whether streamer ran out
+    ended bool
+}
+
+// starts moving to target over seconds; 0 seconds jumps there
+func (f *fader) fade(target, seconds float64) {
+    f.target = target
+    if seconds <= 0 {
+        f.gain = target
+        return
+    }
+    f.step = math.Abs(target-f.gain) / (seconds * float64(AUDIORATE))
+}
+
+func (f *fader) finished() bool {
+    return f.ended || f.drain && f.gain == 0 && f.target == 0
+}
+
+// moves the gain one sample's worth toward the target and returns it
+func (f *fader) next() float64 {
+    switch {
+    case f.gain < f.target:
+        f.gain = math.Min(f.target, f.gain+f.step)
+    case f.gain > f.target:
+        f.gain = math.Max(f.target, f.gain-f.step)
+    }
+    return f.gain
+}
+
+func (f *fader) Stream(samples [][2]float64) (int, bool) {
+    if f.finished() {
+        return 0, false
+    }
+    n, ok := f.streamer.Stream(samples)
+    for i := range samples[:n] {
+        gain := f.next()
+        samples[i][0] *= gain
+        samples[i][1] *= gain
+    }
+    f.ended = !ok
+    return n, ok
+}
+
+func (f *fader) Err() error {
+    return f.streamer.Err()
+}
+
+// plays s up to end, then from start again while loop is set; end 0 is the end of s, and so is
+// a Len of 0 from a decoder that can't tell
+type loopStreamer struct {
+    s          beep.StreamSeeker
+    start, end int
+    loop       bool
+    err        error
+}
+
+func (l *loopStreamer) Stream(samples [][2]float64) (int, bool) {
+    filled := 0
+    // a seek back that yields nothing would otherwise spin forever
+    wrapped := false
+    for filled < len(samples) && l.err == nil {
+        end := l.s.Len()
+        if l.end > 0 && (l.end < end || end <= 0) {
+            end = l.end
+        }
+        left := len(samples) - filled
+        if end > 0 {
+            left = end - l.s.Position()
+        }
+        if left <= 0 {
+            if !l.loop || wrapped {
+                break
+            }
+            if err := l.s.Seek(l.start); err != nil {
+                l.err = err
+                break
+            }
+            wrapped = true
+            continue
+        }
+        want := len(samples) - filled
+        if left < want {
+            want = left
+        }
+        n, ok := l.s.Stream(samples[filled : filled+want])
+        filled += n
+        if n > 0 {
+            wrapped = false
+        }
+        if !ok || n == 0 {
+            // shorter than Len said, or cut off; go round from here
+            if err := l.s.Err(); err != nil {
+                l.err = err
+            }
+            if !l.loop || wrapped {
+                break
+            }
+            if err := l.s.Seek(l.start); err != nil {
+                l.err = err
+                break
+            }
+            wrapped = true
+        }
+    }
+    return filled, filled > 0
+}
+
+func (l *loopStreamer) Err() error {
+    return l.err
+}
+
+type musicStem struct {
+    name   string
+    stream beep.StreamSeekCloser
+    // the stem looped and resampled, read only by the decoding goroutine
+    source beep.Streamer
+    // fades with the intensity; only its gain is used
+    fader *fader
+    // set by MuteStem, whatever the intensity
+    muted bool
+    // whether it's stopped, having ended or failed to decode
+    done bool
+}
+
+// MUSICCHUNK samples of every stem, decoded together so they stay in sync
+type musicChunk [][][2]float64
+
+// a song streaming from its files, faded as a whole for crossfades. a goroutine decodes it
+// MUSICPREBUFFER ahead of the device, which only mixes what's ready: when decoding falls behind,
+// the song goes quiet for a moment rather than stalling everything else. a stem that fails to
+// decode partway is logged and drops out, and the rest play on.
+type musicTrack struct {
+    song  Song
+    stems []*musicStem
+    fader *fader
+
+    chunks  chan musicChunk
+    stop    chan struct{}
+    decoder sync.WaitGroup
+    // the chunk being mixed, and how far into it
+    current musicChunk
+    pos     int
+}
+
+// stops decoding and closes the files
+func (t *musicTrack) close() {
+    if t == nil {
+        return
+    }
+    if t.stop != nil {
+        close(t.stop)
+        t.decoder.Wait()
+        t.stop = nil
+    }
+    for _, stem := range t.stems {
+        stem.stream.Close()
+    }
+}
+
+// whether stem i should be heard at intensity
+func (t *musicTrack) audible(i int, intensity float64) bool {
+    return !t.stems[i].muted && intensity >= t.song.threshold(i)
+}
+
+// the next chunk of every stem, stems that finished early padded with silence; nil once they've
+// all finished
+func (t *musicTrack) decode() musicChunk {
+    chunk := make(musicChunk, len(t.stems))
+    longest := 0
+    for i, stem := range t.stems {
+        chunk[i] = make([][2]float64, MUSICCHUNK)
+        if stem.done {
+            continue
+        }
+        n := 0
+        for n < MUSICCHUNK {
+            got, ok := stem.source.Stream(chunk[i][n:])
+            n += got
+            if !ok || got == 0 {
+                stem.done = true
+                if err := stem.source.Err(); err != nil {
+                    audioLog.Warnf("%s: %v", stem.name, err)
+                }
+                break
+            }
+        }
+        if n > longest {
+            longest = n
+        }
+    }
+    if longest == 0 {
+        return nil
+    }
+    for i := range chunk {
+        chunk[i] = chunk[i][:longest]
+    }
+    return chunk
+}
+
+func (t *musicTrack) decodeAhead() {
+    defer t.decoder.Done()
+    defer close(t.chunks)
+    for {
+        chunk := t.decode()
+        if chunk == nil {
+            return
+        }
+        select {
+        case t.chunks <- chunk:
+        case <-t.stop:
+            return
+        }
+    }
+}
+
+// mixes the stems at their faders' gains, from the chunks decoded so far
+func (t *musicTrack) Stream(samples [][2]float64) (int, bool) {
+    for i := range samples {
+        if t.current == nil || t.pos >= len(t.current[0]) {
+            select {
+            case chunk, ok := <-t.chunks:
+                if !ok {
+                    return i, i > 0
+                }
+                t.current, t.pos = chunk, 0
+            default:
+                // decoding fell behind: fill with silence and pick up where it left off
+                for j := range samples[i:] {
+                    samples[i+j] = [2]float64{}
+                }
+                return len(samples), true
+            }
+        }
+        var mixed [2]float64
+        for s, stem := range t.stems {
+            gain := stem.fader.next()
+            sample := t.current[s][t.pos]
+            mixed[0] += sample[0] * gain
+            mixed[1] += sample[1] * gain
+        }
+        samples[i] = mixed
+        t.pos++
+    }
+    return len(samples), true
+}
+
+func (t *musicTrack) Err() error {
+    return nil
+}
+
+func seconds(s float64) time.Duration {
+    return time.Duration(s * float64(time.Second))
+}
+
+// opens every stem of song at intensity, decodes its first chunk so it can start straight away,
+// and starts decoding the rest
+func openTrack(song Song, intensity float64) (*musicTrack, error) {
+    if len(song.Stems) == 0 {
+        return nil, fmt.Errorf("song with no stems")
+    }
+    t := &musicTrack{song: song}
+    for i, name := range song.Stems {
+        stream, format, err := openAudio(name)
+        if err != nil {
+            t.close()
+            return nil, err
+        }
+        loop := &loopStreamer{
+            s:     stream,
+            start: format.SampleRate.N(seconds(song.LoopStart)),
+            end:   format.SampleRate.N(seconds(song.LoopEnd)),
+            loop:  song.Loop,
+        }
+        stem := &musicStem{name: name, stream: stream, source: resampled(format, loop), fader: &fader{}}
+        t.stems = append(t.stems, stem)
+        if t.audible(i, intensity) {
+            stem.fader.fade(1, 0)
+        }
+    }
+    t.current = t.decode()
+    if t.current == nil {
+        err := t.stems[0].source.Err()
+        t.close()
+        if err == nil {
+            err = fmt.Errorf("empty")
+        }
+        return nil, fmt.Errorf("%s: %v", song.Stems[0], err)
+    }
+    t.chunks = make(chan musicChunk, AUDIORATE.N(MUSICPREBUFFER)/MUSICCHUNK+1)
+    t.stop = make(chan struct{})
+    t.decoder.Add(1)
+    go t.decodeAhead()
+    t.fader = &fader{streamer: t, drain: true}
+    return t, nil
+}
+
+// streams the music at name from its file, replacing the song that's playing straight away;
+// loop repeats it until StopMusic
+func (a *Audio) PlayMusic(name string, loop bool) error {
+    return a.PlaySong(Song{Stems: []string{name}, Loop: loop}, 0)
+}
+
+// crossfades to song over fade seconds, or cuts to it for 0. asking for the song that's already
+// playing carries on with it, so scenes that share a song don't restart it.
+func (a *Audio) PlaySong(song Song, fade float64) error {
+    a.mu.Lock()
+    playing := a.track != nil && a.track.song.same(song)
+    intensity := a.intensity
+    a.mu.Unlock()
+    if playing {
+        return nil
+    }
+    track, err := openTrack(song, intensity)
+    if err != nil {
+        return err
+    }
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    a.retire(fade)
+    track.fader.fade(1, fade)
+    a.track = track
+    a.buses[BusMusic].mix.Add(track.fader)
+    return nil
+}
+
+// fades the song playing out over seconds, to be closed by Update once it's silent; call with
+// the lock held
+func (a *Audio) retire(seconds float64) {
+    if a.track == nil {
+        return
+    }
+    a.track.fader.fade(0, seconds)
+    a.retired = append(a.retired, a.track)
+    a.track = nil
+}
+
+// fades the music out over seconds
+func (a *Audio) FadeOutMusic(seconds float64) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    a.retire(seconds)
+}
+
+func (a *Audio) StopMusic() {
+    a.FadeOutMusic(0)
+}
+
+// the first stem of the song playing, or ""
+func (a *Audio) Music() string {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if a.track == nil {
+        return ""
+    }
+    return a.track.song.Stems[0]
+}
+
+// how intense the game is, 0 to 1: stems come in once it reaches their Song.Intensity and drop
+// out below it, fading over STEMFADE seconds. it carries over to the next song.
+func (a *Audio) SetIntensity(intensity float64) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    a.intensity = intensity
+    a.refadeStems()
+}
+
+func (a *Audio) Intensity() float64 {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return a.intensity
+}
+
+// silences stem i of the song playing whatever the intensity, or lets the intensity decide again
+func (a *Audio) MuteStem(i int, muted bool) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if a.track == nil || i < 0 || i >= len(a.track.stems) {
+        return
+    }
+    a.track.stems[i].muted = muted
+    a.refadeStems()
+}
+
+func (a *Audio) refadeStems() {
+    if a.track == nil {
+        return
+    }
+    for i, stem := range a.track.stems {
+        target := 0.0
+        if a.track.audible(i, a.intensity) {
+            target = 1
+        }
+        if stem.fader.target != target {
+            stem.fader.fade(target, STEMFADE)
+        }
+    }
+}
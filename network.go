@@ -0,0 +1,607 @@
+package main
+
+import (
+    "encoding/binary"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "reflect"
+    "sort"
+    "sync"
+    "time"
+)
+
+var netLog = logging.Module("net")
+
+// where host listens without an address
+const NETADDR = ":7777"
+
+// the biggest frame either side accepts, in bytes; a bigger one drops the connection
+const NETMAXPACKET = 1 << 20
+
+// how many packets wait to go out on a connection, and how many received ones wait for Poll,
+// before the connection counts as stuck
+const NETQUEUE = 256
+
+// how long Connect waits for the server, and how long closing waits for what's queued to go out
+const NETDIALTIMEOUT = 5 * time.Second
+const NETFLUSHTIMEOUT = time.Second
+
+var (
+    packetTypes = make(map[string]reflect.Type)
+    packetNames = make(map[reflect.Type]string)
+)
+
+// makes a struct sendable under name, e.g. RegisterPacket("chat", Chat{}). both sides have to
+// register the same names; handlers get the packet as the value registered, decoded from JSON,
+// so only its exported fields travel.
+func RegisterPacket(name string, example interface{}) {
+    t := reflect.TypeOf(example)
+    if t == nil || t.Kind() == reflect.Ptr {
+        panic(fmt.Sprintf("net: packet %T has to be a value, not a pointer", example))
+    }
+    if _, ok := packetTypes[name]; ok {
+        panic(fmt.Sprintf("net: packet %q registered twice", name))
+    }
+    packetTypes[name] = t
+    packetNames[t] = name
+}
+
+func packetType(packet interface{}) reflect.Type {
+    t := reflect.TypeOf(packet)
+    if t != nil && t.Kind() == reflect.Ptr {
+        t = t.Elem()
+    }
+    return t
+}
+
+// what goes in a frame: the packet's registered name and its fields
+type packetEnvelope struct {
+    Type string          `json:"t"`
+    Data json.RawMessage `json:"d"`
+}
+
+func encodePacket(packet interface{}) ([]byte, error) {
+    name, ok := packetNames[packetType(packet)]
+    if !ok {
+        return nil, fmt.Errorf("net: packet %T isn't registered", packet)
+    }
+    data, err := json.Marshal(packet)
+    if err != nil {
+        return nil, fmt.Errorf("net: %s: %v", name, err)
+    }
+    return json.Marshal(packetEnvelope{Type: name, Data: data})
+}
+
+func decodePacket(frame []byte) (interface{}, error) {
+    var env packetEnvelope
+    if err := json.Unmarshal(frame, &env); err != nil {
+        return nil, fmt.Errorf("net: %v", err)
+    }
+    t, ok := packetTypes[env.Type]
+    if !ok {
+        return nil, fmt.Errorf("net: unknown packet %q", env.Type)
+    }
+    v := reflect.New(t)
+    if err := json.Unmarshal(env.Data, v.Interface()); err != nil {
+        return nil, fmt.Errorf("net: %s: %v", env.Type, err)
+    }
+    return v.Elem().Interface(), nil
+}
+
+// frames are a big-endian byte count, then that many bytes
+func writeFrame(w io.Writer, frame []byte) error {
+    var size [4]byte
+    binary.BigEndian.PutUint32(size[:], uint32(len(frame)))
+    if _, err := w.Write(size[:]); err != nil {
+        return err
+    }
+    _, err := w.Write(frame)
+    return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+    var size [4]byte
+    if _, err := io.ReadFull(r, size[:]); err != nil {
+        return nil, err
+    }
+    n := binary.BigEndian.Uint32(size[:])
+    if n > NETMAXPACKET {
+        return nil, fmt.Errorf("net: a %d byte packet is over the limit", n)
+    }
+    frame := make([]byte, n)
+    if _, err := io.ReadFull(r, frame); err != nil {
+        return nil, err
+    }
+    return frame, nil
+}
+
+// one end of a connection. packets are read and written on its own goroutines; what arrives is
+// handed to the game by its Server's or Client's Poll.
+type NetConn struct {
+    // unique among a server's connections; a client's one connection is 0
+    ID int
+    // anything the game keeps with the connection, e.g. the player it belongs to
+    Data interface{}
+
+    conn net.Conn
+    send chan []byte
+    done chan struct{}
+    once sync.Once
+    err  error
+}
+
+func newNetConn(id int, conn net.Conn) *NetConn {
+    return &NetConn{ID: id, conn: conn, send: make(chan []byte, NETQUEUE), done: make(chan struct{})}
+}
+
+func (c *NetConn) Addr() string {
+    return c.conn.RemoteAddr().String()
+}
+
+// queues packet to go out; it's an error if c has closed, and c closes if it's so far behind that
+// the queue is full
+func (c *NetConn) Send(packet interface{}) error {
+    frame, err := encodePacket(packet)
+    if err != nil {
+        return err
+    }
+    return c.sendFrame(frame)
+}
+
+func (c *NetConn) sendFrame(frame []byte) error {
+    select {
+    case <-c.done:
+        return errors.New("net: connection closed")
+    default:
+    }
+    select {
+    case c.send <- frame:
+        return nil
+    default:
+        err := fmt.Errorf("net: %s isn't keeping up", c.Addr())
+        c.close(err)
+        return err
+    }
+}
+
+// closes c once what's been sent has gone out; its peer's OnDisconnect follows in a later Poll
+func (c *NetConn) Close() {
+    c.close(nil)
+}
+
+func (c *NetConn) close(err error) {
+    c.once.Do(func() {
+        c.err = err
+        close(c.done)
+    })
+}
+
+type netEventKind int
+
+const (
+    netConnected netEventKind = iota
+    netReceived
+    netDisconnected
+)
+
+type netEvent struct {
+    kind   netEventKind
+    conn   *NetConn
+    packet interface{}
+    err    error
+}
+
+// what a Server and a Client share: handlers, and the events their goroutines queue for Poll
+type netPeer struct {
+    events chan netEvent
+    // closed by Close, after which events are dropped rather than waiting for a Poll that won't come
+    stop         chan struct{}
+    stopOnce     sync.Once
+    conns        map[int]*NetConn
+    handlers     map[reflect.Type][]func(*NetConn, interface{})
+    onConnect    []func(*NetConn)
+    onDisconnect []func(*NetConn, error)
+}
+
+func newNetPeer() netPeer {
+    return netPeer{
+        events:   make(chan netEvent, NETQUEUE),
+        stop:     make(chan struct{}),
+        conns:    map[int]*NetConn{},
+        handlers: map[reflect.Type][]func(*NetConn, interface{}){},
+    }
+}
+
+// runs fn with each packet of example's type that arrives, e.g.
+//
+//	server.Handle(Chat{}, func(c *NetConn, p interface{}) { server.Broadcast(p.(Chat)) })
+func (p *netPeer) Handle(example interface{}, fn func(c *NetConn, packet interface{})) {
+    t := packetType(example)
+    if _, ok := packetNames[t]; !ok {
+        panic(fmt.Sprintf("net: packet %T isn't registered", example))
+    }
+    p.handlers[t] = append(p.handlers[t], fn)
+}
+
+func (p *netPeer) OnConnect(fn func(c *NetConn)) {
+    p.onConnect = append(p.onConnect, fn)
+}
+
+// err is nil when the other side hung up cleanly or this one closed without an error. a client
+// that couldn't connect gets a nil c.
+func (p *netPeer) OnDisconnect(fn func(c *NetConn, err error)) {
+    p.onDisconnect = append(p.onDisconnect, fn)
+}
+
+// runs the handlers for everything that's happened since the last Poll; Network.Update calls it
+// each frame, on the main thread
+func (p *netPeer) Poll() {
+    for {
+        select {
+        case e := <-p.events:
+            p.dispatch(e)
+        default:
+            return
+        }
+    }
+}
+
+func (p *netPeer) dispatch(e netEvent) {
+    switch e.kind {
+    case netConnected:
+        p.conns[e.conn.ID] = e.conn
+        for _, fn := range p.onConnect {
+            fn(e.conn)
+        }
+    case netReceived:
+        for _, fn := range p.handlers[packetType(e.packet)] {
+            fn(e.conn, e.packet)
+        }
+    case netDisconnected:
+        if e.conn != nil {
+            delete(p.conns, e.conn.ID)
+        }
+        for _, fn := range p.onDisconnect {
+            fn(e.conn, e.err)
+        }
+    }
+}
+
+// queues e for Poll, and says whether it could
+func (p *netPeer) post(e netEvent) bool {
+    select {
+    case p.events <- e:
+        return true
+    case <-p.stop:
+        return false
+    }
+}
+
+func (p *netPeer) close() {
+    p.stopOnce.Do(func() { close(p.stop) })
+}
+
+// starts c's reader and writer. the connect event goes first, so packets never arrive before it.
+func (p *netPeer) serve(c *NetConn) {
+    if !p.post(netEvent{kind: netConnected, conn: c}) {
+        c.conn.Close()
+        return
+    }
+    go p.write(c)
+    go p.read(c)
+}
+
+func (p *netPeer) write(c *NetConn) {
+    for {
+        select {
+        case frame := <-c.send:
+            if err := writeFrame(c.conn, frame); err != nil {
+                c.close(err)
+                c.conn.Close()
+                return
+            }
+        case <-c.done:
+            // what was sent before Close still goes, if it can
+            c.conn.SetWriteDeadline(time.Now().Add(NETFLUSHTIMEOUT))
+            for len(c.send) > 0 {
+                if writeFrame(c.conn, <-c.send) != nil {
+                    break
+                }
+            }
+            c.conn.Close()
+            return
+        }
+    }
+}
+
+func (p *netPeer) read(c *NetConn) {
+    for {
+        frame, err := readFrame(c.conn)
+        if err != nil {
+            select {
+            case <-c.done:
+                // closed from this side, so the read failing is expected
+            default:
+                if err == io.EOF {
+                    err = nil
+                }
+                c.close(err)
+            }
+            p.post(netEvent{kind: netDisconnected, conn: c, err: c.err})
+            return
+        }
+        packet, err := decodePacket(frame)
+        if err != nil {
+            netLog.Warnf("%s: %v", c.Addr(), err)
+            continue
+        }
+        if !p.post(netEvent{kind: netReceived, conn: c, packet: packet}) {
+            c.Close()
+        }
+    }
+}
+
+// accepts clients over TCP. connections, packets and disconnections reach the game through its
+// handlers in Poll.
+type Server struct {
+    netPeer
+    listener net.Listener
+}
+
+func NewServer() *Server {
+    return &Server{netPeer: newNetPeer()}
+}
+
+// starts accepting clients on addr, e.g. ":7777"
+func (s *Server) Listen(addr string) error {
+    if s.listener != nil {
+        return errors.New("net: the server's already listening")
+    }
+    l, err := net.Listen("tcp", addr)
+    if err != nil {
+        return fmt.Errorf("net: %v", err)
+    }
+    s.listener = l
+    go s.accept(l)
+    return nil
+}
+
+func (s *Server) accept(l net.Listener) {
+    for id := 1; ; id++ {
+        conn, err := l.Accept()
+        if err != nil {
+            // Close stops accepting this way too
+            var ne net.Error
+            if errors.As(err, &ne) && ne.Temporary() {
+                time.Sleep(50 * time.Millisecond)
+                continue
+            }
+            return
+        }
+        if tcp, ok := conn.(*net.TCPConn); ok {
+            tcp.SetNoDelay(true)
+        }
+        s.serve(newNetConn(id, conn))
+    }
+}
+
+// where it's listening, with the port picked when it was given ":0"
+func (s *Server) Addr() string {
+    if s.listener == nil {
+        return ""
+    }
+    return s.listener.Addr().String()
+}
+
+// the connected clients, oldest first, as of the last Poll
+func (s *Server) Conns() []*NetConn {
+    conns := make([]*NetConn, 0, len(s.conns))
+    for _, c := range s.conns {
+        conns = append(conns, c)
+    }
+    sort.Slice(conns, func(i, j int) bool { return conns[i].ID < conns[j].ID })
+    return conns
+}
+
+func (s *Server) Conn(id int) *NetConn {
+    return s.conns[id]
+}
+
+// sends packet to every client, encoding it once
+func (s *Server) Broadcast(packet interface{}) error {
+    frame, err := encodePacket(packet)
+    if err != nil {
+        return err
+    }
+    for _, c := range s.conns {
+        c.sendFrame(frame)
+    }
+    return nil
+}
+
+// stops listening and closes every connection, for good
+func (s *Server) Close() {
+    s.close()
+    if s.listener != nil {
+        s.listener.Close()
+    }
+    for _, c := range s.conns {
+        c.Close()
+    }
+}
+
+// one connection to a Server over TCP
+type Client struct {
+    netPeer
+    conn    *NetConn
+    dialing bool
+}
+
+func NewClient() *Client {
+    c := &Client{netPeer: newNetPeer()}
+    c.OnConnect(func(conn *NetConn) {
+        c.conn, c.dialing = conn, false
+    })
+    c.OnDisconnect(func(conn *NetConn, err error) {
+        c.conn, c.dialing = nil, false
+    })
+    return c
+}
+
+// dials addr, e.g. "localhost:7777", without waiting: OnConnect runs once it's through, or
+// OnDisconnect with a nil connection if it fails
+func (c *Client) Connect(addr string) error {
+    select {
+    case <-c.stop:
+        return errors.New("net: the client's closed")
+    default:
+    }
+    if c.conn != nil || c.dialing {
+        return errors.New("net: the client's already connected")
+    }
+    c.dialing = true
+    go func() {
+        conn, err := net.DialTimeout("tcp", addr, NETDIALTIMEOUT)
+        if err != nil {
+            c.post(netEvent{kind: netDisconnected, err: fmt.Errorf("net: %v", err)})
+            return
+        }
+        if tcp, ok := conn.(*net.TCPConn); ok {
+            tcp.SetNoDelay(true)
+        }
+        c.serve(newNetConn(0, conn))
+    }()
+    return nil
+}
+
+// whether it's connected, as of the last Poll
+func (c *Client) Connected() bool {
+    return c.conn != nil
+}
+
+// the connection to the server, or nil
+func (c *Client) Conn() *NetConn {
+    return c.conn
+}
+
+func (c *Client) Send(packet interface{}) error {
+    if c.conn == nil {
+        return errors.New("net: not connected")
+    }
+    return c.conn.Send(packet)
+}
+
+// disconnects for good; connecting again takes a new Client
+func (c *Client) Close() {
+    c.close()
+    if c.conn != nil {
+        c.conn.Close()
+    }
+}
+
+// the game's server and client, while it's hosting or has joined one. it can do both at once, so
+// whoever hosts plays through their own client like everyone else. Run polls them each frame,
+// before the scenes get input, so handlers run on the main thread along with the rest of the game,
+// and closes them on the way out.
+type Network struct {
+    Server *Server
+    Client *Client
+}
+
+func NewNetwork() *Network {
+    return &Network{}
+}
+
+// starts a server on addr; add its handlers straight after, they're in place for the next Poll
+func (n *Network) Host(addr string) (*Server, error) {
+    if n.Server != nil {
+        return nil, errors.New("net: already hosting")
+    }
+    s := NewServer()
+    if err := s.Listen(addr); err != nil {
+        return nil, err
+    }
+    netLog.Infof("hosting on %s", s.Addr())
+    n.Server = s
+    return s, nil
+}
+
+// starts connecting a client to addr
+func (n *Network) Join(addr string) (*Client, error) {
+    if n.Client != nil {
+        return nil, errors.New("net: already joined")
+    }
+    c := NewClient()
+    if err := c.Connect(addr); err != nil {
+        return nil, err
+    }
+    c.OnDisconnect(func(conn *NetConn, err error) {
+        if err != nil {
+            netLog.Warnf("%v", err)
+        }
+        if n.Client == c {
+            n.Client = nil
+        }
+    })
+    n.Client = c
+    return c, nil
+}
+
+func (n *Network) Update() {
+    if n.Server != nil {
+        n.Server.Poll()
+    }
+    if n.Client != nil {
+        n.Client.Poll()
+    }
+}
+
+// closes the client and stops the server
+func (n *Network) Close() {
+    if n.Client != nil {
+        n.Client.Close()
+        n.Client = nil
+    }
+    if n.Server != nil {
+        n.Server.Close()
+        n.Server = nil
+    }
+}
+
+func registerNetCommands(c *Console, n *Network) {
+    c.Register("host", "starts a server, on "+NETADDR+" unless given an address", func(args ConsoleArgs) error {
+        addr := NETADDR
+        if args.Has(0) {
+            addr = args.String(0)
+        }
+        _, err := n.Host(addr)
+        return err
+    }, StringArg("addr").Opt())
+    c.Register("join", "connects to a server, e.g. join localhost:7777", func(args ConsoleArgs) error {
+        _, err := n.Join(args.String(0))
+        return err
+    }, StringArg("addr"))
+    c.Register("disconnect", "leaves the server and stops hosting", func(args ConsoleArgs) error {
+        n.Close()
+        return nil
+    })
+    c.Register("peers", "lists the server's clients and the client's connection", func(args ConsoleArgs) error {
+        if n.Server != nil {
+            c.Printf("hosting on %s", n.Server.Addr())
+            for _, conn := range n.Server.Conns() {
+                c.Printf("  %d %s", conn.ID, conn.Addr())
+            }
+        }
+        if n.Client != nil {
+            if conn := n.Client.Conn(); conn != nil {
+                c.Printf("joined %s", conn.Addr())
+            } else {
+                c.Printf("connecting")
+            }
+        }
+        return nil
+    })
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+    "image/color"
+
+    "github.com/faiface/pixel"
+)
+
+// a 9-slice image: the corners keep their size, the edges stretch along one axis and the middle along both
+type NinePatch struct {
+    Picture pixel.Picture
+    // the region of Picture holding the patch, so it can live in an atlas
+    Frame pixel.Rect
+    // border widths in picture pixels
+    Left, Bottom, Right, Top float64
+
+    sprite *pixel.Sprite
+    batch  *pixel.Batch
+}
+
+func NewNinePatch(pic pixel.Picture, frame pixel.Rect, left, bottom, right, top float64) *NinePatch {
+    return &NinePatch{
+        Picture: pic,
+        Frame:   frame,
+        Left:    left,
+        Bottom:  bottom,
+        Right:   right,
+        Top:     top,
+        sprite:  pixel.NewSprite(pic, frame),
+        batch:   pixel.NewBatch(&pixel.TrianglesData{}, pic),
+    }
+}
+
+// loads a whole image as a nine-patch with the given borders
+func LoadNinePatch(path string, left, bottom, right, top float64) (*NinePatch, error) {
+    pic, err := LoadPicture(path)
+    if err != nil {
+        return nil, err
+    }
+    return NewNinePatch(pic, pic.Bounds(), left, bottom, right, top), nil
+}
+
+// splits a span into its start border, stretched middle and end border. when the span is
+// smaller than both borders together they shrink proportionally and the middle disappears.
+func ninePatchStops(min, max, start, end float64) [4]float64 {
+    size := max - min
+    if start+end > size && start+end > 0 {
+        scale := size / (start + end)
+        start, end = start*scale, end*scale
+    }
+    return [4]float64{min, min + start, max - end, max}
+}
+
+// draws the patch stretched to fill r in a single batched draw call
+func (np *NinePatch) Draw(t pixel.Target, r pixel.Rect) {
+    np.DrawColorMask(t, r, nil)
+}
+
+func (np *NinePatch) DrawColorMask(t pixel.Target, r pixel.Rect, mask color.Color) {
+    r = r.Norm()
+    f := np.Frame
+    srcX := [4]float64{f.Min.X, f.Min.X + np.Left, f.Max.X - np.Right, f.Max.X}
+    srcY := [4]float64{f.Min.Y, f.Min.Y + np.Bottom, f.Max.Y - np.Top, f.Max.Y}
+    dstX := ninePatchStops(r.Min.X, r.Max.X, np.Left, np.Right)
+    dstY := ninePatchStops(r.Min.Y, r.Max.Y, np.Bottom, np.Top)
+
+    np.batch.Clear()
+    for row := 0; row < 3; row++ {
+        for col := 0; col < 3; col++ {
+            src := pixel.R(srcX[col], srcY[row], srcX[col+1], srcY[row+1])
+            dst := pixel.R(dstX[col], dstY[row], dstX[col+1], dstY[row+1])
+            if src.W() <= 0 || src.H() <= 0 || dst.W() <= 0 || dst.H() <= 0 {
+                continue
+            }
+            np.sprite.Set(np.Picture, src)
+            scale := pixel.V(dst.W()/src.W(), dst.H()/src.H())
+            np.sprite.DrawColorMask(np.batch, pixel.IM.ScaledXY(pixel.ZV, scale).Moved(dst.Center()), mask)
+        }
+    }
+    np.batch.Draw(t)
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+    "image/color"
+    "math"
+    "math/rand"
+
+    "github.com/faiface/pixel"
+)
+
+// coherent noise: nearby points give nearby values, in -1..1, and the same seed gives the same
+// field on every machine, so a level generated from one comes out the same everywhere
+type Noise interface {
+    Noise1(x float64) float64
+    Noise2(x, y float64) float64
+}
+
+// a shuffled 0..255 twice over, so lattice corners hash without wrapping
+type noisePerm [512]uint8
+
+func newNoisePerm(seed int64) noisePerm {
+    var p noisePerm
+    for i, v := range rand.New(rand.NewSource(seed)).Perm(256) {
+        p[i], p[i+256] = uint8(v), uint8(v)
+    }
+    return p
+}
+
+func (p *noisePerm) hash1(x int) int {
+    return int(p[x&255])
+}
+
+func (p *noisePerm) hash2(x, y int) int {
+    return int(p[int(p[x&255])+y&255])
+}
+
+// 6t^5 - 15t^4 + 10t^3, which eases into and out of each cell so the seams don't show
+func noiseFade(t float64) float64 {
+    return t * t * t * (t*(t*6-15) + 10)
+}
+
+func noiseLerp(a, b, t float64) float64 {
+    return a + (b-a)*t
+}
+
+// random values at the lattice points, eased between: blobby, cheap, and squarer than Perlin
+type ValueNoise struct {
+    perm noisePerm
+}
+
+func NewValueNoise(seed int64) *ValueNoise {
+    return &ValueNoise{newNoisePerm(seed)}
+}
+
+func (n *ValueNoise) value(h int) float64 {
+    return float64(h)/127.5 - 1
+}
+
+func (n *ValueNoise) Noise1(x float64) float64 {
+    x0 := math.Floor(x)
+    i := int(x0)
+    return noiseLerp(n.value(n.perm.hash1(i)), n.value(n.perm.hash1(i+1)), noiseFade(x-x0))
+}
+
+func (n *ValueNoise) Noise2(x, y float64) float64 {
+    x0, y0 := math.Floor(x), math.Floor(y)
+    i, j := int(x0), int(y0)
+    u, v := noiseFade(x-x0), noiseFade(y-y0)
+    bottom := noiseLerp(n.value(n.perm.hash2(i, j)), n.value(n.perm.hash2(i+1, j)), u)
+    top := noiseLerp(n.value(n.perm.hash2(i, j+1)), n.value(n.perm.hash2(i+1, j+1)), u)
+    return noiseLerp(bottom, top, v)
+}
+
+// Ken Perlin's improved gradient noise: a slope at each lattice point instead of a value, which
+// gives the familiar rolling hills, 0 at every whole coordinate
+type PerlinNoise struct {
+    perm noisePerm
+}
+
+func NewPerlinNoise(seed int64) *PerlinNoise {
+    return &PerlinNoise{newNoisePerm(seed)}
+}
+
+func perlinGrad1(h int, x float64) float64 {
+    // slopes of 1 to 8 either way
+    g := float64(h&7 + 1)
+    if h&8 != 0 {
+        g = -g
+    }
+    return g * x
+}
+
+// one of the eight directions along the axes and the diagonals
+func perlinGrad2(h int, x, y float64) float64 {
+    switch h & 7 {
+    case 0:
+        return x + y
+    case 1:
+        return -x + y
+    case 2:
+        return x - y
+    case 3:
+        return -x - y
+    case 4:
+        return x
+    case 5:
+        return -x
+    case 6:
+        return y
+    }
+    return -y
+}
+
+func (n *PerlinNoise) Noise1(x float64) float64 {
+    x0 := math.Floor(x)
+    i, f := int(x0), x-x0
+    // the slopes reach 8 but meet halfway, so it rarely gets past a quarter of that
+    v := noiseLerp(perlinGrad1(n.perm.hash1(i), f), perlinGrad1(n.perm.hash1(i+1), f-1), noiseFade(f)) / 4
+    return math.Max(-1, math.Min(1, v))
+}
+
+func (n *PerlinNoise) Noise2(x, y float64) float64 {
+    x0, y0 := math.Floor(x), math.Floor(y)
+    i, j := int(x0), int(y0)
+    fx, fy := x-x0, y-y0
+    u, v := noiseFade(fx), noiseFade(fy)
+    bottom := noiseLerp(perlinGrad2(n.perm.hash2(i, j), fx, fy), perlinGrad2(n.perm.hash2(i+1, j), fx-1, fy), u)
+    top := noiseLerp(perlinGrad2(n.perm.hash2(i, j+1), fx, fy-1), perlinGrad2(n.perm.hash2(i+1, j+1), fx-1, fy-1), u)
+    return math.Max(-1, math.Min(1, noiseLerp(bottom, top, v)))
+}
+
+// Perlin's simplex noise: gradients on a triangular grid, with fewer of the square grid's
+// straight lines and cheaper per sample
+type SimplexNoise struct {
+    perm noisePerm
+}
+
+func NewSimplexNoise(seed int64) *SimplexNoise {
+    return &SimplexNoise{newNoisePerm(seed)}
+}
+
+// skewing the plane onto the triangle grid and back
+var simplexF2, simplexG2 = (math.Sqrt(3) - 1) / 2, (3 - math.Sqrt(3)) / 6
+
+func (n *SimplexNoise) Noise1(x float64) float64 {
+    i := int(math.Floor(x))
+    corner := func(i int, d float64) float64 {
+        t := 1 - d*d
+        if t <= 0 {
+            return 0
+        }
+        t *= t
+        return t * t * perlinGrad1(n.perm.hash1(i), d)
+    }
+    f := x - math.Floor(x)
+    // scaled so the peaks land near 1
+    return math.Max(-1, math.Min(1, 0.395*(corner(i, f)+corner(i+1, f-1))))
+}
+
+func (n *SimplexNoise) Noise2(x, y float64) float64 {
+    s := (x + y) * simplexF2
+    i, j := math.Floor(x+s), math.Floor(y+s)
+    t := (i + j) * simplexG2
+    x0, y0 := x-(i-t), y-(j-t)
+    // which of the cell's two triangles it's in
+    i1, j1 := 0, 1
+    if x0 > y0 {
+        i1, j1 = 1, 0
+    }
+    x1, y1 := x0-float64(i1)+simplexG2, y0-float64(j1)+simplexG2
+    x2, y2 := x0-1+2*simplexG2, y0-1+2*simplexG2
+    ii, jj := int(i), int(j)
+    corner := func(h int, x, y float64) float64 {
+        t := 0.5 - x*x - y*y
+        if t <= 0 {
+            return 0
+        }
+        t *= t
+        return t * t * perlinGrad2(h, x, y)
+    }
+    sum := corner(n.perm.hash2(ii, jj), x0, y0) +
+        corner(n.perm.hash2(ii+i1, jj+j1), x1, y1) +
+        corner(n.perm.hash2(ii+1, jj+1), x2, y2)
+    return math.Max(-1, math.Min(1, 70*sum))
+}
+
+// octaves of Noise added together, each Lacunarity times the frequency and Gain times the
+// strength of the one before, and scaled back into -1..1: broad shapes with finer detail over
+// them, like coastlines or clouds. it's a Noise itself, so it bakes like one, e.g.
+//
+//	terrain := NewFractal(NewSimplexNoise(seed), 5)
+//	height := terrain.Noise2(x/64, y/64)
+type Fractal struct {
+    Noise   Noise
+    Octaves int
+    // of the first octave
+    Frequency float64
+    // 2 and 0.5 by default
+    Lacunarity, Gain float64
+    // folds each octave into sharp crests, for mountain ridges and veins
+    Ridged bool
+}
+
+func NewFractal(n Noise, octaves int) *Fractal {
+    return &Fractal{Noise: n, Octaves: octaves, Frequency: 1, Lacunarity: 2, Gain: 0.5}
+}
+
+func (f *Fractal) sum(sample func(frequency float64) float64) float64 {
+    frequency, amplitude := f.Frequency, 1.0
+    total, max := 0.0, 0.0
+    for o := 0; o < f.Octaves; o++ {
+        v := sample(frequency)
+        if f.Ridged {
+            v = 1 - 2*math.Abs(v)
+        }
+        total += v * amplitude
+        max += amplitude
+        frequency *= f.Lacunarity
+        amplitude *= f.Gain
+    }
+    if max == 0 {
+        return 0
+    }
+    return total / max
+}
+
+func (f *Fractal) Noise1(x float64) float64 {
+    return f.sum(func(frequency float64) float64 {
+        return f.Noise.Noise1(x * frequency)
+    })
+}
+
+func (f *Fractal) Noise2(x, y float64) float64 {
+    // each octave offset a little, so their zeros at the origin don't line up
+    o := 0.0
+    return f.sum(func(frequency float64) float64 {
+        o += 17.3
+        return f.Noise.Noise2(x*frequency+o, y*frequency-o)
+    })
+}
+
+// n sampled across a w by h area like NoisePicture does, mapped into 0..1
+func noiseAt(n Noise, x, y, w, h float64, opts NoiseOptions) float64 {
+    scale := opts.Scale
+    if scale <= 0 {
+        scale = 1
+    }
+    sample := func(x, y float64) float64 {
+        return n.Noise2((x+opts.Offset.X)/scale, (y+opts.Offset.Y)/scale)
+    }
+    v := sample(x, y)
+    if opts.Seamless {
+        // blended with the copies a width and a height away, so each edge matches the opposite one
+        u, t := x/w, y/h
+        v = noiseLerp(
+            noiseLerp(v, sample(x-w, y), u),
+            noiseLerp(sample(x, y-h), sample(x-w, y-h), u),
+            t,
+        )
+    }
+    return math.Max(0, math.Min(1, (v+1)/2))
+}
+
+// how NoisePicture and NoiseTiles sample
+type NoiseOptions struct {
+    // how many pixels or cells one unit of noise spans, 1 when zero; bigger is smoother
+    Scale float64
+    // where in the noise the sampling starts, in pixels or cells, e.g. to scroll clouds
+    Offset pixel.Vec
+    // blends the edges so the result wraps around, for a texture a shader tiles
+    Seamless bool
+}
+
+// a w by h picture of n, made on the CPU, e.g. as clouds to draw or as a texture for a shader's
+// Extra. shade turns each value, 0 to 1, into a pixel; nil is gray from black to white.
+func NoisePicture(n Noise, w, h int, opts NoiseOptions, shade func(v float64) color.Color) *pixel.PictureData {
+    pd := pixel.MakePictureData(pixel.R(0, 0, float64(w), float64(h)))
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            v := noiseAt(n, float64(x), float64(y), float64(w), float64(h), opts)
+            // Pix starts at the bottom row, which is y 0 like everywhere else
+            if shade == nil {
+                g := uint8(math.Round(v * 255))
+                pd.Pix[y*w+x] = color.RGBA{g, g, g, 255}
+            } else {
+                pd.Pix[y*w+x] = color.RGBAModel.Convert(shade(v)).(color.RGBA)
+            }
+        }
+    }
+    return pd
+}
+
+// which tile a range of noise becomes: everything under Below, 0 to 1, that a band before it
+// didn't take
+type NoiseBand struct {
+    Below float64
+    GID   uint32
+}
+
+// fills l with tiles chosen by n at each cell, e.g. for an island:
+//
+//	NoiseTiles(ground, NewFractal(NewPerlinNoise(seed), 4), NoiseOptions{Scale: 12},
+//		NoiseBand{0.4, water}, NoiseBand{0.45, sand}, NoiseBand{0.7, grass}, NoiseBand{1, rock})
+//
+// cells above every band are left as they were. the rows count from the top like the layer's.
+func NoiseTiles(l *TileLayer, n Noise, opts NoiseOptions, bands ...NoiseBand) {
+    for y := 0; y < l.Height; y++ {
+        for x := 0; x < l.Width; x++ {
+            v := noiseAt(n, float64(x), float64(y), float64(l.Width), float64(l.Height), opts)
+            for _, b := range bands {
+                // 1 takes the very top too
+                if v < b.Below || b.Below >= 1 {
+                    l.SetGID(x, y, b.GID)
+                    break
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+    "image/color"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+    "golang.org/x/image/colornames"
+)
+
+// a thumbstick drawn on screen, pushing its four actions as far as it's dragged from the middle
+type VirtualStick struct {
+    // in virtual screen coordinates
+    Center pixel.Vec
+    Radius float64
+    // the actions it drives, by default the same as the arrow keys and the left stick
+    Left, Right, Up, Down string
+
+    // -1 to 1 on each axis while held
+    value pixel.Vec
+    held  bool
+}
+
+// how far the stick is pushed, zero when it isn't held
+func (s *VirtualStick) Value() pixel.Vec {
+    return s.value
+}
+
+// a round button drawn on screen that holds Action while pressed
+type VirtualButton struct {
+    Center pixel.Vec
+    Radius float64
+    Action string
+    Label  string
+
+    held bool
+}
+
+func (b *VirtualButton) Held() bool {
+    return b.held
+}
+
+// on-screen sticks and buttons driven by the mouse, which is how GLFW reports a touchscreen too,
+// for demos on devices without a keyboard. they feed Actions like keys do, so game code reading
+// actions doesn't know the difference. off until Enabled.
+type VirtualControls struct {
+    Enabled bool
+    // the ui layer's alpha for the controls, lighter when idle
+    Opacity float64
+
+    sticks  []*VirtualStick
+    buttons []*VirtualButton
+    // the stick or button the pointer went down on, which keeps it until it lifts
+    grabbed interface{}
+}
+
+func NewVirtualControls() *VirtualControls {
+    return &VirtualControls{Opacity: 0.5}
+}
+
+func (v *VirtualControls) AddStick(center pixel.Vec, radius float64) *VirtualStick {
+    s := &VirtualStick{Center: center, Radius: radius, Left: "left", Right: "right", Up: "up", Down: "down"}
+    v.sticks = append(v.sticks, s)
+    return s
+}
+
+func (v *VirtualControls) AddButton(center pixel.Vec, radius float64, action, label string) *VirtualButton {
+    b := &VirtualButton{Center: center, Radius: radius, Action: action, Label: label}
+    v.buttons = append(v.buttons, b)
+    return b
+}
+
+// follows the pointer and sets the actions it's holding; simulate calls it before Actions.Update
+func (v *VirtualControls) Update(in Input, a *Actions) {
+    a.ClearVirtual()
+    if !v.Enabled {
+        v.grabbed = nil
+        return
+    }
+    pos := screen.MousePosition(in)
+    if in.JustPressed(pixelgl.MouseButtonLeft) {
+        v.grabbed = v.under(pos)
+    }
+    if !in.Pressed(pixelgl.MouseButtonLeft) {
+        v.grabbed = nil
+    }
+    for _, s := range v.sticks {
+        s.held, s.value = false, pixel.ZV
+        if v.grabbed != s {
+            continue
+        }
+        s.held = true
+        offset := pos.Sub(s.Center).Scaled(1 / s.Radius)
+        if offset.Len() > 1 {
+            offset = offset.Unit()
+        }
+        s.value = offset
+        a.SetVirtual(s.Right, offset.X)
+        a.SetVirtual(s.Left, -offset.X)
+        a.SetVirtual(s.Up, offset.Y)
+        a.SetVirtual(s.Down, -offset.Y)
+    }
+    for _, b := range v.buttons {
+        b.held = v.grabbed == b
+        if b.held {
+            a.SetVirtual(b.Action, 1)
+        }
+    }
+}
+
+// the control at pos, a button before a stick when they overlap
+func (v *VirtualControls) under(pos pixel.Vec) interface{} {
+    for _, b := range v.buttons {
+        if pos.Sub(b.Center).Len() <= b.Radius {
+            return b
+        }
+    }
+    for _, s := range v.sticks {
+        if pos.Sub(s.Center).Len() <= s.Radius {
+            return s
+        }
+    }
+    return nil
+}
+
+// submits the controls to the renderer's ui layer; render calls it every frame
+func (v *VirtualControls) Draw() {
+    if !v.Enabled {
+        return
+    }
+    imd := renderer.IMDraw(LAYERUI)
+    fill := func(c color.Color, held bool) pixel.RGBA {
+        alpha := v.Opacity
+        if held {
+            alpha = v.Opacity * 1.6
+        }
+        return pixel.ToRGBA(c).Mul(pixel.Alpha(alpha))
+    }
+    for _, s := range v.sticks {
+        imd.Color = fill(colornames.Gray, s.held)
+        imd.Push(s.Center)
+        imd.Circle(s.Radius, 2)
+        imd.Push(s.Center.Add(s.value.Scaled(s.Radius)))
+        imd.Circle(s.Radius*0.4, 0)
+    }
+    for _, b := range v.buttons {
+        imd.Color = fill(colornames.Lightgray, b.held)
+        imd.Push(b.Center)
+        imd.Circle(b.Radius, 0)
+        if b.Label != "" {
+            label, center := b.Label, b.Center
+            renderer.Submit(LAYERUI, func(t pixel.Target) {
+                DrawText(t, nil, label, center.Sub(pixel.V(0, FONTSIZE/3)), TextOptions{Align: AlignCenter, Color: colornames.Black})
+            })
+        }
+    }
+}
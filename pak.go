@@ -0,0 +1,114 @@
+package main
+
+import (
+    "archive/zip"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// bundle picked up automatically at startup when it sits in the working directory
+const PAKPATH = "data.pak"
+
+// packs every file under dir into a zip based .pak at out, skipping hidden files and directories
+func BuildPak(dir, out string) error {
+    f, err := os.Create(out)
+    if err != nil {
+        return err
+    }
+    zw := zip.NewWriter(f)
+
+    outAbs, _ := filepath.Abs(out)
+    err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if path != dir && strings.HasPrefix(info.Name(), ".") {
+            if info.IsDir() {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if info.IsDir() {
+            return nil
+        }
+        if abs, _ := filepath.Abs(path); abs == outAbs {
+            return nil
+        }
+
+        rel, err := filepath.Rel(dir, path)
+        if err != nil {
+            return err
+        }
+        header, err := zip.FileInfoHeader(info)
+        if err != nil {
+            return err
+        }
+        header.Name = filepath.ToSlash(rel)
+        header.Method = zip.Deflate
+
+        w, err := zw.CreateHeader(header)
+        if err != nil {
+            return err
+        }
+        src, err := os.Open(path)
+        if err != nil {
+            return err
+        }
+        defer src.Close()
+        _, err = io.Copy(w, src)
+        return err
+    })
+
+    if cerr := zw.Close(); err == nil {
+        err = cerr
+    }
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    return err
+}
+
+// opens a .pak for reading as an fs.FS. with verify set every entry is read up front
+// so a corrupted bundle fails here rather than halfway through the game.
+func OpenPak(path string, verify bool) (*zip.ReadCloser, error) {
+    pak, err := zip.OpenReader(path)
+    if err != nil {
+        return nil, err
+    }
+    if verify {
+        if err := verifyPak(&pak.Reader); err != nil {
+            pak.Close()
+            return nil, fmt.Errorf("%s: %v", path, err)
+        }
+    }
+    return pak, nil
+}
+
+func verifyPak(r *zip.Reader) error {
+    for _, file := range r.File {
+        rc, err := file.Open()
+        if err != nil {
+            return err
+        }
+        // the zip reader checks the CRC32 once the entry is read to EOF
+        _, err = io.Copy(io.Discard, rc)
+        rc.Close()
+        if err != nil {
+            return fmt.Errorf("%s: %v", file.Name, err)
+        }
+    }
+    return nil
+}
+
+// serves all assets from the bundle at path
+func UsePak(path string, verify bool) error {
+    pak, err := OpenPak(path, verify)
+    if err != nil {
+        return err
+    }
+    AssetFS = pak
+    return nil
+}
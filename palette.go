@@ -0,0 +1,124 @@
+package main
+
+import (
+    "image/color"
+    "sync"
+
+    "github.com/faiface/pixel"
+)
+
+type Palette []color.RGBA
+
+// collects the distinct opaque colors of a picture in the order they first appear, bottom row first
+func ExtractPalette(pd *pixel.PictureData) Palette {
+    seen := make(map[color.RGBA]bool)
+    var palette Palette
+    for _, c := range pd.Pix {
+        if c.A == 0 || seen[c] {
+            continue
+        }
+        seen[c] = true
+        palette = append(palette, c)
+    }
+    return palette
+}
+
+// maps each color of from to the color at the same index in to
+func (p Palette) Mapping(to Palette) map[color.RGBA]color.RGBA {
+    mapping := make(map[color.RGBA]color.RGBA, len(p))
+    for i, c := range p {
+        if i < len(to) {
+            mapping[c] = to[i]
+        }
+    }
+    return mapping
+}
+
+// generates recolored variants of a picture, caching each under a palette name
+type PaletteSwapper struct {
+    Source *pixel.PictureData
+    Base   Palette
+
+    mu       sync.Mutex
+    variants map[string]*pixel.PictureData
+}
+
+func NewPaletteSwapper(source *pixel.PictureData) *PaletteSwapper {
+    return &PaletteSwapper{
+        Source:   source,
+        Base:     ExtractPalette(source),
+        variants: make(map[string]*pixel.PictureData),
+    }
+}
+
+// returns the cached variant called name, building it from the base palette mapped onto to on first use
+func (s *PaletteSwapper) Variant(name string, to Palette) *pixel.PictureData {
+    return s.variant(name, func() *pixel.PictureData {
+        return RecolorPicture(s.Source, s.Base.Mapping(to))
+    })
+}
+
+// returns the cached variant called name, with every opaque texel replaced by c, e.g. a damage flash
+func (s *PaletteSwapper) Flash(name string, c color.RGBA) *pixel.PictureData {
+    return s.variant(name, func() *pixel.PictureData {
+        return FlashPicture(s.Source, c)
+    })
+}
+
+func (s *PaletteSwapper) variant(name string, build func() *pixel.PictureData) *pixel.PictureData {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if pd, ok := s.variants[name]; ok {
+        return pd
+    }
+    pd := build()
+    s.variants[name] = pd
+    return pd
+}
+
+// drops a cached variant, e.g. after a team's colors change
+func (s *PaletteSwapper) Forget(name string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    delete(s.variants, name)
+}
+
+func copyPictureData(pd *pixel.PictureData) *pixel.PictureData {
+    out := &pixel.PictureData{
+        Pix:    make([]color.RGBA, len(pd.Pix)),
+        Stride: pd.Stride,
+        Rect:   pd.Rect,
+    }
+    copy(out.Pix, pd.Pix)
+    return out
+}
+
+// copies pd, swapping colors found in mapping and leaving the rest alone
+func RecolorPicture(pd *pixel.PictureData, mapping map[color.RGBA]color.RGBA) *pixel.PictureData {
+    out := copyPictureData(pd)
+    for i, c := range out.Pix {
+        if to, ok := mapping[c]; ok {
+            out.Pix[i] = to
+        }
+    }
+    return out
+}
+
+// copies pd with every visible texel set to c, keeping the original alpha
+func FlashPicture(pd *pixel.PictureData, c color.RGBA) *pixel.PictureData {
+    out := copyPictureData(pd)
+    for i, src := range out.Pix {
+        if src.A == 0 {
+            continue
+        }
+        // Pix is alpha premultiplied, so scale the flash color by the texel's alpha
+        a := uint32(src.A)
+        out.Pix[i] = color.RGBA{
+            R: uint8(uint32(c.R) * a / 0xff),
+            G: uint8(uint32(c.G) * a / 0xff),
+            B: uint8(uint32(c.B) * a / 0xff),
+            A: src.A,
+        }
+    }
+    return out
+}
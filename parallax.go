@@ -0,0 +1,156 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+)
+
+type TileMode int
+
+const (
+    TileNone TileMode = iota
+    TileX
+    TileY
+    TileBoth
+)
+
+type ParallaxLayer struct {
+    Picture pixel.Picture
+    // how far the layer moves per unit of camera movement: 0 is pinned to the screen, 1 moves with the world
+    Factor pixel.Vec
+    Tiling TileMode
+    // lower-left corner of the untiled picture in layer space
+    Offset pixel.Vec
+    // pixels per second the layer drifts by itself, e.g. clouds or water; needs Update
+    Velocity pixel.Vec
+    // rounds the layer's screen position to whole pixels, so tile edges always meet exactly
+    PixelSnap bool
+
+    sprite *pixel.Sprite
+    batch  *pixel.Batch
+}
+
+// a layer that repeats forever along tiling and scrolls at velocity on top of the parallax
+// factor, for skies, starfields and water
+func NewScrollingLayer(pic pixel.Picture, factor, velocity pixel.Vec, tiling TileMode) *ParallaxLayer {
+    return &ParallaxLayer{Picture: pic, Factor: factor, Tiling: tiling, Velocity: velocity, PixelSnap: true}
+}
+
+// moves the layer by Velocity. dt is in seconds.
+func (l *ParallaxLayer) Update(dt float64) {
+    l.Offset = l.Offset.Add(l.Velocity.Scaled(dt))
+    // tiled axes wrap by whole tiles, which looks the same but keeps Offset small enough that
+    // float precision never opens gaps between tiles
+    size := l.Picture.Bounds().Size()
+    if (l.Tiling == TileX || l.Tiling == TileBoth) && size.X > 0 {
+        l.Offset.X = math.Mod(l.Offset.X, size.X)
+    }
+    if (l.Tiling == TileY || l.Tiling == TileBoth) && size.Y > 0 {
+        l.Offset.Y = math.Mod(l.Offset.Y, size.Y)
+    }
+}
+
+// the matrix from layer space to screen space for cam
+func (l *ParallaxLayer) Matrix(cam *Camera) pixel.Matrix {
+    scrolled := *cam
+    scrolled.Position = pixel.V(cam.Position.X*l.Factor.X, cam.Position.Y*l.Factor.Y)
+    m := scrolled.Matrix()
+    if l.PixelSnap {
+        m[4], m[5] = math.Round(m[4]), math.Round(m[5])
+    }
+    return m
+}
+
+// draws the layer, batching every visible tile into a single draw call
+func (l *ParallaxLayer) Draw(t pixel.Target, cam *Camera) {
+    if l.sprite == nil {
+        l.sprite = pixel.NewSprite(l.Picture, l.Picture.Bounds())
+        l.batch = pixel.NewBatch(&pixel.TrianglesData{}, l.Picture)
+    }
+    l.batch.Clear()
+
+    m := l.Matrix(cam)
+    size := l.Picture.Bounds().Size()
+    view := visibleIn(m, cam.Viewport)
+
+    xs := []float64{l.Offset.X}
+    ys := []float64{l.Offset.Y}
+    if l.Tiling == TileX || l.Tiling == TileBoth {
+        xs = tileStarts(l.Offset.X, size.X, view.Min.X, view.Max.X)
+    }
+    if l.Tiling == TileY || l.Tiling == TileBoth {
+        ys = tileStarts(l.Offset.Y, size.Y, view.Min.Y, view.Max.Y)
+    }
+
+    half := size.Scaled(0.5)
+    for _, x := range xs {
+        for _, y := range ys {
+            l.sprite.Draw(l.batch, pixel.IM.Moved(pixel.V(x, y).Add(half)).Chained(m))
+        }
+    }
+    l.batch.Draw(t)
+}
+
+// lower-left corners of the tiles needed to cover [lo, hi] along one axis
+func tileStarts(offset, size, lo, hi float64) []float64 {
+    if size <= 0 {
+        return nil
+    }
+    var starts []float64
+    first := offset + math.Floor((lo-offset)/size)*size
+    for x := first; x < hi; x += size {
+        starts = append(starts, x)
+    }
+    return starts
+}
+
+// the axis aligned rect in m's source space that maps onto viewport
+func visibleIn(m pixel.Matrix, viewport pixel.Rect) pixel.Rect {
+    corners := viewport.Vertices()
+    r := pixel.Rect{Min: m.Unproject(corners[0]), Max: m.Unproject(corners[0])}
+    for _, corner := range corners[1:] {
+        p := m.Unproject(corner)
+        r.Min.X, r.Min.Y = math.Min(r.Min.X, p.X), math.Min(r.Min.Y, p.Y)
+        r.Max.X, r.Max.Y = math.Max(r.Max.X, p.X), math.Max(r.Max.Y, p.Y)
+    }
+    return r
+}
+
+// back to front stack of parallax layers
+type ParallaxLayers struct {
+    Layers []*ParallaxLayer
+}
+
+func NewParallaxLayers() *ParallaxLayers {
+    return &ParallaxLayers{}
+}
+
+// adds a layer in front of the existing ones
+func (p *ParallaxLayers) Add(pic pixel.Picture, factor pixel.Vec, tiling TileMode) *ParallaxLayer {
+    layer := &ParallaxLayer{Picture: pic, Factor: factor, Tiling: tiling}
+    p.Layers = append(p.Layers, layer)
+    return layer
+}
+
+// adds an endlessly scrolling layer in front of the existing ones
+func (p *ParallaxLayers) AddScrolling(pic pixel.Picture, factor, velocity pixel.Vec, tiling TileMode) *ParallaxLayer {
+    layer := NewScrollingLayer(pic, factor, velocity, tiling)
+    p.Layers = append(p.Layers, layer)
+    return layer
+}
+
+// drifts every layer with a Velocity. dt is in seconds.
+func (p *ParallaxLayers) Update(dt float64) {
+    for _, layer := range p.Layers {
+        layer.Update(dt)
+    }
+}
+
+// draws every layer relative to cam. the target's own matrix must be the identity (screen space)
+// while this runs, since each layer brings its own view transform.
+func (p *ParallaxLayers) Draw(t pixel.Target, cam *Camera) {
+    for _, layer := range p.Layers {
+        layer.Draw(t, cam)
+    }
+}
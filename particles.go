@@ -0,0 +1,162 @@
+package main
+
+import (
+    "math"
+    "math/rand"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+)
+
+type particle struct {
+    pos, vel       pixel.Vec
+    age, life      float64
+    rotation, spin float64
+}
+
+// spawns and simulates particles, drawing all of them in a single batch
+type ParticleEmitter struct {
+    Position pixel.Vec
+    // particles per second while Emitting
+    Rate     float64
+    Emitting bool
+    // 0 means unlimited
+    MaxParticles int
+
+    // seconds
+    Lifetime, LifetimeVariance float64
+    // initial direction in radians and the random spread either side of it
+    Direction, Spread    float64
+    Speed, SpeedVariance float64
+    Gravity              pixel.Vec
+    // radians per second, picked between -Spin and +Spin
+    Spin float64
+
+    // interpolated over each particle's life
+    StartColor, EndColor pixel.RGBA
+    StartSize, EndSize   float64
+
+    // textured particles when set, otherwise filled squares
+    Sprite *pixel.Sprite
+
+    particles []particle
+    spawn     float64
+    rng       *rand.Rand
+    batch     *pixel.Batch
+    imd       *imdraw.IMDraw
+}
+
+func NewParticleEmitter(pos pixel.Vec) *ParticleEmitter {
+    return &ParticleEmitter{
+        Position:   pos,
+        Rate:       50,
+        Emitting:   true,
+        Lifetime:   1,
+        Direction:  math.Pi / 2,
+        Spread:     math.Pi / 8,
+        Speed:      100,
+        StartColor: pixel.RGB(1, 1, 1),
+        EndColor:   pixel.Alpha(0),
+        StartSize:  4,
+        EndSize:    1,
+        rng:        rng.Stream("vfx"),
+    }
+}
+
+func (e *ParticleEmitter) Len() int {
+    return len(e.particles)
+}
+
+// spawns n particles at once, e.g. for explosions
+func (e *ParticleEmitter) Burst(n int) {
+    for i := 0; i < n; i++ {
+        e.emit()
+    }
+}
+
+func (e *ParticleEmitter) variance(v float64) float64 {
+    return (e.rng.Float64()*2 - 1) * v
+}
+
+func (e *ParticleEmitter) emit() {
+    if e.MaxParticles > 0 && len(e.particles) >= e.MaxParticles {
+        return
+    }
+    angle := e.Direction + e.variance(e.Spread)
+    speed := e.Speed + e.variance(e.SpeedVariance)
+    life := e.Lifetime + e.variance(e.LifetimeVariance)
+    if life <= 0 {
+        return
+    }
+    e.particles = append(e.particles, particle{
+        pos:  e.Position,
+        vel:  pixel.Unit(angle).Scaled(speed),
+        life: life,
+        spin: e.variance(e.Spin),
+    })
+}
+
+// simulates dt seconds
+func (e *ParticleEmitter) Update(dt float64) {
+    if e.Emitting && e.Rate > 0 {
+        e.spawn += e.Rate * dt
+        for ; e.spawn >= 1; e.spawn-- {
+            e.emit()
+        }
+    }
+
+    alive := e.particles[:0]
+    for _, p := range e.particles {
+        p.age += dt
+        if p.age >= p.life {
+            continue
+        }
+        p.vel = p.vel.Add(e.Gravity.Scaled(dt))
+        p.pos = p.pos.Add(p.vel.Scaled(dt))
+        p.rotation += p.spin * dt
+        alive = append(alive, p)
+    }
+    e.particles = alive
+}
+
+func lerpRGBA(a, b pixel.RGBA, t float64) pixel.RGBA {
+    return a.Scaled(1 - t).Add(b.Scaled(t))
+}
+
+func (e *ParticleEmitter) Draw(t pixel.Target) {
+    if e.Sprite != nil {
+        e.drawSprites(t)
+    } else {
+        e.drawSquares(t)
+    }
+}
+
+func (e *ParticleEmitter) drawSprites(t pixel.Target) {
+    if e.batch == nil {
+        e.batch = pixel.NewBatch(&pixel.TrianglesData{}, e.Sprite.Picture())
+    }
+    e.batch.Clear()
+    width := e.Sprite.Frame().W()
+    for _, p := range e.particles {
+        life := p.age / p.life
+        size := e.StartSize + (e.EndSize-e.StartSize)*life
+        m := pixel.IM.Scaled(pixel.ZV, size/width).Rotated(pixel.ZV, p.rotation).Moved(p.pos)
+        e.Sprite.DrawColorMask(e.batch, m, lerpRGBA(e.StartColor, e.EndColor, life))
+    }
+    e.batch.Draw(t)
+}
+
+func (e *ParticleEmitter) drawSquares(t pixel.Target) {
+    if e.imd == nil {
+        e.imd = imdraw.New(nil)
+    }
+    e.imd.Clear()
+    for _, p := range e.particles {
+        life := p.age / p.life
+        half := (e.StartSize + (e.EndSize-e.StartSize)*life) / 2
+        e.imd.Color = lerpRGBA(e.StartColor, e.EndColor, life)
+        e.imd.Push(p.pos.Sub(pixel.V(half, half)), p.pos.Add(pixel.V(half, half)))
+        e.imd.Rectangle(0)
+    }
+    e.imd.Draw(t)
+}
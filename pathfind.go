@@ -0,0 +1,473 @@
+package main
+
+import (
+    "container/heap"
+    "fmt"
+    "math"
+    "strings"
+
+    "github.com/faiface/pixel"
+)
+
+// a cost that can't be entered at all
+const NAVBLOCKED = 0
+
+// nodes Pathfinder expands each tick across every search it's running
+const PATHBUDGET = 2000
+
+// a column and a row of a NavGrid, counted from the top-left like a tile layer's
+type GridCell struct {
+    X, Y int
+}
+
+// what it costs to walk onto each cell of a grid laid over the world, for pathfinding. 1 is
+// ordinary ground, NAVBLOCKED a wall, and anything else dearer or cheaper, like mud or a road.
+type NavGrid struct {
+    Width, Height int
+    CellSize      pixel.Vec
+    // where the top-left corner of cell 0, 0 is in the world
+    TopLeft pixel.Vec
+
+    costs []float64
+    // the cheapest open cell, which keeps the search's estimate from overshooting
+    cheapest float64
+}
+
+func NewNavGrid(width, height int, cellSize, topLeft pixel.Vec) *NavGrid {
+    g := &NavGrid{Width: width, Height: height, CellSize: cellSize, TopLeft: topLeft, costs: make([]float64, width*height), cheapest: 1}
+    for i := range g.costs {
+        g.costs[i] = 1
+    }
+    return g
+}
+
+// a grid over m's tiles from the same layers BuildColliders uses: solid cells are walls, and
+// one-way platforms and ladders are open. a tile with a "cost" property, on any layer, sets what
+// its cell costs. build it again after changing those layers. only orthogonal maps have one.
+func NavGridFromMap(m *TileMap) (*NavGrid, error) {
+    if m.Orientation != "" && m.Orientation != TILEORTHOGONAL {
+        return nil, fmt.Errorf("navgrid: %s maps aren't supported", m.Orientation)
+    }
+    tw, th := float64(m.TileWidth), float64(m.TileHeight)
+    g := NewNavGrid(m.Width, m.Height, pixel.V(tw, th), pixel.V(0, m.pixelSize().Y))
+    for _, l := range m.Layers {
+        collision := l.Properties.Bool("collision")
+        for y := 0; y < l.Height && y < g.Height; y++ {
+            for x := 0; x < l.Width && x < g.Width; x++ {
+                ts, id := m.TileFor(l.GID(x, y))
+                if ts == nil {
+                    continue
+                }
+                info := ts.Tiles[id]
+                if collision && tileSolidityOf(info) == tileSolid {
+                    g.SetCost(x, y, NAVBLOCKED)
+                } else if info != nil && info.Properties.Float("cost") > 0 && g.Cost(x, y) != NAVBLOCKED {
+                    g.SetCost(x, y, info.Properties.Float("cost"))
+                }
+            }
+        }
+    }
+    for _, ig := range m.IntGrids {
+        if !strings.HasPrefix(strings.ToLower(ig.Name), "collision") || ig.GridSize <= 0 {
+            continue
+        }
+        // sampled at each cell's centre, in case the IntGrid's cells aren't the tiles' size
+        for y := 0; y < g.Height; y++ {
+            for x := 0; x < g.Width; x++ {
+                v := ig.Value(int((float64(x)+0.5)*tw/float64(ig.GridSize)), int((float64(y)+0.5)*th/float64(ig.GridSize)))
+                if v != 0 && intGridSolidity(ig.Names[v]) == tileSolid {
+                    g.SetCost(x, y, NAVBLOCKED)
+                }
+            }
+        }
+    }
+    return g, nil
+}
+
+func (g *NavGrid) In(x, y int) bool {
+    return x >= 0 && y >= 0 && x < g.Width && y < g.Height
+}
+
+// what walking onto column x, row y costs; outside the grid is NAVBLOCKED
+func (g *NavGrid) Cost(x, y int) float64 {
+    if !g.In(x, y) {
+        return NAVBLOCKED
+    }
+    return g.costs[y*g.Width+x]
+}
+
+// negative costs count as NAVBLOCKED
+func (g *NavGrid) SetCost(x, y int, cost float64) {
+    if !g.In(x, y) {
+        return
+    }
+    cost = math.Max(NAVBLOCKED, cost)
+    g.costs[y*g.Width+x] = cost
+    if cost > 0 && cost < g.cheapest {
+        g.cheapest = cost
+    }
+}
+
+func (g *NavGrid) Walkable(x, y int) bool {
+    return g.Cost(x, y) > 0
+}
+
+// the cell containing world point p, and whether it's on the grid
+func (g *NavGrid) Cell(p pixel.Vec) (GridCell, bool) {
+    c := GridCell{int(math.Floor((p.X - g.TopLeft.X) / g.CellSize.X)), int(math.Floor((g.TopLeft.Y - p.Y) / g.CellSize.Y))}
+    return c, g.In(c.X, c.Y)
+}
+
+// the world position of c's centre
+func (g *NavGrid) Center(c GridCell) pixel.Vec {
+    return pixel.V(g.TopLeft.X+(float64(c.X)+0.5)*g.CellSize.X, g.TopLeft.Y-(float64(c.Y)+0.5)*g.CellSize.Y)
+}
+
+// whether a path can step diagonally between two cells, by the two cells beside the step
+type DiagonalRule int
+
+const (
+    DiagonalNever DiagonalRule = iota
+    // only with both beside it open, so paths never clip a wall's corner
+    DiagonalNoCorners
+    // with either beside it open, squeezing past a corner but not between two
+    DiagonalOneCorner
+    DiagonalAlways
+)
+
+// how a search goes
+type PathOptions struct {
+    Diagonal DiagonalRule
+    // what this agent pays to walk onto a cell the grid says costs cost, e.g. a boat that only
+    // crosses water, with NAVBLOCKED for cells it can't enter; nil pays the grid's costs. it
+    // shouldn't go under the grid's cheapest cost, or paths may come out longer than they need.
+    Cost func(x, y int, cost float64) float64
+    // drops the points a straight line can skip, where it only crosses open cells. it looks at
+    // walls, not costs, so it can cut across a costly cell the search went round.
+    Smooth bool
+    // cells the search looks at before giving up, or 0 for as many as the grid has
+    MaxNodes int
+}
+
+type pathNode struct {
+    cell int
+    f, h float64
+}
+
+// the open cells, cheapest estimate first and, between equals, nearest the goal
+type pathHeap []pathNode
+
+func (h pathHeap) Len() int { return len(h) }
+func (h pathHeap) Less(i, j int) bool {
+    if h[i].f != h[j].f {
+        return h[i].f < h[j].f
+    }
+    return h[i].h < h[j].h
+}
+func (h pathHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *pathHeap) Push(x interface{}) { *h = append(*h, x.(pathNode)) }
+func (h *pathHeap) Pop() interface{} {
+    n := (*h)[len(*h)-1]
+    *h = (*h)[:len(*h)-1]
+    return n
+}
+
+// an A* search from one cell to another that can be run a few cells at a time, so a long one
+// doesn't stall a frame. it reads the grid as it is at each Step.
+type PathSearch struct {
+    Grid     *NavGrid
+    From, To GridCell
+    Options  PathOptions
+
+    open     pathHeap
+    g        []float64
+    parent   []int
+    closed   []bool
+    expanded int
+    done     bool
+    found    bool
+    cells    []GridCell
+}
+
+// a search from from to to that hasn't started; Step runs it
+func (g *NavGrid) Search(from, to GridCell, opts PathOptions) *PathSearch {
+    s := &PathSearch{Grid: g, From: from, To: to, Options: opts}
+    n := g.Width * g.Height
+    s.g, s.parent, s.closed = make([]float64, n), make([]int, n), make([]bool, n)
+    for i := range s.g {
+        s.g[i] = math.Inf(1)
+        s.parent[i] = -1
+    }
+    if !g.In(from.X, from.Y) || s.cost(to.X, to.Y) <= 0 {
+        // the start may be in a wall, like an agent pushed into one, but the goal can't be
+        s.done = true
+        return s
+    }
+    start := s.index(from)
+    s.g[start] = 0
+    h := s.heuristic(from)
+    heap.Push(&s.open, pathNode{start, h, h})
+    return s
+}
+
+// the whole path from from to to, finding it straight away: the centres of its cells from the
+// start's to the goal's, or false if there's no way there
+func (g *NavGrid) FindPath(from, to pixel.Vec, opts PathOptions) ([]pixel.Vec, bool) {
+    a, _ := g.Cell(from)
+    b, _ := g.Cell(to)
+    s := g.Search(a, b, opts)
+    s.Step(0)
+    return s.Points(), s.Found()
+}
+
+func (s *PathSearch) index(c GridCell) int {
+    return c.Y*s.Grid.Width + c.X
+}
+
+func (s *PathSearch) at(i int) GridCell {
+    return GridCell{i % s.Grid.Width, i / s.Grid.Width}
+}
+
+func (s *PathSearch) cost(x, y int) float64 {
+    c := s.Grid.Cost(x, y)
+    if c > 0 && s.Options.Cost != nil {
+        c = s.Options.Cost(x, y, c)
+    }
+    return c
+}
+
+func (s *PathSearch) heuristic(c GridCell) float64 {
+    dx, dy := math.Abs(float64(c.X-s.To.X)), math.Abs(float64(c.Y-s.To.Y))
+    if s.Options.Diagonal == DiagonalNever {
+        return (dx + dy) * s.Grid.cheapest
+    }
+    // octile distance: diagonal steps as far as they go, then straight
+    return (math.Max(dx, dy) + (math.Sqrt2-1)*math.Min(dx, dy)) * s.Grid.cheapest
+}
+
+func (s *PathSearch) diagonal(c GridCell, dx, dy int) bool {
+    a, b := s.cost(c.X+dx, c.Y) > 0, s.cost(c.X, c.Y+dy) > 0
+    switch s.Options.Diagonal {
+    case DiagonalNoCorners:
+        return a && b
+    case DiagonalOneCorner:
+        return a || b
+    case DiagonalAlways:
+        return true
+    }
+    return false
+}
+
+// looks at up to budget more cells, or all of them if it's 0, and returns whether it's finished
+func (s *PathSearch) Step(budget int) bool {
+    for n := 0; !s.done && (budget <= 0 || n < budget); n++ {
+        if s.open.Len() == 0 {
+            s.done = true
+            break
+        }
+        node := heap.Pop(&s.open).(pathNode)
+        if s.closed[node.cell] {
+            continue
+        }
+        s.closed[node.cell] = true
+        s.expanded++
+        cur := s.at(node.cell)
+        if cur == s.To {
+            s.finish(node.cell)
+            break
+        }
+        if s.Options.MaxNodes > 0 && s.expanded >= s.Options.MaxNodes {
+            s.done = true
+            break
+        }
+        for dy := -1; dy <= 1; dy++ {
+            for dx := -1; dx <= 1; dx++ {
+                if dx == 0 && dy == 0 {
+                    continue
+                }
+                next := GridCell{cur.X + dx, cur.Y + dy}
+                c := s.cost(next.X, next.Y)
+                if c <= 0 || s.closed[s.index(next)] {
+                    continue
+                }
+                if dx != 0 && dy != 0 {
+                    if !s.diagonal(cur, dx, dy) {
+                        continue
+                    }
+                    c *= math.Sqrt2
+                }
+                i := s.index(next)
+                if g := s.g[node.cell] + c; g < s.g[i] {
+                    s.g[i], s.parent[i] = g, node.cell
+                    h := s.heuristic(next)
+                    heap.Push(&s.open, pathNode{i, g + h, h})
+                }
+            }
+        }
+    }
+    return s.done
+}
+
+func (s *PathSearch) finish(goal int) {
+    s.done, s.found = true, true
+    for i := goal; i >= 0; i = s.parent[i] {
+        s.cells = append(s.cells, s.at(i))
+    }
+    for i, j := 0, len(s.cells)-1; i < j; i, j = i+1, j-1 {
+        s.cells[i], s.cells[j] = s.cells[j], s.cells[i]
+    }
+    // the open list and the scores aren't needed any more
+    s.open, s.g, s.parent, s.closed = nil, nil, nil, nil
+    if s.Options.Smooth {
+        s.cells = s.smooth(s.cells)
+    }
+}
+
+func (s *PathSearch) Done() bool {
+    return s.done
+}
+
+func (s *PathSearch) Found() bool {
+    return s.found
+}
+
+// how many cells it's looked at so far
+func (s *PathSearch) Expanded() int {
+    return s.expanded
+}
+
+// the path's cells from From to To, once it's found one
+func (s *PathSearch) Cells() []GridCell {
+    return s.cells
+}
+
+// the world positions of the centres of Cells
+func (s *PathSearch) Points() []pixel.Vec {
+    points := make([]pixel.Vec, len(s.cells))
+    for i, c := range s.cells {
+        points[i] = s.Grid.Center(c)
+    }
+    return points
+}
+
+// keeps a cell only where the line from the last one kept to the cell after it would be blocked
+func (s *PathSearch) smooth(cells []GridCell) []GridCell {
+    if len(cells) < 3 {
+        return cells
+    }
+    kept := []GridCell{cells[0]}
+    for i := 2; i < len(cells); i++ {
+        if !s.clear(kept[len(kept)-1], cells[i]) {
+            kept = append(kept, cells[i-1])
+        }
+    }
+    return append(kept, cells[len(cells)-1])
+}
+
+// whether every cell the line between a's and b's centres touches is open. where it passes
+// exactly through a corner both cells beside it have to be.
+func (s *PathSearch) clear(a, b GridCell) bool {
+    nx, ny := b.X-a.X, b.Y-a.Y
+    sx, sy := 1, 1
+    if nx < 0 {
+        nx, sx = -nx, -1
+    }
+    if ny < 0 {
+        ny, sy = -ny, -1
+    }
+    x, y := a.X, a.Y
+    for ix, iy := 0, 0; ix < nx || iy < ny; {
+        // which of the next column and row boundaries the line reaches first
+        d := (1+2*ix)*ny - (1+2*iy)*nx
+        switch {
+        case d == 0:
+            if s.cost(x+sx, y) <= 0 || s.cost(x, y+sy) <= 0 {
+                return false
+            }
+            x, y, ix, iy = x+sx, y+sy, ix+1, iy+1
+        case d < 0:
+            x, ix = x+sx, ix+1
+        default:
+            y, iy = y+sy, iy+1
+        }
+        if s.cost(x, y) <= 0 {
+            return false
+        }
+    }
+    return true
+}
+
+type pathRequest struct {
+    search *PathSearch
+    done   func(s *PathSearch)
+}
+
+// runs searches a few at a time, oldest first, over as many ticks as their Budget takes, so a
+// crowd of agents all asking at once doesn't cost one frame the lot, e.g.
+//
+//	ctx.Paths.Request(grid, enemy.Position, player.Position, PathOptions{Smooth: true}, func(points []pixel.Vec, ok bool) {
+//		if ok {
+//			enemy.Follow(points)
+//		}
+//	})
+type Pathfinder struct {
+    // cells looked at per tick across every search, PATHBUDGET by default
+    Budget int
+
+    queue []pathRequest
+}
+
+func NewPathfinder() *Pathfinder {
+    return &Pathfinder{Budget: PATHBUDGET}
+}
+
+// runs s until it's done, then calls done with it
+func (p *Pathfinder) Find(s *PathSearch, done func(s *PathSearch)) {
+    p.queue = append(p.queue, pathRequest{s, done})
+}
+
+// finds a path between two world positions over the next ticks and calls done with the points
+// of it from FindPath, or false if there isn't one. the search comes back to cancel it with.
+func (p *Pathfinder) Request(g *NavGrid, from, to pixel.Vec, opts PathOptions, done func(points []pixel.Vec, ok bool)) *PathSearch {
+    a, _ := g.Cell(from)
+    b, _ := g.Cell(to)
+    s := g.Search(a, b, opts)
+    p.Find(s, func(s *PathSearch) {
+        done(s.Points(), s.Found())
+    })
+    return s
+}
+
+// drops s without calling its done, e.g. when its agent's died or wants to go somewhere else
+func (p *Pathfinder) Cancel(s *PathSearch) {
+    for i, r := range p.queue {
+        if r.search == s {
+            p.queue = append(p.queue[:i:i], p.queue[i+1:]...)
+            return
+        }
+    }
+}
+
+// searches still running
+func (p *Pathfinder) Pending() int {
+    return len(p.queue)
+}
+
+// spends the tick's budget on the oldest searches, calling done on each that finishes
+func (p *Pathfinder) Update() {
+    budget := p.Budget
+    if budget <= 0 {
+        budget = PATHBUDGET
+    }
+    for len(p.queue) > 0 && budget > 0 {
+        r := p.queue[0]
+        before := r.search.Expanded()
+        if !r.search.Step(budget) {
+            return
+        }
+        // a finished search may have used less than it was given, and done may queue another
+        budget -= r.search.Expanded() - before + 1
+        p.queue = p.queue[1:]
+        r.done(r.search)
+    }
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// whether the simulation is frozen. it keeps the flag, its callbacks and the pause menu; the main
+// loop hands the flag to the tweener, the scheduler and the scene manager each frame, which hold
+// everything that isn't marked unpausable while drawing and the pause menu carry on.
+type Pause struct {
+    // toggles the pause; set it to pixelgl.KeyUnknown to only pause from code. while something's
+    // open over the pause menu, like its settings, it closes that instead.
+    Key pixelgl.Button
+    // makes the scene pushed over the others while paused, and taken off again on resume, with
+    // whatever was opened from it; a PauseMenuScene by default, nil for no menu
+    Menu func() Scene
+    // pauses when the window loses focus
+    AutoPause bool
+    // resumes when focus comes back, but only from a pause that losing focus started
+    ResumeOnFocus bool
+
+    paused bool
+    auto   bool
+    // starts true so the first Update doesn't see the window gaining focus
+    focused  bool
+    onPause  []func()
+    onResume []func()
+    // the menu showing, or nil
+    menu Scene
+}
+
+func NewPause() *Pause {
+    return &Pause{
+        Key:       pixelgl.KeyEscape,
+        Menu:      func() Scene { return NewPauseMenuScene() },
+        AutoPause: true,
+        focused:   true,
+    }
+}
+
+func (p *Pause) OnPause(fn func()) {
+    p.onPause = append(p.onPause, fn)
+}
+
+func (p *Pause) OnResume(fn func()) {
+    p.onResume = append(p.onResume, fn)
+}
+
+func (p *Pause) Paused() bool {
+    return p.paused
+}
+
+// whether it's paused because the window lost focus, rather than by the player or the game
+func (p *Pause) AutoPaused() bool {
+    return p.paused && p.auto
+}
+
+func (p *Pause) Pause() {
+    if p.paused {
+        return
+    }
+    p.paused = true
+    p.auto = false
+    if p.Menu != nil && scenes != nil {
+        p.menu = p.Menu()
+        scenes.Push(p.menu)
+    }
+    for _, fn := range p.onPause {
+        fn()
+    }
+}
+
+func (p *Pause) Resume() {
+    if !p.paused {
+        return
+    }
+    p.paused = false
+    p.auto = false
+    if p.menu != nil {
+        scenes.Remove(p.menu)
+        p.menu = nil
+    }
+    for _, fn := range p.onResume {
+        fn()
+    }
+}
+
+func (p *Pause) Toggle() {
+    if p.paused {
+        p.Resume()
+    } else {
+        p.Pause()
+    }
+}
+
+// the pause menu while it's showing, or nil
+func (p *Pause) ShowingMenu() Scene {
+    return p.menu
+}
+
+// handles the toggle key and focus changes, once per frame, after actions.Update. the key's left
+// alone while a binding is being changed and on the frame it cancels one.
+func (p *Pause) Update(in Input) {
+    rebinding := false
+    if actions != nil {
+        _, rebinding = actions.Rebinding()
+        rebinding = rebinding || actions.Rebound()
+    }
+    if p.Key != pixelgl.KeyUnknown && in.JustPressed(p.Key) && !rebinding {
+        if p.menu != nil && scenes.Top() != p.menu {
+            scenes.Pop()
+        } else {
+            p.Toggle()
+        }
+    }
+    focused := in.Focused()
+    switch {
+    case p.focused && !focused && p.AutoPause && !p.paused:
+        p.Pause()
+        p.auto = true
+    case !p.focused && focused && p.ResumeOnFocus && p.auto:
+        p.Resume()
+    }
+    p.focused = focused
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "golang.org/x/image/colornames"
+)
+
+type BodyKind int
+
+const (
+    // moved by forces, gravity and collisions
+    BodyDynamic BodyKind = iota
+    // moved by the game, through its Transform, and pushes dynamic bodies out of the way
+    BodyKinematic
+    // never moves, e.g. the level
+    BodyStatic
+)
+
+type ShapeKind int
+
+const (
+    ShapeBox ShapeKind = iota
+    ShapeCircle
+    // convex, counter-clockwise
+    ShapeConvex
+)
+
+// one piece of a body, relative to its center
+type BodyShape struct {
+    Kind ShapeKind
+    // a box's size, a circle's radius, or a polygon's points
+    Size   pixel.Vec
+    Radius float64
+    Points []pixel.Vec
+    Offset pixel.Vec
+    // per unit of area; bodies' mass comes from their shapes
+    Density, Friction, Restitution float64
+    // reports contacts without colliding
+    Sensor bool
+}
+
+func BoxShape(size pixel.Vec) BodyShape {
+    return BodyShape{Kind: ShapeBox, Size: size, Density: 1, Friction: 0.5}
+}
+
+func CircleShape(radius float64) BodyShape {
+    return BodyShape{Kind: ShapeCircle, Radius: radius, Density: 1, Friction: 0.5}
+}
+
+// a rigid body on an entity, which Physics keeps in its backend and in step with the entity's
+// Transform: the backend moves dynamic bodies and the Transform follows, the game moves
+// kinematic ones through the Transform. changing the fields after the first step has no effect;
+// use Body() to push it around.
+type RigidBody struct {
+    Kind          BodyKind
+    Shapes        []BodyShape
+    FixedRotation bool
+    // multiplies the backend's damping; 0 is none
+    LinearDamping, AngularDamping float64
+    // the starting velocity
+    Velocity pixel.Vec
+}
+
+var RigidBodyType = ComponentTypeOf((*RigidBody)(nil))
+
+func init() {
+    RegisterComponent("rigidbody", (*RigidBody)(nil))
+}
+
+// what a backend is told to make for an entity's RigidBody
+type BodyDef struct {
+    Entity   Entity
+    Body     RigidBody
+    Position pixel.Vec
+    Rotation float64
+}
+
+// a body inside the backend
+type PhysicsBody interface {
+    Position() pixel.Vec
+    Rotation() float64
+    SetTransform(pos pixel.Vec, rotation float64)
+    Velocity() pixel.Vec
+    SetVelocity(v pixel.Vec)
+    ApplyForce(force, at pixel.Vec)
+    ApplyImpulse(impulse, at pixel.Vec)
+}
+
+type JointKind int
+
+const (
+    // holds the anchors together, free to turn
+    JointPin JointKind = iota
+    // keeps the anchors Length apart, e.g. a rope or a pendulum
+    JointDistance
+    // pulls the anchors toward Length apart with Stiffness and Damping
+    JointSpring
+    // keeps the bodies from turning relative to each other too
+    JointWeld
+)
+
+// a joint between two entities' bodies; the anchors are relative to each body's center
+type JointDef struct {
+    Kind               JointKind
+    A, B               Entity
+    AnchorA, AnchorB   pixel.Vec
+    Length             float64
+    Stiffness, Damping float64
+}
+
+type PhysicsJoint interface {
+    // 0 for joints that can't break
+    SetBreakForce(force float64)
+}
+
+// what a real 2D physics engine, e.g. Chipmunk through github.com/jakecoffman/cp or Box2D
+// through github.com/ByteArena/box2d, gets wrapped in so Physics can drive it. the engine doesn't
+// depend on either; a game that wants one writes the adapter and sets physics.Backend. bodies are
+// made and removed by Physics, and the backend reports contacts back with physics.Report.
+type PhysicsBackend interface {
+    SetGravity(g pixel.Vec)
+    AddBody(def BodyDef) PhysicsBody
+    RemoveBody(b PhysicsBody)
+    AddJoint(def JointDef, a, b PhysicsBody) PhysicsJoint
+    RemoveJoint(j PhysicsJoint)
+    Step(dt float64)
+}
+
+// a contact a backend reports between two bodies' shapes, at Point in world space
+type PhysicsContact struct {
+    A, B   Entity
+    Point  pixel.Vec
+    Normal pixel.Vec
+    // the impulse the backend applied to separate them, 0 for sensors
+    Impulse float64
+    Sensor  bool
+}
+
+type physicsJoint struct {
+    def   JointDef
+    joint PhysicsJoint
+}
+
+// syncs RigidBody entities in World with a PhysicsBackend, once per fixed step. with a Backend
+// set, the engine steps this instead of collision, for games that want stacking, joints and
+// bounces rather than simple boxes.
+type Physics struct {
+    World   *World
+    Backend PhysicsBackend
+    Gravity pixel.Vec
+    // draws every body's shapes and velocity over the world
+    Debug bool
+
+    bodies   map[Entity]PhysicsBody
+    joints   []*physicsJoint
+    gravity  pixel.Vec
+    started  bool
+    contacts []func(PhysicsContact)
+}
+
+func NewPhysics() *Physics {
+    return &Physics{Gravity: pixel.V(0, -980), bodies: make(map[Entity]PhysicsBody)}
+}
+
+// whether it's stepping in place of collision
+func (p *Physics) Active() bool {
+    return p.Backend != nil && p.World != nil
+}
+
+// registers fn for the contacts the backend reports
+func (p *Physics) OnContact(fn func(PhysicsContact)) {
+    p.contacts = append(p.contacts, fn)
+}
+
+// for backends: passes a contact on to the OnContact handlers
+func (p *Physics) Report(c PhysicsContact) {
+    for _, fn := range p.contacts {
+        fn(c)
+    }
+}
+
+// e's body in the backend, once a step has made it
+func (p *Physics) Body(e Entity) PhysicsBody {
+    return p.bodies[e]
+}
+
+// joins two entities' bodies; it's made on the next step if they aren't in the backend yet, and
+// goes away with either of them
+func (p *Physics) Joint(def JointDef) {
+    p.joints = append(p.joints, &physicsJoint{def: def})
+}
+
+// removes the joints between a and b
+func (p *Physics) Unjoint(a, b Entity) {
+    kept := p.joints[:0]
+    for _, j := range p.joints {
+        if (j.def.A == a && j.def.B == b) || (j.def.A == b && j.def.B == a) {
+            if j.joint != nil {
+                p.Backend.RemoveJoint(j.joint)
+            }
+            continue
+        }
+        kept = append(kept, j)
+    }
+    p.joints = kept
+}
+
+// adds and removes bodies to match World, steps the backend and copies the results into the
+// Transforms; the engine calls it every fixed step while Active
+func (p *Physics) Step(dt float64) {
+    if !p.Active() {
+        return
+    }
+    if !p.started || p.Gravity != p.gravity {
+        p.Backend.SetGravity(p.Gravity)
+        p.gravity, p.started = p.Gravity, true
+    }
+    present := make(map[Entity]bool)
+    for _, e := range p.World.Query(RigidBodyType, TransformType) {
+        present[e] = true
+        t := p.World.Get(e, TransformType).(*Transform)
+        rb := p.World.Get(e, RigidBodyType).(*RigidBody)
+        body, ok := p.bodies[e]
+        if !ok {
+            body = p.Backend.AddBody(BodyDef{Entity: e, Body: *rb, Position: t.Position, Rotation: t.Rotation})
+            p.bodies[e] = body
+            if rb.Velocity != pixel.ZV {
+                body.SetVelocity(rb.Velocity)
+            }
+        }
+        if rb.Kind == BodyKinematic {
+            body.SetTransform(t.Position, t.Rotation)
+        }
+    }
+    for e, body := range p.bodies {
+        if !present[e] {
+            p.removeJoints(e)
+            p.Backend.RemoveBody(body)
+            delete(p.bodies, e)
+        }
+    }
+    for _, j := range p.joints {
+        a, b := p.bodies[j.def.A], p.bodies[j.def.B]
+        if j.joint == nil && a != nil && b != nil {
+            j.joint = p.Backend.AddJoint(j.def, a, b)
+        }
+    }
+
+    p.Backend.Step(dt)
+
+    for e, body := range p.bodies {
+        if p.World.Get(e, RigidBodyType).(*RigidBody).Kind != BodyDynamic {
+            continue
+        }
+        t := p.World.Get(e, TransformType).(*Transform)
+        t.Position, t.Rotation = body.Position(), body.Rotation()
+    }
+}
+
+func (p *Physics) removeJoints(e Entity) {
+    kept := p.joints[:0]
+    for _, j := range p.joints {
+        if j.def.A == e || j.def.B == e {
+            if j.joint != nil {
+                p.Backend.RemoveJoint(j.joint)
+            }
+            continue
+        }
+        kept = append(kept, j)
+    }
+    p.joints = kept
+}
+
+// takes every body out of the backend, e.g. when the level ends
+func (p *Physics) Clear() {
+    for e, body := range p.bodies {
+        p.removeJoints(e)
+        p.Backend.RemoveBody(body)
+        delete(p.bodies, e)
+    }
+    p.joints = nil
+}
+
+// while Debug is on, outlines every body's shapes over the world: dynamic ones green, kinematic
+// blue, static grey and sensors yellow, with velocities as red lines
+func (p *Physics) Draw() {
+    if !p.Debug || !p.Active() {
+        return
+    }
+    imd := renderer.IMDraw(LAYERPARTICLES)
+    for _, e := range p.World.Query(RigidBodyType, TransformType) {
+        t := p.World.Get(e, TransformType).(*Transform)
+        rb := p.World.Get(e, RigidBodyType).(*RigidBody)
+        place := pixel.IM.Rotated(pixel.ZV, t.Rotation).Moved(t.Position)
+        for _, s := range rb.Shapes {
+            switch {
+            case s.Sensor:
+                imd.Color = colornames.Yellow
+            case rb.Kind == BodyKinematic:
+                imd.Color = colornames.Deepskyblue
+            case rb.Kind == BodyStatic:
+                imd.Color = colornames.Gray
+            default:
+                imd.Color = colornames.Lime
+            }
+            drawBodyShape(imd, s, place)
+        }
+        if body := p.bodies[e]; body != nil && rb.Kind == BodyDynamic {
+            imd.Color = colornames.Red
+            imd.Push(t.Position, t.Position.Add(body.Velocity().Scaled(0.1)))
+            imd.Line(1)
+        }
+    }
+}
+
+func drawBodyShape(imd *imdraw.IMDraw, s BodyShape, place pixel.Matrix) {
+    switch s.Kind {
+    case ShapeCircle:
+        center := place.Project(s.Offset)
+        imd.Push(center)
+        imd.Circle(s.Radius, 1)
+        // a spoke, so turning shows
+        imd.Push(center, place.Project(s.Offset.Add(pixel.V(s.Radius, 0))))
+        imd.Line(1)
+        return
+    case ShapeBox:
+        half := s.Size.Scaled(0.5)
+        for _, corner := range []pixel.Vec{{X: -half.X, Y: -half.Y}, {X: half.X, Y: -half.Y}, {X: half.X, Y: half.Y}, {X: -half.X, Y: half.Y}} {
+            imd.Push(place.Project(s.Offset.Add(corner)))
+        }
+    default:
+        for _, pt := range s.Points {
+            imd.Push(place.Project(s.Offset.Add(pt)))
+        }
+    }
+    imd.Polygon(1)
+}
+
+// a body's mass from its shapes' areas and densities
+func (rb *RigidBody) Mass() float64 {
+    var mass float64
+    for _, s := range rb.Shapes {
+        mass += s.Area() * s.Density
+    }
+    return mass
+}
+
+func (s BodyShape) Area() float64 {
+    switch s.Kind {
+    case ShapeCircle:
+        return math.Pi * s.Radius * s.Radius
+    case ShapeBox:
+        return s.Size.X * s.Size.Y
+    }
+    var twice float64
+    for i, a := range s.Points {
+        b := s.Points[(i+1)%len(s.Points)]
+        twice += a.X*b.Y - b.X*a.Y
+    }
+    return math.Abs(twice) / 2
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+    "image/color"
+
+    "github.com/faiface/pixel"
+)
+
+const (
+    PLACEHOLDERSIZE   = 32
+    PLACEHOLDERSQUARE = 8
+)
+
+// generates the magenta and black checkerboard used in place of missing pictures
+func PlaceholderPicture(w, h int) *pixel.PictureData {
+    pd := pixel.MakePictureData(pixel.R(0, 0, float64(w), float64(h)))
+    magenta := color.RGBA{R: 0xff, B: 0xff, A: 0xff}
+    black := color.RGBA{A: 0xff}
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            if (x/PLACEHOLDERSQUARE+y/PLACEHOLDERSQUARE)%2 == 0 {
+                pd.Pix[y*pd.Stride+x] = magenta
+            } else {
+                pd.Pix[y*pd.Stride+x] = black
+            }
+        }
+    }
+    return pd
+}
+
+// loads path, falling back to a placeholder so a missing file shows up on screen instead of
+// stopping the game. the load error is still returned for callers that want to report it.
+func LoadPictureOrPlaceholder(path string) (pixel.Picture, error) {
+    pic, err := LoadPicture(path)
+    if err != nil {
+        assetLog.Warnf("%v, using placeholder", err)
+        return PlaceholderPicture(PLACEHOLDERSIZE, PLACEHOLDERSIZE), err
+    }
+    return pic, nil
+}
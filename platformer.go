@@ -0,0 +1,228 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+)
+
+// moves a side-on character through collision, with the allowances that make jumping feel fair:
+// a jump still works CoyoteTime after running off a ledge and when pressed JumpBuffer before
+// landing, and letting go early cuts it short. steps up to StepHeight are climbed and followed
+// back down, so stairs and tile slopes walk smoothly, and it rides whatever it stands on, so
+// moving platforms carry it; move those with collision.Teleport. one-way platforms come from
+// collision. the entity needs a Transform and a Collider.
+type Platformer struct {
+    Entity Entity
+
+    // horizontal: top speed, and how fast it gets there and stops, per second, on the ground and
+    // in the air
+    Speed, Acceleration, Deceleration, AirAcceleration float64
+    // downward, per second per second; falling uses FallMultiplier times as much for a snappier
+    // arc, up to MaxFall
+    Gravity, FallMultiplier, MaxFall float64
+    // upward speed a jump starts with, and what's kept of it when jump is let go on the way up
+    JumpSpeed, JumpCut     float64
+    CoyoteTime, JumpBuffer float64
+    StepHeight             float64
+
+    Velocity pixel.Vec
+    OnGround bool
+    // what it's standing on, while OnGround
+    Ground Entity
+
+    groundAt       pixel.Vec
+    coyote, buffer float64
+    jumping, held  bool
+    onJump         []func()
+    onLand         []func(speed float64)
+}
+
+func NewPlatformer(e Entity) *Platformer {
+    return &Platformer{
+        Entity:          e,
+        Speed:           120,
+        Acceleration:    1200,
+        Deceleration:    1600,
+        AirAcceleration: 600,
+        Gravity:         1200,
+        FallMultiplier:  1.6,
+        MaxFall:         600,
+        JumpSpeed:       380,
+        JumpCut:         0.5,
+        CoyoteTime:      0.1,
+        JumpBuffer:      INPUTBUFFER,
+        StepHeight:      4,
+    }
+}
+
+func (p *Platformer) OnJump(fn func()) {
+    p.onJump = append(p.onJump, fn)
+}
+
+// registers fn for touching down, with how fast it was falling
+func (p *Platformer) OnLand(fn func(speed float64)) {
+    p.onLand = append(p.onLand, fn)
+}
+
+// steps the character by dt with move from -1 to 1 and whether jump is held, e.g.
+// p.Update(actions.Axis("left", "right"), actions.Pressed("confirm"), dt) from Game.Update
+func (p *Platformer) Update(move float64, jump bool, dt float64) {
+    c := collision
+    t, _ := c.World.Get(p.Entity, TransformType).(*Transform)
+    if t == nil {
+        return
+    }
+    p.ride()
+
+    if p.OnGround {
+        p.coyote = p.CoyoteTime
+    } else {
+        p.coyote -= dt
+    }
+    if jump && !p.held {
+        p.buffer = p.JumpBuffer
+    } else {
+        p.buffer -= dt
+    }
+    p.held = jump
+
+    accel := p.AirAcceleration
+    if p.OnGround {
+        accel = p.Acceleration
+        if move == 0 {
+            accel = p.Deceleration
+        }
+    }
+    p.Velocity.X = approach(p.Velocity.X, move*p.Speed, accel*dt)
+
+    if p.buffer > 0 && p.coyote > 0 {
+        p.Velocity.Y = p.JumpSpeed
+        p.buffer, p.coyote = 0, 0
+        p.jumping, p.OnGround = true, false
+        for _, fn := range p.onJump {
+            fn()
+        }
+    }
+    if p.jumping && !jump && p.Velocity.Y > 0 {
+        p.Velocity.Y *= p.JumpCut
+        p.jumping = false
+    }
+    if p.Velocity.Y <= 0 {
+        p.jumping = false
+    }
+    gravity := p.Gravity
+    if p.Velocity.Y < 0 {
+        gravity *= p.FallMultiplier
+    }
+    p.Velocity.Y = math.Max(p.Velocity.Y-gravity*dt, -p.MaxFall)
+
+    p.moveX(p.Velocity.X * dt)
+
+    wasGround := p.OnGround
+    fall := -p.Velocity.Y
+    _, hits := c.MoveAndCollide(p.Entity, pixel.V(0, p.Velocity.Y*dt))
+    p.OnGround = false
+    for _, hit := range hits {
+        switch {
+        case hit.Normal.Y > 0:
+            p.land(hit.B)
+        case hit.Normal.Y < 0 && p.Velocity.Y > 0:
+            // bumped its head
+            p.Velocity.Y = 0
+        }
+    }
+    // keep to the ground walking down steps instead of hopping off each one
+    if wasGround && !p.OnGround && !p.jumping && p.StepHeight > 0 {
+        p.snapDown()
+    }
+    if p.OnGround {
+        p.Velocity.Y = 0
+        if !wasGround {
+            for _, fn := range p.onLand {
+                fn(fall)
+            }
+        }
+    }
+}
+
+func (p *Platformer) land(ground Entity) {
+    p.OnGround, p.Ground = true, ground
+    if t, _ := collision.World.Get(ground, TransformType).(*Transform); t != nil {
+        p.groundAt = t.Position
+    }
+}
+
+// moves along with the ground since the last update
+func (p *Platformer) ride() {
+    if !p.OnGround {
+        return
+    }
+    t, _ := collision.World.Get(p.Ground, TransformType).(*Transform)
+    if t == nil {
+        p.OnGround = false
+        return
+    }
+    if delta := t.Position.Sub(p.groundAt); delta != pixel.ZV {
+        collision.MoveAndCollide(p.Entity, delta)
+    }
+    p.groundAt = t.Position
+}
+
+// moves dx sideways, stepping up onto anything up to StepHeight in the way
+func (p *Platformer) moveX(dx float64) {
+    if dx == 0 {
+        return
+    }
+    c := collision
+    t := c.World.Get(p.Entity, TransformType).(*Transform)
+    start := t.Position
+    moved, hits := c.MoveAndCollide(p.Entity, pixel.V(dx, 0))
+    if len(hits) == 0 {
+        return
+    }
+    if p.OnGround && p.StepHeight > 0 {
+        blocked := t.Position
+        c.Teleport(p.Entity, start)
+        if up, _ := c.MoveAndCollide(p.Entity, pixel.V(0, p.StepHeight)); up.Y > 0 {
+            if over, _ := c.MoveAndCollide(p.Entity, pixel.V(dx, 0)); math.Abs(over.X) > math.Abs(moved.X) {
+                if _, hits := c.MoveAndCollide(p.Entity, pixel.V(0, -up.Y)); landedOn(hits) {
+                    return
+                }
+            }
+        }
+        c.Teleport(p.Entity, blocked)
+    }
+    p.Velocity.X = 0
+}
+
+func (p *Platformer) snapDown() {
+    c := collision
+    t := c.World.Get(p.Entity, TransformType).(*Transform)
+    before := t.Position
+    _, hits := c.MoveAndCollide(p.Entity, pixel.V(0, -p.StepHeight))
+    for _, hit := range hits {
+        if hit.Normal.Y > 0 {
+            p.land(hit.B)
+            return
+        }
+    }
+    c.Teleport(p.Entity, before)
+}
+
+func landedOn(hits []Contact) bool {
+    for _, hit := range hits {
+        if hit.Normal.Y > 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// moves v toward target by at most step
+func approach(v, target, step float64) float64 {
+    if v < target {
+        return math.Min(v+step, target)
+    }
+    return math.Max(v-step, target)
+}
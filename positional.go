@@ -0,0 +1,118 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/beep"
+    "github.com/faiface/pixel"
+)
+
+// how far past the edge of the view, in half views, a sound played at a position fades out over
+const AUDIOFALLOFF = 1.5
+
+// how far a sound at the edge of the view is panned toward that side, 0 to 1
+const AUDIOEDGEPAN = 0.6
+
+// balances a sound between the speakers and scales it, from where it was played relative to the
+// listener; Audio.Update moves both as the emitter and the camera move
+type pannedStreamer struct {
+    streamer beep.Streamer
+    // -1 all left to 1 all right
+    pan  float64
+    gain float64
+}
+
+func (p *pannedStreamer) Stream(samples [][2]float64) (int, bool) {
+    n, ok := p.streamer.Stream(samples)
+    left := p.gain * math.Min(1, 1-p.pan)
+    right := p.gain * math.Min(1, 1+p.pan)
+    for i := range samples[:n] {
+        samples[i][0] *= left
+        samples[i][1] *= right
+    }
+    return n, ok
+}
+
+func (p *pannedStreamer) Err() error {
+    return p.streamer.Err()
+}
+
+// where sounds played at a position are heard from: the camera's position, how far its view
+// reaches and which way it's turned. simulate sets it every frame.
+func (a *Audio) ListenFrom(c *Camera) {
+    a.listener, a.reach, a.rotation = c.Position, c.halfView(), c.Rotation
+}
+
+// turns placing sounds by where they are on or off, e.g. from an options screen
+func (a *Audio) SetSpatial(spatial bool) {
+    a.mu.Lock()
+    a.volume.Spatial = spatial
+    a.mu.Unlock()
+    a.changed()
+}
+
+// starts s as if it came from pos in the world: panned toward the side of the view it's on, and
+// fading out once it's off screen by AUDIOFALLOFF half views. with spatial audio off in the
+// settings it plays like Play.
+func (a *Audio) PlayAt(s *Sound, pos pixel.Vec) *Playback {
+    return a.playAt(s.buffer.Streamer(0, s.buffer.Len()), pos)
+}
+
+func (a *Audio) playAt(stream beep.Streamer, pos pixel.Vec) *Playback {
+    panned := &pannedStreamer{streamer: stream}
+    p := &Playback{audio: a, panned: panned, pos: pos}
+    a.mu.Lock()
+    a.place(p)
+    a.emitters = append(a.emitters, p)
+    a.mu.Unlock()
+    a.start(p, BusEffects, panned)
+    return p
+}
+
+// plays the sound at name from pos, logging rather than failing like PlayFile
+func (a *Audio) PlayFileAt(name string, pos pixel.Vec) *Playback {
+    s, err := a.Sound(name)
+    if err != nil {
+        audioLog.Warnf("%v", err)
+        return nil
+    }
+    return a.PlayAt(s, pos)
+}
+
+// moves a sound started with PlayAt, e.g. to follow the entity making it
+func (p *Playback) SetPosition(pos pixel.Vec) {
+    p.pos = pos
+}
+
+func (p *Playback) Position() pixel.Vec {
+    return p.pos
+}
+
+// pans and attenuates p from where it is; call with the lock held
+func (a *Audio) place(p *Playback) {
+    if !a.volume.Spatial || a.reach.X <= 0 || a.reach.Y <= 0 {
+        p.panned.pan, p.panned.gain = 0, 1
+        return
+    }
+    offset := p.pos.Sub(a.listener).Rotated(-a.rotation)
+    p.panned.pan = math.Max(-1, math.Min(1, offset.X/a.reach.X*AUDIOEDGEPAN))
+    view := pixel.Rect{Min: pixel.ZV.Sub(a.reach), Max: a.reach}
+    past := rectDistance(view, offset) / (math.Max(a.reach.X, a.reach.Y) * AUDIOFALLOFF)
+    p.panned.gain = math.Max(0, 1-past)
+}
+
+// re-places every sound playing at a position and forgets the finished ones
+func (a *Audio) placeEmitters() {
+    kept := a.emitters[:0]
+    for _, p := range a.emitters {
+        if p.done {
+            continue
+        }
+        a.place(p)
+        kept = append(kept, p)
+    }
+    for i := len(kept); i < len(a.emitters); i++ {
+        a.emitters[i] = nil
+    }
+    a.emitters = kept
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+    "image/color"
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/go-gl/mathgl/mgl32"
+)
+
+// a fullscreen fragment shader pass. besides Pixel's own inputs, every shader gets
+// uTime (seconds the pipeline has been updated for), uResolution (canvas size in pixels) and
+// uExtra (where Extra sits in the texture), plus whatever parameters it was created with.
+type PostEffect struct {
+    Name    string
+    Shader  string
+    Enabled bool
+    // a second image for the shader, like a color LUT. Pixel only binds one texture, so it's
+    // copied into the same canvas below the scene and the shader samples it through uExtra.
+    Extra pixel.Picture
+
+    params     map[string]*float32
+    uniforms   map[string]interface{}
+    time       float32
+    resolution mgl32.Vec2
+    extra      mgl32.Vec4
+    canvas     RenderCanvas
+    stage      RenderCanvas
+}
+
+// params are the effect's tunable float uniforms and their starting values
+func NewPostEffect(name, shader string, params map[string]float32) *PostEffect {
+    e := &PostEffect{
+        Name:     name,
+        Shader:   shader,
+        Enabled:  true,
+        params:   make(map[string]*float32),
+        uniforms: make(map[string]interface{}),
+    }
+    for k, v := range params {
+        v := v
+        e.params[k] = &v
+    }
+    return e
+}
+
+// registers a non-float uniform, a pointer to an mgl32 vector or matrix or an int32, which the
+// caller can keep changing. like params, it has to be added before the effect first draws.
+func (e *PostEffect) Uniform(name string, value interface{}) {
+    e.uniforms[name] = value
+}
+
+// changes a parameter; only the ones the effect was created with exist in the shader
+func (e *PostEffect) Set(name string, v float32) {
+    if p, ok := e.params[name]; ok {
+        *p = v
+    }
+}
+
+// sets a vec4 uniform registered with Uniform from a color, e.g. a tint
+func (e *PostEffect) SetColor(name string, c color.Color) {
+    if v, ok := e.uniforms[name].(*mgl32.Vec4); ok {
+        rgba := pixel.ToRGBA(c)
+        *v = mgl32.Vec4{float32(rgba.R), float32(rgba.G), float32(rgba.B), float32(rgba.A)}
+    }
+}
+
+func (e *PostEffect) Get(name string) float32 {
+    if p, ok := e.params[name]; ok {
+        return *p
+    }
+    return 0
+}
+
+// uniforms have to be registered before the shader compiles, so the canvas is built with all of them
+func (e *PostEffect) build(bounds pixel.Rect) {
+    if e.canvas != nil {
+        e.canvas.SetBounds(bounds)
+        return
+    }
+    e.canvas = graphics.NewCanvas(bounds)
+    e.canvas.SetUniform("uTime", &e.time)
+    e.canvas.SetUniform("uResolution", &e.resolution)
+    e.canvas.SetUniform("uExtra", &e.extra)
+    for name, p := range e.params {
+        e.canvas.SetUniform(name, p)
+    }
+    for name, u := range e.uniforms {
+        e.canvas.SetUniform(name, u)
+    }
+    e.canvas.SetFragmentShader(e.Shader)
+}
+
+// the scene renders into a canvas, then runs through each enabled effect in order before reaching the window
+type PostProcessor struct {
+    Effects []*PostEffect
+    // runs after Effects, so it sees the finished picture, e.g. Accessibility's color filter
+    Filter *PostEffect
+
+    scene RenderCanvas
+    // seconds fed to the shaders as uTime
+    elapsed float64
+}
+
+func NewPostProcessor(bounds pixel.Rect) *PostProcessor {
+    return &PostProcessor{scene: graphics.NewCanvas(bounds)}
+}
+
+// advances uTime by dt seconds
+func (p *PostProcessor) Update(dt float64) {
+    p.elapsed += dt
+}
+
+// the canvas to draw the frame into instead of the window
+func (p *PostProcessor) Scene() RenderCanvas {
+    return p.scene
+}
+
+func (p *PostProcessor) Add(effects ...*PostEffect) {
+    p.Effects = append(p.Effects, effects...)
+}
+
+func (p *PostProcessor) Effect(name string) *PostEffect {
+    for _, e := range p.Effects {
+        if e.Name == name {
+            return e
+        }
+    }
+    return nil
+}
+
+// Effects then Filter
+func (p *PostProcessor) chain() []*PostEffect {
+    if p.Filter == nil {
+        return p.Effects
+    }
+    return append(p.Effects[:len(p.Effects):len(p.Effects)], p.Filter)
+}
+
+// resizes the scene and effect canvases, e.g. after the window changes size
+func (p *PostProcessor) SetBounds(bounds pixel.Rect) {
+    p.scene.SetBounds(bounds)
+    for _, e := range p.chain() {
+        if e.canvas != nil {
+            e.canvas.SetBounds(bounds)
+        }
+    }
+}
+
+// runs the chain and draws the result filling t's bounds
+func (p *PostProcessor) Draw(t RenderTarget, bounds pixel.Rect) {
+    src := p.scene
+    sceneBounds := src.Bounds()
+    elapsed := float32(p.elapsed)
+    for _, e := range p.chain() {
+        if !e.Enabled {
+            continue
+        }
+        e.build(sceneBounds)
+        e.time = elapsed
+        e.resolution = mgl32.Vec2{float32(sceneBounds.W()), float32(sceneBounds.H())}
+        e.canvas.Clear(color.Transparent)
+        if e.Extra != nil {
+            e.drawStaged(src, sceneBounds)
+        } else {
+            src.Draw(e.canvas, pixel.IM.Moved(sceneBounds.Center()))
+        }
+        src = e.canvas
+    }
+
+    scale := pixel.V(bounds.W()/sceneBounds.W(), bounds.H()/sceneBounds.H())
+    t.SetMatrix(pixel.IM)
+    src.Draw(t, pixel.IM.ScaledXY(pixel.ZV, scale).Moved(bounds.Center()))
+}
+
+// copies src and Extra into one canvas, Extra along the bottom, then draws just the scene part through the shader
+func (e *PostEffect) drawStaged(src RenderCanvas, sceneBounds pixel.Rect) {
+    extra := e.Extra.Bounds()
+    size := pixel.V(math.Max(sceneBounds.W(), extra.W()), sceneBounds.H()+extra.H())
+    if e.stage == nil {
+        e.stage = graphics.NewCanvas(pixel.R(0, 0, size.X, size.Y))
+        // the scene is copied 1:1 so it stays sharp, and LUTs get filtered lookups
+        e.stage.SetSmooth(true)
+    }
+    e.stage.SetBounds(pixel.R(0, 0, size.X, size.Y))
+    e.stage.Clear(color.Transparent)
+
+    scene := pixel.R(0, extra.H(), sceneBounds.W(), extra.H()+sceneBounds.H())
+    src.Draw(e.stage, pixel.IM.Moved(scene.Center()))
+    pixel.NewSprite(e.Extra, extra).Draw(e.stage, pixel.IM.Moved(extra.Center().Sub(extra.Min)))
+    e.extra = mgl32.Vec4{0, 0, float32(extra.W()), float32(extra.H())}
+
+    pixel.NewSprite(e.stage, scene).Draw(e.canvas, pixel.IM.Moved(sceneBounds.Center()))
+}
+
+// shared header; t is the fragment's position in 0-1 texture space
+const postShaderHeader = `
+#version 330 core
+
+in vec4  vColor;
+in vec2  vTexCoords;
+in float vIntensity;
+
+out vec4 fragColor;
+
+uniform vec4 uColorMask;
+uniform vec4 uTexBounds;
+uniform sampler2D uTexture;
+uniform float uTime;
+uniform vec2 uResolution;
+uniform vec4 uExtra;
+`
+
+const SHADERVIGNETTE = postShaderHeader + `
+uniform float uStrength;
+
+void main() {
+    vec2 t = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
+    vec4 c = texture(uTexture, t);
+    float d = distance(t, vec2(0.5));
+    c.rgb *= 1.0 - smoothstep(0.3, 0.8, d) * uStrength;
+    fragColor = c;
+}
+`
+
+const SHADERCRT = postShaderHeader + `
+uniform float uCurvature;
+uniform float uScanlines;
+
+void main() {
+    vec2 t = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
+    // barrel distortion
+    vec2 cc = t - 0.5;
+    t = t + cc * dot(cc, cc) * uCurvature;
+    if (t.x < 0.0 || t.x > 1.0 || t.y < 0.0 || t.y > 1.0) {
+        fragColor = vec4(0.0, 0.0, 0.0, 1.0);
+        return;
+    }
+    vec4 c = texture(uTexture, t);
+    float line = 0.5 + 0.5 * sin(t.y * uResolution.y * 3.14159);
+    c.rgb *= 1.0 - uScanlines * (1.0 - line);
+    // faint RGB mask columns
+    float col = mod(gl_FragCoord.x, 3.0);
+    c.rgb *= vec3(col < 1.0 ? 1.0 : 0.85, col >= 1.0 && col < 2.0 ? 1.0 : 0.85, col >= 2.0 ? 1.0 : 0.85);
+    fragColor = c;
+}
+`
+
+const SHADERCHROMATIC = postShaderHeader + `
+uniform float uOffset;
+
+void main() {
+    vec2 t = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
+    // pushes red and blue apart, more towards the edges
+    vec2 dir = (t - 0.5) * uOffset / uResolution;
+    float r = texture(uTexture, t + dir).r;
+    vec4 g = texture(uTexture, t);
+    float b = texture(uTexture, t - dir).b;
+    fragColor = vec4(r, g.g, b, g.a);
+}
+`
+
+const SHADERBLOOM = postShaderHeader + `
+uniform float uThreshold;
+uniform float uIntensity;
+uniform float uRadius;
+
+void main() {
+    vec2 t = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
+    vec4 c = texture(uTexture, t);
+    vec2 texel = uRadius / uResolution;
+    vec3 glow = vec3(0.0);
+    float total = 0.0;
+    for (int x = -4; x <= 4; x++) {
+        for (int y = -4; y <= 4; y++) {
+            float w = 1.0 / (1.0 + float(x*x + y*y));
+            vec3 s = texture(uTexture, t + vec2(x, y) * texel).rgb;
+            float bright = max(max(s.r, s.g), s.b);
+            glow += s * step(uThreshold, bright) * w;
+            total += w;
+        }
+    }
+    fragColor = vec4(c.rgb + glow / total * uIntensity, c.a);
+}
+`
+
+// darkens the corners, strength 0-1
+func VignetteEffect(strength float32) *PostEffect {
+    return NewPostEffect("vignette", SHADERVIGNETTE, map[string]float32{"uStrength": strength})
+}
+
+func CRTEffect(curvature, scanlines float32) *PostEffect {
+    return NewPostEffect("crt", SHADERCRT, map[string]float32{"uCurvature": curvature, "uScanlines": scanlines})
+}
+
+// offset is in pixels at the screen edge
+func ChromaticAberrationEffect(offset float32) *PostEffect {
+    return NewPostEffect("chromatic", SHADERCHROMATIC, map[string]float32{"uOffset": offset})
+}
+
+// a single pass glow around anything brighter than threshold (0-1)
+func BloomEffect(threshold, intensity float32) *PostEffect {
+    return NewPostEffect("bloom", SHADERBLOOM, map[string]float32{
+        "uThreshold": threshold,
+        "uIntensity": intensity,
+        "uRadius":    1.5,
+    })
+}
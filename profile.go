@@ -0,0 +1,233 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    // registers the /debug/pprof handlers StartServer serves
+    _ "net/http/pprof"
+    "os"
+    "runtime"
+    "runtime/pprof"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+var profileLog = logging.Module("profile")
+
+// where --profile serves pprof, e.g. go tool pprof http://localhost:6060/debug/pprof/profile
+const PROFILEADDR = "localhost:6060"
+
+// how quickly a system's average follows its frame times; smaller is steadier
+const PROFILESMOOTHING = 0.05
+
+// how long a console cpuprofile runs when it isn't told
+const PROFILECPUSECONDS = 10
+
+// one part of the frame, e.g. "update" or "render"
+type SystemTiming struct {
+    Name string
+    // the last full frame, a smoothed average, and the worst since Reset
+    Last, Average, Peak time.Duration
+
+    current time.Duration
+}
+
+// times the frame's systems while Enabled, for the debug overlay and the timings command. off,
+// Time costs a branch, so the calls can stay in the loop.
+type Profiler struct {
+    Enabled bool
+
+    systems map[string]*SystemTiming
+
+    cpuMu   sync.Mutex
+    cpuFile *os.File
+}
+
+func NewProfiler() *Profiler {
+    return &Profiler{systems: make(map[string]*SystemTiming)}
+}
+
+func noop() {}
+
+// starts timing name and returns the function that stops it, e.g. defer profiler.Time("ui")().
+// a system timed more than once a frame, like a fixed step, gets the total.
+func (p *Profiler) Time(name string) func() {
+    if !p.Enabled {
+        return noop
+    }
+    start := time.Now()
+    return func() {
+        s, ok := p.systems[name]
+        if !ok {
+            s = &SystemTiming{Name: name}
+            p.systems[name] = s
+        }
+        s.current += time.Since(start)
+    }
+}
+
+// closes the frame's timings; call it once per frame after the last system
+func (p *Profiler) EndFrame() {
+    if !p.Enabled {
+        return
+    }
+    for _, s := range p.systems {
+        s.Last = s.current
+        s.current = 0
+        if s.Average == 0 {
+            s.Average = s.Last
+        } else {
+            s.Average += time.Duration(float64(s.Last-s.Average) * PROFILESMOOTHING)
+        }
+        if s.Last > s.Peak {
+            s.Peak = s.Last
+        }
+    }
+}
+
+func (p *Profiler) Reset() {
+    p.systems = make(map[string]*SystemTiming)
+}
+
+// every timed system, slowest on average first
+func (p *Profiler) Timings() []SystemTiming {
+    timings := make([]SystemTiming, 0, len(p.systems))
+    for _, s := range p.systems {
+        timings = append(timings, *s)
+    }
+    sort.Slice(timings, func(i, j int) bool {
+        if timings[i].Average != timings[j].Average {
+            return timings[i].Average > timings[j].Average
+        }
+        return timings[i].Name < timings[j].Name
+    })
+    return timings
+}
+
+func milliseconds(d time.Duration) float64 {
+    return float64(d) / float64(time.Millisecond)
+}
+
+// e.g. "render 3.10  update 1.25  present 0.40", average milliseconds
+func (p *Profiler) Summary() string {
+    var parts []string
+    for _, s := range p.Timings() {
+        parts = append(parts, fmt.Sprintf("%s %.2f", s.Name, milliseconds(s.Average)))
+    }
+    return strings.Join(parts, "  ")
+}
+
+// serves net/http/pprof on addr in the background. keep addr on localhost, the endpoints give
+// away a lot about the process.
+func (p *Profiler) StartServer(addr string) {
+    go func() {
+        profileLog.Infof("pprof on http://%s/debug/pprof/", addr)
+        if err := http.ListenAndServe(addr, nil); err != nil {
+            profileLog.Errorf("pprof: %v", err)
+        }
+    }()
+}
+
+// writes a heap profile to path, after a GC so it shows what's live
+func (p *Profiler) WriteHeapProfile(path string) error {
+    file, err := os.Create(path)
+    if err != nil {
+        return fmt.Errorf("heap profile: %v", err)
+    }
+    defer file.Close()
+    runtime.GC()
+    if err := pprof.WriteHeapProfile(file); err != nil {
+        return fmt.Errorf("heap profile %s: %v", path, err)
+    }
+    return nil
+}
+
+// records a CPU profile into path until StopCPUProfile, or for duration when it's above zero
+func (p *Profiler) StartCPUProfile(path string, duration time.Duration) error {
+    p.cpuMu.Lock()
+    defer p.cpuMu.Unlock()
+    if p.cpuFile != nil {
+        return fmt.Errorf("cpu profile: already recording %s", p.cpuFile.Name())
+    }
+    file, err := os.Create(path)
+    if err != nil {
+        return fmt.Errorf("cpu profile: %v", err)
+    }
+    if err := pprof.StartCPUProfile(file); err != nil {
+        file.Close()
+        return fmt.Errorf("cpu profile %s: %v", path, err)
+    }
+    p.cpuFile = file
+    if duration > 0 {
+        time.AfterFunc(duration, func() {
+            if err := p.StopCPUProfile(); err != nil {
+                profileLog.Errorf("%v", err)
+            }
+        })
+    }
+    return nil
+}
+
+func (p *Profiler) StopCPUProfile() error {
+    p.cpuMu.Lock()
+    defer p.cpuMu.Unlock()
+    if p.cpuFile == nil {
+        return nil
+    }
+    pprof.StopCPUProfile()
+    name := p.cpuFile.Name()
+    err := p.cpuFile.Close()
+    p.cpuFile = nil
+    if err != nil {
+        return fmt.Errorf("cpu profile %s: %v", name, err)
+    }
+    profileLog.Infof("wrote %s", name)
+    return nil
+}
+
+// timestamped like screenshots, e.g. cpu_2024-01-02_15-04-05.pprof
+func profilePath(kind string) string {
+    return kind + "_" + time.Now().Format("2006-01-02_15-04-05") + ".pprof"
+}
+
+// the timings, heapprofile and cpuprofile console commands
+func registerProfileCommands(c *Console, p *Profiler) {
+    c.Register("timings", "prints how long each system took, in milliseconds", func(args ConsoleArgs) error {
+        if !p.Enabled {
+            return fmt.Errorf("profiling is off, start with --profile")
+        }
+        c.Printf("%-12s %8s %8s %8s", "system", "last", "average", "peak")
+        for _, s := range p.Timings() {
+            c.Printf("%-12s %8.2f %8.2f %8.2f", s.Name, milliseconds(s.Last), milliseconds(s.Average), milliseconds(s.Peak))
+        }
+        return nil
+    })
+    c.Register("heapprofile", "writes a heap profile for go tool pprof", func(args ConsoleArgs) error {
+        path := profilePath("heap")
+        if args.Has(0) {
+            path = args.String(0)
+        }
+        if err := p.WriteHeapProfile(path); err != nil {
+            return err
+        }
+        c.Printf("wrote %s", path)
+        return nil
+    }, StringArg("path").Opt())
+    c.Register("cpuprofile", "records a CPU profile for go tool pprof over some seconds", func(args ConsoleArgs) error {
+        seconds := float64(PROFILECPUSECONDS)
+        if args.Has(0) {
+            seconds = args.Float(0)
+        }
+        if seconds <= 0 {
+            return fmt.Errorf("seconds must be above zero")
+        }
+        path := profilePath("cpu")
+        if err := p.StartCPUProfile(path, time.Duration(seconds*float64(time.Second))); err != nil {
+            return err
+        }
+        c.Printf("recording %s for %gs", path, seconds)
+        return nil
+    }, FloatArg("seconds").Opt())
+}
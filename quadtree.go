@@ -0,0 +1,173 @@
+package main
+
+import "github.com/faiface/pixel"
+
+// how many items a quadtree node holds before it splits, and how deep it goes at most
+const (
+    QUADCAPACITY = 8
+    QUADDEPTH    = 8
+)
+
+type quadItem struct {
+    value  interface{}
+    bounds pixel.Rect
+}
+
+type quadNode struct {
+    bounds   pixel.Rect
+    depth    int
+    items    []quadItem
+    children *[4]quadNode
+}
+
+// rectangles in a fixed area, split into quarters where they crowd, so asking what's inside a
+// view skips whole empty quarters; the renderer culls tile chunks and placed drawables with it.
+// unlike SpatialHash it suits things of very different sizes. values are compared with ==, so
+// use pointers.
+type Quadtree struct {
+    root quadNode
+    // anything reaching outside the root's bounds, checked on every query
+    outside []quadItem
+    where   map[interface{}]pixel.Rect
+}
+
+func NewQuadtree(bounds pixel.Rect) *Quadtree {
+    return &Quadtree{root: quadNode{bounds: bounds.Norm()}, where: make(map[interface{}]pixel.Rect)}
+}
+
+func (q *Quadtree) Len() int {
+    return len(q.where)
+}
+
+// adds value with bounds r, or moves it there
+func (q *Quadtree) Insert(value interface{}, r pixel.Rect) {
+    if _, ok := q.where[value]; ok {
+        q.Remove(value)
+    }
+    r = r.Norm()
+    q.where[value] = r
+    item := quadItem{value, r}
+    if !containsRect(q.root.bounds, r) {
+        q.outside = append(q.outside, item)
+        return
+    }
+    q.root.insert(item)
+}
+
+func (q *Quadtree) Remove(value interface{}) {
+    r, ok := q.where[value]
+    if !ok {
+        return
+    }
+    delete(q.where, value)
+    if !containsRect(q.root.bounds, r) {
+        q.outside = removeQuadItem(q.outside, value)
+        return
+    }
+    q.root.remove(value, r)
+}
+
+func (q *Quadtree) Clear() {
+    q.root = quadNode{bounds: q.root.bounds}
+    q.outside = nil
+    q.where = make(map[interface{}]pixel.Rect)
+}
+
+// calls fn for every value whose bounds overlap r, edges included
+func (q *Quadtree) Each(r pixel.Rect, fn func(value interface{})) {
+    r = r.Norm()
+    for _, item := range q.outside {
+        if item.bounds.Intersects(r) {
+            fn(item.value)
+        }
+    }
+    q.root.each(r, fn)
+}
+
+// the values whose bounds overlap r
+func (q *Quadtree) Query(r pixel.Rect) []interface{} {
+    var found []interface{}
+    q.Each(r, func(v interface{}) { found = append(found, v) })
+    return found
+}
+
+func (n *quadNode) insert(item quadItem) {
+    if n.children != nil {
+        if child := n.childFor(item.bounds); child != nil {
+            child.insert(item)
+            return
+        }
+        n.items = append(n.items, item)
+        return
+    }
+    n.items = append(n.items, item)
+    if len(n.items) > QUADCAPACITY && n.depth < QUADDEPTH {
+        n.split()
+    }
+}
+
+func (n *quadNode) split() {
+    c := n.bounds.Center()
+    b := n.bounds
+    n.children = &[4]quadNode{
+        {bounds: pixel.R(b.Min.X, b.Min.Y, c.X, c.Y), depth: n.depth + 1},
+        {bounds: pixel.R(c.X, b.Min.Y, b.Max.X, c.Y), depth: n.depth + 1},
+        {bounds: pixel.R(b.Min.X, c.Y, c.X, b.Max.Y), depth: n.depth + 1},
+        {bounds: pixel.R(c.X, c.Y, b.Max.X, b.Max.Y), depth: n.depth + 1},
+    }
+    items := n.items
+    n.items = nil
+    for _, item := range items {
+        n.insert(item)
+    }
+}
+
+// the quarter that wholly holds r, or nil when it straddles them
+func (n *quadNode) childFor(r pixel.Rect) *quadNode {
+    for i := range n.children {
+        if containsRect(n.children[i].bounds, r) {
+            return &n.children[i]
+        }
+    }
+    return nil
+}
+
+func (n *quadNode) remove(value interface{}, r pixel.Rect) {
+    if n.children != nil {
+        if child := n.childFor(r); child != nil {
+            child.remove(value, r)
+            return
+        }
+    }
+    n.items = removeQuadItem(n.items, value)
+}
+
+func (n *quadNode) each(r pixel.Rect, fn func(value interface{})) {
+    if !n.bounds.Intersects(r) {
+        return
+    }
+    for _, item := range n.items {
+        if item.bounds.Intersects(r) {
+            fn(item.value)
+        }
+    }
+    if n.children != nil {
+        for i := range n.children {
+            n.children[i].each(r, fn)
+        }
+    }
+}
+
+func removeQuadItem(items []quadItem, value interface{}) []quadItem {
+    for i, item := range items {
+        if item.value == value {
+            return append(items[:i], items[i+1:]...)
+        }
+    }
+    return items
+}
+
+// whether r lies wholly within outer
+func containsRect(outer, r pixel.Rect) bool {
+    return r.Min.X >= outer.Min.X && r.Min.Y >= outer.Min.Y && r.Max.X <= outer.Max.X && r.Max.Y <= outer.Max.Y
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+    "math"
+    "sort"
+
+    "github.com/faiface/pixel"
+)
+
+// where a ray stopped. Normal faces back along the ray, out of what it hit, or is zero when the
+// ray started inside it.
+type RayHit struct {
+    Point, Normal pixel.Vec
+    Distance      float64
+    // what it hit: a collider's entity, or when Tiles is set, a tile of that layer at column
+    // TileX, row TileY from the top, with Entity meaningless
+    Entity       Entity
+    Tiles        *TileLayer
+    TileX, TileY int
+}
+
+// makes rays stop at l's tiles, e.g. a map's walls layer. any tile counts, and only orthogonal
+// maps are supported.
+func (c *Collisions) AddSolidTiles(l *TileLayer) {
+    c.Solids = append(c.Solids, l)
+}
+
+func (c *Collisions) RemoveSolidTiles(l *TileLayer) {
+    for i, solid := range c.Solids {
+        if solid == l {
+            c.Solids = append(c.Solids[:i:i], c.Solids[i+1:]...)
+            return
+        }
+    }
+}
+
+func (c *Collisions) solidLayer() uint32 {
+    if c.SolidLayer == 0 {
+        return 1
+    }
+    return c.SolidLayer
+}
+
+// the first thing on one of mask's layers the segment from from to to hits, colliders and solid
+// tiles alike, for line of sight, lasers and hitscan
+func (c *Collisions) Raycast(from, to pixel.Vec, mask uint32) (RayHit, bool) {
+    hits := c.raycast(from, to, mask, true)
+    if len(hits) == 0 {
+        return RayHit{}, false
+    }
+    return hits[0], true
+}
+
+// everything on one of mask's layers the segment passes through, nearest first; a tile layer
+// only reports the first tile it hits, since the ray is in the wall from there
+func (c *Collisions) RaycastAll(from, to pixel.Vec, mask uint32) []RayHit {
+    return c.raycast(from, to, mask, false)
+}
+
+// whether nothing on mask's layers stands between from and to
+func (c *Collisions) LineOfSight(from, to pixel.Vec, mask uint32) bool {
+    _, hit := c.Raycast(from, to, mask)
+    return !hit
+}
+
+func (c *Collisions) raycast(from, to pixel.Vec, mask uint32, first bool) []RayHit {
+    var hits []RayHit
+    length := to.Sub(from).Len()
+    if c.World != nil {
+        c.refresh()
+        candidates := c.Index.Query(pixel.Rect{Min: from, Max: to}.Norm())
+        for _, e := range c.filter(candidates, mask, func(WorldShape) bool { return true }) {
+            shape, _ := c.Shape(e)
+            if t, normal, ok := shape.segment(from, to); ok {
+                hits = append(hits, RayHit{Point: from.Add(to.Sub(from).Scaled(t)), Normal: normal, Distance: t * length, Entity: e})
+            }
+        }
+    }
+    if mask&c.solidLayer() != 0 {
+        for _, l := range c.Solids {
+            if hit, ok := raycastTiles(l, from, to); ok {
+                hits = append(hits, hit)
+            }
+        }
+    }
+    sort.SliceStable(hits, func(i, j int) bool { return hits[i].Distance < hits[j].Distance })
+    if first && len(hits) > 1 {
+        hits = hits[:1]
+    }
+    return hits
+}
+
+// where along the segment, 0 to 1, it enters r, and the face's normal; the slab method
+func segmentRect(from, to pixel.Vec, r pixel.Rect) (float64, pixel.Vec, bool) {
+    if r.Contains(from) {
+        return 0, pixel.ZV, true
+    }
+    d := to.Sub(from)
+    enter, exit := 0.0, 1.0
+    var normal pixel.Vec
+    axes := []struct {
+        start, dir, lo, hi float64
+        normal             pixel.Vec
+    }{
+        {from.X, d.X, r.Min.X, r.Max.X, pixel.V(1, 0)},
+        {from.Y, d.Y, r.Min.Y, r.Max.Y, pixel.V(0, 1)},
+    }
+    for _, a := range axes {
+        if a.dir == 0 {
+            if a.start < a.lo || a.start > a.hi {
+                return 0, pixel.ZV, false
+            }
+            continue
+        }
+        t0, t1 := (a.lo-a.start)/a.dir, (a.hi-a.start)/a.dir
+        n := pixel.ZV.Sub(a.normal)
+        if t0 > t1 {
+            t0, t1 = t1, t0
+            n = a.normal
+        }
+        if t0 > enter {
+            enter, normal = t0, n
+        }
+        if t1 < exit {
+            exit = t1
+        }
+        if enter > exit {
+            return 0, pixel.ZV, false
+        }
+    }
+    return enter, normal, true
+}
+
+// walks the cells under the segment in order until one has a tile
+func raycastTiles(l *TileLayer, from, to pixel.Vec) (RayHit, bool) {
+    m := l.tileMap
+    if m == nil || m.TileWidth == 0 || m.TileHeight == 0 || (m.Orientation != "" && m.Orientation != TILEORTHOGONAL) {
+        return RayHit{}, false
+    }
+    tw, th := float64(m.TileWidth), float64(m.TileHeight)
+    top := m.pixelSize().Y + l.Offset.Y
+    // grid space: cells are 1 wide, Y down from the top row
+    gx, gy := (from.X-l.Offset.X)/tw, (top-from.Y)/th
+    dx, dy := (to.X-from.X)/tw, -(to.Y-from.Y)/th
+    x, y := int(math.Floor(gx)), int(math.Floor(gy))
+
+    step := func(pos, dir float64, cell int) (int, float64, float64) {
+        switch {
+        case dir > 0:
+            return 1, (float64(cell+1) - pos) / dir, 1 / dir
+        case dir < 0:
+            return -1, (pos - float64(cell)) / -dir, -1 / dir
+        }
+        return 0, math.Inf(1), math.Inf(1)
+    }
+    stepX, nextX, deltaX := step(gx, dx, x)
+    stepY, nextY, deltaY := step(gy, dy, y)
+
+    t := 0.0
+    var normal pixel.Vec
+    length := to.Sub(from).Len()
+    for cells := int(math.Abs(dx)) + int(math.Abs(dy)) + 2; cells >= 0 && t <= 1; cells-- {
+        if l.GID(x, y) != 0 {
+            return RayHit{
+                Point:    from.Add(to.Sub(from).Scaled(t)),
+                Normal:   normal,
+                Distance: t * length,
+                Tiles:    l,
+                TileX:    x,
+                TileY:    y,
+            }, true
+        }
+        if nextX < nextY {
+            t, x, nextX = nextX, x+stepX, nextX+deltaX
+            normal = pixel.V(-float64(stepX), 0)
+        } else {
+            t, y, nextY = nextY, y+stepY, nextY+deltaY
+            // a step down the rows is a step down the world
+            normal = pixel.V(0, float64(stepY))
+        }
+    }
+    return RayHit{}, false
+}
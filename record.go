@@ -0,0 +1,307 @@
+package main
+
+import (
+    "fmt"
+    "image"
+    "image/color"
+    "image/draw"
+    "image/gif"
+    "io"
+    "math"
+    "os"
+    "os/exec"
+    "sort"
+    "time"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+    "golang.org/x/image/colornames"
+)
+
+var recordLog = logging.Module("recording")
+
+type RecordFormat string
+
+const (
+    RecordGIF RecordFormat = "gif"
+    // needs ffmpeg on the PATH; frames are piped to it as they're captured
+    RecordMP4 RecordFormat = "mp4"
+)
+
+// grabs frames from a canvas at a fixed rate and writes them to SCREENSHOTDIR as a clip
+type Recorder struct {
+    // frames per second captured, independent of the game's frame rate
+    FPS float64
+    // divides the captured size, 2 halves it, to keep GIFs small
+    Downscale int
+    // recording stops by itself after this long
+    MaxDuration time.Duration
+    Format      RecordFormat
+    Key         pixelgl.Button
+
+    recording bool
+    accum     float64
+    captured  int
+    frames    chan *image.RGBA
+    done      chan struct{}
+    imd       *imdraw.IMDraw
+}
+
+func NewRecorder() *Recorder {
+    return &Recorder{
+        FPS:         20,
+        Downscale:   2,
+        MaxDuration: 10 * time.Second,
+        Format:      RecordGIF,
+        Key:         pixelgl.KeyF10,
+        imd:         imdraw.New(nil),
+    }
+}
+
+func (r *Recorder) Recording() bool {
+    return r.recording
+}
+
+func (r *Recorder) Start() error {
+    if r.recording {
+        return nil
+    }
+    if r.FPS <= 0 {
+        r.FPS = 20
+    }
+    ext := "." + string(r.Format)
+    path, err := screenshotPath(ext)
+    if err != nil {
+        return fmt.Errorf("recording: %v", err)
+    }
+
+    // a frame writer running off the main thread; full buffers drop frames rather than stall the game
+    r.frames = make(chan *image.RGBA, 16)
+    r.done = make(chan struct{})
+    switch r.Format {
+    case RecordMP4:
+        if _, err := exec.LookPath("ffmpeg"); err != nil {
+            return fmt.Errorf("recording: mp4 needs ffmpeg: %v", err)
+        }
+        go r.writeMP4(path, r.frames, r.done)
+    default:
+        go r.writeGIF(path, r.frames, r.done)
+    }
+    r.recording = true
+    r.accum = 0
+    r.captured = 0
+    return nil
+}
+
+// stops capturing; the clip finishes encoding in the background and is logged when saved
+func (r *Recorder) Stop() {
+    if !r.recording {
+        return
+    }
+    r.recording = false
+    close(r.frames)
+}
+
+// waits for the last clip to finish writing, e.g. before exiting
+func (r *Recorder) Wait() {
+    if r.done != nil {
+        <-r.done
+    }
+}
+
+func (r *Recorder) Toggle() error {
+    if r.recording {
+        r.Stop()
+        return nil
+    }
+    return r.Start()
+}
+
+// handles the record key and captures c when a frame is due. dt is in seconds.
+func (r *Recorder) Update(w *pixelgl.Window, c RenderCanvas, dt float64) {
+    if w.JustPressed(r.Key) {
+        if err := r.Toggle(); err != nil {
+            recordLog.Errorf("%v", err)
+        }
+    }
+    if !r.recording {
+        return
+    }
+
+    interval := 1 / r.FPS
+    r.accum += dt
+    if r.accum < interval {
+        return
+    }
+    // a long hitch shouldn't turn into a burst of identical frames
+    r.accum = math.Mod(r.accum, interval)
+
+    img := CaptureCanvas(c)
+    if r.Downscale > 1 {
+        img = downscaleNearest(img, r.Downscale)
+    }
+    select {
+    case r.frames <- img:
+    default:
+    }
+    r.captured++
+    if float64(r.captured) >= r.FPS*r.MaxDuration.Seconds() {
+        r.Stop()
+    }
+}
+
+// a red dot in the top-right corner while recording; draw it after Update so it stays out of the clip
+func (r *Recorder) DrawIndicator(t RenderTarget, bounds pixel.Rect) {
+    if !r.recording {
+        return
+    }
+    // blinks once a second
+    if time.Now().UnixNano()/int64(500*time.Millisecond)%2 == 1 {
+        return
+    }
+    t.SetMatrix(pixel.IM)
+    r.imd.Clear()
+    r.imd.Color = colornames.Red
+    r.imd.Push(pixel.V(bounds.Max.X-20, bounds.Max.Y-20))
+    r.imd.Circle(8, 0)
+    r.imd.Draw(t)
+}
+
+func downscaleNearest(img *image.RGBA, factor int) *image.RGBA {
+    b := img.Bounds()
+    out := image.NewRGBA(image.Rect(0, 0, b.Dx()/factor, b.Dy()/factor))
+    for y := 0; y < out.Rect.Dy(); y++ {
+        for x := 0; x < out.Rect.Dx(); x++ {
+            si := img.PixOffset(b.Min.X+x*factor, b.Min.Y+y*factor)
+            di := out.PixOffset(x, y)
+            copy(out.Pix[di:di+4], img.Pix[si:si+4])
+        }
+    }
+    return out
+}
+
+func (r *Recorder) writeGIF(path string, frames <-chan *image.RGBA, done chan<- struct{}) {
+    defer close(done)
+    var captured []*image.RGBA
+    for img := range frames {
+        captured = append(captured, img)
+    }
+    if len(captured) == 0 {
+        return
+    }
+
+    palette, exact := gifPalette(captured)
+    delay := int(math.Round(100 / r.FPS))
+    anim := &gif.GIF{}
+    for _, img := range captured {
+        paletted := image.NewPaletted(img.Bounds(), palette)
+        if exact {
+            draw.Draw(paletted, img.Bounds(), img, img.Bounds().Min, draw.Src)
+        } else {
+            draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, img.Bounds().Min)
+        }
+        anim.Image = append(anim.Image, paletted)
+        anim.Delay = append(anim.Delay, delay)
+    }
+
+    file, err := os.Create(path)
+    if err != nil {
+        recordLog.Errorf("%v", err)
+        return
+    }
+    defer file.Close()
+    if err := gif.EncodeAll(file, anim); err != nil {
+        recordLog.Errorf("%s: %v", path, err)
+        return
+    }
+    recordLog.Infof("saved %s", path)
+}
+
+// the clip's own colors when there are few enough, like most pixel art, otherwise the 256 most
+// common colors after dropping to 5 bits per channel
+func gifPalette(frames []*image.RGBA) (color.Palette, bool) {
+    count := func(mask uint8, limit int) map[color.RGBA]int {
+        counts := make(map[color.RGBA]int)
+        for _, img := range frames {
+            for i := 0; i < len(img.Pix); i += 4 {
+                counts[color.RGBA{img.Pix[i] &^ mask, img.Pix[i+1] &^ mask, img.Pix[i+2] &^ mask, 255}]++
+                if limit > 0 && len(counts) > limit {
+                    return nil
+                }
+            }
+        }
+        return counts
+    }
+    counts, exact := count(0, 256), true
+    if counts == nil {
+        counts, exact = count(7, 0), false
+    }
+
+    colors := make([]color.RGBA, 0, len(counts))
+    for c := range counts {
+        colors = append(colors, c)
+    }
+    sort.Slice(colors, func(i, j int) bool {
+        if counts[colors[i]] != counts[colors[j]] {
+            return counts[colors[i]] > counts[colors[j]]
+        }
+        a, b := colors[i], colors[j]
+        return uint32(a.R)<<16|uint32(a.G)<<8|uint32(a.B) < uint32(b.R)<<16|uint32(b.G)<<8|uint32(b.B)
+    })
+    if len(colors) > 256 {
+        colors = colors[:256]
+    }
+    palette := make(color.Palette, len(colors))
+    for i, c := range colors {
+        palette[i] = c
+    }
+    return palette, exact
+}
+
+func (r *Recorder) writeMP4(path string, frames <-chan *image.RGBA, done chan<- struct{}) {
+    defer close(done)
+    var cmd *exec.Cmd
+    var stdin io.WriteCloser
+    for img := range frames {
+        if cmd == nil {
+            // the size is only known once the first frame arrives
+            b := img.Bounds()
+            cmd = exec.Command("ffmpeg", "-loglevel", "error", "-y",
+                "-f", "rawvideo", "-pix_fmt", "rgba",
+                "-s", fmt.Sprintf("%dx%d", b.Dx(), b.Dy()),
+                "-r", fmt.Sprint(r.FPS),
+                "-i", "-",
+                // yuv420p needs even dimensions
+                "-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+                "-pix_fmt", "yuv420p", path)
+            cmd.Stderr = os.Stderr
+            var err error
+            stdin, err = cmd.StdinPipe()
+            if err == nil {
+                err = cmd.Start()
+            }
+            if err != nil {
+                recordLog.Errorf("ffmpeg: %v", err)
+                for range frames {
+                }
+                return
+            }
+        }
+        if _, err := stdin.Write(img.Pix); err != nil {
+            recordLog.Errorf("ffmpeg: %v", err)
+            break
+        }
+    }
+    if cmd == nil {
+        return
+    }
+    for range frames {
+    }
+    stdin.Close()
+    if err := cmd.Wait(); err != nil {
+        recordLog.Errorf("%s: ffmpeg: %v", path, err)
+        return
+    }
+    recordLog.Infof("saved %s", path)
+}
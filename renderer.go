@@ -0,0 +1,317 @@
+package main
+
+import (
+    "fmt"
+    "sort"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+)
+
+// the default layers, back to front
+const (
+    LAYERBACKGROUND = "background"
+    LAYERWORLD      = "world"
+    LAYERACTORS     = "actors"
+    LAYERPARTICLES  = "particles"
+    LAYERUI         = "ui"
+)
+
+type DrawFunc func(t pixel.Target)
+
+// anything with a view matrix, i.e. a window or canvas
+type RenderTarget interface {
+    pixel.Target
+    SetMatrix(m pixel.Matrix)
+}
+
+// the world area placed drawables are indexed over by default, see SetWorldBounds; anything
+// outside it still draws, just without the quadtree's help
+const RENDERWORLD = 8192
+
+type drawCall struct {
+    z  float64
+    fn DrawFunc
+    // culled when it's outside the layer's camera view; a zero rect is never culled
+    bounds pixel.Rect
+}
+
+// a drawable that stays on its layer from frame to frame until removed, indexed by its bounds so
+// only the ones the camera sees are drawn, e.g. props scattered over a big map
+type Placed struct {
+    Z  float64
+    Fn DrawFunc
+
+    bounds pixel.Rect
+    layer  *RenderLayer
+    // placement order, which breaks ties in z
+    seq int
+}
+
+// moves the drawable's bounds, e.g. when what it draws moves
+func (p *Placed) Move(bounds pixel.Rect) {
+    p.bounds = bounds
+    if p.layer != nil {
+        p.layer.placed.Insert(p, bounds)
+    }
+}
+
+func (p *Placed) Bounds() pixel.Rect {
+    return p.bounds
+}
+
+// takes the drawable off its layer
+func (p *Placed) Remove() {
+    if p.layer != nil {
+        p.layer.placed.Remove(p)
+        p.layer = nil
+    }
+}
+
+type RenderLayer struct {
+    Name string
+    // lower orders draw first
+    Order int
+    // world layers follow the camera, a nil camera draws in screen space
+    Camera  *Camera
+    Visible bool
+
+    imd     *imdraw.IMDraw
+    sprites *SpriteQueue
+    calls   []drawCall
+    placed  *Quadtree
+    seq     int
+}
+
+// keeps fn drawing at z on this layer every frame while bounds, in world coordinates for a
+// camera layer, is in view
+func (l *RenderLayer) Place(bounds pixel.Rect, z float64, fn DrawFunc) *Placed {
+    l.seq++
+    p := &Placed{Z: z, Fn: fn, layer: l, seq: l.seq}
+    p.Move(bounds)
+    return p
+}
+
+// the area the camera sees, or false for a screen space layer, which is never culled
+func (l *RenderLayer) View() (pixel.Rect, bool) {
+    if l.Camera == nil {
+        return pixel.Rect{}, false
+    }
+    return l.Camera.VisibleRect(), true
+}
+
+// a sprite queue for this layer, batched per picture and drawn after the submitted calls
+func (l *RenderLayer) Sprites() *SpriteQueue {
+    if l.sprites == nil {
+        l.sprites = NewSpriteQueue()
+    }
+    return l.sprites
+}
+
+// an imdraw for this layer, drawn last and cleared each frame
+func (l *RenderLayer) IMDraw() *imdraw.IMDraw {
+    if l.imd == nil {
+        l.imd = imdraw.New(nil)
+    }
+    return l.imd
+}
+
+// what the last Draw did, for the debug overlay
+type RenderStats struct {
+    Layers, Calls, Batches int
+    // things with bounds, tile chunks included, that were in view and drawn or outside and skipped
+    Drawn, Culled int
+}
+
+// collects draw calls from anywhere in the frame and replays them layer by layer
+type Renderer struct {
+    layers []*RenderLayer
+    stats  RenderStats
+    world  pixel.Rect
+    // counted since the last Draw, see CountCulling
+    drawn, culled int
+}
+
+func (r *Renderer) Stats() RenderStats {
+    return r.stats
+}
+
+// a renderer with the default layers, all but the UI following cam
+func NewRenderer(cam *Camera) *Renderer {
+    r := &Renderer{world: pixel.R(-RENDERWORLD, -RENDERWORLD, RENDERWORLD, RENDERWORLD)}
+    r.AddLayer(LAYERBACKGROUND, 0, cam)
+    r.AddLayer(LAYERWORLD, 100, cam)
+    r.AddLayer(LAYERACTORS, 200, cam)
+    r.AddLayer(LAYERPARTICLES, 300, cam)
+    r.AddLayer(LAYERUI, 400, nil)
+    return r
+}
+
+// adds a layer, or moves and re-cameras an existing one with the same name
+func (r *Renderer) AddLayer(name string, order int, cam *Camera) *RenderLayer {
+    l := r.Layer(name)
+    if l == nil {
+        l = &RenderLayer{Name: name, Visible: true, placed: NewQuadtree(r.world)}
+        r.layers = append(r.layers, l)
+    }
+    l.Order = order
+    l.Camera = cam
+    sort.SliceStable(r.layers, func(i, j int) bool { return r.layers[i].Order < r.layers[j].Order })
+    return l
+}
+
+func (r *Renderer) Layer(name string) *RenderLayer {
+    for _, l := range r.layers {
+        if l.Name == name {
+            return l
+        }
+    }
+    return nil
+}
+
+func (r *Renderer) Layers() []*RenderLayer {
+    return r.layers
+}
+
+// sets the area the layers' quadtrees cover, e.g. to the map's bounds when a level loads; what's
+// already placed is kept
+func (r *Renderer) SetWorldBounds(world pixel.Rect) {
+    r.world = world
+    for _, l := range r.layers {
+        old := l.placed
+        l.placed = NewQuadtree(world)
+        for v, bounds := range old.where {
+            l.placed.Insert(v, bounds)
+        }
+    }
+}
+
+// adds to this frame's drawn and culled counts, for code that culls on its own like tile layers
+func (r *Renderer) CountCulling(drawn, culled int) {
+    r.drawn += drawn
+    r.culled += culled
+}
+
+// queues fn on the named layer for this frame
+func (r *Renderer) Submit(layer string, fn DrawFunc) {
+    r.SubmitZ(layer, 0, fn)
+}
+
+// like Submit, but calls within a layer draw in ascending z, e.g. -y for top-down depth sorting.
+// calls with equal z keep their submission order.
+func (r *Renderer) SubmitZ(layer string, z float64, fn DrawFunc) {
+    l := r.mustLayer(layer)
+    l.calls = append(l.calls, drawCall{z: z, fn: fn})
+}
+
+// like SubmitZ, but skipped when bounds, in the layer's coordinates, is outside its camera's view
+func (r *Renderer) SubmitBounds(layer string, z float64, bounds pixel.Rect, fn DrawFunc) {
+    l := r.mustLayer(layer)
+    l.calls = append(l.calls, drawCall{z, fn, bounds})
+}
+
+// queues m's tile layers on the named layer at z, drawing only the chunks its camera sees
+func (r *Renderer) SubmitMap(layer string, z float64, m *TileMap) {
+    l := r.mustLayer(layer)
+    r.SubmitZ(layer, z, func(t pixel.Target) {
+        if view, ok := l.View(); ok {
+            m.DrawView(t, view)
+        } else {
+            m.Draw(t)
+        }
+    })
+}
+
+// shorthand for the named layer's Place
+func (r *Renderer) Place(layer string, bounds pixel.Rect, z float64, fn DrawFunc) *Placed {
+    return r.mustLayer(layer).Place(bounds, z, fn)
+}
+
+// shorthand for the named layer's sprite queue
+func (r *Renderer) Sprites(layer string) *SpriteQueue {
+    return r.mustLayer(layer).Sprites()
+}
+
+// shorthand for the named layer's imdraw
+func (r *Renderer) IMDraw(layer string) *imdraw.IMDraw {
+    return r.mustLayer(layer).IMDraw()
+}
+
+// a misspelt layer name would otherwise silently draw nothing
+func (r *Renderer) mustLayer(name string) *RenderLayer {
+    l := r.Layer(name)
+    if l == nil {
+        panic(fmt.Sprintf("renderer: unknown layer %q", name))
+    }
+    return l
+}
+
+// draws every visible layer onto t with its own matrix, then empties them for the next frame
+func (r *Renderer) Draw(t RenderTarget) {
+    r.stats = RenderStats{Drawn: r.drawn, Culled: r.culled}
+    for _, l := range r.layers {
+        if l.Visible {
+            r.stats.Layers++
+            if l.Camera != nil {
+                t.SetMatrix(l.Camera.Matrix())
+            } else {
+                t.SetMatrix(pixel.IM)
+            }
+            calls := r.cull(l)
+            r.stats.Calls += len(calls)
+            sort.SliceStable(calls, func(i, j int) bool { return calls[i].z < calls[j].z })
+            for _, call := range calls {
+                call.fn(t)
+            }
+            if l.sprites != nil {
+                r.stats.Batches += l.sprites.DrawCalls()
+                l.sprites.Draw(t)
+            }
+            if l.imd != nil {
+                l.imd.Draw(t)
+            }
+        }
+        l.calls = l.calls[:0]
+        if l.sprites != nil {
+            l.sprites.Clear()
+        }
+        if l.imd != nil {
+            l.imd.Clear()
+        }
+    }
+    t.SetMatrix(pixel.IM)
+    r.drawn, r.culled = 0, 0
+}
+
+// the layer's submitted calls in view, then its placed drawables in view, so at equal z the
+// submitted ones draw first. a screen space layer culls nothing.
+func (r *Renderer) cull(l *RenderLayer) []drawCall {
+    view, culls := l.View()
+    calls := l.calls[:0]
+    for _, call := range l.calls {
+        if call.bounds != (pixel.Rect{}) {
+            if culls && !call.bounds.Norm().Intersects(view) {
+                r.stats.Culled++
+                continue
+            }
+            r.stats.Drawn++
+        }
+        calls = append(calls, call)
+    }
+    var placed []*Placed
+    if culls {
+        l.placed.Each(view, func(v interface{}) { placed = append(placed, v.(*Placed)) })
+    } else {
+        for v := range l.placed.where {
+            placed = append(placed, v.(*Placed))
+        }
+    }
+    // the quadtree's order depends on how it split, so go by placement order instead
+    sort.Slice(placed, func(i, j int) bool { return placed[i].seq < placed[j].seq })
+    for _, p := range placed {
+        calls = append(calls, drawCall{p.Z, p.Fn, p.bounds})
+    }
+    r.stats.Drawn += len(placed)
+    r.stats.Culled += l.placed.Len() - len(placed)
+    return calls
+}
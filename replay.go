@@ -0,0 +1,332 @@
+package main
+
+import (
+    "bytes"
+    "compress/gzip"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "time"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+var replayLog = logging.Module("replay")
+
+// bumped when the replay layout changes; a replay only plays back on the version that wrote it
+const REPLAYVERSION = 1
+
+// seeds the game's random source, and every other stream of the RNG. replays seed it before
+// Game.Init, so anything drawn from it comes out the same again; a math/rand source of the
+// game's own would break that.
+func SeedRandom(seed int64) {
+    rng.Reseed(seed)
+}
+
+// one frame of input, stored as what changed since the frame before
+type ReplayFrame struct {
+    // real seconds, as the clock measured them
+    Delta  float64          `json:"dt"`
+    Down   []pixelgl.Button `json:"down,omitempty"`
+    Up     []pixelgl.Button `json:"up,omitempty"`
+    Repeat []pixelgl.Button `json:"repeat,omitempty"`
+    Mouse  *pixel.Vec       `json:"mouse,omitempty"`
+    Scroll *pixel.Vec       `json:"scroll,omitempty"`
+    Typed  string           `json:"typed,omitempty"`
+    Focus  *bool            `json:"focus,omitempty"`
+    Inside *bool            `json:"inside,omitempty"`
+    Window *pixel.Rect      `json:"window,omitempty"`
+    Pads   []ReplayPad      `json:"pads,omitempty"`
+    // console commands run this frame, replayed before it's simulated
+    Commands []string `json:"commands,omitempty"`
+}
+
+// what changed on one gamepad during a frame
+type ReplayPad struct {
+    Joystick pixelgl.Joystick        `json:"js"`
+    Present  *bool                   `json:"present,omitempty"`
+    Name     string                  `json:"name,omitempty"`
+    Down     []pixelgl.GamepadButton `json:"down,omitempty"`
+    Up       []pixelgl.GamepadButton `json:"up,omitempty"`
+    // axes that moved, by index
+    Axes map[pixelgl.GamepadAxis]float64 `json:"axes,omitempty"`
+}
+
+// everything needed to play a session again: the random seed and the input of every frame from
+// Game.Init on. the simulation runs in fixed ticks fed by the recorded frame times, so the same
+// frames make the same ticks with the same input.
+type Replay struct {
+    Version  int           `json:"version"`
+    Seed     int64         `json:"seed"`
+    Recorded time.Time     `json:"recorded"`
+    Frames   []ReplayFrame `json:"frames"`
+}
+
+// reads a replay written by Save
+func LoadReplay(path string) (*Replay, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    zr, err := gzip.NewReader(file)
+    if err != nil {
+        return nil, fmt.Errorf("replay %s: %v", path, err)
+    }
+    data, err := io.ReadAll(zr)
+    if err != nil {
+        return nil, fmt.Errorf("replay %s: %v", path, err)
+    }
+    var r Replay
+    if err := json.Unmarshal(data, &r); err != nil {
+        return nil, fmt.Errorf("replay %s: %v", path, err)
+    }
+    if r.Version != REPLAYVERSION {
+        return nil, fmt.Errorf("replay %s: version %d, this build plays %d", path, r.Version, REPLAYVERSION)
+    }
+    return &r, nil
+}
+
+// writes the replay as gzipped JSON
+func (r *Replay) Save(path string) error {
+    data, err := json.Marshal(r)
+    if err != nil {
+        return err
+    }
+    var buf bytes.Buffer
+    zw := gzip.NewWriter(&buf)
+    zw.Write(data)
+    if err := zw.Close(); err != nil {
+        return err
+    }
+    if err := writeAtomic(path, buf.Bytes()); err != nil {
+        return fmt.Errorf("replay: %v", err)
+    }
+    return nil
+}
+
+// real seconds the replay covers
+func (r *Replay) Duration() float64 {
+    total := 0.0
+    for _, f := range r.Frames {
+        total += f.Delta
+    }
+    return total
+}
+
+// builds a Replay from the input the simulation saw each frame
+type ReplayRecorder struct {
+    Replay *Replay
+
+    pressed  [pixelgl.KeyLast + 1]bool
+    mouse    pixel.Vec
+    focused  bool
+    inside   bool
+    window   pixel.Rect
+    pads     [pixelgl.JoystickLast + 1]fakePad
+    commands []string
+    started  bool
+}
+
+func NewReplayRecorder(seed int64) *ReplayRecorder {
+    return &ReplayRecorder{Replay: &Replay{Version: REPLAYVERSION, Seed: seed, Recorded: time.Now()}}
+}
+
+// notes a console command for the frame being recorded; hand it to Console.OnExec
+func (r *ReplayRecorder) Command(line string) {
+    r.commands = append(r.commands, line)
+}
+
+// records in as one frame dt real seconds long
+func (r *ReplayRecorder) Record(in Input, dt float64) {
+    f := ReplayFrame{Delta: dt, Typed: in.Typed(), Commands: r.commands}
+    r.commands = nil
+    for b := pixelgl.Button(0); b <= pixelgl.KeyLast; b++ {
+        if pressed := in.Pressed(b); pressed != r.pressed[b] {
+            if pressed {
+                f.Down = append(f.Down, b)
+            } else {
+                f.Up = append(f.Up, b)
+            }
+            r.pressed[b] = pressed
+        }
+        if in.Repeated(b) {
+            f.Repeat = append(f.Repeat, b)
+        }
+    }
+    if mouse := in.MousePosition(); !r.started || mouse != r.mouse {
+        r.mouse = mouse
+        f.Mouse = &mouse
+    }
+    if scroll := in.MouseScroll(); scroll != pixel.ZV {
+        f.Scroll = &scroll
+    }
+    if focused := in.Focused(); !r.started || focused != r.focused {
+        r.focused = focused
+        f.Focus = &focused
+    }
+    if inside := in.MouseInsideWindow(); !r.started || inside != r.inside {
+        r.inside = inside
+        f.Inside = &inside
+    }
+    if window := in.Bounds(); !r.started || window != r.window {
+        r.window = window
+        f.Window = &window
+    }
+    for js := pixelgl.Joystick1; js <= pixelgl.JoystickLast; js++ {
+        if pad, changed := r.recordPad(in, js); changed {
+            f.Pads = append(f.Pads, pad)
+        }
+    }
+    r.started = true
+    r.Replay.Frames = append(r.Replay.Frames, f)
+}
+
+func (r *ReplayRecorder) recordPad(in Input, js pixelgl.Joystick) (ReplayPad, bool) {
+    pad := ReplayPad{Joystick: js}
+    last := &r.pads[js]
+    present := in.JoystickPresent(js)
+    changed := false
+    if present != last.present {
+        last.present = present
+        pad.Present = &present
+        changed = true
+        // a pad starts out with nothing held, like FakeInput.ConnectPad
+        last.pressed = [pixelgl.ButtonLast + 1]bool{}
+        if present {
+            pad.Name = in.JoystickName(js)
+        }
+    }
+    if !present {
+        return pad, changed
+    }
+    for b := pixelgl.GamepadButton(0); b <= pixelgl.ButtonLast; b++ {
+        if pressed := in.JoystickPressed(js, b); pressed != last.pressed[b] {
+            if pressed {
+                pad.Down = append(pad.Down, b)
+            } else {
+                pad.Up = append(pad.Up, b)
+            }
+            last.pressed[b] = pressed
+            changed = true
+        }
+    }
+    for axis := pixelgl.GamepadAxis(0); axis <= pixelgl.AxisLast; axis++ {
+        if v := in.JoystickAxis(js, axis); v != last.axes[axis] || pad.Present != nil {
+            if pad.Axes == nil {
+                pad.Axes = make(map[pixelgl.GamepadAxis]float64)
+            }
+            pad.Axes[axis] = v
+            last.axes[axis] = v
+            changed = true
+        }
+    }
+    return pad, changed
+}
+
+// plays a Replay back through a FakeInput, one frame per Next
+type ReplayPlayer struct {
+    Input  *FakeInput
+    Replay *Replay
+
+    frame int
+}
+
+func NewReplayPlayer(r *Replay) *ReplayPlayer {
+    return &ReplayPlayer{Input: NewFakeInput(pixel.R(0, 0, SCREENX, SCREENY)), Replay: r}
+}
+
+func (p *ReplayPlayer) Done() bool {
+    return p.frame >= len(p.Replay.Frames)
+}
+
+// frames played so far
+func (p *ReplayPlayer) Frame() int {
+    return p.frame
+}
+
+// ends the previous frame and sets Input to the next one, returning it for its Delta and
+// Commands. false once the replay has run out.
+func (p *ReplayPlayer) Next() (ReplayFrame, bool) {
+    if p.Done() {
+        return ReplayFrame{}, false
+    }
+    f := p.Replay.Frames[p.frame]
+    p.frame++
+
+    in := p.Input
+    if p.frame > 1 {
+        in.Update()
+    }
+    in.Press(f.Down...)
+    in.Release(f.Up...)
+    for _, b := range f.Repeat {
+        in.Repeat(b)
+    }
+    if f.Mouse != nil {
+        in.MoveMouse(*f.Mouse)
+    }
+    if f.Scroll != nil {
+        in.Scroll(*f.Scroll)
+    }
+    in.Type(f.Typed)
+    if f.Focus != nil {
+        in.SetFocused(*f.Focus)
+    }
+    if f.Inside != nil {
+        in.SetMouseInside(*f.Inside)
+    }
+    if f.Window != nil {
+        in.Window = *f.Window
+    }
+    for _, pad := range f.Pads {
+        if pad.Present != nil {
+            if *pad.Present {
+                in.ConnectPad(pad.Joystick, pad.Name)
+            } else {
+                in.DisconnectPad(pad.Joystick)
+            }
+        }
+        in.PressPad(pad.Joystick, pad.Down...)
+        in.ReleasePad(pad.Joystick, pad.Up...)
+        for axis, v := range pad.Axes {
+            in.SetAxis(pad.Joystick, axis, v)
+        }
+    }
+    return f, true
+}
+
+// plays r through h from its current state, for gameplay regression checks: build h with
+// NewHeadless after SeedRandom(r.Seed), or use PlayHeadless. commands go through console.
+func (h *Headless) Play(r *Replay) {
+    player := NewReplayPlayer(r)
+    h.Input = player.Input
+    loop.Reset()
+    for {
+        f, ok := player.Next()
+        if !ok {
+            return
+        }
+        for _, line := range f.Commands {
+            if err := console.Exec(line); err != nil {
+                replayLog.Warnf("frame %d: %v", player.Frame(), err)
+            }
+        }
+        h.Delta = f.Delta
+        h.Step()
+    }
+}
+
+// seeds the game's random source like the recording did, initialises game headless and plays
+// the whole of r through it, leaving the game as the session left it
+func PlayHeadless(game Game, r *Replay) (*Headless, error) {
+    SeedRandom(r.Seed)
+    h, err := NewHeadless(game)
+    if err != nil {
+        return nil, err
+    }
+    h.Play(r)
+    return h, nil
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "reflect"
+    "sort"
+
+    "github.com/faiface/pixel"
+)
+
+// how often a ReplicationServer sends snapshots, per second
+const SNAPSHOTRATE = 20
+
+// how far behind the server a ReplicationClient draws other entities, in seconds: two snapshots'
+// worth, so there's nearly always one either side to interpolate between
+const INTERPOLATIONDELAY = 2.0 / SNAPSHOTRATE
+
+// how many snapshots a client keeps, which bounds how far back it can interpolate from
+const SNAPSHOTBUFFER = 32
+
+// the world as one client should see it, sent every snapshot interval
+type snapshotPacket struct {
+    Tick uint64  `json:"tick"`
+    Time float64 `json:"time"`
+    // the last input of this client's the server has run, and the entity it predicts
+    Ack      uint64           `json:"ack"`
+    Player   *Entity          `json:"player,omitempty"`
+    Entities []entitySnapshot `json:"entities"`
+}
+
+// one of a client's inputs, numbered so the server can say which it's run; Input is the game's
+// own registered packet
+type inputPacket struct {
+    Seq   uint64          `json:"seq"`
+    Input json.RawMessage `json:"input"`
+}
+
+func init() {
+    RegisterPacket("snapshot", snapshotPacket{})
+    RegisterPacket("input", inputPacket{})
+}
+
+// components that implement it move smoothly between snapshots on clients instead of jumping
+// from one to the next: set the receiver t of the way from from to to, both of its own type
+type Interpolator interface {
+    Interpolate(from, to interface{}, t float64)
+}
+
+func (tr *Transform) Interpolate(from, to interface{}, t float64) {
+    a, b := from.(*Transform), to.(*Transform)
+    tr.Position = pixel.Lerp(a.Position, b.Position, t)
+    // the short way round
+    turn := math.Remainder(b.Rotation-a.Rotation, 2*math.Pi)
+    tr.Rotation = a.Rotation + turn*t
+}
+
+// sends a World's entities to a Server's clients as snapshots, picking up the clients' inputs for
+// the game to run. only components passed to Replicate go out, and only to clients Relevant lets
+// them; they have to be registered with RegisterComponent, as snapshots name them that way.
+type ReplicationServer struct {
+    World  *World
+    Server *Server
+    // seconds between snapshots
+    Interval float64
+    // whether e goes to c, e.g. only what's near c's player; nil sends everything
+    Relevant func(c *NetConn, e Entity) bool
+
+    components map[ComponentType]string
+    players    map[int]Entity
+    acks       map[int]uint64
+    onInput    []func(c *NetConn, player Entity, input interface{})
+
+    tick        uint64
+    time, since float64
+}
+
+func NewReplicationServer(w *World, s *Server) *ReplicationServer {
+    r := &ReplicationServer{
+        World:      w,
+        Server:     s,
+        Interval:   1.0 / SNAPSHOTRATE,
+        components: map[ComponentType]string{},
+        players:    map[int]Entity{},
+        acks:       map[int]uint64{},
+    }
+    s.Handle(inputPacket{}, func(c *NetConn, p interface{}) {
+        in := p.(inputPacket)
+        input, err := decodePacket(in.Input)
+        if err != nil {
+            netLog.Warnf("%s: %v", c.Addr(), err)
+            return
+        }
+        player, ok := r.players[c.ID]
+        if !ok || !r.World.Alive(player) {
+            return
+        }
+        for _, fn := range r.onInput {
+            fn(c, player, input)
+        }
+        r.acks[c.ID] = in.Seq
+    })
+    s.OnDisconnect(func(c *NetConn, err error) {
+        if c != nil {
+            delete(r.players, c.ID)
+            delete(r.acks, c.ID)
+        }
+    })
+    return r
+}
+
+// makes components of each type replicate, e.g. r.Replicate((*Transform)(nil), (*Sprite)(nil))
+func (r *ReplicationServer) Replicate(ptrs ...interface{}) {
+    for _, ptr := range ptrs {
+        t := ComponentTypeOf(ptr)
+        name, ok := componentNames[t]
+        if !ok {
+            panic(fmt.Sprintf("net: component %T isn't registered", ptr))
+        }
+        r.components[t] = name
+    }
+}
+
+// makes e the entity c's client predicts and sends inputs for
+func (r *ReplicationServer) SetPlayer(c *NetConn, e Entity) {
+    r.players[c.ID] = e
+}
+
+func (r *ReplicationServer) Player(c *NetConn) (Entity, bool) {
+    e, ok := r.players[c.ID]
+    return e, ok
+}
+
+// runs fn with each input a client sends, on its player; applying it here should do exactly what
+// the client's Predict does, so the two agree
+func (r *ReplicationServer) OnInput(fn func(c *NetConn, player Entity, input interface{})) {
+    r.onInput = append(r.onInput, fn)
+}
+
+// sends a snapshot to every client once Interval has passed; call it from the game's Update
+func (r *ReplicationServer) Update(dt float64) {
+    r.time += dt
+    r.since += dt
+    if r.since < r.Interval {
+        return
+    }
+    r.since = math.Mod(r.since, r.Interval)
+    r.tick++
+    entities, err := r.snapshot()
+    if err != nil {
+        netLog.Errorf("snapshot: %v", err)
+        return
+    }
+    for _, c := range r.Server.Conns() {
+        snap := snapshotPacket{Tick: r.tick, Time: r.time, Ack: r.acks[c.ID]}
+        if player, ok := r.players[c.ID]; ok {
+            snap.Player = &player
+        }
+        for _, es := range entities {
+            if r.Relevant == nil || r.Relevant(c, es.ID) {
+                snap.Entities = append(snap.Entities, es)
+            }
+        }
+        c.Send(snap)
+    }
+}
+
+// every entity with a replicated component, and those components
+func (r *ReplicationServer) snapshot() ([]entitySnapshot, error) {
+    var entities []entitySnapshot
+    for _, e := range r.World.Query() {
+        es := entitySnapshot{ID: e}
+        for t, name := range r.components {
+            c := r.World.Get(e, t)
+            if c == nil {
+                continue
+            }
+            data, err := json.Marshal(c)
+            if err != nil {
+                return nil, fmt.Errorf("component %s of %v: %v", name, e, err)
+            }
+            es.Components = append(es.Components, componentSnapshot{name, data})
+        }
+        if len(es.Components) > 0 {
+            sort.Slice(es.Components, func(i, j int) bool { return es.Components[i].Type < es.Components[j].Type })
+            entities = append(entities, es)
+        }
+    }
+    return entities, nil
+}
+
+// a snapshot with its components decoded, keyed by the server's entities
+type clientSnapshot struct {
+    tick     uint64
+    time     float64
+    ack      uint64
+    player   *Entity
+    entities map[Entity]map[ComponentType]interface{}
+}
+
+type pendingInput struct {
+    seq   uint64
+    input interface{}
+}
+
+// mirrors a ReplicationServer's world into World from the snapshots Client receives. entities
+// are drawn Delay behind the server, interpolated between the snapshots either side of then; the
+// player's entity is instead predicted, running each input through Predict as it's sent and, when
+// a snapshot arrives, starting again from the server's state with the inputs it hasn't run yet.
+// the mirrored entities are the World's own, so its systems draw them like any others.
+type ReplicationClient struct {
+    World  *World
+    Client *Client
+    // seconds behind the server other entities are shown
+    Delay float64
+    // runs input on the player e, the same as the server's OnInput does; nil turns prediction off,
+    // so the player is interpolated like everything else
+    Predict func(w *World, e Entity, input interface{})
+
+    snapshots []*clientSnapshot
+    // the snapshot the World was last brought up to date with, and the newest one
+    applied, latest *clientSnapshot
+    // the server's entities and their mirrors
+    local   map[Entity]Entity
+    pending []pendingInput
+    seq     uint64
+    // local seconds, and how far ahead of them the server's clock is, smoothed
+    time, offset float64
+}
+
+func NewReplicationClient(w *World, c *Client) *ReplicationClient {
+    r := &ReplicationClient{
+        World:  w,
+        Client: c,
+        Delay:  INTERPOLATIONDELAY,
+        local:  map[Entity]Entity{},
+    }
+    c.Handle(snapshotPacket{}, func(conn *NetConn, p interface{}) {
+        snap := p.(snapshotPacket)
+        if err := r.receive(snap); err != nil {
+            netLog.Warnf("snapshot %d: %v", snap.Tick, err)
+        }
+    })
+    c.OnDisconnect(func(conn *NetConn, err error) {
+        r.Reset()
+    })
+    return r
+}
+
+// destroys the mirrored entities and forgets the snapshots, e.g. after leaving a server
+func (r *ReplicationClient) Reset() {
+    for _, e := range r.local {
+        r.World.Destroy(e)
+    }
+    r.local = map[Entity]Entity{}
+    r.snapshots, r.applied, r.latest, r.pending = nil, nil, nil, nil
+}
+
+func (r *ReplicationClient) receive(snap snapshotPacket) error {
+    if n := len(r.snapshots); n > 0 && snap.Tick <= r.snapshots[n-1].tick {
+        // out of date already
+        return nil
+    }
+    cs := &clientSnapshot{
+        tick:     snap.Tick,
+        time:     snap.Time,
+        ack:      snap.Ack,
+        player:   snap.Player,
+        entities: make(map[Entity]map[ComponentType]interface{}, len(snap.Entities)),
+    }
+    for _, es := range snap.Entities {
+        components := make(map[ComponentType]interface{}, len(es.Components))
+        for _, c := range es.Components {
+            t, ok := componentTypes[c.Type]
+            if !ok {
+                return fmt.Errorf("unknown component %q", c.Type)
+            }
+            v := reflect.New(t.Elem()).Interface()
+            if err := json.Unmarshal(c.Data, v); err != nil {
+                return fmt.Errorf("component %s of %v: %v", c.Type, es.ID, err)
+            }
+            components[t] = v
+        }
+        cs.entities[es.ID] = components
+    }
+
+    ahead := snap.Time - r.time
+    if len(r.snapshots) == 0 {
+        r.offset = ahead
+    } else {
+        r.offset += (ahead - r.offset) * 0.1
+    }
+    r.snapshots = append(r.snapshots, cs)
+    r.latest = cs
+    if len(r.snapshots) > SNAPSHOTBUFFER {
+        r.snapshots = r.snapshots[len(r.snapshots)-SNAPSHOTBUFFER:]
+    }
+    r.reconcile(cs)
+    return nil
+}
+
+// queues input to the server and, with prediction, runs it on the player straight away
+func (r *ReplicationClient) SendInput(input interface{}) error {
+    data, err := encodePacket(input)
+    if err != nil {
+        return err
+    }
+    r.seq++
+    if err := r.Client.Send(inputPacket{Seq: r.seq, Input: data}); err != nil {
+        return err
+    }
+    if r.predicting() {
+        r.pending = append(r.pending, pendingInput{r.seq, input})
+        if e, ok := r.Player(); ok {
+            r.Predict(r.World, e, input)
+        }
+    }
+    return nil
+}
+
+func (r *ReplicationClient) predicting() bool {
+    return r.Predict != nil && r.latest != nil && r.latest.player != nil
+}
+
+// the mirror of the entity this client predicts
+func (r *ReplicationClient) Player() (Entity, bool) {
+    if r.latest == nil || r.latest.player == nil {
+        return 0, false
+    }
+    e, ok := r.local[*r.latest.player]
+    return e, ok
+}
+
+// the mirror of the server's entity e
+func (r *ReplicationClient) Local(e Entity) (Entity, bool) {
+    l, ok := r.local[e]
+    return l, ok
+}
+
+// the server's tick being shown, 0 before the first snapshot
+func (r *ReplicationClient) Tick() uint64 {
+    if r.applied == nil {
+        return 0
+    }
+    return r.applied.tick
+}
+
+// how many inputs the server hasn't run yet
+func (r *ReplicationClient) Pending() int {
+    return len(r.pending)
+}
+
+// puts the player back where the server had it and runs the inputs it hadn't got to yet
+func (r *ReplicationClient) reconcile(snap *clientSnapshot) {
+    kept := r.pending[:0]
+    for _, p := range r.pending {
+        if p.seq > snap.ack {
+            kept = append(kept, p)
+        }
+    }
+    r.pending = kept
+    if r.Predict == nil || snap.player == nil {
+        return
+    }
+    components, ok := snap.entities[*snap.player]
+    if !ok {
+        return
+    }
+    e := r.mirror(*snap.player)
+    for t, c := range components {
+        r.set(e, t, c)
+    }
+    for _, p := range r.pending {
+        r.Predict(r.World, e, p.input)
+    }
+}
+
+// the local entity for the server's e, made if it's new
+func (r *ReplicationClient) mirror(e Entity) Entity {
+    l, ok := r.local[e]
+    if !ok || !r.World.Alive(l) {
+        l = r.World.Create()
+        r.local[e] = l
+    }
+    return l
+}
+
+// copies c into e's component of type t, adding one if it hasn't got it
+func (r *ReplicationClient) set(e Entity, t ComponentType, c interface{}) {
+    if existing := r.World.Get(e, t); existing != nil {
+        reflect.ValueOf(existing).Elem().Set(reflect.ValueOf(c).Elem())
+        return
+    }
+    v := reflect.New(t.Elem())
+    v.Elem().Set(reflect.ValueOf(c).Elem())
+    r.World.Add(e, v.Interface())
+    if restorable, ok := v.Interface().(Restorable); ok {
+        restorable.Restored(r.World, e)
+    }
+}
+
+// brings the World up to Delay behind the server; call it from the game's Update
+func (r *ReplicationClient) Update(dt float64) {
+    r.time += dt
+    if len(r.snapshots) == 0 {
+        return
+    }
+    at := r.time + r.offset - r.Delay
+    // the last snapshot at or before then, and the one after it if there is one
+    i := 0
+    for i+1 < len(r.snapshots) && r.snapshots[i+1].time <= at {
+        i++
+    }
+    from, to := r.snapshots[i], r.snapshots[i]
+    t := 1.0
+    if i+1 < len(r.snapshots) && at > from.time {
+        to = r.snapshots[i+1]
+        t = (at - from.time) / (to.time - from.time)
+    }
+    r.snapshots = r.snapshots[i:]
+    r.apply(from, to, t)
+}
+
+func (r *ReplicationClient) apply(from, to *clientSnapshot, t float64) {
+    // predicted rather than interpolated, and up to date with the newest snapshot already
+    var player *Entity
+    if r.Predict != nil {
+        player = r.latest.player
+    }
+    for e, components := range to.entities {
+        l := r.mirror(e)
+        if player != nil && e == *player {
+            continue
+        }
+        for ct, c := range components {
+            before, ok := from.entities[e][ct]
+            current := r.World.Get(l, ct)
+            if i, interpolates := current.(Interpolator); ok && interpolates {
+                i.Interpolate(before, c, t)
+            } else {
+                r.set(l, ct, c)
+            }
+        }
+        // components the server's taken off
+        if r.applied != nil {
+            for ct := range r.applied.entities[e] {
+                if _, still := components[ct]; !still {
+                    r.World.Remove(l, ct)
+                }
+            }
+        }
+    }
+    for e, l := range r.local {
+        if player != nil && e == *player {
+            if _, ok := r.latest.entities[e]; ok {
+                continue
+            }
+        }
+        if _, ok := to.entities[e]; !ok {
+            r.World.Destroy(l)
+            delete(r.local, e)
+        }
+    }
+    r.applied = to
+}
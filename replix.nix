@@ -16,5 +16,7 @@
         pkgs.xorg.libXxf86vm
         #Needed for pixel
         pkgs.pkgconfig
+        #Needed for the speaker build of beep
+        pkgs.alsa-lib
     ];
 }
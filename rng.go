@@ -0,0 +1,90 @@
+package main
+
+import (
+    "hash/fnv"
+    "math/rand"
+    "sort"
+)
+
+var rngLog = logging.Module("rng")
+
+// the stream Context.Random has always been: seeded with the seed itself, so replays recorded
+// before there were named streams still play the same
+const RNGGAMEPLAY = ""
+
+// the engine's random numbers, seeded once per run and split into named streams that don't
+// draw from each other. what a stream gives depends only on the seed and its name, so the
+// particles a frame happens to spawn can't change the next loot roll, e.g.
+//
+//	drop := ctx.RNG.Stream("loot").Intn(len(table))
+//	wander := ctx.RNG.Stream("ai").Float64()
+//
+// gameplay streams stay deterministic for replays and rollback as long as only the simulation
+// draws from them; effects and audio have their own ("vfx", "audio") for that reason.
+type RNG struct {
+    seed    int64
+    streams map[string]*rand.Rand
+}
+
+func NewRNG(seed int64) *RNG {
+    return &RNG{seed: seed, streams: map[string]*rand.Rand{}}
+}
+
+func (r *RNG) Seed() int64 {
+    return r.seed
+}
+
+// starts every stream over from seed, in place, so streams already handed out follow along.
+// replays do this before Game.Init.
+func (r *RNG) Reseed(seed int64) {
+    r.seed = seed
+    for name, s := range r.streams {
+        s.Seed(streamSeed(seed, name))
+    }
+}
+
+// the stream called name, made the first time it's asked for. it's not safe to share between
+// goroutines.
+func (r *RNG) Stream(name string) *rand.Rand {
+    s, ok := r.streams[name]
+    if !ok {
+        s = rand.New(rand.NewSource(streamSeed(r.seed, name)))
+        r.streams[name] = s
+    }
+    return s
+}
+
+// the streams asked for so far, sorted
+func (r *RNG) Streams() []string {
+    names := make([]string, 0, len(r.streams))
+    for name := range r.streams {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// the name hashed into the seed, then mixed with splitmix64's finaliser so that seeds 1 and 2,
+// or streams "ai" and "aj", don't start out alike
+func streamSeed(seed int64, name string) int64 {
+    if name == RNGGAMEPLAY {
+        return seed
+    }
+    h := fnv.New64a()
+    h.Write([]byte(name))
+    z := uint64(seed) ^ h.Sum64()
+    z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+    z = (z ^ z>>27) * 0x94d049bb133111eb
+    return int64(z ^ z>>31)
+}
+
+func registerRNGCommands(c *Console, r *RNG) {
+    c.Register("seed", "prints the random seed, to pass to --seed, or starts every stream over from a new one", func(args ConsoleArgs) error {
+        if args.Has(0) {
+            r.Reseed(int64(args.Int(0)))
+            rngLog.Infof("reseeded with %d", r.Seed())
+        }
+        c.Printf("seed %d, streams %q", r.Seed(), r.Streams())
+        return nil
+    }, IntArg("seed").Opt())
+}
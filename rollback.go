@@ -0,0 +1,397 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "reflect"
+)
+
+// ticks a local input waits before it's played, to hide that much latency without rolling back
+const ROLLBACKDELAY = 2
+
+// the most ticks a session runs ahead of the inputs it's sure of; further than that it waits
+const ROLLBACKMAX = 8
+
+// one player's input for a tick, as bits, e.g. from ActionInput; the same on every machine, so a
+// deterministic game comes out the same everywhere
+type RollbackInput uint64
+
+// sets bit i for each of names that's held, e.g. ActionInput(actions, "left", "right", "jump")
+func ActionInput(a *Actions, names ...string) RollbackInput {
+    var in RollbackInput
+    for i, name := range names {
+        if a != nil && a.Pressed(name) {
+            in |= 1 << uint(i)
+        }
+    }
+    return in
+}
+
+// a game that can run under rollback: stepping it with the same inputs from the same state has
+// to give the same state on every machine, so no wall clock, map order or unseeded randomness in
+// Step
+type RollbackGame interface {
+    // advances one tick with every player's input for it, indexed by player
+    Step(inputs []RollbackInput)
+    // a copy of the whole simulation, to roll back to; it mustn't share anything Step changes
+    SaveState() interface{}
+    LoadState(state interface{})
+}
+
+// what one player sends the others each tick
+type RollbackPacket struct {
+    Player int           `json:"player"`
+    Tick   int           `json:"tick"`
+    Input  RollbackInput `json:"input"`
+}
+
+func init() {
+    RegisterPacket("rollback", RollbackPacket{})
+}
+
+// where a session's local inputs go, e.g. NetRollbackLink over a connection
+type RollbackLink interface {
+    Send(p RollbackPacket) error
+}
+
+type netRollbackLink struct {
+    conn *NetConn
+}
+
+func (l netRollbackLink) Send(p RollbackPacket) error {
+    return l.conn.Send(p)
+}
+
+// sends a session's inputs over conn
+func NetRollbackLink(conn *NetConn) RollbackLink {
+    return netRollbackLink{conn}
+}
+
+// one player's inputs, known or guessed
+type rollbackInputs struct {
+    known map[int]RollbackInput
+    // every tick up to this one is known
+    confirmed int
+    // the newest known input, which is the guess for ticks after it
+    last RollbackInput
+}
+
+// runs a RollbackGame between players on different machines. each tick it plays every player's
+// input: its own Delay ticks late, and the others' as they arrive or, before then, guessed to be
+// what they last were. when an input arrives that doesn't match its guess, the game is put back
+// to that tick and played forward again with it, all within one AdvanceFrame. call AdvanceFrame
+// once per fixed step with the local player's input, e.g.
+//
+//	session := NewRollbackSession(game, 2, local)
+//	session.AddLink(NetRollbackLink(conn))
+//	session.Listen(client)
+//	...
+//	session.AdvanceFrame(ActionInput(actions, "left", "right", "fire"))
+type RollbackSession struct {
+    Game    RollbackGame
+    Players int
+    // which player this machine is
+    Local int
+    Delay int
+    // how far it runs ahead of the slowest player's known inputs before waiting for them
+    MaxRollback int
+
+    links  []RollbackLink
+    inputs []rollbackInputs
+    // what each tick was played with, to spot wrong guesses
+    played map[int][]RollbackInput
+    // the state before each tick that might still be rolled back to
+    states map[int]interface{}
+    tick   int
+    // the earliest tick played with a wrong guess, or -1
+    rollbackTo int
+    started    bool
+
+    rollbacks, resimulated, stalls int
+}
+
+func NewRollbackSession(game RollbackGame, players, local int) *RollbackSession {
+    s := &RollbackSession{
+        Game:        game,
+        Players:     players,
+        Local:       local,
+        Delay:       ROLLBACKDELAY,
+        MaxRollback: ROLLBACKMAX,
+        inputs:      make([]rollbackInputs, players),
+        played:      map[int][]RollbackInput{},
+        states:      map[int]interface{}{},
+        rollbackTo:  -1,
+    }
+    for p := range s.inputs {
+        s.inputs[p] = rollbackInputs{known: map[int]RollbackInput{}, confirmed: -1}
+    }
+    return s
+}
+
+func (s *RollbackSession) AddLink(link RollbackLink) {
+    s.links = append(s.links, link)
+}
+
+// takes the other players' inputs from peer, a Server or a Client
+func (s *RollbackSession) Listen(peer interface {
+    Handle(example interface{}, fn func(c *NetConn, packet interface{}))
+}) {
+    peer.Handle(RollbackPacket{}, func(c *NetConn, packet interface{}) {
+        p := packet.(RollbackPacket)
+        if err := s.Receive(p.Player, p.Tick, p.Input); err != nil {
+            netLog.Warnf("%s: %v", c.Addr(), err)
+        }
+    })
+}
+
+// records player's input for tick. inputs come in order, as they're sent; one for a tick that's
+// already been played with a different guess rolls the game back on the next AdvanceFrame.
+func (s *RollbackSession) Receive(player, tick int, input RollbackInput) error {
+    if player < 0 || player >= s.Players || player == s.Local {
+        return fmt.Errorf("rollback: input from player %d", player)
+    }
+    s.start()
+    in := &s.inputs[player]
+    if tick != in.confirmed+1 {
+        return fmt.Errorf("rollback: player %d's input for tick %d came after tick %d", player, tick, in.confirmed)
+    }
+    s.record(player, tick, input)
+    if played, ok := s.played[tick]; ok && played[player] != input {
+        if s.rollbackTo < 0 || tick < s.rollbackTo {
+            s.rollbackTo = tick
+        }
+    }
+    return nil
+}
+
+func (s *RollbackSession) record(player, tick int, input RollbackInput) {
+    in := &s.inputs[player]
+    in.known[tick] = input
+    in.last = input
+    in.confirmed = tick
+}
+
+// the input player is played with at tick: theirs if it's in, otherwise their newest
+func (s *RollbackSession) input(player, tick int) RollbackInput {
+    in := &s.inputs[player]
+    if input, ok := in.known[tick]; ok {
+        return input
+    }
+    return in.last
+}
+
+// the newest tick every player's input is known up to
+func (s *RollbackSession) Confirmed() int {
+    confirmed := math.MaxInt32
+    for _, in := range s.inputs {
+        if in.confirmed < confirmed {
+            confirmed = in.confirmed
+        }
+    }
+    return confirmed
+}
+
+// the next tick to be played
+func (s *RollbackSession) Tick() int {
+    return s.tick
+}
+
+// how many times it's rolled back, how many ticks it's played again doing so, and how many
+// frames it's waited on the other players
+func (s *RollbackSession) Stats() (rollbacks, resimulated, stalls int) {
+    return s.rollbacks, s.resimulated, s.stalls
+}
+
+// plays one tick with local as this player's input for Delay ticks from now, rolling back first
+// if a guess turned out wrong. if it's got MaxRollback ahead of the inputs it knows, it waits
+// instead, drops local and returns false; the game should hold its frame until it goes again.
+func (s *RollbackSession) AdvanceFrame(local RollbackInput) bool {
+    s.start()
+    s.rollback()
+    if s.tick-s.Confirmed()-1 >= s.MaxRollback {
+        s.stalls++
+        return false
+    }
+
+    at := s.tick + s.Delay
+    s.record(s.Local, at, local)
+    for _, link := range s.links {
+        if err := link.Send(RollbackPacket{Player: s.Local, Tick: at, Input: local}); err != nil {
+            netLog.Warnf("rollback: %v", err)
+        }
+    }
+    s.step()
+    s.prune()
+    return true
+}
+
+// nobody's input covers the first Delay ticks, so they're empty for everyone
+func (s *RollbackSession) start() {
+    if s.started {
+        return
+    }
+    s.started = true
+    for p := range s.inputs {
+        for t := 0; t < s.Delay; t++ {
+            s.record(p, t, 0)
+        }
+    }
+}
+
+// plays s.tick, keeping the state before it
+func (s *RollbackSession) step() {
+    s.states[s.tick] = s.Game.SaveState()
+    inputs := make([]RollbackInput, s.Players)
+    for p := range inputs {
+        inputs[p] = s.input(p, s.tick)
+    }
+    s.played[s.tick] = inputs
+    s.Game.Step(inputs)
+    s.tick++
+}
+
+// goes back to the earliest wrong guess and plays up to now again
+func (s *RollbackSession) rollback() {
+    if s.rollbackTo < 0 {
+        return
+    }
+    from, now := s.rollbackTo, s.tick
+    s.rollbackTo = -1
+    state, ok := s.states[from]
+    if !ok {
+        // pruned, which MaxRollback should never let happen
+        netLog.Errorf("rollback: no state for tick %d", from)
+        return
+    }
+    s.Game.LoadState(state)
+    s.tick = from
+    for s.tick < now {
+        s.step()
+    }
+    s.rollbacks++
+    s.resimulated += now - from
+}
+
+// forgets inputs and states no rollback can reach any more
+func (s *RollbackSession) prune() {
+    oldest := s.Confirmed()
+    for t := range s.states {
+        if t < oldest {
+            delete(s.states, t)
+            delete(s.played, t)
+        }
+    }
+    for p := range s.inputs {
+        for t := range s.inputs[p].known {
+            if t < oldest {
+                delete(s.inputs[p].known, t)
+            }
+        }
+    }
+}
+
+// the newest state it's sure of, from before the tick after the last one with every input, or
+// false before there is one
+func (s *RollbackSession) settled() (int, interface{}, bool) {
+    tick := s.Confirmed() + 1
+    if tick >= s.tick {
+        tick = s.tick - 1
+    }
+    state, ok := s.states[tick]
+    return tick, state, ok && s.rollbackTo < 0
+}
+
+// two sessions of the same game in one process, each player's inputs reaching the other Latency
+// ticks after they're sent, for trying a game under rollback without a network. Check compares
+// the two games where both have every input, so a desync shows straight away, e.g.
+//
+//	h := NewRollbackHarness(NewMyGame(), NewMyGame(), 3)
+//	for i := 0; i < 600; i++ {
+//		h.Step(RollbackInput(rand.Intn(16)), RollbackInput(rand.Intn(16)))
+//		if err := h.Check(); err != nil { ... }
+//	}
+type RollbackHarness struct {
+    Sessions [2]*RollbackSession
+    Latency  int
+
+    inflight []harnessPacket
+    step     int
+    // each session's settled states, kept until the other's caught up
+    settled [2]map[int]interface{}
+}
+
+type harnessPacket struct {
+    at, to int
+    packet RollbackPacket
+}
+
+type harnessLink struct {
+    h  *RollbackHarness
+    to int
+}
+
+func (l harnessLink) Send(p RollbackPacket) error {
+    l.h.inflight = append(l.h.inflight, harnessPacket{at: l.h.step + l.h.Latency, to: l.to, packet: p})
+    return nil
+}
+
+func NewRollbackHarness(a, b RollbackGame, latency int) *RollbackHarness {
+    h := &RollbackHarness{Latency: latency, settled: [2]map[int]interface{}{{}, {}}}
+    for i, game := range []RollbackGame{a, b} {
+        h.Sessions[i] = NewRollbackSession(game, 2, i)
+        h.Sessions[i].AddLink(harnessLink{h, 1 - i})
+    }
+    return h
+}
+
+// delivers what's arrived, then advances both sessions one frame with their player's input
+func (h *RollbackHarness) Step(a, b RollbackInput) {
+    kept := h.inflight[:0]
+    for _, p := range h.inflight {
+        if p.at > h.step {
+            kept = append(kept, p)
+            continue
+        }
+        if err := h.Sessions[p.to].Receive(p.packet.Player, p.packet.Tick, p.packet.Input); err != nil {
+            netLog.Errorf("%v", err)
+        }
+    }
+    h.inflight = kept
+    h.Sessions[0].AdvanceFrame(a)
+    h.Sessions[1].AdvanceFrame(b)
+    h.step++
+    for i, s := range h.Sessions {
+        if tick, state, ok := s.settled(); ok {
+            h.settled[i][tick] = state
+        }
+    }
+}
+
+// an error if the two games have differed at any tick both had all the inputs for
+func (h *RollbackHarness) Check() error {
+    a, b := h.settled[0], h.settled[1]
+    for tick, sa := range a {
+        sb, ok := b[tick]
+        if !ok {
+            continue
+        }
+        delete(a, tick)
+        delete(b, tick)
+        if !reflect.DeepEqual(sa, sb) {
+            return fmt.Errorf("rollback: the games differ at tick %d", tick)
+        }
+    }
+    // what the other's already past won't be matched
+    newest := -1
+    for tick := range b {
+        if tick > newest {
+            newest = tick
+        }
+    }
+    for tick := range a {
+        if tick < newest {
+            delete(a, tick)
+        }
+    }
+    return nil
+}
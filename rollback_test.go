@@ -0,0 +1,93 @@
+package main
+
+import (
+    "fmt"
+    "math/rand"
+    "testing"
+)
+
+// two players pushed around a board by their input bits, bumping into each other
+type pushGame struct {
+    state pushState
+    // added to player 0's x from this tick on, so games given different nudges drift apart
+    nudgeFrom, nudge int
+}
+
+type pushState struct {
+    Tick int
+    X, Y [2]int
+}
+
+func (g *pushGame) Step(inputs []RollbackInput) {
+    for p, in := range inputs {
+        if in&1 != 0 {
+            g.state.X[p]--
+        }
+        if in&2 != 0 {
+            g.state.X[p]++
+        }
+        if in&4 != 0 {
+            g.state.Y[p]++
+        }
+        if in&8 != 0 {
+            g.state.Y[p]--
+        }
+    }
+    if g.state.X[0] == g.state.X[1] && g.state.Y[0] == g.state.Y[1] {
+        g.state.X[1]++
+    }
+    if g.nudge != 0 && g.state.Tick >= g.nudgeFrom {
+        g.state.X[0] += g.nudge
+    }
+    g.state.Tick++
+}
+
+func (g *pushGame) SaveState() interface{}      { return g.state }
+func (g *pushGame) LoadState(state interface{}) { g.state = state.(pushState) }
+
+// plays ticks of random input through h, checking after each, and returns the first error
+func runHarness(h *RollbackHarness, ticks int) error {
+    random := rand.New(rand.NewSource(1))
+    for i := 0; i < ticks; i++ {
+        h.Step(RollbackInput(random.Intn(16)), RollbackInput(random.Intn(16)))
+        if err := h.Check(); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func TestRollbackHarnessConverges(t *testing.T) {
+    a, b := &pushGame{}, &pushGame{}
+    h := NewRollbackHarness(a, b, 5)
+    if err := runHarness(h, 600); err != nil {
+        t.Fatal(err)
+    }
+    for i, s := range h.Sessions {
+        if rollbacks, _, _ := s.Stats(); rollbacks == 0 {
+            t.Errorf("session %d never rolled back, so the latency wasn't felt", i)
+        }
+    }
+    // once the inputs stop changing every guess is right, so both end up in the same place
+    for i := 0; i < 2*(ROLLBACKDELAY+5+ROLLBACKMAX); i++ {
+        h.Step(0, 0)
+        if err := h.Check(); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if h.Sessions[0].Tick() != h.Sessions[1].Tick() || a.state != b.state {
+        t.Errorf("ended at tick %d %+v and tick %d %+v", h.Sessions[0].Tick(), a.state, h.Sessions[1].Tick(), b.state)
+    }
+}
+
+func TestRollbackHarnessCatchesDesync(t *testing.T) {
+    h := NewRollbackHarness(&pushGame{}, &pushGame{nudgeFrom: 300, nudge: 1}, 5)
+    err := runHarness(h, 600)
+    if err == nil {
+        t.Fatal("games that drift apart passed Check")
+    }
+    var tick int
+    if _, scanErr := fmt.Sscanf(err.Error(), "rollback: the games differ at tick %d", &tick); scanErr != nil || tick < 300 {
+        t.Errorf("error %v, want one from tick 300 on", err)
+    }
+}
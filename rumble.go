@@ -0,0 +1,102 @@
+package main
+
+import (
+    "errors"
+    "math"
+
+    "github.com/faiface/pixel/pixelgl"
+)
+
+var errNoRumble = errors.New("rumble isn't supported on this platform")
+
+// the platform side of Rumble. GLFW has no force feedback, so the default does nothing; a build
+// with SDL or XInput underneath can set Gamepads.Haptics to drive the motors.
+type Haptics interface {
+    // sets js's low and high frequency motors, 0 to 1; 0, 0 stops them
+    SetRumble(js pixelgl.Joystick, low, high float64) error
+}
+
+type noHaptics struct{}
+
+func (noHaptics) SetRumble(js pixelgl.Joystick, low, high float64) error {
+    return errNoRumble
+}
+
+type padRumble struct {
+    low, high, remaining float64
+}
+
+// runs js's motors for duration seconds, low for the heavy thud of an explosion and high for the
+// buzz of a hit, both 0 to 1. overlapping rumbles don't add up, each motor runs at the strongest.
+// does nothing on a platform without rumble, so it's safe to call anywhere.
+func (g *Gamepads) Rumble(js pixelgl.Joystick, low, high, duration float64) {
+    if js < 0 || !g.present[js] || duration <= 0 {
+        return
+    }
+    g.rumbles[js] = append(g.rumbles[js], padRumble{math.Max(0, math.Min(1, low)), math.Max(0, math.Min(1, high)), duration})
+    g.applyRumble(js)
+}
+
+// rumbles player's pad, if they have one
+func (g *Gamepads) RumblePlayer(player int, low, high, duration float64) {
+    g.Rumble(g.Joystick(player), low, high, duration)
+}
+
+func (g *Gamepads) StopRumble(js pixelgl.Joystick) {
+    g.rumbles[js] = nil
+    g.applyRumble(js)
+}
+
+// how hard js's motors are asked to run right now, whether or not the platform can
+func (g *Gamepads) Rumbling(js pixelgl.Joystick) (low, high float64) {
+    return g.motors[js][0], g.motors[js][1]
+}
+
+// counts rumbles down by dt seconds of game time. they hold while Paused, with the motors off.
+func (g *Gamepads) UpdateRumble(dt float64) {
+    for js := range g.rumbles {
+        if !g.Paused {
+            rumbles := g.rumbles[js][:0]
+            for _, r := range g.rumbles[js] {
+                r.remaining -= dt
+                if r.remaining > 0 {
+                    rumbles = append(rumbles, r)
+                }
+            }
+            g.rumbles[js] = rumbles
+        }
+        g.applyRumble(pixelgl.Joystick(js))
+    }
+}
+
+// tells Haptics about js's motors when they change
+func (g *Gamepads) applyRumble(js pixelgl.Joystick) {
+    low, high := 0.0, 0.0
+    if !g.Paused {
+        for _, r := range g.rumbles[js] {
+            if r.low > low {
+                low = r.low
+            }
+            if r.high > high {
+                high = r.high
+            }
+        }
+    }
+    strength := math.Max(0, math.Min(1, g.RumbleStrength))
+    low, high = low*strength, high*strength
+    if g.motors[js] == [2]float64{low, high} {
+        return
+    }
+    g.motors[js] = [2]float64{low, high}
+    if !g.present[js] || g.Haptics == nil {
+        return
+    }
+    if err := g.Haptics.SetRumble(js, low, high); err != nil {
+        if err != errNoRumble {
+            padLog.Warnf("pad %d rumble: %v", js+1, err)
+        } else if !g.noRumble {
+            g.noRumble = true
+            padLog.Debugf("%v", err)
+        }
+    }
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+)
+
+const SAVEEXT = ".sav"
+
+// a save's header, for listing slots on a load screen
+type SaveInfo struct {
+    Slot    string
+    Version int
+    Saved   time.Time
+    // the slot itself was unreadable and this came from the backup of the save before it
+    Recovered bool
+}
+
+type saveFile struct {
+    Version  int       `json:"version"`
+    Saved    time.Time `json:"saved"`
+    Checksum string    `json:"checksum"`
+    // the game's own state, as JSON so migrations can reshape it
+    Data json.RawMessage `json:"data"`
+}
+
+// takes the data as saved by version from and returns it as version from+1 would have saved it
+type SaveMigration func(data json.RawMessage) (json.RawMessage, error)
+
+// named save slots in the user's config directory. every save is written to a temporary file
+// and renamed into place, keeping the one it replaces as a backup, so a crash or power cut
+// mid-save leaves either the old save or the new one; a slot that fails its checksum loads from
+// the backup instead.
+type SaveManager struct {
+    Dir string
+    // what new saves are stamped with; bump it and add a Migrate step when the saved data
+    // changes shape
+    Version int
+
+    migrations map[int]SaveMigration
+}
+
+// slots go under the OS config directory, e.g. ~/.config/<game>/saves on Linux and
+// %AppData%\<game>\saves on Windows
+func NewSaveManager(game string) (*SaveManager, error) {
+    base, err := os.UserConfigDir()
+    if err != nil {
+        return nil, fmt.Errorf("saves: %v", err)
+    }
+    return &SaveManager{
+        Dir:        filepath.Join(base, game, "saves"),
+        Version:    1,
+        migrations: make(map[int]SaveMigration),
+    }, nil
+}
+
+// registers the step that upgrades saves from version from to from+1; older saves run every
+// step in turn on load
+func (m *SaveManager) Migrate(from int, fn SaveMigration) {
+    m.migrations[from] = fn
+}
+
+// slot names become file names, so they're kept to letters, digits, - and _
+func validSlot(slot string) error {
+    if slot == "" {
+        return errors.New("empty slot name")
+    }
+    for _, r := range slot {
+        if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+            return fmt.Errorf("slot %q: only letters, digits, - and _ are allowed", slot)
+        }
+    }
+    return nil
+}
+
+func (m *SaveManager) path(slot string) string {
+    return filepath.Join(m.Dir, slot+SAVEEXT)
+}
+
+func checksum(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+// writes v, which is marshalled to JSON, into slot
+func (m *SaveManager) Save(slot string, v interface{}) error {
+    if err := validSlot(slot); err != nil {
+        return fmt.Errorf("save: %v", err)
+    }
+    data, err := json.Marshal(v)
+    if err != nil {
+        return fmt.Errorf("save %s: %v", slot, err)
+    }
+    file, err := json.Marshal(saveFile{
+        Version:  m.Version,
+        Saved:    time.Now(),
+        Checksum: checksum(data),
+        Data:     data,
+    })
+    if err != nil {
+        return fmt.Errorf("save %s: %v", slot, err)
+    }
+    if err := os.MkdirAll(m.Dir, 0755); err != nil {
+        return fmt.Errorf("save %s: %v", slot, err)
+    }
+    if err := writeAtomic(m.path(slot), file); err != nil {
+        return fmt.Errorf("save %s: %v", slot, err)
+    }
+    return nil
+}
+
+// replaces path with data through a synced temporary file in the same directory, keeping the
+// file it replaces as path.bak
+func writeAtomic(path string, data []byte) error {
+    tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+    if err != nil {
+        return err
+    }
+    _, err = tmp.Write(data)
+    if err == nil {
+        err = tmp.Sync()
+    }
+    if cerr := tmp.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        os.Remove(tmp.Name())
+        return err
+    }
+    if _, err := os.Stat(path); err == nil {
+        if err := os.Rename(path, path+".bak"); err != nil {
+            os.Remove(tmp.Name())
+            return err
+        }
+    }
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        return err
+    }
+    // so the rename itself survives a power cut; not every OS can sync a directory
+    if dir, err := os.Open(filepath.Dir(path)); err == nil {
+        dir.Sync()
+        dir.Close()
+    }
+    return nil
+}
+
+func readSave(path string) (*saveFile, error) {
+    raw, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var file saveFile
+    if err := json.Unmarshal(raw, &file); err != nil {
+        return nil, fmt.Errorf("corrupt: %v", err)
+    }
+    // compacted the way Save marshalled it, in case the file was reformatted by hand
+    var data bytes.Buffer
+    if err := json.Compact(&data, file.Data); err != nil {
+        return nil, fmt.Errorf("corrupt: %v", err)
+    }
+    if checksum(data.Bytes()) != file.Checksum {
+        return nil, errors.New("checksum mismatch")
+    }
+    file.Data = data.Bytes()
+    return &file, nil
+}
+
+// reads slot, or its backup when the slot is missing or damaged
+func (m *SaveManager) read(slot string) (*saveFile, bool, error) {
+    path := m.path(slot)
+    file, err := readSave(path)
+    if err == nil {
+        return file, false, nil
+    }
+    backup, berr := readSave(path + ".bak")
+    if berr != nil {
+        // the slot's own error says more than the backup's
+        return nil, false, err
+    }
+    return backup, true, nil
+}
+
+// reads slot into v, migrating it first if it was saved by an older Version
+func (m *SaveManager) Load(slot string, v interface{}) (SaveInfo, error) {
+    if err := validSlot(slot); err != nil {
+        return SaveInfo{}, fmt.Errorf("load: %v", err)
+    }
+    file, recovered, err := m.read(slot)
+    if err != nil {
+        return SaveInfo{}, fmt.Errorf("load %s: %v", slot, err)
+    }
+    info := SaveInfo{Slot: slot, Version: file.Version, Saved: file.Saved, Recovered: recovered}
+    if file.Version > m.Version {
+        return info, fmt.Errorf("load %s: saved by version %d, newer than %d", slot, file.Version, m.Version)
+    }
+    data := file.Data
+    for version := file.Version; version < m.Version; version++ {
+        migrate, ok := m.migrations[version]
+        if !ok {
+            return info, fmt.Errorf("load %s: no migration from version %d", slot, version)
+        }
+        if data, err = migrate(data); err != nil {
+            return info, fmt.Errorf("load %s: migrating from version %d: %v", slot, version, err)
+        }
+    }
+    if err := json.Unmarshal(data, v); err != nil {
+        return info, fmt.Errorf("load %s: %v", slot, err)
+    }
+    return info, nil
+}
+
+func (m *SaveManager) Exists(slot string) bool {
+    if validSlot(slot) != nil {
+        return false
+    }
+    for _, path := range []string{m.path(slot), m.path(slot) + ".bak"} {
+        if _, err := os.Stat(path); err == nil {
+            return true
+        }
+    }
+    return false
+}
+
+func (m *SaveManager) Delete(slot string) error {
+    if err := validSlot(slot); err != nil {
+        return fmt.Errorf("delete: %v", err)
+    }
+    for _, path := range []string{m.path(slot), m.path(slot) + ".bak"} {
+        if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+            return fmt.Errorf("delete %s: %v", slot, err)
+        }
+    }
+    return nil
+}
+
+// every readable slot, newest first
+func (m *SaveManager) Slots() ([]SaveInfo, error) {
+    entries, err := os.ReadDir(m.Dir)
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("saves: %v", err)
+    }
+    var slots []SaveInfo
+    seen := make(map[string]bool)
+    for _, entry := range entries {
+        // a backup on its own is a save interrupted between its two renames
+        slot := strings.TrimSuffix(entry.Name(), ".bak")
+        if entry.IsDir() || !strings.HasSuffix(slot, SAVEEXT) {
+            continue
+        }
+        slot = strings.TrimSuffix(slot, SAVEEXT)
+        if seen[slot] || validSlot(slot) != nil {
+            continue
+        }
+        seen[slot] = true
+        file, recovered, err := m.read(slot)
+        if err != nil {
+            continue
+        }
+        slots = append(slots, SaveInfo{Slot: slot, Version: file.Version, Saved: file.Saved, Recovered: recovered})
+    }
+    sort.Slice(slots, func(i, j int) bool { return slots[i].Saved.After(slots[j].Saved) })
+    return slots, nil
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+    "github.com/faiface/pixel"
+)
+
+// one screen of the game, like a menu, a level or a pause menu
+type Scene interface {
+    // called when the scene is added to the stack, and Exit when it leaves it
+    Enter()
+    Exit()
+    // only the top scene gets input and updates; dt is in seconds
+    HandleInput(in Input)
+    Update(dt float64)
+    // draws onto t directly or by submitting to the renderer
+    Draw(t RenderTarget)
+}
+
+// scenes that implement it and return true let the scene underneath show through, like a pause
+// menu over the paused level
+type OverlayScene interface {
+    Overlay() bool
+}
+
+// scenes that implement it and return true keep updating while the manager is Paused, like the
+// pause menu itself
+type UnpausableScene interface {
+    Unpausable() bool
+}
+
+// scenes that implement it bring their song in when they come to the top, crossfading from the
+// one before over the transition, or MUSICFADE seconds without one. one that returns a Song with
+// no stems, like a pause menu, leaves the music as it is.
+type MusicScene interface {
+    Music() Song
+}
+
+// no-op Scene methods to embed, so a scene only writes the ones it needs
+type BaseScene struct{}
+
+func (BaseScene) Enter()               {}
+func (BaseScene) Exit()                {}
+func (BaseScene) HandleInput(in Input) {}
+func (BaseScene) Update(dt float64)    {}
+func (BaseScene) Draw(t RenderTarget)  {}
+
+type sceneOpKind int
+
+const (
+    scenePush sceneOpKind = iota
+    scenePop
+    sceneReplace
+    sceneReset
+    sceneRemove
+)
+
+type sceneOp struct {
+    kind       sceneOpKind
+    scene      Scene
+    transition *Transition
+}
+
+// a stack of scenes. changes are queued and applied between updates, so a scene can push or
+// pop from its own Update without pulling the stack out from under the loop.
+type SceneManager struct {
+    // flushed into each side of a transition, so scenes that submit to it transition too
+    Renderer *Renderer
+    // stops updating the top scene unless it's an UnpausableScene; input and drawing carry on
+    Paused bool
+
+    stack      []Scene
+    pending    []sceneOp
+    transition *Transition
+    bounds     pixel.Rect
+}
+
+// bounds is the size transitions render at, usually screen.Bounds()
+func NewSceneManager(r *Renderer, bounds pixel.Rect) *SceneManager {
+    return &SceneManager{Renderer: r, bounds: bounds}
+}
+
+// a transition sized for the manager, to pass to PushWith, PopWith, ReplaceWith or ResetWith
+func (m *SceneManager) NewTransition(kind TransitionKind, duration float64) *Transition {
+    return NewTransition(kind, duration, m.bounds)
+}
+
+func (m *SceneManager) SetBounds(bounds pixel.Rect) {
+    m.bounds = bounds
+    if m.transition != nil {
+        m.transition.SetBounds(bounds)
+    }
+}
+
+// the scene getting input, or nil when the stack is empty
+func (m *SceneManager) Top() Scene {
+    if len(m.stack) == 0 {
+        return nil
+    }
+    return m.stack[len(m.stack)-1]
+}
+
+func (m *SceneManager) Len() int {
+    return len(m.stack)
+}
+
+func (m *SceneManager) Transitioning() bool {
+    return m.transition != nil
+}
+
+// adds s on top, e.g. a pause menu
+func (m *SceneManager) Push(s Scene) { m.PushWith(s, nil) }
+
+// removes the top scene, going back to the one below
+func (m *SceneManager) Pop() { m.PopWith(nil) }
+
+// swaps the top scene for s, e.g. from one level to the next
+func (m *SceneManager) Replace(s Scene) { m.ReplaceWith(s, nil) }
+
+// clears the whole stack down to just s, e.g. from game over back to the title screen
+func (m *SceneManager) Reset(s Scene) { m.ResetWith(s, nil) }
+
+// takes s off the stack along with every scene above it, e.g. a pause menu and the options opened
+// from it; nothing happens if s isn't on the stack by then
+func (m *SceneManager) Remove(s Scene) { m.RemoveWith(s, nil) }
+
+func (m *SceneManager) PushWith(s Scene, tr *Transition) {
+    m.pending = append(m.pending, sceneOp{scenePush, s, tr})
+}
+
+func (m *SceneManager) PopWith(tr *Transition) {
+    m.pending = append(m.pending, sceneOp{scenePop, nil, tr})
+}
+
+func (m *SceneManager) ReplaceWith(s Scene, tr *Transition) {
+    m.pending = append(m.pending, sceneOp{sceneReplace, s, tr})
+}
+
+func (m *SceneManager) ResetWith(s Scene, tr *Transition) {
+    m.pending = append(m.pending, sceneOp{sceneReset, s, tr})
+}
+
+func (m *SceneManager) RemoveWith(s Scene, tr *Transition) {
+    m.pending = append(m.pending, sceneOp{sceneRemove, s, tr})
+}
+
+// applies queued changes; ones queued behind a transition wait for it to finish
+func (m *SceneManager) flush() {
+    for len(m.pending) > 0 && m.transition == nil {
+        op := m.pending[0]
+        m.pending = m.pending[1:]
+        m.apply(op)
+    }
+}
+
+func (m *SceneManager) apply(op sceneOp) {
+    before := append([]Scene(nil), m.stack...)
+    var leaving []Scene
+    entering := op.scene
+    switch op.kind {
+    case scenePop:
+        if len(m.stack) == 0 {
+            return
+        }
+        leaving = m.stack[len(m.stack)-1:]
+        m.stack = m.stack[:len(m.stack)-1]
+    case sceneReplace:
+        if len(m.stack) > 0 {
+            leaving = m.stack[len(m.stack)-1:]
+            m.stack = m.stack[:len(m.stack)-1]
+        }
+    case sceneReset:
+        // top first, the order they'd have been popped in
+        for i := len(m.stack) - 1; i >= 0; i-- {
+            leaving = append(leaving, m.stack[i])
+        }
+        m.stack = nil
+    case sceneRemove:
+        entering = nil
+        i := len(m.stack) - 1
+        for i >= 0 && m.stack[i] != op.scene {
+            i--
+        }
+        if i < 0 {
+            return
+        }
+        for j := len(m.stack) - 1; j >= i; j-- {
+            leaving = append(leaving, m.stack[j])
+        }
+        m.stack = m.stack[:i]
+    }
+    leaving = append([]Scene(nil), leaving...)
+    if entering != nil {
+        m.stack = append(m.stack, entering)
+    }
+
+    exit := func() {
+        for _, s := range leaving {
+            s.Exit()
+        }
+    }
+    tr := op.transition
+    if tr == nil {
+        exit()
+        if entering != nil {
+            entering.Enter()
+        }
+        m.playMusic(MUSICFADE)
+        return
+    }
+
+    // the leaving scenes keep drawing until the transition ends, so they only exit then
+    if entering != nil {
+        entering.Enter()
+    }
+    after := append([]Scene(nil), m.stack...)
+    tr.From = func(t RenderTarget) { m.drawScenes(before, t) }
+    tr.To = func(t RenderTarget) { m.drawScenes(after, t) }
+    done := tr.OnComplete
+    tr.OnComplete = func() {
+        exit()
+        m.transition = nil
+        if done != nil {
+            done()
+        }
+    }
+    m.transition = tr
+    m.playMusic(tr.Duration)
+}
+
+// crossfades to the top scene's song, if it has one
+func (m *SceneManager) playMusic(fade float64) {
+    s, ok := m.Top().(MusicScene)
+    if !ok || audio == nil {
+        return
+    }
+    if song := s.Music(); len(song.Stems) > 0 {
+        if err := audio.PlaySong(song, fade); err != nil {
+            audioLog.Warnf("%v", err)
+        }
+    }
+}
+
+// passes input to the top scene, unless a transition is running
+func (m *SceneManager) HandleInput(in Input) {
+    m.flush()
+    if top := m.Top(); top != nil && m.transition == nil {
+        top.HandleInput(in)
+    }
+    m.flush()
+}
+
+func unpausable(s Scene) bool {
+    u, ok := s.(UnpausableScene)
+    return ok && u.Unpausable()
+}
+
+// updates the top scene and any running transition. dt is in seconds.
+func (m *SceneManager) Update(dt float64) {
+    m.flush()
+    if top := m.Top(); top != nil && (!m.Paused || unpausable(top)) {
+        top.Update(dt)
+    }
+    if m.transition != nil {
+        m.transition.Update(dt)
+    }
+    m.flush()
+}
+
+// draws the stack from the lowest scene that isn't covered up
+func (m *SceneManager) drawScenes(stack []Scene, t RenderTarget) {
+    first := len(stack) - 1
+    for first > 0 {
+        overlay, ok := stack[first].(OverlayScene)
+        if !ok || !overlay.Overlay() {
+            break
+        }
+        first--
+    }
+    for i := first; i >= 0 && i < len(stack); i++ {
+        stack[i].Draw(t)
+    }
+    // inside a transition each side renders into its own canvas, so submitted draws go with it
+    if m.transition != nil && m.Renderer != nil {
+        m.Renderer.Draw(t)
+    }
+}
+
+func (m *SceneManager) Draw(t ComposeTarget) {
+    if m.transition != nil {
+        m.transition.Draw(t)
+        return
+    }
+    m.drawScenes(m.stack, t)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+    "math"
+)
+
+type taskStep struct {
+    wait  float64
+    until func() bool
+    do    func()
+}
+
+// waits and calls run one after another by a Scheduler, built by chaining, e.g.
+// Sequence().Do(openDoor).Wait(1.5).WaitUntil(playerInside).Do(closeDoor)
+type Task struct {
+    // stops the task where it is until cleared
+    Paused bool
+    // keeps running while the Scheduler is paused, e.g. for pause menu timers
+    Unpausable bool
+
+    steps     []taskStep
+    step      int
+    elapsed   float64
+    loop      bool
+    done      bool
+    cancelled bool
+}
+
+// an empty task to chain steps onto, then hand to Scheduler.Start
+func Sequence() *Task {
+    return &Task{}
+}
+
+// waits seconds of scheduler time
+func (t *Task) Wait(seconds float64) *Task {
+    t.steps = append(t.steps, taskStep{wait: seconds})
+    return t
+}
+
+// waits until cond returns true, checking once per update
+func (t *Task) WaitUntil(cond func() bool) *Task {
+    t.steps = append(t.steps, taskStep{until: cond})
+    return t
+}
+
+func (t *Task) Do(fn func()) *Task {
+    t.steps = append(t.steps, taskStep{do: fn})
+    return t
+}
+
+// starts over from the first step after the last, until cancelled
+func (t *Task) Loop() *Task {
+    t.loop = true
+    return t
+}
+
+func (t *Task) Cancel() {
+    t.cancelled = true
+}
+
+func (t *Task) Done() bool {
+    return t.done || t.cancelled
+}
+
+func (t *Task) hasWait() bool {
+    for _, s := range t.steps {
+        if s.do == nil && s.until == nil && s.wait > 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// runs steps with dt seconds, carrying what's left of a finished wait into the next one so
+// repeating timers don't drift
+func (t *Task) update(dt float64) {
+    for !t.Done() && !t.Paused {
+        if t.step >= len(t.steps) {
+            if !t.loop || len(t.steps) == 0 {
+                t.done = true
+                return
+            }
+            t.step = 0
+            // a loop with nothing to wait on would spin forever, so it gets one pass per update
+            if !t.hasWait() {
+                return
+            }
+        }
+        s := t.steps[t.step]
+        switch {
+        case s.do != nil:
+            s.do()
+        case s.until != nil:
+            if !s.until() {
+                return
+            }
+        default:
+            t.elapsed += dt
+            if t.elapsed < s.wait {
+                return
+            }
+            dt = t.elapsed - s.wait
+            t.elapsed = 0
+        }
+        t.step++
+    }
+}
+
+// runs delayed calls, repeating timers and sequences off the game clock
+type Scheduler struct {
+    // holds every task except the Unpausable ones
+    Paused bool
+
+    tasks []*Task
+}
+
+func NewScheduler() *Scheduler {
+    return &Scheduler{}
+}
+
+func (s *Scheduler) Start(t *Task) *Task {
+    s.tasks = append(s.tasks, t)
+    return t
+}
+
+// calls fn once after delay seconds
+func (s *Scheduler) After(delay float64, fn func()) *Task {
+    return s.Start(Sequence().Wait(delay).Do(fn))
+}
+
+// calls fn every interval seconds until cancelled
+func (s *Scheduler) Every(interval float64, fn func()) *Task {
+    return s.Start(Sequence().Wait(math.Max(interval, 1e-6)).Do(fn).Loop())
+}
+
+// calls fn every interval seconds, times times
+func (s *Scheduler) Repeat(interval float64, times int, fn func()) *Task {
+    t := Sequence()
+    for i := 0; i < times; i++ {
+        t.Wait(interval).Do(fn)
+    }
+    return s.Start(t)
+}
+
+// advances every task by dt seconds
+func (s *Scheduler) Update(dt float64) {
+    // tasks started during the update wait for the next one
+    current := len(s.tasks)
+    for _, t := range s.tasks[:current] {
+        if !s.Paused || t.Unpausable {
+            t.update(dt)
+        }
+    }
+    running := s.tasks[:0]
+    for _, t := range s.tasks {
+        if !t.Done() {
+            running = append(running, t)
+        }
+    }
+    for i := len(running); i < len(s.tasks); i++ {
+        s.tasks[i] = nil
+    }
+    s.tasks = running
+}
+
+// cancels everything, e.g. when leaving a level
+func (s *Scheduler) Clear() {
+    for _, t := range s.tasks {
+        t.Cancel()
+    }
+    s.tasks = nil
+}
+
+func (s *Scheduler) Len() int {
+    return len(s.tasks)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+)
+
+type ScaleMode int
+
+const (
+    // largest aspect-preserving fit, with letterbox or pillarbox bars filling the rest
+    ScaleFit ScaleMode = iota
+    // fills the whole window, distorting the picture if the aspect ratios differ
+    ScaleStretch
+    // the largest whole multiple that fits, so every virtual pixel is the same size on screen.
+    // windows smaller than the virtual screen still get 1x, cropped at the edges.
+    ScaleInteger
+    // no scaling at all; the virtual screen grows and shrinks with the window so more of the world shows
+    ScaleResize
+)
+
+// a fixed design resolution the game renders at, scaled to whatever size the window is
+type VirtualScreen struct {
+    Width, Height float64
+    Mode          ScaleMode
+
+    window   pixel.Rect
+    onResize []func(bounds pixel.Rect)
+}
+
+// fn runs with the new virtual bounds whenever the window changes size, and once on the first Update
+func (v *VirtualScreen) OnResize(fn func(bounds pixel.Rect)) {
+    v.onResize = append(v.onResize, fn)
+}
+
+// notices window size changes; call once per frame before drawing
+func (v *VirtualScreen) Update(window pixel.Rect) {
+    if window == v.window || window.W() <= 0 || window.H() <= 0 {
+        return
+    }
+    v.window = window
+    if v.Mode == ScaleResize {
+        v.Width, v.Height = window.W(), window.H()
+    }
+    bounds := v.Bounds()
+    for _, fn := range v.onResize {
+        fn(bounds)
+    }
+}
+
+func NewVirtualScreen(width, height float64) *VirtualScreen {
+    return &VirtualScreen{Width: width, Height: height}
+}
+
+// the virtual screen in its own coordinates, for canvases and camera viewports
+func (v *VirtualScreen) Bounds() pixel.Rect {
+    return pixel.R(0, 0, v.Width, v.Height)
+}
+
+// horizontal and vertical scale from virtual to window pixels
+func (v *VirtualScreen) Scale(window pixel.Rect) pixel.Vec {
+    sx, sy := window.W()/v.Width, window.H()/v.Height
+    switch v.Mode {
+    case ScaleResize:
+        return pixel.V(1, 1)
+    case ScaleStretch:
+        return pixel.V(sx, sy)
+    case ScaleInteger:
+        s := math.Max(1, math.Floor(math.Min(sx, sy)))
+        return pixel.V(s, s)
+    }
+    s := math.Min(sx, sy)
+    return pixel.V(s, s)
+}
+
+// where the virtual screen lands inside window, snapped to whole pixels
+func (v *VirtualScreen) Viewport(window pixel.Rect) pixel.Rect {
+    scale := v.Scale(window)
+    size := pixel.V(v.Width*scale.X, v.Height*scale.Y)
+    min := window.Center().Sub(size.Scaled(0.5))
+    min = pixel.V(math.Floor(min.X), math.Floor(min.Y))
+    return pixel.Rect{Min: min, Max: min.Add(size)}
+}
+
+// converts a window position, such as the mouse, into virtual coordinates
+func (v *VirtualScreen) ToVirtual(window pixel.Rect, pos pixel.Vec) pixel.Vec {
+    vp := v.Viewport(window)
+    scale := v.Scale(window)
+    d := pos.Sub(vp.Min)
+    return pixel.V(d.X/scale.X, d.Y/scale.Y)
+}
+
+func (v *VirtualScreen) ToWindow(window pixel.Rect, pos pixel.Vec) pixel.Vec {
+    vp := v.Viewport(window)
+    scale := v.Scale(window)
+    return vp.Min.Add(pixel.V(pos.X*scale.X, pos.Y*scale.Y))
+}
+
+// the mouse in virtual coordinates; it can lie outside Bounds over the bars
+func (v *VirtualScreen) MousePosition(in Input) pixel.Vec {
+    return v.ToVirtual(in.Bounds(), in.MousePosition())
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+    "fmt"
+    "image"
+    "image/png"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/faiface/pixel/pixelgl"
+)
+
+var screenshotLog = logging.Module("screenshot")
+
+// where screenshots and recordings are written, relative to the working directory. it's ignored
+// by git, unlike screenshots/, which holds the README's images.
+const SCREENSHOTDIR = "captures"
+
+// key that saves a screenshot of the window
+var SCREENSHOTKEY = pixelgl.KeyF12
+
+// reads c back from the GPU into an opaque image, top row first
+func CaptureCanvas(c RenderCanvas) *image.RGBA {
+    pixels := c.Pixels()
+    w, h := canvasSize(c.Bounds())
+    img := image.NewRGBA(image.Rect(0, 0, w, h))
+    stride := 4 * w
+    // OpenGL rows start at the bottom
+    for y := 0; y < h; y++ {
+        copy(img.Pix[y*stride:(y+1)*stride], pixels[(h-1-y)*stride:(h-y)*stride])
+    }
+    for i := 3; i < len(img.Pix); i += 4 {
+        img.Pix[i] = 255
+    }
+    return img
+}
+
+// a timestamped file name in SCREENSHOTDIR with the given extension
+func screenshotPath(ext string) (string, error) {
+    if err := os.MkdirAll(SCREENSHOTDIR, 0755); err != nil {
+        return "", err
+    }
+    name := time.Now().Format("2006-01-02_15-04-05.000") + ext
+    return filepath.Join(SCREENSHOTDIR, name), nil
+}
+
+// writes img as a PNG into SCREENSHOTDIR and returns its path
+func WriteScreenshot(img image.Image) (string, error) {
+    path, err := screenshotPath(".png")
+    if err != nil {
+        return "", fmt.Errorf("screenshot: %v", err)
+    }
+    file, err := os.Create(path)
+    if err != nil {
+        return "", fmt.Errorf("screenshot: %v", err)
+    }
+    defer file.Close()
+    if err := png.Encode(file, img); err != nil {
+        return "", fmt.Errorf("screenshot %s: %v", path, err)
+    }
+    return path, nil
+}
+
+func SaveScreenshot(c RenderCanvas) (string, error) {
+    return WriteScreenshot(CaptureCanvas(c))
+}
+
+// saves a screenshot when SCREENSHOTKEY is pressed, encoding off the main thread so the game doesn't hitch
+func HandleScreenshotKey(w *pixelgl.Window) {
+    if !w.JustPressed(SCREENSHOTKEY) {
+        return
+    }
+    img := CaptureCanvas(w.Canvas())
+    go func() {
+        path, err := WriteScreenshot(img)
+        if err != nil {
+            screenshotLog.Errorf("%v", err)
+            return
+        }
+        screenshotLog.Infof("saved %s", path)
+    }()
+}
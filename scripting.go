@@ -0,0 +1,565 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "image/color"
+    "io/fs"
+    "reflect"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+    lua "github.com/yuin/gopher-lua"
+)
+
+var scriptLog = logging.Module("scripts")
+
+// where LoadAll looks for scripts in the asset filesystem
+const SCRIPTDIR = "scripts"
+
+// a Lua file from the asset filesystem with its own interpreter. the engine calls the globals
+// init() once it's loaded, update(dt) every simulation step and draw() every frame, whichever
+// the script defines.
+type Script struct {
+    Path string
+    // the error that stopped the script, until it's reloaded
+    Err error
+
+    state   *lua.LState
+    host    *Scripts
+    modTime time.Time
+    tasks   map[int]*Task
+    next    int
+}
+
+// every loaded script and what they can reach: World for the entity table, the engine's input,
+// scheduler and renderer for the rest
+type Scripts struct {
+    // when set, PollChanges reloads scripts whose files changed on disk
+    HotReload bool
+    // the world entity functions act on; without one they raise an error
+    World *World
+    // where draw calls go until a script calls gfx.layer
+    Layer string
+
+    scripts  []*Script
+    input    Input
+    lastPoll time.Time
+}
+
+func NewScripts() *Scripts {
+    return &Scripts{Layer: LAYERWORLD}
+}
+
+// loads and runs the script at path, replacing one already loaded from it
+func (s *Scripts) Load(path string) (*Script, error) {
+    script, err := s.open(path)
+    if err != nil {
+        return nil, err
+    }
+    for i, old := range s.scripts {
+        if old.Path == path {
+            old.close()
+            s.scripts[i] = script
+            return script, nil
+        }
+    }
+    s.scripts = append(s.scripts, script)
+    return script, nil
+}
+
+// loads every .lua file directly inside dir, in name order so load order is predictable
+func (s *Scripts) LoadAll(dir string) error {
+    paths, err := fs.Glob(AssetFS, assetPath(dir)+"/*.lua")
+    if err != nil {
+        return err
+    }
+    sort.Strings(paths)
+    for _, path := range paths {
+        if _, err := s.Load(path); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (s *Scripts) Unload(path string) {
+    for i, script := range s.scripts {
+        if script.Path == path {
+            script.close()
+            s.scripts = append(s.scripts[:i], s.scripts[i+1:]...)
+            return
+        }
+    }
+}
+
+func (s *Scripts) Close() {
+    for _, script := range s.scripts {
+        script.close()
+    }
+    s.scripts = nil
+}
+
+func (s *Scripts) Loaded() []*Script {
+    return s.scripts
+}
+
+func (s *Scripts) open(path string) (*Script, error) {
+    src, err := ReadAsset(path)
+    if err != nil {
+        return nil, fmt.Errorf("script %s: %v", path, err)
+    }
+    script := &Script{Path: path, host: s, modTime: assetModTime(path), tasks: make(map[int]*Task)}
+    script.state = newScriptState(script)
+    fn, err := script.state.Load(strings.NewReader(string(src)), path)
+    if err == nil {
+        script.state.Push(fn)
+        err = script.state.PCall(0, 0, nil)
+    }
+    if err != nil {
+        script.close()
+        return nil, fmt.Errorf("script %s: %v", path, err)
+    }
+    script.call("init")
+    if script.Err != nil {
+        err := script.Err
+        script.close()
+        return nil, err
+    }
+    return script, nil
+}
+
+// one simulation step: update(dt) in every script, in load order
+func (s *Scripts) Update(in Input, dt float64) {
+    s.input = in
+    for _, script := range s.scripts {
+        script.call("update", lua.LNumber(dt))
+    }
+}
+
+// calls draw() in every script; what they draw goes into the renderer's layers
+func (s *Scripts) Draw() {
+    for _, script := range s.scripts {
+        script.call("draw")
+    }
+}
+
+// reloads scripts whose files changed since they were loaded, every HOTRELOADINTERVAL like
+// AssetManager.PollChanges. a script that fails to load keeps running its old version.
+func (s *Scripts) PollChanges() {
+    if !s.HotReload || time.Since(s.lastPoll) < HOTRELOADINTERVAL {
+        return
+    }
+    s.lastPoll = time.Now()
+    for _, script := range s.scripts {
+        modTime := assetModTime(script.Path)
+        if modTime.IsZero() || !modTime.After(script.modTime) {
+            continue
+        }
+        // not retried until the file changes again, so a broken save is logged once
+        script.modTime = modTime
+        if _, err := s.Load(script.Path); err != nil {
+            scriptLog.Errorf("%v", err)
+            continue
+        }
+        scriptLog.Infof("reloaded %s", script.Path)
+    }
+}
+
+// calls the global fn if the script defines it. an error is logged and stops the script, so a
+// broken update doesn't log every frame.
+func (sc *Script) call(name string, args ...lua.LValue) {
+    if sc.Err != nil || sc.state == nil {
+        return
+    }
+    fn, ok := sc.state.GetGlobal(name).(*lua.LFunction)
+    if !ok {
+        return
+    }
+    sc.callFunc(fn, args...)
+}
+
+func (sc *Script) callFunc(fn *lua.LFunction, args ...lua.LValue) {
+    if sc.Err != nil || sc.state == nil {
+        return
+    }
+    if err := sc.state.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, args...); err != nil {
+        sc.Err = fmt.Errorf("script %s: %v", sc.Path, err)
+        scriptLog.Errorf("%v", sc.Err)
+    }
+}
+
+func (sc *Script) close() {
+    for _, t := range sc.tasks {
+        t.Cancel()
+    }
+    sc.tasks = nil
+    if sc.state != nil {
+        sc.state.Close()
+        sc.state = nil
+    }
+}
+
+// an interpreter with the safe parts of the standard library and the engine's tables. io, os
+// and the loaders that read the real filesystem are left out, scripts only see the game.
+func newScriptState(sc *Script) *lua.LState {
+    L := lua.NewState(lua.Options{SkipOpenLibs: true})
+    for _, lib := range []struct {
+        name string
+        open lua.LGFunction
+    }{
+        {lua.BaseLibName, lua.OpenBase},
+        {lua.TabLibName, lua.OpenTable},
+        {lua.StringLibName, lua.OpenString},
+        {lua.MathLibName, lua.OpenMath},
+        {lua.CoroutineLibName, lua.OpenCoroutine},
+    } {
+        L.Push(L.NewFunction(lib.open))
+        L.Push(lua.LString(lib.name))
+        L.Call(1, 0)
+    }
+    for _, name := range []string{"dofile", "loadfile"} {
+        L.SetGlobal(name, lua.LNil)
+    }
+
+    L.SetGlobal("log", L.NewFunction(func(L *lua.LState) int {
+        parts := make([]string, L.GetTop())
+        for i := range parts {
+            parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+        }
+        scriptLog.Infof("%s: %s", sc.Path, strings.Join(parts, " "))
+        return 0
+    }))
+    L.SetGlobal("input", L.SetFuncs(L.NewTable(), sc.inputFuncs()))
+    L.SetGlobal("timer", L.SetFuncs(L.NewTable(), sc.timerFuncs()))
+    L.SetGlobal("entity", L.SetFuncs(L.NewTable(), sc.entityFuncs()))
+    L.SetGlobal("gfx", L.SetFuncs(L.NewTable(), sc.drawFuncs()))
+    return L
+}
+
+func checkButton(L *lua.LState, n int) pixelgl.Button {
+    name := L.CheckString(n)
+    b, ok := ParseButton(name)
+    if !ok {
+        L.ArgError(n, fmt.Sprintf("unknown button %q", name))
+    }
+    return b
+}
+
+// input.pressed("Space"), input.action("jump"), input.mouse() and the like. buttons read as idle
+// outside update.
+func (sc *Script) inputFuncs() map[string]lua.LGFunction {
+    button := func(check func(in Input, b pixelgl.Button) bool) lua.LGFunction {
+        return func(L *lua.LState) int {
+            b := checkButton(L, 1)
+            in := sc.host.input
+            L.Push(lua.LBool(in != nil && check(in, b)))
+            return 1
+        }
+    }
+    action := func(check func(name string) bool) lua.LGFunction {
+        return func(L *lua.LState) int {
+            name := L.CheckString(1)
+            L.Push(lua.LBool(actions != nil && check(name)))
+            return 1
+        }
+    }
+    return map[string]lua.LGFunction{
+        "pressed":       button(func(in Input, b pixelgl.Button) bool { return in.Pressed(b) }),
+        "just_pressed":  button(func(in Input, b pixelgl.Button) bool { return in.JustPressed(b) }),
+        "just_released": button(func(in Input, b pixelgl.Button) bool { return in.JustReleased(b) }),
+        // named actions from the key bindings, see Actions
+        "action":               action(func(name string) bool { return actions.Pressed(name) }),
+        "action_just_pressed":  action(func(name string) bool { return actions.JustPressed(name) }),
+        "action_just_released": action(func(name string) bool { return actions.JustReleased(name) }),
+        // a press from the last moment or so, used up by asking; see Actions.Consume
+        "consume": action(func(name string) bool { return actions.Consume(name) }),
+        // -1 to 1, analog on a stick, e.g. input.axis("left", "right")
+        "axis": func(L *lua.LState) int {
+            negative, positive := L.CheckString(1), L.CheckString(2)
+            v := 0.0
+            if actions != nil {
+                v = actions.Axis(negative, positive)
+            }
+            L.Push(lua.LNumber(v))
+            return 1
+        },
+        // input.rumble(low, high, seconds) on the player's pad, when it can
+        "rumble": func(L *lua.LState) int {
+            low, high, duration := float64(L.CheckNumber(1)), float64(L.CheckNumber(2)), float64(L.CheckNumber(3))
+            if actions != nil {
+                gamepads.RumblePlayer(actions.Player, low, high, duration)
+            }
+            return 0
+        },
+        // in virtual screen coordinates
+        "mouse": func(L *lua.LState) int {
+            pos := pixel.ZV
+            if in := sc.host.input; in != nil {
+                pos = screen.MousePosition(in)
+            }
+            L.Push(lua.LNumber(pos.X))
+            L.Push(lua.LNumber(pos.Y))
+            return 2
+        },
+    }
+}
+
+// timer.after(seconds, fn) and timer.every(seconds, fn) run on the engine's scheduler, so they
+// hold while paused. both return a handle for timer.cancel; reloading a script cancels its timers.
+func (sc *Script) timerFuncs() map[string]lua.LGFunction {
+    start := func(repeat bool) lua.LGFunction {
+        return func(L *lua.LState) int {
+            delay, fn := float64(L.CheckNumber(1)), L.CheckFunction(2)
+            sc.next++
+            id := sc.next
+            if repeat {
+                sc.tasks[id] = scheduler.Every(delay, func() { sc.callFunc(fn) })
+            } else {
+                sc.tasks[id] = scheduler.After(delay, func() {
+                    delete(sc.tasks, id)
+                    sc.callFunc(fn)
+                })
+            }
+            L.Push(lua.LNumber(id))
+            return 1
+        }
+    }
+    return map[string]lua.LGFunction{
+        "after": start(false),
+        "every": start(true),
+        "cancel": func(L *lua.LState) int {
+            id := int(L.CheckNumber(1))
+            if t, ok := sc.tasks[id]; ok {
+                t.Cancel()
+                delete(sc.tasks, id)
+            }
+            return 0
+        },
+    }
+}
+
+// entities are plain numbers to scripts. components are reached by the names they were
+// registered under with RegisterComponent and copied in and out as tables through their JSON
+// form, e.g. entity.set(e, "position", {X = 10, Y = 20}).
+func (sc *Script) entityFuncs() map[string]lua.LGFunction {
+    world := func(L *lua.LState) *World {
+        if sc.host.World == nil {
+            L.RaiseError("no world to script, set Scripts.World")
+        }
+        return sc.host.World
+    }
+    component := func(L *lua.LState, n int) ComponentType {
+        name := L.CheckString(n)
+        t, ok := componentTypes[name]
+        if !ok {
+            L.ArgError(n, fmt.Sprintf("no component %q", name))
+        }
+        return t
+    }
+    set := func(L *lua.LState, w *World, e Entity, t ComponentType, v lua.LValue) {
+        data, err := json.Marshal(fromLua(v))
+        if err != nil {
+            L.RaiseError("%v", err)
+        }
+        existing := w.Get(e, t)
+        if existing == nil {
+            existing = reflect.New(t.Elem()).Interface()
+            defer w.Add(e, existing)
+        }
+        // into the existing component, so fields the table leaves out keep their values
+        if err := json.Unmarshal(data, existing); err != nil {
+            L.RaiseError("component %s: %v", componentNames[t], err)
+        }
+    }
+    return map[string]lua.LGFunction{
+        // entity.create({position = {X = 0, Y = 0}}), components optional
+        "create": func(L *lua.LState) int {
+            w := world(L)
+            e := w.Create()
+            if tbl, ok := L.Get(1).(*lua.LTable); ok {
+                tbl.ForEach(func(k, v lua.LValue) {
+                    t, ok := componentTypes[k.String()]
+                    if !ok {
+                        L.RaiseError("no component %q", k.String())
+                    }
+                    set(L, w, e, t, v)
+                })
+            }
+            L.Push(lua.LNumber(e))
+            return 1
+        },
+        "destroy": func(L *lua.LState) int {
+            world(L).Destroy(Entity(L.CheckNumber(1)))
+            return 0
+        },
+        "alive": func(L *lua.LState) int {
+            L.Push(lua.LBool(world(L).Alive(Entity(L.CheckNumber(1)))))
+            return 1
+        },
+        // a copy of the component, or nil; change it and hand it to entity.set
+        "get": func(L *lua.LState) int {
+            w, e, t := world(L), Entity(L.CheckNumber(1)), component(L, 2)
+            c := w.Get(e, t)
+            if c == nil {
+                L.Push(lua.LNil)
+                return 1
+            }
+            data, err := json.Marshal(c)
+            if err != nil {
+                L.RaiseError("%v", err)
+            }
+            var v interface{}
+            json.Unmarshal(data, &v)
+            L.Push(toLua(L, v))
+            return 1
+        },
+        "set": func(L *lua.LState) int {
+            w, e, t := world(L), Entity(L.CheckNumber(1)), component(L, 2)
+            if !w.Alive(e) {
+                L.ArgError(1, "dead entity")
+            }
+            set(L, w, e, t, L.CheckAny(3))
+            return 0
+        },
+        "remove": func(L *lua.LState) int {
+            world(L).Remove(Entity(L.CheckNumber(1)), component(L, 2))
+            return 0
+        },
+        // entities with every named component, as a list
+        "query": func(L *lua.LState) int {
+            w := world(L)
+            types := make([]ComponentType, L.GetTop())
+            for i := range types {
+                types[i] = component(L, i+1)
+            }
+            list := L.NewTable()
+            for _, e := range w.Query(types...) {
+                list.Append(lua.LNumber(e))
+            }
+            L.Push(list)
+            return 1
+        },
+    }
+}
+
+// colors are {r, g, b, a} tables from 0 to 1, alpha optional; white when left out
+func checkColor(L *lua.LState, n int) color.Color {
+    tbl, ok := L.Get(n).(*lua.LTable)
+    if !ok {
+        return pixel.RGB(1, 1, 1)
+    }
+    channels := []float64{1, 1, 1, 1}
+    for i := range channels {
+        if v, ok := tbl.RawGetInt(i + 1).(lua.LNumber); ok {
+            channels[i] = float64(v)
+        }
+    }
+    return pixel.RGB(channels[0], channels[1], channels[2]).Mul(pixel.Alpha(channels[3]))
+}
+
+// gfx.rect, gfx.circle, gfx.line and gfx.text, in the coordinates of the current layer. the table
+// isn't called draw since that's the name of the script's own hook.
+func (sc *Script) drawFuncs() map[string]lua.LGFunction {
+    vec := func(L *lua.LState, n int) pixel.Vec {
+        return pixel.V(float64(L.CheckNumber(n)), float64(L.CheckNumber(n+1)))
+    }
+    return map[string]lua.LGFunction{
+        "layer": func(L *lua.LState) int {
+            name := L.CheckString(1)
+            if renderer.Layer(name) == nil {
+                L.ArgError(1, fmt.Sprintf("unknown layer %q", name))
+            }
+            sc.host.Layer = name
+            return 0
+        },
+        // gfx.rect(x, y, w, h, color), filled
+        "rect": func(L *lua.LState) int {
+            pos, size := vec(L, 1), vec(L, 3)
+            imd := renderer.IMDraw(sc.host.Layer)
+            imd.Color = checkColor(L, 5)
+            imd.Push(pos, pos.Add(size))
+            imd.Rectangle(0)
+            return 0
+        },
+        // gfx.circle(x, y, radius, color), filled
+        "circle": func(L *lua.LState) int {
+            imd := renderer.IMDraw(sc.host.Layer)
+            imd.Color = checkColor(L, 4)
+            imd.Push(vec(L, 1))
+            imd.Circle(float64(L.CheckNumber(3)), 0)
+            return 0
+        },
+        // gfx.line(x1, y1, x2, y2, thickness, color)
+        "line": func(L *lua.LState) int {
+            imd := renderer.IMDraw(sc.host.Layer)
+            imd.Color = checkColor(L, 6)
+            imd.Push(vec(L, 1), vec(L, 3))
+            imd.Line(float64(L.OptNumber(5, 1)))
+            return 0
+        },
+        // gfx.text(s, x, y, size, color), x, y being the first baseline
+        "text": func(L *lua.LState) int {
+            s, pos := L.CheckString(1), vec(L, 2)
+            opts := TextOptions{Size: float64(L.OptNumber(4, 16)), Color: checkColor(L, 5)}
+            renderer.Submit(sc.host.Layer, func(t pixel.Target) {
+                DrawText(t, nil, s, pos, opts)
+            })
+            return 0
+        },
+    }
+}
+
+// Lua values for what encoding/json decodes into
+func toLua(L *lua.LState, v interface{}) lua.LValue {
+    switch v := v.(type) {
+    case bool:
+        return lua.LBool(v)
+    case float64:
+        return lua.LNumber(v)
+    case string:
+        return lua.LString(v)
+    case []interface{}:
+        tbl := L.NewTable()
+        for _, item := range v {
+            tbl.Append(toLua(L, item))
+        }
+        return tbl
+    case map[string]interface{}:
+        tbl := L.NewTable()
+        for k, item := range v {
+            tbl.RawSetString(k, toLua(L, item))
+        }
+        return tbl
+    }
+    return lua.LNil
+}
+
+// the reverse of toLua; tables with a sequence part become lists, the rest objects
+func fromLua(v lua.LValue) interface{} {
+    switch v := v.(type) {
+    case lua.LBool:
+        return bool(v)
+    case lua.LNumber:
+        return float64(v)
+    case lua.LString:
+        return string(v)
+    case *lua.LTable:
+        if n := v.Len(); n > 0 {
+            list := make([]interface{}, n)
+            for i := range list {
+                list[i] = fromLua(v.RawGetInt(i + 1))
+            }
+            return list
+        }
+        obj := make(map[string]interface{})
+        v.ForEach(func(k, item lua.LValue) {
+            obj[k.String()] = fromLua(item)
+        })
+        return obj
+    }
+    return nil
+}
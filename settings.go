@@ -0,0 +1,225 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "sort"
+
+    "github.com/faiface/pixel/pixelgl"
+)
+
+var settingsLog = logging.Module("settings")
+
+// where the player's settings are remembered between runs
+const SETTINGSPATH = "settings.json"
+
+// the volumes, 0 silent to 1 full, and how sounds are placed
+type VolumeSettings struct {
+    Master  float64 `json:"master"`
+    Music   float64 `json:"music"`
+    Effects float64 `json:"effects"`
+    Voice   float64 `json:"voice"`
+    // muted apart from the volumes, so unmuting brings back the level the player set
+    MasterMuted  bool `json:"master_muted"`
+    MusicMuted   bool `json:"music_muted"`
+    EffectsMuted bool `json:"effects_muted"`
+    VoiceMuted   bool `json:"voice_muted"`
+    // pans and fades sounds played at a position by where they are on screen; off plays them
+    // all centered
+    Spatial bool `json:"spatial"`
+    // what happens to the audio while the window doesn't have focus, and how quiet ducking is
+    Unfocused  AudioFocus `json:"unfocused"`
+    DuckVolume float64    `json:"duck_volume"`
+}
+
+// buttons per action name, saved by button name, e.g. "jump": ["Space", "W"]
+type KeyBindings map[string][]pixelgl.Button
+
+var buttonsByName map[string]pixelgl.Button
+
+func buttonNames() map[string]pixelgl.Button {
+    if buttonsByName == nil {
+        buttonsByName = make(map[string]pixelgl.Button)
+        for b := pixelgl.KeyUnknown; b <= pixelgl.KeyLast; b++ {
+            if s := b.String(); s != "Invalid" {
+                buttonsByName[s] = b
+            }
+        }
+    }
+    return buttonsByName
+}
+
+// the button pixelgl names name, e.g. "Space", "A" or "MouseButtonLeft"
+func ParseButton(name string) (pixelgl.Button, bool) {
+    b, ok := buttonNames()[name]
+    return b, ok
+}
+
+// every name ParseButton knows, sorted
+func ButtonNames() []string {
+    names := make([]string, 0, len(buttonNames()))
+    for name := range buttonNames() {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+func (k KeyBindings) MarshalJSON() ([]byte, error) {
+    names := make(map[string][]string, len(k))
+    for action, buttons := range k {
+        for _, b := range buttons {
+            names[action] = append(names[action], b.String())
+        }
+    }
+    return json.Marshal(names)
+}
+
+// unknown button names are dropped with a warning, so one typo doesn't lose every binding
+func (k *KeyBindings) UnmarshalJSON(data []byte) error {
+    var names map[string][]string
+    if err := json.Unmarshal(data, &names); err != nil {
+        return err
+    }
+    bindings := make(KeyBindings, len(names))
+    for action, list := range names {
+        buttons := []pixelgl.Button{}
+        for _, name := range list {
+            b, ok := ParseButton(name)
+            if !ok {
+                settingsLog.Warnf("unknown button %q for %s", name, action)
+                continue
+            }
+            buttons = append(buttons, b)
+        }
+        bindings[action] = buttons
+    }
+    *k = bindings
+    return nil
+}
+
+// the actions bound to buttons, sorted, for an options screen
+func (k KeyBindings) Actions() []string {
+    actions := make([]string, 0, len(k))
+    for action := range k {
+        actions = append(actions, action)
+    }
+    sort.Strings(actions)
+    return actions
+}
+
+func DefaultKeyBindings() KeyBindings {
+    return KeyBindings{
+        "up":      {pixelgl.KeyW, pixelgl.KeyUp},
+        "down":    {pixelgl.KeyS, pixelgl.KeyDown},
+        "left":    {pixelgl.KeyA, pixelgl.KeyLeft},
+        "right":   {pixelgl.KeyD, pixelgl.KeyRight},
+        "confirm": {pixelgl.KeyEnter, pixelgl.KeySpace},
+        "cancel":  {pixelgl.KeyBackspace},
+        "pause":   {pixelgl.KeyEscape},
+    }
+}
+
+// the player's options, loaded at startup over the game's defaults and saved when they change
+type Settings struct {
+    Title   string          `json:"title"`
+    Display DisplaySettings `json:"display"`
+    VSync   bool            `json:"vsync"`
+    Volume  VolumeSettings  `json:"volume"`
+    Keys    KeyBindings     `json:"keys"`
+    Pad     PadBindings     `json:"pad"`
+    // how far a stick moves before it counts, 0 to 1
+    PadDeadZone float64 `json:"pad_dead_zone"`
+    // 0 to 1, 0 for no rumble
+    Rumble float64 `json:"rumble"`
+    // scales captured mouse movement
+    MouseSensitivity float64      `json:"mouse_sensitivity"`
+    Zoom             ZoomSettings `json:"zoom"`
+    // the language text is shown in; "" follows the system's
+    Language      string                `json:"language"`
+    Accessibility AccessibilitySettings `json:"accessibility"`
+
+    path string
+}
+
+func DefaultSettings() Settings {
+    return Settings{
+        Title: "Go Pixel",
+        Display: DisplaySettings{
+            Mode:         DisplayWindowed,
+            WindowWidth:  SCREENX,
+            WindowHeight: SCREENY,
+        },
+        VSync: true,
+        Volume: VolumeSettings{
+            Master:     1,
+            Music:      1,
+            Effects:    1,
+            Voice:      1,
+            Spatial:    true,
+            Unfocused:  AudioFocusDuck,
+            DuckVolume: 0.25,
+        },
+        Keys: DefaultKeyBindings(),
+        Pad:  DefaultPadBindings(),
+
+        PadDeadZone: PADDEADZONE,
+        Rumble:      1,
+
+        MouseSensitivity: 1,
+        Zoom:             DefaultZoomSettings(),
+
+        Accessibility: AccessibilitySettings{ColorFilter: ColorFilterNone, FilterStrength: 1, UIScale: 1},
+    }
+}
+
+// reads path over defaults, so anything the file leaves out keeps its default. a missing file
+// is normal on the first run; an unreadable one is logged and replaced by defaults on the next
+// Save. an empty path keeps the settings in memory only.
+func LoadSettings(path string, defaults Settings) *Settings {
+    s := defaults
+    s.path = path
+    if path == "" {
+        return &s
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        if !os.IsNotExist(err) {
+            settingsLog.Warnf("%v", err)
+        }
+        return &s
+    }
+    loaded := s
+    if err := json.Unmarshal(data, &loaded); err != nil {
+        settingsLog.Warnf("%s: %v", path, err)
+        return &s
+    }
+    // actions the file doesn't mention keep their default buttons
+    for action, buttons := range defaults.Keys {
+        if _, ok := loaded.Keys[action]; !ok {
+            loaded.Keys[action] = buttons
+        }
+    }
+    for action, controls := range defaults.Pad {
+        if _, ok := loaded.Pad[action]; !ok {
+            loaded.Pad[action] = controls
+        }
+    }
+    return &loaded
+}
+
+// writes the settings back to the file they were loaded from
+func (s *Settings) Save() error {
+    if s.path == "" {
+        return nil
+    }
+    data, err := json.MarshalIndent(s, "", "    ")
+    if err != nil {
+        return err
+    }
+    if err := writeAtomic(s.path, data); err != nil {
+        return fmt.Errorf("settings: %v", err)
+    }
+    return nil
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+)
+
+// a collider's shape placed in the world, for the narrowphase and the queries. Kind is ShapeBox
+// only for a box that isn't rotated; a rotated one is a ShapeConvex of its corners.
+type WorldShape struct {
+    Kind ShapeKind
+    // a box's rect, or the bounds of a circle or polygon
+    Rect   pixel.Rect
+    Center pixel.Vec
+    Radius float64
+    // a polygon's corners in order, either way round
+    Points []pixel.Vec
+}
+
+// the four corners of a size box centered on the origin, for Collider.Points
+func BoxPoints(size pixel.Vec) []pixel.Vec {
+    h := size.Scaled(0.5)
+    return []pixel.Vec{pixel.V(-h.X, -h.Y), pixel.V(h.X, -h.Y), pixel.V(h.X, h.Y), pixel.V(-h.X, h.Y)}
+}
+
+func WorldRect(r pixel.Rect) WorldShape {
+    return WorldShape{Kind: ShapeBox, Rect: r, Center: r.Center()}
+}
+
+func WorldCircle(center pixel.Vec, radius float64) WorldShape {
+    return WorldShape{
+        Kind:   ShapeCircle,
+        Rect:   pixel.Rect{Min: center.Sub(pixel.V(radius, radius)), Max: center.Add(pixel.V(radius, radius))},
+        Center: center,
+        Radius: radius,
+    }
+}
+
+// a convex polygon from its corners in world space
+func WorldPolygon(points []pixel.Vec) WorldShape {
+    s := WorldShape{Kind: ShapeConvex, Points: points}
+    if len(points) == 0 {
+        return s
+    }
+    s.Rect = pixel.Rect{Min: points[0], Max: points[0]}
+    var sum pixel.Vec
+    for _, p := range points {
+        s.Rect = s.Rect.Union(pixel.Rect{Min: p, Max: p})
+        sum = sum.Add(p)
+    }
+    s.Center = sum.Scaled(1 / float64(len(points)))
+    return s
+}
+
+// the box's corners, or the polygon's
+func (s WorldShape) corners() []pixel.Vec {
+    if s.Kind == ShapeBox {
+        r := s.Rect
+        return []pixel.Vec{r.Min, pixel.V(r.Max.X, r.Min.Y), r.Max, pixel.V(r.Min.X, r.Max.Y)}
+    }
+    return s.Points
+}
+
+// how a overlaps b: the shortest push that separates a. false when they don't overlap; touching
+// doesn't count. two boxes give the same answer as Penetration.
+func Collide(a, b WorldShape) (pixel.Vec, bool) {
+    push, depth, ok := overlap(a, b)
+    if !ok || depth <= 0 {
+        return pixel.ZV, false
+    }
+    return push.Scaled(depth), true
+}
+
+// whether a and b overlap or touch
+func (s WorldShape) Intersects(other WorldShape) bool {
+    _, _, ok := overlap(s, other)
+    return ok
+}
+
+// the direction that separates a from b and how far it has to go, unless they're apart. touching
+// shapes come back with a depth of 0.
+func overlap(a, b WorldShape) (pixel.Vec, float64, bool) {
+    switch {
+    case a.Kind == ShapeBox && b.Kind == ShapeBox:
+        if !a.Rect.Intersects(b.Rect) {
+            return pixel.ZV, 0, false
+        }
+        push, ok := Penetration(a.Rect, b.Rect)
+        if !ok {
+            return pixel.V(0, 1), 0, true
+        }
+        depth := push.Len()
+        return push.Scaled(1 / depth), depth, true
+    case a.Kind == ShapeCircle && b.Kind == ShapeCircle:
+        return circles(a.Center, a.Radius, b.Center, b.Radius)
+    case a.Kind == ShapeCircle:
+        return circlePolygon(a.Center, a.Radius, b.corners())
+    case b.Kind == ShapeCircle:
+        n, depth, ok := circlePolygon(b.Center, b.Radius, a.corners())
+        return pixel.ZV.Sub(n), depth, ok
+    }
+    return polygons(a.corners(), b.corners())
+}
+
+// circle a against circle b
+func circles(ca pixel.Vec, ra float64, cb pixel.Vec, rb float64) (pixel.Vec, float64, bool) {
+    d := ca.Sub(cb)
+    dist := d.Len()
+    if dist > ra+rb {
+        return pixel.ZV, 0, false
+    }
+    if dist == 0 {
+        // dead center has no best way out, so go up like a landing would
+        return pixel.V(0, 1), ra + rb, true
+    }
+    return d.Scaled(1 / dist), ra + rb - dist, true
+}
+
+// the separating axis test for a circle against a convex polygon: the polygon's edge normals,
+// plus the line from its nearest corner to the circle's center
+func circlePolygon(center pixel.Vec, radius float64, poly []pixel.Vec) (pixel.Vec, float64, bool) {
+    if len(poly) == 0 {
+        return pixel.ZV, 0, false
+    }
+    axes := edgeNormals(poly)
+    nearest := poly[0]
+    for _, p := range poly[1:] {
+        if p.Sub(center).Len() < nearest.Sub(center).Len() {
+            nearest = p
+        }
+    }
+    if d := center.Sub(nearest); d != pixel.ZV {
+        axes = append(axes, d.Unit())
+    }
+    best, bestDepth := pixel.ZV, math.Inf(1)
+    for _, axis := range axes {
+        c := center.Dot(axis)
+        lo, hi := project(poly, axis)
+        n, depth, ok := separation(c-radius, c+radius, lo, hi, axis)
+        if !ok {
+            return pixel.ZV, 0, false
+        }
+        if depth < bestDepth {
+            best, bestDepth = n, depth
+        }
+    }
+    return best, bestDepth, true
+}
+
+// the separating axis test for two convex polygons on both sets of edge normals
+func polygons(a, b []pixel.Vec) (pixel.Vec, float64, bool) {
+    if len(a) == 0 || len(b) == 0 {
+        return pixel.ZV, 0, false
+    }
+    best, bestDepth := pixel.ZV, math.Inf(1)
+    for _, axis := range append(edgeNormals(a), edgeNormals(b)...) {
+        aLo, aHi := project(a, axis)
+        bLo, bHi := project(b, axis)
+        n, depth, ok := separation(aLo, aHi, bLo, bHi, axis)
+        if !ok {
+            return pixel.ZV, 0, false
+        }
+        if depth < bestDepth {
+            best, bestDepth = n, depth
+        }
+    }
+    return best, bestDepth, true
+}
+
+// of a's span on axis against b's, the shorter way out for a and how far, unless they're apart
+func separation(aLo, aHi, bLo, bHi float64, axis pixel.Vec) (pixel.Vec, float64, bool) {
+    back, forward := aHi-bLo, bHi-aLo
+    if back < 0 || forward < 0 {
+        return pixel.ZV, 0, false
+    }
+    if back < forward {
+        return pixel.ZV.Sub(axis), back, true
+    }
+    return axis, forward, true
+}
+
+// each edge's unit normal; which way they face doesn't matter to separation
+func edgeNormals(poly []pixel.Vec) []pixel.Vec {
+    normals := make([]pixel.Vec, 0, len(poly))
+    for i, p := range poly {
+        edge := poly[(i+1)%len(poly)].Sub(p)
+        if edge != pixel.ZV {
+            normals = append(normals, edge.Normal().Unit())
+        }
+    }
+    return normals
+}
+
+// the span of poly's corners along axis
+func project(poly []pixel.Vec, axis pixel.Vec) (float64, float64) {
+    lo, hi := math.Inf(1), math.Inf(-1)
+    for _, p := range poly {
+        d := p.Dot(axis)
+        lo, hi = math.Min(lo, d), math.Max(hi, d)
+    }
+    return lo, hi
+}
+
+// how a circle overlaps a box, like Penetration: the push that separates the circle
+func CircleRect(center pixel.Vec, radius float64, r pixel.Rect) (pixel.Vec, bool) {
+    return Collide(WorldCircle(center, radius), WorldRect(r))
+}
+
+// whether p is inside the shape or on its edge
+func (s WorldShape) Contains(p pixel.Vec) bool {
+    switch s.Kind {
+    case ShapeBox:
+        return s.Rect.Contains(p)
+    case ShapeCircle:
+        return p.Sub(s.Center).Len() <= s.Radius
+    }
+    // on the same side of every edge, whichever way the corners go round
+    side := 0.0
+    for i, a := range s.Points {
+        cross := s.Points[(i+1)%len(s.Points)].Sub(a).Cross(p.Sub(a))
+        if cross*side < 0 {
+            return false
+        }
+        if cross != 0 {
+            side = cross
+        }
+    }
+    return len(s.Points) > 0
+}
+
+// how far p is from the shape, 0 inside it
+func (s WorldShape) Distance(p pixel.Vec) float64 {
+    switch {
+    case s.Kind == ShapeBox:
+        return rectDistance(s.Rect, p)
+    case s.Kind == ShapeCircle:
+        return math.Max(0, p.Sub(s.Center).Len()-s.Radius)
+    case s.Contains(p):
+        return 0
+    }
+    dist := math.Inf(1)
+    for i, a := range s.Points {
+        dist = math.Min(dist, segmentDistance(a, s.Points[(i+1)%len(s.Points)], p))
+    }
+    return dist
+}
+
+// how far p is from the segment a, b
+func segmentDistance(a, b, p pixel.Vec) float64 {
+    ab := b.Sub(a)
+    t := 0.0
+    if l := ab.Dot(ab); l > 0 {
+        t = math.Max(0, math.Min(1, p.Sub(a).Dot(ab)/l))
+    }
+    return p.Sub(a.Add(ab.Scaled(t))).Len()
+}
+
+// where along the segment, 0 to 1, it enters the shape, and the surface normal there, the way
+// segmentRect does for boxes
+func (s WorldShape) segment(from, to pixel.Vec) (float64, pixel.Vec, bool) {
+    switch s.Kind {
+    case ShapeBox:
+        return segmentRect(from, to, s.Rect)
+    case ShapeCircle:
+        return segmentCircle(from, to, s.Center, s.Radius)
+    }
+    return segmentPolygon(from, to, s.Points)
+}
+
+func segmentCircle(from, to, center pixel.Vec, radius float64) (float64, pixel.Vec, bool) {
+    if from.Sub(center).Len() <= radius {
+        return 0, pixel.ZV, true
+    }
+    d, f := to.Sub(from), from.Sub(center)
+    a, b, c := d.Dot(d), 2*f.Dot(d), f.Dot(f)-radius*radius
+    disc := b*b - 4*a*c
+    if a == 0 || disc < 0 {
+        return 0, pixel.ZV, false
+    }
+    t := (-b - math.Sqrt(disc)) / (2 * a)
+    if t < 0 || t > 1 {
+        return 0, pixel.ZV, false
+    }
+    return t, from.Add(d.Scaled(t)).Sub(center).Unit(), true
+}
+
+// clips the segment against each edge of a convex polygon, the Cyrus-Beck way
+func segmentPolygon(from, to pixel.Vec, poly []pixel.Vec) (float64, pixel.Vec, bool) {
+    if len(poly) < 3 {
+        return 0, pixel.ZV, false
+    }
+    if WorldPolygon(poly).Contains(from) {
+        return 0, pixel.ZV, true
+    }
+    center := WorldPolygon(poly).Center
+    d := to.Sub(from)
+    enter, exit := 0.0, 1.0
+    var normal pixel.Vec
+    for i, a := range poly {
+        edge := poly[(i+1)%len(poly)].Sub(a)
+        if edge == pixel.ZV {
+            continue
+        }
+        n := edge.Normal().Unit()
+        // facing out, away from the middle
+        if center.Sub(a).Dot(n) > 0 {
+            n = pixel.ZV.Sub(n)
+        }
+        dist := from.Sub(a).Dot(n)
+        along := d.Dot(n)
+        if along == 0 {
+            if dist > 0 {
+                return 0, pixel.ZV, false
+            }
+            continue
+        }
+        t := -dist / along
+        if along < 0 {
+            if t > enter {
+                enter, normal = t, n
+            }
+        } else if t < exit {
+            exit = t
+        }
+        if enter > exit {
+            return 0, pixel.ZV, false
+        }
+    }
+    return enter, normal, true
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// the context every shortcut falls back to, active whatever else is
+const SHORTCUTGLOBAL = "global"
+
+// a key with the modifiers that have to be held with it, e.g. Ctrl+Shift+R
+type Chord struct {
+    Key                     pixelgl.Button
+    Ctrl, Shift, Alt, Super bool
+}
+
+var modifierKeys = map[pixelgl.Button]bool{
+    pixelgl.KeyLeftControl: true, pixelgl.KeyRightControl: true,
+    pixelgl.KeyLeftShift: true, pixelgl.KeyRightShift: true,
+    pixelgl.KeyLeftAlt: true, pixelgl.KeyRightAlt: true,
+    pixelgl.KeyLeftSuper: true, pixelgl.KeyRightSuper: true,
+}
+
+// reads chords like "Ctrl+Shift+R", "Alt+Enter" or "F5"; the key is a ParseButton name
+func ParseChord(s string) (Chord, error) {
+    var c Chord
+    parts := strings.Split(s, "+")
+    for _, mod := range parts[:len(parts)-1] {
+        switch strings.ToLower(strings.TrimSpace(mod)) {
+        case "ctrl", "control":
+            c.Ctrl = true
+        case "shift":
+            c.Shift = true
+        case "alt", "option":
+            c.Alt = true
+        case "super", "cmd", "command", "win":
+            c.Super = true
+        default:
+            return Chord{}, fmt.Errorf("chord %q: unknown modifier %q", s, mod)
+        }
+    }
+    key, ok := ParseButton(strings.TrimSpace(parts[len(parts)-1]))
+    if !ok {
+        return Chord{}, fmt.Errorf("chord %q: unknown key %q", s, parts[len(parts)-1])
+    }
+    if modifierKeys[key] {
+        return Chord{}, fmt.Errorf("chord %q: ends in a modifier", s)
+    }
+    c.Key = key
+    return c, nil
+}
+
+// like ParseChord, for chords written into the game's code
+func MustChord(s string) Chord {
+    c, err := ParseChord(s)
+    if err != nil {
+        panic(err)
+    }
+    return c
+}
+
+func (c Chord) String() string {
+    var parts []string
+    if c.Ctrl {
+        parts = append(parts, "Ctrl")
+    }
+    if c.Shift {
+        parts = append(parts, "Shift")
+    }
+    if c.Alt {
+        parts = append(parts, "Alt")
+    }
+    if c.Super {
+        parts = append(parts, "Super")
+    }
+    return strings.Join(append(parts, c.Key.String()), "+")
+}
+
+// whether c was pressed this frame with exactly its modifiers held, so Ctrl+R doesn't also fire
+// for Ctrl+Shift+R
+func (c Chord) JustPressed(in Input) bool {
+    if !in.JustPressed(c.Key) {
+        return false
+    }
+    held := func(left, right pixelgl.Button) bool { return in.Pressed(left) || in.Pressed(right) }
+    return c.Ctrl == held(pixelgl.KeyLeftControl, pixelgl.KeyRightControl) &&
+        c.Shift == held(pixelgl.KeyLeftShift, pixelgl.KeyRightShift) &&
+        c.Alt == held(pixelgl.KeyLeftAlt, pixelgl.KeyRightAlt) &&
+        c.Super == held(pixelgl.KeyLeftSuper, pixelgl.KeyRightSuper)
+}
+
+type shortcut struct {
+    context, name string
+    chord         Chord
+    run           func()
+}
+
+// named keyboard shortcuts grouped by context, e.g. "editor" and "gameplay". a chord bound in
+// several contexts runs in the most recently pushed active one, falling back to SHORTCUTGLOBAL,
+// so Ctrl+Z can undo in the editor and do something else in play.
+type Shortcuts struct {
+    shortcuts []*shortcut
+    // active contexts, the last pushed first in line
+    contexts []string
+}
+
+func NewShortcuts() *Shortcuts {
+    return &Shortcuts{}
+}
+
+// binds chord to run in context, replacing whatever it did there before; a clash with another
+// shortcut of the same context is logged, since one of them could never fire
+func (s *Shortcuts) Register(context, name string, chord Chord, run func()) {
+    kept := s.shortcuts[:0]
+    for _, sc := range s.shortcuts {
+        if sc.context == context && sc.chord == chord && sc.name != name {
+            engineLog.Warnf("shortcut %s: %s replaces %s in %s", chord, name, sc.name, context)
+        }
+        if sc.context == context && (sc.chord == chord || sc.name == name) {
+            continue
+        }
+        kept = append(kept, sc)
+    }
+    s.shortcuts = append(kept, &shortcut{context, name, chord, run})
+}
+
+func (s *Shortcuts) Unregister(context, name string) {
+    for i, sc := range s.shortcuts {
+        if sc.context == context && sc.name == name {
+            s.shortcuts = append(s.shortcuts[:i:i], s.shortcuts[i+1:]...)
+            return
+        }
+    }
+}
+
+// makes context's shortcuts active, ahead of those already active, e.g. when the editor opens
+func (s *Shortcuts) PushContext(context string) {
+    s.PopContext(context)
+    s.contexts = append(s.contexts, context)
+}
+
+// deactivates context
+func (s *Shortcuts) PopContext(context string) {
+    for i, c := range s.contexts {
+        if c == context {
+            s.contexts = append(s.contexts[:i:i], s.contexts[i+1:]...)
+            return
+        }
+    }
+}
+
+// the active contexts, first in line first, ending in SHORTCUTGLOBAL
+func (s *Shortcuts) Contexts() []string {
+    contexts := make([]string, 0, len(s.contexts)+1)
+    for i := len(s.contexts) - 1; i >= 0; i-- {
+        contexts = append(contexts, s.contexts[i])
+    }
+    return append(contexts, SHORTCUTGLOBAL)
+}
+
+// the shortcut chord runs right now, if any
+func (s *Shortcuts) Resolve(chord Chord) (context, name string, ok bool) {
+    if sc := s.find(chord); sc != nil {
+        return sc.context, sc.name, true
+    }
+    return "", "", false
+}
+
+func (s *Shortcuts) find(chord Chord) *shortcut {
+    for _, context := range s.Contexts() {
+        for _, sc := range s.shortcuts {
+            if sc.context == context && sc.chord == chord {
+                return sc
+            }
+        }
+    }
+    return nil
+}
+
+// runs the shortcuts pressed this frame; simulate calls it every frame
+func (s *Shortcuts) Update(in Input) {
+    seen := make(map[Chord]bool)
+    for _, sc := range s.shortcuts {
+        if seen[sc.chord] || !sc.chord.JustPressed(in) {
+            continue
+        }
+        seen[sc.chord] = true
+        if winner := s.find(sc.chord); winner != nil {
+            winner.run()
+        }
+    }
+}
+
+// "context  chord  name" for every shortcut, sorted, for the console
+func (s *Shortcuts) List() []string {
+    lines := make([]string, 0, len(s.shortcuts))
+    for _, sc := range s.shortcuts {
+        lines = append(lines, fmt.Sprintf("%-10s %-18s %s", sc.context, sc.chord, sc.name))
+    }
+    sort.Strings(lines)
+    return lines
+}
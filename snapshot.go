@@ -0,0 +1,221 @@
+package main
+
+import (
+    "bytes"
+    "encoding/gob"
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "sort"
+
+    "github.com/faiface/pixel"
+)
+
+// bumped when the snapshot layout changes; older snapshots still load, newer ones are refused
+const WORLDSNAPSHOTVERSION = 1
+
+var (
+    componentTypes = make(map[string]ComponentType)
+    componentNames = make(map[ComponentType]string)
+)
+
+// makes a component type saveable under name, e.g. RegisterComponent("position", (*Position)(nil)).
+// the name is what snapshots store, so keep it once saves exist. components of unregistered
+// types are left out of snapshots, which suits runtime-only state like caches.
+func RegisterComponent(name string, ptr interface{}) {
+    t := ComponentTypeOf(ptr)
+    if t == nil || t.Kind() != reflect.Ptr {
+        panic(fmt.Sprintf("ecs: component %T isn't a pointer", ptr))
+    }
+    if _, ok := componentTypes[name]; ok {
+        panic(fmt.Sprintf("ecs: component %q registered twice", name))
+    }
+    componentTypes[name] = t
+    componentNames[t] = name
+}
+
+// components that implement it are told once every component of a restored snapshot is back,
+// e.g. to rebuild what they cache from their saved fields
+type Restorable interface {
+    Restored(w *World, e Entity)
+}
+
+type worldSnapshot struct {
+    Version     int              `json:"version"`
+    Generations []uint32         `json:"generations"`
+    Free        []uint32         `json:"free,omitempty"`
+    Entities    []entitySnapshot `json:"entities"`
+}
+
+type entitySnapshot struct {
+    ID         Entity              `json:"id"`
+    Components []componentSnapshot `json:"components,omitempty"`
+}
+
+// Data is the component encoded on its own, as JSON or gob to match the snapshot
+type componentSnapshot struct {
+    Type string          `json:"type"`
+    Data json.RawMessage `json:"data"`
+}
+
+func (w *World) snapshot(encode func(interface{}) ([]byte, error)) (*worldSnapshot, error) {
+    snap := &worldSnapshot{
+        Version:     WORLDSNAPSHOTVERSION,
+        Generations: append([]uint32(nil), w.generations...),
+        Free:        append([]uint32(nil), w.free...),
+    }
+    for _, e := range w.Query() {
+        es := entitySnapshot{ID: e}
+        for t, s := range w.stores {
+            name, ok := componentNames[t]
+            if !ok {
+                continue
+            }
+            i, ok := s.index[e]
+            if !ok {
+                continue
+            }
+            data, err := encode(s.components[i])
+            if err != nil {
+                return nil, fmt.Errorf("component %s of %v: %v", name, e, err)
+            }
+            es.Components = append(es.Components, componentSnapshot{name, data})
+        }
+        // map order would make every save of the same world differ
+        sort.Slice(es.Components, func(i, j int) bool { return es.Components[i].Type < es.Components[j].Type })
+        snap.Entities = append(snap.Entities, es)
+    }
+    return snap, nil
+}
+
+// replaces every entity and component with the snapshot's, keeping the systems. entity slots
+// come back exactly as saved, so Entity values stored in components still point the right way.
+func (w *World) restore(snap *worldSnapshot, decode func([]byte, interface{}) error) error {
+    if snap.Version > WORLDSNAPSHOTVERSION {
+        return fmt.Errorf("world snapshot: version %d is newer than %d", snap.Version, WORLDSNAPSHOTVERSION)
+    }
+    n := len(snap.Generations)
+    restored := &World{
+        generations: append([]uint32(nil), snap.Generations...),
+        alive:       make([]bool, n),
+        free:        append([]uint32(nil), snap.Free...),
+        stores:      make(map[ComponentType]*componentStore),
+        systems:     w.systems,
+    }
+    for _, es := range snap.Entities {
+        i := es.ID.index()
+        if int(i) >= n || restored.generations[i] != es.ID.generation() {
+            return fmt.Errorf("world snapshot: %v doesn't match its slot", es.ID)
+        }
+        restored.alive[i] = true
+        for _, cs := range es.Components {
+            t, ok := componentTypes[cs.Type]
+            if !ok {
+                return fmt.Errorf("world snapshot: unknown component %q", cs.Type)
+            }
+            c := reflect.New(t.Elem()).Interface()
+            if err := decode(cs.Data, c); err != nil {
+                return fmt.Errorf("component %s of %v: %v", cs.Type, es.ID, err)
+            }
+            restored.Add(es.ID, c)
+        }
+    }
+    *w = *restored
+
+    for _, es := range snap.Entities {
+        for _, cs := range es.Components {
+            if r, ok := w.Get(es.ID, componentTypes[cs.Type]).(Restorable); ok {
+                r.Restored(w, es.ID)
+            }
+        }
+    }
+    return nil
+}
+
+func (w *World) MarshalJSON() ([]byte, error) {
+    snap, err := w.snapshot(json.Marshal)
+    if err != nil {
+        return nil, err
+    }
+    return json.Marshal(snap)
+}
+
+func (w *World) UnmarshalJSON(data []byte) error {
+    var snap worldSnapshot
+    if err := json.Unmarshal(data, &snap); err != nil {
+        return fmt.Errorf("world snapshot: %v", err)
+    }
+    return w.restore(&snap, json.Unmarshal)
+}
+
+func gobEncode(v interface{}) ([]byte, error) {
+    var buf bytes.Buffer
+    if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+func gobDecode(data []byte, v interface{}) error {
+    return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// smaller and faster than JSON, for saves nobody needs to read
+func (w *World) GobEncode() ([]byte, error) {
+    snap, err := w.snapshot(gobEncode)
+    if err != nil {
+        return nil, err
+    }
+    return gobEncode(snap)
+}
+
+func (w *World) GobDecode(data []byte) error {
+    var snap worldSnapshot
+    if err := gobDecode(data, &snap); err != nil {
+        return fmt.Errorf("world snapshot: %v", err)
+    }
+    return w.restore(&snap, gobDecode)
+}
+
+// a manifest asset held by its logical name, so components that use it save the name and find
+// the asset again after loading rather than saving a pointer. Kind is the manifest section:
+// "sprite", "atlas", "aseprite" or "font".
+type AssetRef struct {
+    Kind string `json:"kind"`
+    Name string `json:"name"`
+
+    value interface{}
+}
+
+func SpriteRef(name string) AssetRef   { return AssetRef{Kind: "sprite", Name: name} }
+func AtlasRef(name string) AssetRef    { return AssetRef{Kind: "atlas", Name: name} }
+func AsepriteRef(name string) AssetRef { return AssetRef{Kind: "aseprite", Name: name} }
+func FontRef(name string) AssetRef     { return AssetRef{Kind: "font", Name: name} }
+
+// the asset from resources, looked up once and then cached; nil until loading has finished
+func (r *AssetRef) Get() interface{} {
+    if r.value == nil && resources != nil && r.Name != "" {
+        r.value = resources.loader.Get(manifestKey(r.Kind, r.Name))
+    }
+    return r.value
+}
+
+func (r *AssetRef) Picture() pixel.Picture {
+    pic, _ := r.Get().(pixel.Picture)
+    return pic
+}
+
+func (r *AssetRef) Atlas() *Atlas {
+    atlas, _ := r.Get().(*Atlas)
+    return atlas
+}
+
+func (r *AssetRef) Aseprite() *AsepriteSheet {
+    sheet, _ := r.Get().(*AsepriteSheet)
+    return sheet
+}
+
+func (r *AssetRef) Font() *Font {
+    f, _ := r.Get().(*Font)
+    return f
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+
+    "github.com/faiface/beep"
+    "github.com/faiface/pixel"
+)
+
+// a sound the game asks for by name, like "footstep", that plays one of several clips a little
+// differently each time, so repeats don't sound mechanical
+type SoundEvent struct {
+    Clips []string `json:"clips"`
+    // 0 to 1; 0 leaves it at 1
+    Volume float64 `json:"volume"`
+    // how far each play strays from Volume and from the recorded pitch, e.g. 0.1 for up to 10%
+    // either way
+    VolumeVariance float64 `json:"volume_variance"`
+    PitchVariance  float64 `json:"pitch_variance"`
+    // never picks the clip that played last, when there's another
+    NoRepeat bool `json:"no_repeat"`
+}
+
+type soundEvent struct {
+    SoundEvent
+    last int
+}
+
+// names event so PlayEvent can play it, replacing one of the same name
+func (a *Audio) DefineEvent(name string, event SoundEvent) {
+    a.events[name] = &soundEvent{SoundEvent: event, last: -1}
+}
+
+// defines every event in a JSON asset of names to events, e.g. {"footstep": {"clips": [...]}}
+func (a *Audio) LoadEvents(name string) error {
+    data, err := ReadAsset(name)
+    if err != nil {
+        return err
+    }
+    var events map[string]SoundEvent
+    if err := json.Unmarshal(data, &events); err != nil {
+        return fmt.Errorf("%s: %v", name, err)
+    }
+    for event, e := range events {
+        if len(e.Clips) == 0 {
+            return fmt.Errorf("%s: %s has no clips", name, event)
+        }
+        a.DefineEvent(event, e)
+    }
+    return nil
+}
+
+// plays one of the event's clips with its variation, logging rather than failing when the event
+// or its clip is missing, like PlayFile
+func (a *Audio) PlayEvent(name string) *Playback {
+    stream, ok := a.event(name)
+    if !ok {
+        return nil
+    }
+    p := &Playback{audio: a}
+    a.start(p, BusEffects, stream)
+    return p
+}
+
+// plays the event from pos in the world, like PlayAt
+func (a *Audio) PlayEventAt(name string, pos pixel.Vec) *Playback {
+    stream, ok := a.event(name)
+    if !ok {
+        return nil
+    }
+    return a.playAt(stream, pos)
+}
+
+// picks the event's clip and varies it
+func (a *Audio) event(name string) (beep.Streamer, bool) {
+    e, ok := a.events[name]
+    if !ok || len(e.Clips) == 0 {
+        audioLog.Warnf("no sound event %q", name)
+        return nil, false
+    }
+    i := a.rng.Intn(len(e.Clips))
+    if e.NoRepeat && len(e.Clips) > 1 && i == e.last {
+        i = (i + 1 + a.rng.Intn(len(e.Clips)-1)) % len(e.Clips)
+    }
+    e.last = i
+    s, err := a.Sound(e.Clips[i])
+    if err != nil {
+        audioLog.Warnf("%v", err)
+        return nil, false
+    }
+    volume := e.Volume
+    if volume <= 0 {
+        volume = 1
+    }
+    volume *= 1 + e.VolumeVariance*(a.rng.Float64()*2-1)
+    var stream beep.Streamer = &gainStreamer{streamer: s.buffer.Streamer(0, s.buffer.Len()), gain: volume}
+    if e.PitchVariance > 0 {
+        // played faster sounds higher, and slower lower
+        stream = beep.ResampleRatio(4, 1+e.PitchVariance*(a.rng.Float64()*2-1), stream)
+    }
+    return stream, true
+}
+
+// plays the event called name, or the sound file at name when no event is, e.g. for sounds named
+// in data files
+func (a *Audio) PlaySound(name string) *Playback {
+    if _, ok := a.events[name]; ok {
+        return a.PlayEvent(name)
+    }
+    return a.PlayFile(name)
+}
+
+func (a *Audio) PlaySoundAt(name string, pos pixel.Vec) *Playback {
+    if _, ok := a.events[name]; ok {
+        return a.PlayEventAt(name, pos)
+    }
+    return a.PlayFileAt(name, pos)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+    "math"
+    "sort"
+
+    "github.com/faiface/pixel"
+)
+
+// the default SpatialHash cell size in world units; about the size of the typical entity, or a
+// little bigger, keeps the cells short
+const SPATIALCELL = 64
+
+type spatialCell struct {
+    x, y int
+}
+
+// a uniform grid of entity bounds, so asking what's near a spot only looks at the cells around it
+// rather than every entity: collision's broadphase, camera culling and proximity checks all go
+// through one. results come back in entity order, the same run to run.
+type SpatialHash struct {
+    CellSize float64
+
+    cells  map[spatialCell][]Entity
+    bounds map[Entity]pixel.Rect
+}
+
+func NewSpatialHash(cellSize float64) *SpatialHash {
+    if cellSize <= 0 {
+        cellSize = SPATIALCELL
+    }
+    return &SpatialHash{CellSize: cellSize, cells: make(map[spatialCell][]Entity), bounds: make(map[Entity]pixel.Rect)}
+}
+
+func (h *SpatialHash) cellRange(r pixel.Rect) (x0, y0, x1, y1 int) {
+    return int(math.Floor(r.Min.X / h.CellSize)), int(math.Floor(r.Min.Y / h.CellSize)),
+        int(math.Floor(r.Max.X / h.CellSize)), int(math.Floor(r.Max.Y / h.CellSize))
+}
+
+// puts e in the hash with bounds r, or moves it there
+func (h *SpatialHash) Set(e Entity, r pixel.Rect) {
+    r = r.Norm()
+    if old, ok := h.bounds[e]; ok {
+        ox0, oy0, ox1, oy1 := h.cellRange(old)
+        x0, y0, x1, y1 := h.cellRange(r)
+        if ox0 == x0 && oy0 == y0 && ox1 == x1 && oy1 == y1 {
+            h.bounds[e] = r
+            return
+        }
+        h.Remove(e)
+    }
+    h.bounds[e] = r
+    x0, y0, x1, y1 := h.cellRange(r)
+    for x := x0; x <= x1; x++ {
+        for y := y0; y <= y1; y++ {
+            cell := spatialCell{x, y}
+            h.cells[cell] = append(h.cells[cell], e)
+        }
+    }
+}
+
+func (h *SpatialHash) Remove(e Entity) {
+    r, ok := h.bounds[e]
+    if !ok {
+        return
+    }
+    delete(h.bounds, e)
+    x0, y0, x1, y1 := h.cellRange(r)
+    for x := x0; x <= x1; x++ {
+        for y := y0; y <= y1; y++ {
+            cell := spatialCell{x, y}
+            entities := h.cells[cell]
+            for i, other := range entities {
+                if other == e {
+                    entities = append(entities[:i], entities[i+1:]...)
+                    break
+                }
+            }
+            if len(entities) == 0 {
+                delete(h.cells, cell)
+            } else {
+                h.cells[cell] = entities
+            }
+        }
+    }
+}
+
+// e's bounds, if it's in the hash
+func (h *SpatialHash) Bounds(e Entity) (pixel.Rect, bool) {
+    r, ok := h.bounds[e]
+    return r, ok
+}
+
+func (h *SpatialHash) Len() int {
+    return len(h.bounds)
+}
+
+// every entity in the hash, in entity order
+func (h *SpatialHash) Entities() []Entity {
+    entities := make([]Entity, 0, len(h.bounds))
+    for e := range h.bounds {
+        entities = append(entities, e)
+    }
+    sortEntities(entities)
+    return entities
+}
+
+// the cells with anything in them, in world space
+func (h *SpatialHash) Cells() []pixel.Rect {
+    cells := make([]pixel.Rect, 0, len(h.cells))
+    for cell := range h.cells {
+        corner := pixel.V(float64(cell.x), float64(cell.y)).Scaled(h.CellSize)
+        cells = append(cells, pixel.Rect{Min: corner, Max: corner.Add(pixel.V(h.CellSize, h.CellSize))})
+    }
+    return cells
+}
+
+func (h *SpatialHash) Clear() {
+    h.cells = make(map[spatialCell][]Entity)
+    h.bounds = make(map[Entity]pixel.Rect)
+}
+
+// the entities whose bounds overlap r, edges included, in entity order; e.g.
+// Query(camera.VisibleRect()) for what's worth drawing
+func (h *SpatialHash) Query(r pixel.Rect) []Entity {
+    r = r.Norm()
+    return h.collect(r, func(bounds pixel.Rect) bool { return bounds.Intersects(r) })
+}
+
+// the entities whose bounds contain p
+func (h *SpatialHash) QueryPoint(p pixel.Vec) []Entity {
+    return h.collect(pixel.Rect{Min: p, Max: p}, func(bounds pixel.Rect) bool { return bounds.Contains(p) })
+}
+
+// the entities whose bounds come within radius of center, e.g. enemies that hear a noise
+func (h *SpatialHash) QueryRadius(center pixel.Vec, radius float64) []Entity {
+    around := pixel.Rect{Min: center.Sub(pixel.V(radius, radius)), Max: center.Add(pixel.V(radius, radius))}
+    return h.collect(around, func(bounds pixel.Rect) bool { return rectDistance(bounds, center) <= radius })
+}
+
+func (h *SpatialHash) collect(area pixel.Rect, keep func(pixel.Rect) bool) []Entity {
+    var found []Entity
+    seen := make(map[Entity]bool)
+    x0, y0, x1, y1 := h.cellRange(area)
+    for x := x0; x <= x1; x++ {
+        for y := y0; y <= y1; y++ {
+            for _, e := range h.cells[spatialCell{x, y}] {
+                if seen[e] {
+                    continue
+                }
+                seen[e] = true
+                if keep(h.bounds[e]) {
+                    found = append(found, e)
+                }
+            }
+        }
+    }
+    sortEntities(found)
+    return found
+}
+
+// calls fn once for every two entities whose bounds overlap, the lower numbered one first, in a
+// set order; the broadphase for collision
+func (h *SpatialHash) Pairs(fn func(a, b Entity)) {
+    var pairs [][2]Entity
+    for cell, entities := range h.cells {
+        for i, a := range entities {
+            ra := h.bounds[a]
+            for _, b := range entities[i+1:] {
+                rb := h.bounds[b]
+                if !ra.Intersects(rb) {
+                    continue
+                }
+                // a pair sharing several cells is counted in the first of them only
+                x, y, _, _ := h.cellRange(pixel.Rect{Min: pixel.V(math.Max(ra.Min.X, rb.Min.X), math.Max(ra.Min.Y, rb.Min.Y))})
+                if (spatialCell{x, y}) != cell {
+                    continue
+                }
+                if a.index() < b.index() {
+                    pairs = append(pairs, [2]Entity{a, b})
+                } else {
+                    pairs = append(pairs, [2]Entity{b, a})
+                }
+            }
+        }
+    }
+    sort.Slice(pairs, func(i, j int) bool {
+        if pairs[i][0] != pairs[j][0] {
+            return pairs[i][0].index() < pairs[j][0].index()
+        }
+        return pairs[i][1].index() < pairs[j][1].index()
+    })
+    for _, pair := range pairs {
+        fn(pair[0], pair[1])
+    }
+}
+
+// how far p is from the closest point of r, 0 inside it
+func rectDistance(r pixel.Rect, p pixel.Vec) float64 {
+    dx := math.Max(math.Max(r.Min.X-p.X, 0), p.X-r.Max.X)
+    dy := math.Max(math.Max(r.Min.Y-p.Y, 0), p.Y-r.Max.Y)
+    return math.Hypot(dx, dy)
+}
+
+// in World.Query's order, by slot
+func sortEntities(entities []Entity) {
+    sort.Slice(entities, func(i, j int) bool { return entities[i].index() < entities[j].index() })
+}
@@ -0,0 +1,31 @@
+//go:build speaker
+// +build speaker
+
+package main
+
+import (
+    "time"
+
+    "github.com/faiface/beep"
+    "github.com/faiface/beep/speaker"
+)
+
+// plays through the sound card; beep's speaker needs ALSA's headers to build on Linux, so it's
+// only in builds with the speaker tag, which the Makefile sets
+type speakerDevice struct{}
+
+func init() {
+    newAudioDevice = func() AudioDevice { return speakerDevice{} }
+}
+
+func (speakerDevice) Start(rate beep.SampleRate, latency time.Duration, mix beep.Streamer) error {
+    if err := speaker.Init(rate, rate.N(latency)); err != nil {
+        return err
+    }
+    speaker.Play(mix)
+    return nil
+}
+
+func (speakerDevice) Close() {
+    speaker.Close()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+    "fmt"
+    "math"
+
+    "github.com/faiface/pixel"
+)
+
+// slices a picture into indexed sprite frames
+type SpriteSheet struct {
+    picture pixel.Picture
+    frames  []pixel.Rect
+    sprites []*pixel.Sprite
+}
+
+// cuts the picture into a grid of cellW x cellH frames, indexed left to right and top to bottom
+func NewSpriteSheet(pic pixel.Picture, cellW, cellH float64) (*SpriteSheet, error) {
+    if cellW <= 0 || cellH <= 0 {
+        return nil, fmt.Errorf("spritesheet: invalid cell size %vx%v", cellW, cellH)
+    }
+
+    bounds := pic.Bounds()
+    cols := int(math.Floor(bounds.W() / cellW))
+    rows := int(math.Floor(bounds.H() / cellH))
+    if cols == 0 || rows == 0 {
+        return nil, fmt.Errorf("spritesheet: cell size %vx%v larger than picture %vx%v", cellW, cellH, bounds.W(), bounds.H())
+    }
+
+    var frames []pixel.Rect
+    // pixel's Y axis points up, but sheets are read top row first
+    for row := 0; row < rows; row++ {
+        maxY := bounds.Max.Y - float64(row)*cellH
+        for col := 0; col < cols; col++ {
+            minX := bounds.Min.X + float64(col)*cellW
+            frames = append(frames, pixel.R(minX, maxY-cellH, minX+cellW, maxY))
+        }
+    }
+
+    return NewSpriteSheetRects(pic, frames)
+}
+
+// uses an explicit list of frame bounds, for sheets with irregular frames
+func NewSpriteSheetRects(pic pixel.Picture, frames []pixel.Rect) (*SpriteSheet, error) {
+    bounds := pic.Bounds()
+    sheet := &SpriteSheet{picture: pic}
+    for i, frame := range frames {
+        if bounds.Intersect(frame) != frame {
+            return nil, fmt.Errorf("spritesheet: frame %d %v outside picture bounds %v", i, frame, bounds)
+        }
+        sheet.frames = append(sheet.frames, frame)
+        sheet.sprites = append(sheet.sprites, pixel.NewSprite(pic, frame))
+    }
+    return sheet, nil
+}
+
+func (s *SpriteSheet) Picture() pixel.Picture {
+    return s.picture
+}
+
+func (s *SpriteSheet) Len() int {
+    return len(s.sprites)
+}
+
+// returns the sprite for frame i, panicking if i is out of range like a slice index would
+func (s *SpriteSheet) Sprite(i int) *pixel.Sprite {
+    return s.sprites[i]
+}
+
+func (s *SpriteSheet) Frame(i int) pixel.Rect {
+    return s.frames[i]
+}
+
+func (s *SpriteSheet) Sprites() []*pixel.Sprite {
+    return s.sprites
+}
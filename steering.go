@@ -0,0 +1,402 @@
+package main
+
+import (
+    "math"
+    "math/rand"
+
+    "github.com/faiface/pixel"
+)
+
+// seconds a behavior asks to take to reach the velocity it wants; shorter turns sharper, up to
+// MaxForce
+const STEERRESPONSE = 0.1
+
+// what a steering behavior knows about the agent it steers
+type SteeringAgent struct {
+    Position, Velocity pixel.Vec
+    // how fast it can go, and how hard it can speed up or turn, per second
+    MaxSpeed, MaxForce float64
+    // the agent's entity, so flocking and avoidance can leave it out; zero outside a World
+    Entity Entity
+}
+
+// the way the agent should speed up, per second per second. behaviors ask for as much as they
+// like; BlendSteering caps the total at MaxForce.
+type SteeringBehavior interface {
+    Steer(a SteeringAgent) pixel.Vec
+}
+
+// a behavior and how much it counts in a blend
+type WeightedSteering struct {
+    Behavior SteeringBehavior
+    Weight   float64
+}
+
+// the weighted sum of behaviors, capped at a.MaxForce. weights are in the agent's own terms: an
+// avoidance of 3 beside a seek of 1 keeps it off the walls even while it's chasing something.
+func BlendSteering(a SteeringAgent, behaviors ...WeightedSteering) pixel.Vec {
+    var total pixel.Vec
+    for _, b := range behaviors {
+        total = total.Add(b.Behavior.Steer(a).Scaled(b.Weight))
+    }
+    return truncate(total, a.MaxForce)
+}
+
+// v, shortened to max if it's longer
+func truncate(v pixel.Vec, max float64) pixel.Vec {
+    if l := v.Len(); l > max && l > 0 {
+        return v.Scaled(max / l)
+    }
+    return v
+}
+
+// the push that turns velocity into desired within STEERRESPONSE, the basic step of every
+// behavior here
+func steerToward(a SteeringAgent, desired pixel.Vec) pixel.Vec {
+    return truncate(desired.Sub(a.Velocity).Scaled(1/STEERRESPONSE), a.MaxForce)
+}
+
+// heads straight for Target at full speed, overshooting it
+type SteerSeek struct {
+    Target pixel.Vec
+}
+
+func (s *SteerSeek) Steer(a SteeringAgent) pixel.Vec {
+    to := s.Target.Sub(a.Position)
+    if to == pixel.ZV {
+        return pixel.ZV
+    }
+    return steerToward(a, to.Unit().Scaled(a.MaxSpeed))
+}
+
+// runs straight away from From while it's within Radius, or always when Radius is 0
+type SteerFlee struct {
+    From   pixel.Vec
+    Radius float64
+}
+
+func (s *SteerFlee) Steer(a SteeringAgent) pixel.Vec {
+    away := a.Position.Sub(s.From)
+    if away == pixel.ZV || (s.Radius > 0 && away.Len() > s.Radius) {
+        return pixel.ZV
+    }
+    return steerToward(a, away.Unit().Scaled(a.MaxSpeed))
+}
+
+// seeks Target but slows down over the last Slowing world units, stopping on it
+type SteerArrive struct {
+    Target  pixel.Vec
+    Slowing float64
+}
+
+func (s *SteerArrive) Steer(a SteeringAgent) pixel.Vec {
+    to := s.Target.Sub(a.Position)
+    dist := to.Len()
+    if dist < 1e-6 {
+        return steerToward(a, pixel.ZV)
+    }
+    speed := a.MaxSpeed
+    if dist < s.Slowing {
+        speed *= dist / s.Slowing
+    }
+    return steerToward(a, to.Scaled(speed/dist))
+}
+
+// meanders: it seeks a point on a circle Distance ahead of the agent, which drifts around the
+// circle by up to Jitter radians each time it steers. Rand is the "ai" stream when nil, so a
+// seeded run wanders the same way.
+type SteerWander struct {
+    Distance, Radius, Jitter float64
+    Rand                     *rand.Rand
+
+    angle float64
+}
+
+func NewSteerWander() *SteerWander {
+    return &SteerWander{Distance: 40, Radius: 20, Jitter: 0.1}
+}
+
+func (s *SteerWander) Steer(a SteeringAgent) pixel.Vec {
+    r := s.Rand
+    if r == nil {
+        r = rng.Stream("ai")
+    }
+    s.angle += (r.Float64()*2 - 1) * s.Jitter
+    heading := pixel.V(1, 0)
+    if a.Velocity != pixel.ZV {
+        heading = a.Velocity.Unit()
+    }
+    target := a.Position.Add(heading.Scaled(s.Distance)).Add(pixel.Unit(heading.Angle() + s.angle).Scaled(s.Radius))
+    return (&SteerSeek{Target: target}).Steer(a)
+}
+
+// seeks where a moving target will be by the time it gets there, looking at most Lookahead
+// seconds ahead, or as far as it takes when 0
+type SteerPursue struct {
+    Target, TargetVelocity pixel.Vec
+    Lookahead              float64
+}
+
+func (s *SteerPursue) Steer(a SteeringAgent) pixel.Vec {
+    return (&SteerSeek{Target: predict(a, s.Target, s.TargetVelocity, s.Lookahead)}).Steer(a)
+}
+
+// flees where a moving threat will be, within Radius of where it is now, or always when 0
+type SteerEvade struct {
+    Threat, ThreatVelocity pixel.Vec
+    Lookahead, Radius      float64
+}
+
+func (s *SteerEvade) Steer(a SteeringAgent) pixel.Vec {
+    if s.Radius > 0 && a.Position.Sub(s.Threat).Len() > s.Radius {
+        return pixel.ZV
+    }
+    return (&SteerFlee{From: predict(a, s.Threat, s.ThreatVelocity, s.Lookahead)}).Steer(a)
+}
+
+// where something at pos going at vel will be once a could reach it
+func predict(a SteeringAgent, pos, vel pixel.Vec, lookahead float64) pixel.Vec {
+    if a.MaxSpeed <= 0 {
+        return pos
+    }
+    t := pos.Sub(a.Position).Len() / a.MaxSpeed
+    if lookahead > 0 {
+        t = math.Min(t, lookahead)
+    }
+    return pos.Add(vel.Scaled(t))
+}
+
+// boids: keeps apart from, lines up with and stays together with the other steering agents within
+// Radius on one of Mask's collision layers, each by its weight. the agents need a Collider, and
+// the neighbours' Steering components say how they're moving.
+type SteerFlock struct {
+    Radius float64
+    // zero means COLLIDEALL, like a Collider's
+    Mask uint32
+    // 1.5, 1 and 1 when all three are 0
+    Separation, Alignment, Cohesion float64
+}
+
+func (s *SteerFlock) Steer(a SteeringAgent) pixel.Vec {
+    w := collision.World
+    if w == nil {
+        return pixel.ZV
+    }
+    separation, alignment, cohesion := s.Separation, s.Alignment, s.Cohesion
+    if separation == 0 && alignment == 0 && cohesion == 0 {
+        separation, alignment, cohesion = 1.5, 1, 1
+    }
+    var away, heading, center pixel.Vec
+    n := 0
+    for _, e := range collision.Near(a.Position, s.Radius, steeringMask(s.Mask)) {
+        other, ok := w.Get(e, SteeringType).(*Steering)
+        if e == a.Entity || !ok {
+            continue
+        }
+        pos := w.Get(e, TransformType).(*Transform).Position
+        // pushed away harder the closer it is
+        if d := a.Position.Sub(pos); d != pixel.ZV {
+            away = away.Add(d.Scaled(1 / (d.Len() * d.Len())))
+        }
+        heading = heading.Add(other.Velocity)
+        center = center.Add(pos)
+        n++
+    }
+    if n == 0 {
+        return pixel.ZV
+    }
+    var force pixel.Vec
+    if away != pixel.ZV {
+        force = force.Add(steerToward(a, away.Unit().Scaled(a.MaxSpeed)).Scaled(separation))
+    }
+    if heading != pixel.ZV {
+        force = force.Add(steerToward(a, heading.Unit().Scaled(a.MaxSpeed)).Scaled(alignment))
+    }
+    force = force.Add((&SteerSeek{Target: center.Scaled(1 / float64(n))}).Steer(a).Scaled(cohesion))
+    return force
+}
+
+// turns away from colliders and solid tiles on Mask's layers ahead of the agent, and brakes the
+// closer they are. it feels Lookahead seconds of travel ahead from its centre and from either
+// side of it, Radius out, and half that at an angle. triggers don't count. it only gets round
+// what's in the way; a wall between the agent and where it's going wants a path.
+type SteerAvoid struct {
+    Lookahead float64
+    // half the agent's width; 0 takes it from its Collider
+    Radius float64
+    // zero means COLLIDEALL
+    Mask uint32
+}
+
+func steeringMask(mask uint32) uint32 {
+    if mask == 0 {
+        return COLLIDEALL
+    }
+    return mask
+}
+
+func (s *SteerAvoid) radius(a SteeringAgent) float64 {
+    if s.Radius > 0 || collision.World == nil {
+        return s.Radius
+    }
+    c, ok := collision.World.Get(a.Entity, ColliderType).(*Collider)
+    if !ok {
+        return 0
+    }
+    if c.Shape == ShapeCircle {
+        return c.Radius
+    }
+    return math.Max(c.Size.X, c.Size.Y) / 2
+}
+
+func (s *SteerAvoid) Steer(a SteeringAgent) pixel.Vec {
+    speed := a.Velocity.Len()
+    if speed == 0 {
+        return pixel.ZV
+    }
+    reach := speed * s.Lookahead
+    heading := a.Velocity.Unit()
+    left := heading.Normal().Scaled(s.radius(a))
+    feelers := []struct {
+        from          pixel.Vec
+        angle, length float64
+        // which side of the agent it's on
+        side float64
+    }{
+        {a.Position, 0, 1, 0},
+        {a.Position.Add(left), 0, 1, 1},
+        {a.Position.Sub(left), 0, 1, -1},
+        {a.Position, math.Pi / 6, 0.5, 1},
+        {a.Position, -math.Pi / 6, 0.5, -1},
+    }
+    // a wall straight ahead is turned from toward the side that's clearer
+    lean := 0.0
+    type feelerHit struct {
+        hit    RayHit
+        length float64
+    }
+    var hits []feelerHit
+    for _, f := range feelers {
+        length := reach * f.length
+        if hit, ok := s.hit(a, f.from, f.from.Add(heading.Rotated(f.angle).Scaled(length))); ok {
+            lean -= f.side * (1 - hit.Distance/length)
+            hits = append(hits, feelerHit{hit, length})
+        }
+    }
+    var force pixel.Vec
+    for _, h := range hits {
+        // the push grows as the wall gets closer
+        closeness := 1 - h.hit.Distance/h.length
+        side := h.hit.Normal.Sub(heading.Scaled(h.hit.Normal.Dot(heading)))
+        if side.Len() < 0.1 {
+            side = heading.Normal()
+            if lean < 0 {
+                side = side.Scaled(-1)
+            }
+        }
+        force = force.Add(side.Unit().Add(h.hit.Normal).Scaled(a.MaxForce * closeness))
+    }
+    return force
+}
+
+// the nearest thing along the feeler that isn't the agent itself or a trigger
+func (s *SteerAvoid) hit(a SteeringAgent, from, to pixel.Vec) (RayHit, bool) {
+    for _, hit := range collision.RaycastAll(from, to, steeringMask(s.Mask)) {
+        if hit.Normal == pixel.ZV {
+            continue
+        }
+        if hit.Tiles == nil {
+            if hit.Entity == a.Entity {
+                continue
+            }
+            if c, ok := collision.World.Get(hit.Entity, ColliderType).(*Collider); ok && c.Trigger {
+                continue
+            }
+        }
+        return hit, true
+    }
+    return RayHit{}, false
+}
+
+// an entity that moves by blending steering behaviors. SteeringSystem moves it each tick: through
+// its RigidBody when physics is running one, otherwise by its own Velocity, through collision when
+// it has a Collider. for a TopDown mover, feed it Input instead.
+type Steering struct {
+    MaxSpeed, MaxForce float64
+    Behaviors          []WeightedSteering
+    // turns the Transform to face the way it's going
+    Face bool
+
+    Velocity pixel.Vec
+    // what the behaviors asked for last tick
+    Acceleration pixel.Vec
+}
+
+var SteeringType = ComponentTypeOf((*Steering)(nil))
+
+func NewSteering(maxSpeed, maxForce float64, behaviors ...WeightedSteering) *Steering {
+    return &Steering{MaxSpeed: maxSpeed, MaxForce: maxForce, Behaviors: behaviors}
+}
+
+func (s *Steering) agent(e Entity, pos pixel.Vec) SteeringAgent {
+    return SteeringAgent{Position: pos, Velocity: s.Velocity, MaxSpeed: s.MaxSpeed, MaxForce: s.MaxForce, Entity: e}
+}
+
+// the blend for e at pos, kept in Acceleration
+func (s *Steering) Steer(e Entity, pos pixel.Vec) pixel.Vec {
+    s.Acceleration = BlendSteering(s.agent(e, pos), s.Behaviors...)
+    return s.Acceleration
+}
+
+// the Velocity after accelerating by Acceleration for dt seconds, within MaxSpeed
+func (s *Steering) Integrate(dt float64) pixel.Vec {
+    s.Velocity = truncate(s.Velocity.Add(s.Acceleration.Scaled(dt)), s.MaxSpeed)
+    return s.Velocity
+}
+
+// Velocity as a TopDown move, up to length 1, after integrating; give the TopDown the same Speed
+// as MaxSpeed
+func (s *Steering) Input(dt float64) pixel.Vec {
+    if s.MaxSpeed <= 0 {
+        return pixel.ZV
+    }
+    return s.Integrate(dt).Scaled(1 / s.MaxSpeed)
+}
+
+// moves every entity with a Steering and a Transform, e.g.
+// world.AddSystem("steering", 0, SteeringSystem()). it runs with the World, which the game
+// updates before collision and physics step.
+func SteeringSystem() System {
+    return SystemFunc(func(w *World, dt float64) {
+        w.Each(func(e Entity) {
+            s := w.Get(e, SteeringType).(*Steering)
+            t := w.Get(e, TransformType).(*Transform)
+            if body := physics.Body(e); body != nil && physics.Active() {
+                s.Velocity = body.Velocity()
+                accel := s.Steer(e, body.Position())
+                mass := 1.0
+                if rb, ok := w.Get(e, RigidBodyType).(*RigidBody); ok {
+                    mass = rb.Mass()
+                }
+                body.ApplyForce(accel.Scaled(mass), body.Position())
+                // forces can't hold it to MaxSpeed, so it's clamped straight
+                if v := body.Velocity(); v.Len() > s.MaxSpeed {
+                    body.SetVelocity(truncate(v, s.MaxSpeed))
+                }
+            } else {
+                s.Steer(e, t.Position)
+                step := s.Integrate(dt).Scaled(dt)
+                if w.Has(e, ColliderType) && collision.World == w && dt > 0 {
+                    // what a wall stopped doesn't carry over into the next tick
+                    moved, _ := collision.MoveAndCollide(e, step)
+                    s.Velocity = moved.Scaled(1 / dt)
+                } else {
+                    t.Position = t.Position.Add(step)
+                }
+            }
+            if s.Face && s.Velocity.Len() > 1e-6 {
+                t.Rotation = s.Velocity.Angle()
+            }
+        }, SteeringType, TransformType)
+    })
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+    "fmt"
+    "image"
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/srwiley/oksvg"
+    "github.com/srwiley/rasterx"
+)
+
+// rasterizes an SVG at scale times its viewBox size, so UI art can be re-rendered sharp
+// whenever the window or UI scale changes
+func LoadSVG(path string, scale float64) (*pixel.PictureData, error) {
+    if scale <= 0 {
+        return nil, fmt.Errorf("%s: invalid svg scale %v", path, scale)
+    }
+
+    file, err := OpenAsset(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    icon, err := oksvg.ReadIconStream(file)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+
+    w := int(math.Ceil(icon.ViewBox.W * scale))
+    h := int(math.Ceil(icon.ViewBox.H * scale))
+    if w <= 0 || h <= 0 {
+        return nil, fmt.Errorf("%s: svg has an empty viewBox", path)
+    }
+    return rasterizeSVG(icon, w, h), nil
+}
+
+// rasterizes an SVG stretched to exactly w x h pixels
+func LoadSVGSize(path string, w, h int) (*pixel.PictureData, error) {
+    if w <= 0 || h <= 0 {
+        return nil, fmt.Errorf("%s: invalid svg size %dx%d", path, w, h)
+    }
+
+    file, err := OpenAsset(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    icon, err := oksvg.ReadIconStream(file)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    return rasterizeSVG(icon, w, h), nil
+}
+
+func rasterizeSVG(icon *oksvg.SvgIcon, w, h int) *pixel.PictureData {
+    icon.SetTarget(0, 0, float64(w), float64(h))
+    img := image.NewRGBA(image.Rect(0, 0, w, h))
+    scanner := rasterx.NewScannerGV(w, h, img, img.Bounds())
+    icon.Draw(rasterx.NewDasher(w, h, scanner), 1)
+    return pixel.PictureDataFromImage(img)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+    "math"
+    "sort"
+
+    "github.com/faiface/pixel"
+)
+
+// where a moving collider first touches another
+type SweepHit struct {
+    Entity Entity
+    // how far along the move it touches, 0 to 1, and where its Transform is then
+    Time     float64
+    Position pixel.Vec
+    // the face it touches, pointing back at the mover
+    Normal  pixel.Vec
+    Trigger bool
+}
+
+// how close two faces have to be to count as touching, for moves the sweep stopped flush
+const SWEEPTOUCH = 1e-9
+
+// when, 0 to 1, box moving by delta first touches target, and target's face it touches. boxes
+// that already overlap don't count, Penetration covers those; one already touching target hits
+// at 0 if it's moving into it, so a move stopped flush against a wall can't go through next time.
+func SweepRect(box pixel.Rect, delta pixel.Vec, target pixel.Rect) (float64, pixel.Vec, bool) {
+    if delta == pixel.ZV {
+        return 0, pixel.ZV, false
+    }
+    if normal := touchingFace(box, target); normal != pixel.ZV {
+        if delta.Dot(normal) < 0 {
+            return 0, normal, true
+        }
+        return 0, pixel.ZV, false
+    }
+    if box.Intersects(target) {
+        return 0, pixel.ZV, false
+    }
+    // a point sweeping against target grown by half the box is the same test, and a ray
+    half := box.Size().Scaled(0.5)
+    grown := pixel.Rect{Min: target.Min.Sub(half), Max: target.Max.Add(half)}
+    from := box.Center()
+    t, normal, ok := segmentRect(from, from.Add(delta), grown)
+    // starting inside the grown box is rounding on boxes that touch
+    if !ok || normal == pixel.ZV {
+        return 0, pixel.ZV, false
+    }
+    return t, normal, true
+}
+
+// the face of target that box rests against, pointing at box, or zero when they don't share one;
+// corners alone don't count
+func touchingFace(box, target pixel.Rect) pixel.Vec {
+    alongY := box.Min.Y < target.Max.Y && target.Min.Y < box.Max.Y
+    alongX := box.Min.X < target.Max.X && target.Min.X < box.Max.X
+    switch {
+    case alongY && math.Abs(box.Max.X-target.Min.X) <= SWEEPTOUCH:
+        return pixel.V(-1, 0)
+    case alongY && math.Abs(box.Min.X-target.Max.X) <= SWEEPTOUCH:
+        return pixel.V(1, 0)
+    case alongX && math.Abs(box.Max.Y-target.Min.Y) <= SWEEPTOUCH:
+        return pixel.V(0, -1)
+    case alongX && math.Abs(box.Min.Y-target.Max.Y) <= SWEEPTOUCH:
+        return pixel.V(0, 1)
+    }
+    return pixel.ZV
+}
+
+// the first collider e would touch moving by delta, on layers e's collider hits, triggers
+// included; for bullets and anything else fast enough to skip past a wall in one step. circles and
+// polygons sweep as their bounding boxes.
+func (c *Collisions) Sweep(e Entity, delta pixel.Vec) (SweepHit, bool) {
+    hits := c.sweep(e, delta, false)
+    if len(hits) == 0 {
+        return SweepHit{}, false
+    }
+    return hits[0], true
+}
+
+// everything e would touch moving by delta, soonest first, e.g. for a piercing shot
+func (c *Collisions) SweepAll(e Entity, delta pixel.Vec) []SweepHit {
+    return c.sweep(e, delta, false)
+}
+
+func (c *Collisions) sweep(e Entity, delta pixel.Vec, solid bool) []SweepHit {
+    own, ok := c.Shape(e)
+    if !ok || delta == pixel.ZV {
+        return nil
+    }
+    box := own.Rect
+    c.refresh()
+    col := c.World.Get(e, ColliderType).(*Collider)
+    pos := c.World.Get(e, TransformType).(*Transform).Position
+    moved := pixel.Rect{Min: box.Min.Add(delta), Max: box.Max.Add(delta)}
+    var hits []SweepHit
+    for _, other := range c.Index.Query(box.Union(moved)) {
+        if other == e {
+            continue
+        }
+        shape, ok := c.Shape(other)
+        if !ok {
+            continue
+        }
+        target := shape.Rect
+        oc := c.World.Get(other, ColliderType).(*Collider)
+        if !col.Hits(oc) || (solid && oc.Trigger) {
+            continue
+        }
+        // circles and polygons sweep as their bounds, which is too rough to stop a move on, so
+        // MoveAndCollide leaves them to its overlap test
+        if solid && (own.Kind != ShapeBox || shape.Kind != ShapeBox) {
+            continue
+        }
+        t, normal, ok := SweepRect(box, delta, target)
+        if !ok {
+            continue
+        }
+        // one-way platforms only stop things landing on them
+        if oc.OneWay && (normal.Y <= 0 || box.Min.Y < target.Max.Y-ONEWAYSLOP) {
+            continue
+        }
+        hits = append(hits, SweepHit{Entity: other, Time: t, Position: pos.Add(delta.Scaled(t)), Normal: normal, Trigger: col.Trigger || oc.Trigger})
+    }
+    sort.SliceStable(hits, func(i, j int) bool { return hits[i].Time < hits[j].Time })
+    return hits
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+    "image/color"
+    "math"
+    "unicode"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+    "golang.org/x/image/colornames"
+)
+
+// seconds the caret spends on and then off
+const CARETBLINK = 0.53
+
+// space between a text field's edge and its text, in pixels
+const TEXTFIELDPADDING = 4
+
+// a single line of editable text for name entry and chat boxes, with a caret, selection by Shift
+// or dragging, word jumps with Ctrl, clipboard shortcuts and repeat on held keys. it works in
+// runes, so anything an input method commits through Typed edits as whole characters; draw it
+// with a font that has them.
+type TextField struct {
+    // in virtual screen coordinates: where Draw puts it and where clicks focus it
+    Rect        pixel.Rect
+    Placeholder string
+    // the most runes it holds; 0 for no limit
+    MaxLength int
+    // runes it accepts, e.g. unicode.IsDigit; nil takes anything printable
+    Filter  func(r rune) bool
+    Focused bool
+    Font    *Font
+    Options TextOptions
+
+    runes []rune
+    // the caret, and the other end of the selection; equal when nothing is selected
+    cursor, anchor int
+    // the first rune shown, so the caret stays in view in a long line
+    first int
+    // an input method's text that isn't committed yet, see SetComposition
+    composition string
+    // when the caret last moved, so it shows straight away rather than mid-blink
+    moved    float64
+    dragging bool
+
+    onChange []func(text string)
+    onSubmit []func(text string)
+
+    imd *imdraw.IMDraw
+}
+
+func NewTextField(rect pixel.Rect) *TextField {
+    return &TextField{Rect: rect, Options: TextOptions{Size: FONTSIZE}, imd: imdraw.New(nil)}
+}
+
+// registers fn for every edit
+func (f *TextField) OnChange(fn func(text string)) {
+    f.onChange = append(f.onChange, fn)
+}
+
+// registers fn for Enter
+func (f *TextField) OnSubmit(fn func(text string)) {
+    f.onSubmit = append(f.onSubmit, fn)
+}
+
+func (f *TextField) Text() string {
+    return string(f.runes)
+}
+
+// replaces the text, caret at the end, without calling OnChange
+func (f *TextField) SetText(s string) {
+    f.runes = f.accept([]rune(s), f.MaxLength)
+    f.cursor, f.anchor, f.first = len(f.runes), len(f.runes), 0
+}
+
+// the selected text, or ""
+func (f *TextField) Selection() string {
+    lo, hi := f.selection()
+    return string(f.runes[lo:hi])
+}
+
+func (f *TextField) SelectAll() {
+    f.anchor, f.cursor = 0, len(f.runes)
+}
+
+// shows in-progress input method text at the caret without committing it, and holds the
+// editing keys back for the IME while there is some. GLFW doesn't report composition, so the
+// OS draws it in its own window and only the finished characters arrive through Typed; this is
+// for a platform layer that does report it.
+func (f *TextField) SetComposition(s string) {
+    f.composition = s
+}
+
+func (f *TextField) selection() (int, int) {
+    if f.anchor < f.cursor {
+        return f.anchor, f.cursor
+    }
+    return f.cursor, f.anchor
+}
+
+// the runes of rs the field takes, up to room of them when room is above zero
+func (f *TextField) accept(rs []rune, room int) []rune {
+    var kept []rune
+    for _, r := range rs {
+        if !unicode.IsPrint(r) || (f.Filter != nil && !f.Filter(r)) {
+            continue
+        }
+        if f.MaxLength > 0 && len(kept) >= room {
+            break
+        }
+        kept = append(kept, r)
+    }
+    return kept
+}
+
+// replaces the selection with s, as typing or pasting does
+func (f *TextField) Insert(s string) {
+    lo, hi := f.selection()
+    added := f.accept([]rune(s), f.MaxLength-(len(f.runes)-(hi-lo)))
+    if len(added) == 0 && lo == hi {
+        return
+    }
+    runes := append([]rune(nil), f.runes[:lo]...)
+    runes = append(runes, added...)
+    f.runes = append(runes, f.runes[hi:]...)
+    f.moveTo(lo+len(added), false)
+    f.changed()
+}
+
+func (f *TextField) changed() {
+    for _, fn := range f.onChange {
+        fn(f.Text())
+    }
+}
+
+// the start of the word before i, or the end of the word after it when forward
+func (f *TextField) wordBoundary(i int, forward bool) int {
+    if forward {
+        for i < len(f.runes) && unicode.IsSpace(f.runes[i]) {
+            i++
+        }
+        for i < len(f.runes) && !unicode.IsSpace(f.runes[i]) {
+            i++
+        }
+        return i
+    }
+    for i > 0 && unicode.IsSpace(f.runes[i-1]) {
+        i--
+    }
+    for i > 0 && !unicode.IsSpace(f.runes[i-1]) {
+        i--
+    }
+    return i
+}
+
+// moves the caret to i, dragging the selection along when extend
+func (f *TextField) moveTo(i int, extend bool) {
+    if i < 0 {
+        i = 0
+    }
+    if i > len(f.runes) {
+        i = len(f.runes)
+    }
+    f.cursor = i
+    if !extend {
+        f.anchor = i
+    }
+    f.moved = clock.UnscaledTotal()
+}
+
+// deletes the selection, or from the caret to i when there isn't one
+func (f *TextField) deleteTo(i int) {
+    lo, hi := f.selection()
+    if lo == hi {
+        lo, hi = f.cursor, i
+        if hi < lo {
+            lo, hi = hi, lo
+        }
+    }
+    if lo < 0 {
+        lo = 0
+    }
+    if hi > len(f.runes) {
+        hi = len(f.runes)
+    }
+    if lo == hi {
+        return
+    }
+    f.runes = append(f.runes[:lo:lo], f.runes[hi:]...)
+    f.moveTo(lo, false)
+    f.changed()
+}
+
+// handles clicks and, while Focused, typing and editing keys. returns whether the field has the
+// keyboard, so the caller can hand the rest of the frame BlockInput(in).
+func (f *TextField) Update(in Input) bool {
+    mouse := screen.MousePosition(in)
+    if in.JustPressed(pixelgl.MouseButtonLeft) {
+        f.Focused = f.Rect.Contains(mouse)
+        if f.Focused {
+            f.moveTo(f.runeAt(mouse.X), in.Pressed(pixelgl.KeyLeftShift) || in.Pressed(pixelgl.KeyRightShift))
+            f.dragging = true
+        }
+    }
+    if !in.Pressed(pixelgl.MouseButtonLeft) {
+        f.dragging = false
+    }
+    if f.dragging {
+        f.moveTo(f.runeAt(mouse.X), true)
+    }
+    if !f.Focused {
+        return false
+    }
+    if typed := in.Typed(); typed != "" {
+        f.Insert(typed)
+    }
+    if f.composition != "" {
+        return true
+    }
+
+    ctrl := in.Pressed(pixelgl.KeyLeftControl) || in.Pressed(pixelgl.KeyRightControl)
+    shift := in.Pressed(pixelgl.KeyLeftShift) || in.Pressed(pixelgl.KeyRightShift)
+    shortcut := shortcutHeld(in)
+    switch {
+    case shortcut && in.JustPressed(pixelgl.KeyA):
+        f.SelectAll()
+    case shortcut && (in.JustPressed(pixelgl.KeyC) || in.JustPressed(pixelgl.KeyX)):
+        if selected := f.Selection(); selected != "" {
+            SetClipboardText(selected)
+            if in.JustPressed(pixelgl.KeyX) {
+                f.deleteTo(f.cursor)
+            }
+        }
+    case shortcut && typing(in, pixelgl.KeyV):
+        f.Insert(clipboardLine())
+    case typing(in, pixelgl.KeyLeft):
+        lo, hi := f.selection()
+        switch {
+        case ctrl:
+            f.moveTo(f.wordBoundary(f.cursor, false), shift)
+        case lo != hi && !shift:
+            f.moveTo(lo, false)
+        default:
+            f.moveTo(f.cursor-1, shift)
+        }
+    case typing(in, pixelgl.KeyRight):
+        lo, hi := f.selection()
+        switch {
+        case ctrl:
+            f.moveTo(f.wordBoundary(f.cursor, true), shift)
+        case lo != hi && !shift:
+            f.moveTo(hi, false)
+        default:
+            f.moveTo(f.cursor+1, shift)
+        }
+    case in.JustPressed(pixelgl.KeyHome):
+        f.moveTo(0, shift)
+    case in.JustPressed(pixelgl.KeyEnd):
+        f.moveTo(len(f.runes), shift)
+    case typing(in, pixelgl.KeyBackspace):
+        if ctrl {
+            f.deleteTo(f.wordBoundary(f.cursor, false))
+        } else {
+            f.deleteTo(f.cursor - 1)
+        }
+    case typing(in, pixelgl.KeyDelete):
+        if ctrl {
+            f.deleteTo(f.wordBoundary(f.cursor, true))
+        } else {
+            f.deleteTo(f.cursor + 1)
+        }
+    case in.JustPressed(pixelgl.KeyEnter) || in.JustPressed(pixelgl.KeyKPEnter):
+        for _, fn := range f.onSubmit {
+            fn(f.Text())
+        }
+    case in.JustPressed(pixelgl.KeyEscape):
+        f.Focused = false
+    }
+    return f.Focused
+}
+
+func (f *TextField) font() *Font {
+    if f.Font == nil {
+        return DefaultFont()
+    }
+    return f.Font
+}
+
+// the caret position nearest x
+func (f *TextField) runeAt(x float64) int {
+    atlas, err := f.font().Atlas(f.Options.size())
+    if err != nil {
+        return f.cursor
+    }
+    left := f.Rect.Min.X + TEXTFIELDPADDING
+    for i := f.first; i < len(f.runes); i++ {
+        w := atlas.Glyph(f.runes[i]).Advance
+        if x < left+w/2 {
+            return i
+        }
+        left += w
+    }
+    return len(f.runes)
+}
+
+// scrolls so the caret is in view and returns the last rune that fits
+func (f *TextField) visible(width func(lo, hi int) float64) int {
+    inner := f.Rect.W() - 2*TEXTFIELDPADDING
+    if f.cursor < f.first {
+        f.first = f.cursor
+    }
+    for f.first < f.cursor && width(f.first, f.cursor) > inner {
+        f.first++
+    }
+    end := f.cursor
+    for end < len(f.runes) && width(f.first, end+1) <= inner {
+        end++
+    }
+    return end
+}
+
+// draws the box, the visible part of the text or the placeholder, the selection and the caret
+func (f *TextField) Draw(t pixel.Target) {
+    atlas, err := f.font().Atlas(f.Options.size())
+    if err != nil {
+        return
+    }
+    width := func(lo, hi int) float64 { return textWidth(atlas, string(f.runes[lo:hi])) }
+    end := f.visible(width)
+    left := f.Rect.Min.X + TEXTFIELDPADDING
+    baseline := f.Rect.Center().Y - (atlas.Ascent()+atlas.Descent())/2 + atlas.Descent()
+
+    f.imd.Clear()
+    f.imd.Color = pixel.RGBA{A: 0.6}
+    f.imd.Push(f.Rect.Min, f.Rect.Max)
+    f.imd.Rectangle(0)
+    f.imd.Color = colornames.Dimgray
+    if f.Focused {
+        f.imd.Color = colornames.Lightsteelblue
+    }
+    f.imd.Push(f.Rect.Min, f.Rect.Max)
+    f.imd.Rectangle(1)
+    if lo, hi := f.selection(); f.Focused && lo != hi {
+        lo, hi = int(math.Max(float64(lo), float64(f.first))), int(math.Min(float64(hi), float64(end)))
+        if lo < hi {
+            x := left + width(f.first, lo)
+            f.imd.Color = pixel.RGB(0.25, 0.4, 0.7)
+            f.imd.Push(pixel.V(x, baseline-atlas.Descent()), pixel.V(x+width(lo, hi), baseline+atlas.Ascent()))
+            f.imd.Rectangle(0)
+        }
+    }
+    f.imd.Draw(t)
+
+    opts := f.Options
+    shown := string(f.runes[f.first:end])
+    caret := left + width(f.first, f.cursor)
+    if f.composition != "" {
+        // drawn at the caret, pushing the rest along, and underlined as IMEs do
+        before, after := string(f.runes[f.first:f.cursor]), string(f.runes[f.cursor:end])
+        shown = before + f.composition + after
+        composed := textWidth(atlas, f.composition)
+        f.imd.Clear()
+        f.imd.Color = colornames.White
+        f.imd.Push(pixel.V(caret, baseline-2), pixel.V(caret+composed, baseline-2))
+        f.imd.Line(1)
+        f.imd.Draw(t)
+        caret += composed
+    }
+    if len(f.runes) == 0 && f.composition == "" {
+        shown = f.Placeholder
+        opts.Color = color.Gray{128}
+    }
+    DrawText(t, f.Font, shown, pixel.V(left, baseline), opts)
+
+    if f.Focused && math.Mod(clock.UnscaledTotal()-f.moved, 2*CARETBLINK) < CARETBLINK {
+        f.imd.Clear()
+        f.imd.Color = colornames.White
+        if f.Options.Color != nil {
+            f.imd.Color = f.Options.Color
+        }
+        f.imd.Push(pixel.V(caret, baseline-atlas.Descent()), pixel.V(caret, baseline+atlas.Ascent()))
+        f.imd.Line(1)
+        f.imd.Draw(t)
+    }
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+    "strings"
+
+    "github.com/faiface/pixel"
+)
+
+// what a cell of a collision layer is
+type tileSolidity int
+
+const (
+    tileEmpty tileSolidity = iota
+    tileSolid
+    tileOneWay
+    tileLadder
+)
+
+// a rectangle of collision geometry generated from a map, in world coordinates
+type MapCollider struct {
+    Rect pixel.Rect
+    // a platform that only stops things landing on top, or a climbable area that stops nothing
+    OneWay, Ladder bool
+    // the layer it came from
+    Layer string
+}
+
+// the collider c.AddMap gives it
+func (mc MapCollider) Collider() *Collider {
+    return &Collider{Size: mc.Rect.Size(), Static: true, OneWay: mc.OneWay, Ladder: mc.Ladder, Trigger: mc.Ladder}
+}
+
+// how a tile of a Tiled collision layer counts. a tile's properties, or its type, can make it
+// "one_way" or a "ladder", and "collision" false leaves it out, e.g. for grass drawn on the layer.
+func tileSolidityOf(info *TileInfo) tileSolidity {
+    if info == nil {
+        return tileSolid
+    }
+    if _, ok := info.Properties["collision"]; ok && !info.Properties.Bool("collision") {
+        return tileEmpty
+    }
+    switch {
+    case info.Properties.Bool("one_way") || info.Type == "one_way":
+        return tileOneWay
+    case info.Properties.Bool("ladder") || info.Type == "ladder":
+        return tileLadder
+    }
+    return tileSolid
+}
+
+// how a value of an LDtk collision IntGrid counts, by the name it has in the project
+func intGridSolidity(name string) tileSolidity {
+    switch strings.ToLower(name) {
+    case "one_way", "oneway", "platform":
+        return tileOneWay
+    case "ladder":
+        return tileLadder
+    }
+    return tileSolid
+}
+
+// fills Colliders from the layers marked for collision: Tiled tile layers with a "collision"
+// property set to true, and LDtk IntGrid layers named Collision or starting with it. neighboring
+// cells of the same kind are merged into as few rectangles as it takes. LoadTMX and LoadLDtk call
+// it; call it again after changing those layers' tiles. only orthogonal maps get any.
+func (m *TileMap) BuildColliders() {
+    m.Colliders = m.Colliders[:0]
+    if m.Orientation != "" && m.Orientation != TILEORTHOGONAL {
+        return
+    }
+    height := m.pixelSize().Y
+    for _, l := range m.Layers {
+        if !l.Properties.Bool("collision") {
+            continue
+        }
+        solidity := func(x, y int) tileSolidity {
+            ts, id := m.TileFor(l.GID(x, y))
+            if ts == nil {
+                return tileEmpty
+            }
+            return tileSolidityOf(ts.Tiles[id])
+        }
+        m.addColliders(l.Name, l.Width, l.Height, float64(m.TileWidth), float64(m.TileHeight), l.Offset, height, solidity)
+    }
+    for _, g := range m.IntGrids {
+        if !strings.HasPrefix(strings.ToLower(g.Name), "collision") {
+            continue
+        }
+        solidity := func(x, y int) tileSolidity {
+            v := g.Value(x, y)
+            if v == 0 {
+                return tileEmpty
+            }
+            return intGridSolidity(g.Names[v])
+        }
+        size := float64(g.GridSize)
+        m.addColliders(g.Name, g.Width, g.Height, size, size, g.Offset, height, solidity)
+    }
+}
+
+// greedily grows a rectangle right, then down, from each cell no rectangle covers yet
+func (m *TileMap) addColliders(layer string, width, height int, cw, ch float64, offset pixel.Vec, top float64, solidity func(x, y int) tileSolidity) {
+    covered := make([]bool, width*height)
+    free := func(x, y int, kind tileSolidity) bool {
+        return !covered[y*width+x] && solidity(x, y) == kind
+    }
+    for y := 0; y < height; y++ {
+        for x := 0; x < width; x++ {
+            kind := solidity(x, y)
+            if kind == tileEmpty || covered[y*width+x] {
+                continue
+            }
+            w := 1
+            for x+w < width && free(x+w, y, kind) {
+                w++
+            }
+            h := 1
+        grow:
+            for y+h < height {
+                for i := 0; i < w; i++ {
+                    if !free(x+i, y+h, kind) {
+                        break grow
+                    }
+                }
+                h++
+            }
+            for dy := 0; dy < h; dy++ {
+                for dx := 0; dx < w; dx++ {
+                    covered[(y+dy)*width+x+dx] = true
+                }
+            }
+            // rows count from the top, the world's Y from the bottom
+            minX := float64(x)*cw + offset.X
+            maxY := top - float64(y)*ch + offset.Y
+            m.Colliders = append(m.Colliders, MapCollider{
+                Rect:   pixel.R(minX, maxY-float64(h)*ch, minX+float64(w)*cw, maxY),
+                OneWay: kind == tileOneWay,
+                Ladder: kind == tileLadder,
+                Layer:  layer,
+            })
+        }
+    }
+}
+
+// makes a static entity in World for each of m's Colliders, returning them so they can be
+// destroyed with the level
+func (c *Collisions) AddMap(m *TileMap) []Entity {
+    if c.World == nil {
+        return nil
+    }
+    entities := make([]Entity, 0, len(m.Colliders))
+    for _, mc := range m.Colliders {
+        e := c.World.Create()
+        c.World.Add(e, &Transform{Position: mc.Rect.Center()})
+        c.World.Add(e, mc.Collider())
+        entities = append(entities, e)
+    }
+    return entities
+}
+
+// where a shape overlaps one of a map's colliders
+type MapContact struct {
+    Collider MapCollider
+    // the way the shape has to go to get out, and how far
+    Normal pixel.Vec
+    Depth  float64
+}
+
+// the solid and one-way Colliders shape overlaps, for a rotated hitbox or a round projectile
+// tested straight against the level without going through a World; ladders are left out. one-way
+// platforms count from any side, so check the normal points up before stopping on one.
+func (m *TileMap) Overlaps(shape WorldShape) []MapContact {
+    var contacts []MapContact
+    for _, mc := range m.Colliders {
+        if mc.Ladder || !mc.Rect.Intersects(shape.Rect) {
+            continue
+        }
+        if push, ok := Collide(shape, WorldRect(mc.Rect)); ok {
+            depth := push.Len()
+            contacts = append(contacts, MapContact{Collider: mc, Normal: push.Scaled(1 / depth), Depth: depth})
+        }
+    }
+    return contacts
+}
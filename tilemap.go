@@ -0,0 +1,579 @@
+package main
+
+import (
+    "fmt"
+    "image/color"
+    "reflect"
+    "sort"
+    "strconv"
+    "time"
+
+    "github.com/faiface/pixel"
+)
+
+// custom properties attached to maps, layers, tiles and objects, as written in the editor
+type Properties map[string]string
+
+func (p Properties) String(key string) string {
+    return p[key]
+}
+
+func (p Properties) Int(key string) int {
+    v, _ := strconv.Atoi(p[key])
+    return v
+}
+
+func (p Properties) Float(key string) float64 {
+    v, _ := strconv.ParseFloat(p[key], 64)
+    return v
+}
+
+func (p Properties) Bool(key string) bool {
+    v, _ := strconv.ParseBool(p[key])
+    return v
+}
+
+type TileFrame struct {
+    TileID   int
+    Duration time.Duration
+}
+
+// per-tile data from a tileset
+type TileInfo struct {
+    ID         int
+    Type       string
+    Properties Properties
+    Animation  []TileFrame
+}
+
+type Tileset struct {
+    FirstGID              int
+    Name                  string
+    TileWidth, TileHeight int
+    Columns, TileCount    int
+    Picture               pixel.Picture
+    Properties            Properties
+    Tiles                 map[int]*TileInfo
+
+    frames []pixel.Rect
+    // as it was loaded from a .tmx or .tsx, so SaveTMX can write it back; nil for LDtk's
+    tmx *tmxTileset
+}
+
+func (ts *Tileset) sliceFrames(spacing, margin int) {
+    bounds := ts.Picture.Bounds()
+    columns := ts.Columns
+    if columns == 0 && ts.TileWidth > 0 {
+        columns = (int(bounds.W()) - 2*margin + spacing) / (ts.TileWidth + spacing)
+        ts.Columns = columns
+    }
+    count := ts.TileCount
+    if count == 0 && columns > 0 {
+        rows := (int(bounds.H()) - 2*margin + spacing) / (ts.TileHeight + spacing)
+        count = columns * rows
+        ts.TileCount = count
+    }
+
+    ts.frames = make([]pixel.Rect, count)
+    for id := 0; id < count; id++ {
+        col, row := id%columns, id/columns
+        minX := bounds.Min.X + float64(margin+col*(ts.TileWidth+spacing))
+        maxY := bounds.Max.Y - float64(margin+row*(ts.TileHeight+spacing))
+        ts.frames[id] = pixel.R(minX, maxY-float64(ts.TileHeight), minX+float64(ts.TileWidth), maxY)
+    }
+}
+
+// the picture bounds of a local tile id
+func (ts *Tileset) Frame(id int) pixel.Rect {
+    return ts.frames[id]
+}
+
+func (ts *Tileset) Contains(gid uint32) bool {
+    id := int(gid&TILEGIDMASK) - ts.FirstGID
+    return id >= 0 && id < len(ts.frames)
+}
+
+// the side, in cells, of the blocks a layer's static tiles are batched and culled in
+const TILECHUNK = 16
+
+type TileLayer struct {
+    Name          string
+    Width, Height int
+    Visible       bool
+    Opacity       float64
+    Offset        pixel.Vec
+    // lifts every tile by this many pixels, for stacked floors on isometric maps. tiles with an
+    // "elevation" property are lifted by that much more.
+    Elevation  float64
+    Properties Properties
+    // row-major from the top-left, including Tiled's flip flags; 0 is empty
+    GIDs []uint32
+
+    tileMap *TileMap
+    // static tiles, in TILECHUNK square blocks of cells on orthogonal maps so DrawView can skip
+    // the ones out of view; projected maps keep one chunk so tiles still overlap back to front
+    chunks         []*tileChunk
+    chunkTree      *Quadtree
+    animated       map[*Tileset]*pixel.Batch
+    animatedCells  []int
+    animatedBounds []pixel.Rect
+    dirty          bool
+    // overlapping tiles from more than one tileset, or animated ones, in a projected map have to
+    // draw strictly back to front, so they go through a queue instead of a batch per tileset
+    ordered       bool
+    queue         *SpriteQueue
+    queuedOpacity float64
+}
+
+// the gid at column x, row y counted from the top like the editor does
+func (l *TileLayer) GID(x, y int) uint32 {
+    if x < 0 || y < 0 || x >= l.Width || y >= l.Height {
+        return 0
+    }
+    return l.GIDs[y*l.Width+x]
+}
+
+func (l *TileLayer) SetGID(x, y int, gid uint32) {
+    if x < 0 || y < 0 || x >= l.Width || y >= l.Height {
+        return
+    }
+    l.GIDs[y*l.Width+x] = gid
+    l.dirty = true
+}
+
+type ObjectShape int
+
+const (
+    ShapeRect ObjectShape = iota
+    ShapeEllipse
+    ShapePoint
+    ShapePolygon
+    ShapePolyline
+    ShapeTile
+)
+
+// an object from an object layer, converted into world coordinates with Y up
+type MapObject struct {
+    ID         int
+    Name, Type string
+    Shape      ObjectShape
+    Rect       pixel.Rect
+    // degrees clockwise, as in the editor
+    Rotation   float64
+    GID        uint32
+    Points     []pixel.Vec
+    Visible    bool
+    Properties Properties
+}
+
+// fills the exported fields of the struct v points to from the object's properties.
+// fields are matched by a `tmx:"name"` tag or else by field name; "-" skips a field.
+func (o *MapObject) Decode(v interface{}) error {
+    rv := reflect.ValueOf(v)
+    if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+        return fmt.Errorf("decode object %d: need a pointer to a struct, got %T", o.ID, v)
+    }
+    rv = rv.Elem()
+    rt := rv.Type()
+    for i := 0; i < rt.NumField(); i++ {
+        field := rt.Field(i)
+        if field.PkgPath != "" {
+            continue
+        }
+        key := field.Tag.Get("tmx")
+        if key == "-" {
+            continue
+        }
+        if key == "" {
+            key = field.Name
+        }
+        raw, ok := o.Properties[key]
+        if !ok {
+            continue
+        }
+        if err := setFromString(rv.Field(i), raw); err != nil {
+            return fmt.Errorf("decode object %d: property %q: %v", o.ID, key, err)
+        }
+    }
+    return nil
+}
+
+func setFromString(v reflect.Value, raw string) error {
+    switch v.Kind() {
+    case reflect.String:
+        v.SetString(raw)
+    case reflect.Bool:
+        b, err := strconv.ParseBool(raw)
+        if err != nil {
+            return err
+        }
+        v.SetBool(b)
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        n, err := strconv.ParseInt(raw, 10, 64)
+        if err != nil {
+            return err
+        }
+        v.SetInt(n)
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        n, err := strconv.ParseUint(raw, 10, 64)
+        if err != nil {
+            return err
+        }
+        v.SetUint(n)
+    case reflect.Float32, reflect.Float64:
+        f, err := strconv.ParseFloat(raw, 64)
+        if err != nil {
+            return err
+        }
+        v.SetFloat(f)
+    default:
+        return fmt.Errorf("unsupported field type %s", v.Type())
+    }
+    return nil
+}
+
+type ObjectGroup struct {
+    Name       string
+    Visible    bool
+    Properties Properties
+    Objects    []*MapObject
+}
+
+// every object of the given type
+func (g *ObjectGroup) OfType(typ string) []*MapObject {
+    var objects []*MapObject
+    for _, o := range g.Objects {
+        if o.Type == typ {
+            objects = append(objects, o)
+        }
+    }
+    return objects
+}
+
+type TileMap struct {
+    Width, Height         int
+    TileWidth, TileHeight int
+    // one of the TILEORTHOGONAL style constants; staggered and hexagonal maps shift every other
+    // row, or column when StaggerAxis is "x", with StaggerIndex "odd" or "even" picking which
+    Orientation               string
+    HexSideLength             int
+    StaggerAxis, StaggerIndex string
+    Properties                Properties
+    Tilesets                  []*Tileset
+    Layers                    []*TileLayer
+    ObjectGroups              []*ObjectGroup
+    // only filled by LDtk imports
+    IntGrids []*IntGridLayer
+    // collision geometry from the layers marked for it, see BuildColliders
+    Colliders []MapCollider
+
+    // seconds, drives animated tiles
+    clock float64
+}
+
+func (m *TileMap) Layer(name string) *TileLayer {
+    for _, l := range m.Layers {
+        if l.Name == name {
+            return l
+        }
+    }
+    return nil
+}
+
+func (m *TileMap) IntGrid(name string) *IntGridLayer {
+    for _, g := range m.IntGrids {
+        if g.Name == name {
+            return g
+        }
+    }
+    return nil
+}
+
+func (m *TileMap) ObjectGroup(name string) *ObjectGroup {
+    for _, g := range m.ObjectGroups {
+        if g.Name == name {
+            return g
+        }
+    }
+    return nil
+}
+
+// world size in pixels
+func (m *TileMap) Bounds() pixel.Rect {
+    size := m.pixelSize()
+    return pixel.R(0, 0, size.X, size.Y)
+}
+
+// the tileset a gid belongs to and the tile's local id
+func (m *TileMap) TileFor(gid uint32) (*Tileset, int) {
+    gid &= TILEGIDMASK
+    if gid == 0 {
+        return nil, 0
+    }
+    // tilesets are sorted by firstgid, so the last one starting at or below gid owns it
+    for i := len(m.Tilesets) - 1; i >= 0; i-- {
+        ts := m.Tilesets[i]
+        if int(gid) >= ts.FirstGID {
+            return ts, int(gid) - ts.FirstGID
+        }
+    }
+    return nil, 0
+}
+
+// advances animated tiles by dt seconds
+func (m *TileMap) Update(dt float64) {
+    m.clock += dt
+}
+
+func (m *TileMap) animatedFrame(info *TileInfo) int {
+    var total time.Duration
+    for _, frame := range info.Animation {
+        total += frame.Duration
+    }
+    if total <= 0 {
+        return info.Animation[0].TileID
+    }
+    t := time.Duration(m.clock*float64(time.Second)) % total
+    for _, frame := range info.Animation {
+        if t < frame.Duration {
+            return frame.TileID
+        }
+        t -= frame.Duration
+    }
+    return info.Animation[len(info.Animation)-1].TileID
+}
+
+// undoes Tiled's flip flags around the tile's center
+func tileFlipMatrix(gid uint32) pixel.Matrix {
+    m := pixel.IM
+    if gid&TILEFLIPDIAG != 0 {
+        // Tiled's diagonal flip swaps axes in its Y down space, which is (x, y) -> (-y, -x) with Y up
+        m = pixel.Matrix{0, -1, -1, 0, 0, 0}
+    }
+    flip := pixel.V(1, 1)
+    if gid&TILEFLIPX != 0 {
+        flip.X = -1
+    }
+    if gid&TILEFLIPY != 0 {
+        flip.Y = -1
+    }
+    return m.ScaledXY(pixel.ZV, flip)
+}
+
+func (m *TileMap) tileSprite(ts *Tileset, id int, gid uint32, x, y int, offset pixel.Vec) (*pixel.Sprite, pixel.Matrix) {
+    frame := ts.Frame(id)
+    // oversized tiles hang off the top of their cell, like in the editor
+    center := m.CellOrigin(x, y).Add(offset).Add(frame.Size().Scaled(0.5))
+    return pixel.NewSprite(ts.Picture, frame), tileFlipMatrix(gid).Moved(center)
+}
+
+func (m *TileMap) drawTile(batch *pixel.Batch, ts *Tileset, id int, gid uint32, x, y int, offset pixel.Vec) {
+    sprite, mat := m.tileSprite(ts, id, gid, x, y, offset)
+    sprite.Draw(batch, mat)
+}
+
+// the layer offset plus any elevation, for a tile with local id in ts
+func (l *TileLayer) tileOffset(ts *Tileset, id int) pixel.Vec {
+    lift := l.Elevation
+    if info := ts.Tiles[id]; info != nil {
+        lift += info.Properties.Float("elevation")
+    }
+    return l.Offset.Add(pixel.V(0, lift))
+}
+
+func (l *TileLayer) rebuild() {
+    m := l.tileMap
+    orthogonal := m.Orientation == "" || m.Orientation == TILEORTHOGONAL
+    columns := 1
+    if orthogonal {
+        columns = (l.Width + TILECHUNK - 1) / TILECHUNK
+    }
+    chunks := make(map[int]*tileChunk)
+    l.chunks = l.chunks[:0]
+    l.chunkTree = NewQuadtree(m.Bounds())
+    l.animatedCells = l.animatedCells[:0]
+    l.animatedBounds = l.animatedBounds[:0]
+    used := make(map[*Tileset]bool)
+    m.eachCell(l.Width, l.Height, func(x, y int) {
+        gid := l.GID(x, y)
+        ts, id := m.TileFor(gid)
+        if ts == nil || id >= len(ts.frames) {
+            return
+        }
+        used[ts] = true
+        sprite, mat := m.tileSprite(ts, id, gid, x, y, l.tileOffset(ts, id))
+        bounds := tileBounds(sprite.Frame(), gid, mat)
+        if info := ts.Tiles[id]; info != nil && len(info.Animation) > 0 {
+            l.animatedCells = append(l.animatedCells, y*l.Width+x)
+            // frames can differ in size, but a tileset's tiles share one
+            l.animatedBounds = append(l.animatedBounds, bounds)
+            return
+        }
+        key := 0
+        if orthogonal {
+            key = y/TILECHUNK*columns + x/TILECHUNK
+        }
+        c := chunks[key]
+        if c == nil {
+            c = &tileChunk{index: len(l.chunks), bounds: bounds, batches: make(map[*Tileset]*pixel.Batch)}
+            chunks[key] = c
+            l.chunks = append(l.chunks, c)
+        }
+        c.bounds = c.bounds.Union(bounds)
+        sprite.Draw(l.batch(c.batches, ts), mat)
+    })
+    for _, c := range l.chunks {
+        l.chunkTree.Insert(c, c.bounds)
+    }
+    l.ordered = !orthogonal && (len(used) > 1 || len(l.animatedCells) > 0)
+    if l.ordered {
+        l.fillQueue()
+    }
+    l.dirty = false
+}
+
+// queues every tile in draw order, at the current animation frame
+func (l *TileLayer) fillQueue() {
+    m := l.tileMap
+    if l.queue == nil {
+        l.queue = NewSpriteQueue()
+        l.queue.KeepOrder = true
+    }
+    l.queue.Clear()
+    l.queuedOpacity = l.Opacity
+    mask := pixel.Alpha(l.Opacity)
+    m.eachCell(l.Width, l.Height, func(x, y int) {
+        gid := l.GID(x, y)
+        ts, id := m.TileFor(gid)
+        if ts == nil || id >= len(ts.frames) {
+            return
+        }
+        frame := id
+        if info := ts.Tiles[id]; info != nil && len(info.Animation) > 0 {
+            if frame = m.animatedFrame(info); frame >= len(ts.frames) {
+                return
+            }
+        }
+        sprite, mat := m.tileSprite(ts, frame, gid, x, y, l.tileOffset(ts, id))
+        l.queue.AddColorMask(sprite, mat, mask)
+    })
+}
+
+func (l *TileLayer) batch(batches map[*Tileset]*pixel.Batch, ts *Tileset) *pixel.Batch {
+    batch, ok := batches[ts]
+    if !ok {
+        batch = pixel.NewBatch(&pixel.TrianglesData{}, ts.Picture)
+        batches[ts] = batch
+    }
+    return batch
+}
+
+// draws the animated tiles overlapping view, or all of them when view is nil, and returns how
+// many it skipped
+func (l *TileLayer) drawAnimated(t pixel.Target, mask color.Color, view *pixel.Rect) int {
+    m := l.tileMap
+    if l.animated == nil {
+        l.animated = make(map[*Tileset]*pixel.Batch)
+    }
+    for _, batch := range l.animated {
+        batch.Clear()
+    }
+    culled := 0
+    for i, cell := range l.animatedCells {
+        if view != nil && !l.animatedBounds[i].Intersects(*view) {
+            culled++
+            continue
+        }
+        x, y := cell%l.Width, cell/l.Width
+        gid := l.GIDs[cell]
+        ts, id := m.TileFor(gid)
+        frame := m.animatedFrame(ts.Tiles[id])
+        if frame >= len(ts.frames) {
+            continue
+        }
+        m.drawTile(l.batch(l.animated, ts), ts, frame, gid, x, y, l.tileOffset(ts, id))
+    }
+    for _, batch := range l.animated {
+        batch.SetColorMask(mask)
+        batch.Draw(t)
+    }
+    return culled
+}
+
+// draws the layer in one batch per tileset and chunk, plus one per tileset for animated tiles,
+// back to front in projected maps
+func (l *TileLayer) Draw(t pixel.Target) {
+    l.draw(t, nil)
+}
+
+// like Draw, but only the chunks and animated tiles overlapping view, in world pixels, e.g. the
+// camera's VisibleRect. what it draws and skips goes into the renderer's drawn and culled
+// counts. projected layers that draw through a queue are drawn whole.
+func (l *TileLayer) DrawView(t pixel.Target, view pixel.Rect) {
+    l.draw(t, &view)
+}
+
+func (l *TileLayer) draw(t pixel.Target, view *pixel.Rect) {
+    if !l.Visible {
+        return
+    }
+    if l.chunkTree == nil || l.dirty {
+        l.rebuild()
+    }
+    if l.ordered {
+        if len(l.animatedCells) > 0 || l.queuedOpacity != l.Opacity {
+            l.fillQueue()
+        }
+        l.queue.Draw(t)
+        return
+    }
+    mask := pixel.Alpha(l.Opacity)
+    chunks := l.chunks
+    if view != nil {
+        chunks = chunks[:0:0]
+        // the quadtree's order depends on how it split, so go back to the chunks' own order
+        l.chunkTree.Each(*view, func(v interface{}) { chunks = append(chunks, v.(*tileChunk)) })
+        sort.Slice(chunks, func(i, j int) bool { return chunks[i].index < chunks[j].index })
+    }
+    for _, c := range chunks {
+        for _, batch := range c.batches {
+            batch.SetColorMask(mask)
+            batch.Draw(t)
+        }
+    }
+    culled := l.drawAnimated(t, mask, view)
+    if view != nil && renderer != nil {
+        renderer.CountCulling(len(chunks)+len(l.animatedCells)-culled, len(l.chunks)-len(chunks)+culled)
+    }
+}
+
+// draws every visible tile layer in map order
+func (m *TileMap) Draw(t pixel.Target) {
+    for _, l := range m.Layers {
+        l.Draw(t)
+    }
+}
+
+// like Draw, but each layer only where it overlaps view, see TileLayer.DrawView
+func (m *TileMap) DrawView(t pixel.Target, view pixel.Rect) {
+    for _, l := range m.Layers {
+        l.DrawView(t, view)
+    }
+}
+
+type tileChunk struct {
+    // where in the layer it was first reached, for drawing in a stable order
+    index   int
+    bounds  pixel.Rect
+    batches map[*Tileset]*pixel.Batch
+}
+
+// the world rect a tile's sprite covers once mat places it, flips and all
+func tileBounds(frame pixel.Rect, gid uint32, mat pixel.Matrix) pixel.Rect {
+    size := frame.Size()
+    if gid&TILEFLIPDIAG != 0 {
+        size = pixel.V(size.Y, size.X)
+    }
+    center := mat.Project(pixel.ZV)
+    return pixel.Rect{Min: center.Sub(size.Scaled(0.5)), Max: center.Add(size.Scaled(0.5))}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+)
+
+// TileMap.Orientation values, named like Tiled's; empty is orthogonal
+const (
+    TILEORTHOGONAL = "orthogonal"
+    // diamonds, with column x running down-right and row y down-left
+    TILEISOMETRIC = "isometric"
+    // diamonds in staggered rows, so the map stays rectangular
+    TILESTAGGERED = "staggered"
+    TILEHEXAGONAL = "hexagonal"
+)
+
+func (m *TileMap) isometric() bool {
+    return m.Orientation == TILEISOMETRIC
+}
+
+// staggered maps are laid out like hexagons with no flat sides
+func (m *TileMap) staggered() bool {
+    return m.Orientation == TILESTAGGERED || m.Orientation == TILEHEXAGONAL
+}
+
+func (m *TileMap) staggerX() bool {
+    return m.StaggerAxis == "x"
+}
+
+// whether column or row i is the shifted one
+func (m *TileMap) staggeredIndex(i int) bool {
+    if m.StaggerIndex == "even" {
+        return i%2 == 0
+    }
+    return i%2 != 0
+}
+
+// the distance between neighbouring columns and rows, and how far the sloped edges reach in
+func (m *TileMap) staggerSteps() (colW, rowH, sideX, sideY float64) {
+    tw, th := float64(m.TileWidth), float64(m.TileHeight)
+    side := float64(m.HexSideLength)
+    if m.Orientation == TILESTAGGERED {
+        side = 0
+    }
+    if m.staggerX() {
+        sideX = (tw - side) / 2
+        return sideX + side, th, sideX, 0
+    }
+    sideY = (th - side) / 2
+    return tw, sideY + side, 0, sideY
+}
+
+// map size in pixels
+func (m *TileMap) pixelSize() pixel.Vec {
+    tw, th := float64(m.TileWidth), float64(m.TileHeight)
+    switch {
+    case m.isometric():
+        return pixel.V(float64(m.Width+m.Height)*tw/2, float64(m.Width+m.Height)*th/2)
+    case m.staggered():
+        colW, rowH, sideX, sideY := m.staggerSteps()
+        if m.staggerX() {
+            return pixel.V(float64(m.Width)*colW+sideX, float64(m.Height)*th+th/2)
+        }
+        return pixel.V(float64(m.Width)*tw+tw/2, float64(m.Height)*rowH+sideY)
+    }
+    return pixel.V(float64(m.Width)*tw, float64(m.Height)*th)
+}
+
+// the top-left of the cell's bounding box in the editor's Y down pixels
+func (m *TileMap) cellTopLeft(x, y int) pixel.Vec {
+    tw, th := float64(m.TileWidth), float64(m.TileHeight)
+    switch {
+    case m.isometric():
+        originX := float64(m.Height) * tw / 2
+        return pixel.V(float64(x-y)*tw/2+originX-tw/2, float64(x+y)*th/2)
+    case m.staggered():
+        colW, rowH, _, _ := m.staggerSteps()
+        if m.staggerX() {
+            p := pixel.V(float64(x)*colW, float64(y)*th)
+            if m.staggeredIndex(x) {
+                p.Y += th / 2
+            }
+            return p
+        }
+        p := pixel.V(float64(x)*tw, float64(y)*rowH)
+        if m.staggeredIndex(y) {
+            p.X += tw / 2
+        }
+        return p
+    }
+    return pixel.V(float64(x)*tw, float64(y)*th)
+}
+
+// the world position of the bottom-left corner of the bounding box of the cell at column x,
+// row y (from the top), whatever the orientation
+func (m *TileMap) CellOrigin(x, y int) pixel.Vec {
+    p := m.cellTopLeft(x, y)
+    return pixel.V(p.X, m.pixelSize().Y-p.Y-float64(m.TileHeight))
+}
+
+// the world position of the middle of a cell, e.g. to place an entity standing on it
+func (m *TileMap) CellCenter(x, y int) pixel.Vec {
+    return m.CellOrigin(x, y).Add(pixel.V(float64(m.TileWidth)/2, float64(m.TileHeight)/2))
+}
+
+// the cell containing a world position, with the row counted from the top. positions off the
+// map give cells outside it.
+func (m *TileMap) CellAt(world pixel.Vec) (x, y int) {
+    tw, th := float64(m.TileWidth), float64(m.TileHeight)
+    // editor pixels, Y down
+    p := pixel.V(world.X, m.pixelSize().Y-world.Y)
+    switch {
+    case m.isometric():
+        originX := float64(m.Height) * tw / 2
+        fx := p.Y/th + (p.X-originX)/tw
+        fy := p.Y/th - (p.X-originX)/tw
+        return int(math.Floor(fx)), int(math.Floor(fy))
+    case m.staggered():
+        return m.staggeredCellAt(p)
+    }
+    return int(math.Floor(p.X / tw)), int(math.Floor(p.Y / th))
+}
+
+// checks the cells around the rough guess for the one whose center is closest. staggered
+// diamonds measure along their edges, hexagons go by straight distance.
+func (m *TileMap) staggeredCellAt(p pixel.Vec) (int, int) {
+    tw, th := float64(m.TileWidth), float64(m.TileHeight)
+    colW, rowH, _, _ := m.staggerSteps()
+    guessX, guessY := int(math.Floor(p.X/colW)), int(math.Floor(p.Y/rowH))
+    bestX, bestY, best := guessX, guessY, math.Inf(1)
+    for y := guessY - 1; y <= guessY+1; y++ {
+        for x := guessX - 1; x <= guessX+1; x++ {
+            c := m.cellTopLeft(x, y).Add(pixel.V(tw/2, th/2))
+            d := c.To(p)
+            dist := d.Len()
+            if m.Orientation == TILESTAGGERED {
+                dist = math.Abs(d.X)/(tw/2) + math.Abs(d.Y)/(th/2)
+            }
+            if dist < best {
+                bestX, bestY, best = x, y, dist
+            }
+        }
+    }
+    return bestX, bestY
+}
+
+// visits every cell back to front, so tiles closer to the viewer overlap the ones behind
+func (m *TileMap) eachCell(width, height int, fn func(x, y int)) {
+    if m.staggered() && m.staggerX() {
+        // within a row the shifted columns sit lower on screen, so they go second
+        for y := 0; y < height; y++ {
+            for pass := 0; pass < 2; pass++ {
+                for x := 0; x < width; x++ {
+                    if m.staggeredIndex(x) == (pass == 1) {
+                        fn(x, y)
+                    }
+                }
+            }
+        }
+        return
+    }
+    // row by row already works for orthogonal, isometric and row staggered maps
+    for y := 0; y < height; y++ {
+        for x := 0; x < width; x++ {
+            fn(x, y)
+        }
+    }
+}
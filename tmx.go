@@ -0,0 +1,687 @@
+package main
+
+import (
+    "bytes"
+    "compress/gzip"
+    "compress/zlib"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/faiface/pixel"
+)
+
+// flip flags Tiled stores in the top bits of a gid
+const (
+    TILEFLIPX    = 0x80000000
+    TILEFLIPY    = 0x40000000
+    TILEFLIPDIAG = 0x20000000
+    TILEGIDMASK  = 0x1fffffff
+)
+
+type tmxProperty struct {
+    Name  string `xml:"name,attr"`
+    Type  string `xml:"type,attr,omitempty"`
+    Value string `xml:"value,attr,omitempty"`
+    Text  string `xml:",chardata"`
+}
+
+type tmxProperties struct {
+    Properties []tmxProperty `xml:"property"`
+}
+
+func (p tmxProperties) parse() Properties {
+    props := make(Properties, len(p.Properties))
+    for _, prop := range p.Properties {
+        value := prop.Value
+        // multiline strings are stored as element text rather than an attribute
+        if value == "" {
+            value = prop.Text
+        }
+        props[prop.Name] = value
+    }
+    return props
+}
+
+type tmxImage struct {
+    Source string `xml:"source,attr"`
+    Width  int    `xml:"width,attr"`
+    Height int    `xml:"height,attr"`
+}
+
+type tmxTile struct {
+    ID         int           `xml:"id,attr"`
+    Type       string        `xml:"type,attr,omitempty"`
+    Class      string        `xml:"class,attr,omitempty"`
+    Properties tmxProperties `xml:"properties"`
+    Animation  tmxAnimation  `xml:"animation"`
+}
+
+type tmxAnimation struct {
+    Frames []struct {
+        TileID   int `xml:"tileid,attr"`
+        Duration int `xml:"duration,attr"`
+    } `xml:"frame"`
+}
+
+type tmxTileset struct {
+    FirstGID   int           `xml:"firstgid,attr"`
+    Source     string        `xml:"source,attr,omitempty"`
+    Name       string        `xml:"name,attr"`
+    TileWidth  int           `xml:"tilewidth,attr"`
+    TileHeight int           `xml:"tileheight,attr"`
+    Spacing    int           `xml:"spacing,attr,omitempty"`
+    Margin     int           `xml:"margin,attr,omitempty"`
+    TileCount  int           `xml:"tilecount,attr"`
+    Columns    int           `xml:"columns,attr"`
+    Image      tmxImage      `xml:"image"`
+    Tiles      []tmxTile     `xml:"tile"`
+    Properties tmxProperties `xml:"properties"`
+}
+
+type tmxData struct {
+    Encoding    string `xml:"encoding,attr"`
+    Compression string `xml:"compression,attr,omitempty"`
+    Text        string `xml:",chardata"`
+    Tiles       []struct {
+        GID uint32 `xml:"gid,attr"`
+    } `xml:"tile"`
+    Chunks []struct{} `xml:"chunk"`
+}
+
+type tmxLayer struct {
+    Name       string        `xml:"name,attr"`
+    Width      int           `xml:"width,attr"`
+    Height     int           `xml:"height,attr"`
+    Visible    *int          `xml:"visible,attr,omitempty"`
+    Opacity    *float64      `xml:"opacity,attr,omitempty"`
+    OffsetX    float64       `xml:"offsetx,attr,omitempty"`
+    OffsetY    float64       `xml:"offsety,attr,omitempty"`
+    Data       tmxData       `xml:"data"`
+    Properties tmxProperties `xml:"properties"`
+}
+
+type tmxObject struct {
+    ID         int           `xml:"id,attr"`
+    Name       string        `xml:"name,attr,omitempty"`
+    Type       string        `xml:"type,attr,omitempty"`
+    Class      string        `xml:"class,attr,omitempty"`
+    X          float64       `xml:"x,attr"`
+    Y          float64       `xml:"y,attr"`
+    Width      float64       `xml:"width,attr,omitempty"`
+    Height     float64       `xml:"height,attr,omitempty"`
+    Rotation   float64       `xml:"rotation,attr,omitempty"`
+    GID        uint32        `xml:"gid,attr,omitempty"`
+    Visible    *int          `xml:"visible,attr,omitempty"`
+    Properties tmxProperties `xml:"properties"`
+    Ellipse    *struct{}     `xml:"ellipse"`
+    Point      *struct{}     `xml:"point"`
+    Polygon    *struct {
+        Points string `xml:"points,attr"`
+    } `xml:"polygon"`
+    Polyline *struct {
+        Points string `xml:"points,attr"`
+    } `xml:"polyline"`
+}
+
+type tmxObjectGroup struct {
+    Name       string        `xml:"name,attr"`
+    Visible    *int          `xml:"visible,attr,omitempty"`
+    Objects    []tmxObject   `xml:"object"`
+    Properties tmxProperties `xml:"properties"`
+}
+
+type tmxMap struct {
+    Version       string        `xml:"version,attr,omitempty"`
+    Orientation   string        `xml:"orientation,attr"`
+    HexSideLength int           `xml:"hexsidelength,attr,omitempty"`
+    StaggerAxis   string        `xml:"staggeraxis,attr,omitempty"`
+    StaggerIndex  string        `xml:"staggerindex,attr,omitempty"`
+    Width         int           `xml:"width,attr"`
+    Height        int           `xml:"height,attr"`
+    TileWidth     int           `xml:"tilewidth,attr"`
+    TileHeight    int           `xml:"tileheight,attr"`
+    Infinite      int           `xml:"infinite,attr"`
+    NextObjectID  int           `xml:"nextobjectid,attr,omitempty"`
+    Properties    tmxProperties `xml:"properties"`
+    Tilesets      []tmxTileset  `xml:"tileset"`
+    // kept in document order, since draw order depends on it
+    Layers []tmxAnyLayer `xml:",any"`
+}
+
+// a direct child of <map> that is either a tile layer or an object group
+type tmxAnyLayer struct {
+    XMLName xml.Name
+    Tile    tmxLayer
+    Objects tmxObjectGroup
+}
+
+func (l *tmxAnyLayer) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+    l.XMLName = start.Name
+    switch start.Name.Local {
+    case "layer":
+        return d.DecodeElement(&l.Tile, &start)
+    case "objectgroup":
+        return d.DecodeElement(&l.Objects, &start)
+    default:
+        return d.Skip()
+    }
+}
+
+func tmxVisible(v *int) bool {
+    return v == nil || *v != 0
+}
+
+// loads a Tiled .tmx map along with its external .tsx tilesets and images
+func LoadTMX(name string) (*TileMap, error) {
+    data, err := ReadAsset(name)
+    if err != nil {
+        return nil, err
+    }
+
+    var raw tmxMap
+    if err := xml.Unmarshal(data, &raw); err != nil {
+        return nil, fmt.Errorf("tmx %s: %v", name, err)
+    }
+    if raw.Infinite != 0 {
+        return nil, fmt.Errorf("tmx %s: infinite maps aren't supported", name)
+    }
+
+    m := &TileMap{
+        Width:         raw.Width,
+        Height:        raw.Height,
+        TileWidth:     raw.TileWidth,
+        TileHeight:    raw.TileHeight,
+        Orientation:   raw.Orientation,
+        HexSideLength: raw.HexSideLength,
+        StaggerAxis:   raw.StaggerAxis,
+        StaggerIndex:  raw.StaggerIndex,
+        Properties:    raw.Properties.parse(),
+    }
+
+    dir := path.Dir(assetPath(name))
+    for _, ts := range raw.Tilesets {
+        tileset, err := loadTMXTileset(dir, ts)
+        if err != nil {
+            return nil, fmt.Errorf("tmx %s: %v", name, err)
+        }
+        m.Tilesets = append(m.Tilesets, tileset)
+    }
+
+    for _, layer := range raw.Layers {
+        switch layer.XMLName.Local {
+        case "layer":
+            tl, err := m.parseTileLayer(layer.Tile)
+            if err != nil {
+                return nil, fmt.Errorf("tmx %s: layer %q: %v", name, layer.Tile.Name, err)
+            }
+            m.Layers = append(m.Layers, tl)
+        case "objectgroup":
+            m.ObjectGroups = append(m.ObjectGroups, m.parseObjectGroup(layer.Objects))
+        }
+    }
+    m.BuildColliders()
+
+    return m, nil
+}
+
+func loadTMXTileset(dir string, ts tmxTileset) (*Tileset, error) {
+    firstGID := ts.FirstGID
+    if ts.Source != "" {
+        source := path.Join(dir, ts.Source)
+        data, err := ReadAsset(source)
+        if err != nil {
+            return nil, err
+        }
+        if err := xml.Unmarshal(data, &ts); err != nil {
+            return nil, fmt.Errorf("tsx %s: %v", source, err)
+        }
+        dir = path.Dir(source)
+    }
+    ts.FirstGID = firstGID
+
+    if ts.Image.Source == "" {
+        return nil, fmt.Errorf("tileset %q: image collection tilesets aren't supported", ts.Name)
+    }
+    pic, err := LoadPicture(path.Join(dir, ts.Image.Source))
+    if err != nil {
+        return nil, err
+    }
+
+    tileset := &Tileset{
+        FirstGID:   ts.FirstGID,
+        Name:       ts.Name,
+        TileWidth:  ts.TileWidth,
+        TileHeight: ts.TileHeight,
+        Columns:    ts.Columns,
+        TileCount:  ts.TileCount,
+        Picture:    pic,
+        Properties: ts.Properties.parse(),
+        Tiles:      make(map[int]*TileInfo),
+        tmx:        &ts,
+    }
+    tileset.sliceFrames(ts.Spacing, ts.Margin)
+
+    for _, tile := range ts.Tiles {
+        info := &TileInfo{ID: tile.ID, Type: tile.Type, Properties: tile.Properties.parse()}
+        if info.Type == "" {
+            info.Type = tile.Class
+        }
+        for _, frame := range tile.Animation.Frames {
+            info.Animation = append(info.Animation, TileFrame{
+                TileID:   frame.TileID,
+                Duration: time.Duration(frame.Duration) * time.Millisecond,
+            })
+        }
+        tileset.Tiles[tile.ID] = info
+    }
+    return tileset, nil
+}
+
+func (m *TileMap) parseTileLayer(raw tmxLayer) (*TileLayer, error) {
+    gids, err := decodeTMXData(raw.Data, raw.Width*raw.Height)
+    if err != nil {
+        return nil, err
+    }
+    opacity := 1.0
+    if raw.Opacity != nil {
+        opacity = *raw.Opacity
+    }
+    props := raw.Properties.parse()
+    return &TileLayer{
+        Name:       raw.Name,
+        Width:      raw.Width,
+        Height:     raw.Height,
+        Visible:    tmxVisible(raw.Visible),
+        Opacity:    opacity,
+        Offset:     pixel.V(raw.OffsetX, -raw.OffsetY),
+        Elevation:  props.Float("elevation"),
+        Properties: props,
+        GIDs:       gids,
+        tileMap:    m,
+    }, nil
+}
+
+func decodeTMXData(data tmxData, count int) ([]uint32, error) {
+    if len(data.Chunks) > 0 {
+        return nil, fmt.Errorf("chunked (infinite) layers aren't supported")
+    }
+
+    var gids []uint32
+    switch data.Encoding {
+    case "csv":
+        for _, field := range strings.Split(data.Text, ",") {
+            field = strings.TrimSpace(field)
+            if field == "" {
+                continue
+            }
+            gid, err := strconv.ParseUint(field, 10, 32)
+            if err != nil {
+                return nil, err
+            }
+            gids = append(gids, uint32(gid))
+        }
+    case "base64":
+        raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data.Text))
+        if err != nil {
+            return nil, err
+        }
+        var r io.Reader = bytes.NewReader(raw)
+        switch data.Compression {
+        case "":
+        case "zlib":
+            if r, err = zlib.NewReader(r); err != nil {
+                return nil, err
+            }
+        case "gzip":
+            if r, err = gzip.NewReader(r); err != nil {
+                return nil, err
+            }
+        default:
+            return nil, fmt.Errorf("unsupported compression %q", data.Compression)
+        }
+        raw, err = ioutil.ReadAll(r)
+        if err != nil {
+            return nil, err
+        }
+        for i := 0; i+4 <= len(raw); i += 4 {
+            gids = append(gids, binary.LittleEndian.Uint32(raw[i:]))
+        }
+    case "":
+        for _, tile := range data.Tiles {
+            gids = append(gids, tile.GID)
+        }
+    default:
+        return nil, fmt.Errorf("unsupported encoding %q", data.Encoding)
+    }
+
+    if len(gids) != count {
+        return nil, fmt.Errorf("expected %d tiles, got %d", count, len(gids))
+    }
+    return gids, nil
+}
+
+func (m *TileMap) parseObjectGroup(raw tmxObjectGroup) *ObjectGroup {
+    group := &ObjectGroup{
+        Name:       raw.Name,
+        Visible:    tmxVisible(raw.Visible),
+        Properties: raw.Properties.parse(),
+    }
+
+    for _, obj := range raw.Objects {
+        o := &MapObject{
+            ID:         obj.ID,
+            Name:       obj.Name,
+            Type:       obj.Type,
+            GID:        obj.GID,
+            Rotation:   obj.Rotation,
+            Visible:    tmxVisible(obj.Visible),
+            Properties: obj.Properties.parse(),
+        }
+        if o.Type == "" {
+            o.Type = obj.Class
+        }
+
+        // Tiled anchors tile objects at their bottom-left and everything else at the top-left
+        anchor := m.objectPoint(obj.X, obj.Y)
+        y := anchor.Y
+        if obj.GID == 0 {
+            y -= obj.Height
+        }
+        o.Rect = pixel.R(anchor.X, y, anchor.X+obj.Width, y+obj.Height)
+
+        switch {
+        case obj.Ellipse != nil:
+            o.Shape = ShapeEllipse
+        case obj.Point != nil:
+            o.Shape = ShapePoint
+        case obj.Polygon != nil:
+            o.Shape = ShapePolygon
+            o.Points = m.parseTMXPoints(obj.Polygon.Points, obj.X, obj.Y)
+        case obj.Polyline != nil:
+            o.Shape = ShapePolyline
+            o.Points = m.parseTMXPoints(obj.Polyline.Points, obj.X, obj.Y)
+        case obj.GID != 0:
+            o.Shape = ShapeTile
+        default:
+            o.Shape = ShapeRect
+        }
+        group.Objects = append(group.Objects, o)
+    }
+    return group
+}
+
+// converts Tiled's object coordinates, Y down and on isometric maps measured along the tile
+// axes in units of TileHeight, into world space
+func (m *TileMap) objectPoint(x, y float64) pixel.Vec {
+    height := m.pixelSize().Y
+    if m.isometric() {
+        th := float64(m.TileHeight)
+        tx, ty := x/th, y/th
+        originX := float64(m.Height*m.TileWidth) / 2
+        return pixel.V((tx-ty)*float64(m.TileWidth)/2+originX, height-(tx+ty)*th/2)
+    }
+    return pixel.V(x, height-y)
+}
+
+// converts "x,y x,y ..." relative to an object's position into world points
+func (m *TileMap) parseTMXPoints(points string, originX, originY float64) []pixel.Vec {
+    var out []pixel.Vec
+    for _, pair := range strings.Fields(points) {
+        xy := strings.SplitN(pair, ",", 2)
+        if len(xy) != 2 {
+            continue
+        }
+        x, errX := strconv.ParseFloat(xy[0], 64)
+        y, errY := strconv.ParseFloat(xy[1], 64)
+        if errX != nil || errY != nil {
+            continue
+        }
+        out = append(out, m.objectPoint(originX+x, originY+y))
+    }
+    return out
+}
+
+// an empty <properties> is left out
+func (p tmxProperties) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+    if len(p.Properties) == 0 {
+        return nil
+    }
+    type plain tmxProperties
+    return e.EncodeElement(plain(p), start)
+}
+
+func (a tmxAnimation) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+    if len(a.Frames) == 0 {
+        return nil
+    }
+    type plain tmxAnimation
+    return e.EncodeElement(plain(a), start)
+}
+
+// an external tileset is written as just its firstgid and source, like Tiled does
+func (ts tmxTileset) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+    if ts.Source != "" {
+        return e.EncodeElement(struct {
+            FirstGID int    `xml:"firstgid,attr"`
+            Source   string `xml:"source,attr"`
+        }{ts.FirstGID, ts.Source}, start)
+    }
+    type plain tmxTileset
+    return e.EncodeElement(plain(ts), start)
+}
+
+// the CSV goes out as it is, where EncodeElement would escape its line breaks
+func (d tmxData) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+    start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "encoding"}, Value: d.Encoding})
+    if err := e.EncodeToken(start); err != nil {
+        return err
+    }
+    if err := e.EncodeToken(xml.CharData(d.Text)); err != nil {
+        return err
+    }
+    return e.EncodeToken(start.End())
+}
+
+func (l tmxAnyLayer) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+    start = xml.StartElement{Name: l.XMLName}
+    if l.XMLName.Local == "objectgroup" {
+        return e.EncodeElement(l.Objects, start)
+    }
+    return e.EncodeElement(l.Tile, start)
+}
+
+func encodeTMXProperties(p Properties) tmxProperties {
+    keys := make([]string, 0, len(p))
+    for key := range p {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    var out tmxProperties
+    for _, key := range keys {
+        prop := tmxProperty{Name: key, Value: p[key]}
+        // the way Tiled keeps multiline strings
+        if strings.Contains(prop.Value, "\n") {
+            prop.Value, prop.Text = "", p[key]
+        }
+        out.Properties = append(out.Properties, prop)
+    }
+    return out
+}
+
+func tmxHidden(visible bool) *int {
+    if visible {
+        return nil
+    }
+    hidden := 0
+    return &hidden
+}
+
+// m as a Tiled .tmx, the way LoadTMX reads it back, e.g. for the level editor to save what it's
+// changed. tilesets go out as they came in, external ones by reference. tile layers come before
+// object groups, since m doesn't keep how they were interleaved, and custom properties are all
+// written as strings, which Properties reads the same.
+func EncodeTMX(m *TileMap) ([]byte, error) {
+    orientation := m.Orientation
+    if orientation == "" {
+        orientation = TILEORTHOGONAL
+    }
+    raw := tmxMap{
+        Version:       "1.10",
+        Orientation:   orientation,
+        HexSideLength: m.HexSideLength,
+        StaggerAxis:   m.StaggerAxis,
+        StaggerIndex:  m.StaggerIndex,
+        Width:         m.Width,
+        Height:        m.Height,
+        TileWidth:     m.TileWidth,
+        TileHeight:    m.TileHeight,
+        Properties:    encodeTMXProperties(m.Properties),
+    }
+    for _, ts := range m.Tilesets {
+        if ts.tmx == nil {
+            return nil, fmt.Errorf("tmx: tileset %q wasn't loaded from Tiled", ts.Name)
+        }
+        raw.Tilesets = append(raw.Tilesets, *ts.tmx)
+    }
+    for _, l := range m.Layers {
+        raw.Layers = append(raw.Layers, tmxAnyLayer{XMLName: xml.Name{Local: "layer"}, Tile: encodeTMXLayer(l)})
+    }
+    next := 1
+    for _, g := range m.ObjectGroups {
+        group := tmxObjectGroup{Name: g.Name, Visible: tmxHidden(g.Visible), Properties: encodeTMXProperties(g.Properties)}
+        for _, o := range g.Objects {
+            group.Objects = append(group.Objects, m.encodeTMXObject(o))
+            if o.ID >= next {
+                next = o.ID + 1
+            }
+        }
+        raw.Layers = append(raw.Layers, tmxAnyLayer{XMLName: xml.Name{Local: "objectgroup"}, Objects: group})
+    }
+    raw.NextObjectID = next
+
+    var b bytes.Buffer
+    b.WriteString(xml.Header)
+    e := xml.NewEncoder(&b)
+    e.Indent("", " ")
+    if err := e.EncodeElement(raw, xml.StartElement{Name: xml.Name{Local: "map"}}); err != nil {
+        return nil, fmt.Errorf("tmx: %v", err)
+    }
+    b.WriteString("\n")
+    return b.Bytes(), nil
+}
+
+// writes m to path on disk as EncodeTMX does, through a temporary file so a failed save leaves
+// the old one whole
+func SaveTMX(m *TileMap, path string) error {
+    data, err := EncodeTMX(m)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return fmt.Errorf("tmx %s: %v", path, err)
+    }
+    if err := writeAtomic(path, data); err != nil {
+        return fmt.Errorf("tmx %s: %v", path, err)
+    }
+    return nil
+}
+
+// the gids as CSV, a row to a line like Tiled writes them
+func encodeTMXLayer(l *TileLayer) tmxLayer {
+    var csv strings.Builder
+    csv.WriteString("\n")
+    for i, gid := range l.GIDs {
+        csv.WriteString(strconv.FormatUint(uint64(gid), 10))
+        if i < len(l.GIDs)-1 {
+            csv.WriteString(",")
+        }
+        if (i+1)%l.Width == 0 {
+            csv.WriteString("\n")
+        }
+    }
+    raw := tmxLayer{
+        Name:       l.Name,
+        Width:      l.Width,
+        Height:     l.Height,
+        Visible:    tmxHidden(l.Visible),
+        OffsetX:    l.Offset.X,
+        OffsetY:    -l.Offset.Y,
+        Data:       tmxData{Encoding: "csv", Text: csv.String()},
+        Properties: encodeTMXProperties(l.Properties),
+    }
+    if l.Opacity != 1 {
+        opacity := l.Opacity
+        raw.Opacity = &opacity
+    }
+    return raw
+}
+
+func (m *TileMap) encodeTMXObject(o *MapObject) tmxObject {
+    // back to the corner Tiled anchors it at, see parseObjectGroup
+    anchor := pixel.V(o.Rect.Min.X, o.Rect.Max.Y)
+    if o.GID != 0 {
+        anchor = o.Rect.Min
+    }
+    x, y := m.tmxPoint(anchor)
+    raw := tmxObject{
+        ID:         o.ID,
+        Name:       o.Name,
+        Type:       o.Type,
+        X:          x,
+        Y:          y,
+        Width:      o.Rect.W(),
+        Height:     o.Rect.H(),
+        Rotation:   o.Rotation,
+        GID:        o.GID,
+        Visible:    tmxHidden(o.Visible),
+        Properties: encodeTMXProperties(o.Properties),
+    }
+    points := func() string {
+        pairs := make([]string, len(o.Points))
+        for i, p := range o.Points {
+            px, py := m.tmxPoint(p)
+            pairs[i] = strconv.FormatFloat(px-x, 'g', -1, 64) + "," + strconv.FormatFloat(py-y, 'g', -1, 64)
+        }
+        return strings.Join(pairs, " ")
+    }
+    switch o.Shape {
+    case ShapeEllipse:
+        raw.Ellipse = &struct{}{}
+    case ShapePoint:
+        raw.Point = &struct{}{}
+    case ShapePolygon:
+        raw.Polygon = &struct {
+            Points string `xml:"points,attr"`
+        }{points()}
+    case ShapePolyline:
+        raw.Polyline = &struct {
+            Points string `xml:"points,attr"`
+        }{points()}
+    }
+    return raw
+}
+
+// the other way from objectPoint, world space back into Tiled's object coordinates
+func (m *TileMap) tmxPoint(p pixel.Vec) (x, y float64) {
+    height := m.pixelSize().Y
+    if m.isometric() {
+        th := float64(m.TileHeight)
+        originX := float64(m.Height*m.TileWidth) / 2
+        // tx-ty and tx+ty, in tiles
+        d := (p.X - originX) * 2 / float64(m.TileWidth)
+        s := (height - p.Y) * 2 / th
+        return (s + d) / 2 * th, (s - d) / 2 * th
+    }
+    return p.X, height - p.Y
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+    "image/color"
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+)
+
+// how many real seconds a toast stays up, not counting its slide in and out
+const TOASTDURATION = 3
+
+// how long a toast takes to slide in or out, in real seconds
+const TOASTSLIDE = 0.25
+
+// how wide a toast's text gets before wrapping, and the most shown at once before the rest wait,
+// in virtual pixels
+const TOASTWIDTH = 240
+const TOASTMAX = 4
+
+// how quickly the toasts below one that's gone close the gap, per second
+const TOASTSETTLE = 12
+
+// a message that shows for a while and goes, like "Game saved": an optional icon beside a title
+// over some text, both looked up with T
+type Toast struct {
+    Icon  *pixel.Sprite
+    Title string
+    Text  string
+    // seconds it stays up; 0 for the Toasts' Duration
+    Duration float64
+}
+
+type shownToast struct {
+    Toast
+    // real seconds since it started sliding in
+    age float64
+    // how far along the stack from the corner it is right now, easing to where it belongs
+    offset float64
+    size   pixel.Vec
+}
+
+// toasts in a corner of the screen. each slides in from the edge, stays for its duration and
+// slides back out; newer ones stack beneath the older, away from the corner, and the rest close
+// up as one goes. past Max they wait their turn. they run on real time, so they keep going while
+// the game's paused, e.g.
+//
+//	toasts.Notify("Achievement unlocked", "Jumped a hundred times")
+type Toasts struct {
+    // AnchorTopRight by default; the middle anchors slide in from above or below
+    Corner   Anchor
+    Margin   pixel.Vec
+    Duration float64
+    Slide    float64
+    Width    float64
+    Max      int
+    Style    UIStyle
+    Font     *Font
+    Options  TextOptions
+
+    queue []Toast
+    shown []*shownToast
+
+    imd *imdraw.IMDraw
+}
+
+func NewToasts() *Toasts {
+    style := DefaultUIStyle()
+    return &Toasts{
+        Corner:   AnchorTopRight,
+        Margin:   pixel.V(style.Padding, style.Padding),
+        Duration: TOASTDURATION,
+        Slide:    TOASTSLIDE,
+        Width:    TOASTWIDTH,
+        Max:      TOASTMAX,
+        Style:    style,
+        Options:  TextOptions{Size: FONTSIZE},
+        imd:      imdraw.New(nil),
+    }
+}
+
+// queues toast to show once there's room
+func (t *Toasts) Show(toast Toast) {
+    t.queue = append(t.queue, toast)
+}
+
+// shows a toast with just a title and text
+func (t *Toasts) Notify(title, text string) {
+    t.Show(Toast{Title: title, Text: text})
+}
+
+// drops every toast, shown or waiting
+func (t *Toasts) Clear() {
+    t.queue, t.shown = t.queue[:0], t.shown[:0]
+}
+
+// how many are showing and how many are waiting
+func (t *Toasts) Len() (shown, queued int) {
+    return len(t.shown), len(t.queue)
+}
+
+func (t *Toasts) font() *Font {
+    if t.Font == nil {
+        return DefaultFont()
+    }
+    return t.Font
+}
+
+func (t *Toasts) duration(toast Toast) float64 {
+    if toast.Duration > 0 {
+        return toast.Duration
+    }
+    return t.Duration
+}
+
+// ages the toasts by dt real seconds, drops the finished ones and brings on waiting ones
+func (t *Toasts) Update(dt float64) {
+    kept := t.shown[:0]
+    for _, s := range t.shown {
+        s.age += dt
+        if s.age < 2*t.Slide+t.duration(s.Toast) {
+            kept = append(kept, s)
+        }
+    }
+    for i := len(kept); i < len(t.shown); i++ {
+        t.shown[i] = nil
+    }
+    t.shown = kept
+
+    scale := accessibility.UIScale()
+    spacing := t.Style.Spacing * scale
+    end := 0.0
+    for _, s := range t.shown {
+        end += s.size.Y + spacing
+    }
+    for len(t.queue) > 0 && (t.Max <= 0 || len(t.shown) < t.Max) {
+        s := &shownToast{Toast: t.queue[0], offset: end}
+        t.queue = append(t.queue[:0], t.queue[1:]...)
+        s.size = t.measure(s.Toast, scale)
+        end += s.size.Y + spacing
+        t.shown = append(t.shown, s)
+    }
+
+    target := 0.0
+    settle := math.Min(1, TOASTSETTLE*dt)
+    for _, s := range t.shown {
+        s.size = t.measure(s.Toast, scale)
+        s.offset += (target - s.offset) * settle
+        target += s.size.Y + spacing
+    }
+}
+
+// the size of toast's box at the UI scale
+func (t *Toasts) measure(toast Toast, scale float64) pixel.Vec {
+    font := t.font()
+    opts := t.Options.scaled(scale)
+    opts.Width = t.Width * scale
+    var title, body pixel.Vec
+    if toast.Title != "" {
+        title, _ = MeasureText(font, T(toast.Title), opts)
+    }
+    if toast.Text != "" {
+        body, _ = MeasureText(font, T(toast.Text), opts)
+    }
+    pad := t.Style.Padding * scale
+    size := pixel.V(math.Max(title.X, body.X), title.Y+body.Y)
+    if toast.Icon != nil {
+        icon := toastIcon(toast.Icon, scale)
+        size.X += icon.X + pad
+        size.Y = math.Max(size.Y, icon.Y)
+    }
+    return size.Add(pixel.V(2*pad, 2*pad))
+}
+
+// an icon's size at the UI scale, no bigger than TOOLTIPICON
+func toastIcon(icon *pixel.Sprite, scale float64) pixel.Vec {
+    frame := icon.Frame()
+    return frame.Size().Scaled(scale * math.Min(1, math.Min(TOOLTIPICON/frame.W(), TOOLTIPICON/frame.H())))
+}
+
+// how far in s is, 0 off screen to 1 fully in
+func (t *Toasts) visible(s *shownToast) float64 {
+    if t.Slide <= 0 {
+        return 1
+    }
+    left := 2*t.Slide + t.duration(s.Toast) - s.age
+    return OutCubic(math.Max(0, math.Min(1, math.Min(s.age, left)/t.Slide)))
+}
+
+// s's box on the screen, slid p of the way in
+func (t *Toasts) place(s *shownToast, p float64, margin pixel.Vec) pixel.Rect {
+    bounds := screen.Bounds()
+    at := t.Corner.point()
+    inward := pixel.V(1, 1)
+    if at.X == 1 {
+        inward.X = -1
+    }
+    if at.Y == 1 {
+        inward.Y = -1
+    }
+    min := pixel.V(
+        bounds.Min.X+at.X*(bounds.W()-s.size.X)+inward.X*margin.X,
+        bounds.Min.Y+at.Y*(bounds.H()-s.size.Y)+inward.Y*margin.Y,
+    )
+    // away from the edge they're against, and down from the middle
+    if at.Y == 0 {
+        min.Y += s.offset
+    } else {
+        min.Y -= s.offset
+    }
+    hidden := 1 - p
+    switch {
+    case at.X != 0.5:
+        min.X -= inward.X * hidden * (s.size.X + margin.X)
+    case at.Y == 0:
+        min.Y -= hidden * (s.size.Y + margin.Y)
+    default:
+        min.Y += hidden * (s.size.Y + margin.Y)
+    }
+    return pixel.Rect{Min: min, Max: min.Add(s.size)}
+}
+
+// draws the toasts at the UI scale in virtual screen coordinates; Run draws them over everything
+func (t *Toasts) Draw(target RenderTarget) {
+    if len(t.shown) == 0 {
+        return
+    }
+    scale := accessibility.UIScale()
+    style, opts := t.Style.Scaled(scale), t.Options.scaled(scale)
+    opts.Width = t.Width * scale
+    font := t.font()
+    atlas, err := font.Atlas(opts.size())
+    if err != nil {
+        return
+    }
+    target.SetMatrix(pixel.IM)
+    fade := func(c color.Color, p float64) pixel.RGBA {
+        return pixel.ToRGBA(c).Mul(pixel.Alpha(p))
+    }
+    for _, s := range t.shown {
+        p := t.visible(s)
+        box := t.place(s, p, t.Margin.Scaled(scale))
+        t.imd.Clear()
+        t.imd.Color = fade(style.Panel, p)
+        t.imd.Push(box.Min, box.Max)
+        t.imd.Rectangle(0)
+        t.imd.Color = fade(style.Accent, p)
+        t.imd.Push(box.Min, box.Max)
+        t.imd.Rectangle(1)
+        t.imd.Draw(target)
+
+        x, top := box.Min.X+style.Padding, box.Max.Y-style.Padding
+        if s.Icon != nil {
+            icon := toastIcon(s.Icon, scale)
+            frame := s.Icon.Frame()
+            m := pixel.IM.Scaled(pixel.ZV, icon.X/frame.W()).Moved(pixel.V(x+icon.X/2, top-icon.Y/2))
+            s.Icon.DrawColorMask(target, m, pixel.Alpha(p))
+            x += icon.X + style.Padding
+        }
+        y := top - atlas.Ascent()
+        if s.Title != "" {
+            title := T(s.Title)
+            opts.Color = fade(style.Accent, p)
+            DrawText(target, font, title, pixel.V(x, y), opts)
+            size, _ := MeasureText(font, title, opts)
+            y -= size.Y
+        }
+        if s.Text != "" {
+            opts.Color = fade(style.Text, p)
+            DrawText(target, font, T(s.Text), pixel.V(x, y), opts)
+        }
+    }
+}
+
+func registerToastCommands(c *Console, t *Toasts) {
+    c.Register("toast", "shows a toast, to try out how they look", func(args ConsoleArgs) error {
+        text := ""
+        if args.Has(1) {
+            text = args.String(1)
+        }
+        t.Notify(args.String(0), text)
+        return nil
+    }, StringArg("title"), StringArg("text").Opt())
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// how many real seconds the mouse rests on something before its tooltip shows
+const TOOLTIPDELAY = 0.5
+
+// how far from the cursor a tooltip is drawn, and how wide its text gets before wrapping, in
+// virtual pixels
+const TOOLTIPOFFSET = 12
+const TOOLTIPWIDTH = 220
+
+// the biggest an icon is drawn in a tooltip, in virtual pixels
+const TOOLTIPICON = 32
+
+// what a tooltip says: an optional icon beside a title over some text, both looked up with T
+type Tooltip struct {
+    Icon  *pixel.Sprite
+    Title string
+    Text  string
+}
+
+// something with a tooltip. move its Rect freely, or let AddEntity keep it on an entity.
+type TooltipTarget struct {
+    Tooltip Tooltip
+    // in virtual screen coordinates, or in the world when World is set
+    Rect    pixel.Rect
+    World   bool
+    Enabled bool
+
+    world  *World
+    entity Entity
+}
+
+// tooltips shown after the mouse rests on a target for Delay, beside the cursor and flipped or
+// nudged to stay on screen. clicking hides one until the mouse moves to something else. targets
+// over the screen sit above ones in the world, and later ones above earlier ones, like Mouse's
+// hover areas.
+type Tooltips struct {
+    Delay   float64
+    Width   float64
+    Style   UIStyle
+    Font    *Font
+    Options TextOptions
+
+    targets []*TooltipTarget
+    // what the mouse is on: a target, or an ID handed to Hover
+    over      interface{}
+    since     float64
+    dismissed bool
+    pending   *Tooltip
+    pendingID string
+    showing   *Tooltip
+    mouse     pixel.Vec
+
+    imd *imdraw.IMDraw
+}
+
+func NewTooltips() *Tooltips {
+    return &Tooltips{
+        Delay:   TOOLTIPDELAY,
+        Width:   TOOLTIPWIDTH,
+        Style:   DefaultUIStyle(),
+        Options: TextOptions{Size: FONTSIZE},
+        imd:     imdraw.New(nil),
+    }
+}
+
+// gives rect on the screen a tooltip, e.g. a HUD icon
+func (t *Tooltips) Add(rect pixel.Rect, tip Tooltip) *TooltipTarget {
+    target := &TooltipTarget{Tooltip: tip, Rect: rect, Enabled: true}
+    t.targets = append(t.targets, target)
+    return target
+}
+
+// gives rect in the world a tooltip, found under the mouse through the camera
+func (t *Tooltips) AddWorld(rect pixel.Rect, tip Tooltip) *TooltipTarget {
+    target := t.Add(rect, tip)
+    target.World = true
+    return target
+}
+
+// gives e a tooltip over its Collider, following its Transform; it's dropped once e is destroyed
+func (t *Tooltips) AddEntity(w *World, e Entity, tip Tooltip) *TooltipTarget {
+    target := t.AddWorld(pixel.Rect{}, tip)
+    target.world, target.entity = w, e
+    return target
+}
+
+func (t *Tooltips) Remove(target *TooltipTarget) {
+    for i, other := range t.targets {
+        if other == target {
+            t.targets = append(t.targets[:i:i], t.targets[i+1:]...)
+            break
+        }
+    }
+}
+
+// shows tip for something Tooltips doesn't keep, like a UI widget: call it every frame the
+// widget with id is hovered, before Update, e.g.
+//
+//	if ui.Hovered() == "Sell" {
+//		tooltips.Hover("Sell", Tooltip{Text: "Sells the whole stack"})
+//	}
+func (t *Tooltips) Hover(id string, tip Tooltip) {
+    t.pending, t.pendingID = &tip, id
+}
+
+// works out what the mouse is on and whether it's been there long enough; call once a frame
+// with the frame's input, after any Hover
+func (t *Tooltips) Update(in Input) {
+    t.mouse = screen.MousePosition(in)
+    var over interface{}
+    var tip *Tooltip
+    if t.pending != nil {
+        over, tip = t.pendingID, t.pending
+    } else if in.MouseInsideWindow() {
+        if target := t.under(t.mouse); target != nil {
+            over, tip = target, &target.Tooltip
+        }
+    }
+    t.pending = nil
+
+    now := clock.UnscaledTotal()
+    if over != t.over {
+        t.over, t.since, t.dismissed = over, now, false
+    }
+    for b := pixelgl.MouseButton1; b <= pixelgl.MouseButton3; b++ {
+        if in.JustPressed(b) {
+            t.dismissed = true
+        }
+    }
+    t.showing = nil
+    if tip != nil && !t.dismissed && now-t.since >= t.Delay {
+        t.showing = tip
+    }
+}
+
+// the topmost enabled target at pos on the screen
+func (t *Tooltips) under(pos pixel.Vec) *TooltipTarget {
+    kept := t.targets[:0]
+    for _, target := range t.targets {
+        if target.world == nil {
+            kept = append(kept, target)
+            continue
+        }
+        if !target.world.Alive(target.entity) {
+            continue
+        }
+        tr, _ := target.world.Get(target.entity, TransformType).(*Transform)
+        c, _ := target.world.Get(target.entity, ColliderType).(*Collider)
+        if tr != nil && c != nil {
+            target.Rect = c.Rect(tr.Position)
+        }
+        kept = append(kept, target)
+    }
+    for i := len(kept); i < len(t.targets); i++ {
+        t.targets[i] = nil
+    }
+    t.targets = kept
+
+    var world *TooltipTarget
+    for i := len(t.targets) - 1; i >= 0; i-- {
+        target := t.targets[i]
+        switch {
+        case !target.Enabled:
+        case !target.World && target.Rect.Contains(pos):
+            return target
+        case target.World && world == nil && camera != nil && target.Rect.Contains(camera.ScreenToWorld(pos)):
+            world = target
+        }
+    }
+    return world
+}
+
+// the tooltip showing this frame, if any
+func (t *Tooltips) Showing() (Tooltip, bool) {
+    if t.showing == nil {
+        return Tooltip{}, false
+    }
+    return *t.showing, true
+}
+
+func (t *Tooltips) font() *Font {
+    if t.Font == nil {
+        return DefaultFont()
+    }
+    return t.Font
+}
+
+// the tooltip's box, beside the cursor where it fits and on the other side where it doesn't
+func (t *Tooltips) place(size pixel.Vec) pixel.Rect {
+    bounds := screen.Bounds()
+    min := pixel.V(t.mouse.X+TOOLTIPOFFSET, t.mouse.Y-TOOLTIPOFFSET-size.Y)
+    if min.X+size.X > bounds.Max.X {
+        min.X = t.mouse.X - TOOLTIPOFFSET - size.X
+    }
+    if min.Y < bounds.Min.Y {
+        min.Y = t.mouse.Y + TOOLTIPOFFSET
+    }
+    // bigger than the space either side, so it's pushed back in whole
+    min.X = math.Max(bounds.Min.X, math.Min(bounds.Max.X-size.X, min.X))
+    min.Y = math.Max(bounds.Min.Y, math.Min(bounds.Max.Y-size.Y, min.Y))
+    return pixel.Rect{Min: min, Max: min.Add(size)}
+}
+
+// draws the tooltip showing, if any, at the UI scale in virtual screen coordinates; draw it after
+// everything else
+func (t *Tooltips) Draw(target RenderTarget) {
+    if t.showing == nil {
+        return
+    }
+    tip := *t.showing
+    tip.Title, tip.Text = T(tip.Title), T(tip.Text)
+    font := t.font()
+    ui := accessibility.UIScale()
+    style, opts := t.Style.Scaled(ui), t.Options.scaled(ui)
+    atlas, err := font.Atlas(opts.size())
+    if err != nil {
+        return
+    }
+    opts.Width = t.Width * ui
+    var title, body pixel.Vec
+    if tip.Title != "" {
+        title, _ = MeasureText(font, tip.Title, opts)
+    }
+    if tip.Text != "" {
+        body, _ = MeasureText(font, tip.Text, opts)
+    }
+    var icon pixel.Vec
+    scale := 1.0
+    if tip.Icon != nil {
+        frame := tip.Icon.Frame()
+        scale = ui * math.Min(1, math.Min(TOOLTIPICON/frame.W(), TOOLTIPICON/frame.H()))
+        icon = frame.Size().Scaled(scale)
+    }
+    pad := style.Padding
+    size := pixel.V(math.Max(title.X, body.X), math.Max(icon.Y, title.Y+body.Y))
+    if tip.Icon != nil {
+        size.X += icon.X + pad
+    }
+    size = size.Add(pixel.V(2*pad, 2*pad))
+    box := t.place(size)
+
+    target.SetMatrix(pixel.IM)
+    t.imd.Clear()
+    t.imd.Color = style.Panel
+    t.imd.Push(box.Min, box.Max)
+    t.imd.Rectangle(0)
+    t.imd.Color = style.Accent
+    t.imd.Push(box.Min, box.Max)
+    t.imd.Rectangle(1)
+    t.imd.Draw(target)
+
+    x, top := box.Min.X+pad, box.Max.Y-pad
+    if tip.Icon != nil {
+        tip.Icon.Draw(target, pixel.IM.Scaled(pixel.ZV, scale).Moved(pixel.V(x+icon.X/2, top-icon.Y/2)))
+        x += icon.X + pad
+    }
+    y := top - atlas.Ascent()
+    if tip.Title != "" {
+        opts.Color = style.Accent
+        DrawText(target, font, tip.Title, pixel.V(x, y), opts)
+        y -= title.Y
+    }
+    if tip.Text != "" {
+        opts.Color = style.Text
+        DrawText(target, font, tip.Text, pixel.V(x, y), opts)
+    }
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+)
+
+// how far, in world units, a TopDown mover gets nudged sideways around a corner it clips
+const CORNERSLIDE = 4
+
+// moves a top-down character through collision: it slides along walls, and when it only clips a
+// corner it's nudged around it instead of stopping, like doorways in a Zelda-like. diagonals are
+// as fast as straight lines, and EightWay snaps movement to the eight directions. the entity
+// needs a Transform and a Collider.
+type TopDown struct {
+    Entity Entity
+    // top speed, and how fast it gets there and stops, per second
+    Speed, Acceleration, Deceleration float64
+    EightWay                          bool
+    // the most it's nudged around a corner; 0 turns it off
+    CornerSlide float64
+
+    Velocity pixel.Vec
+    // the way it last moved, a unit vector, for picking sprites
+    Facing pixel.Vec
+}
+
+func NewTopDown(e Entity) *TopDown {
+    return &TopDown{
+        Entity:       e,
+        Speed:        100,
+        Acceleration: 1000,
+        Deceleration: 1400,
+        CornerSlide:  CORNERSLIDE,
+        Facing:       pixel.V(0, -1),
+    }
+}
+
+// steps the character by dt, with move the direction it's pushed, up to length 1, e.g.
+// pixel.V(actions.Axis("left", "right"), actions.Axis("down", "up")). returns what it bumped into.
+func (d *TopDown) Update(move pixel.Vec, dt float64) []Contact {
+    if move.Len() > 1 {
+        move = move.Unit()
+    }
+    if d.EightWay && move != pixel.ZV {
+        angle := math.Round(move.Angle()/(math.Pi/4)) * (math.Pi / 4)
+        move = pixel.Unit(angle).Scaled(move.Len())
+        // no sliver of sideways drift from rounding
+        if math.Abs(move.X) < 1e-9 {
+            move.X = 0
+        }
+        if math.Abs(move.Y) < 1e-9 {
+            move.Y = 0
+        }
+    }
+    accel := d.Acceleration
+    if move == pixel.ZV {
+        accel = d.Deceleration
+    }
+    d.Velocity = approachVec(d.Velocity, move.Scaled(d.Speed), accel*dt)
+    if move != pixel.ZV {
+        d.Facing = move.Unit()
+    }
+
+    var hits []Contact
+    step := d.Velocity.Scaled(dt)
+    if step.X != 0 {
+        hits = append(hits, d.moveAxis(pixel.V(step.X, 0), move.Y == 0)...)
+    }
+    if step.Y != 0 {
+        hits = append(hits, d.moveAxis(pixel.V(0, step.Y), move.X == 0)...)
+    }
+    return hits
+}
+
+// moves along one axis, sliding around a clipped corner when the player isn't steering on the
+// other axis anyway
+func (d *TopDown) moveAxis(step pixel.Vec, slide bool) []Contact {
+    c := collision
+    moved, hits := c.MoveAndCollide(d.Entity, step)
+    if len(hits) == 0 {
+        return nil
+    }
+    if slide && d.CornerSlide > 0 {
+        if nudge, ok := d.cornerNudge(hits[0], step); ok {
+            before := c.World.Get(d.Entity, TransformType).(*Transform).Position
+            // a nudge may not clear the corner in one step, and it keeps its speed for the next
+            if _, more := c.MoveAndCollide(d.Entity, nudge); len(more) == 0 {
+                _, blocked := c.MoveAndCollide(d.Entity, step.Sub(moved))
+                return blocked
+            }
+            c.Teleport(d.Entity, before)
+        }
+    }
+    if step.X != 0 {
+        d.Velocity.X = 0
+    } else {
+        d.Velocity.Y = 0
+    }
+    return hits
+}
+
+// the sideways move, no longer than the step, that gets past hit's corner, if it's within
+// CornerSlide of it
+func (d *TopDown) cornerNudge(hit Contact, step pixel.Vec) (pixel.Vec, bool) {
+    a, _ := collision.Rect(d.Entity)
+    b, _ := collision.Rect(hit.B)
+    // past b's low or high edge across the way it's moving
+    var low, high float64
+    if step.X != 0 {
+        low, high = a.Max.Y-b.Min.Y, b.Max.Y-a.Min.Y
+    } else {
+        low, high = a.Max.X-b.Min.X, b.Max.X-a.Min.X
+    }
+    amount, dir := low, -1.0
+    if high < low {
+        amount, dir = high, 1
+    }
+    if amount <= 0 || amount > d.CornerSlide {
+        return pixel.ZV, false
+    }
+    amount = math.Min(amount, step.Len())
+    if step.X != 0 {
+        return pixel.V(0, dir*amount), true
+    }
+    return pixel.V(dir*amount, 0), true
+}
+
+// moves v toward target by at most step
+func approachVec(v, target pixel.Vec, step float64) pixel.Vec {
+    diff := target.Sub(v)
+    if diff.Len() <= step {
+        return target
+    }
+    return v.Add(diff.Unit().Scaled(step))
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+)
+
+type TrailMode int
+
+const (
+    // copies of Sprite left where the entity was, e.g. for a dash
+    TrailAfterimage TrailMode = iota
+    // a strip through the recorded positions that narrows and fades towards the tail, e.g. behind a projectile
+    TrailRibbon
+)
+
+type trailPoint struct {
+    m   pixel.Matrix
+    pos pixel.Vec
+    age float64
+}
+
+// remembers an entity's recent transforms and draws them fading out behind it, all in one batch
+type Trail struct {
+    Mode TrailMode
+    // seconds each point lasts
+    Lifetime float64
+    // seconds between recorded points, 0 records every Record call
+    Interval float64
+    // skips points closer than this to the last one, so a resting entity doesn't stack copies
+    MinDistance float64
+    // 0 means unlimited
+    MaxPoints int
+    // while false Record is ignored but existing points still fade
+    Emitting bool
+
+    // interpolated from the newest point to the oldest
+    StartColor, EndColor pixel.RGBA
+    // ribbon thickness at the head and tail
+    StartWidth, EndWidth float64
+
+    // drawn for each afterimage with the transform it was recorded with
+    Sprite *pixel.Sprite
+
+    points []trailPoint
+    since  float64
+    batch  *pixel.Batch
+    imd    *imdraw.IMDraw
+}
+
+func NewTrail(mode TrailMode, lifetime float64) *Trail {
+    return &Trail{
+        Mode:       mode,
+        Lifetime:   lifetime,
+        Interval:   0.03,
+        MaxPoints:  64,
+        Emitting:   true,
+        StartColor: pixel.RGB(1, 1, 1).Scaled(0.6),
+        EndColor:   pixel.Alpha(0),
+        StartWidth: 8,
+        EndWidth:   0,
+    }
+}
+
+// afterimages of sprite, like a dash
+func NewAfterimageTrail(sprite *pixel.Sprite, lifetime float64) *Trail {
+    t := NewTrail(TrailAfterimage, lifetime)
+    t.Sprite = sprite
+    t.Interval = 0.05
+    return t
+}
+
+func (t *Trail) Len() int {
+    return len(t.points)
+}
+
+// drops every point at once
+func (t *Trail) Clear() {
+    t.points = t.points[:0]
+}
+
+// records the entity's transform this frame, the same matrix its sprite is drawn with.
+// call it after Update so the interval is measured from the latest frame.
+func (t *Trail) Record(m pixel.Matrix) {
+    if !t.Emitting {
+        return
+    }
+    pos := m.Project(pixel.ZV)
+    if n := len(t.points); n > 0 {
+        if t.since < t.Interval {
+            return
+        }
+        if t.points[n-1].pos.To(pos).Len() < t.MinDistance {
+            return
+        }
+    }
+    t.since = 0
+    t.points = append(t.points, trailPoint{m: m, pos: pos})
+    if t.MaxPoints > 0 && len(t.points) > t.MaxPoints {
+        t.points = append(t.points[:0], t.points[len(t.points)-t.MaxPoints:]...)
+    }
+}
+
+// ages points and drops the expired ones. dt is in seconds.
+func (t *Trail) Update(dt float64) {
+    t.since += dt
+    alive := t.points[:0]
+    for _, p := range t.points {
+        p.age += dt
+        if p.age < t.Lifetime {
+            alive = append(alive, p)
+        }
+    }
+    t.points = alive
+}
+
+// 0 for a fresh point up to 1 when it expires
+func (t *Trail) life(p trailPoint) float64 {
+    if t.Lifetime <= 0 {
+        return 1
+    }
+    return math.Min(1, p.age/t.Lifetime)
+}
+
+func (t *Trail) Draw(target pixel.Target) {
+    if t.Mode == TrailRibbon {
+        t.drawRibbon(target)
+    } else {
+        t.drawAfterimages(target)
+    }
+}
+
+func (t *Trail) drawAfterimages(target pixel.Target) {
+    if t.Sprite == nil {
+        return
+    }
+    if t.batch == nil {
+        t.batch = pixel.NewBatch(&pixel.TrianglesData{}, t.Sprite.Picture())
+    }
+    t.batch.Clear()
+    // oldest first so newer copies sit on top
+    for _, p := range t.points {
+        t.Sprite.DrawColorMask(t.batch, p.m, lerpRGBA(t.StartColor, t.EndColor, t.life(p)))
+    }
+    t.batch.Draw(target)
+}
+
+func (t *Trail) drawRibbon(target pixel.Target) {
+    if t.imd == nil {
+        t.imd = imdraw.New(nil)
+    }
+    t.imd.Clear()
+    if len(t.points) < 2 {
+        return
+    }
+
+    // each point gets a left and right edge vertex along the average normal of its segments
+    n := len(t.points)
+    left := make([]pixel.Vec, n)
+    right := make([]pixel.Vec, n)
+    colors := make([]pixel.RGBA, n)
+    for i, p := range t.points {
+        prev, next := p.pos, p.pos
+        if i > 0 {
+            prev = t.points[i-1].pos
+        }
+        if i < n-1 {
+            next = t.points[i+1].pos
+        }
+        dir := prev.To(next)
+        if dir.Len() == 0 {
+            dir = pixel.V(1, 0)
+        }
+        life := t.life(p)
+        half := (t.StartWidth + (t.EndWidth-t.StartWidth)*life) / 2
+        normal := dir.Unit().Normal().Scaled(half)
+        left[i], right[i] = p.pos.Add(normal), p.pos.Sub(normal)
+        colors[i] = lerpRGBA(t.StartColor, t.EndColor, life)
+    }
+    for i := 0; i < n-1; i++ {
+        t.imd.Color = colors[i]
+        t.imd.Push(left[i], right[i])
+        t.imd.Color = colors[i+1]
+        t.imd.Push(right[i+1], left[i+1])
+        t.imd.Polygon(0)
+    }
+    t.imd.Draw(target)
+}
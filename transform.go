@@ -0,0 +1,17 @@
+package main
+
+import "github.com/faiface/pixel"
+
+// where an entity is in the world. the engine's systems, like collision, read and move it, so a
+// game's own position component should be this one.
+type Transform struct {
+    Position pixel.Vec
+    // radians, counter-clockwise
+    Rotation float64
+}
+
+var TransformType = ComponentTypeOf((*Transform)(nil))
+
+func init() {
+    RegisterComponent("transform", (*Transform)(nil))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+    "image/color"
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+)
+
+type TransitionKind int
+
+const (
+    // fades out to Color, then in from it
+    TransitionFade TransitionKind = iota
+    TransitionCrossfade
+    // the incoming scene slides in over the outgoing one along Direction
+    TransitionWipe
+    // the incoming scene shows through a growing circle around Center
+    TransitionCircle
+)
+
+// blends between two scenes, each rendered into its own canvas every frame so both keep moving
+type Transition struct {
+    Kind     TransitionKind
+    Duration float64
+    Ease     EaseFunc
+    Color    color.Color
+    // unit vector the wipe travels in
+    Direction pixel.Vec
+    // circle reveal origin, in the transition's bounds
+    Center pixel.Vec
+
+    // render each scene onto the target they're given, e.g. a Renderer's Draw
+    From, To func(t RenderTarget)
+    // runs once at the halfway point, where a fade is fully covered
+    OnMidpoint func()
+    OnComplete func()
+
+    elapsed           float64
+    midpoint, done    bool
+    from, to, scratch RenderCanvas
+    imd               *imdraw.IMDraw
+}
+
+// duration is in seconds
+func NewTransition(kind TransitionKind, duration float64, bounds pixel.Rect) *Transition {
+    return &Transition{
+        Kind:      kind,
+        Duration:  duration,
+        Ease:      InOutQuad,
+        Color:     color.Black,
+        Direction: pixel.V(1, 0),
+        Center:    bounds.Center(),
+        from:      graphics.NewCanvas(bounds),
+        to:        graphics.NewCanvas(bounds),
+        scratch:   graphics.NewCanvas(bounds),
+        imd:       imdraw.New(nil),
+    }
+}
+
+func (tr *Transition) SetBounds(bounds pixel.Rect) {
+    tr.from.SetBounds(bounds)
+    tr.to.SetBounds(bounds)
+    tr.scratch.SetBounds(bounds)
+}
+
+// eased progress from 0 to 1
+func (tr *Transition) Progress() float64 {
+    if tr.Duration <= 0 {
+        return 1
+    }
+    p := math.Min(1, tr.elapsed/tr.Duration)
+    if tr.Ease != nil {
+        p = tr.Ease(p)
+    }
+    return p
+}
+
+func (tr *Transition) Done() bool {
+    return tr.done
+}
+
+// dt is in seconds
+func (tr *Transition) Update(dt float64) {
+    if tr.done {
+        return
+    }
+    tr.elapsed += dt
+    if !tr.midpoint && (tr.Duration <= 0 || tr.elapsed >= tr.Duration/2) {
+        tr.midpoint = true
+        if tr.OnMidpoint != nil {
+            tr.OnMidpoint()
+        }
+    }
+    if tr.Duration <= 0 || tr.elapsed >= tr.Duration {
+        tr.done = true
+        if tr.OnComplete != nil {
+            tr.OnComplete()
+        }
+    }
+}
+
+func (tr *Transition) render(c RenderCanvas, scene func(t RenderTarget)) {
+    c.Clear(color.Transparent)
+    if scene != nil {
+        scene(c)
+    }
+    c.SetMatrix(pixel.IM)
+}
+
+// draws the blended frame onto t
+func (tr *Transition) Draw(t ComposeTarget) {
+    p := tr.Progress()
+    bounds := tr.from.Bounds()
+    center := pixel.IM.Moved(bounds.Center())
+    t.SetMatrix(pixel.IM)
+
+    switch tr.Kind {
+    case TransitionFade:
+        // only one scene is visible at a time, so only that one is rendered
+        cover := p * 2
+        if p < 0.5 {
+            tr.render(tr.from, tr.From)
+            tr.from.Draw(t, center)
+        } else {
+            cover = (1 - p) * 2
+            tr.render(tr.to, tr.To)
+            tr.to.Draw(t, center)
+        }
+        tr.imd.Clear()
+        tr.imd.Color = pixel.ToRGBA(tr.Color).Scaled(cover)
+        tr.imd.Push(bounds.Min, bounds.Max)
+        tr.imd.Rectangle(0)
+        tr.imd.Draw(t)
+
+    case TransitionCrossfade:
+        tr.render(tr.from, tr.From)
+        tr.render(tr.to, tr.To)
+        tr.from.Draw(t, center)
+        tr.to.DrawColorMask(t, center, pixel.Alpha(p))
+
+    case TransitionWipe:
+        tr.render(tr.from, tr.From)
+        tr.render(tr.to, tr.To)
+        tr.from.Draw(t, center)
+        // the incoming scene is pushed in from the opposite side
+        dir := tr.Direction
+        if dir.Len() == 0 {
+            dir = pixel.V(1, 0)
+        }
+        dir = dir.Unit()
+        offset := pixel.V(dir.X*bounds.W(), dir.Y*bounds.H()).Scaled(p - 1)
+        tr.to.Draw(t, center.Moved(offset))
+
+    case TransitionCircle:
+        tr.render(tr.from, tr.From)
+        tr.render(tr.to, tr.To)
+        tr.from.Draw(t, center)
+        // a circle of alpha in scratch, then the incoming scene composed In so only the circle keeps it
+        corner := math.Max(
+            math.Max(tr.Center.To(bounds.Min).Len(), tr.Center.To(bounds.Max).Len()),
+            math.Max(tr.Center.To(pixel.V(bounds.Min.X, bounds.Max.Y)).Len(), tr.Center.To(pixel.V(bounds.Max.X, bounds.Min.Y)).Len()),
+        )
+        tr.scratch.Clear(color.Transparent)
+        tr.scratch.SetComposeMethod(pixel.ComposeOver)
+        if radius := corner * p; radius > 0 {
+            tr.imd.Clear()
+            tr.imd.Color = pixel.Alpha(1)
+            tr.imd.Push(tr.Center)
+            tr.imd.Circle(radius, 0)
+            tr.imd.Draw(tr.scratch)
+        }
+        tr.scratch.SetComposeMethod(pixel.ComposeIn)
+        tr.to.Draw(tr.scratch, center)
+        tr.scratch.SetComposeMethod(pixel.ComposeOver)
+        tr.scratch.Draw(t, center)
+    }
+}
@@ -0,0 +1,153 @@
+package main
+
+import "sort"
+
+// a named area that reports what walks into it on the event bus, e.g. a door, a checkpoint or
+// a cutscene start. it goes on an entity with a Transform and a Trigger Collider.
+type TriggerZone struct {
+    Name       string
+    Properties Properties
+    // reports the first entry only, then goes quiet until Fired is cleared, e.g. for a cutscene
+    Once  bool
+    Fired bool
+}
+
+var TriggerZoneType = ComponentTypeOf((*TriggerZone)(nil))
+
+func init() {
+    RegisterComponent("trigger", (*TriggerZone)(nil))
+}
+
+// published when Other starts overlapping a TriggerZone
+type TriggerEntered struct {
+    Trigger, Other Entity
+    Name           string
+}
+
+// published when Other stops overlapping a TriggerZone, or goes away
+type TriggerExited struct {
+    Trigger, Other Entity
+    Name           string
+}
+
+// one trigger's handlers, from Collisions.Trigger
+type TriggerCallbacks struct {
+    onEnter, onStay, onExit []func(other Entity)
+}
+
+func (t *TriggerCallbacks) OnEnter(fn func(other Entity)) {
+    t.onEnter = append(t.onEnter, fn)
+}
+
+// registers fn for every step other stays inside, e.g. for damage over time
+func (t *TriggerCallbacks) OnStay(fn func(other Entity)) {
+    t.onStay = append(t.onStay, fn)
+}
+
+func (t *TriggerCallbacks) OnExit(fn func(other Entity)) {
+    t.onExit = append(t.onExit, fn)
+}
+
+// the handlers for what overlaps e, a Trigger collider, e.g.
+// collision.Trigger(spikes).OnStay(func(other Entity) { hurt(other, 1) }). they go away with e.
+func (c *Collisions) Trigger(e Entity) *TriggerCallbacks {
+    if c.triggers == nil {
+        c.triggers = make(map[Entity]*TriggerCallbacks)
+    }
+    t, ok := c.triggers[e]
+    if !ok {
+        t = &TriggerCallbacks{}
+        c.triggers[e] = t
+    }
+    return t
+}
+
+type triggerPhase int
+
+const (
+    triggerEnter triggerPhase = iota
+    triggerStay
+    triggerExit
+)
+
+// passes a trigger contact on to each side that's a trigger
+func (c *Collisions) triggered(contact Contact, phase triggerPhase) {
+    c.triggerSide(contact.A, contact.B, phase)
+    c.triggerSide(contact.B, contact.A, phase)
+}
+
+func (c *Collisions) triggerSide(trigger, other Entity, phase triggerPhase) {
+    if col, _ := c.World.Get(trigger, ColliderType).(*Collider); col != nil && !col.Trigger {
+        return
+    }
+    zone, _ := c.World.Get(trigger, TriggerZoneType).(*TriggerZone)
+    if zone != nil && zone.Once {
+        if zone.Fired || phase != triggerEnter {
+            return
+        }
+        zone.Fired = true
+    }
+    if cb := c.triggers[trigger]; cb != nil {
+        handlers := cb.onStay
+        switch phase {
+        case triggerEnter:
+            handlers = cb.onEnter
+        case triggerExit:
+            handlers = cb.onExit
+        }
+        for _, fn := range handlers {
+            fn(other)
+        }
+    }
+    if zone != nil && phase == triggerEnter {
+        events.Publish(TriggerEntered{trigger, other, zone.Name})
+    }
+    if zone != nil && phase == triggerExit {
+        events.Publish(TriggerExited{trigger, other, zone.Name})
+    }
+}
+
+// drops the handlers of triggers that are gone
+func (c *Collisions) pruneTriggers() {
+    for e := range c.triggers {
+        if !c.World.Has(e, ColliderType) {
+            delete(c.triggers, e)
+        }
+    }
+}
+
+// makes a trigger zone for every rectangle object in g, named after the object's name, or its
+// type when it has none, and carrying its properties; e.g. the "triggers" group of a TMX map
+func (c *Collisions) AddTriggers(g *ObjectGroup) []Entity {
+    if c.World == nil {
+        return nil
+    }
+    var entities []Entity
+    for _, o := range g.Objects {
+        if o.Shape != ShapeRect || o.Rect.Area() == 0 {
+            continue
+        }
+        name := o.Name
+        if name == "" {
+            name = o.Type
+        }
+        e := c.World.Create()
+        c.World.Add(e,
+            &Transform{Position: o.Rect.Center()},
+            &Collider{Size: o.Rect.Size(), Trigger: true, Static: true},
+            &TriggerZone{Name: name, Properties: o.Properties, Once: o.Properties.Bool("once")},
+        )
+        entities = append(entities, e)
+    }
+    return entities
+}
+
+// pairs in a set order, so exits fire the same way every run
+func sortPairs(pairs []contactPair) {
+    sort.Slice(pairs, func(i, j int) bool {
+        if pairs[i].a != pairs[j].a {
+            return pairs[i].a.index() < pairs[j].a.index()
+        }
+        return pairs[i].b.index() < pairs[j].b.index()
+    })
+}
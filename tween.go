@@ -0,0 +1,321 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+)
+
+// maps linear progress in [0, 1] onto eased progress
+type EaseFunc func(t float64) float64
+
+func Linear(t float64) float64 { return t }
+
+func InQuad(t float64) float64    { return t * t }
+func OutQuad(t float64) float64   { return 1 - (1-t)*(1-t) }
+func InOutQuad(t float64) float64 { return inOut(InQuad, t) }
+
+func InCubic(t float64) float64    { return t * t * t }
+func OutCubic(t float64) float64   { return 1 - math.Pow(1-t, 3) }
+func InOutCubic(t float64) float64 { return inOut(InCubic, t) }
+
+func InSine(t float64) float64    { return 1 - math.Cos(t*math.Pi/2) }
+func OutSine(t float64) float64   { return math.Sin(t * math.Pi / 2) }
+func InOutSine(t float64) float64 { return -(math.Cos(math.Pi*t) - 1) / 2 }
+
+func InExpo(t float64) float64 {
+    if t == 0 {
+        return 0
+    }
+    return math.Pow(2, 10*t-10)
+}
+
+func OutExpo(t float64) float64 {
+    if t == 1 {
+        return 1
+    }
+    return 1 - math.Pow(2, -10*t)
+}
+
+func InOutExpo(t float64) float64 { return inOut(InExpo, t) }
+
+const backOvershoot = 1.70158
+
+func InBack(t float64) float64    { return (backOvershoot+1)*t*t*t - backOvershoot*t*t }
+func OutBack(t float64) float64   { return 1 - InBack(1-t) }
+func InOutBack(t float64) float64 { return inOut(InBack, t) }
+
+func OutBounce(t float64) float64 {
+    const n, d = 7.5625, 2.75
+    switch {
+    case t < 1/d:
+        return n * t * t
+    case t < 2/d:
+        t -= 1.5 / d
+        return n*t*t + 0.75
+    case t < 2.5/d:
+        t -= 2.25 / d
+        return n*t*t + 0.9375
+    default:
+        t -= 2.625 / d
+        return n*t*t + 0.984375
+    }
+}
+
+func InBounce(t float64) float64    { return 1 - OutBounce(1-t) }
+func InOutBounce(t float64) float64 { return inOut(InBounce, t) }
+
+func OutElastic(t float64) float64 {
+    if t == 0 || t == 1 {
+        return t
+    }
+    return math.Pow(2, -10*t)*math.Sin((t*10-0.75)*(2*math.Pi/3)) + 1
+}
+
+func InElastic(t float64) float64 { return 1 - OutElastic(1-t) }
+
+// builds an in-out curve from an in curve
+func inOut(in EaseFunc, t float64) float64 {
+    if t < 0.5 {
+        return in(t*2) / 2
+    }
+    return 1 - in((1-t)*2)/2
+}
+
+// animates a value over Duration seconds. the start value is captured when the tween
+// actually begins, so chained tweens pick up where the previous one left off.
+type Tween struct {
+    Duration float64
+    Delay    float64
+    Ease     EaseFunc
+
+    begin      func() func(t float64)
+    apply      func(t float64)
+    elapsed    float64
+    started    bool
+    done       bool
+    next       *Tween
+    group      []*Tween
+    onComplete []func()
+}
+
+// tweens using fn, which is handed eased progress in [0, 1] every update
+func TweenFunc(duration float64, ease EaseFunc, fn func(t float64)) *Tween {
+    return &Tween{Duration: duration, Ease: ease, begin: func() func(float64) { return fn }}
+}
+
+func TweenFloat(target *float64, to, duration float64, ease EaseFunc) *Tween {
+    return &Tween{Duration: duration, Ease: ease, begin: func() func(float64) {
+        from := *target
+        return func(t float64) { *target = from + (to-from)*t }
+    }}
+}
+
+func TweenVec(target *pixel.Vec, to pixel.Vec, duration float64, ease EaseFunc) *Tween {
+    return &Tween{Duration: duration, Ease: ease, begin: func() func(float64) {
+        from := *target
+        return func(t float64) { *target = pixel.Lerp(from, to, t) }
+    }}
+}
+
+func TweenColor(target *pixel.RGBA, to pixel.RGBA, duration float64, ease EaseFunc) *Tween {
+    return &Tween{Duration: duration, Ease: ease, begin: func() func(float64) {
+        from := *target
+        return func(t float64) {
+            *target = pixel.RGBA{
+                R: from.R + (to.R-from.R)*t,
+                G: from.G + (to.G-from.G)*t,
+                B: from.B + (to.B-from.B)*t,
+                A: from.A + (to.A-from.A)*t,
+            }
+        }
+    }}
+}
+
+// waits before starting, in seconds
+func (tw *Tween) Delayed(delay float64) *Tween {
+    tw.Delay = delay
+    return tw
+}
+
+// runs fn once this tween (not the rest of its chain) finishes
+func (tw *Tween) OnComplete(fn func()) *Tween {
+    tw.onComplete = append(tw.onComplete, fn)
+    return tw
+}
+
+// appends next to the end of this tween's chain, returning the head so calls can be strung together
+func (tw *Tween) Then(next *Tween) *Tween {
+    last := tw
+    for last.next != nil {
+        last = last.next
+    }
+    last.next = next
+    return tw
+}
+
+func (tw *Tween) Done() bool {
+    return tw.done
+}
+
+// advances this tween alone by dt seconds, returning the time left over once it has finished
+func (tw *Tween) Update(dt float64) float64 {
+    if tw.done {
+        return dt
+    }
+    if tw.Delay > 0 {
+        if dt < tw.Delay {
+            tw.Delay -= dt
+            return 0
+        }
+        dt -= tw.Delay
+        tw.Delay = 0
+    }
+    if !tw.started {
+        tw.started = true
+        tw.apply = tw.begin()
+    }
+
+    if tw.group != nil {
+        return tw.updateGroup(dt)
+    }
+
+    tw.elapsed += dt
+    progress := 1.0
+    if tw.Duration > 0 {
+        progress = math.Min(tw.elapsed/tw.Duration, 1)
+    }
+    ease := tw.Ease
+    if ease == nil {
+        ease = Linear
+    }
+    tw.apply(ease(progress))
+
+    if progress < 1 {
+        return 0
+    }
+    tw.finish()
+    return tw.elapsed - tw.Duration
+}
+
+func (tw *Tween) finish() {
+    tw.done = true
+    for _, fn := range tw.onComplete {
+        fn()
+    }
+}
+
+func (tw *Tween) updateGroup(dt float64) float64 {
+    leftover := dt
+    running := false
+    for i, chain := range tw.group {
+        if chain == nil {
+            continue
+        }
+        var rest float64
+        tw.group[i], rest = updateChain(chain, dt)
+        if tw.group[i] != nil {
+            running = true
+        } else if rest < leftover {
+            leftover = rest
+        }
+    }
+    if running {
+        return 0
+    }
+    tw.finish()
+    return leftover
+}
+
+// runs a chain of tweens for dt, returning the tween still running (nil once the chain is
+// finished) and any time left over
+func updateChain(tw *Tween, dt float64) (*Tween, float64) {
+    for tw != nil {
+        dt = tw.Update(dt)
+        if !tw.done {
+            return tw, 0
+        }
+        tw = tw.next
+    }
+    return nil, dt
+}
+
+// runs several tweens (and their chains) at once, finishing when the last of them does
+func Parallel(tweens ...*Tween) *Tween {
+    group := make([]*Tween, len(tweens))
+    copy(group, tweens)
+    return &Tween{
+        group: group,
+        begin: func() func(float64) { return nil },
+    }
+}
+
+// a pause in a chain, in seconds
+func Wait(duration float64) *Tween {
+    return TweenFunc(duration, Linear, func(float64) {})
+}
+
+type activeTween struct {
+    tween      *Tween
+    unpausable bool
+}
+
+// runs tweens added to it from the main loop's Update
+type Tweener struct {
+    // holds every tween except the unpausable ones where they are
+    Paused bool
+
+    active []activeTween
+}
+
+func NewTweener() *Tweener {
+    return &Tweener{}
+}
+
+// starts tw and everything chained after it
+func (t *Tweener) Add(tw *Tween) *Tween {
+    t.active = append(t.active, activeTween{tween: tw})
+    return tw
+}
+
+// like Add, but the chain keeps running while the Tweener is paused, e.g. for pause menu animations
+func (t *Tweener) AddUnpausable(tw *Tween) *Tween {
+    t.active = append(t.active, activeTween{tween: tw, unpausable: true})
+    return tw
+}
+
+func (t *Tweener) Update(dt float64) {
+    // tweens added during the update, e.g. from OnComplete, start on the next one
+    n := len(t.active)
+    list := t.active
+    running := list[:0]
+    for _, a := range list {
+        if t.Paused && !a.unpausable {
+            running = append(running, a)
+            continue
+        }
+        if current, _ := updateChain(a.tween, dt); current != nil {
+            running = append(running, activeTween{current, a.unpausable})
+        }
+    }
+    // clear the tails so finished tweens can be collected
+    for i := len(running); i < n; i++ {
+        list[i] = activeTween{}
+    }
+    if len(t.active) > n {
+        running = append(running, t.active[n:]...)
+    }
+    for i := len(running); i < len(t.active); i++ {
+        t.active[i] = activeTween{}
+    }
+    t.active = running
+}
+
+// drops every running tween, leaving values wherever they currently are
+func (t *Tweener) Clear() {
+    t.active = nil
+}
+
+func (t *Tweener) Len() int {
+    return len(t.active)
+}
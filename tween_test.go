@@ -0,0 +1,53 @@
+package main
+
+import (
+    "math"
+    "testing"
+)
+
+func TestTweenerAddFromOnComplete(t *testing.T) {
+    tw := NewTweener()
+    var x, y float64
+    tw.Add(TweenFloat(&y, 1, 1, Linear))
+    tw.Add(Wait(0.1).OnComplete(func() {
+        tw.Add(TweenFloat(&x, 1, 0.1, Linear))
+    }))
+
+    tw.Update(0.1)
+    if tw.Len() != 2 {
+        t.Fatalf("%d tweens after the wait, want the long one and the one its callback added", tw.Len())
+    }
+    if x != 0 {
+        t.Errorf("x is %v, the added tween shouldn't run until the next update", x)
+    }
+    tw.Update(0.05)
+    if math.Abs(x-0.5) > 1e-9 {
+        t.Errorf("x is %v halfway through, want 0.5", x)
+    }
+    tw.Update(0.05)
+    if x != 1 || tw.Len() != 1 {
+        t.Errorf("x is %v with %d tweens left, want 1 and just the long one", x, tw.Len())
+    }
+    if math.Abs(y-0.2) > 1e-9 {
+        t.Errorf("y is %v, the long tween should have kept going to 0.2", y)
+    }
+}
+
+func TestTweenerPausedKeepsAdded(t *testing.T) {
+    tw := NewTweener()
+    var x float64
+    tw.AddUnpausable(Wait(0.1).OnComplete(func() {
+        tw.Add(TweenFloat(&x, 1, 0.1, Linear))
+    }))
+    tw.Paused = true
+    tw.Update(0.1)
+    tw.Update(0.1)
+    if x != 0 || tw.Len() != 1 {
+        t.Errorf("x is %v with %d tweens, want the added one held by the pause", x, tw.Len())
+    }
+    tw.Paused = false
+    tw.Update(0.1)
+    if x != 1 || tw.Len() != 0 {
+        t.Errorf("x is %v with %d tweens after resuming, want 1 and none", x, tw.Len())
+    }
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+    "image/color"
+    "math"
+    "strings"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// how many presses of left or right take a focused slider from one end to the other
+const SLIDERSTEPS = 20
+
+// colors and sizes for UI, in virtual pixels
+type UIStyle struct {
+    Panel, Widget, Hovered, Pressed color.Color
+    // the focus outline, a slider's fill and a checked box
+    Accent color.Color
+    Text   color.Color
+    // around a panel's contents, and between widgets
+    Padding, Spacing float64
+    // how tall a widget is
+    RowHeight float64
+}
+
+func DefaultUIStyle() UIStyle {
+    return UIStyle{
+        Panel:     pixel.RGBA{R: 0.05, G: 0.05, B: 0.08, A: 0.85},
+        Widget:    pixel.RGB(0.2, 0.2, 0.25),
+        Hovered:   pixel.RGB(0.3, 0.3, 0.38),
+        Pressed:   pixel.RGB(0.14, 0.14, 0.18),
+        Accent:    pixel.RGB(0.45, 0.65, 1),
+        Text:      color.White,
+        Padding:   8,
+        Spacing:   4,
+        RowHeight: 24,
+    }
+}
+
+// s with its sizes multiplied by scale
+func (s UIStyle) Scaled(scale float64) UIStyle {
+    s.Padding *= scale
+    s.Spacing *= scale
+    s.RowHeight *= scale
+    return s
+}
+
+// where widgets go: down a column, or across a row split into cells
+type uiLayout struct {
+    rect pixel.Rect
+    // the top of the next row
+    cursor float64
+    // set by BeginRow
+    cells, cell int
+    rowHeight   float64
+}
+
+type uiRect struct {
+    rect  pixel.Rect
+    color color.Color
+    // 0 fills
+    thickness float64
+}
+
+type uiText struct {
+    s     string
+    pos   pixel.Vec
+    color color.Color
+    align TextAlign
+    size  float64
+}
+
+// an immediate-mode UI for menus and options screens: each frame call Begin with the frame's
+// input, then a function per widget, which draws it and says what happened to it, e.g.
+//
+//	ui.Begin(in)
+//	if ui.Button("Play") { ... }
+//	ui.Slider("Music", &music, 0, 1)
+//
+// then Draw in the scene's Draw. widgets are told apart by label, so two with the same label
+// need an ID after "##", like "Apply##video", which isn't shown. text is looked up with T, so it
+// shows in the player's language and IDs stay the same whichever that is. the mouse presses a widget and
+// it only counts if it's released over it; the up and down actions and Tab move the keyboard
+// focus, confirm activates, and left and right move a slider. positions are in virtual screen
+// coordinates.
+type UI struct {
+    Style   UIStyle
+    Font    *Font
+    Options TextOptions
+    // the area widgets are laid out in when there's no panel; the zero rect is the whole screen
+    Bounds pixel.Rect
+
+    // Style and the text size at the player's UI scale, which this frame is laid out with
+    style UIStyle
+    scale float64
+
+    // the widget under the pressed mouse, the one with the keyboard and the one under the mouse
+    active, focus, hover string
+    // the widgets of the previous frame, in order, for moving the focus
+    ids, previous []string
+    layouts       []uiLayout
+    rects         []uiRect
+    texts         []uiText
+
+    mouse                     pixel.Vec
+    inside, down, press, lift bool
+    confirm                   bool
+    nav, adjust               int
+    used                      bool
+
+    imd *imdraw.IMDraw
+}
+
+func NewUI() *UI {
+    return &UI{Style: DefaultUIStyle(), Options: TextOptions{Size: FONTSIZE}, imd: imdraw.New(nil)}
+}
+
+// starts a frame with in, dropping what was drawn last frame
+func (u *UI) Begin(in Input) {
+    u.mouse = screen.MousePosition(in)
+    u.inside = in.MouseInsideWindow()
+    u.down = in.Pressed(pixelgl.MouseButtonLeft)
+    u.press = in.JustPressed(pixelgl.MouseButtonLeft)
+    u.lift = in.JustReleased(pixelgl.MouseButtonLeft)
+    if !u.down && !u.lift {
+        u.active = ""
+    }
+
+    shift := in.Pressed(pixelgl.KeyLeftShift) || in.Pressed(pixelgl.KeyRightShift)
+    u.nav, u.adjust, u.confirm = 0, 0, false
+    u.hover = ""
+    switch {
+    case typing(in, pixelgl.KeyTab) && shift:
+        u.nav = -1
+    case typing(in, pixelgl.KeyTab):
+        u.nav = 1
+    }
+    if actions != nil {
+        switch {
+        case actions.JustPressed("up"):
+            u.nav = -1
+        case actions.JustPressed("down"):
+            u.nav = 1
+        }
+        switch {
+        case actions.JustPressed("left"):
+            u.adjust = -1
+        case actions.JustPressed("right"):
+            u.adjust = 1
+        }
+        u.confirm = actions.JustPressed("confirm")
+    }
+
+    // the focus moves through last frame's widgets, which are this frame's as far as it matters
+    u.previous, u.ids = u.ids, u.previous[:0]
+    if u.nav != 0 && len(u.previous) > 0 {
+        i := indexOf(u.previous, u.focus)
+        switch {
+        case i < 0 && u.nav > 0:
+            i = 0
+        case i < 0:
+            i = len(u.previous) - 1
+        default:
+            i = (i + u.nav + len(u.previous)) % len(u.previous)
+        }
+        u.focus = u.previous[i]
+    }
+    u.used = u.active != "" || u.nav != 0
+
+    u.scale = accessibility.UIScale()
+    u.style = u.Style.Scaled(u.scale)
+    bounds := u.Bounds
+    if bounds == (pixel.Rect{}) {
+        bounds = screen.Bounds()
+    }
+    u.layouts = append(u.layouts[:0], uiLayout{rect: inset(bounds, u.style.Padding), cursor: bounds.Max.Y - u.style.Padding})
+    u.rects, u.texts = u.rects[:0], u.texts[:0]
+}
+
+func indexOf(ids []string, id string) int {
+    for i, other := range ids {
+        if other == id {
+            return i
+        }
+    }
+    return -1
+}
+
+func inset(r pixel.Rect, by float64) pixel.Rect {
+    return pixel.Rect{Min: r.Min.Add(pixel.V(by, by)), Max: r.Max.Sub(pixel.V(by, by))}
+}
+
+// whether the UI took this frame's input: the mouse is over a widget or pressing one, or the
+// keyboard moved the focus. the caller can hand the rest of the frame BlockInput(in).
+func (u *UI) WantsInput() bool {
+    return u.used
+}
+
+// the widget with the keyboard's ID, or ""
+func (u *UI) Focused() string {
+    return u.focus
+}
+
+// the ID of the widget under the mouse this frame, or "", e.g. to give it a tooltip
+func (u *UI) Hovered() string {
+    return u.hover
+}
+
+// gives the keyboard to the widget with id, e.g. a menu's first button
+func (u *UI) Focus(id string) {
+    u.focus = id
+}
+
+// Style at the player's UI scale, which this frame is laid out with, e.g. to size a Panel to fit
+func (u *UI) Scaled() UIStyle {
+    return u.style
+}
+
+// splits "label##id" into what's shown, in the current language, and what identifies it
+func uiLabel(label string) (string, string) {
+    if i := strings.Index(label, "##"); i >= 0 {
+        return T(label[:i]), label
+    }
+    return T(label), label
+}
+
+func (u *UI) layout() *uiLayout {
+    return &u.layouts[len(u.layouts)-1]
+}
+
+// the rect for the next widget, height tall
+func (u *UI) next(height float64) pixel.Rect {
+    l := u.layout()
+    if l.cells == 0 {
+        r := pixel.R(l.rect.Min.X, l.cursor-height, l.rect.Max.X, l.cursor)
+        l.cursor -= height + u.style.Spacing
+        return r
+    }
+    w := (l.rect.W() - u.style.Spacing*float64(l.cells-1)) / float64(l.cells)
+    x := l.rect.Min.X + float64(l.cell)*(w+u.style.Spacing)
+    r := pixel.R(x, l.cursor-height, x+w, l.cursor)
+    l.rowHeight = math.Max(l.rowHeight, height)
+    l.cell++
+    if l.cell == l.cells {
+        l.cursor -= l.rowHeight + u.style.Spacing
+        l.cell, l.rowHeight = 0, 0
+    }
+    return r
+}
+
+// lays the widgets that follow side by side, cells to a row, until EndRow
+func (u *UI) BeginRow(cells int) {
+    u.EndRow()
+    if cells > 0 {
+        u.layout().cells = cells
+    }
+}
+
+func (u *UI) EndRow() {
+    l := u.layout()
+    if l.cell > 0 {
+        l.cursor -= l.rowHeight + u.style.Spacing
+    }
+    l.cells, l.cell, l.rowHeight = 0, 0, 0
+}
+
+// draws a panel at r and lays the widgets that follow down a column inside it, until EndPanel.
+// a zero rect takes the next height pixels of the layout it's in.
+func (u *UI) BeginPanel(r pixel.Rect, height float64) {
+    if r == (pixel.Rect{}) {
+        r = u.next(height)
+    }
+    u.rects = append(u.rects, uiRect{rect: r, color: u.style.Panel})
+    if r.Contains(u.mouse) && u.inside {
+        u.used = true
+    }
+    u.layouts = append(u.layouts, uiLayout{rect: inset(r, u.style.Padding), cursor: r.Max.Y - u.style.Padding})
+}
+
+func (u *UI) EndPanel() {
+    if len(u.layouts) > 1 {
+        u.layouts = u.layouts[:len(u.layouts)-1]
+    }
+}
+
+// leaves height pixels empty
+func (u *UI) Space(height float64) {
+    u.next(height)
+}
+
+// hover, press and focus for the widget id at r; whether it was clicked or confirmed
+func (u *UI) interact(id string, r pixel.Rect) (hovered, clicked bool) {
+    u.ids = append(u.ids, id)
+    hovered = u.inside && r.Contains(u.mouse) && (u.active == "" || u.active == id)
+    if hovered {
+        u.used, u.hover = true, id
+        if u.press {
+            u.active, u.focus = id, id
+        }
+    }
+    if u.active == id && u.lift {
+        clicked = hovered
+        u.active = ""
+    }
+    if u.focus == id && u.confirm {
+        clicked = true
+        u.used = true
+    }
+    return hovered, clicked
+}
+
+// the widget's fill for its state, and its focus outline
+func (u *UI) box(id string, r pixel.Rect, hovered bool) {
+    fill := u.style.Widget
+    switch {
+    case u.active == id && hovered:
+        fill = u.style.Pressed
+    case hovered:
+        fill = u.style.Hovered
+    }
+    u.rects = append(u.rects, uiRect{rect: r, color: fill})
+    if u.focus == id {
+        u.rects = append(u.rects, uiRect{rect: r, color: u.style.Accent, thickness: 1})
+    }
+}
+
+// text vertically centered in r, starting at x
+func (u *UI) text(s string, r pixel.Rect, x float64, align TextAlign) {
+    u.sizedText(s, r, x, align, u.scale*u.Options.size())
+}
+
+func (u *UI) sizedText(s string, r pixel.Rect, x float64, align TextAlign, size float64) {
+    atlas, err := u.font().Atlas(size)
+    if err != nil {
+        return
+    }
+    baseline := r.Center().Y - (atlas.Ascent()+atlas.Descent())/2 + atlas.Descent()
+    u.texts = append(u.texts, uiText{s: s, pos: pixel.V(x, baseline), color: u.style.Text, align: align, size: size})
+}
+
+func (u *UI) font() *Font {
+    if u.Font == nil {
+        return DefaultFont()
+    }
+    return u.Font
+}
+
+// a line of text
+func (u *UI) Label(s string) {
+    r := u.next(u.style.RowHeight)
+    u.text(T(s), r, r.Min.X, AlignLeft)
+}
+
+// a line of text twice the size, centered, for a screen's title
+func (u *UI) Title(s string) {
+    r := u.next(2 * u.style.RowHeight)
+    u.sizedText(T(s), r, r.Center().X, AlignCenter, 2*u.scale*u.Options.size())
+}
+
+// a button, true on the frame it's clicked or confirmed
+func (u *UI) Button(label string) bool {
+    shown, id := uiLabel(label)
+    r := u.next(u.style.RowHeight)
+    hovered, clicked := u.interact(id, r)
+    u.box(id, r, hovered)
+    u.text(shown, r, r.Center().X, AlignCenter)
+    return clicked
+}
+
+// a box ticked while *value, flipped by clicking; true when it changed
+func (u *UI) Checkbox(label string, value *bool) bool {
+    shown, id := uiLabel(label)
+    r := u.next(u.style.RowHeight)
+    hovered, clicked := u.interact(id, r)
+    if clicked {
+        *value = !*value
+    }
+    size := r.H() - 2*u.style.Spacing
+    check := pixel.R(r.Min.X+u.style.Spacing, r.Min.Y+u.style.Spacing, r.Min.X+u.style.Spacing+size, r.Max.Y-u.style.Spacing)
+    u.box(id, r, hovered)
+    u.rects = append(u.rects, uiRect{rect: check, color: u.style.Pressed})
+    if *value {
+        u.rects = append(u.rects, uiRect{rect: inset(check, 3), color: u.style.Accent})
+    }
+    u.text(shown, r, check.Max.X+u.style.Padding, AlignLeft)
+    return clicked
+}
+
+// an on/off switch at the right of its row, like Checkbox; true when it changed
+func (u *UI) Toggle(label string, value *bool) bool {
+    shown, id := uiLabel(label)
+    r := u.next(u.style.RowHeight)
+    hovered, clicked := u.interact(id, r)
+    if clicked {
+        *value = !*value
+    }
+    u.box(id, r, hovered)
+    h := r.H() - 2*u.style.Spacing
+    track := pixel.R(r.Max.X-u.style.Spacing-2*h, r.Min.Y+u.style.Spacing, r.Max.X-u.style.Spacing, r.Max.Y-u.style.Spacing)
+    u.rects = append(u.rects, uiRect{rect: track, color: u.style.Pressed})
+    knob := pixel.R(track.Min.X, track.Min.Y, track.Min.X+h, track.Max.Y)
+    if *value {
+        knob = pixel.R(track.Max.X-h, track.Min.Y, track.Max.X, track.Max.Y)
+        u.rects = append(u.rects, uiRect{rect: track, color: u.style.Accent, thickness: 1})
+    }
+    u.rects = append(u.rects, uiRect{rect: inset(knob, 2), color: u.style.Text})
+    u.text(shown, r, r.Min.X+u.style.Padding, AlignLeft)
+    return clicked
+}
+
+// a slider setting *value between lo and hi, labelled on its left half; dragging or left and
+// right while focused move it. true when it changed.
+func (u *UI) Slider(label string, value *float64, lo, hi float64) bool {
+    shown, id := uiLabel(label)
+    r := u.next(u.style.RowHeight)
+    hovered, _ := u.interact(id, r)
+    track := pixel.R(r.Center().X, r.Min.Y+u.style.Spacing, r.Max.X-u.style.Spacing, r.Max.Y-u.style.Spacing)
+    old := *value
+    if u.active == id && u.down && track.W() > 0 {
+        t := math.Max(0, math.Min(1, (u.mouse.X-track.Min.X)/track.W()))
+        *value = lo + t*(hi-lo)
+    }
+    if u.focus == id && u.adjust != 0 {
+        *value = *value + float64(u.adjust)*(hi-lo)/SLIDERSTEPS
+        u.used = true
+    }
+    *value = math.Max(math.Min(lo, hi), math.Min(math.Max(lo, hi), *value))
+
+    u.box(id, r, hovered)
+    u.rects = append(u.rects, uiRect{rect: track, color: u.style.Pressed})
+    if hi != lo {
+        t := (*value - lo) / (hi - lo)
+        u.rects = append(u.rects, uiRect{rect: pixel.R(track.Min.X, track.Min.Y, track.Min.X+t*track.W(), track.Max.Y), color: u.style.Accent})
+    }
+    u.text(shown, r, r.Min.X+u.style.Padding, AlignLeft)
+    return *value != old
+}
+
+// draws everything since Begin
+func (u *UI) Draw(t RenderTarget) {
+    t.SetMatrix(pixel.IM)
+    u.imd.Clear()
+    for _, r := range u.rects {
+        u.imd.Color = r.color
+        u.imd.Push(r.rect.Min, r.rect.Max)
+        u.imd.Rectangle(r.thickness)
+    }
+    u.imd.Draw(t)
+    for _, txt := range u.texts {
+        opts := u.Options
+        opts.Color, opts.Align, opts.Size = txt.color, txt.align, txt.size
+        DrawText(t, u.Font, txt.s, txt.pos, opts)
+    }
+}
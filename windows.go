@@ -0,0 +1,348 @@
+package main
+
+import (
+    "fmt"
+    "image/color"
+    "math"
+    "reflect"
+    "sort"
+    "strings"
+    "sync"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/imdraw"
+    "github.com/faiface/pixel/pixelgl"
+    "golang.org/x/image/colornames"
+)
+
+var windowsLog = logging.Module("windows")
+
+// a second OS window next to the game's, for tooling like an inspector or a live map view.
+// Windows creates, draws and destroys it on the main thread between the game's frames.
+type ToolWindow struct {
+    Title  string
+    Bounds pixel.Rect
+    // black when nil
+    Background color.Color
+    // draws the contents each frame, in the window's own pixels; t is the window, so it reads
+    // its own keys and mouse too. the picture shows up a frame late.
+    Draw func(t *pixelgl.Window)
+    // runs once it's gone, whether Close was called or the player closed it
+    OnClose func()
+
+    // the tool it was opened as, if any
+    tool    string
+    ws      *Windows
+    win     *pixelgl.Window
+    closing bool
+}
+
+// asks for the window to go; it's destroyed on the next Windows.Update
+func (w *ToolWindow) Close() {
+    if w.ws == nil {
+        return
+    }
+    w.ws.mu.Lock()
+    w.closing = true
+    w.ws.mu.Unlock()
+}
+
+// the OS window, nil until it's been created
+func (w *ToolWindow) Window() *pixelgl.Window {
+    return w.win
+}
+
+// the tool windows. every GL window has its own context with pixelgl, and one only becomes
+// current when it swaps, so Update does all their work in one place: after the game's frame
+// is drawn and before the game's window swaps, which makes that current again for the next.
+type Windows struct {
+    mu      sync.Mutex
+    pending []*ToolWindow
+    open    []*ToolWindow
+    tools   map[string]func() *ToolWindow
+}
+
+func NewWindows() *Windows {
+    ws := &Windows{tools: map[string]func() *ToolWindow{}}
+    ws.Register("debug", DebugWindow)
+    return ws
+}
+
+// names a window maker so "window <name>" can open and close it
+func (ws *Windows) Register(name string, fn func() *ToolWindow) {
+    ws.tools[name] = fn
+}
+
+// registered tool names, sorted
+func (ws *Windows) Tools() []string {
+    names := make([]string, 0, len(ws.tools))
+    for name := range ws.tools {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// queues w to be created on the next Update; safe from any goroutine
+func (ws *Windows) Open(w *ToolWindow) *ToolWindow {
+    ws.mu.Lock()
+    defer ws.mu.Unlock()
+    w.ws, w.closing = ws, false
+    ws.pending = append(ws.pending, w)
+    return w
+}
+
+// the window open, or about to be, as the named tool
+func (ws *Windows) Tool(name string) *ToolWindow {
+    ws.mu.Lock()
+    defer ws.mu.Unlock()
+    for _, list := range [][]*ToolWindow{ws.open, ws.pending} {
+        for _, w := range list {
+            if w.tool == name && !w.closing {
+                return w
+            }
+        }
+    }
+    return nil
+}
+
+// opens the named tool, or closes it when it's already open, and reports whether it's open now
+func (ws *Windows) Toggle(name string) (bool, error) {
+    if w := ws.Tool(name); w != nil {
+        w.Close()
+        return false, nil
+    }
+    fn, ok := ws.tools[name]
+    if !ok {
+        return false, fmt.Errorf("no window %q", name)
+    }
+    w := fn()
+    w.tool = name
+    ws.Open(w)
+    return true, nil
+}
+
+// whether any tool window has the keyboard
+func (ws *Windows) Focused() bool {
+    for _, w := range ws.open {
+        if w.win != nil && w.win.Focused() {
+            return true
+        }
+    }
+    return false
+}
+
+// in, but still focused while a tool window is, so clicking into one doesn't auto-pause
+func (ws *Windows) Input(in Input) Input {
+    return toolFocusInput{in, ws}
+}
+
+type toolFocusInput struct {
+    Input
+    ws *Windows
+}
+
+func (t toolFocusInput) Focused() bool {
+    return t.Input.Focused() || t.ws.Focused()
+}
+
+// creates the queued windows, shows and redraws the open ones and destroys the closed ones.
+// call it on the main thread once a frame, after drawing the game's window and before its Update.
+func (ws *Windows) Update() {
+    ws.mu.Lock()
+    var pending []*ToolWindow
+    for _, w := range ws.pending {
+        if !w.closing {
+            pending = append(pending, w)
+        }
+    }
+    ws.pending = nil
+    ws.mu.Unlock()
+    // created first, while the game's window is still the current context they share with
+    for _, w := range pending {
+        bounds := w.Bounds
+        if bounds.W() <= 0 || bounds.H() <= 0 {
+            bounds = pixel.R(0, 0, 400, 300)
+        }
+        win, err := pixelgl.NewWindow(pixelgl.WindowConfig{
+            Title:     w.Title,
+            Bounds:    bounds,
+            Resizable: true,
+        })
+        if err != nil {
+            windowsLog.Errorf("%s: %v", w.Title, err)
+            continue
+        }
+        w.win = win
+        ws.open = append(ws.open, w)
+    }
+
+    open := ws.open[:0]
+    var gone []*ToolWindow
+    for _, w := range ws.open {
+        ws.mu.Lock()
+        closing := w.closing
+        ws.mu.Unlock()
+        if closing || w.win.Closed() {
+            gone = append(gone, w)
+            continue
+        }
+        // swapping shows last frame's contents and makes the window's context current to draw the next
+        w.win.Update()
+        bg := w.Background
+        if bg == nil {
+            bg = colornames.Black
+        }
+        w.win.Clear(bg)
+        if w.Draw != nil {
+            w.win.SetMatrix(pixel.IM)
+            w.Draw(w.win)
+        }
+        open = append(open, w)
+    }
+    ws.open = open
+    // last, since the game's window has to swap before anything else is created
+    for _, w := range gone {
+        ws.destroy(w)
+    }
+}
+
+func (ws *Windows) destroy(w *ToolWindow) {
+    w.win.Destroy()
+    w.win = nil
+    if w.OnClose != nil {
+        w.OnClose()
+    }
+}
+
+// destroys every tool window, when the game's closing
+func (ws *Windows) CloseAll() {
+    for _, w := range ws.open {
+        ws.destroy(w)
+    }
+    ws.open = nil
+    ws.mu.Lock()
+    ws.pending = nil
+    ws.mu.Unlock()
+}
+
+const TOOLPAD = 8
+
+// writes lines from the top-left of t, as many as fit
+func drawToolLines(t pixel.Target, bounds pixel.Rect, lines []string, opts TextOptions) {
+    pos := pixel.V(bounds.Min.X+TOOLPAD, bounds.Max.Y-TOOLPAD-opts.size())
+    for _, line := range lines {
+        if pos.Y < bounds.Min.Y {
+            return
+        }
+        DrawText(t, nil, line, pos, opts)
+        pos.Y -= opts.size() + 3
+    }
+}
+
+// the debug overlay's numbers and watches in their own window, so they don't cover the game
+func DebugWindow() *ToolWindow {
+    return &ToolWindow{
+        Title:  "Debug",
+        Bounds: pixel.R(0, 0, 360, 420),
+        Draw: func(t *pixelgl.Window) {
+            drawToolLines(t, t.Bounds(), debug.lines(), TextOptions{Size: 13})
+        },
+    }
+}
+
+// a live list of world's entities, Up and Down picking one to show its components in full
+func InspectorWindow(world *World) *ToolWindow {
+    selected := 0
+    return &ToolWindow{
+        Title:  "Inspector",
+        Bounds: pixel.R(0, 0, 480, 600),
+        Draw: func(t *pixelgl.Window) {
+            entities := world.Query()
+            sort.Slice(entities, func(i, j int) bool { return entities[i].index() < entities[j].index() })
+            if t.Repeated(pixelgl.KeyDown) || t.JustPressed(pixelgl.KeyDown) {
+                selected++
+            }
+            if t.Repeated(pixelgl.KeyUp) || t.JustPressed(pixelgl.KeyUp) {
+                selected--
+            }
+            selected = int(math.Max(0, math.Min(float64(selected), float64(len(entities)-1))))
+
+            opts := TextOptions{Size: 12}
+            lines := []string{fmt.Sprintf("%d entities", len(entities))}
+            // a window's worth of the list around the selection
+            rows := 12
+            first := int(math.Max(0, float64(selected-rows/2)))
+            for i := first; i < len(entities) && i < first+rows; i++ {
+                var names []string
+                for _, c := range world.Components(entities[i]) {
+                    names = append(names, reflect.TypeOf(c).Elem().Name())
+                }
+                mark := "  "
+                if i == selected {
+                    mark = "> "
+                }
+                lines = append(lines, mark+entities[i].String()+"  "+strings.Join(names, " "))
+            }
+            if len(entities) > 0 {
+                lines = append(lines, "")
+                for _, c := range world.Components(entities[selected]) {
+                    lines = append(lines, fmt.Sprintf("%s %+v", reflect.TypeOf(c).Elem().Name(), reflect.ValueOf(c).Elem().Interface()))
+                }
+            }
+            drawToolLines(t, t.Bounds(), lines, opts)
+        },
+    }
+}
+
+// the whole of m scaled to fit, with what cam sees outlined when it's set
+func MapWindow(m *TileMap, cam *Camera) *ToolWindow {
+    imd := imdraw.New(nil)
+    return &ToolWindow{
+        Title:  "Map",
+        Bounds: pixel.R(0, 0, 480, 480),
+        Draw: func(t *pixelgl.Window) {
+            world, view := m.Bounds(), t.Bounds()
+            if world.W() <= 0 || world.H() <= 0 {
+                return
+            }
+            scale := math.Min(view.W()/world.W(), view.H()/world.H())
+            t.SetMatrix(pixel.IM.Moved(world.Center().Scaled(-1)).Scaled(pixel.ZV, scale).Moved(view.Center()))
+            m.Draw(t)
+            if cam != nil {
+                imd.Clear()
+                imd.Color = colornames.Red
+                visible := cam.VisibleRect()
+                imd.Push(visible.Min, visible.Max)
+                imd.Rectangle(2 / scale)
+                imd.Draw(t)
+            }
+            t.SetMatrix(pixel.IM)
+        },
+    }
+}
+
+func registerWindowCommands(c *Console, ws *Windows) {
+    c.Register("window", "opens or closes a tool window, or lists them", func(args ConsoleArgs) error {
+        if !args.Has(0) {
+            for _, name := range ws.Tools() {
+                mark := " "
+                if ws.Tool(name) != nil {
+                    mark = "x"
+                }
+                c.Printf("[%s] %s", mark, name)
+            }
+            return nil
+        }
+        open, err := ws.Toggle(args.String(0))
+        if err != nil {
+            return err
+        }
+        if open {
+            c.Printf("%s window opened", args.String(0))
+        } else {
+            c.Printf("%s window closed", args.String(0))
+        }
+        return nil
+    }, StringArg("name").Opt())
+}
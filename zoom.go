@@ -0,0 +1,99 @@
+package main
+
+import (
+    "math"
+
+    "github.com/faiface/pixel"
+    "github.com/faiface/pixel/pixelgl"
+)
+
+// zoom steps per notch of the mouse wheel; a step of 1 zooms by e
+const ZOOMWHEELSTEP = 0.1
+
+// zoom steps per second with + or - held
+const ZOOMKEYRATE = 1.5
+
+// how strongly each source zooms, 1 as shipped; negative flips a wheel that feels backwards
+type ZoomSettings struct {
+    Wheel float64 `json:"wheel"`
+    Pinch float64 `json:"pinch"`
+    Keys  float64 `json:"keys"`
+}
+
+func DefaultZoomSettings() ZoomSettings {
+    return ZoomSettings{Wheel: 1, Pinch: 1, Keys: 1}
+}
+
+// the mouse wheel, trackpad pinch and the + and - keys as one zoom signal, so camera code reads
+// Delta instead of handling each. Delta is in steps, positive zooming in; Camera.ZoomAt takes
+// Factor. GLFW reports trackpad pinches as scrolling on most platforms, so they arrive through the
+// wheel; Pinch is for a platform layer that tells them apart.
+type ZoomInput struct {
+    Sensitivity ZoomSettings
+    Enabled     bool
+    // this frame's zoom
+    Delta float64
+    // the virtual screen point to zoom around: the mouse for the wheel, the middle for keys
+    Anchor pixel.Vec
+
+    pinch float64
+}
+
+func NewZoomInput() *ZoomInput {
+    return &ZoomInput{Sensitivity: DefaultZoomSettings(), Enabled: true}
+}
+
+// adds a pinch gesture's scale change, above 1 for fingers spreading
+func (z *ZoomInput) Pinch(scale float64) {
+    if scale > 0 {
+        z.pinch += math.Log(scale)
+    }
+}
+
+// reads this frame's zoom from in, dt in real seconds; simulate calls it every frame
+func (z *ZoomInput) Update(in Input, dt float64) {
+    z.Delta = 0
+    pinch := z.pinch
+    z.pinch = 0
+    if !z.Enabled {
+        return
+    }
+    z.Anchor = screen.Bounds().Center()
+    keys := 0.0
+    if in.Pressed(pixelgl.KeyEqual) || in.Pressed(pixelgl.KeyKPAdd) {
+        keys++
+    }
+    if in.Pressed(pixelgl.KeyMinus) || in.Pressed(pixelgl.KeyKPSubtract) {
+        keys--
+    }
+    z.Delta += keys * ZOOMKEYRATE * dt * z.Sensitivity.Keys
+
+    wheel := in.MouseScroll().Y*ZOOMWHEELSTEP*z.Sensitivity.Wheel + pinch*z.Sensitivity.Pinch
+    if wheel != 0 {
+        z.Delta += wheel
+        z.Anchor = screen.MousePosition(in)
+    }
+}
+
+// the zoom as a multiplier for Camera.Zoom, 1 when there's none
+func (z *ZoomInput) Factor() float64 {
+    return math.Exp(z.Delta)
+}
+
+// multiplies Zoom by factor, keeping the world point under screen anchor where it was, then
+// keeps it within ZoomMin and ZoomMax, e.g. camera.ZoomAt(zoom.Factor(), zoom.Anchor)
+func (c *Camera) ZoomAt(factor float64, anchor pixel.Vec) {
+    if factor <= 0 || factor == 1 {
+        return
+    }
+    before := c.ScreenToWorld(anchor)
+    c.Zoom = c.zoom() * factor
+    if c.ZoomMin > 0 && c.Zoom < c.ZoomMin {
+        c.Zoom = c.ZoomMin
+    }
+    if c.ZoomMax > 0 && c.Zoom > c.ZoomMax {
+        c.Zoom = c.ZoomMax
+    }
+    c.Position = c.Position.Add(before.Sub(c.ScreenToWorld(anchor)))
+    c.Clamp()
+}